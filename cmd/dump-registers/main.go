@@ -0,0 +1,310 @@
+// dump-registers reads all documented registers of JasperMate IO cards (identity, config, IO), as listed
+// by the model spec of each card, and prints them as JSON together with per-request diagnostics (raw
+// words, response time, errors), for attaching to support tickets when card behavior is unexplained.
+//
+// Build (to dist/):
+//   One-off command: mkdir -p dist && go build -o dist/dump-registers ./cmd/dump-registers
+//   Or: make dump-registers
+//
+// Usage:
+//   go run ./cmd/dump-registers
+//   go run ./cmd/dump-registers -port=/dev/ttyS7 -baud=115200 -slaves=1,2 > cards.json
+//
+// Stop the jm-utils service first; it holds the serial port while running.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goburrow/modbus"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+const (
+	aoTypeRegAddr  = 0x0190 // Probed for AO channels, like the service's model detection
+	maxChannels    = 8
+	operationDelay = 5 * time.Millisecond
+)
+
+// Dump is the tool output
+type Dump struct {
+	Port      string     `json:"port"`
+	BaudRate  int        `json:"baudRate"`
+	Timestamp time.Time  `json:"timestamp"`
+	Cards     []CardDump `json:"cards"`
+}
+
+// CardDump holds everything read from one slave
+type CardDump struct {
+	SlaveID  byte   `json:"slaveId"`
+	Model    string `json:"model"`
+	Identity struct {
+		SerialNumber string `json:"serialNumber"`
+	} `json:"identity"`
+	Config struct {
+		BaudRate int      `json:"baudRate,omitempty"`
+		AOType   []string `json:"aoType,omitempty"`
+	} `json:"config"`
+	IO struct {
+		DI []bool    `json:"di,omitempty"`
+		DO []bool    `json:"do,omitempty"`
+		AI []float32 `json:"ai,omitempty"`
+		AO []float32 `json:"ao,omitempty"`
+	} `json:"io"`
+	// Diagnostics lists every request with its raw response, duration, and error
+	Diagnostics []RegisterRead `json:"diagnostics"`
+}
+
+// RegisterRead is one Modbus read request and its outcome
+type RegisterRead struct {
+	Name       string   `json:"name"`
+	Function   string   `json:"function"`
+	Address    string   `json:"address"`
+	Count      int      `json:"count"`
+	Raw        []string `json:"raw,omitempty"` // Registers as hex words, or coil/input bytes as hex
+	DurationMs float64  `json:"durationMs"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type reader struct {
+	client modbus.Client
+	card   *CardDump
+}
+
+func main() {
+	port := flag.String("port", "/dev/ttyS7", "Serial port (default /dev/ttyS7)")
+	baud := flag.Int("baud", 115200, "Baud rate of the cards")
+	slavesFlag := flag.String("slaves", "1,2,3,4,5", "Comma-separated slave IDs to read (e.g. 1,2,3,4,5)")
+	timeout := flag.Duration("timeout", 500*time.Millisecond, "Response timeout per request")
+	flag.Parse()
+
+	slaves, err := parseSlaves(*slavesFlag)
+	if err != nil {
+		log.Fatalf("slaves: %v", err)
+	}
+
+	handler := modbus.NewRTUClientHandler(*port)
+	handler.BaudRate = *baud
+	handler.DataBits = 8
+	handler.Parity = "N"
+	handler.StopBits = 1
+	handler.SlaveId = 1
+	handler.Timeout = *timeout
+
+	if err := handler.Connect(); err != nil {
+		log.Fatalf("connect %s at %d: %v", *port, *baud, err)
+	}
+	defer handler.Close()
+
+	client := modbus.NewClient(handler)
+	dump := Dump{Port: *port, BaudRate: *baud, Timestamp: time.Now(), Cards: []CardDump{}}
+
+	for _, sid := range slaves {
+		handler.SlaveId = sid
+		card := CardDump{SlaveID: sid}
+		r := &reader{client: client, card: &card}
+
+		// Probe: the serial number register exists on every model
+		sn := localio.ModelSpec{}.StatusRegisters()[0]
+		raw, err := r.read(sn.Name, sn.Table, sn.Address, sn.Count)
+		if err != nil {
+			log.Printf("slave %d: not found or no response (%v)", sid, err)
+			continue
+		}
+		card.Identity.SerialNumber = decodeString(raw)
+		dumpCard(r)
+		dump.Cards = append(dump.Cards, card)
+	}
+
+	if len(dump.Cards) == 0 {
+		log.Fatalf("no cards answered (check port, baud %d, and slave IDs)", *baud)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dump); err != nil {
+		log.Fatalf("encode: %v", err)
+	}
+}
+
+// dumpCard probes the channel counts like the service's model detection, then reads the documented
+// status registers and the IO registers of the model, sized from its spec
+func dumpCard(r *reader) {
+	card := r.card
+
+	di := r.probe("probeDI", "discrete", 0x0000, maxChannels, 4)
+	do := r.probe("probeDO", "coil", 0x0000, maxChannels, 4)
+	ai := 0
+	if _, err := r.read("probeAI", "input", 0x0000, 8); err == nil {
+		ai = 4
+	}
+	ao := 0
+	if _, err := r.read("probeAO", "holding", aoTypeRegAddr, 4); err == nil {
+		ao = 4
+	}
+
+	spec, ok := localio.ModelForChannels(di, do, ai, ao)
+	if !ok {
+		// Still dump what answered, so the ticket shows why detection failed
+		spec = localio.ModelSpec{Name: "Unknown", DI: di, DO: do, AI: ai, AO: ao}
+	}
+	card.Model = spec.Name
+
+	for _, reg := range spec.StatusRegisters() {
+		if reg.Name == "serialNumber" {
+			continue // Read by the probe in main
+		}
+		raw, err := r.read(reg.Name, reg.Table, reg.Address, reg.Count)
+		if err != nil {
+			continue
+		}
+		switch reg.Name {
+		case "baudRate":
+			if len(raw) >= 4 {
+				card.Config.BaudRate = int(binary.BigEndian.Uint32(raw[:4]))
+			}
+		case "aoType":
+			for i := 0; i+1 < len(raw); i += 2 {
+				card.Config.AOType = append(card.Config.AOType, aoTypeName(binary.BigEndian.Uint16(raw[i:])))
+			}
+		}
+	}
+
+	if spec.DI > 0 {
+		if raw, err := r.read("di", "discrete", 0x0000, spec.DI); err == nil {
+			card.IO.DI = decodeBits(raw, spec.DI)
+		}
+	}
+	if spec.DO > 0 {
+		if raw, err := r.read("do", "coil", 0x0000, spec.DO); err == nil {
+			card.IO.DO = decodeBits(raw, spec.DO)
+		}
+	}
+	if spec.AI > 0 {
+		if raw, err := r.read("ai", "input", 0x0000, spec.AI*2); err == nil {
+			card.IO.AI = decodeFloats(raw)
+		}
+	}
+	if spec.AO > 0 {
+		if raw, err := r.read("ao", "holding", 0x0000, spec.AO*2); err == nil {
+			card.IO.AO = decodeFloats(raw)
+		}
+	}
+}
+
+// probe returns the first of the channel counts whose discrete inputs or coils can be read (0 if none)
+func (r *reader) probe(name, function string, address int, counts ...int) int {
+	for _, count := range counts {
+		if _, err := r.read(name, function, address, count); err == nil {
+			return count
+		}
+	}
+	return 0
+}
+
+// read performs one request and records it in the card's read log
+func (r *reader) read(name, function string, address, count int) ([]byte, error) {
+	start := time.Now()
+	var raw []byte
+	var err error
+	switch function {
+	case "discrete":
+		raw, err = r.client.ReadDiscreteInputs(uint16(address), uint16(count))
+	case "coil":
+		raw, err = r.client.ReadCoils(uint16(address), uint16(count))
+	case "input":
+		raw, err = r.client.ReadInputRegisters(uint16(address), uint16(count))
+	default:
+		raw, err = r.client.ReadHoldingRegisters(uint16(address), uint16(count))
+	}
+
+	entry := RegisterRead{
+		Name:       name,
+		Function:   function,
+		Address:    fmt.Sprintf("0x%04X", address),
+		Count:      count,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else if function == "discrete" || function == "coil" {
+		for _, b := range raw {
+			entry.Raw = append(entry.Raw, fmt.Sprintf("0x%02X", b))
+		}
+	} else {
+		for i := 0; i+1 < len(raw); i += 2 {
+			entry.Raw = append(entry.Raw, fmt.Sprintf("0x%04X", binary.BigEndian.Uint16(raw[i:])))
+		}
+	}
+	r.card.Diagnostics = append(r.card.Diagnostics, entry)
+
+	time.Sleep(operationDelay)
+	return raw, err
+}
+
+func decodeString(raw []byte) string {
+	for i, b := range raw {
+		if b == 0 {
+			return string(raw[:i])
+		}
+	}
+	return string(raw)
+}
+
+func decodeBits(raw []byte, count int) []bool {
+	out := make([]bool, count)
+	for i := range out {
+		if i/8 < len(raw) {
+			out[i] = raw[i/8]&(1<<uint(i%8)) != 0
+		}
+	}
+	return out
+}
+
+func decodeFloats(raw []byte) []float32 {
+	out := make([]float32, 0, len(raw)/4)
+	for i := 0; i+3 < len(raw); i += 4 {
+		out = append(out, math.Float32frombits(binary.BigEndian.Uint32(raw[i:])))
+	}
+	return out
+}
+
+func aoTypeName(v uint16) string {
+	switch v {
+	case 0x0001:
+		return "0-10V"
+	case 0x0004:
+		return "4-20mA"
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+func parseSlaves(s string) ([]byte, error) {
+	var out []byte
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 255 {
+			return nil, fmt.Errorf("invalid slave id %q", p)
+		}
+		out = append(out, byte(n))
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no slave IDs")
+	}
+	return out, nil
+}
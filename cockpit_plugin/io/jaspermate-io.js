@@ -8,14 +8,77 @@
   var tcpConnected = false;
   var requestPending = false;
 
-  function getApiErrorMessage(err) {
+  // Messages of the API error codes; {name} is replaced with the error parameter of that name
+  var ERROR_MESSAGES = {
+    INVALID_REQUEST: "Invalid request.",
+    CARD_NOT_FOUND: "Card {cardId} not found.",
+    NOT_FOUND: "Not found.",
+    INDEX_OUT_OF_RANGE: "Channel {channel} does not exist on this card.",
+    CONFLICT: "Not allowed right now.",
+    FEATURE_DISABLED: "This feature is disabled.",
+    UNAUTHORIZED: "Not authorized.",
+    INTERLOCK_VIOLATION: "{channel} is blocked by interlock {interlock}.",
+    SLAVE_ID_CONFLICT: "More than one card answers on slave ID {slaveId}.",
+    SHORT_CYCLE: "{channel} switched {state} {elapsedMs} ms ago, the minimum is {minimumMs} ms.",
+    CONTROL_LOCKED: "Controlled by {owner}.",
+    WRITE_FORBIDDEN: "{source} may not write {channel}.",
+    QUEUE_FULL: "Too many pending writes, try again.",
+    PORT_UNAVAILABLE: "Serial port {port} is not available.",
+    BUS_TIMEOUT: "No response from the card.",
+    ILLEGAL_FUNCTION: "The card does not support this request.",
+    ILLEGAL_DATA_ADDRESS: "The card has no such register.",
+    ILLEGAL_DATA_VALUE: "The card rejected the value.",
+    DEVICE_BUSY: "The card is busy, try again.",
+    MODBUS_EXCEPTION: "The card rejected the request.",
+    BUS_ERROR: "Communication error.",
+    INTERNAL: "Internal error."
+  };
+
+  // localizeError renders the message of an error code with its parameters; fallback (the raw detail)
+  // is used for unknown codes or missing parameters
+  function localizeError(code, params, fallback) {
+    var msg = code && ERROR_MESSAGES[code];
+    if (!msg) return fallback || code || "Unknown error";
+    var missing = false;
+    msg = msg.replace(/\{(\w+)\}/g, function (m, name) {
+      if (!params || params[name] == null) {
+        missing = true;
+        return m;
+      }
+      return String(params[name]);
+    });
+    return missing && fallback ? fallback : msg;
+  }
+
+  function escapeHtml(s) {
+    return String(s).replace(/[&<>"']/g, function (c) {
+      return { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }[c];
+    });
+  }
+
+  // getApiErrorMessage returns the message of a failed request; data is the response body, an error
+  // object with code, params and detail
+  function getApiErrorMessage(err, data) {
+    if (data) {
+      try {
+        var body = typeof data === "string" ? JSON.parse(data) : data;
+        if (body && body.code) return localizeError(body.code, body.params, body.detail || body.error);
+      } catch (e) {
+        // Not an API error body
+      }
+    }
     var msg = (err && (err.message != null ? err.message : err)) ? String(err.message != null ? err.message : err) : "Unknown error";
     if (msg.indexOf("not-found") !== -1 || msg === "not-found") return "JasperMate Utils is not reachable.";
     return msg;
   }
 
-  function showApiError(container, err) {
-    if (container) container.innerHTML = '<p class="jaspermate-io-error">' + getApiErrorMessage(err) + "</p>";
+  function showApiError(container, err, data) {
+    if (container) container.innerHTML = '<p class="jaspermate-io-error">' + escapeHtml(getApiErrorMessage(err, data)) + "</p>";
+  }
+
+  // cardErrorMessage returns the message of the last read error of a card
+  function cardErrorMessage(last) {
+    return last.errorCode ? localizeError(last.errorCode, last.errorParams, last.error) : last.error;
   }
 
   function createCardElement(card) {
@@ -104,7 +167,7 @@
       html += "</div>";
     }
     if (last.error) {
-      html += '<div class="jaspermate-io-card-error"><span class="jaspermate-io-error">' + last.error + "</span></div>";
+      html += '<div class="jaspermate-io-card-error"><span class="jaspermate-io-error">' + escapeHtml(cardErrorMessage(last)) + "</span></div>";
     }
 
     html += "</div>";
@@ -200,11 +263,11 @@
     if (last.error) {
       if (errorDiv) {
         var errorSpan = errorDiv.querySelector('.jaspermate-io-error');
-        if (errorSpan) errorSpan.textContent = last.error;
+        if (errorSpan) errorSpan.textContent = cardErrorMessage(last);
       } else {
         errorDiv = document.createElement('div');
         errorDiv.className = 'jaspermate-io-card-error';
-        errorDiv.innerHTML = '<span class="jaspermate-io-error">' + last.error + '</span>';
+        errorDiv.innerHTML = '<span class="jaspermate-io-error">' + escapeHtml(cardErrorMessage(last)) + '</span>';
         var cardBody = cardEl.querySelector('.jaspermate-io-card-body');
         if (cardBody) cardBody.appendChild(errorDiv);
       }
@@ -315,7 +378,7 @@
     return cockpit
       .http({ address: API_HOST, port: API_PORT })
       .post(
-        "/api/jaspermate-io/" + encodeURIComponent(cardId) + "/write-do",
+        "/api/v1/jaspermate-io/" + encodeURIComponent(cardId) + "/write-do",
         JSON.stringify({ index: parseInt(index, 10), state: state === true || state === "true" }),
         { "Content-Type": "application/json" }
       );
@@ -449,7 +512,7 @@
     return cockpit
       .http({ address: API_HOST, port: API_PORT })
       .post(
-        "/api/jaspermate-io/" + encodeURIComponent(cardId) + "/write-ao",
+        "/api/v1/jaspermate-io/" + encodeURIComponent(cardId) + "/write-ao",
         JSON.stringify({ index: parseInt(index, 10), value: parseInt(value, 10) }),
         { "Content-Type": "application/json" }
       );
@@ -458,14 +521,14 @@
   function rebootCard(cardId) {
     return cockpit
       .http({ address: API_HOST, port: API_PORT })
-      .post("/api/jaspermate-io/" + encodeURIComponent(cardId) + "/reboot", "{}", { "Content-Type": "application/json" });
+      .post("/api/v1/jaspermate-io/" + encodeURIComponent(cardId) + "/reboot", "{}", { "Content-Type": "application/json" });
   }
 
   function writeAOType(cardId, index, mode) {
     return cockpit
       .http({ address: API_HOST, port: API_PORT })
       .post(
-        "/api/jaspermate-io/" + encodeURIComponent(cardId) + "/write-aotype",
+        "/api/v1/jaspermate-io/" + encodeURIComponent(cardId) + "/write-aotype",
         JSON.stringify({ index: parseInt(index, 10), mode: mode }),
         { "Content-Type": "application/json" }
       );
@@ -479,8 +542,8 @@
       var index = btn.getAttribute("data-do-index");
       var state = btn.getAttribute("data-do-state") === "true";
       if (!cardId || index === null) return;
-      writeDo(cardId, index, state).then(fetchJasperMateIO, function (err) {
-        showApiError(document.getElementById("app-container"), err);
+      writeDo(cardId, index, state).then(fetchJasperMateIO, function (err, data) {
+        showApiError(document.getElementById("app-container"), err, data);
       });
       return;
     }
@@ -504,8 +567,8 @@
       if (!window.confirm("Are you sure you want to reboot Card " + cardId + "?")) return;
       rebootCard(cardId)
         .then(fetchJasperMateIO)
-        .catch(function (err) {
-          showApiError(document.getElementById("app-container"), err);
+        .catch(function (err, data) {
+          showApiError(document.getElementById("app-container"), err, data);
         });
       return;
     }
@@ -533,12 +596,12 @@
 
     cockpit
       .http({ address: API_HOST, port: API_PORT })
-      .get("/api/jaspermate-io")
+      .get("/api/v1/jaspermate-io")
       .then(renderCards)
-      .catch(function (err) {
+      .catch(function (err, data) {
         hideLoading();
         if (statusEl) statusEl.textContent = "Monitor and control JasperMate IO cards";
-        showApiError(container, err);
+        showApiError(container, err, data);
         cardElements = {};
       })
       .finally(function () {
@@ -566,8 +629,8 @@
         if (!window.confirm("Change AO-" + (aoModalChannel + 1) + " type to 4-20mA? Reboot card may be required.")) return;
         aoModalType = "4-20mA";
         updateAOTypeButtons();
-        writeAOType(aoModalCardId, aoModalChannel, "4-20mA").then(fetchJasperMateIO).catch(function (err) {
-          showApiError(document.getElementById("app-container"), err);
+        writeAOType(aoModalCardId, aoModalChannel, "4-20mA").then(fetchJasperMateIO).catch(function (err, data) {
+          showApiError(document.getElementById("app-container"), err, data);
         });
       });
     }
@@ -577,8 +640,8 @@
         if (!window.confirm("Change AO-" + (aoModalChannel + 1) + " type to 0-10V? Reboot card may be required.")) return;
         aoModalType = "0-10V";
         updateAOTypeButtons();
-        writeAOType(aoModalCardId, aoModalChannel, "0-10V").then(fetchJasperMateIO).catch(function (err) {
-          showApiError(document.getElementById("app-container"), err);
+        writeAOType(aoModalCardId, aoModalChannel, "0-10V").then(fetchJasperMateIO).catch(function (err, data) {
+          showApiError(document.getElementById("app-container"), err, data);
         });
       });
     }
@@ -609,9 +672,9 @@
             hideAOModal();
             fetchJasperMateIO();
           })
-          .catch(function (err) {
+          .catch(function (err, data) {
             hideAOModal();
-            showApiError(document.getElementById("app-container"), err);
+            showApiError(document.getElementById("app-container"), err, data);
           });
       });
     }
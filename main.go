@@ -1,18 +1,25 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
 
+	"jaspermate-utils/src/server/api"
+	"jaspermate-utils/src/server/cloud"
 	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/discovery"
+	"jaspermate-utils/src/server/grpcapi"
 	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/mqtt"
+	"jaspermate-utils/src/server/nats"
+	"jaspermate-utils/src/server/redis"
 	"jaspermate-utils/src/server/tcp"
-
-	"github.com/gorilla/mux"
+	"jaspermate-utils/src/server/telemetry"
 )
 
 const version = "1.0.0"
@@ -20,172 +27,116 @@ const version = "1.0.0"
 type App struct {
 	localioMgr *localio.Manager
 	tcpServer  *tcp.TCPServer
+	grpcServer *grpcapi.Server
+	heartbeat  *discovery.HeartbeatAgent
+	mqtt       *mqtt.Connector
+	nats       *nats.Connector
+	redis      *redis.Mirror
+	cloudTwin  *cloud.Connector
+	api        *api.Server
 }
 
 func NewApp() *App {
+	if profile := config.ActiveProfile(); profile != "" {
+		log.Printf("Using config profile %s", profile)
+	}
+	settings := config.GetSettings()
 	extMgr := localio.InitializeManager()
-	tcpServer := tcp.NewTCPServer("9081", extMgr, version, config.GetConfig().ServeExternally)
+	tcpServer := tcp.NewTCPServer(strconv.Itoa(settings.TCPPort), extMgr, version, config.GetConfig().ServeExternally)
+	tcpServer.SetMaxMessageSize(config.GetConfig().TCPMaxMessageSize)
+	tcpServer.SetUpdateInterval(settings.TCPUpdateInterval())
+	tcpServer.SetUpdateMode(settings.TCPUpdateMode)
+	tcpServer.SetEventSeverity(settings.TCPEventSeverity)
+	tcpServer.SetSendQueue(settings.TCPSendQueueSize, settings.TCPSlowClientPolicy)
+	tcpServer.SetSessionGrace(settings.TCPSessionGrace())
 	if err := tcpServer.Start(); err != nil {
 		log.Printf("Warning: Failed to start TCP server: %v", err)
 	}
 
-	return &App{
+	app := &App{
 		localioMgr: extMgr,
 		tcpServer:  tcpServer,
 	}
-}
-
-func (app *App) rootHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
+	if settings.GRPCPort != 0 {
+		app.grpcServer = grpcapi.NewServer(strconv.Itoa(settings.GRPCPort), extMgr, config.GetGRPCToken(), config.GetConfig().ServeExternally)
+		if err := app.grpcServer.Start(); err != nil {
+			log.Printf("Warning: Failed to start gRPC server: %v", err)
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"service": "jaspermate-io-api"})
-}
-
-func (app *App) rediscoverLocalIOCardsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if app.localioMgr != nil {
-		app.localioMgr.StopCycle()
+	if cfg := config.GetConfig(); cfg.MQTT.Broker != "" {
+		app.mqtt = mqtt.NewConnector(cfg.MQTT, cfg.DeviceID, extMgr)
+		app.mqtt.Start()
 	}
-
-	app.localioMgr = localio.InitializeManager()
-	cards := app.localioMgr.RefreshAll()
-	json.NewEncoder(w).Encode(map[string]interface{}{"cards": cards})
-}
-
-func (app *App) getLocalIOCardsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	cards := app.localioMgr.GetAllCards()
-	tcpConnected := app.tcpServer != nil && app.tcpServer.IsConnected()
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"cards":        cards,
-		"tcpConnected": tcpConnected,
-	})
-}
-
-func (app *App) localIOCardHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["id"]
-
-	if app.tcpServer != nil && app.tcpServer.IsConnected() {
-		path := r.URL.Path
-		if strings.HasSuffix(path, "/write-do") || strings.HasSuffix(path, "/write-ao") ||
-			strings.HasSuffix(path, "/write-aotype") || strings.HasSuffix(path, "/reboot") {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "TCP client is connected, frontend controls are disabled",
-			})
-			return
+	if cfg := config.GetConfig(); cfg.NATS.URL != "" {
+		app.nats = nats.NewConnector(cfg.NATS, cfg.DeviceID, extMgr)
+		if err := app.nats.Start(); err != nil {
+			log.Printf("Warning: Failed to start NATS connector: %v", err)
+			app.nats = nil
 		}
 	}
-
-	_, ok := app.localioMgr.GetCard(cardID)
-	if !ok {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "card not found"})
-		return
+	if cfg := config.GetConfig(); cfg.Redis.Addr != "" {
+		app.redis = redis.NewMirror(cfg.Redis, cfg.DeviceID, extMgr)
+		app.redis.Start()
 	}
-
-	path := r.URL.Path
-	switch {
-	case strings.HasSuffix(path, "/write-do"):
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-		var req struct {
-			Index int  `json:"index"`
-			State bool `json:"state"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid body"})
-			return
-		}
-		if err := app.localioMgr.QueueWriteDO(cardID, req.Index, req.State); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
+	if cfg := config.GetConfig(); cfg.CloudTwin.Provider != "" {
+		twin, err := cloud.NewConnector(cfg.CloudTwin, cfg.DeviceID, extMgr)
+		if err == nil {
+			err = twin.Start()
 		}
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-
-	case strings.HasSuffix(path, "/write-ao"):
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-		var req struct {
-			Index int     `json:"index"`
-			Value float32 `json:"value"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid body"})
-			return
-		}
-		if err := app.localioMgr.QueueWriteAO(cardID, req.Index, req.Value); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-
-	case strings.HasSuffix(path, "/write-aotype"):
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-		var req struct {
-			Index int    `json:"index"`
-			Mode  string `json:"mode"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid body"})
-			return
-		}
-		if err := app.localioMgr.QueueWriteAOType(cardID, req.Index, req.Mode); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-
-	case strings.HasSuffix(path, "/reboot"):
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
+		if err != nil {
+			log.Printf("Warning: Failed to start cloud twin connector: %v", err)
+		} else {
+			app.cloudTwin = twin
 		}
-		if err := app.localioMgr.RebootCard(cardID); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+	if settings.HeartbeatURL != "" {
+		app.heartbeat = discovery.NewHeartbeatAgent(settings.HeartbeatURL, settings.HeartbeatInterval(), version, app.cardSummary)
+		app.heartbeat.Start()
+	}
+	app.api = api.New(extMgr, tcpServer, api.Options{
+		Version:   version,
+		Heartbeat: app.heartbeat,
+		MQTT:      app.mqtt,
+		NATS:      app.nats,
+		Redis:     app.redis,
+		CloudTwin: app.cloudTwin,
+	})
+	return app
+}
 
-	default:
-		w.WriteHeader(http.StatusNotFound)
+// cardSummary lists the known cards for the device heartbeat
+func (app *App) cardSummary() []discovery.CardSummary {
+	cards := app.localioMgr.GetAllCards()
+	out := make([]discovery.CardSummary, 0, len(cards))
+	for _, c := range cards {
+		out = append(out, discovery.CardSummary{
+			ID:           c.ID,
+			Module:       c.Module,
+			PortPath:     c.PortPath,
+			SlaveID:      c.SlaveID,
+			SerialNumber: c.Last.SerialNumber,
+			Online:       c.Last.Error == "",
+		})
 	}
+	return out
 }
 
 func main() {
 	os.Args[0] = "cm-utils"
+	config.RegisterSettingsFlags(flag.CommandLine)
+	flag.Parse()
 
-	app := NewApp()
-
-	r := mux.NewRouter()
+	shutdownTracing, err := telemetry.Setup(context.Background(), config.GetSettings().OTLPEndpoint, version, config.GetDeviceID())
+	if err != nil {
+		log.Printf("Warning: tracing disabled: %v", err)
+	}
 
-	r.HandleFunc("/", app.rootHandler).Methods("GET")
-	r.HandleFunc("/api/jaspermate-io", app.getLocalIOCardsHandler).Methods("GET")
-	r.HandleFunc("/api/jaspermate-io/rediscover", app.rediscoverLocalIOCardsHandler).Methods("POST")
-	r.HandleFunc("/api/jaspermate-io/{id}/write-do", app.localIOCardHandler).Methods("POST")
-	r.HandleFunc("/api/jaspermate-io/{id}/write-ao", app.localIOCardHandler).Methods("POST")
-	r.HandleFunc("/api/jaspermate-io/{id}/write-aotype", app.localIOCardHandler).Methods("POST")
-	r.HandleFunc("/api/jaspermate-io/{id}/reboot", app.localIOCardHandler).Methods("POST")
+	app := NewApp()
+	api.LogSelfTest(app.api.RunSelfTest())
 
-	fmt.Println("JasperMate Utils (jaspermate-io API) starting on :9080")
-	log.Fatal(http.ListenAndServe(":9080", r))
+	addr := fmt.Sprintf(":%d", config.GetSettings().HTTPPort)
+	fmt.Println("JasperMate Utils (jaspermate-io API) starting on " + addr)
+	err = http.ListenAndServe(addr, app.api.Handler())
+	shutdownTracing(context.Background())
+	log.Fatal(err)
 }
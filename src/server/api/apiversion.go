@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiVersion is the current version of the HTTP API, served under /api/v1
+const apiVersion = 1
+
+// apiPrefix is the path prefix of the current API version
+const apiPrefix = "/api/v1"
+
+// apiVersionKey is the context key of the API version a request was made with
+type apiVersionKey struct{}
+
+// withAPIVersion serves the API under /api/v1 and keeps the unversioned /api paths as aliases of it for
+// deployed clients. The routes are registered once, under /api: versioned paths are routed with the
+// version prefix removed. Unversioned paths are answered with a Deprecation header and a Link to the
+// versioned path, and their responses keep the shapes of the unversioned API (see requestAPIVersion).
+func withAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case strings.HasPrefix(path, apiPrefix+"/"):
+			w.Header().Set("API-Version", strconv.Itoa(apiVersion))
+			r2 := r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, apiVersion))
+			u := *r.URL
+			u.Path = "/api" + strings.TrimPrefix(path, apiPrefix)
+			if u.RawPath != "" {
+				u.RawPath = "/api" + strings.TrimPrefix(u.RawPath, apiPrefix)
+			}
+			r2.URL = &u
+			next.ServeHTTP(w, r2)
+			return
+		case strings.HasPrefix(path, "/api/"):
+			successor := apiPrefix + strings.TrimPrefix(r.URL.EscapedPath(), "/api")
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAPIVersion returns the API version of a request: 0 for the unversioned /api aliases. Handlers that
+// change the shape of a response keep the old shape for version 0, so deployed clients keep working.
+func requestAPIVersion(r *http.Request) int {
+	v, _ := r.Context().Value(apiVersionKey{}).(int)
+	return v
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAPIVersion(t *testing.T) {
+	s := newTestServer(fakeTCP{})
+	h := s.Handler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	v1 := get("/api/v1/jaspermate-io")
+	legacy := get("/api/jaspermate-io")
+	if v1.Code != http.StatusOK || legacy.Code != http.StatusOK {
+		t.Fatalf("Expected both paths served, got %d and %d", v1.Code, legacy.Code)
+	}
+	if v1.Header().Get("API-Version") != "1" || v1.Header().Get("Deprecation") != "" {
+		t.Errorf("Unexpected headers of the versioned path: %v", v1.Header())
+	}
+	if legacy.Header().Get("Deprecation") != "true" || legacy.Header().Get("Link") != `</api/v1/jaspermate-io>; rel="successor-version"` {
+		t.Errorf("Expected the unversioned path deprecated, got %v", legacy.Header())
+	}
+	if v1.Body.String() != legacy.Body.String() {
+		t.Errorf("Expected the same response, got %q and %q", v1.Body.String(), legacy.Body.String())
+	}
+
+	// Route variables are matched with the version prefix removed
+	if rr := get("/api/v1/jaspermate-io/missing/errors"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown card, got %d", rr.Code)
+	} else {
+		var out map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&out)
+		if out["code"] != "CARD_NOT_FOUND" {
+			t.Errorf("Expected CARD_NOT_FOUND, got %v", out)
+		}
+	}
+	if rr := get("/healthz"); rr.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected paths outside the API not deprecated, got %v", rr.Header())
+	}
+
+	// Handlers see the version of the request
+	versions := map[string]int{}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/x", func(w http.ResponseWriter, req *http.Request) {
+		versions[req.Header.Get("X-Path")] = requestAPIVersion(req)
+	})
+	for _, path := range []string{"/api/x", "/api/v1/x"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Path", path)
+		withAPIVersion(r).ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if versions["/api/x"] != 0 || versions["/api/v1/x"] != 1 {
+		t.Errorf("Expected versions 0 and 1, got %v", versions)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// asBuiltPage renders the as-built description as a printable HTML page, one table per card
+var asBuiltPage = template.Must(template.New("as-built").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>As-built {{.DeviceID}}</title>
+<style>
+body { font-family: sans-serif; font-size: 10pt; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; page-break-inside: avoid; }
+th, td { border: 1px solid #999; padding: 3px 6px; text-align: left; }
+th { background: #eee; }
+</style>
+</head>
+<body>
+<h1>As-built documentation</h1>
+<p>Device {{.DeviceID}} &middot; generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</p>
+{{range .Cards}}
+<h2>Card {{.CardID}}: {{.Module}}</h2>
+<p>Port {{.PortPath}}, slave ID {{.SlaveID}}{{if .BaudRate}}, {{.BaudRate}} baud{{end}}
+&middot; serial number {{if .SerialNumber}}{{.SerialNumber}}{{else}}unknown{{end}}
+&middot; firmware {{if .Firmware}}{{.Firmware}}{{else}}not reported{{end}}
+&middot; driver {{.Driver}}</p>
+<table>
+<tr><th>Channel</th><th>Name</th><th>Wiring label</th><th>Unit</th><th>Scaling</th><th>Safe state</th><th>AO type</th><th>Roles</th><th>Commissioning</th></tr>
+{{range .Channels}}<tr><td>{{.Channel}}</td><td>{{.Name}}</td><td>{{.Label}}</td><td>{{.Unit}}</td><td>{{.Scaling}}</td><td>{{.SafeState}}</td><td>{{.AOType}}</td><td>{{join .Roles ", "}}</td><td>{{.Commissioning}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No cards found.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// asBuiltHandler serves the as-built description of the panel as JSON, or with ?format=html as a
+// printable page
+func (s *Server) asBuiltHandler(w http.ResponseWriter, r *http.Request) {
+	doc := s.mgr.GetAsBuilt()
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := asBuiltPage.Execute(w, doc); err != nil {
+			writeError(w, http.StatusInternalServerError, localio.CodeInternal, err.Error())
+		}
+	default:
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "format must be json or html")
+	}
+}
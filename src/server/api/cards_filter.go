@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// cardFilter holds the optional query filters for the cards list
+// e.g. ?module=IO4040&port=/dev/ttyS7&online=true&fields=id,module,last.di
+type cardFilter struct {
+	module string
+	port   string
+	online *bool
+	fields []string
+}
+
+// parseCardFilter reads the card list filters from the query string
+func parseCardFilter(q url.Values) (cardFilter, error) {
+	f := cardFilter{
+		module: q.Get("module"),
+		port:   q.Get("port"),
+	}
+	if v := q.Get("online"); v != "" {
+		online, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, err
+		}
+		f.online = &online
+	}
+	if v := q.Get("fields"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				f.fields = append(f.fields, field)
+			}
+		}
+	}
+	return f, nil
+}
+
+// match reports whether a card passes the module/port/online filters
+func (f cardFilter) match(c *localio.Card) bool {
+	if f.module != "" && !strings.EqualFold(c.Module, f.module) {
+		return false
+	}
+	if f.port != "" && c.PortPath != f.port {
+		return false
+	}
+	if f.online != nil && (c.Last.Error == "") != *f.online {
+		return false
+	}
+	return true
+}
+
+// apply filters the cards and, if fields were requested, projects each card to those fields
+func (f cardFilter) apply(cards []*localio.Card) []interface{} {
+	out := make([]interface{}, 0, len(cards))
+	for _, c := range cards {
+		if !f.match(c) {
+			continue
+		}
+		if len(f.fields) == 0 {
+			out = append(out, c)
+			continue
+		}
+		out = append(out, selectFields(c, f.fields))
+	}
+	return out
+}
+
+// selectFields returns only the requested JSON fields of v; nested fields use dot notation (last.di)
+func selectFields(v interface{}, fields []string) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	var full map[string]interface{}
+	if err := json.Unmarshal(data, &full); err != nil {
+		return map[string]interface{}{}
+	}
+
+	out := make(map[string]interface{})
+	for _, field := range fields {
+		parts := strings.Split(field, ".")
+		src := full
+		dst := out
+		for i, part := range parts {
+			val, ok := src[part]
+			if !ok {
+				break
+			}
+			if i == len(parts)-1 {
+				dst[part] = val
+				break
+			}
+			next, ok := val.(map[string]interface{})
+			if !ok {
+				break
+			}
+			child, ok := dst[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				dst[part] = child
+			}
+			src = next
+			dst = child
+		}
+	}
+	return out
+}
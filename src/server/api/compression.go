@@ -0,0 +1,166 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response body that is compressed; the gzip framing of smaller bodies
+// saves little or nothing
+const minCompressSize = 1024
+
+// gzipWriters are reused across responses: allocating a gzip.Writer per response is expensive
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+
+// withCompression gzips the responses of clients that accept it, for sites monitored over narrowband
+// cellular links. Only text bodies (JSON, CSV, YAML, HTML, ...) of at least minCompressSize bytes are
+// compressed; server-sent event streams and bodies that are already encoded are sent as they are.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			q, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+		}
+		return q > 0
+	}
+	return false
+}
+
+// compressible reports whether a response with the given header and status can be compressed
+func compressible(h http.Header, status int) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", mediaType == "application/yaml", mediaType == "application/x-yaml",
+		mediaType == "application/xml", mediaType == "application/javascript", strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether to compress it: the body reached
+// minCompressSize, the handler flushed, or the response is complete
+type compressWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool // The handler called WriteHeader
+	started     bool // The header was sent; gz is set if the body is compressed
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader || c.started {
+		return
+	}
+	c.wroteHeader = true
+	c.status = status
+	if !compressible(c.Header(), status) {
+		c.start(false)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.started {
+		if !compressible(c.Header(), c.status) {
+			c.start(false)
+		} else {
+			c.buf = append(c.buf, p...)
+			if len(c.buf) >= minCompressSize {
+				c.start(true)
+			}
+			return len(p), nil
+		}
+	}
+	if c.gz != nil {
+		return c.gz.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush sends the buffered body, compressed if it may be, and flushes the connection
+func (c *compressWriter) Flush() {
+	if !c.started {
+		c.start(compressible(c.Header(), c.status))
+	}
+	if c.gz != nil {
+		c.gz.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start sends the header and the buffered body
+func (c *compressWriter) start(compress bool) {
+	c.started = true
+	if compress {
+		h := c.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		c.gz = gzipWriters.Get().(*gzip.Writer)
+		c.gz.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	if len(c.buf) > 0 {
+		if c.gz != nil {
+			c.gz.Write(c.buf)
+		} else {
+			c.ResponseWriter.Write(c.buf)
+		}
+	}
+	c.buf = nil
+}
+
+// close sends a response shorter than minCompressSize as it is and completes a compressed one
+func (c *compressWriter) close() {
+	if !c.started {
+		if !c.wroteHeader && len(c.buf) == 0 {
+			// Nothing was written: leave the implicit 200 to the server
+			return
+		}
+		c.start(false)
+	}
+	if c.gz != nil {
+		c.gz.Close()
+		c.gz.Reset(io.Discard)
+		gzipWriters.Put(c.gz)
+		c.gz = nil
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat(`{"id":"1","module":"IO4040"},`, 100)
+	h := withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(large))
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(large))
+		case "/status":
+			w.Header().Set("Content-Type", "text/csv")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(large))
+		}
+	}))
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/large", "gzip, deflate")
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected a gzipped response, got %v", rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != large {
+		t.Errorf("Unexpected body after decompression: %q", body)
+	}
+
+	rr = get("/status", "gzip")
+	if rr.Code != http.StatusAccepted || rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected the status kept on a gzipped response, got %d %v", rr.Code, rr.Header())
+	}
+
+	// Not compressed: not accepted, too small, or not text
+	for _, tt := range []struct{ path, accept string }{
+		{"/large", ""},
+		{"/large", "gzip;q=0"},
+		{"/large", "br"},
+		{"/small", "gzip"},
+		{"/binary", "gzip"},
+	} {
+		rr := get(tt.path, tt.accept)
+		if rr.Header().Get("Content-Encoding") != "" || rr.Code != http.StatusOK {
+			t.Errorf("%s %q: expected an uncompressed response, got %d %v", tt.path, tt.accept, rr.Code, rr.Header())
+		}
+		if tt.path == "/small" && rr.Body.String() != `{"status":"ok"}` {
+			t.Errorf("Unexpected small body %q", rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// stateStamps are the fields of a card state that change with every read, even when the values don't
+var stateStamps = []string{"timestamp", "seq", "monotonicMs", "lastGood"}
+
+// cardListETag returns the weak ETag of a card list response: a hash of the response without the stamps
+// of the card states. The state sequence number increases with every poll, so a tag over it would change
+// twice a second; without the stamps the tag only changes when a value, quality, error or card does.
+func cardListETag(resp map[string]interface{}) (string, []byte, error) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return "", nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return "", nil, err
+	}
+	cards, _ := generic["cards"].([]interface{})
+	for _, c := range cards {
+		card, _ := c.(map[string]interface{})
+		if last, ok := card["last"].(map[string]interface{}); ok {
+			for _, field := range stateStamps {
+				delete(last, field)
+			}
+		}
+	}
+	stripped, err := json.Marshal(generic)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(stripped)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, body, nil
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, by the weak comparison of RFC 9110
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
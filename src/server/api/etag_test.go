@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestCardListETag(t *testing.T) {
+	tag := func(di bool, seq uint64) string {
+		t.Helper()
+		card := &localio.Card{ID: "1", Module: "IO4040", Last: localio.CardState{
+			Timestamp: time.Unix(int64(seq), 0), Seq: seq, MonotonicMs: int64(seq) * 500, DI: []bool{di, false},
+		}}
+		etag, _, err := cardListETag(map[string]interface{}{"cards": []interface{}{card}, "tcpConnected": false})
+		if err != nil {
+			t.Fatalf("cardListETag failed: %v", err)
+		}
+		return etag
+	}
+	if tag(true, 1) != tag(true, 2) {
+		t.Errorf("Expected the same tag for new reads of the same values")
+	}
+	if tag(true, 1) == tag(false, 1) {
+		t.Errorf("Expected a new tag for a changed value")
+	}
+
+	tests := []struct {
+		header string
+		match  bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"x", W/"abc"`, true},
+		{"*", true},
+		{`W/"abd"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `W/"abc"`); got != tt.match {
+			t.Errorf("%q: expected %v, got %v", tt.header, tt.match, got)
+		}
+	}
+}
+
+func TestCardListNotModified(t *testing.T) {
+	s := newTestServer(fakeTCP{})
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/jaspermate-io", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected a response with an ETag, got %d %v", rr.Code, rr.Header())
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/jaspermate-io", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag {
+		t.Errorf("Expected 304 without a body, got %d %q", rr.Code, rr.Body.String())
+	}
+
+}
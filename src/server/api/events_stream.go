@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// eventStreamBuffer is the number of events buffered per subscriber; a subscriber that falls further behind
+// misses events rather than stalling the manager
+const eventStreamBuffer = 64
+
+// eventStreamKeepAlive is the interval of the comment lines keeping idle streams open through proxies
+const eventStreamKeepAlive = 15 * time.Second
+
+// eventStream fans manager events out to the subscribers of GET /api/events
+type eventStream struct {
+	mu          sync.Mutex
+	subscribers map[chan localio.Event]struct{}
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{subscribers: make(map[chan localio.Event]struct{})}
+}
+
+// publish is the manager event listener; it never blocks
+func (s *eventStream) publish(ev localio.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (s *eventStream) subscribe() chan localio.Event {
+	ch := make(chan localio.Event, eventStreamBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *eventStream) unsubscribe(ch chan localio.Event) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	s.mu.Unlock()
+}
+
+// eventsHandler streams manager events as server-sent events. Each event is sent with its type as the SSE
+// event name, so clients can listen for card-added, card-removed, card-offline and card-online directly.
+// ?severity= sets the minimum severity and ?type= selects a single event type.
+// A subscriber keeps the poll cycle at full rate until it disconnects.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	severity, eventType := r.URL.Query().Get("severity"), r.URL.Query().Get("type")
+	if severity != "" && !localio.ValidSeverity(severity) {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: unknown severity "+severity)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusInternalServerError, localio.CodeInternal, "streaming is not supported")
+		return
+	}
+
+	// Subscribed before the headers are sent: a client sees every event published after the response starts
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+	defer s.mgr.AttachConsumer("sse")()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev := <-events:
+			if (eventType != "" && ev.Type != eventType) || !localio.SeverityAtLeast(ev.Severity, severity) {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		flusher.Flush()
+	}
+}
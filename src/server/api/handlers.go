@@ -0,0 +1,1503 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/tcp"
+
+	"github.com/gorilla/mux"
+)
+
+// writeError writes a JSON error body with a machine-readable code
+func writeError(w http.ResponseWriter, status int, code localio.ErrorCode, message string) {
+	writeErrorParams(w, status, code, nil, message)
+}
+
+// apiError is the body of an error response. Clients render their own (localized) message from the code
+// and the params; detail is the English message for developers, also sent as error for older clients.
+type apiError struct {
+	Code   localio.ErrorCode      `json:"code"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Detail string                 `json:"detail"`
+	Error  string                 `json:"error"`
+}
+
+// writeErrorParams writes an error response with the parameters of its message
+func writeErrorParams(w http.ResponseWriter, status int, code localio.ErrorCode, params map[string]interface{}, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Code: code, Params: params, Detail: message, Error: message})
+}
+
+// writeManagerError writes an error returned by the localio manager with the HTTP status for its code
+func writeManagerError(w http.ResponseWriter, err error) {
+	code := localio.ErrorCodeOf(err)
+	writeErrorParams(w, httpStatusForCode(code), code, localio.ErrorParamsOf(err), err.Error())
+}
+
+// requireAdmin checks the admin bearer token of an administrative request and writes the error response
+// if it is missing or wrong. Administrative endpoints are disabled while no admin_token is configured.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := config.GetAdminToken()
+	if token == "" {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "admin_token is not configured")
+		return false
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		writeError(w, http.StatusUnauthorized, localio.CodeUnauthorized, "invalid or missing admin token")
+		return false
+	}
+	return true
+}
+
+func httpStatusForCode(code localio.ErrorCode) int {
+	switch code {
+	case localio.CodeInvalidRequest, localio.CodeIndexOutOfRange:
+		return http.StatusBadRequest
+	case localio.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case localio.CodeFeatureDisabled, localio.CodeWriteForbidden:
+		return http.StatusForbidden
+	case localio.CodeCardNotFound, localio.CodeNotFound:
+		return http.StatusNotFound
+	case localio.CodeConflict, localio.CodeInterlockViolation, localio.CodeSlaveConflict, localio.CodeShortCycle:
+		return http.StatusConflict
+	case localio.CodeControlLocked, localio.CodeQueueFull, localio.CodeDeviceBusy:
+		return http.StatusServiceUnavailable
+	case localio.CodePortUnavailable, localio.CodeIllegalFunction, localio.CodeIllegalAddress, localio.CodeIllegalValue,
+		localio.CodeModbusException, localio.CodeBusError:
+		return http.StatusBadGateway
+	case localio.CodeBusTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"service": "jaspermate-io-api", "api": apiPrefix})
+}
+
+// rediscoverLocalIOCardsHandler scans the ports for cards again. The manager is kept, so the TCP, gRPC and
+// broker connections and event subscribers see the change as card-removed and card-added events.
+func (s *Server) rediscoverLocalIOCardsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s.mgr.Rediscover()
+	cards := s.mgr.RefreshAll()
+	json.NewEncoder(w).Encode(map[string]interface{}{"cards": cards})
+}
+
+// rebootAllHandler reboots every card one after another and returns the result per card
+func (s *Server) rebootAllHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.tcpConnected() {
+		writeError(w, http.StatusServiceUnavailable, localio.CodeControlLocked, "TCP client is connected, frontend controls are disabled")
+		return
+	}
+	results := s.mgr.RebootAll()
+	status := "ok"
+	for _, result := range results {
+		if result.Status == "error" {
+			status = "error"
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "results": results})
+}
+
+func (s *Server) getLocalIOCardsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	filter, err := parseCardFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	page, err := parsePageQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	s.mgr.TouchConsumer(httpSource(r).String())
+	resp := map[string]interface{}{
+		"tcpConnected": s.tcpConnected(),
+		"bootId":       s.mgr.BootID(),
+	}
+	resp["cards"] = paginate(filter.apply(s.mgr.GetAllCards()), page, resp)
+
+	// Polling clients revalidate with If-None-Match and get a 304 while nothing changed
+	etag, body, err := cardListETag(resp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, localio.CodeInternal, err.Error())
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(append(body, '\n'))
+}
+
+// httpSource is the write source of an API request, identified by the client host
+func httpSource(r *http.Request) localio.WriteSource {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return localio.WriteSource{Kind: localio.SourceHTTP, ID: host}
+}
+
+// controlLock applies the control lock policy to an HTTP write of the given channels of a card and
+// returns the context to write with and a warning for the response. If a TCP client is connected and
+// the policy rejects the write, it writes the error response and returns ok == false.
+func (s *Server) controlLock(w http.ResponseWriter, r *http.Request, cardID string, channels ...string) (ctx context.Context, warning string, ok bool) {
+	src := httpSource(r)
+	if s.tcpConnected() {
+		lock := config.GetConfig().ControlLock
+		switch lock.Policy {
+		case config.ControlLockBlock:
+			writeErrorParams(w, http.StatusServiceUnavailable, localio.CodeControlLocked, map[string]interface{}{"owner": localio.SourceTCP},
+				"TCP client is connected, frontend controls are disabled")
+			return nil, "", false
+		case config.ControlLockChannels:
+			for _, ch := range channels {
+				if !slices.Contains(lock.Channels, config.ControlChannel{Card: cardID, Channel: ch}) {
+					writeErrorParams(w, http.StatusServiceUnavailable, localio.CodeControlLocked, map[string]interface{}{"owner": localio.SourceTCP, "channel": ch},
+						fmt.Sprintf("TCP client is connected, %s is not open for manual override", ch))
+					return nil, "", false
+				}
+			}
+			fallthrough
+		case config.ControlLockWarn:
+			src.Override = true
+			warning = "TCP client is connected, the write overrides its control"
+			log.Printf("HTTP: %s overrides TCP control of card %s %v", src, cardID, channels)
+		}
+	}
+	return localio.WithSource(r.Context(), src), warning, true
+}
+
+// okResponse is the success body of a write, carrying the control lock warning if any
+func okResponse(warning string) map[string]string {
+	if warning == "" {
+		return map[string]string{"status": "ok"}
+	}
+	return map[string]string{"status": "ok", "warning": warning}
+}
+
+func (s *Server) ownersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"owners": s.mgr.GetOwners(),
+	})
+}
+
+// queueHandler lists the pending write operations (GET) or cancels one (DELETE .../queue/{opId})
+func (s *Server) queueHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pending": s.mgr.GetPendingWrites(),
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["opId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid operation id")
+		return
+	}
+	if err := s.mgr.CancelPendingWrite(id); err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *Server) localIOCardHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["id"]
+
+	// Channel writes are arbitrated per channel by the manager; rebooting a card takes all of it
+	if s.tcpConnected() && strings.HasSuffix(r.URL.Path, "/reboot") {
+		writeError(w, http.StatusServiceUnavailable, localio.CodeControlLocked, "TCP client is connected, frontend controls are disabled")
+		return
+	}
+	card, ok := s.mgr.GetCard(cardID)
+	if !ok {
+		writeError(w, http.StatusNotFound, localio.CodeCardNotFound, "card not found")
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/write-do"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Index int  `json:"index"`
+			State bool `json:"state"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		ctx, warning, ok := s.controlLock(w, r, cardID, localio.ChannelKey(localio.WriteOpDO, req.Index))
+		if !ok {
+			return
+		}
+		if err := s.mgr.QueueWriteDOContext(ctx, cardID, req.Index, req.State); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(okResponse(warning))
+
+	case strings.HasSuffix(path, "/write-ao"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Index int     `json:"index"`
+			Value float32 `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		ctx, warning, ok := s.controlLock(w, r, cardID, localio.ChannelKey(localio.WriteOpAO, req.Index))
+		if !ok {
+			return
+		}
+		if err := s.mgr.QueueWriteAOContext(ctx, cardID, req.Index, req.Value); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(okResponse(warning))
+
+	case strings.HasSuffix(path, "/write-aotype"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Index int    `json:"index"`
+			Mode  string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		ctx, warning, ok := s.controlLock(w, r, cardID, localio.ChannelKey(localio.WriteOpAOType, req.Index))
+		if !ok {
+			return
+		}
+		if err := s.mgr.QueueWriteAOTypeContext(ctx, cardID, req.Index, req.Mode); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(okResponse(warning))
+
+	case strings.HasSuffix(path, "/write-aotype-all"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// Either "mode" (applied to every channel) or "modes" (one per channel)
+		var req struct {
+			Mode  string   `json:"mode"`
+			Modes []string `json:"modes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		modes := req.Modes
+		if len(modes) == 0 && req.Mode != "" {
+			modes = []string{req.Mode}
+		}
+		channels := make([]string, card.Spec().AO)
+		for i := range channels {
+			channels[i] = localio.ChannelKey(localio.WriteOpAOType, i)
+		}
+		ctx, warning, ok := s.controlLock(w, r, cardID, channels...)
+		if !ok {
+			return
+		}
+		results, err := s.mgr.WriteAOTypeAllContext(ctx, cardID, modes)
+		if err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		status := "ok"
+		for _, result := range results {
+			if result.Status == "error" {
+				status = "error"
+				break
+			}
+		}
+		response := map[string]interface{}{"status": status, "results": results}
+		if warning != "" {
+			response["warning"] = warning
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case strings.HasSuffix(path, "/reboot"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.mgr.RebootCard(cardID); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	case strings.HasSuffix(path, "/refresh-identity"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.mgr.RefreshIdentity(cardID); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// cardErrorsHandler returns the recent bus errors of a card, oldest first (?limit=&offset= for a page)
+func (s *Server) cardErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	page, err := parsePageQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	errs, err := s.mgr.GetCardErrors(mux.Vars(r)["id"])
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	resp := map[string]interface{}{}
+	resp["errors"] = paginate(errs, page, resp)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// safeStateChecksHandler lists the last read-back of each card's outputs after a safe state activation
+func (s *Server) safeStateChecksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"cards": s.mgr.GetSafeStateChecks()})
+}
+
+// relayCyclesHandler lists the DO transition counts of all cards (GET) or resets those of a card
+// (DELETE .../{id}/relay-cycles, optionally ?channel=do0) after its relays were replaced
+func (s *Server) relayCyclesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		if err := s.mgr.ResetRelayCycles(mux.Vars(r)["id"], r.URL.Query().Get("channel")); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"relays": s.mgr.GetRelayCycles()})
+}
+
+// runtimeHandler lists the running hours of all outputs (GET) or resets those of a card
+// (DELETE .../{id}/runtime, optionally ?channel=do0) after the equipment was serviced
+func (s *Server) runtimeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		if err := s.mgr.ResetRuntime(mux.Vars(r)["id"], r.URL.Query().Get("channel")); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"outputs": s.mgr.GetRuntimes()})
+}
+
+// aiStatsHandler lists the daily min/max/avg of every AI channel
+func (s *Server) aiStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": s.mgr.GetAIStats()})
+}
+
+// replacementsHandler lists the completed and pending card replacements (?limit=&offset= for a page)
+func (s *Server) replacementsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	page, err := parsePageQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	resp := map[string]interface{}{}
+	resp["replacements"] = paginate(s.mgr.GetReplacements(), page, resp)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// replaceCardHandler marks a card as being replaced (POST, optionally with the new card's serial number)
+// or cancels the replacement (DELETE)
+func (s *Server) replaceCardHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	cardID := mux.Vars(r)["id"]
+
+	if r.Method == http.MethodDelete {
+		if err := s.mgr.CancelReplace(cardID); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		return
+	}
+
+	var req struct {
+		Serial string `json:"serial"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+	}
+	replacement, err := s.mgr.BeginReplace(cardID, req.Serial)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(replacement)
+}
+
+// pointsHandler lists the points with their current values
+func (s *Server) pointsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"points": s.mgr.GetPoints()})
+}
+
+// importPointsHandler loads a point schedule from the CSV body; ?merge=true keeps the points of other
+// channels instead of replacing all of them
+func (s *Server) importPointsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	merge := r.URL.Query().Get("merge") == "true"
+	n, err := s.mgr.ImportPointsCSVContext(r.Context(), r.Body, merge)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"imported": n, "points": s.mgr.GetPoints()})
+}
+
+// projectExportHandler returns the point database of the unit as a project document
+func (s *Server) projectExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	project := s.mgr.ExportProject()
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="jaspermate-project-%s.json"`, project.DeviceID))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(project)
+}
+
+// projectImportHandler replaces the point database by an exported project document. It requires the admin
+// token, since the document includes the write permissions.
+func (s *Server) projectImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireAdmin(w, r) {
+		return
+	}
+	var project localio.Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+		return
+	}
+	warnings, err := s.mgr.ImportProjectContext(r.Context(), project)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "warnings": warnings})
+}
+
+// commissioningHandler returns the commissioning checklist and report (GET) or clears the progress (DELETE)
+func (s *Server) commissioningHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		if err := s.mgr.ResetCommissioning(); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(s.mgr.GetCommissioningReport())
+}
+
+// commissioningChannelHandler marks a channel verified, failed, or pending again
+// ({"status":"verified","by":"J. Smith","note":"pump starts"}); without "by" the client is recorded
+func (s *Server) commissioningChannelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req struct {
+		Status string `json:"status"`
+		By     string `json:"by"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+		return
+	}
+	if req.By == "" {
+		req.By = httpSource(r).String()
+	}
+	vars := mux.Vars(r)
+	check, err := s.mgr.MarkChannel(vars["id"], vars["channel"], req.Status, req.By, req.Note)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(check)
+}
+
+// snapshotHandler returns the cards (?cards=1,2, default all) as of the end of the last poll cycle
+func (s *Server) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var ids []string
+	if v := r.URL.Query().Get("cards"); v != "" {
+		ids = strings.Split(v, ",")
+	}
+	s.mgr.TouchConsumer(httpSource(r).String())
+	snap, err := s.mgr.GetSnapshot(ids)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(snap)
+}
+
+// cycleStatsHandler returns the cycle, card read and write wait durations
+func (s *Server) cycleStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.mgr.GetCycleStats())
+}
+
+// simulateHandler injects (POST) or clears (DELETE) simulated input values for a card.
+// Not blocked by a connected TCP client: the point is to test the controller's logic.
+func (s *Server) simulateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	cardID := mux.Vars(r)["id"]
+
+	if !config.GetConfig().SimulationEnabled {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "input simulation is disabled (simulation_enabled in config)")
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodDelete {
+		err = s.mgr.ClearSimulation(cardID)
+	} else {
+		var req struct {
+			DI map[int]bool    `json:"di"`
+			AI map[int]float32 `json:"ai"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		err = s.mgr.SimulateInputs(cardID, req.DI, req.AI)
+	}
+
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// simulateWriteHandler runs a batch of writes through the write checks and returns the predicted results
+// and bus requests without writing, as a pre-flight check for controllers. The batch is checked as a
+// write of the request's client, or of the source given in the body (e.g. {"kind":"tcp"}).
+func (s *Server) simulateWriteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Source   *localio.WriteSource `json:"source"`
+		Commands []struct {
+			Type   string  `json:"type"` // "write-do", "write-ao" or "write-aotype"
+			CardID string  `json:"cardId"`
+			Index  int     `json:"index"`
+			State  bool    `json:"state"`
+			Value  float32 `json:"value"`
+			Mode   string  `json:"mode"`
+		} `json:"commands"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+		return
+	}
+	if len(req.Commands) == 0 {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "no commands in batch")
+		return
+	}
+	ops := make([]localio.WriteOperation, len(req.Commands))
+	for i, cmd := range req.Commands {
+		ops[i] = localio.WriteOperation{CardID: cmd.CardID, Index: cmd.Index}
+		switch cmd.Type {
+		case "write-do":
+			ops[i].Type = localio.WriteOpDO
+			if cmd.State {
+				ops[i].Value = 1
+			}
+		case "write-ao":
+			ops[i].Type, ops[i].Value = localio.WriteOpAO, cmd.Value
+		case "write-aotype":
+			ops[i].Type, ops[i].Mode = localio.WriteOpAOType, cmd.Mode
+		default:
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, fmt.Sprintf("commands[%d]: unknown type %q", i, cmd.Type))
+			return
+		}
+	}
+
+	src := httpSource(r)
+	if req.Source != nil {
+		if req.Source.Kind == "" {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "source kind is required")
+			return
+		}
+		src = *req.Source
+	}
+	json.NewEncoder(w).Encode(s.mgr.SimulateBatchWrite(localio.WithSource(r.Context(), src), ops))
+}
+
+func (s *Server) recorderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(s.mgr.RecorderStatus())
+		return
+	}
+
+	var req struct {
+		Name  string  `json:"name"`
+		Speed float64 `json:"speed"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+	}
+
+	var err error
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/record/start"):
+		if req.Name == "" {
+			req.Name = "recording-" + time.Now().Format("20060102-150405")
+		}
+		err = s.mgr.StartRecording(req.Name)
+	case strings.HasSuffix(path, "/record/stop"):
+		err = s.mgr.StopRecording()
+	case strings.HasSuffix(path, "/replay/start"):
+		err = s.mgr.StartReplay(req.Name, req.Speed)
+	case strings.HasSuffix(path, "/replay/stop"):
+		err = s.mgr.StopReplay()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(s.mgr.RecorderStatus())
+}
+
+// readdressHandler drives the guided slave re-addressing workflow
+func (s *Server) readdressHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(s.mgr.ReaddressStatus())
+		return
+	}
+
+	path := r.URL.Path
+	if !strings.HasSuffix(path, "/stop") && s.tcpConnected() {
+		writeError(w, http.StatusServiceUnavailable, localio.CodeControlLocked, "TCP client is connected, frontend controls are disabled")
+		return
+	}
+
+	var err error
+	switch {
+	case strings.HasSuffix(path, "/start"):
+		req := struct {
+			Port         string `json:"port"`
+			StartAddress int    `json:"startAddress"`
+		}{Port: config.GetSettings().SerialPort, StartAddress: 2}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+				return
+			}
+		}
+		err = s.mgr.StartReaddressing(req.Port, req.StartAddress)
+	case strings.HasSuffix(path, "/confirm"):
+		err = s.mgr.ConfirmReaddress()
+	case strings.HasSuffix(path, "/stop"):
+		err = s.mgr.StopReaddressing()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(s.mgr.ReaddressStatus())
+}
+
+func (s *Server) getPIDLoopsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"loops": s.mgr.GetPIDLoops()})
+}
+
+func (s *Server) pidLoopHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["name"]
+
+	var err error
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/setpoint"):
+		var req struct {
+			Setpoint float64 `json:"setpoint"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		err = s.mgr.SetPIDSetpointContext(r.Context(), name, req.Setpoint)
+
+	case strings.HasSuffix(path, "/mode"):
+		var req struct {
+			Mode   string  `json:"mode"`
+			Output float64 `json:"output"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		err = s.mgr.SetPIDModeContext(r.Context(), name, req.Mode, req.Output)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *Server) interlocksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Interlocks []config.InterlockRule `json:"interlocks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetInterlocksContext(r.Context(), req.Interlocks); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"interlocks": s.mgr.GetInterlocks()})
+}
+
+// writePermissionsHandler lists the write permissions; replacing them requires the admin token, so the
+// clients they restrict can't lift them
+func (s *Server) writePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		if !requireAdmin(w, r) {
+			return
+		}
+		var req struct {
+			WritePermissions []config.WritePermission `json:"writePermissions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetWritePermissionsContext(r.Context(), req.WritePermissions); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"writePermissions": s.mgr.GetWritePermissions()})
+}
+
+func (s *Server) doTimingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			DOTimings []config.DOTiming `json:"doTimings"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetDOTimingsContext(r.Context(), req.DOTimings); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"doTimings": s.mgr.GetDOTimings()})
+}
+
+func (s *Server) heartbeatOutputHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var hb config.HeartbeatOutput
+		if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetHeartbeatOutputContext(r.Context(), hb); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(s.mgr.GetHeartbeatOutput())
+}
+
+func (s *Server) aoSlewRatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			SlewRates []config.AOSlewRate `json:"slewRates"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetAOSlewRatesContext(r.Context(), req.SlewRates); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"slewRates": s.mgr.GetAOSlewRates(),
+		"ramps":     s.mgr.GetAORamps(),
+	})
+}
+
+func (s *Server) disabledChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Channels []config.InputChannel `json:"channels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetDisabledChannelsContext(r.Context(), req.Channels); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": s.mgr.GetDisabledChannels()})
+}
+
+func (s *Server) priorityChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Channels []config.InputChannel `json:"channels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetPriorityChannelsContext(r.Context(), req.Channels); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": s.mgr.GetPriorityChannels()})
+}
+
+func (s *Server) pulseChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Channels []config.InputChannel `json:"channels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetPulseChannelsContext(r.Context(), req.Channels); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": s.mgr.GetPulseChannels()})
+}
+
+func (s *Server) currentLoopInputsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Channels []config.InputChannel `json:"channels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetCurrentLoopInputsContext(r.Context(), req.Channels); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": s.mgr.GetCurrentLoopInputs()})
+}
+
+func (s *Server) sequencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Sequences []config.Sequence `json:"sequences"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetSequencesContext(r.Context(), req.Sequences); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"sequences": s.mgr.GetSequences()})
+}
+
+func (s *Server) schedulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Schedules []config.Schedule `json:"schedules"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetSchedulesContext(r.Context(), req.Schedules); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	resp := map[string]interface{}{"schedules": s.mgr.GetSchedules()}
+	if sun := s.mgr.GetSunTimes(); sun != nil {
+		resp["sun"] = sun
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// calendarHandler returns or replaces the calendar exceptions (holidays) of the schedules
+func (s *Server) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Exceptions []config.CalendarException `json:"exceptions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetCalendarContext(r.Context(), req.Exceptions); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"exceptions": s.mgr.GetCalendar()})
+}
+
+func (s *Server) alarmRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Alarms []config.AlarmRule `json:"alarms"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetAlarmRulesContext(r.Context(), req.Alarms); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"alarms": s.mgr.GetAlarmRules()})
+}
+
+// maintenanceHandler returns or replaces the maintenance windows, with the open one
+func (s *Server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Windows []config.MaintenanceWindow `json:"windows"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetMaintenanceWindowsContext(r.Context(), req.Windows); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(s.mgr.GetMaintenance())
+}
+
+// notificationsHandler returns or replaces the notification channels and alarm escalation policies
+func (s *Server) notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req config.Notifications
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetNotificationsContext(r.Context(), req); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(s.mgr.GetNotifications())
+}
+
+// testNotificationsHandler sends a synthetic event to every notification channel, or to the one named in
+// the optional body {"channel":"ops-mail"}, and returns the deliveries
+func (s *Server) testNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+	}
+	deliveries, err := s.mgr.TestNotifications(req.Channel)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": deliveries})
+}
+
+// notificationDeliveriesHandler lists the recent notification deliveries, newest first (?limit=&offset=
+// for a page)
+func (s *Server) notificationDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	page, err := parsePageQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	resp := map[string]interface{}{}
+	resp["deliveries"] = paginate(s.mgr.GetNotificationDeliveries(), page, resp)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// journalHandler queries the persistent event journal, newest first
+// e.g. ?type=alarm&severity=warning&card=2&since=2024-05-01T00:00:00Z&limit=50&before=1234
+func (s *Server) journalHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q, err := parseJournalQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	page, err := s.mgr.QueryJournal(q)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseJournalQuery reads the journal filters and page from the query string
+func parseJournalQuery(v url.Values) (localio.JournalQuery, error) {
+	q := localio.JournalQuery{Type: v.Get("type"), Severity: v.Get("severity"), CardID: v.Get("card")}
+	var err error
+	if s := v.Get("since"); s != "" {
+		if q.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, err
+		}
+	}
+	if s := v.Get("until"); s != "" {
+		if q.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, err
+		}
+	}
+	if s := v.Get("before"); s != "" {
+		if q.Before, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return q, err
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// alarmsHandler returns the alarm list (active or unacknowledged alarms), or all alarms with ?all=true
+func (s *Server) alarmsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	all := r.URL.Query().Get("all") == "true"
+	json.NewEncoder(w).Encode(map[string]interface{}{"alarms": s.mgr.GetAlarms(!all)})
+}
+
+// alarmHandler acknowledges, shelves or unshelves an alarm. Allowed while a TCP client is connected:
+// managing alarms doesn't write outputs.
+func (s *Server) alarmHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["name"]
+
+	var req struct {
+		User        string `json:"user"`
+		Comment     string `json:"comment"` // Acknowledgment comment or shelving reason
+		DurationSec int    `json:"durationSec"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+		return
+	}
+
+	path := r.URL.Path
+	var err error
+	switch {
+	case strings.HasSuffix(path, "/ack"):
+		err = s.mgr.AcknowledgeAlarm(name, req.User, req.Comment)
+	case strings.HasSuffix(path, "/unshelve"):
+		err = s.mgr.UnshelveAlarm(name, req.User)
+	case strings.HasSuffix(path, "/shelve"):
+		err = s.mgr.ShelveAlarm(name, req.User, req.Comment, time.Duration(req.DurationSec)*time.Second)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *Server) scriptsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Scripts []config.Script `json:"scripts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+			return
+		}
+		if err := s.mgr.SetScriptsContext(r.Context(), req.Scripts); err != nil {
+			writeManagerError(w, err)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"scripts": s.mgr.GetScripts()})
+}
+
+func (s *Server) sequenceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["name"]
+
+	path := r.URL.Path
+	var err error
+	switch {
+	case strings.HasSuffix(path, "/start"):
+		if s.tcpConnected() {
+			writeError(w, http.StatusServiceUnavailable, localio.CodeControlLocked, "TCP client is connected, frontend controls are disabled")
+			return
+		}
+		err = s.mgr.StartSequence(name)
+	case strings.HasSuffix(path, "/abort"):
+		// Aborting is always allowed
+		err = s.mgr.AbortSequence(name)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// rotateDeviceIDHandler regenerates the DeviceID and returns a one-time claim token (admin only)
+func (s *Server) rotateDeviceIDHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	deviceID, token, expiresAt, err := config.RotateDeviceID(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, localio.CodeInternal, fmt.Sprintf("failed to rotate device ID: %v", err))
+		return
+	}
+	log.Printf("device ID rotated to %s, claim token valid until %s", deviceID, expiresAt.Format(time.RFC3339))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deviceId":   deviceID,
+		"claimToken": token,
+		"expiresAt":  expiresAt,
+	})
+}
+
+// claimHandler redeems a claim token issued by rotateDeviceIDHandler; the token is the credential
+func (s *Server) claimHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		ClaimToken string `json:"claimToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+		return
+	}
+	deviceID, err := config.ConsumeClaimToken(req.ClaimToken)
+	if errors.Is(err, config.ErrInvalidClaimToken) {
+		writeError(w, http.StatusUnauthorized, localio.CodeUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, localio.CodeInternal, fmt.Sprintf("failed to save config: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"deviceId": deviceID})
+}
+
+// heartbeatHandler returns the state of the management heartbeat
+func (s *Server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.heartbeat == nil {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "heartbeat_url is not configured")
+		return
+	}
+	json.NewEncoder(w).Encode(s.heartbeat.Status())
+}
+
+// mqttHandler returns the state of the MQTT broker connection
+func (s *Server) mqttHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.mqtt == nil {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "mqtt.broker is not configured")
+		return
+	}
+	json.NewEncoder(w).Encode(s.mqtt.Status())
+}
+
+// natsHandler returns the state of the NATS server connection
+func (s *Server) natsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.nats == nil {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "nats.url is not configured")
+		return
+	}
+	json.NewEncoder(w).Encode(s.nats.Status())
+}
+
+// redisHandler returns the state of the Redis state mirror
+func (s *Server) redisHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.redis == nil {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "redis.addr is not configured")
+		return
+	}
+	json.NewEncoder(w).Encode(s.redis.Status())
+}
+
+// cloudTwinHandler returns the state of the device twin/shadow connection
+func (s *Server) cloudTwinHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.cloudTwin == nil {
+		writeError(w, http.StatusForbidden, localio.CodeFeatureDisabled, "cloud_twin is not configured")
+		return
+	}
+	json.NewEncoder(w).Encode(s.cloudTwin.Status())
+}
+
+// driversHandler lists the compiled-in card drivers and their models
+func (s *Server) driversHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	type driverInfo struct {
+		Name   string              `json:"name"`
+		Models []localio.ModelSpec `json:"models"`
+	}
+	drivers := []driverInfo{}
+	for _, d := range localio.Drivers() {
+		drivers = append(drivers, driverInfo{Name: d.Name(), Models: d.Models()})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"drivers": drivers})
+}
+
+// settingsHandler returns the effective settings and their defaults
+func (s *Server) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings": config.GetSettings(),
+		"defaults": config.DefaultSettings(),
+		"profile":  config.ActiveProfile(),
+	})
+}
+
+// tcpSchemaHandler returns the JSON Schema of the TCP protocol messages
+func (s *Server) tcpSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tcp.Schema())
+}
+
+// validateConfigHandler validates a config file (YAML or JSON with the config.yaml field names) without
+// applying it. An empty body validates the running config.
+func (s *Server) validateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid body")
+		return
+	}
+
+	var problems []localio.ConfigProblem
+	if len(bytes.TrimSpace(body)) == 0 {
+		problems = s.mgr.ValidateConfig(config.GetConfig())
+	} else if cfg, err := config.Parse(body); err != nil {
+		problems = []localio.ConfigProblem{{Message: err.Error()}}
+	} else {
+		problems = s.mgr.ValidateConfig(cfg)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
+
+// versioned attributes the configuration changes made by a mutating request to the client: the request
+// context carries the change recorded in the config history (see config.WithChange)
+func versioned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			change := config.Change{Actor: httpSource(r).String(), Summary: r.Method + " " + r.URL.Path}
+			r = r.WithContext(config.WithChange(r.Context(), change))
+		}
+		h(w, r)
+	}
+}
+
+// configHistoryHandler lists the kept configuration versions, newest first (?limit=&offset= for a page)
+func (s *Server) configHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	page, err := parsePageQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid query: "+err.Error())
+		return
+	}
+	versions, err := config.History()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, localio.CodeInternal, fmt.Sprintf("failed to read config history: %v", err))
+		return
+	}
+	resp := map[string]interface{}{}
+	resp["versions"] = paginate(versions, page, resp)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// configRollbackHandler restores a configuration version
+func (s *Server) configRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "invalid version")
+		return
+	}
+	if err := s.mgr.RollbackConfigContext(r.Context(), version); err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
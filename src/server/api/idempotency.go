@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+// maxIdempotencyKeyLen is the longest accepted Idempotency-Key
+const maxIdempotencyKeyLen = 255
+
+// idempotentResponse is the response to the first request with an idempotency key
+type idempotentResponse struct {
+	fingerprint string        // Method, path and body hash of the request
+	done        chan struct{} // Closed once the response is recorded
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore keeps the responses of write requests by client and Idempotency-Key, so a retried
+// request returns the first response instead of writing again
+type idempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	now       func() time.Time
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{responses: make(map[string]*idempotentResponse), now: time.Now}
+}
+
+// begin returns the response recorded for key, or registers a new one for the caller to fill in
+// (first == true). Expired responses are dropped.
+func (s *idempotencyStore) begin(key, fingerprint string) (resp *idempotentResponse, first bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for k, r := range s.responses {
+		if !r.expires.IsZero() && now.After(r.expires) {
+			delete(s.responses, k)
+		}
+	}
+	if resp, ok := s.responses[key]; ok {
+		return resp, false
+	}
+	resp = &idempotentResponse{fingerprint: fingerprint, done: make(chan struct{})}
+	s.responses[key] = resp
+	return resp, true
+}
+
+// finish records the response and releases the requests waiting for it
+func (s *idempotencyStore) finish(resp *idempotentResponse, rec *responseRecorder, window time.Duration) {
+	s.mu.Lock()
+	resp.status = rec.status
+	if resp.status == 0 {
+		resp.status = http.StatusOK
+	}
+	resp.header = rec.Header().Clone()
+	resp.body = rec.body.Bytes()
+	resp.expires = s.now().Add(window)
+	s.mu.Unlock()
+	close(resp.done)
+}
+
+// responseRecorder passes a response through and keeps a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent deduplicates retried write requests: a request repeating the Idempotency-Key of an earlier
+// request of the same client within idempotency_window_sec gets the earlier response (marked with
+// Idempotent-Replayed: true) instead of being executed again. A retry arriving while the first request
+// is still running waits for it. Requests without the header are executed as usual.
+func (s *Server) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			h(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "Idempotency-Key is too long")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "failed to read body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := r.Method + " " + r.URL.Path + " " + hex.EncodeToString(sum[:])
+
+		window := config.GetSettings().IdempotencyWindow()
+		resp, first := s.idempotency.begin(httpSource(r).ID+" "+key, fingerprint)
+		if first {
+			rec := &responseRecorder{ResponseWriter: w}
+			defer s.idempotency.finish(resp, rec, window)
+			h(rec, r)
+			return
+		}
+
+		if resp.fingerprint != fingerprint {
+			writeError(w, http.StatusUnprocessableEntity, localio.CodeInvalidRequest, "Idempotency-Key was used for a different request")
+			return
+		}
+		select {
+		case <-resp.done:
+		case <-r.Context().Done():
+			return
+		}
+		for name, values := range resp.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	}
+}
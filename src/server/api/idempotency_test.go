@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	s := &Server{idempotency: newIdempotencyStore()}
+	calls := 0
+	h := s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/jaspermate-io/1/write-do", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	first := send("k1", `{"index":0,"state":true}`)
+	retry := send("k1", `{"index":0,"state":true}`)
+	if calls != 1 {
+		t.Fatalf("Expected the retry not to be executed, got %d calls", calls)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the first response to be replayed, got %d %q %v", retry.Code, retry.Body.String(), retry.Header())
+	}
+	if rr := send("k1", `{"index":1,"state":true}`); rr.Code != http.StatusUnprocessableEntity || calls != 1 {
+		t.Errorf("Expected 422 for a reused key, got %d", rr.Code)
+	}
+	send("k2", `{"index":0,"state":true}`)
+	if calls != 2 {
+		t.Errorf("Expected a new key to be executed, got %d calls", calls)
+	}
+
+	// After the window the key can be used again
+	s.idempotency.now = func() time.Time { return time.Now().Add(time.Hour) }
+	send("k1", `{"index":0,"state":true}`)
+	if calls != 3 {
+		t.Errorf("Expected an expired key to be executed again, got %d calls", calls)
+	}
+}
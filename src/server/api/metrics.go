@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	w io.Writer
+}
+
+// metric writes one sample, preceded by HELP and TYPE lines when help is set.
+// labels are written in sorted order.
+func (m metricsWriter) metric(name, kind, help string, labels map[string]string, value float64) {
+	if help != "" {
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	fmt.Fprintf(m.w, "%s%s %g\n", name, formatLabels(labels), value)
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts[i] = fmt.Sprintf("%s=%q", k, v)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// metricsHandler serves the service metrics for Prometheus scraping
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metricsWriter{w: w}
+	if s.tcpServer != nil {
+		s.writeTCPMetrics(m)
+	}
+	if s.mgr != nil {
+		s.writeRelayMetrics(m)
+		s.writeRuntimeMetrics(m)
+		s.writeCycleMetrics(m)
+	}
+}
+
+// writeCycleMetrics writes the cycle, card read and write wait durations
+func (s *Server) writeCycleMetrics(m metricsWriter) {
+	st := s.mgr.GetCycleStats()
+	m.metric("cm_utils_cycles_total", "counter", "Read-write cycles run.", nil, float64(st.Cycles))
+	m.metric("cm_utils_cycle_duration_seconds", "gauge", "Duration of the last read-write cycle.", nil, st.LastCycleMs/1000)
+	m.metric("cm_utils_cycle_over_budget_total", "counter", "Read-write cycles that took longer than cycle_budget_ms.", nil, float64(st.OverBudget))
+	for i, c := range st.Cards {
+		help := ""
+		if i == 0 {
+			help = "Duration of the last read of a card."
+		}
+		m.metric("cm_utils_card_read_duration_seconds", "gauge", help, map[string]string{"card": c.CardID}, c.LastReadMs/1000)
+	}
+	m.metric("cm_utils_write_wait_seconds_total", "counter", "Time executed queued writes waited in the queue.", nil, st.TotalWaitMs/1000)
+	m.metric("cm_utils_write_waits_total", "counter", "Queued writes executed.", nil, float64(st.WriteWaits))
+}
+
+// writeRelayMetrics writes the DO transition counts
+func (s *Server) writeRelayMetrics(m metricsWriter) {
+	for i, rc := range s.mgr.GetRelayCycles() {
+		help := ""
+		if i == 0 {
+			help = "DO transitions (relay switching operations), persisted across restarts."
+		}
+		m.metric("cm_utils_relay_transitions_total", "counter", help,
+			map[string]string{"card": rc.CardID, "channel": rc.Channel}, float64(rc.Transitions))
+	}
+}
+
+// writeRuntimeMetrics writes the running time of the outputs
+func (s *Server) writeRuntimeMetrics(m metricsWriter) {
+	for i, rt := range s.mgr.GetRuntimes() {
+		help := ""
+		if i == 0 {
+			help = "Running time of DO (on) and AO (above ao_runtime_threshold) channels, persisted across restarts."
+		}
+		m.metric("cm_utils_output_runtime_seconds_total", "counter", help,
+			map[string]string{"card": rt.CardID, "channel": rt.Channel}, rt.Hours*3600)
+	}
+}
+
+// writeTCPMetrics writes the TCP server connection and message counters
+func (s *Server) writeTCPMetrics(m metricsWriter) {
+	st := s.tcpServer.Stats()
+
+	connected := 0.0
+	if st.Client != nil {
+		connected = 1
+	}
+	m.metric("cm_utils_tcp_client_connected", "gauge", "Whether a TCP client is connected.", nil, connected)
+	m.metric("cm_utils_tcp_connections_accepted_total", "counter", "TCP connections accepted.", nil, float64(st.ConnectionsAccepted))
+
+	reasons := make([]string, 0, len(st.ConnectionsRejected))
+	for reason := range st.ConnectionsRejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for i, reason := range reasons {
+		help := ""
+		if i == 0 {
+			help = "TCP connections rejected, by reason."
+		}
+		m.metric("cm_utils_tcp_connections_rejected_total", "counter", help,
+			map[string]string{"reason": reason}, float64(st.ConnectionsRejected[reason]))
+	}
+
+	m.metric("cm_utils_tcp_messages_sent_total", "counter", "Messages sent to the TCP client.", nil, float64(st.MessagesSent))
+	m.metric("cm_utils_tcp_messages_received_total", "counter", "Messages received from the TCP client.", nil, float64(st.MessagesReceived))
+	m.metric("cm_utils_tcp_protocol_errors_total", "counter", "Received TCP messages rejected as invalid.", nil, float64(st.ProtocolErrors))
+	m.metric("cm_utils_tcp_encode_failures_total", "counter", "Messages that failed to encode or send to the TCP client.", nil, float64(st.EncodeFailures))
+	m.metric("cm_utils_tcp_safe_state_activations_total", "counter", "Outputs written to safe state after the TCP client disconnected.", nil, float64(st.SafeStateActivations))
+	m.metric("cm_utils_tcp_safe_state_failures_total", "counter", "Safe state writes after a TCP disconnect that failed.", nil, float64(st.SafeStateFailures))
+	m.metric("cm_utils_tcp_updates_dropped_total", "counter", "Card updates dropped because the TCP client fell behind.", nil, float64(st.UpdatesDropped))
+	m.metric("cm_utils_tcp_slow_client_disconnects_total", "counter", "TCP clients disconnected because their send queue was full.", nil, float64(st.SlowClientDisconnects))
+	m.metric("cm_utils_tcp_sessions_resumed_total", "counter", "TCP client sessions resumed after a reconnect.", nil, float64(st.SessionsResumed))
+	queued := 0.0
+	if st.Client != nil {
+		queued = float64(st.Client.Queued)
+	}
+	m.metric("cm_utils_tcp_send_queue_length", "gauge", "Messages waiting to be written to the TCP client.", nil, queued)
+}
+
+// tcpStatsHandler returns the TCP server connection and message counters
+func (s *Server) tcpStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.tcpServer == nil {
+		writeError(w, http.StatusServiceUnavailable, localio.CodeInternal, "TCP server is not running")
+		return
+	}
+	json.NewEncoder(w).Encode(s.tcpServer.Stats())
+}
+
+// tcpClientsHandler lists the TCP clients that have connected, to audit which controllers drove the outputs
+func (s *Server) tcpClientsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.tcpServer == nil {
+		writeError(w, http.StatusServiceUnavailable, localio.CodeInternal, "TCP server is not running")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"clients": s.tcpServer.Clients()})
+}
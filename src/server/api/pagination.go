@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// maxPageLimit is the largest accepted ?limit= of a list
+const maxPageLimit = 1000
+
+// pageQuery is the optional page of a list, e.g. ?limit=50&offset=100. Without a limit the whole list is
+// returned, as before lists were paginated.
+type pageQuery struct {
+	limit  int
+	offset int
+}
+
+// parsePageQuery reads the page of a list from the query string
+func parsePageQuery(q url.Values) (pageQuery, error) {
+	var p pageQuery
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if p.limit, err = strconv.Atoi(v); err != nil {
+			return p, err
+		}
+		if p.limit < 1 || p.limit > maxPageLimit {
+			return p, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if p.offset, err = strconv.Atoi(v); err != nil {
+			return p, err
+		}
+		if p.offset < 0 {
+			return p, errors.New("offset must not be negative")
+		}
+	}
+	return p, nil
+}
+
+// paginate returns the page of items and adds the paging fields to the response: total, the number of
+// items of the list, and next, the offset of the next page if there are more items
+func paginate[T any](items []T, p pageQuery, resp map[string]interface{}) []T {
+	total := len(items)
+	resp["total"] = total
+	start := min(p.offset, total)
+	end := total
+	if p.limit > 0 && start+p.limit < total {
+		end = start + p.limit
+		resp["next"] = end
+	}
+	return items[start:end]
+}
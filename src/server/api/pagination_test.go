@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		query string
+		page  []int
+		next  interface{}
+	}{
+		{"", []int{1, 2, 3, 4, 5}, nil},
+		{"limit=2", []int{1, 2}, 2},
+		{"limit=2&offset=2", []int{3, 4}, 4},
+		{"limit=2&offset=4", []int{5}, nil},
+		{"offset=3", []int{4, 5}, nil},
+		{"limit=10&offset=9", []int{}, nil},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		p, err := parsePageQuery(q)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", tt.query, err)
+		}
+		resp := map[string]interface{}{}
+		page := paginate(items, p, resp)
+		if !reflect.DeepEqual(page, tt.page) || resp["next"] != tt.next || resp["total"] != 5 {
+			t.Errorf("%q: got %v %v", tt.query, page, resp)
+		}
+	}
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=x", "offset=-1"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parsePageQuery(q); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func TestCardsPagination(t *testing.T) {
+	s := newTestServer(fakeTCP{})
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/jaspermate-io?limit=10", nil))
+	var out map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rr.Code != http.StatusOK || out["total"] != 0.0 || out["next"] != nil {
+		t.Errorf("Expected an empty page, got %d %v", rr.Code, out)
+	}
+
+	rr = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/jaspermate-io?limit=0", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for limit 0, got %d", rr.Code)
+	}
+}
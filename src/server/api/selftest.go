@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+// minSaneTime is the earliest plausible clock time; a unit without a synchronized RTC starts in 1970
+var minSaneTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SelfTestCheck is the result of one self-test check
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// SelfTest is the report of the self-test run at startup
+type SelfTest struct {
+	Time    time.Time       `json:"time"`
+	Version string          `json:"version"`
+	Passed  bool            `json:"passed"`
+	Checks  []SelfTestCheck `json:"checks"`
+}
+
+// selfTestResult keeps the last self-test report
+type selfTestResult struct {
+	mu     sync.Mutex
+	report SelfTest
+}
+
+// RunSelfTest checks that the unit is ready for operation: the config is valid, the serial ports open, at
+// least one card responds, the clock is set, and the config is stored persistently
+func (s *Server) RunSelfTest() SelfTest {
+	report := SelfTest{Time: time.Now(), Version: s.version, Passed: true}
+	add := func(name string, passed bool, format string, args ...interface{}) {
+		report.Checks = append(report.Checks, SelfTestCheck{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+		report.Passed = report.Passed && passed
+	}
+
+	if problems := s.mgr.ValidateConfig(config.GetConfig()); len(problems) > 0 {
+		details := make([]string, len(problems))
+		for i, p := range problems {
+			details[i] = p.Error()
+		}
+		add("config", false, "%d problem(s): %s", len(problems), strings.Join(details, "; "))
+	} else {
+		add("config", true, "valid")
+	}
+
+	var failed []string
+	ports := localio.DiscoveryOptionsFromSettings(config.GetSettings()).Ports
+	for _, path := range ports {
+		if err := s.mgr.CheckPort(path); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	if len(failed) > 0 {
+		add("serial-ports", false, "%s", strings.Join(failed, "; "))
+	} else {
+		add("serial-ports", true, "%s open", strings.Join(ports, ", "))
+	}
+
+	cards := s.mgr.GetAllCards()
+	responding := 0
+	for _, c := range cards {
+		if c.Last.Error == "" {
+			responding++
+		}
+	}
+	add("cards", responding > 0, "%d of %d card(s) responding", responding, len(cards))
+
+	if now := time.Now(); now.Before(minSaneTime) {
+		add("clock", false, "%s is before %s; check NTP or the RTC", now.UTC().Format(time.RFC3339), minSaneTime.Format("2006-01-02"))
+	} else {
+		add("clock", true, "%s", now.UTC().Format(time.RFC3339))
+	}
+
+	storage := config.GetStorage()
+	if f, err := os.CreateTemp(config.DataDir(), ".selftest"); err != nil {
+		add("disk", false, "%s is not writable: %v", config.DataDir(), err)
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+		if storage.Warning != "" {
+			add("disk", false, "%s", storage.Warning)
+		} else {
+			add("disk", true, "%s writable", config.DataDir())
+		}
+	}
+
+	s.selfTest.mu.Lock()
+	s.selfTest.report = report
+	s.selfTest.mu.Unlock()
+	return report
+}
+
+// LogSelfTest writes the startup banner with the self-test report
+func LogSelfTest(report SelfTest) {
+	result := "PASSED"
+	if !report.Passed {
+		result = "FAILED"
+	}
+	log.Printf("JasperMate Utils %s, device %s, config %s", report.Version, config.GetDeviceID(), config.GetStorage().Path)
+	log.Printf("Self-test %s", result)
+	for _, c := range report.Checks {
+		status := "ok  "
+		if !c.Passed {
+			status = "FAIL"
+		}
+		log.Printf("  %s %-12s %s", status, c.Name, c.Detail)
+	}
+}
+
+// selfTestHandler returns the startup self-test report (GET) or runs the self-test again (POST), e.g.
+// after fixing the wiring
+func (s *Server) selfTestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		json.NewEncoder(w).Encode(s.RunSelfTest())
+		return
+	}
+	s.selfTest.mu.Lock()
+	report := s.selfTest.report
+	s.selfTest.mu.Unlock()
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,297 @@
+// Package api is the HTTP API of JasperMate Utils: the card, configuration and diagnostics endpoints served
+// to the Cockpit plugin and other HTTP clients. The server only depends on the Manager and TCPServer
+// interfaces, so it can be embedded in other binaries and its handlers tested against fakes.
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"jaspermate-utils/src/server/cloud"
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/discovery"
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/mqtt"
+	"jaspermate-utils/src/server/nats"
+	"jaspermate-utils/src/server/redis"
+	"jaspermate-utils/src/server/tcp"
+	"jaspermate-utils/src/server/telemetry"
+
+	"github.com/gorilla/mux"
+)
+
+// Manager is the part of the localio manager served by the API; *localio.Manager implements it
+type Manager interface {
+	// Cards
+	GetAllCards() []*localio.Card
+	GetCard(id string) (*localio.Card, bool)
+	RefreshAll() []*localio.Card
+	Rediscover() int
+	GetSnapshot(cardIDs []string) (localio.Snapshot, error)
+	Offline(cardID string) bool
+	CheckPort(path string) error
+	BootID() string
+	AttachConsumer(name string) (detach func())
+	TouchConsumer(name string)
+	RefreshIdentity(cardID string) error
+	RebootCard(cardID string) error
+	RebootAll() []localio.RebootResult
+	GetCardErrors(cardID string) ([]localio.CardError, error)
+	GetSafeStateChecks() []localio.SafeStateCheck
+
+	// Writes
+	QueueWriteDOContext(ctx context.Context, cardID string, index int, state bool) error
+	QueueWriteAOContext(ctx context.Context, cardID string, index int, value float32) error
+	QueueWriteAOTypeContext(ctx context.Context, cardID string, index int, mode string) error
+	WriteAOTypeAllContext(ctx context.Context, cardID string, modes []string) ([]localio.CommandResult, error)
+	GetPendingWrites() []localio.PendingWrite
+	CancelPendingWrite(id uint64) error
+	GetOwners() []localio.ChannelOwner
+	GetAORamps() []localio.AORamp
+	SimulateInputs(cardID string, di map[int]bool, ai map[int]float32) error
+	ClearSimulation(cardID string) error
+	SimulateBatchWrite(ctx context.Context, ops []localio.WriteOperation) localio.WriteSimulation
+
+	// Diagnostics
+	GetCycleStats() localio.CycleStats
+	GetRelayCycles() []localio.RelayCycles
+	ResetRelayCycles(cardID, channel string) error
+	GetRuntimes() []localio.OutputRuntime
+	ResetRuntime(cardID, channel string) error
+	GetAIStats() []localio.AIStats
+	BeginReplace(cardID, expected string) (*localio.CardReplacement, error)
+	CancelReplace(cardID string) error
+	GetReplacements() []localio.CardReplacement
+	GetAsBuilt() localio.AsBuilt
+	AddEventListener(listener localio.EventListener)
+	QueryJournal(q localio.JournalQuery) (localio.JournalPage, error)
+	RecorderStatus() localio.RecorderStatus
+	StartRecording(name string) error
+	StopRecording() error
+	StartReplay(name string, speed float64) error
+	StopReplay() error
+	ReaddressStatus() localio.ReaddressStatus
+	StartReaddressing(port string, startAddress int) error
+	ConfirmReaddress() error
+	StopReaddressing() error
+
+	// Commissioning and points
+	GetCommissioningReport() localio.CommissioningReport
+	MarkChannel(cardID, channel, status, by, note string) (localio.ChannelCheck, error)
+	ResetCommissioning() error
+	GetPoints() []localio.PointValue
+	ImportPointsCSVContext(ctx context.Context, r io.Reader, merge bool) (int, error)
+	ExportProject() localio.Project
+	ImportProjectContext(ctx context.Context, p localio.Project) ([]string, error)
+
+	// Configuration sections
+	ValidateConfig(cfg config.Config) []localio.ConfigProblem
+	RollbackConfigContext(ctx context.Context, version int) error
+	GetInterlocks() []config.InterlockRule
+	SetInterlocksContext(ctx context.Context, rules []config.InterlockRule) error
+	GetWritePermissions() []config.WritePermission
+	SetWritePermissionsContext(ctx context.Context, perms []config.WritePermission) error
+	GetDOTimings() []config.DOTiming
+	SetDOTimingsContext(ctx context.Context, rules []config.DOTiming) error
+	GetAOSlewRates() []config.AOSlewRate
+	SetAOSlewRatesContext(ctx context.Context, rules []config.AOSlewRate) error
+	GetHeartbeatOutput() localio.HeartbeatOutputStatus
+	SetHeartbeatOutputContext(ctx context.Context, hb config.HeartbeatOutput) error
+	GetDisabledChannels() []config.InputChannel
+	SetDisabledChannelsContext(ctx context.Context, channels []config.InputChannel) error
+	GetPriorityChannels() []config.InputChannel
+	SetPriorityChannelsContext(ctx context.Context, channels []config.InputChannel) error
+	GetPulseChannels() []localio.PulseChannel
+	SetPulseChannelsContext(ctx context.Context, channels []config.InputChannel) error
+	GetCurrentLoopInputs() []config.InputChannel
+	SetCurrentLoopInputsContext(ctx context.Context, channels []config.InputChannel) error
+	GetNotifications() config.Notifications
+	SetNotificationsContext(ctx context.Context, n config.Notifications) error
+	TestNotifications(channel string) ([]localio.NotificationDelivery, error)
+	GetNotificationDeliveries() []localio.NotificationDelivery
+
+	// Alarms, sequences, schedules, scripts and PID loops
+	GetAlarmRules() []config.AlarmRule
+	SetAlarmRulesContext(ctx context.Context, rules []config.AlarmRule) error
+	GetMaintenance() localio.MaintenanceStatus
+	SetMaintenanceWindowsContext(ctx context.Context, windows []config.MaintenanceWindow) error
+	GetAlarms(listOnly bool) []localio.Alarm
+	AcknowledgeAlarm(name, user, comment string) error
+	ShelveAlarm(name, user, reason string, d time.Duration) error
+	UnshelveAlarm(name, user string) error
+	GetSequences() []localio.SequenceStatus
+	SetSequencesContext(ctx context.Context, seqs []config.Sequence) error
+	GetSchedules() []localio.ScheduleStatus
+	GetSunTimes() *localio.SunTimes
+	SetSchedulesContext(ctx context.Context, schedules []config.Schedule) error
+	GetCalendar() []config.CalendarException
+	SetCalendarContext(ctx context.Context, calendar []config.CalendarException) error
+	StartSequence(name string) error
+	AbortSequence(name string) error
+	GetScripts() []localio.ScriptStatus
+	SetScriptsContext(ctx context.Context, scripts []config.Script) error
+	GetPIDLoops() []localio.PIDLoopStatus
+	SetPIDSetpointContext(ctx context.Context, name string, setpoint float64) error
+	SetPIDModeContext(ctx context.Context, name string, mode string, output float64) error
+}
+
+// TCPServer is the state of the TCP interface used by the API; *tcp.TCPServer implements it
+type TCPServer interface {
+	// IsConnected reports whether a TCP client is connected; its writes take precedence over the frontend
+	IsConnected() bool
+	Stats() tcp.Stats
+	// Clients is the registry of the clients that have connected
+	Clients() []tcp.ClientRecord
+}
+
+// Options are the optional parts of the server. Status endpoints of connectors that are nil report them as
+// disabled.
+type Options struct {
+	Version   string
+	Heartbeat *discovery.HeartbeatAgent
+	MQTT      *mqtt.Connector
+	NATS      *nats.Connector
+	Redis     *redis.Mirror
+	CloudTwin *cloud.Connector
+}
+
+// Server serves the HTTP API
+type Server struct {
+	mgr       Manager
+	tcpServer TCPServer
+	version   string
+	heartbeat *discovery.HeartbeatAgent
+	mqtt      *mqtt.Connector
+	nats      *nats.Connector
+	redis     *redis.Mirror
+	cloudTwin *cloud.Connector
+	// idempotency keeps the responses of writes sent with an Idempotency-Key
+	idempotency *idempotencyStore
+	selfTest    selfTestResult
+	// events streams manager events to GET /api/events
+	events *eventStream
+}
+
+// New creates the API server for a manager and the TCP interface. tcpServer may be nil in embedded
+// servers without a TCP interface.
+func New(mgr Manager, tcpServer TCPServer, opts Options) *Server {
+	s := &Server{
+		mgr:         mgr,
+		tcpServer:   tcpServer,
+		version:     opts.Version,
+		heartbeat:   opts.Heartbeat,
+		mqtt:        opts.MQTT,
+		nats:        opts.NATS,
+		redis:       opts.Redis,
+		cloudTwin:   opts.CloudTwin,
+		idempotency: newIdempotencyStore(),
+		events:      newEventStream(),
+	}
+	mgr.AddEventListener(s.events.publish)
+	return s
+}
+
+// tcpConnected reports whether a TCP client is connected
+func (s *Server) tcpConnected() bool {
+	return s.tcpServer != nil && s.tcpServer.IsConnected()
+}
+
+// Handler returns the router serving all API routes, under /api/v1 and the unversioned /api aliases
+func (s *Server) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.Use(telemetry.HTTPMiddleware)
+
+	r.HandleFunc("/", s.rootHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io", s.getLocalIOCardsHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/snapshot", s.snapshotHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/rediscover", s.rediscoverLocalIOCardsHandler).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/simulate-write", s.simulateWriteHandler).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/reboot-all", s.idempotent(s.rebootAllHandler)).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/{id}/write-do", s.idempotent(s.localIOCardHandler)).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/{id}/write-ao", s.idempotent(s.localIOCardHandler)).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/{id}/write-aotype", s.idempotent(s.localIOCardHandler)).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/{id}/write-aotype-all", s.idempotent(s.localIOCardHandler)).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/{id}/reboot", s.idempotent(s.localIOCardHandler)).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/{id}/refresh-identity", s.localIOCardHandler).Methods("POST")
+	r.HandleFunc("/api/jaspermate-io/owners", s.ownersHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/queue", s.queueHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/queue/{opId}", s.queueHandler).Methods("DELETE")
+	r.HandleFunc("/api/jaspermate-io/{id}/errors", s.cardErrorsHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/relay-cycles", s.relayCyclesHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/runtime", s.runtimeHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/ai-stats", s.aiStatsHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/cycle-stats", s.cycleStatsHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/safe-state", s.safeStateChecksHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/{id}/relay-cycles", s.relayCyclesHandler).Methods("DELETE")
+	r.HandleFunc("/api/jaspermate-io/{id}/runtime", s.runtimeHandler).Methods("DELETE")
+	r.HandleFunc("/api/jaspermate-io/replacements", s.replacementsHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/{id}/replace", s.replaceCardHandler).Methods("POST", "DELETE")
+	r.HandleFunc("/api/jaspermate-io/points", s.pointsHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/points/import", versioned(s.importPointsHandler)).Methods("POST")
+	r.HandleFunc("/api/project/export", s.projectExportHandler).Methods("GET")
+	r.HandleFunc("/api/project/import", versioned(s.projectImportHandler)).Methods("POST")
+	r.HandleFunc("/api/commissioning", s.commissioningHandler).Methods("GET", "DELETE")
+	r.HandleFunc("/api/commissioning/{id}/{channel}", s.commissioningChannelHandler).Methods("POST")
+	r.HandleFunc("/api/as-built", s.asBuiltHandler).Methods("GET")
+	r.HandleFunc("/api/jaspermate-io/{id}/simulate", s.simulateHandler).Methods("POST", "DELETE")
+	r.HandleFunc("/api/recorder", s.recorderHandler).Methods("GET")
+	r.HandleFunc("/api/recorder/record/start", s.recorderHandler).Methods("POST")
+	r.HandleFunc("/api/recorder/record/stop", s.recorderHandler).Methods("POST")
+	r.HandleFunc("/api/recorder/replay/start", s.recorderHandler).Methods("POST")
+	r.HandleFunc("/api/recorder/replay/stop", s.recorderHandler).Methods("POST")
+	r.HandleFunc("/api/readdress", s.readdressHandler).Methods("GET")
+	r.HandleFunc("/api/readdress/start", s.readdressHandler).Methods("POST")
+	r.HandleFunc("/api/readdress/confirm", s.readdressHandler).Methods("POST")
+	r.HandleFunc("/api/readdress/stop", s.readdressHandler).Methods("POST")
+	r.HandleFunc("/api/interlocks", versioned(s.interlocksHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/write-permissions", versioned(s.writePermissionsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/do-timings", versioned(s.doTimingsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/ao-slew-rates", versioned(s.aoSlewRatesHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/heartbeat-output", versioned(s.heartbeatOutputHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/disabled-channels", versioned(s.disabledChannelsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/priority-channels", versioned(s.priorityChannelsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/pulse-channels", versioned(s.pulseChannelsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/current-loop-inputs", versioned(s.currentLoopInputsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/notifications", versioned(s.notificationsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/notifications/test", s.testNotificationsHandler).Methods("POST")
+	r.HandleFunc("/api/notifications/deliveries", s.notificationDeliveriesHandler).Methods("GET")
+	r.HandleFunc("/api/journal", s.journalHandler).Methods("GET")
+	r.HandleFunc("/api/events", s.eventsHandler).Methods("GET")
+	r.HandleFunc("/api/alarm-rules", versioned(s.alarmRulesHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/maintenance", versioned(s.maintenanceHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/alarms", s.alarmsHandler).Methods("GET")
+	r.HandleFunc("/api/alarms/{name}/ack", s.alarmHandler).Methods("POST")
+	r.HandleFunc("/api/alarms/{name}/shelve", s.alarmHandler).Methods("POST")
+	r.HandleFunc("/api/alarms/{name}/unshelve", s.alarmHandler).Methods("POST")
+	r.HandleFunc("/api/sequences", versioned(s.sequencesHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/sequences/{name}/start", s.idempotent(s.sequenceHandler)).Methods("POST")
+	r.HandleFunc("/api/sequences/{name}/abort", s.sequenceHandler).Methods("POST")
+	r.HandleFunc("/api/schedules", versioned(s.schedulesHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/schedules/calendar", versioned(s.calendarHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/scripts", versioned(s.scriptsHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/api/settings", s.settingsHandler).Methods("GET")
+	r.HandleFunc("/api/drivers", s.driversHandler).Methods("GET")
+	r.HandleFunc("/api/heartbeat", s.heartbeatHandler).Methods("GET")
+	r.HandleFunc("/api/mqtt", s.mqttHandler).Methods("GET")
+	r.HandleFunc("/api/nats", s.natsHandler).Methods("GET")
+	r.HandleFunc("/api/redis", s.redisHandler).Methods("GET")
+	r.HandleFunc("/api/cloud-twin", s.cloudTwinHandler).Methods("GET")
+	r.HandleFunc("/api/tcp/stats", s.tcpStatsHandler).Methods("GET")
+	r.HandleFunc("/api/tcp/clients", s.tcpClientsHandler).Methods("GET")
+	r.HandleFunc("/api/tcp/schema", s.tcpSchemaHandler).Methods("GET")
+	r.HandleFunc("/metrics", s.metricsHandler).Methods("GET")
+	r.HandleFunc("/api/status/check", s.statusCheckHandler).Methods("GET")
+	r.HandleFunc("/healthz", s.healthzHandler).Methods("GET")
+	r.HandleFunc("/api/selftest", s.selfTestHandler).Methods("GET", "POST")
+	r.HandleFunc("/api/device/rotate-id", versioned(s.rotateDeviceIDHandler)).Methods("POST")
+	r.HandleFunc("/api/device/claim", versioned(s.claimHandler)).Methods("POST")
+	r.HandleFunc("/api/config/validate", s.validateConfigHandler).Methods("POST")
+	r.HandleFunc("/api/config/history", s.configHistoryHandler).Methods("GET")
+	r.HandleFunc("/api/config/history/{version}/rollback", versioned(s.configRollbackHandler)).Methods("POST")
+	r.HandleFunc("/api/pid", s.getPIDLoopsHandler).Methods("GET")
+	r.HandleFunc("/api/pid/{name}/setpoint", s.idempotent(versioned(s.pidLoopHandler))).Methods("POST")
+	r.HandleFunc("/api/pid/{name}/mode", s.idempotent(versioned(s.pidLoopHandler))).Methods("POST")
+	return withCompression(withAPIVersion(r))
+}
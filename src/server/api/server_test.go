@@ -0,0 +1,473 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/tcp"
+)
+
+// fakeTCP is a TCP interface without a listener
+type fakeTCP struct {
+	connected bool
+}
+
+func (f fakeTCP) IsConnected() bool { return f.connected }
+
+func (f fakeTCP) Clients() []tcp.ClientRecord { return []tcp.ClientRecord{} }
+
+func (f fakeTCP) Stats() tcp.Stats {
+	return tcp.Stats{ConnectionsRejected: map[string]uint64{tcp.RejectBusy: 0, tcp.RejectNonLocal: 0}}
+}
+
+func newTestServer(tcpServer TCPServer) *Server {
+	return New(localio.NewManager(), tcpServer, Options{Version: "1.0.0"})
+}
+
+// consumerCount is a Manager counting its attached consumers
+type consumerCount struct {
+	Manager
+	attached atomic.Int32
+}
+
+func (c *consumerCount) AttachConsumer(name string) func() {
+	c.attached.Add(1)
+	detach := c.Manager.AttachConsumer(name)
+	return func() {
+		c.attached.Add(-1)
+		detach()
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	s := newTestServer(fakeTCP{})
+
+	t.Run("Root", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		s.rootHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Root handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var out map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if out["service"] != "jaspermate-io-api" {
+			t.Errorf("Expected service jaspermate-io-api, got %s", out["service"])
+		}
+	})
+
+	t.Run("JasperMate IO cards", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/jaspermate-io", nil)
+		rr := httptest.NewRecorder()
+		s.getLocalIOCardsHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("JasperMate IO handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var out struct {
+			Cards        []interface{} `json:"cards"`
+			TCPConnected bool          `json:"tcpConnected"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		// Cards may be empty if no hardware; we only check structure
+		if out.Cards == nil {
+			t.Error("Expected non-nil cards array")
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		rr := httptest.NewRecorder()
+		s.metricsHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Metrics handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		body := rr.Body.String()
+		for _, want := range []string{
+			"# TYPE cm_utils_tcp_messages_sent_total counter\n",
+			"cm_utils_tcp_client_connected 0\n",
+			`cm_utils_tcp_connections_rejected_total{reason="busy"} 0`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("Status check", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/status/check", nil)
+		rr := httptest.NewRecorder()
+		s.statusCheckHandler(rr, req)
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "JASPERMATE IO UNKNOWN - no cards found | cards=0") {
+			t.Errorf("Expected UNKNOWN without cards, got %d %q", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Self-test", func(t *testing.T) {
+		s.RunSelfTest()
+		req, _ := http.NewRequest("GET", "/api/selftest", nil)
+		rr := httptest.NewRecorder()
+		s.selfTestHandler(rr, req)
+		var out SelfTest
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		names := make([]string, len(out.Checks))
+		for i, c := range out.Checks {
+			names[i] = c.Name
+			// No card responds without hardware
+			if c.Name == "cards" && (c.Passed || out.Passed) {
+				t.Errorf("Expected the cards check and the self-test to fail without cards, got %+v", out)
+			}
+		}
+		if strings.Join(names, ",") != "config,serial-ports,cards,clock,disk" {
+			t.Errorf("Expected all checks, got %v", names)
+		}
+	})
+
+	t.Run("Event stream", func(t *testing.T) {
+		consumers := &consumerCount{Manager: s.mgr}
+		s.mgr = consumers
+		defer func() { s.mgr = consumers.Manager }()
+		// Through the router and its middleware, which must let the stream flush
+		srv := httptest.NewServer(s.Handler())
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + "/api/v1/events?type=card-added")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %s", resp.Header.Get("Content-Type"))
+		}
+
+		s.events.publish(localio.Event{Type: localio.EventCardOnline, Severity: localio.SeverityInfo, CardID: "1"})
+		s.events.publish(localio.Event{Type: localio.EventCardAdded, Severity: localio.SeverityInfo, CardID: "2"})
+		lines := bufio.NewScanner(resp.Body)
+		var got []string
+		for len(got) < 2 && lines.Scan() {
+			got = append(got, lines.Text())
+		}
+		if len(got) != 2 || got[0] != "event: card-added" || !strings.Contains(got[1], `"cardId":"2"`) {
+			t.Errorf("Expected only the card-added event, got %q", got)
+		}
+
+		// A subscriber is a consumer of the card states until it disconnects
+		if consumers.attached.Load() != 1 {
+			t.Errorf("Expected the subscriber attached as a consumer, got %d", consumers.attached.Load())
+		}
+		resp.Body.Close()
+		deadline := time.Now().Add(2 * time.Second)
+		for consumers.attached.Load() != 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if consumers.attached.Load() != 0 {
+			t.Errorf("Expected the consumer released on disconnect, got %d", consumers.attached.Load())
+		}
+
+		resp2, err := http.Get(srv.URL + "/api/v1/events?severity=fatal")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp2.Body.Close()
+		if resp2.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown severity, got %d", resp2.StatusCode)
+		}
+	})
+
+	t.Run("Validate config", func(t *testing.T) {
+		body := "serial_baud: 1234\npid_loops:\n  - name: a\n    pv_card: \"1\"\n    cv_card: \"2\"\n    out_min: 10\n    out_max: 5\n"
+		req, _ := http.NewRequest("POST", "/api/config/validate", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		s.validateConfigHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Validate handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var out struct {
+			Valid    bool                    `json:"valid"`
+			Problems []localio.ConfigProblem `json:"problems"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if out.Valid || len(out.Problems) != 2 {
+			t.Errorf("Expected 2 problems, got valid=%v %v", out.Valid, out.Problems)
+		}
+
+		req, _ = http.NewRequest("POST", "/api/config/validate", strings.NewReader("bogus_field: 1\n"))
+		rr = httptest.NewRecorder()
+		s.validateConfigHandler(rr, req)
+		out.Problems = nil
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if out.Valid || len(out.Problems) != 1 {
+			t.Errorf("Expected unknown field to be reported, got valid=%v %v", out.Valid, out.Problems)
+		}
+	})
+
+	t.Run("As-built", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/as-built?format=html", nil)
+		rr := httptest.NewRecorder()
+		s.asBuiltHandler(rr, req)
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("As-built handler returned %d %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(rr.Body.String(), "<h1>As-built documentation</h1>") {
+			t.Errorf("Expected the HTML page, got %s", rr.Body.String())
+		}
+
+		req, _ = http.NewRequest("GET", "/api/as-built?format=pdf", nil)
+		rr = httptest.NewRecorder()
+		s.asBuiltHandler(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown format, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Simulate write", func(t *testing.T) {
+		body := `{"commands":[{"type":"write-do","cardId":"99","index":0,"state":true}]}`
+		req, _ := http.NewRequest("POST", "/api/jaspermate-io/simulate-write", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, req)
+		var out localio.WriteSimulation
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("Simulate write returned %d: %v", rr.Code, err)
+		}
+		if len(out.Results) != 1 || out.Results[0].Code != localio.CodeCardNotFound || len(out.Writes) != 0 {
+			t.Errorf("Expected the unknown card rejected, got %+v", out)
+		}
+
+		req, _ = http.NewRequest("POST", "/api/jaspermate-io/simulate-write", strings.NewReader(`{"commands":[{"type":"reboot","cardId":"1"}]}`))
+		rr = httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a command that isn't a write, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Config history", func(t *testing.T) {
+		configtest.Isolate(t)
+		req, _ := http.NewRequest("PUT", "/api/priority-channels", strings.NewReader(`{"channels":[{"card":"1","channel":"di0"}]}`))
+		req.RemoteAddr = "10.0.0.7:51234"
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("PUT /api/priority-channels returned %d: %s", rr.Code, rr.Body.String())
+		}
+		// A change made outside the request is not attributed to it
+		config.Update(func(c *config.Config) { c.SerialBaud = 9600 })
+
+		versions, err := config.History()
+		if err != nil || len(versions) != 3 {
+			t.Fatalf("Expected the initial configuration and two changes, got %+v %v", versions, err)
+		}
+		if v := versions[1]; v.Actor != "http:10.0.0.7" || v.Summary != "PUT /api/priority-channels" {
+			t.Errorf("Expected the change attributed to the client, got %+v", v.Change)
+		}
+		if v := versions[0]; v.Actor != "" || v.Summary != "" {
+			t.Errorf("Expected an unattributed change, got %+v", v.Change)
+		}
+	})
+
+	t.Run("Notification test", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/notifications/test", strings.NewReader(`{"channel":"missing"}`))
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown channel, got %d", rr.Code)
+		}
+
+		req, _ = http.NewRequest("GET", "/api/notifications/deliveries", nil)
+		rr = httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, req)
+		var out struct {
+			Deliveries []localio.NotificationDelivery `json:"deliveries"`
+			Total      int                            `json:"total"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("Deliveries returned %d: %v", rr.Code, err)
+		}
+		if out.Deliveries == nil || out.Total != 0 {
+			t.Errorf("Expected an empty delivery list, got %+v", out)
+		}
+	})
+}
+
+func TestCheckCards(t *testing.T) {
+	cards := []*localio.Card{
+		{ID: "1", Module: "IO4040"},
+		{ID: "2", Module: "IO0404", Last: localio.CardState{Error: "timeout"}},
+		{ID: "3", Module: "IO4040", Last: localio.CardState{Error: "timeout"}},
+		{ID: "4", Module: "IO4040", Conflict: "serial numbers 1 and 2"},
+	}
+	check := checkCards(cards, func(id string) bool { return id == "3" })
+	if check.Status != "CRITICAL" || check.Code != 2 {
+		t.Errorf("Expected CRITICAL, got %s (%d)", check.Status, check.Code)
+	}
+	for i, want := range []string{"OK", "WARNING", "CRITICAL", "CRITICAL"} {
+		if check.Cards[i].Status != want {
+			t.Errorf("Expected card %s to be %s, got %+v", cards[i].ID, want, check.Cards[i])
+		}
+	}
+	out := check.plugin()
+	for _, want := range []string{
+		"JASPERMATE IO CRITICAL - 4 cards: 1 OK, 1 WARNING, 2 CRITICAL | cards=4 warning=1 critical=2\n",
+		"WARNING: card 2 (IO0404) read failed: timeout\n",
+		"CRITICAL: card 3 (IO4040) offline: timeout\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestCardFilter(t *testing.T) {
+	cards := []*localio.Card{
+		{ID: "1", PortPath: "/dev/ttyS7", Module: "IO4040", Last: localio.CardState{DI: []bool{true, false, false, false}}},
+		{ID: "2", PortPath: "/dev/ttyS7", Module: "IO0404", Last: localio.CardState{Error: "timeout"}},
+		{ID: "3", PortPath: "/dev/ttyS8", Module: "IO4040"},
+	}
+
+	q, _ := url.ParseQuery("module=IO4040&port=/dev/ttyS7&online=true&fields=id,module,last.di")
+	filter, err := parseCardFilter(q)
+	if err != nil {
+		t.Fatalf("parseCardFilter failed: %v", err)
+	}
+	out := filter.apply(cards)
+	if len(out) != 1 {
+		t.Fatalf("Expected 1 card, got %d", len(out))
+	}
+	card := out[0].(map[string]interface{})
+	if card["id"] != "1" || card["module"] != "IO4040" {
+		t.Errorf("Unexpected projected card: %v", card)
+	}
+	if _, ok := card["portPath"]; ok {
+		t.Error("Expected portPath to be omitted")
+	}
+	last := card["last"].(map[string]interface{})
+	if di, ok := last["di"].([]interface{}); !ok || len(di) != 4 {
+		t.Errorf("Expected last.di with 4 values, got %v", last["di"])
+	}
+	if _, ok := last["timestamp"]; ok {
+		t.Error("Expected last.timestamp to be omitted")
+	}
+
+	q, _ = url.ParseQuery("online=false")
+	filter, _ = parseCardFilter(q)
+	if out := filter.apply(cards); len(out) != 1 || out[0].(*localio.Card).ID != "2" {
+		t.Errorf("Expected only offline card 2, got %v", out)
+	}
+
+	q, _ = url.ParseQuery("online=maybe")
+	if _, err := parseCardFilter(q); err == nil {
+		t.Error("Expected error for invalid online value")
+	}
+}
+
+func TestWriteManagerError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{&localio.Error{Code: localio.CodeCardNotFound, Message: "card not found"}, http.StatusNotFound, "CARD_NOT_FOUND"},
+		{&localio.Error{Code: localio.CodeInterlockViolation, Message: "interlock x"}, http.StatusConflict, "INTERLOCK_VIOLATION"},
+		{&localio.Error{Code: localio.CodeBusTimeout, Message: "serial: timeout"}, http.StatusGatewayTimeout, "BUS_TIMEOUT"},
+		{&localio.Error{Code: localio.CodeDeviceBusy, Message: "modbus: exception '6'"}, http.StatusServiceUnavailable, "DEVICE_BUSY"},
+		{errors.New("disk full"), http.StatusInternalServerError, "INTERNAL"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		writeManagerError(rr, tt.err)
+		if rr.Code != tt.status {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.status, rr.Code)
+		}
+		var out map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if out["code"] != tt.code || out["error"] != tt.err.Error() || out["detail"] != tt.err.Error() {
+			t.Errorf("%v: unexpected body %v", tt.err, out)
+		}
+	}
+
+	// The message parameters are passed on for localized clients
+	rr := httptest.NewRecorder()
+	writeManagerError(rr, &localio.Error{Code: localio.CodeControlLocked, Message: "do1 is controlled by tcp", Params: map[string]interface{}{"channel": "do1", "owner": "tcp"}})
+	var out struct {
+		Code   string            `json:"code"`
+		Params map[string]string `json:"params"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if out.Code != "CONTROL_LOCKED" || out.Params["channel"] != "do1" || out.Params["owner"] != "tcp" {
+		t.Errorf("Expected the error parameters, got %+v", out)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	t.Setenv("CM_UTILS_ADMIN_TOKEN", "")
+	if config.GetAdminToken() != "" {
+		t.Skip("admin_token is set in the local config")
+	}
+
+	req := httptest.NewRequest("POST", "/api/device/rotate-id", nil)
+	rr := httptest.NewRecorder()
+	if requireAdmin(rr, req) || rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a configured token, got %d", rr.Code)
+	}
+
+	t.Setenv("CM_UTILS_ADMIN_TOKEN", "secret")
+	rr = httptest.NewRecorder()
+	req.Header.Set("Authorization", "Bearer wrong")
+	if requireAdmin(rr, req) || rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	req.Header.Set("Authorization", "Bearer secret")
+	if !requireAdmin(rr, req) {
+		t.Errorf("Expected the correct token to be accepted, got %d", rr.Code)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	serve := func(s *Server, method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	s := newTestServer(nil)
+	if rr := serve(s, "GET", "/api/jaspermate-io/7/errors"); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "CARD_NOT_FOUND") {
+		t.Errorf("Expected CARD_NOT_FOUND for an unknown card, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := serve(s, "DELETE", "/api/jaspermate-io"); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for an unrouted method, got %d", rr.Code)
+	}
+	if rr := serve(s, "GET", "/metrics"); strings.Contains(rr.Body.String(), "cm_utils_tcp_") {
+		t.Error("Expected no TCP metrics without a TCP interface")
+	}
+
+	// A connected TCP client locks the frontend controls
+	s = newTestServer(fakeTCP{connected: true})
+	if rr := serve(s, "POST", "/api/jaspermate-io/reboot-all"); rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "CONTROL_LOCKED") {
+		t.Errorf("Expected CONTROL_LOCKED while a TCP client is connected, got %d %s", rr.Code, rr.Body.String())
+	}
+}
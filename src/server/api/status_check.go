@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+// Check states, numbered like the exit codes of Nagios plugins
+const (
+	checkOK       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+var checkStateNames = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// CardCheck is the health of one card
+type CardCheck struct {
+	ID     string `json:"id"`
+	Module string `json:"module"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	state  int
+}
+
+// StatusCheck summarizes the health of the cards for monitoring checks
+type StatusCheck struct {
+	Status  string      `json:"status"`
+	Code    int         `json:"code"` // Nagios plugin exit code: 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN
+	Summary string      `json:"summary"`
+	Cards   []CardCheck `json:"cards"`
+}
+
+// checkCards rates every card: CRITICAL while it is offline or its slave ID is in conflict, WARNING while
+// its last read failed or it reports a different model, and OK otherwise. The overall state is the worst
+// card's; it is UNKNOWN without cards, since a check can't tell a healthy bus from a missing one.
+func checkCards(cards []*localio.Card, offline func(cardID string) bool) StatusCheck {
+	out := StatusCheck{Cards: make([]CardCheck, 0, len(cards))}
+	counts := make([]int, len(checkStateNames))
+	for _, c := range cards {
+		check := CardCheck{ID: c.ID, Module: c.Module, state: checkOK, Detail: "online"}
+		switch {
+		case c.Conflict != "":
+			check.state, check.Detail = checkCritical, "slave ID conflict: "+c.Conflict
+		case offline(c.ID):
+			check.state, check.Detail = checkCritical, "offline: "+c.Last.Error
+		case c.Last.Error != "":
+			check.state, check.Detail = checkWarning, "read failed: "+c.Last.Error
+		case c.DetectedModel != "":
+			check.state, check.Detail = checkWarning, "detected model "+c.DetectedModel
+		}
+		check.Status = checkStateNames[check.state]
+		counts[check.state]++
+		out.Code = max(out.Code, check.state)
+		out.Cards = append(out.Cards, check)
+	}
+
+	if len(cards) == 0 {
+		out.Code = checkUnknown
+		out.Summary = "no cards found"
+	} else {
+		out.Summary = fmt.Sprintf("%d cards: %d OK, %d WARNING, %d CRITICAL",
+			len(cards), counts[checkOK], counts[checkWarning], counts[checkCritical])
+	}
+	out.Status = checkStateNames[out.Code]
+	return out
+}
+
+// plugin formats the check as Nagios plugin output: the status line with performance data, followed by
+// one line per card
+func (s StatusCheck) plugin() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "JASPERMATE IO %s - %s | cards=%d", s.Status, s.Summary, len(s.Cards))
+	for _, name := range []string{"warning", "critical"} {
+		n := 0
+		for _, c := range s.Cards {
+			if strings.EqualFold(c.Status, name) {
+				n++
+			}
+		}
+		fmt.Fprintf(&b, " %s=%d", name, n)
+	}
+	b.WriteString("\n")
+	for _, c := range s.Cards {
+		fmt.Fprintf(&b, "%s: card %s (%s) %s\n", c.Status, c.ID, c.Module, c.Detail)
+	}
+	return b.String()
+}
+
+// statusCheckHandler serves the card health for classic monitoring checks, as Nagios plugin output or
+// with ?format=json as JSON. The response is 200 in every state, so checks read the state from the body.
+func (s *Server) statusCheckHandler(w http.ResponseWriter, r *http.Request) {
+	check := checkCards(s.mgr.GetAllCards(), s.mgr.Offline)
+	switch r.URL.Query().Get("format") {
+	case "", "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, check.plugin())
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(check)
+	default:
+		writeError(w, http.StatusBadRequest, localio.CodeInvalidRequest, "format must be text or json")
+	}
+}
+
+// healthzHandler reports whether the service runs degraded, e.g. with its config in a non-persistent
+// directory. The response is 200 in both states: the service is up, the warnings are for the operator.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	storage := config.GetStorage()
+	status, warnings := "ok", []string{}
+	if storage.Warning != "" {
+		status = "degraded"
+		warnings = append(warnings, storage.Warning)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"warnings": warnings,
+		"config":   storage,
+	})
+}
@@ -0,0 +1,77 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"jaspermate-utils/src/server/config"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// aws syncs with the classic device shadow of AWS IoT Core
+type aws struct {
+	cfg config.CloudTwinConfig
+}
+
+// topic returns a shadow topic of the thing, e.g. "update/delta"
+func (a *aws) topic(name string) string {
+	return "$aws/things/" + a.cfg.DeviceID + "/shadow/" + name
+}
+
+func (a *aws) configure(opts *paho.ClientOptions) error {
+	if a.cfg.CertFile == "" {
+		return errors.New("AWS IoT requires a device certificate (cert_file and key_file)")
+	}
+	opts.AddBroker("ssl://" + a.cfg.Host + ":8883")
+	return nil
+}
+
+func (a *aws) subscriptions() []string {
+	return []string{a.topic("update/delta"), a.topic("update/rejected"), a.topic("get/accepted")}
+}
+
+func (a *aws) connected() (string, []byte) {
+	return a.topic("get"), []byte("{}")
+}
+
+func (a *aws) report(reported []byte) (string, []byte) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"state": map[string]json.RawMessage{"reported": reported},
+	})
+	return a.topic("update"), payload
+}
+
+func (a *aws) desired(topic string, payload []byte) (Outputs, error) {
+	switch topic {
+	case a.topic("update/delta"):
+		// The desired properties that differ from the reported ones
+		var delta struct {
+			State struct {
+				Outputs Outputs `json:"outputs"`
+			} `json:"state"`
+		}
+		if err := json.Unmarshal(payload, &delta); err != nil {
+			return nil, fmt.Errorf("invalid shadow delta: %v", err)
+		}
+		return delta.State.Outputs, nil
+
+	case a.topic("get/accepted"):
+		var shadow struct {
+			State struct {
+				Delta struct {
+					Outputs Outputs `json:"outputs"`
+				} `json:"delta"`
+			} `json:"state"`
+		}
+		if err := json.Unmarshal(payload, &shadow); err != nil {
+			return nil, fmt.Errorf("invalid shadow: %v", err)
+		}
+		return shadow.State.Delta.Outputs, nil
+
+	case a.topic("update/rejected"):
+		return nil, fmt.Errorf("shadow update rejected: %s", payload)
+	}
+	return nil, nil
+}
@@ -0,0 +1,26 @@
+package cloud
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+)
+
+func TestAWSShadow(t *testing.T) {
+	a := &aws{cfg: config.CloudTwinConfig{DeviceID: "thing1"}}
+
+	if topic, payload := a.report([]byte(`{"cards":{}}`)); topic != "$aws/things/thing1/shadow/update" || string(payload) != `{"state":{"reported":{"cards":{}}}}` {
+		t.Errorf("Unexpected report %s %s", topic, payload)
+	}
+	outputs, err := a.desired("$aws/things/thing1/shadow/update/delta", []byte(`{"version":7,"state":{"outputs":{"1":{"do2":false}}}}`))
+	if err != nil || string(outputs["1"]["do2"]) != "false" {
+		t.Errorf("Expected the delta outputs, got %v, %v", outputs, err)
+	}
+	outputs, err = a.desired("$aws/things/thing1/shadow/get/accepted", []byte(`{"state":{"desired":{},"delta":{"outputs":{"1":{"ao0":3}}}}}`))
+	if err != nil || string(outputs["1"]["ao0"]) != "3" {
+		t.Errorf("Expected the delta of the full shadow, got %v, %v", outputs, err)
+	}
+	if _, err := a.desired("$aws/things/thing1/shadow/update/rejected", []byte(`{"code":400}`)); err == nil {
+		t.Error("Expected an error for a rejected update")
+	}
+}
@@ -0,0 +1,118 @@
+package cloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// azureAPIVersion is the IoT Hub MQTT API version
+const azureAPIVersion = "2021-04-12"
+
+// sasTokenLifetime is the validity of the SAS tokens signed with the device key. A new token is signed
+// for every connect; IoT Hub closes the connection when the token expires.
+const sasTokenLifetime = 24 * time.Hour
+
+// IoT Hub device twin topics
+const (
+	azureDesiredTopic  = "$iothub/twin/PATCH/properties/desired/"
+	azureReportedTopic = "$iothub/twin/PATCH/properties/reported/?$rid="
+	azureResponseTopic = "$iothub/twin/res/"
+	azureGetTopic      = "$iothub/twin/GET/?$rid="
+	// azureGetRequestID identifies the response to the request for the full twin
+	azureGetRequestID = "get"
+)
+
+// azure syncs with the device twin of Azure IoT Hub
+type azure struct {
+	cfg config.CloudTwinConfig
+	rid atomic.Uint64 // Request ID of the last reported properties update
+}
+
+func (a *azure) configure(opts *paho.ClientOptions) error {
+	opts.AddBroker("ssl://" + a.cfg.Host + ":8883")
+	opts.SetProtocolVersion(4) // IoT Hub supports MQTT 3.1.1 only
+	username := a.cfg.Host + "/" + a.cfg.DeviceID + "/?api-version=" + azureAPIVersion
+	opts.SetUsername(username)
+	if a.cfg.DeviceKey == "" {
+		return nil // Authenticated by the X.509 certificate
+	}
+	key, err := base64.StdEncoding.DecodeString(a.cfg.DeviceKey)
+	if err != nil {
+		return fmt.Errorf("device_key is not valid base64: %v", err)
+	}
+	resource := a.cfg.Host + "/devices/" + a.cfg.DeviceID
+	opts.SetCredentialsProvider(func() (string, string) {
+		return username, sasToken(resource, key, time.Now().Add(sasTokenLifetime))
+	})
+	return nil
+}
+
+// sasToken signs a shared access signature for resource with the device key
+func sasToken(resource string, key []byte, expiry time.Time) string {
+	sr := url.QueryEscape(resource)
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(sr + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return "SharedAccessSignature sr=" + sr + "&sig=" + url.QueryEscape(sig) + "&se=" + se
+}
+
+func (a *azure) subscriptions() []string {
+	return []string{azureDesiredTopic + "#", azureResponseTopic + "#"}
+}
+
+func (a *azure) connected() (string, []byte) {
+	return azureGetTopic + azureGetRequestID, []byte{}
+}
+
+func (a *azure) report(reported []byte) (string, []byte) {
+	return azureReportedTopic + strconv.FormatUint(a.rid.Add(1), 10), reported
+}
+
+func (a *azure) desired(topic string, payload []byte) (Outputs, error) {
+	if strings.HasPrefix(topic, azureDesiredTopic) {
+		// A patch of the desired properties
+		var patch struct {
+			Outputs Outputs `json:"outputs"`
+		}
+		if err := json.Unmarshal(payload, &patch); err != nil {
+			return nil, fmt.Errorf("invalid desired properties: %v", err)
+		}
+		return patch.Outputs, nil
+	}
+
+	// A response: $iothub/twin/res/<status>/?$rid=<request ID>
+	rest, ok := strings.CutPrefix(topic, azureResponseTopic)
+	if !ok {
+		return nil, nil
+	}
+	status, query, _ := strings.Cut(rest, "/?")
+	values, _ := url.ParseQuery(query)
+	if code, _ := strconv.Atoi(status); code >= 300 {
+		return nil, fmt.Errorf("twin request %s failed with status %s: %s", values.Get("$rid"), status, payload)
+	}
+	if values.Get("$rid") != azureGetRequestID {
+		return nil, nil // Reported properties update accepted
+	}
+	var twin struct {
+		Desired struct {
+			Outputs Outputs `json:"outputs"`
+		} `json:"desired"`
+	}
+	if err := json.Unmarshal(payload, &twin); err != nil {
+		return nil, fmt.Errorf("invalid device twin: %v", err)
+	}
+	return twin.Desired.Outputs, nil
+}
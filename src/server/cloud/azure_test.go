@@ -0,0 +1,45 @@
+package cloud
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+func TestSASToken(t *testing.T) {
+	token := sasToken("hub.azure-devices.net/devices/dev1", []byte("key"), time.Unix(1700000000, 0))
+	if !strings.HasPrefix(token, "SharedAccessSignature sr=hub.azure-devices.net%2Fdevices%2Fdev1&sig=") || !strings.HasSuffix(token, "&se=1700000000") {
+		t.Errorf("Unexpected token %s", token)
+	}
+	sig, _ := url.QueryUnescape(strings.Split(strings.Split(token, "&sig=")[1], "&")[0])
+	// HMAC-SHA256 of "hub.azure-devices.net%2Fdevices%2Fdev1\n1700000000" with the key "key"
+	if sig != "BNNt8woINt9vmJPub8Pk+jG642qABbDC1i3VzwhpUXU=" {
+		t.Errorf("Unexpected signature %s", sig)
+	}
+}
+
+func TestAzureDesired(t *testing.T) {
+	a := &azure{cfg: config.CloudTwinConfig{Host: "hub.azure-devices.net", DeviceID: "dev1"}}
+
+	outputs, err := a.desired("$iothub/twin/PATCH/properties/desired/?$version=4", []byte(`{"outputs":{"1":{"do0":true}},"$version":4}`))
+	if err != nil || string(outputs["1"]["do0"]) != "true" {
+		t.Errorf("Expected the desired patch, got %v, %v", outputs, err)
+	}
+	outputs, err = a.desired("$iothub/twin/res/200/?$rid=get", []byte(`{"desired":{"outputs":{"2":{"ao1":4.5}},"$version":4},"reported":{}}`))
+	if err != nil || string(outputs["2"]["ao1"]) != "4.5" {
+		t.Errorf("Expected the desired outputs of the full twin, got %v, %v", outputs, err)
+	}
+	if outputs, err := a.desired("$iothub/twin/res/204/?$rid=3&$version=5", nil); outputs != nil || err != nil {
+		t.Errorf("Expected nothing for an accepted report, got %v, %v", outputs, err)
+	}
+	if _, err := a.desired("$iothub/twin/res/429/?$rid=4", []byte(`{}`)); err == nil {
+		t.Error("Expected an error for a throttled report")
+	}
+
+	if topic, _ := a.report([]byte(`{}`)); topic != "$iothub/twin/PATCH/properties/reported/?$rid=1" {
+		t.Errorf("Unexpected report topic %s", topic)
+	}
+}
@@ -0,0 +1,364 @@
+// Package cloud syncs the cards with the device twin of Azure IoT Hub or the device shadow of AWS IoT:
+// card states are reported as properties and desired outputs are written to the cards.
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/tcp"
+	"jaspermate-utils/src/server/telemetry"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultReportInterval is the interval of state reports when report_interval_ms is not set
+const DefaultReportInterval = 5 * time.Second
+
+// Reported are the reported properties of the device
+type Reported struct {
+	Cards map[string]ReportedCard `json:"cards"`
+	// Outputs are the output values by card and channel, in the format of the desired outputs, so the
+	// platform sees a desired value as applied once it is reported
+	Outputs Outputs `json:"outputs"`
+}
+
+// ReportedCard is the state of a card in the reported properties
+type ReportedCard struct {
+	Module string    `json:"module"`
+	Online bool      `json:"online"`
+	Error  string    `json:"error"`
+	DI     []bool    `json:"di"`
+	AI     []float32 `json:"ai"`
+}
+
+// Outputs are output values by card ID and channel: "do<n>" (boolean), "ao<n>" (number) and
+// "aotype<n>" ("0-10V" or "4-20mA")
+type Outputs map[string]map[string]json.RawMessage
+
+// provider adapts the connector to the topics and payloads of an IoT platform
+type provider interface {
+	// configure sets the broker, client ID and credentials
+	configure(opts *paho.ClientOptions) error
+	// subscriptions are the topics carrying desired properties and responses
+	subscriptions() []string
+	// connected returns the message requesting the full desired state after a connect
+	connected() (topic string, payload []byte)
+	// report returns the message reporting the properties (the JSON of Reported)
+	report(reported []byte) (topic string, payload []byte)
+	// desired returns the desired outputs of a message on a subscribed topic (nil = none)
+	desired(topic string, payload []byte) (Outputs, error)
+}
+
+// Status reports the state of the cloud connection
+type Status struct {
+	Provider   string    `json:"provider"`
+	Host       string    `json:"host"`
+	Connected  bool      `json:"connected"`
+	LastError  string    `json:"lastError,omitempty"`
+	LastReport time.Time `json:"lastReport,omitempty"`
+	// Writes counts the desired outputs written to the cards
+	Writes int `json:"writes"`
+}
+
+// Connector keeps the device twin or shadow in sync with the cards
+type Connector struct {
+	cfg        config.CloudTwinConfig
+	provider   provider
+	interval   time.Duration
+	localioMgr *localio.Manager
+	client     paho.Client
+	// publish sends a message to the platform (replaced in tests)
+	publish func(topic string, payload []byte)
+
+	mu           sync.Mutex
+	status       Status
+	lastReported []byte
+	stop         chan struct{}
+	once         sync.Once
+}
+
+// NewConnector creates the connector of the configured provider. The device ID defaults to deviceID.
+func NewConnector(cfg config.CloudTwinConfig, deviceID string, localioMgr *localio.Manager) (*Connector, error) {
+	if cfg.DeviceID == "" {
+		cfg.DeviceID = deviceID
+	}
+	var p provider
+	switch cfg.Provider {
+	case "azure":
+		p = &azure{cfg: cfg}
+	case "aws":
+		p = &aws{cfg: cfg}
+	default:
+		return nil, fmt.Errorf("unknown cloud twin provider %q (use azure or aws)", cfg.Provider)
+	}
+	interval := time.Duration(cfg.ReportIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+	c := &Connector{
+		cfg:        cfg,
+		provider:   p,
+		interval:   interval,
+		localioMgr: localioMgr,
+		status:     Status{Provider: cfg.Provider, Host: cfg.Host},
+		stop:       make(chan struct{}),
+	}
+	c.publish = func(topic string, payload []byte) {
+		c.client.Publish(topic, 1, false, payload)
+	}
+	return c, nil
+}
+
+// Start connects to the platform in the background, reconnecting whenever the connection is lost, and
+// reports changed card states every interval until Stop is called
+func (c *Connector) Start() error {
+	opts := paho.NewClientOptions().
+		SetClientID(c.cfg.DeviceID).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(c.onConnectionLost)
+	tlsConfig, err := loadTLSConfig(c.cfg)
+	if err != nil {
+		return err
+	}
+	opts.SetTLSConfig(tlsConfig)
+	if err := c.provider.configure(opts); err != nil {
+		return err
+	}
+	c.client = paho.NewClient(opts)
+	c.client.Connect()
+	log.Printf("Cloud twin: connecting to %s (%s) as %s", c.cfg.Host, c.cfg.Provider, c.cfg.DeviceID)
+	go c.run()
+	return nil
+}
+
+// Stop disconnects from the platform
+func (c *Connector) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+		if c.client != nil {
+			c.client.Disconnect(250)
+		}
+	})
+}
+
+// Status returns the state of the cloud connection
+func (c *Connector) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// onConnect subscribes to the desired properties and requests the full desired state. Subscriptions
+// are renewed on every connect since the platforms don't keep sessions.
+func (c *Connector) onConnect(client paho.Client) {
+	c.mu.Lock()
+	c.status.Connected = true
+	c.status.LastError = ""
+	c.lastReported = nil
+	c.mu.Unlock()
+	log.Printf("Cloud twin: connected to %s", c.cfg.Host)
+
+	topics := make(map[string]byte)
+	for _, topic := range c.provider.subscriptions() {
+		topics[topic] = 1
+	}
+	client.SubscribeMultiple(topics, func(_ paho.Client, msg paho.Message) {
+		c.handleMessage(msg.Topic(), msg.Payload())
+	})
+	c.publish(c.provider.connected())
+	c.report()
+}
+
+func (c *Connector) onConnectionLost(_ paho.Client, err error) {
+	c.mu.Lock()
+	c.status.Connected = false
+	c.status.LastError = err.Error()
+	c.mu.Unlock()
+	log.Printf("Cloud twin: connection to %s lost: %v", c.cfg.Host, err)
+}
+
+func (c *Connector) run() {
+	// Reporting keeps the cycle at full rate, like a connected TCP client
+	detach := c.localioMgr.AttachConsumer("cloud")
+	defer detach()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if c.client.IsConnectionOpen() {
+				c.report()
+			}
+		}
+	}
+}
+
+// report sends the reported properties if they changed since the last report; the platforms bill and
+// throttle twin updates
+func (c *Connector) report() {
+	reported, err := json.Marshal(reportedState(c.localioMgr.GetAllCards()))
+	if err != nil {
+		log.Printf("Cloud twin: failed to encode reported properties: %v", err)
+		return
+	}
+	c.mu.Lock()
+	if bytes.Equal(reported, c.lastReported) {
+		c.mu.Unlock()
+		return
+	}
+	c.lastReported = reported
+	c.status.LastReport = time.Now()
+	c.mu.Unlock()
+	c.publish(c.provider.report(reported))
+}
+
+// handleMessage writes the desired outputs of a message received on a subscribed topic
+func (c *Connector) handleMessage(topic string, payload []byte) {
+	outputs, err := c.provider.desired(topic, payload)
+	if err != nil {
+		log.Printf("Cloud twin: %v", err)
+		c.mu.Lock()
+		c.status.LastError = err.Error()
+		c.mu.Unlock()
+		return
+	}
+	if len(outputs) > 0 {
+		c.applyDesired(outputs)
+	}
+}
+
+// applyDesired writes desired outputs to the cards. The new values are reported with the next report
+// once the cycle has read them back.
+func (c *Connector) applyDesired(outputs Outputs) {
+	cmd := &tcp.WriteCommand{Type: "write"}
+	for _, cardID := range slices.Sorted(maps.Keys(outputs)) {
+		for _, channel := range slices.Sorted(maps.Keys(outputs[cardID])) {
+			value := outputs[cardID][channel]
+			if string(value) == "null" {
+				continue // Deleted desired property
+			}
+			item, perr := desiredWrite(cardID, channel, value)
+			if perr != nil {
+				log.Printf("Cloud twin: ignoring desired outputs.%s.%s: %v", cardID, channel, perr)
+				continue
+			}
+			cmd.Commands = append(cmd.Commands, item)
+		}
+	}
+	if len(cmd.Commands) == 0 {
+		return
+	}
+
+	ctx, span := telemetry.Tracer().Start(context.Background(), "cloud.write",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int("commands", len(cmd.Commands))))
+	response := tcp.ExecuteWrite(localio.WithSource(ctx, localio.WriteSource{Kind: localio.SourceCloud}), c.localioMgr, cmd)
+	if response.Status == "error" {
+		span.SetStatus(codes.Error, response.Message)
+	}
+	span.End()
+
+	written := 0
+	for _, result := range response.Results {
+		if result.Status == "ok" {
+			written++
+			continue
+		}
+		item := cmd.Commands[result.Index]
+		log.Printf("Cloud twin: failed to write desired %s of card %s: %s", item.Type, item.CardID, result.Message)
+	}
+	c.mu.Lock()
+	c.status.Writes += written
+	c.mu.Unlock()
+}
+
+// desiredWrite converts a desired output to a write command
+func desiredWrite(cardID, channel string, value json.RawMessage) (tcp.WriteCommandItem, *tcp.ProtocolError) {
+	// AO types have their own key since an AO channel reports its value as a number
+	if index, ok := strings.CutPrefix(channel, "aotype"); ok {
+		var mode string
+		if err := json.Unmarshal(value, &mode); err != nil {
+			return tcp.WriteCommandItem{}, &tcp.ProtocolError{Code: localio.CodeInvalidRequest, Message: "an AO type must be a string", Index: -1}
+		}
+		channel = "ao" + index
+	} else if len(value) > 0 && value[0] == '"' {
+		return tcp.WriteCommandItem{}, &tcp.ProtocolError{Code: localio.CodeInvalidRequest, Message: "use aotype<n> for AO types", Index: -1}
+	}
+	cmd, perr := tcp.ParseChannelWrite(cardID, channel, value)
+	if perr != nil {
+		return tcp.WriteCommandItem{}, perr
+	}
+	return cmd.Commands[0], nil
+}
+
+// reportedState builds the reported properties from the cards
+func reportedState(cards []*localio.Card) Reported {
+	r := Reported{Cards: make(map[string]ReportedCard, len(cards)), Outputs: make(Outputs, len(cards))}
+	for _, c := range cards {
+		r.Cards[c.ID] = ReportedCard{
+			Module: c.Module,
+			Online: c.Last.Error == "",
+			Error:  c.Last.Error,
+			DI:     c.Last.DI,
+			AI:     c.Last.AI,
+		}
+		outputs := make(map[string]json.RawMessage)
+		for i, state := range c.Last.DO {
+			outputs["do"+strconv.Itoa(i)] = json.RawMessage(strconv.FormatBool(state))
+		}
+		for i, value := range c.Last.AO {
+			outputs["ao"+strconv.Itoa(i)] = json.RawMessage(strconv.FormatFloat(float64(value), 'f', -1, 32))
+		}
+		for i, mode := range c.Last.AOType {
+			outputs["aotype"+strconv.Itoa(i)] = json.RawMessage(strconv.Quote(mode))
+		}
+		r.Outputs[c.ID] = outputs
+	}
+	return r
+}
+
+// loadTLSConfig returns the TLS configuration with the device certificate and CA bundle, if configured
+func loadTLSConfig(cfg config.CloudTwinConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load device certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA bundle %s", cfg.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,78 @@
+package cloud
+
+import (
+	"encoding/json"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestReportedState(t *testing.T) {
+	r := reportedState([]*localio.Card{{
+		ID:     "1",
+		Module: "IO4040",
+		Last: localio.CardState{
+			DI:     []bool{true},
+			DO:     []bool{false, true},
+			AO:     []float32{5.5},
+			AOType: []string{"4-20mA"},
+		},
+	}})
+	data, _ := json.Marshal(r)
+	want := `{"cards":{"1":{"module":"IO4040","online":true,"error":"","di":[true],"ai":null}},` +
+		`"outputs":{"1":{"ao0":5.5,"aotype0":"4-20mA","do0":false,"do1":true}}}`
+	if string(data) != want {
+		t.Errorf("Unexpected reported properties:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestDesiredWrite(t *testing.T) {
+	for _, tc := range []struct {
+		channel, value string
+		want           string // Command type, "" = rejected
+	}{
+		{"do0", `true`, "write-do"},
+		{"ao1", `7.5`, "write-ao"},
+		{"aotype1", `"0-10V"`, "write-aotype"},
+		{"aotype1", `10`, ""},
+		{"ao1", `"4-20mA"`, ""},
+		{"di0", `true`, ""},
+	} {
+		item, perr := desiredWrite("2", tc.channel, json.RawMessage(tc.value))
+		if tc.want == "" {
+			if perr == nil {
+				t.Errorf("%s=%s: expected an error, got %+v", tc.channel, tc.value, item)
+			}
+			continue
+		}
+		if perr != nil || item.Type != tc.want || item.CardID != "2" {
+			t.Errorf("%s=%s: expected %s, got %+v, %v", tc.channel, tc.value, tc.want, item, perr)
+		}
+	}
+}
+
+func TestReportOnlyChanges(t *testing.T) {
+	c, err := NewConnector(config.CloudTwinConfig{Provider: "aws", Host: "example.iot.eu-west-1.amazonaws.com"}, "dev1", localio.NewManager())
+	if err != nil {
+		t.Fatalf("NewConnector failed: %v", err)
+	}
+	var topics []string
+	c.publish = func(topic string, payload []byte) { topics = append(topics, topic) }
+
+	c.report()
+	c.report()
+	if len(topics) != 1 || topics[0] != "$aws/things/dev1/shadow/update" {
+		t.Errorf("Expected one report to the thing's shadow, got %v", topics)
+	}
+
+	// Desired outputs of unknown cards are not counted as written
+	c.handleMessage("$aws/things/dev1/shadow/update/delta", []byte(`{"version":3,"state":{"outputs":{"9":{"do0":true}}}}`))
+	if s := c.Status(); s.Writes != 0 || s.LastReport.IsZero() {
+		t.Errorf("Expected no write and the report time, got %+v", s)
+	}
+
+	if _, err := NewConnector(config.CloudTwinConfig{Provider: "gcp"}, "dev1", localio.NewManager()); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -8,6 +10,9 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/util"
 
 	"gopkg.in/yaml.v3"
 )
@@ -23,53 +28,621 @@ type Config struct {
 	ServeExternally bool   `yaml:"serve_externally,omitempty"`
 	// SerialBaud is the RS485/serial baud rate for local IO (default 115200)
 	SerialBaud int `yaml:"serial_baud,omitempty"`
+	// TCPMaxMessageSize is the maximum size in bytes of one TCP message (default 1 MiB)
+	TCPMaxMessageSize int `yaml:"tcp_max_message_size,omitempty"`
+	// SimulationEnabled allows injecting simulated DI/AI values via the API (FAT/testing only)
+	SimulationEnabled bool `yaml:"simulation_enabled,omitempty"`
+	// ModelCheckIntervalSec is how often each card's model is re-probed (default 600, negative = only after read errors)
+	ModelCheckIntervalSec int `yaml:"model_check_interval_sec,omitempty"`
+	// IdentityRefreshIntervalSec is how often each card's AO types, serial number and baud rate are re-read
+	// (default 300, negative = only after reboots and on request)
+	IdentityRefreshIntervalSec int `yaml:"identity_refresh_interval_sec,omitempty"`
+	// PIDLoops are the embedded PID control loops executed on the poll cycle
+	PIDLoops []PIDLoopConfig `yaml:"pid_loops,omitempty"`
+	// Alarms are alarm rules evaluated on the poll cycle
+	Alarms []AlarmRule `yaml:"alarms,omitempty"`
+	// MaintenanceWindows are recurring periods of maintenance work that suppress alarms
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenance_windows,omitempty"`
+	// Notifications are the channels unacknowledged alarms are escalated to
+	Notifications Notifications `yaml:"notifications,omitempty"`
+	// MQTT is the connection to an MQTT broker for broker-mediated monitoring and control
+	MQTT MQTTConfig `yaml:"mqtt,omitempty"`
+	// NATS is the connection to a NATS server for edge messaging
+	NATS NATSConfig `yaml:"nats,omitempty"`
+	// Redis mirrors the card states into a Redis server for co-located services
+	Redis RedisConfig `yaml:"redis,omitempty"`
+	// CloudTwin syncs the card states with a device twin (Azure IoT Hub) or device shadow (AWS IoT)
+	CloudTwin CloudTwinConfig `yaml:"cloud_twin,omitempty"`
+	// Interlocks are output interlock rules enforced on every DO write
+	Interlocks []InterlockRule `yaml:"interlocks,omitempty"`
+	// DOTimings are minimum on/off times of DO channels enforced on every write
+	DOTimings []DOTiming `yaml:"do_timings,omitempty"`
+	// AOSlewRates limit the rate of change of AO channels; larger steps are ramped
+	AOSlewRates []AOSlewRate `yaml:"ao_slew_rates,omitempty"`
+	// HeartbeatOutput is a DO channel toggled while the service and the bus are healthy (watchdog output)
+	HeartbeatOutput HeartbeatOutput `yaml:"heartbeat_output,omitempty"`
+	// Sequences are named step sequences that can be triggered over HTTP/TCP
+	Sequences []Sequence `yaml:"sequences,omitempty"`
+	// Schedules switch output channels at fixed local times
+	Schedules []Schedule `yaml:"schedules,omitempty"`
+	// Calendar lists the dates (holidays) on which schedules are skipped or follow another day
+	Calendar []CalendarException `yaml:"calendar,omitempty"`
+	// Location is the position of the site, required by sunrise/sunset schedule entries
+	Location *Location `yaml:"location,omitempty"`
+	// Scripts are sandboxed Starlark scripts run on state changes and timers
+	Scripts []Script `yaml:"scripts,omitempty"`
+	// DisabledChannels are input channels the poll cycle does not read (e.g. unwired AIs)
+	DisabledChannels []InputChannel `yaml:"disabled_channels,omitempty"`
+	// PriorityChannels are DI channels re-read between card reads for fast edge detection
+	PriorityChannels []InputChannel `yaml:"priority_channels,omitempty"`
+	// PulseChannels are DI channels whose pulses shorter than a poll cycle must not be missed
+	PulseChannels []InputChannel `yaml:"pulse_channels,omitempty"`
+	// CurrentLoopInputs are AI channels wired to 4-20mA transmitters, checked for sensor faults
+	CurrentLoopInputs []InputChannel `yaml:"current_loop_inputs,omitempty"`
+	// ControlLock is the policy for HTTP writes while a TCP client is connected
+	ControlLock ControlLock `yaml:"control_lock,omitempty"`
+	// WritePermissions restrict the sources allowed to write output channels
+	WritePermissions []WritePermission `yaml:"write_permissions,omitempty"`
+	// Points name the IO channels, with unit, scaling and safe state (see ImportPointsCSV)
+	Points []Point `yaml:"points,omitempty"`
+	// SlaveIDRegister is the holding register storing a card's Modbus slave address, used by the
+	// re-addressing workflow (0 = not configured, re-addressing disabled)
+	SlaveIDRegister int `yaml:"slave_id_register,omitempty"`
+	// SlaveAssignments records the slave addresses assigned by the re-addressing workflow
+	SlaveAssignments []SlaveAssignment `yaml:"slave_assignments,omitempty"`
+	// AdminToken authorizes administrative API calls (sent as "Authorization: Bearer <token>").
+	// Empty = administrative endpoints are disabled; CM_UTILS_ADMIN_TOKEN is used as a fallback.
+	AdminToken string `yaml:"admin_token,omitempty"`
+	// GRPCToken authorizes calls to the gRPC API (sent as "authorization: Bearer <token>" metadata).
+	// Empty = all calls are refused; CM_UTILS_GRPC_TOKEN is used as a fallback.
+	GRPCToken string `yaml:"grpc_token,omitempty"`
+	// ClaimTokenHash is the SHA-256 of the pending claim token issued by RotateDeviceID
+	ClaimTokenHash    string    `yaml:"claim_token_hash,omitempty"`
+	ClaimTokenExpires time.Time `yaml:"claim_token_expires,omitempty"`
+	// EncryptSecrets stores the tokens, passwords and device keys encrypted with the key in config.key;
+	// they are decrypted when the config is loaded
+	EncryptSecrets bool `yaml:"encrypt_secrets,omitempty"`
+	// Settings overrides the built-in ports, timeouts and intervals (see GetSettings)
+	Settings Settings `yaml:"settings,omitempty"`
+	// Profiles are named settings overlays per deployment environment (e.g. lab, production); the active
+	// profile is selected with CM_UTILS_PROFILE or -profile (see ActiveProfile)
+	Profiles map[string]Settings `yaml:"profiles,omitempty"`
+}
+
+// InputChannel names an input channel of a card, e.g. {card: "2", channel: "ai3"}
+type InputChannel struct {
+	Card    string `yaml:"card" json:"card"`
+	Channel string `yaml:"channel" json:"channel"`
+}
+
+// SlaveAssignment maps a card (by serial number) to the slave address it was given
+type SlaveAssignment struct {
+	Port         string    `yaml:"port" json:"port"`
+	SlaveID      int       `yaml:"slave_id" json:"slaveId"`
+	Module       string    `yaml:"module" json:"module"`
+	SerialNumber string    `yaml:"serial_number,omitempty" json:"serialNumber,omitempty"`
+	AssignedAt   time.Time `yaml:"assigned_at" json:"assignedAt"`
+}
+
+// Sequence is an ordered list of steps executed by the sequence engine
+type Sequence struct {
+	Name  string         `yaml:"name" json:"name"`
+	Steps []SequenceStep `yaml:"steps" json:"steps"`
+}
+
+// Sequence step types
+const (
+	StepWriteDO = "write-do"
+	StepWriteAO = "write-ao"
+	StepDelay   = "delay"
+	StepWaitDI  = "wait-di"
+)
+
+// SequenceStep is a single sequence step: a DO/AO write, a delay, or a wait for a DI state
+type SequenceStep struct {
+	Type  string  `yaml:"type" json:"type"`
+	Card  string  `yaml:"card,omitempty" json:"card,omitempty"`
+	Index int     `yaml:"index,omitempty" json:"index,omitempty"`
+	State bool    `yaml:"state,omitempty" json:"state,omitempty"` // write-do, wait-di
+	Value float32 `yaml:"value,omitempty" json:"value,omitempty"` // write-ao
+	// DelayMs is the delay duration for "delay" steps
+	DelayMs int `yaml:"delay_ms,omitempty" json:"delayMs,omitempty"`
+	// TimeoutMs aborts a "wait-di" step if the input doesn't reach State in time (0 = wait forever)
+	TimeoutMs int `yaml:"timeout_ms,omitempty" json:"timeoutMs,omitempty"`
+}
+
+// Schedule output types
+const (
+	ScheduleDO = "do"
+	ScheduleAO = "ao"
+)
+
+// Sun events of astro schedule entries
+const (
+	Sunrise = "sunrise"
+	Sunset  = "sunset"
+)
+
+// Holiday is the day type of calendar exceptions that select the holiday entries of schedules
+const Holiday = "holiday"
+
+// Schedule writes an output channel at fixed local times, e.g. lighting or HVAC occupancy
+type Schedule struct {
+	Name string `yaml:"name" json:"name"`
+	Card string `yaml:"card" json:"card"`
+	// Type is the output type, "do" (default) or "ao"
+	Type    string          `yaml:"type,omitempty" json:"type,omitempty"`
+	Index   int             `yaml:"index" json:"index"`
+	Entries []ScheduleEntry `yaml:"entries" json:"entries"`
+}
+
+// ScheduleEntry writes State (DO) or Value (AO) at a local time
+type ScheduleEntry struct {
+	// At is the local time, "HH:MM", or "sunrise" / "sunset" at the configured location
+	At string `yaml:"at" json:"at"`
+	// OffsetMin shifts the entry by minutes, e.g. -30 for half an hour before sunset
+	OffsetMin int `yaml:"offset_min,omitempty" json:"offsetMin,omitempty"`
+	// Days are the day types the entry applies to: weekdays ("mon" .. "sun") and "holiday" for the dates
+	// of calendar exceptions with a holiday alternate. Every day if none is given.
+	Days  []string `yaml:"days,omitempty" json:"days,omitempty"`
+	State bool     `yaml:"state,omitempty" json:"state,omitempty"`
+	Value float32  `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// CalendarException is a date on which schedules don't follow their weekday entries
+type CalendarException struct {
+	// Date is the local date, "YYYY-MM-DD"
+	Date string `yaml:"date" json:"date"`
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Schedules are the names of the affected schedules (all if none is given)
+	Schedules []string `yaml:"schedules,omitempty" json:"schedules,omitempty"`
+	// Alternate is the day type the schedules follow instead, a weekday or "holiday"; empty skips them
+	Alternate string `yaml:"alternate,omitempty" json:"alternate,omitempty"`
+}
+
+// Location is a geographic position in degrees
+type Location struct {
+	// Latitude is north positive, Longitude east positive
+	Latitude  float64 `yaml:"latitude" json:"latitude"`
+	Longitude float64 `yaml:"longitude" json:"longitude"`
+}
+
+// Script is a Starlark script with site-specific logic. It can define on_change(cards), called when
+// DI/AI values change, and on_timer(), called every IntervalMs.
+type Script struct {
+	Name   string `yaml:"name" json:"name"`
+	Source string `yaml:"source" json:"source"`
+	// IntervalMs is the period of the on_timer hook (0 = no timer)
+	IntervalMs int `yaml:"interval_ms,omitempty" json:"intervalMs,omitempty"`
+}
+
+// ChannelRef identifies a single channel of a card
+type ChannelRef struct {
+	Card  string `yaml:"card" json:"card"`
+	Index int    `yaml:"index" json:"index"`
+}
+
+// HeartbeatOutput designates a DO channel as a watchdog output for external safety relays. An empty Card
+// disables it.
+type HeartbeatOutput struct {
+	Card  string `yaml:"card,omitempty" json:"card"`
+	Index int    `yaml:"index,omitempty" json:"index"`
+	// IntervalMs is the time between two toggles of the output (default 500)
+	IntervalMs int `yaml:"interval_ms,omitempty" json:"intervalMs,omitempty"`
+}
+
+// Control lock policies for HTTP writes while a TCP client is connected
+const (
+	// ControlLockOwner arbitrates each channel by the priority of its owner (default)
+	ControlLockOwner = "owner"
+	// ControlLockBlock rejects all HTTP writes
+	ControlLockBlock = "block"
+	// ControlLockWarn lets HTTP writes override the TCP client and returns a warning
+	ControlLockWarn = "warn"
+	// ControlLockChannels lets HTTP writes override the TCP client on Channels only and rejects the others
+	ControlLockChannels = "channels"
+)
+
+// Modes of the periodic TCP card updates
+const (
+	// TCPUpdatePeriodic sends all cards every update interval (default)
+	TCPUpdatePeriodic = "periodic"
+	// TCPUpdateChangeOnly only sends the cards whose values changed since they were last sent
+	TCPUpdateChangeOnly = "change-only"
+)
+
+// Startup output policies, applied once the cards are discovered
+const (
+	// StartupOutputsUntouched leaves the outputs at whatever the cards hold (default)
+	StartupOutputsUntouched = "untouched"
+	// StartupOutputsSafeState drives all outputs to their safe state
+	StartupOutputsSafeState = "safe-state"
+	// StartupOutputsRestore writes the output values persisted before the service stopped
+	StartupOutputsRestore = "restore"
+)
+
+// Policies for a TCP client whose send queue is full
+const (
+	// SlowClientDisconnect closes the connection of a client that stopped reading (default)
+	SlowClientDisconnect = "disconnect"
+	// SlowClientDropOldest drops the oldest queued card update; the client sees a gap in the update seq
+	SlowClientDropOldest = "drop-oldest"
+)
+
+// ControlLock configures which HTTP writes are allowed while a TCP client is connected, e.g. for
+// manual overrides during commissioning
+type ControlLock struct {
+	Policy string `yaml:"policy,omitempty" json:"policy"`
+	// Channels are the channels writable under the "channels" policy
+	Channels []ControlChannel `yaml:"channels,omitempty" json:"channels,omitempty"`
+}
+
+// ControlChannel identifies an output channel of a card ("do0", "ao1", ...)
+type ControlChannel struct {
+	Card    string `yaml:"card" json:"card"`
+	Channel string `yaml:"channel" json:"channel"`
+}
+
+// WritePermission restricts the writers of an output channel ("do0", "ao1", ...; an AO channel includes
+// its type). Safe state and the heartbeat output always write.
+type WritePermission struct {
+	Card    string `yaml:"card" json:"card"`
+	Channel string `yaml:"channel" json:"channel"`
+	// Writers are the allowed write sources, by kind ("tcp") or kind and ID with * wildcards
+	// ("http:192.168.1.*"); none = read-only
+	Writers []string `yaml:"writers,omitempty" json:"writers"`
+}
+
+// Point names an IO channel ("di0", "ao1", ...) of a card, identified by its serial number so the name
+// stays with the card when it moves to another slave ID
+type Point struct {
+	Serial  string `yaml:"serial" json:"serial"`
+	Channel string `yaml:"channel" json:"channel"`
+	Name    string `yaml:"name" json:"name"`
+	Unit    string `yaml:"unit,omitempty" json:"unit,omitempty"`
+	// RawMin..RawMax of an analog channel's value are scaled linearly to EngMin..EngMax (all zero = unscaled)
+	RawMin float64 `yaml:"raw_min,omitempty" json:"rawMin,omitempty"`
+	RawMax float64 `yaml:"raw_max,omitempty" json:"rawMax,omitempty"`
+	EngMin float64 `yaml:"eng_min,omitempty" json:"engMin,omitempty"`
+	EngMax float64 `yaml:"eng_max,omitempty" json:"engMax,omitempty"`
+	// SafeState overrides the safe state of an output: "on" or "off" for DO, the value in V or mA for AO
+	SafeState string `yaml:"safe_state,omitempty" json:"safeState,omitempty"`
+	// Label is the wiring label of the channel: terminal, wire or cable tag (e.g. "X1:3 / W-101")
+	Label string `yaml:"label,omitempty" json:"label,omitempty"`
+}
+
+// Interlock rule types
+const (
+	// InterlockExclusive allows at most one of Outputs to be on at a time (e.g. reversing contactors)
+	InterlockExclusive = "exclusive"
+	// InterlockRequires allows Output to be switched on only while Input is in InputState
+	InterlockRequires = "requires"
+)
+
+// AlarmRule raises an alarm from a DI state, an AI limit, or a failure to read a card
+type AlarmRule struct {
+	Name string `yaml:"name" json:"name"`
+	Card string `yaml:"card" json:"card"`
+	// Channel is the monitored input ("di0", "ai2"); empty monitors the communication with the card
+	Channel string `yaml:"channel,omitempty" json:"channel,omitempty"`
+	// State is the DI state raising the alarm
+	State bool `yaml:"state,omitempty" json:"state,omitempty"`
+	// High and Low are AI limits in raw units (value * 1000); the alarm is raised above High or below Low
+	High    *float32 `yaml:"high,omitempty" json:"high,omitempty"`
+	Low     *float32 `yaml:"low,omitempty" json:"low,omitempty"`
+	Message string   `yaml:"message,omitempty" json:"message,omitempty"`
+	// Severity is "info", "warning" (default) or "critical"; it selects the escalation policy
+	Severity string `yaml:"severity,omitempty" json:"severity,omitempty"`
+}
+
+// MaintenanceWindow is a recurring period of maintenance work in local time. While a window is open, alarms
+// raise no events and aren't escalated, script timers are paused and schedule entries are skipped.
+type MaintenanceWindow struct {
+	Name string `yaml:"name" json:"name"`
+	// Start is the local start time, "HH:MM"
+	Start string `yaml:"start" json:"start"`
+	// DurationMin is the length of the window in minutes (at most a week)
+	DurationMin int `yaml:"duration_min" json:"durationMin"`
+	// Days are the weekdays the window starts on ("mon" .. "sun"); MonthDays the days of the month (1-31);
+	// Dates single dates ("2026-12-24"). A window starts on the days matching all given lists, every day
+	// if none is given.
+	Days      []string `yaml:"days,omitempty" json:"days,omitempty"`
+	MonthDays []int    `yaml:"month_days,omitempty" json:"monthDays,omitempty"`
+	Dates     []string `yaml:"dates,omitempty" json:"dates,omitempty"`
+	// SafeState drives all outputs to their safe state when the window opens
+	SafeState bool `yaml:"safe_state,omitempty" json:"safeState,omitempty"`
+}
+
+// Notifications configures where alarm notifications are sent and when
+type Notifications struct {
+	Channels    []NotificationChannel `yaml:"channels,omitempty" json:"channels"`
+	Escalations []EscalationPolicy    `yaml:"escalations,omitempty" json:"escalations"`
+	// SMTP is the mail server of email channels
+	SMTP SMTPServer `yaml:"smtp,omitempty" json:"smtp"`
+}
+
+// NotificationChannel is a named notification target
+type NotificationChannel struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"` // "webhook", "slack" or "email"
+	// URL is the webhook or Slack incoming webhook URL
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+	// To are the recipients of an email channel
+	To []string `yaml:"to,omitempty" json:"to,omitempty"`
+	// Events is the minimum severity of the events forwarded to the channel as they happen ("" = none;
+	// the channel only receives alarm escalations)
+	Events string `yaml:"events,omitempty" json:"events,omitempty"`
+}
+
+// SMTPServer is the mail server used by email channels. The password is never returned by the API.
+type SMTPServer struct {
+	Host     string `yaml:"host,omitempty" json:"host,omitempty"`
+	Port     int    `yaml:"port,omitempty" json:"port,omitempty"` // Default 587
+	From     string `yaml:"from,omitempty" json:"from,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+}
+
+// MQTTConfig is the MQTT connector: it publishes the card states and accepts write commands under
+// TopicPrefix. The password is never returned by the API.
+type MQTTConfig struct {
+	// Broker is the broker URL, e.g. tcp://broker:1883 or ssl://broker:8883 ("" = disabled)
+	Broker string `yaml:"broker,omitempty" json:"broker,omitempty"`
+	// ClientID is the MQTT client identifier (default "jaspermate-<device_id>")
+	ClientID string `yaml:"client_id,omitempty" json:"clientId,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+	// TopicPrefix is the prefix of the device's topics (default "jaspermate/<device_id>")
+	TopicPrefix string `yaml:"topic_prefix,omitempty" json:"topicPrefix,omitempty"`
+	// PublishIntervalMs is how often the card states are checked for changes and published (default 1000)
+	PublishIntervalMs int `yaml:"publish_interval_ms,omitempty" json:"publishIntervalMs,omitempty"`
+}
+
+// NATSConfig is the NATS connector: it publishes the card states and accepts write commands under
+// SubjectPrefix. The password and token are never returned by the API.
+type NATSConfig struct {
+	// URL is the server URL, e.g. nats://nats:4222; several can be given separated by commas ("" = disabled)
+	URL      string `yaml:"url,omitempty" json:"url,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+	Token    string `yaml:"token,omitempty" json:"-"`
+	// SubjectPrefix is the prefix of the device's subjects (default "jaspermate.<device_id>")
+	SubjectPrefix string `yaml:"subject_prefix,omitempty" json:"subjectPrefix,omitempty"`
+	// PublishIntervalMs is how often the card states are published (default 1000)
+	PublishIntervalMs int `yaml:"publish_interval_ms,omitempty" json:"publishIntervalMs,omitempty"`
+}
+
+// RedisConfig is the Redis state mirror: the state of every card is kept in a key under KeyPrefix and
+// published on a channel of the same name when it changes. The password is never returned by the API.
+type RedisConfig struct {
+	// Addr is the server address, e.g. localhost:6379 ("" = disabled)
+	Addr     string `yaml:"addr,omitempty" json:"addr,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+	// DB is the database number
+	DB int `yaml:"db,omitempty" json:"db,omitempty"`
+	// KeyPrefix is the prefix of the device's keys and channels (default "jaspermate:<device_id>")
+	KeyPrefix string `yaml:"key_prefix,omitempty" json:"keyPrefix,omitempty"`
+	// IntervalMs is how often the card states are mirrored (default 200)
+	IntervalMs int `yaml:"interval_ms,omitempty" json:"intervalMs,omitempty"`
+}
+
+// CloudTwinConfig is the cloud connector: the card states are reported as device twin/shadow properties
+// and the desired outputs are written. The device key is never returned by the API.
+type CloudTwinConfig struct {
+	// Provider is "azure" (IoT Hub device twin) or "aws" (IoT Core device shadow); "" = disabled
+	Provider string `yaml:"provider,omitempty" json:"provider,omitempty"`
+	// Host is the IoT Hub host name (<hub>.azure-devices.net) or the AWS IoT data endpoint
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// DeviceID is the IoT Hub device ID or AWS thing name (default device_id)
+	DeviceID string `yaml:"device_id,omitempty" json:"deviceId,omitempty"`
+	// DeviceKey is the IoT Hub symmetric device key (base64); not needed with an X.509 certificate
+	DeviceKey string `yaml:"device_key,omitempty" json:"-"`
+	// CertFile and KeyFile are the device's X.509 certificate and private key (PEM); required by AWS
+	CertFile string `yaml:"cert_file,omitempty" json:"certFile,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty" json:"keyFile,omitempty"`
+	// CAFile is the PEM bundle verifying the server ("" = system roots)
+	CAFile string `yaml:"ca_file,omitempty" json:"caFile,omitempty"`
+	// ReportIntervalMs is how often changed card states are reported (default 5000)
+	ReportIntervalMs int `yaml:"report_interval_ms,omitempty" json:"reportIntervalMs,omitempty"`
+}
+
+// EscalationPolicy lists the notifications sent while an alarm of a severity stays unacknowledged
+type EscalationPolicy struct {
+	Severity string           `yaml:"severity" json:"severity"`
+	Steps    []EscalationStep `yaml:"steps" json:"steps"`
+}
+
+// EscalationStep notifies channels once an alarm has been unacknowledged for AfterSec seconds
+type EscalationStep struct {
+	AfterSec int      `yaml:"after_sec" json:"afterSec"`
+	Channels []string `yaml:"channels" json:"channels"`
+}
+
+// InterlockRule is a DO interlock. Only switching an output on is ever rejected; switching off is always allowed.
+type InterlockRule struct {
+	Name    string       `yaml:"name" json:"name"`
+	Type    string       `yaml:"type" json:"type"`
+	Outputs []ChannelRef `yaml:"outputs,omitempty" json:"outputs,omitempty"` // exclusive
+	Output  ChannelRef   `yaml:"output,omitempty" json:"output,omitempty"`   // requires
+	Input   ChannelRef   `yaml:"input,omitempty" json:"input,omitempty"`     // requires (DI)
+	// InputState is the DI state required by a "requires" rule (default true = high)
+	InputState *bool `yaml:"input_state,omitempty" json:"inputState,omitempty"`
+}
+
+// DO timing modes
+const (
+	// DOTimingReject rejects a write switching a DO before its minimum on/off time has passed
+	DOTimingReject = "reject"
+	// DOTimingDelay holds such a write back until the minimum time has passed
+	DOTimingDelay = "delay"
+)
+
+// DOTiming is the minimum on and off time of a DO channel, protecting contactors and compressors from
+// short-cycling. Safe state writes are never held back.
+type DOTiming struct {
+	Card     string `yaml:"card" json:"card"`
+	Index    int    `yaml:"index" json:"index"`
+	MinOnMs  int    `yaml:"min_on_ms,omitempty" json:"minOnMs,omitempty"`
+	MinOffMs int    `yaml:"min_off_ms,omitempty" json:"minOffMs,omitempty"`
+	// Mode is "reject" (default) or "delay"
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// AOSlewRate is the maximum rate of change of an AO channel, protecting actuators that can't handle step
+// changes. Writes changing the output faster are converted into a ramp.
+type AOSlewRate struct {
+	Card  string `yaml:"card" json:"card"`
+	Index int    `yaml:"index" json:"index"`
+	// MaxPerSec is the maximum change per second in raw AO units (value * 1000, e.g. 1000 = 1 V/s)
+	MaxPerSec float64 `yaml:"max_per_sec" json:"maxPerSec"`
+}
+
+// PIDLoopConfig configures an embedded PID loop reading an AI channel (PV) and driving an AO channel (CV).
+// Output limits are in raw AO units (value * 1000, e.g. 0-10000 for 0-10V).
+type PIDLoopConfig struct {
+	Name     string  `yaml:"name"`
+	PVCard   string  `yaml:"pv_card"`
+	PVIndex  int     `yaml:"pv_index"`
+	CVCard   string  `yaml:"cv_card"`
+	CVIndex  int     `yaml:"cv_index"`
+	Kp       float64 `yaml:"kp"`
+	Ki       float64 `yaml:"ki"`
+	Kd       float64 `yaml:"kd"`
+	Setpoint float64 `yaml:"setpoint"`
+	OutMin   float64 `yaml:"out_min"`
+	OutMax   float64 `yaml:"out_max"`
+	// Mode is "auto" (default) or "manual"; in manual mode ManualOutput is written to the CV
+	Mode         string  `yaml:"mode,omitempty"`
+	ManualOutput float64 `yaml:"manual_output,omitempty"`
 }
 
 var (
-	cfg     Config
-	cfgOnce sync.Once
-	cfgMu   sync.RWMutex
+	cfg    Config
+	cfgMu  sync.RWMutex
+	loaded bool // cfg was loaded from the config file; guarded by cfgMu
 )
 
-func init() {
-	cfgOnce.Do(func() {
-		if err := loadConfig(); err != nil {
-			log.Printf("Config: failed to load, using generated values: %v", err)
-		}
-	})
+// load reads the config file on first use rather than at package initialization, so the config
+// directory can still be chosen after the package is initialized (tests set CM_UTILS_CONFIG_DIR)
+func load() {
+	cfgMu.RLock()
+	done := loaded
+	cfgMu.RUnlock()
+	if done {
+		return
+	}
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	if loaded {
+		return
+	}
+	if err := loadConfigLocked(); err != nil {
+		log.Printf("Config: failed to load, using generated values: %v", err)
+	}
+}
+
+// Reset discards the config in memory and the resolved config directory; both are loaded again on next use.
+// Tests call it to start from the config of their own directory instead of the config left by the test
+// before.
+func Reset() {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	cfg = Config{}
+	secretRefs = make(map[string]secretRef)
+	loaded = false
+	forgetStorage()
 }
 
 func GetConfig() Config {
+	load()
 	cfgMu.RLock()
 	defer cfgMu.RUnlock()
 	return cfg
 }
 
 func GetDeviceID() string {
+	load()
 	cfgMu.RLock()
 	defer cfgMu.RUnlock()
 	return cfg.DeviceID
 }
 
 func SetSerialBaud(baud int) {
+	load()
 	cfgMu.Lock()
 	defer cfgMu.Unlock()
 	cfg.SerialBaud = baud
 }
 
+// GetAdminToken returns the token authorizing administrative API calls ("" = none configured)
+func GetAdminToken() string {
+	if token := GetConfig().AdminToken; token != "" {
+		return token
+	}
+	return util.GetString("CM_UTILS_ADMIN_TOKEN", "")
+}
+
+// GetGRPCToken returns the token authorizing gRPC calls ("" = none configured)
+func GetGRPCToken() string {
+	if token := GetConfig().GRPCToken; token != "" {
+		return token
+	}
+	return util.GetString("CM_UTILS_GRPC_TOKEN", "")
+}
+
+// Update applies fn to the config, persists the result to disk and records it in the configuration
+// history as a change of the service itself
+func Update(fn func(c *Config)) error {
+	return UpdateContext(context.Background(), fn)
+}
+
+// UpdateContext is Update with the version recorded in the history attributed to the change of ctx
+// (see WithChange)
+func UpdateContext(ctx context.Context, fn func(c *Config)) error {
+	load()
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	return updateLocked(changeFrom(ctx), fn)
+}
+
+func updateLocked(change Change, fn func(c *Config)) error {
+	before := cfg
+	fn(&cfg)
+	if err := saveConfigLocked(getConfigPath()); err != nil {
+		return err
+	}
+	if err := recordVersionLocked(before, cfg, change); err != nil {
+		log.Printf("Config history: failed to record the change: %v", err)
+	}
+	return nil
+}
+
+// Parse decodes a config file without applying it. Unknown fields are rejected.
+func Parse(data []byte) (Config, error) {
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && err != io.EOF {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// DataDir returns the directory holding config.yaml, used for other persistent service data
+func DataDir() string {
+	return filepath.Dir(getConfigPath())
+}
+
+// getConfigPath returns the path of config.yaml: in CM_UTILS_CONFIG_DIR if set, otherwise in the directory
+// resolved when the config was loaded
 func getConfigPath() string {
-	if dir := os.Getenv("CM_UTILS_CONFIG_DIR"); dir != "" {
-		return filepath.Join(dir, configFileName)
-	}
-	if info, err := os.Stat(prodConfigDir); err == nil && info.IsDir() {
-		testFile := filepath.Join(prodConfigDir, ".write_test")
-		if f, err := os.Create(testFile); err == nil {
-			f.Close()
-			os.Remove(testFile)
-			return filepath.Join(prodConfigDir, configFileName)
-		}
+	if dir := util.GetString("CM_UTILS_CONFIG_DIR", ""); dir != "" {
+		path := filepath.Join(dir, configFileName)
+		setStorage(Storage{Path: path, Persistent: true})
+		return path
 	}
-	return filepath.Join("tmp", configFileName)
+	return resolvedStorage().Path
 }
 
 func generateUUID() (string, error) {
@@ -86,20 +659,40 @@ func generateUUID() (string, error) {
 func loadConfig() error {
 	cfgMu.Lock()
 	defer cfgMu.Unlock()
+	return loadConfigLocked()
+}
 
+func loadConfigLocked() error {
+	loaded = true
+	forgetStorage()
 	path := getConfigPath()
 	fmt.Println("Config:", path)
 	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
+	seeded := false
+	if os.IsNotExist(err) {
+		// Carry over the config of a directory that became read-only instead of generating a new DeviceID
+		seed, from := readOnlyConfig(GetStorage())
+		if seed == nil {
 			return createDefaultConfig(path)
 		}
+		log.Printf("Config: copying %s to %s", from, path)
+		data, err, seeded = seed, nil, true
+	}
+	if err != nil {
 		return err
 	}
 
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return err
 	}
+	// Secrets written in plaintext (e.g. by hand) are encrypted right away
+	encrypt := cfg.EncryptSecrets && hasPlaintextSecrets(&cfg)
+	if err := decryptSecrets(&cfg); err != nil {
+		log.Printf("Config: %v", err)
+	}
+	if err := resolveSecretRefsLocked(&cfg); err != nil {
+		log.Printf("Config: %v", err)
+	}
 
 	if cfg.DeviceID == "" {
 		uuid, err := generateUUID()
@@ -109,6 +702,9 @@ func loadConfig() error {
 		cfg.DeviceID = uuid
 		return saveConfigLocked(path)
 	}
+	if seeded || encrypt {
+		return saveConfigLocked(path)
+	}
 
 	return nil
 }
@@ -126,7 +722,7 @@ func createDefaultConfig(path string) error {
 }
 
 func saveConfigLocked(path string) error {
-	data, err := yaml.Marshal(&cfg)
+	data, err := marshalConfigLocked(cfg)
 	if err != nil {
 		return err
 	}
@@ -144,3 +740,16 @@ func saveConfigLocked(path string) error {
 	}
 	return os.Rename(tmp, path)
 }
+
+// marshalConfigLocked encodes c as stored on disk: secrets loaded from secret:// references are written
+// as the reference, the others encrypted if encrypt_secrets is set. The caller must hold cfgMu.
+func marshalConfigLocked(c Config) ([]byte, error) {
+	c = withOwnSecrets(c)
+	restoreSecretRefsLocked(&c)
+	if c.EncryptSecrets {
+		if err := encryptSecrets(&c); err != nil {
+			return nil, fmt.Errorf("encrypt secrets: %w", err)
+		}
+	}
+	return yaml.Marshal(&c)
+}
@@ -0,0 +1,36 @@
+// Package configtest isolates the tests of packages using the config from the config of the machine
+// running them and from each other.
+package configtest
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Isolate gives the test a config directory of its own, with a new config loaded from it on first use.
+// The config is discarded again when the test ends, so the changes of the test don't leak into the next.
+func Isolate(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CM_UTILS_CONFIG_DIR", dir)
+	config.Reset()
+	t.Cleanup(config.Reset)
+	return dir
+}
+
+// Main runs the tests of a package with the config in a temporary directory, so that tests that don't
+// call Isolate don't write a config to the tmp/ directory of the package. Call it from TestMain.
+func Main(m *testing.M) {
+	dir, err := os.MkdirTemp("", "cm-utils-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("CM_UTILS_CONFIG_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ClaimTokenTTL is how long a claim token issued by RotateDeviceID stays valid
+const ClaimTokenTTL = 24 * time.Hour
+
+// ErrInvalidClaimToken is returned for an unknown, used, or expired claim token
+var ErrInvalidClaimToken = errors.New("invalid or expired claim token")
+
+// RotateDeviceID gives the device a new DeviceID and issues a one-time claim token for binding it to a new
+// account in the cloud backend (e.g. a refurbished unit). Only a hash of the token is persisted, so the
+// token itself is returned once and never shown again. A previous unused token is invalidated. The change
+// is attributed in the configuration history to the change of ctx (see WithChange).
+func RotateDeviceID(ctx context.Context) (deviceID, claimToken string, expiresAt time.Time, err error) {
+	deviceID, err = generateUUID()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", time.Time{}, err
+	}
+	claimToken = hex.EncodeToString(raw)
+	expiresAt = time.Now().Add(ClaimTokenTTL).UTC().Truncate(time.Second)
+
+	err = UpdateContext(ctx, func(c *Config) {
+		c.DeviceID = deviceID
+		c.ClaimTokenHash = hashClaimToken(claimToken)
+		c.ClaimTokenExpires = expiresAt
+	})
+	return deviceID, claimToken, expiresAt, err
+}
+
+// ConsumeClaimToken checks a claim token and invalidates it, returning the DeviceID it was issued for
+func ConsumeClaimToken(token string) (string, error) {
+	load()
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+
+	if cfg.ClaimTokenHash == "" || token == "" || time.Now().After(cfg.ClaimTokenExpires) {
+		return "", ErrInvalidClaimToken
+	}
+	if subtle.ConstantTimeCompare([]byte(hashClaimToken(token)), []byte(cfg.ClaimTokenHash)) != 1 {
+		return "", ErrInvalidClaimToken
+	}
+	cfg.ClaimTokenHash = ""
+	cfg.ClaimTokenExpires = time.Time{}
+	return cfg.DeviceID, saveConfigLocked(getConfigPath())
+}
+
+func hashClaimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
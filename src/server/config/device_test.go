@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateDeviceID_ClaimTokenIsOneTime(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+	before := GetDeviceID()
+
+	deviceID, token, expiresAt, err := RotateDeviceID(context.Background())
+	if err != nil {
+		t.Fatalf("RotateDeviceID failed: %v", err)
+	}
+	if deviceID == before || GetDeviceID() != deviceID {
+		t.Errorf("Expected a new device ID, got %s (before %s)", GetDeviceID(), before)
+	}
+	if expiresAt.Before(time.Now()) {
+		t.Errorf("Expected expiry in the future, got %s", expiresAt)
+	}
+	if GetConfig().ClaimTokenHash == token {
+		t.Error("Claim token must not be stored in plain text")
+	}
+
+	if _, err := ConsumeClaimToken("wrong"); !errors.Is(err, ErrInvalidClaimToken) {
+		t.Errorf("Expected wrong token to be rejected, got %v", err)
+	}
+	got, err := ConsumeClaimToken(token)
+	if err != nil || got != deviceID {
+		t.Fatalf("ConsumeClaimToken = %s, %v; want %s", got, err, deviceID)
+	}
+	if _, err := ConsumeClaimToken(token); !errors.Is(err, ErrInvalidClaimToken) {
+		t.Errorf("Expected token to be usable only once, got %v", err)
+	}
+}
+
+func TestConsumeClaimToken_Expired(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+	_, token, _, err := RotateDeviceID(context.Background())
+	if err != nil {
+		t.Fatalf("RotateDeviceID failed: %v", err)
+	}
+	Update(func(c *Config) { c.ClaimTokenExpires = time.Now().Add(-time.Minute) })
+
+	if _, err := ConsumeClaimToken(token); !errors.Is(err, ErrInvalidClaimToken) {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// historyDir is the directory in DataDir holding the configuration versions
+const historyDir = "config-history"
+
+// redacted replaces secrets in the diffs of configuration versions
+const redacted = "<redacted>"
+
+// ErrVersionNotFound is returned by Rollback for a version that is not (or no longer) kept
+var ErrVersionNotFound = errors.New("config version not found")
+
+// Change describes who made a configuration change and how
+type Change struct {
+	// Actor is who made the change, e.g. "http:192.168.1.20" ("" = the service itself)
+	Actor string `json:"actor"`
+	// Summary describes the change, e.g. "PUT /api/interlocks"
+	Summary string `json:"summary"`
+}
+
+// Version is a saved configuration: every change persisted with Update creates one
+type Version struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Change
+	// Diff lists the lines of config.yaml removed ("-") and added ("+") by the change, secrets redacted
+	Diff string `json:"diff,omitempty"`
+}
+
+// versionFile is a version as stored on disk, with the full config.yaml it restores
+type versionFile struct {
+	Version
+	Config string `json:"config"`
+}
+
+type changeKey struct{}
+
+// WithChange returns a copy of ctx attributing the configuration changes made with it (UpdateContext,
+// RollbackContext) to c
+func WithChange(ctx context.Context, c Change) context.Context {
+	return context.WithValue(ctx, changeKey{}, c)
+}
+
+// changeFrom returns the change of ctx (zero = made by the service itself)
+func changeFrom(ctx context.Context) Change {
+	c, _ := ctx.Value(changeKey{}).(Change)
+	return c
+}
+
+// History returns the kept configuration versions, newest first
+func History() ([]Version, error) {
+	load()
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	files, err := readHistoryLocked()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]Version, len(files))
+	for i, f := range files {
+		versions[len(files)-1-i] = f.Version
+	}
+	return versions, nil
+}
+
+// Rollback restores the configuration of a kept version and persists it as a new version. The device
+// identity and credentials (device ID, admin and gRPC tokens, claim token) are not rolled back.
+func Rollback(version int) error {
+	return RollbackContext(context.Background(), version)
+}
+
+// RollbackContext is Rollback with the new version attributed to the change of ctx (see WithChange)
+func RollbackContext(ctx context.Context, version int) error {
+	load()
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	data, err := os.ReadFile(versionPath(version))
+	if os.IsNotExist(err) {
+		return ErrVersionNotFound
+	} else if err != nil {
+		return err
+	}
+	var f versionFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("version %d: %w", version, err)
+	}
+	var restored Config
+	if err := yaml.Unmarshal([]byte(f.Config), &restored); err != nil {
+		return fmt.Errorf("version %d: %w", version, err)
+	}
+	if err := decryptSecrets(&restored); err != nil {
+		return fmt.Errorf("version %d: %w", version, err)
+	}
+	if err := resolveSecretRefsLocked(&restored); err != nil {
+		return fmt.Errorf("version %d: %w", version, err)
+	}
+	return updateLocked(changeFrom(ctx), func(c *Config) {
+		restored.DeviceID = c.DeviceID
+		restored.AdminToken = c.AdminToken
+		restored.GRPCToken = c.GRPCToken
+		restored.ClaimTokenHash = c.ClaimTokenHash
+		restored.ClaimTokenExpires = c.ClaimTokenExpires
+		*c = restored
+	})
+}
+
+// recordVersionLocked saves the config after a change as a new version and removes the versions beyond
+// config_history_versions. The config before the change is saved first if the history is empty, so the
+// first change can be rolled back as well. The caller must hold cfgMu.
+func recordVersionLocked(before, after Config, change Change) error {
+	files, err := readHistoryLocked()
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(files) > 0 {
+		next = files[len(files)-1].Version.Version + 1
+	} else {
+		if err := writeVersionLocked(versionFile{Version: Version{Version: next, Time: time.Now(), Change: Change{Summary: "initial configuration"}}}, before); err != nil {
+			return err
+		}
+		next++
+	}
+
+	diff := lineDiff(redactedYAML(before), redactedYAML(after))
+	if diff == "" {
+		return nil
+	}
+	v := versionFile{Version: Version{Version: next, Time: time.Now(), Change: change, Diff: diff}}
+	if err := writeVersionLocked(v, after); err != nil {
+		return err
+	}
+
+	keep := settingsOf(after).ConfigHistoryVersions
+	for _, f := range files {
+		if f.Version.Version <= next-keep {
+			os.Remove(versionPath(f.Version.Version))
+		}
+	}
+	return nil
+}
+
+func writeVersionLocked(f versionFile, c Config) error {
+	data, err := marshalConfigLocked(c)
+	if err != nil {
+		return err
+	}
+	f.Config = string(data)
+	if data, err = json.Marshal(f); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(DataDir(), historyDir), 0700); err != nil {
+		return err
+	}
+	// Versions hold the full config including secrets
+	return os.WriteFile(versionPath(f.Version.Version), data, 0600)
+}
+
+// readHistoryLocked reads the kept versions, oldest first. Unreadable versions are skipped.
+func readHistoryLocked() ([]versionFile, error) {
+	entries, err := os.ReadDir(filepath.Join(DataDir(), historyDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var files []versionFile
+	for _, e := range entries {
+		if _, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".json")); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(DataDir(), historyDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var f versionFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			log.Printf("Config history: skipping %s: %v", e.Name(), err)
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Version.Version < files[j].Version.Version })
+	return files, nil
+}
+
+func versionPath(version int) string {
+	return filepath.Join(DataDir(), historyDir, strconv.Itoa(version)+".json")
+}
+
+// redactedYAML returns config.yaml of c with the secrets replaced
+func redactedYAML(c Config) []string {
+	c = withOwnSecrets(c)
+	if c.ClaimTokenHash != "" {
+		c.ClaimTokenHash = redacted
+	}
+	for _, s := range secretsOf(&c) {
+		if *s.value != "" {
+			*s.value = redacted
+		}
+	}
+	data, err := yaml.Marshal(&c)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// lineDiff returns the lines removed from a ("-") and added in b ("+"), in file order
+func lineDiff(a, b []string) string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
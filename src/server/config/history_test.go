@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHistoryAndRollback(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+	orig := GetConfig()
+	defer Update(func(c *Config) { *c = orig })
+
+	baud := orig.SerialBaud
+	ctx := WithChange(context.Background(), Change{Actor: "http:10.0.0.1", Summary: "PUT /api/settings"})
+	if err := UpdateContext(ctx, func(c *Config) { c.SerialBaud = 9600 }); err != nil {
+		t.Fatalf("UpdateContext failed: %v", err)
+	}
+	if err := Update(func(c *Config) { c.AdminToken = "secret" }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	versions, err := History()
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(versions) != 3 || versions[2].Summary != "initial configuration" {
+		t.Fatalf("Expected the initial configuration and two changes, got %+v", versions)
+	}
+	v := versions[1]
+	if v.Version != 2 || v.Actor != "http:10.0.0.1" || !strings.Contains(v.Diff, "+serial_baud: 9600\n") {
+		t.Errorf("Expected the attributed baud rate change, got %+v", v)
+	}
+	if versions[0].Actor != "" || strings.Contains(versions[0].Diff, "secret") || !strings.Contains(versions[0].Diff, redacted) {
+		t.Errorf("Expected an unattributed change with the admin token redacted, got %+v", versions[0])
+	}
+
+	// Rolling back restores the configuration except the credentials and is a version itself
+	if err := Rollback(1); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if c := GetConfig(); c.SerialBaud != baud || c.AdminToken != "secret" {
+		t.Errorf("Expected baud rate %d and the admin token kept, got %d and %q", baud, c.SerialBaud, c.AdminToken)
+	}
+	if versions, _ := History(); len(versions) != 4 || !strings.Contains(versions[0].Diff, "-serial_baud: 9600\n") {
+		t.Errorf("Expected the rollback recorded as version 4, got %+v", versions)
+	}
+	if err := Rollback(42); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+
+	// Only the last config_history_versions versions are kept
+	Update(func(c *Config) { c.Settings.ConfigHistoryVersions = 2 })
+	Update(func(c *Config) { c.SerialBaud = 19200 })
+	if versions, _ := History(); len(versions) != 2 || versions[1].Version != 5 {
+		t.Errorf("Expected versions 6 and 5, got %+v", versions)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	a := []string{"a: 1", "b: 2", "c: 3"}
+	b := []string{"a: 1", "b: 5", "c: 3", "d: 4"}
+	if got := lineDiff(a, b); got != "-b: 2\n+b: 5\n+d: 4\n" {
+		t.Errorf("Unexpected diff %q", got)
+	}
+	if got := lineDiff(a, a); got != "" {
+		t.Errorf("Expected no diff, got %q", got)
+	}
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// encryptedPrefix marks an encrypted secret in config.yaml: "enc:v1:<base64 of nonce and ciphertext>"
+	encryptedPrefix = "enc:v1:"
+	// keyFileName is the device key in the data directory, readable by the service only
+	keyFileName = "config.key"
+)
+
+// secret is a config field holding a credential
+type secret struct {
+	name  string
+	value *string
+}
+
+// secretsOf returns the credentials of c, which are encrypted at rest with encrypt_secrets. Webhook and
+// Slack URLs carry the token of their endpoint, so notification channel URLs are secrets too.
+func secretsOf(c *Config) []secret {
+	secrets := []secret{
+		{"admin_token", &c.AdminToken},
+		{"grpc_token", &c.GRPCToken},
+		{"notifications.smtp.password", &c.Notifications.SMTP.Password},
+		{"mqtt.password", &c.MQTT.Password},
+		{"nats.password", &c.NATS.Password},
+		{"nats.token", &c.NATS.Token},
+		{"redis.password", &c.Redis.Password},
+		{"cloud_twin.device_key", &c.CloudTwin.DeviceKey},
+	}
+	for i := range c.Notifications.Channels {
+		ch := &c.Notifications.Channels[i]
+		secrets = append(secrets, secret{fmt.Sprintf("notifications.channels[%s].url", ch.Name), &ch.URL})
+	}
+	return secrets
+}
+
+// withOwnSecrets returns c with its own copy of the slices holding secrets, so the secrets of a copy of the
+// config can be encrypted or redacted without touching the original
+func withOwnSecrets(c Config) Config {
+	c.Notifications.Channels = slices.Clone(c.Notifications.Channels)
+	return c
+}
+
+// deviceKey returns the AES-256 key of the device, generating it on first use
+func deviceKey() ([]byte, error) {
+	path := filepath.Join(DataDir(), keyFileName)
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%s: invalid key length %d", path, len(key))
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// O_EXCL: never replace a key that encrypted secrets depend on
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecrets encrypts the plaintext secrets of c
+func encryptSecrets(c *Config) error {
+	var gcm cipher.AEAD
+	for _, s := range secretsOf(c) {
+		if *s.value == "" || strings.HasPrefix(*s.value, encryptedPrefix) || strings.HasPrefix(*s.value, secretRefPrefix) {
+			continue
+		}
+		if gcm == nil {
+			key, err := deviceKey()
+			if err != nil {
+				return fmt.Errorf("device key: %w", err)
+			}
+			if gcm, err = newGCM(key); err != nil {
+				return err
+			}
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		sealed := gcm.Seal(nonce, nonce, []byte(*s.value), []byte(s.name))
+		*s.value = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+	return nil
+}
+
+// decryptSecrets decrypts the encrypted secrets of c. A secret that can't be decrypted (e.g. the device key
+// was lost) is cleared and reported, so the rest of the config stays usable.
+func decryptSecrets(c *Config) error {
+	var gcm cipher.AEAD
+	var errs []error
+	for _, s := range secretsOf(c) {
+		if !strings.HasPrefix(*s.value, encryptedPrefix) {
+			continue
+		}
+		plain, err := func() ([]byte, error) {
+			if gcm == nil {
+				key, err := deviceKey()
+				if err != nil {
+					return nil, fmt.Errorf("device key: %w", err)
+				}
+				if gcm, err = newGCM(key); err != nil {
+					return nil, err
+				}
+			}
+			sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*s.value, encryptedPrefix))
+			if err != nil || len(sealed) < gcm.NonceSize() {
+				return nil, errors.New("malformed value")
+			}
+			return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(s.name))
+		}()
+		if err != nil {
+			*s.value = ""
+			errs = append(errs, fmt.Errorf("%s: can't decrypt: %w", s.name, err))
+			continue
+		}
+		*s.value = string(plain)
+	}
+	return errors.Join(errs...)
+}
+
+// hasPlaintextSecrets reports whether c holds secrets that encrypt_secrets would encrypt
+func hasPlaintextSecrets(c *Config) bool {
+	for _, s := range secretsOf(c) {
+		if *s.value != "" && !strings.HasPrefix(*s.value, encryptedPrefix) && !strings.HasPrefix(*s.value, secretRefPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecrets(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+
+	c := Config{AdminToken: "admin", MQTT: MQTTConfig{Password: "mqtt"}}
+	if err := encryptSecrets(&c); err != nil {
+		t.Fatalf("encryptSecrets failed: %v", err)
+	}
+	if !strings.HasPrefix(c.AdminToken, encryptedPrefix) || !strings.HasPrefix(c.MQTT.Password, encryptedPrefix) || c.GRPCToken != "" {
+		t.Fatalf("Expected the set secrets to be encrypted, got %+v", c)
+	}
+	if info, err := os.Stat(filepath.Join(DataDir(), keyFileName)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a device key readable by the owner only, got %v %v", info, err)
+	}
+
+	// A secret moved to another field doesn't decrypt
+	c.GRPCToken = c.AdminToken
+	if err := decryptSecrets(&c); err == nil || !strings.Contains(err.Error(), "grpc_token") {
+		t.Errorf("Expected grpc_token to fail, got %v", err)
+	}
+	if c.AdminToken != "admin" || c.MQTT.Password != "mqtt" || c.GRPCToken != "" {
+		t.Errorf("Expected the secrets decrypted and the moved one cleared, got %+v", c)
+	}
+
+	// Channel URLs are encrypted in the saved copy only
+	c = Config{EncryptSecrets: true, Notifications: Notifications{Channels: []NotificationChannel{
+		{Name: "chat", Type: "slack", URL: "https://hooks.example.com/T000"},
+	}}}
+	data, err := marshalConfigLocked(c)
+	if err != nil {
+		t.Fatalf("marshalConfigLocked failed: %v", err)
+	}
+	if strings.Contains(string(data), "T000") || !strings.Contains(string(data), encryptedPrefix) {
+		t.Errorf("Expected the channel URL encrypted, got:\n%s", data)
+	}
+	if c.Notifications.Channels[0].URL != "https://hooks.example.com/T000" {
+		t.Errorf("Expected the config unchanged, got %q", c.Notifications.Channels[0].URL)
+	}
+}
+
+func TestLoadEncryptedConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CM_UTILS_CONFIG_DIR", dir)
+	cfgMu.Lock()
+	saved := cfg
+	cfg = Config{}
+	cfgMu.Unlock()
+	defer func() {
+		cfgMu.Lock()
+		cfg = saved
+		cfgMu.Unlock()
+	}()
+
+	// Plaintext secrets are encrypted on load and decrypted in memory
+	path := filepath.Join(dir, configFileName)
+	os.WriteFile(path, []byte("device_id: d1\nencrypt_secrets: true\nmqtt:\n  password: hunter2\n"), 0644)
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), encryptedPrefix) {
+		t.Errorf("Expected the password encrypted on disk, got:\n%s", data)
+	}
+	if GetConfig().MQTT.Password != "hunter2" {
+		t.Errorf("Expected the decrypted password, got %q", GetConfig().MQTT.Password)
+	}
+
+	cfgMu.Lock()
+	cfg = Config{}
+	cfgMu.Unlock()
+	if err := loadConfig(); err != nil || GetConfig().MQTT.Password != "hunter2" {
+		t.Errorf("Expected the encrypted password to load, got %q %v", GetConfig().MQTT.Password, err)
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretRefPrefix marks a secret resolved from outside config.yaml when the config is loaded:
+//
+//	secret://env/NAME        the environment variable NAME
+//	secret://file/PATH       the file /PATH, e.g. secret://file/run/secrets/mqtt
+//	secret://credential/NAME the systemd credential NAME (LoadCredential=, in $CREDENTIALS_DIRECTORY)
+const secretRefPrefix = "secret://"
+
+// secretRef is a secret field loaded from a reference, with the value it resolved to
+type secretRef struct {
+	uri   string
+	value string
+}
+
+// secretRefs are the resolved references by field name, so saving the config writes the reference back
+// instead of the value. Guarded by cfgMu.
+var secretRefs = make(map[string]secretRef)
+
+// resolveSecret returns the value a secret:// reference points to
+func resolveSecret(uri string) (string, error) {
+	kind, name, ok := strings.Cut(strings.TrimPrefix(uri, secretRefPrefix), "/")
+	if !ok || name == "" {
+		return "", fmt.Errorf("invalid secret reference %q (use secret://env/NAME, secret://file/PATH or secret://credential/NAME)", uri)
+	}
+	var path string
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case "file":
+		path = "/" + name
+	case "credential":
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return "", fmt.Errorf("no systemd credentials (CREDENTIALS_DIRECTORY is not set)")
+		}
+		if strings.Contains(name, "/") {
+			return "", fmt.Errorf("invalid credential name %q", name)
+		}
+		path = filepath.Join(dir, name)
+	default:
+		return "", fmt.Errorf("unknown secret source %q (use env, file or credential)", kind)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Secret files usually end with a newline that isn't part of the secret
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecretRefsLocked replaces the secret:// references of c by their values and remembers them. A
+// reference that can't be resolved is reported and leaves its field empty. The caller must hold cfgMu.
+func resolveSecretRefsLocked(c *Config) error {
+	var errs []string
+	for _, s := range secretsOf(c) {
+		if !strings.HasPrefix(*s.value, secretRefPrefix) {
+			continue
+		}
+		uri := *s.value
+		value, err := resolveSecret(uri)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", s.name, err))
+		}
+		*s.value = value
+		secretRefs[s.name] = secretRef{uri: uri, value: value}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// restoreSecretRefsLocked puts the references back into the fields of c still holding the value they
+// resolved to; a field changed since is saved with its new value. The caller must hold cfgMu.
+func restoreSecretRefsLocked(c *Config) {
+	for _, s := range secretsOf(c) {
+		if ref, ok := secretRefs[s.name]; ok && *s.value == ref.value {
+			*s.value = ref.uri
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "mqtt"), []byte("from-file\n"), 0600)
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+
+	tests := []struct {
+		uri, want string
+		wantErr   bool
+	}{
+		{"secret://env/TEST_SECRET", "from-env", false},
+		{"secret://env/TEST_SECRET_MISSING", "", true},
+		{"secret://file" + filepath.Join(dir, "mqtt"), "from-file", false},
+		{"secret://credential/mqtt", "from-file", false},
+		{"secret://credential/../mqtt", "", true},
+		{"secret://vault/mqtt", "", true},
+		{"secret://env", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.uri)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("resolveSecret(%q) = %q, %v; want %q, error %v", tt.uri, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSecretRefsKeptOnSave(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CM_UTILS_CONFIG_DIR", dir)
+	t.Setenv("TEST_MQTT_PASSWORD", "hunter2")
+	cfgMu.Lock()
+	saved := cfg
+	cfg = Config{}
+	cfgMu.Unlock()
+	defer func() {
+		cfgMu.Lock()
+		cfg = saved
+		clear(secretRefs)
+		cfgMu.Unlock()
+	}()
+
+	path := filepath.Join(dir, configFileName)
+	os.WriteFile(path, []byte("device_id: d1\nencrypt_secrets: true\nmqtt:\n  password: secret://env/TEST_MQTT_PASSWORD\nnats:\n  password: secret://env/TEST_NATS_PASSWORD\n"), 0644)
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if GetConfig().MQTT.Password != "hunter2" || GetConfig().NATS.Password != "" {
+		t.Fatalf("Expected the resolved password and an empty unresolvable one, got %q %q", GetConfig().MQTT.Password, GetConfig().NATS.Password)
+	}
+
+	// Saving writes the references back, not the values; a changed value replaces its reference
+	if err := Update(func(c *Config) { c.SerialBaud = 9600 }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "secret://env/TEST_MQTT_PASSWORD") || !strings.Contains(string(data), "secret://env/TEST_NATS_PASSWORD") {
+		t.Errorf("Expected the references kept on save, got:\n%s", data)
+	}
+	if err := Update(func(c *Config) { c.MQTT.Password = "changed" }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "TEST_MQTT_PASSWORD") || !strings.Contains(string(data), encryptedPrefix) {
+		t.Errorf("Expected the changed password encrypted instead of the reference, got:\n%s", data)
+	}
+}
@@ -0,0 +1,381 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/util"
+)
+
+// profileEnv selects the active config profile
+const profileEnv = "CM_UTILS_PROFILE"
+
+// settingsEnvPrefix prefixes the environment variable overriding a setting, e.g. CM_UTILS_HTTP_PORT
+const settingsEnvPrefix = "CM_UTILS_"
+
+// Settings are the service's tunable runtime values. Each one can be set in the "settings" section of
+// config.yaml and overridden by the environment variable CM_UTILS_<NAME> (e.g. CM_UTILS_TCP_PORT=9091)
+// or a command line flag (see RegisterSettingsFlags). Zero values fall back to the defaults.
+type Settings struct {
+	// HTTPPort is the port of the HTTP API and web UI
+	HTTPPort int `yaml:"http_port,omitempty" json:"httpPort"`
+	// TCPPort is the port of the TCP control interface
+	TCPPort int `yaml:"tcp_port,omitempty" json:"tcpPort"`
+	// GRPCPort is the port of the gRPC API (0 = disabled)
+	GRPCPort int `yaml:"grpc_port,omitempty" json:"grpcPort"`
+	// SerialPort is the RS485 port scanned for IO cards at startup
+	SerialPort string `yaml:"serial_port,omitempty" json:"serialPort"`
+	// DiscoveryPorts are the ports scanned for cards at startup (default: SerialPort)
+	DiscoveryPorts []string `yaml:"discovery_ports,omitempty" json:"discoveryPorts"`
+	// MinSlaveID is the lowest slave ID probed during discovery
+	MinSlaveID int `yaml:"min_slave_id,omitempty" json:"minSlaveId"`
+	// MaxSlaveID is the highest slave ID probed during discovery
+	MaxSlaveID int `yaml:"max_slave_id,omitempty" json:"maxSlaveId"`
+	// ProbeTimeoutMs is the Modbus timeout while probing for cards (0 = ModbusTimeoutMs).
+	// A short timeout keeps scanning a wide address range fast.
+	ProbeTimeoutMs int `yaml:"probe_timeout_ms,omitempty" json:"probeTimeoutMs"`
+	// StartCycleWithoutCards starts the read-write cycle even if discovery found no card
+	StartCycleWithoutCards bool `yaml:"start_cycle_without_cards,omitempty" json:"startCycleWithoutCards"`
+	// StartupOutputPolicy is applied to the outputs once the cards are discovered: "untouched",
+	// "safe-state" or "restore" (the values persisted while running)
+	StartupOutputPolicy string `yaml:"startup_output_policy,omitempty" json:"startupOutputPolicy"`
+	// ModbusTimeoutMs is the response timeout of one Modbus request
+	ModbusTimeoutMs int `yaml:"modbus_timeout_ms,omitempty" json:"modbusTimeoutMs"`
+	// ModbusWriteTimeoutMs is the response timeout of one Modbus write request (0 = ModbusTimeoutMs)
+	ModbusWriteTimeoutMs int `yaml:"modbus_write_timeout_ms,omitempty" json:"modbusWriteTimeoutMs"`
+	// CycleDelayMs is the pause between two read-write cycles
+	CycleDelayMs int `yaml:"cycle_delay_ms,omitempty" json:"cycleDelayMs"`
+	// IdleCycleDelayMs is the pause between two read-write cycles while no consumer is active
+	IdleCycleDelayMs int `yaml:"idle_cycle_delay_ms,omitempty" json:"idleCycleDelayMs"`
+	// OperationDelayMs is the pause between two Modbus operations on the bus
+	OperationDelayMs int `yaml:"operation_delay_ms,omitempty" json:"operationDelayMs"`
+	// TCPUpdateIntervalMs is the interval of the periodic card updates sent to the TCP client
+	TCPUpdateIntervalMs int `yaml:"tcp_update_interval_ms,omitempty" json:"tcpUpdateIntervalMs"`
+	// TCPUpdateMode is "periodic" (all cards every interval) or "change-only" (only cards whose values
+	// changed since they were last sent)
+	TCPUpdateMode string `yaml:"tcp_update_mode,omitempty" json:"tcpUpdateMode"`
+	// ReaddressPollMs is the poll interval of the re-addressing workflow
+	ReaddressPollMs int `yaml:"readdress_poll_ms,omitempty" json:"readdressPollMs"`
+	// HeartbeatURL is the management endpoint receiving device heartbeats ("" = disabled)
+	HeartbeatURL string `yaml:"heartbeat_url,omitempty" json:"heartbeatUrl"`
+	// OTLPEndpoint is the OTLP/HTTP collector receiving traces, e.g. http://collector:4318
+	// ("" = use OTEL_EXPORTER_OTLP_ENDPOINT; tracing is off if neither is set)
+	OTLPEndpoint string `yaml:"otlp_endpoint,omitempty" json:"otlpEndpoint"`
+	// HeartbeatIntervalSec is the interval between two heartbeats
+	HeartbeatIntervalSec int `yaml:"heartbeat_interval_sec,omitempty" json:"heartbeatIntervalSec"`
+	// OptimisticWrites shows queued DO/AO values in the card state before the write is confirmed by a read
+	OptimisticWrites bool `yaml:"optimistic_writes,omitempty" json:"optimisticWrites"`
+	// ModbusTrafficLog is the file every Modbus request/response pair is appended to ("" = disabled)
+	ModbusTrafficLog string `yaml:"modbus_traffic_log,omitempty" json:"modbusTrafficLog"`
+	// ModbusTrafficLogMaxKB is the size at which the Modbus traffic log is rotated
+	ModbusTrafficLogMaxKB int `yaml:"modbus_traffic_log_max_kb,omitempty" json:"modbusTrafficLogMaxKb"`
+	// ModbusTrafficLogFiles is the number of Modbus traffic log files kept, including the current one
+	ModbusTrafficLogFiles int `yaml:"modbus_traffic_log_files,omitempty" json:"modbusTrafficLogFiles"`
+	// RelayWearLimit is the number of DO transitions after which a relay is reported worn
+	RelayWearLimit int `yaml:"relay_wear_limit,omitempty" json:"relayWearLimit"`
+	// AORuntimeThreshold is the value in raw units (value * 1000) above the bottom of its range (0 V, 4 mA)
+	// above which an AO counts as running
+	AORuntimeThreshold int `yaml:"ao_runtime_threshold,omitempty" json:"aoRuntimeThreshold"`
+	// AIStatsResetTime is the local time ("HH:MM") the daily AI statistics start over
+	AIStatsResetTime string `yaml:"ai_stats_reset_time,omitempty" json:"aiStatsResetTime"`
+	// FailedCardRetryMaxMs is the longest interval between two reads of a card whose reads keep failing
+	FailedCardRetryMaxMs int `yaml:"failed_card_retry_max_ms,omitempty" json:"failedCardRetryMaxMs"`
+	// CycleBudgetMs is the read-write cycle duration above which a cycle-over-budget event is emitted
+	CycleBudgetMs int `yaml:"cycle_budget_ms,omitempty" json:"cycleBudgetMs"`
+	// EventLogSeverity is the minimum severity of the events written to the service log
+	EventLogSeverity string `yaml:"event_log_severity,omitempty" json:"eventLogSeverity"`
+	// TCPEventSeverity is the minimum severity of the events sent to the TCP client
+	TCPEventSeverity string `yaml:"tcp_event_severity,omitempty" json:"tcpEventSeverity"`
+	// TCPSendQueueSize is the number of messages queued for a TCP client that doesn't keep up
+	TCPSendQueueSize int `yaml:"tcp_send_queue_size,omitempty" json:"tcpSendQueueSize"`
+	// TCPSlowClientPolicy is what happens when the send queue of a TCP client is full: "disconnect" or
+	// "drop-oldest" (drop the oldest queued card update)
+	TCPSlowClientPolicy string `yaml:"tcp_slow_client_policy,omitempty" json:"tcpSlowClientPolicy"`
+	// TCPSessionGraceMs is how long the session of a disconnected TCP client can be resumed before its
+	// outputs go to safe state (0 = safe state right away)
+	TCPSessionGraceMs int `yaml:"tcp_session_grace_ms,omitempty" json:"tcpSessionGraceMs"`
+	// JournalMaxKB is the size at which the event journal is rotated
+	JournalMaxKB int `yaml:"journal_max_kb,omitempty" json:"journalMaxKb"`
+	// JournalFiles is the number of event journal files kept, including the current one
+	JournalFiles int `yaml:"journal_files,omitempty" json:"journalFiles"`
+	// ConfigHistoryVersions is the number of configuration versions kept for rollback
+	ConfigHistoryVersions int `yaml:"config_history_versions,omitempty" json:"configHistoryVersions"`
+	// IdempotencyWindowSec is how long the responses of HTTP writes with an Idempotency-Key are kept
+	IdempotencyWindowSec int `yaml:"idempotency_window_sec,omitempty" json:"idempotencyWindowSec"`
+}
+
+// DefaultSettings returns the built-in setting values
+func DefaultSettings() Settings {
+	return Settings{
+		HTTPPort:              9080,
+		TCPPort:               9081,
+		SerialPort:            "/dev/ttyS7",
+		MinSlaveID:            1,
+		MaxSlaveID:            5,
+		ModbusTimeoutMs:       200,
+		CycleDelayMs:          10,
+		IdleCycleDelayMs:      1000,
+		OperationDelayMs:      2,
+		TCPUpdateIntervalMs:   500,
+		TCPUpdateMode:         TCPUpdatePeriodic,
+		StartupOutputPolicy:   StartupOutputsUntouched,
+		ReaddressPollMs:       500,
+		HeartbeatIntervalSec:  60,
+		RelayWearLimit:        100000,
+		AORuntimeThreshold:    100,
+		AIStatsResetTime:      "00:00",
+		FailedCardRetryMaxMs:  5000,
+		CycleBudgetMs:         500,
+		EventLogSeverity:      "info",
+		TCPEventSeverity:      "info",
+		TCPSendQueueSize:      256,
+		TCPSlowClientPolicy:   SlowClientDisconnect,
+		ModbusTrafficLogMaxKB: 10240,
+		ModbusTrafficLogFiles: 2,
+		JournalMaxKB:          1024,
+		JournalFiles:          5,
+		ConfigHistoryVersions: 20,
+		IdempotencyWindowSec:  600,
+	}
+}
+
+// GetSettings returns the effective settings: defaults, overridden by config.yaml, the active profile,
+// the environment and command line flags, in that order
+func GetSettings() Settings {
+	return settingsOf(GetConfig())
+}
+
+// settingsOf returns the effective settings of the given config
+func settingsOf(cfg Config) Settings {
+	s := DefaultSettings()
+	mergeSettings(&s, cfg.Settings)
+	if profile, ok := cfg.Profiles[ActiveProfile()]; ok {
+		mergeSettings(&s, profile)
+	}
+	applySettingsEnv(&s)
+
+	settingsFlagsMu.RLock()
+	defer settingsFlagsMu.RUnlock()
+	v := reflect.ValueOf(&s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if value, ok := settingsFlags[settingName(v.Type().Field(i))]; ok {
+			// Flag values were checked when the flags were parsed
+			_ = setSettingField(v.Field(i), value)
+		}
+	}
+	return s
+}
+
+// ActiveProfile returns the name of the selected config profile: the -profile flag, or else the
+// CM_UTILS_PROFILE environment variable ("" = no profile)
+func ActiveProfile() string {
+	settingsFlagsMu.RLock()
+	profile := profileFlag
+	settingsFlagsMu.RUnlock()
+	if profile != "" {
+		return profile
+	}
+	profile, _ = util.Lookup(profileEnv)
+	return profile
+}
+
+// SettingEnvName returns the environment variable overriding the setting with the given YAML name
+func SettingEnvName(name string) string {
+	return settingsEnvPrefix + strings.ToUpper(name)
+}
+
+// Duration helpers
+
+func (s Settings) ModbusTimeout() time.Duration {
+	return time.Duration(s.ModbusTimeoutMs) * time.Millisecond
+}
+
+// ModbusWriteTimeout returns the response timeout of writes, falling back to the Modbus timeout
+func (s Settings) ModbusWriteTimeout() time.Duration {
+	if s.ModbusWriteTimeoutMs <= 0 {
+		return s.ModbusTimeout()
+	}
+	return time.Duration(s.ModbusWriteTimeoutMs) * time.Millisecond
+}
+
+func (s Settings) CycleDelay() time.Duration {
+	return time.Duration(s.CycleDelayMs) * time.Millisecond
+}
+
+func (s Settings) IdleCycleDelay() time.Duration {
+	return time.Duration(s.IdleCycleDelayMs) * time.Millisecond
+}
+
+func (s Settings) FailedCardRetryMax() time.Duration {
+	return time.Duration(s.FailedCardRetryMaxMs) * time.Millisecond
+}
+
+func (s Settings) CycleBudget() time.Duration {
+	return time.Duration(s.CycleBudgetMs) * time.Millisecond
+}
+
+// AIStatsReset returns the time after midnight the daily AI statistics start over
+func (s Settings) AIStatsReset() time.Duration {
+	t, err := time.Parse("15:04", s.AIStatsResetTime)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// JournalMaxBytes returns the rotation size of the event journal
+func (s Settings) JournalMaxBytes() int64 {
+	return int64(s.JournalMaxKB) * 1024
+}
+
+// ModbusTrafficLogMaxBytes returns the rotation size of the Modbus traffic log
+func (s Settings) ModbusTrafficLogMaxBytes() int64 {
+	return int64(s.ModbusTrafficLogMaxKB) * 1024
+}
+
+func (s Settings) OperationDelay() time.Duration {
+	return time.Duration(s.OperationDelayMs) * time.Millisecond
+}
+
+func (s Settings) TCPUpdateInterval() time.Duration {
+	return time.Duration(s.TCPUpdateIntervalMs) * time.Millisecond
+}
+
+func (s Settings) TCPSessionGrace() time.Duration {
+	return time.Duration(s.TCPSessionGraceMs) * time.Millisecond
+}
+
+// ProbeTimeout returns the discovery probe timeout, falling back to the Modbus timeout
+func (s Settings) ProbeTimeout() time.Duration {
+	if s.ProbeTimeoutMs <= 0 {
+		return s.ModbusTimeout()
+	}
+	return time.Duration(s.ProbeTimeoutMs) * time.Millisecond
+}
+
+func (s Settings) ReaddressPoll() time.Duration {
+	return time.Duration(s.ReaddressPollMs) * time.Millisecond
+}
+
+func (s Settings) HeartbeatInterval() time.Duration {
+	return time.Duration(s.HeartbeatIntervalSec) * time.Second
+}
+
+func (s Settings) IdempotencyWindow() time.Duration {
+	return time.Duration(s.IdempotencyWindowSec) * time.Second
+}
+
+// mergeSettings copies every non-zero field of src into dst
+func mergeSettings(dst *Settings, src Settings) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src)
+	for i := 0; i < sv.NumField(); i++ {
+		if !sv.Field(i).IsZero() {
+			dv.Field(i).Set(sv.Field(i))
+		}
+	}
+}
+
+// applySettingsEnv applies CM_UTILS_<NAME> overrides from the environment or .env.local;
+// invalid values are logged and ignored
+func applySettingsEnv(s *Settings) {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		env := SettingEnvName(settingName(v.Type().Field(i)))
+		value, ok := util.Lookup(env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setSettingField(v.Field(i), value); err != nil {
+			log.Printf("Config: ignoring %s=%q: %v", env, value, err)
+		}
+	}
+}
+
+// setSettingField parses a setting from its text form. Lists are comma-separated.
+func setSettingField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("not a non-negative integer")
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+// settingName returns the YAML name of a Settings field
+func settingName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	return name
+}
+
+var (
+	settingsFlagsMu sync.RWMutex
+	// settingsFlags are the settings given on the command line, by setting name
+	settingsFlags = make(map[string]string)
+	// profileFlag is the config profile given on the command line
+	profileFlag string
+)
+
+// settingFlag is a command line flag overriding one setting
+type settingFlag struct {
+	name  string
+	field reflect.StructField
+}
+
+func (f *settingFlag) String() string { return "" }
+
+func (f *settingFlag) IsBoolFlag() bool { return f.field.Type.Kind() == reflect.Bool }
+
+func (f *settingFlag) Set(value string) error {
+	var s Settings
+	if err := setSettingField(reflect.ValueOf(&s).Elem().FieldByIndex(f.field.Index), value); err != nil {
+		return err
+	}
+	settingsFlagsMu.Lock()
+	defer settingsFlagsMu.Unlock()
+	settingsFlags[f.name] = value
+	return nil
+}
+
+// RegisterSettingsFlags adds a flag per setting to fs, named after the setting with dashes
+// (e.g. -max-slave-id 20, -discovery-ports /dev/ttyS7,/dev/ttyS8), and the -profile flag selecting the
+// config profile. Flags override every other source.
+func RegisterSettingsFlags(fs *flag.FlagSet) {
+	fs.Func("profile", fmt.Sprintf("config profile to apply (env %s)", profileEnv), func(value string) error {
+		settingsFlagsMu.Lock()
+		defer settingsFlagsMu.Unlock()
+		profileFlag = value
+		return nil
+	})
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		name := settingName(t.Field(i))
+		fs.Var(&settingFlag{name: name, field: t.Field(i)}, strings.ReplaceAll(name, "_", "-"),
+			fmt.Sprintf("overrides settings.%s (env %s)", name, SettingEnvName(name)))
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestGetSettings_Overrides(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+	t.Setenv("CM_UTILS_TCP_PORT", "9091")
+	t.Setenv("CM_UTILS_MAX_SLAVE_ID", "bogus")
+
+	if err := Update(func(c *Config) {
+		c.Settings = Settings{TCPPort: 7000, SerialPort: "/dev/ttyUSB0", MaxSlaveID: 8}
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	defer Update(func(c *Config) { c.Settings = Settings{} })
+
+	s := GetSettings()
+	if s.TCPPort != 9091 {
+		t.Errorf("Expected env override 9091, got %d", s.TCPPort)
+	}
+	if s.SerialPort != "/dev/ttyUSB0" || s.MaxSlaveID != 8 {
+		t.Errorf("Expected file overrides, got %+v", s)
+	}
+	if s.HTTPPort != DefaultSettings().HTTPPort || s.ModbusTimeoutMs != DefaultSettings().ModbusTimeoutMs {
+		t.Errorf("Expected defaults for unset settings, got %+v", s)
+	}
+}
+
+func TestParse_Settings(t *testing.T) {
+	c, err := Parse([]byte("settings:\n  http_port: 8080\n  modbus_timeout_ms: 300\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if c.Settings.HTTPPort != 8080 || c.Settings.ModbusTimeout().Milliseconds() != 300 {
+		t.Errorf("Unexpected settings %+v", c.Settings)
+	}
+}
+
+func TestRegisterSettingsFlags(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+	t.Setenv("CM_UTILS_MAX_SLAVE_ID", "8")
+	defer func() { settingsFlags = make(map[string]string) }()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterSettingsFlags(fs)
+	if err := fs.Parse([]string{"-max-slave-id", "20", "-discovery-ports", "/dev/ttyS7, /dev/ttyS8", "-start-cycle-without-cards"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	s := GetSettings()
+	if s.MaxSlaveID != 20 {
+		t.Errorf("Expected flag to override env, got max_slave_id %d", s.MaxSlaveID)
+	}
+	if len(s.DiscoveryPorts) != 2 || s.DiscoveryPorts[1] != "/dev/ttyS8" {
+		t.Errorf("Unexpected discovery ports %v", s.DiscoveryPorts)
+	}
+	if !s.StartCycleWithoutCards {
+		t.Error("Expected start_cycle_without_cards to be set")
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	RegisterSettingsFlags(fs)
+	if err := fs.Parse([]string{"-min-slave-id", "ten"}); err == nil {
+		t.Error("Expected an invalid flag value to be rejected")
+	}
+}
+
+func TestGetSettings_Profile(t *testing.T) {
+	t.Setenv("CM_UTILS_CONFIG_DIR", t.TempDir())
+	t.Setenv("CM_UTILS_PROFILE", "lab")
+	defer func() { profileFlag = "" }()
+
+	if err := Update(func(c *Config) {
+		c.Settings = Settings{TCPPort: 7000, MaxSlaveID: 8}
+		c.Profiles = map[string]Settings{
+			"lab":        {MaxSlaveID: 30, HeartbeatURL: "http://lab.example.com/hb"},
+			"production": {TCPPort: 7100},
+		}
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	defer Update(func(c *Config) {
+		c.Settings = Settings{}
+		c.Profiles = nil
+	})
+
+	if s := GetSettings(); s.MaxSlaveID != 30 || s.HeartbeatURL != "http://lab.example.com/hb" || s.TCPPort != 7000 {
+		t.Errorf("Expected the lab profile over the settings section, got %+v", s)
+	}
+
+	// The flag takes precedence over the environment
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterSettingsFlags(fs)
+	if err := fs.Parse([]string{"-profile", "production"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if s := GetSettings(); ActiveProfile() != "production" || s.TCPPort != 7100 || s.MaxSlaveID != 8 {
+		t.Errorf("Expected the production profile, got %q %+v", ActiveProfile(), s)
+	}
+}
+
+func TestModbusWriteTimeout(t *testing.T) {
+	s := DefaultSettings()
+	if s.ModbusWriteTimeout() != s.ModbusTimeout() {
+		t.Errorf("Expected the write timeout to default to the Modbus timeout, got %v", s.ModbusWriteTimeout())
+	}
+	s.ModbusWriteTimeoutMs = 1000
+	if s.ModbusWriteTimeout().Milliseconds() != 1000 {
+		t.Errorf("Expected write timeout 1000ms, got %v", s.ModbusWriteTimeout())
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"jaspermate-utils/src/server/util"
+)
+
+// Storage reports where the config is persisted
+type Storage struct {
+	Path string `json:"path"`
+	// Persistent is false while the config is kept in the working directory's tmp/, which is lost when the
+	// service is redeployed (new DeviceID, settings reset)
+	Persistent bool `json:"persistent"`
+	// ReadOnly lists the persistent directories that exist but can't be written
+	ReadOnly []string `json:"readOnly,omitempty"`
+	Warning  string   `json:"warning,omitempty"`
+}
+
+var (
+	storageMu   sync.Mutex
+	lastStorage Storage
+	// resolved is the storage picked by resolveStorage when the config was loaded; the directories are
+	// probed once rather than on every save, so the data of the service stays in one directory
+	resolved      Storage
+	storageProbed bool
+)
+
+// GetStorage returns where the config was last loaded from or saved to
+func GetStorage() Storage {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	return lastStorage
+}
+
+// configDirs returns the persistent directories tried for config.yaml in order: the production directory,
+// then the directories in CM_UTILS_CONFIG_FALLBACK_DIRS
+func configDirs() []string {
+	dirs := []string{prodConfigDir}
+	for _, dir := range strings.Split(util.GetString("CM_UTILS_CONFIG_FALLBACK_DIRS", ""), ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// resolveStorage picks the first writable directory of dirs. The production directory (dirs[0]) is only
+// used if it exists; fallback directories are created. Without a writable directory the config goes to
+// tmp/ with a warning.
+func resolveStorage(dirs []string) Storage {
+	var s Storage
+	for i, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			if i == 0 || os.MkdirAll(dir, 0755) != nil {
+				continue
+			}
+		}
+		if !writable(dir) {
+			s.ReadOnly = append(s.ReadOnly, dir)
+			continue
+		}
+		s.Path = filepath.Join(dir, configFileName)
+		s.Persistent = true
+		if len(s.ReadOnly) > 0 {
+			s.Warning = fmt.Sprintf("%s is read-only, using %s", strings.Join(s.ReadOnly, ", "), dir)
+		}
+		return s
+	}
+
+	s.Path = filepath.Join("tmp", configFileName)
+	if len(s.ReadOnly) > 0 {
+		s.Warning = fmt.Sprintf("%s is read-only; the config is kept in %s and is lost on redeploy", strings.Join(s.ReadOnly, ", "), s.Path)
+	} else {
+		s.Warning = fmt.Sprintf("no persistent config directory; the config is kept in %s and is lost on redeploy", s.Path)
+	}
+	return s
+}
+
+func writable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".write_test")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// resolvedStorage returns the storage resolved from the config directories, probing them on first use
+// after the config was (re)loaded or reset
+func resolvedStorage() Storage {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	if !storageProbed {
+		resolved = resolveStorage(configDirs())
+		storageProbed = true
+	}
+	setStorageLocked(resolved)
+	return resolved
+}
+
+// forgetStorage makes the next resolvedStorage probe the config directories again
+func forgetStorage() {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	storageProbed = false
+}
+
+// setStorage records where the config is persisted, logging a new warning once
+func setStorage(s Storage) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	setStorageLocked(s)
+}
+
+func setStorageLocked(s Storage) {
+	if s.Warning != "" && s.Warning != lastStorage.Warning {
+		log.Printf("Config: WARNING: %s", s.Warning)
+	}
+	lastStorage = s
+}
+
+// readOnlyConfig returns the config of the first read-only directory that has one, so a device whose
+// production directory became read-only keeps its DeviceID and settings in the fallback location
+func readOnlyConfig(s Storage) ([]byte, string) {
+	for _, dir := range s.ReadOnly {
+		path := filepath.Join(dir, configFileName)
+		if data, err := os.ReadFile(path); err == nil {
+			return data, path
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveStorage(t *testing.T) {
+	base := t.TempDir()
+	prod := filepath.Join(base, "prod")
+	fallback := filepath.Join(base, "data", "cm-utils")
+
+	// A missing production directory is not created, fallback directories are
+	s := resolveStorage([]string{prod, fallback})
+	if s.Path != filepath.Join(fallback, configFileName) || !s.Persistent || s.Warning != "" {
+		t.Errorf("Expected the fallback directory without warning, got %+v", s)
+	}
+	if _, err := os.Stat(prod); !os.IsNotExist(err) {
+		t.Errorf("Expected the production directory not to be created")
+	}
+
+	s = resolveStorage([]string{prod})
+	if s.Path != filepath.Join("tmp", configFileName) || s.Persistent || s.Warning == "" {
+		t.Errorf("Expected tmp/ with a warning, got %+v", s)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("read-only directories are writable as root")
+	}
+	os.Mkdir(prod, 0755)
+	os.WriteFile(filepath.Join(prod, configFileName), []byte("device_id: kept\n"), 0644)
+	os.Chmod(prod, 0555)
+	defer os.Chmod(prod, 0755)
+	s = resolveStorage([]string{prod, fallback})
+	if s.Path != filepath.Join(fallback, configFileName) || len(s.ReadOnly) != 1 || !strings.Contains(s.Warning, "read-only") {
+		t.Errorf("Expected the fallback directory with a read-only warning, got %+v", s)
+	}
+}
+
+func TestReadOnlyConfig(t *testing.T) {
+	empty, dir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(dir, configFileName), []byte("device_id: kept\n"), 0644)
+
+	data, from := readOnlyConfig(Storage{ReadOnly: []string{empty, dir}})
+	if string(data) != "device_id: kept\n" || from != filepath.Join(dir, configFileName) {
+		t.Errorf("Expected the config of the second directory, got %q from %q", data, from)
+	}
+	if data, _ := readOnlyConfig(Storage{ReadOnly: []string{empty}}); data != nil {
+		t.Errorf("Expected no config, got %q", data)
+	}
+}
+
+func TestStorageResolvedOnce(t *testing.T) {
+	if _, err := os.Stat(prodConfigDir); err == nil {
+		t.Skip(prodConfigDir + " exists")
+	}
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv("CM_UTILS_CONFIG_DIR", "")
+	t.Setenv("CM_UTILS_CONFIG_FALLBACK_DIRS", first)
+	Reset()
+	t.Cleanup(Reset)
+
+	if DataDir() != first {
+		t.Fatalf("Expected %s, got %s", first, DataDir())
+	}
+	// Saves don't probe the directories again, so the data stays where the config was loaded from
+	t.Setenv("CM_UTILS_CONFIG_FALLBACK_DIRS", second)
+	if DataDir() != first {
+		t.Errorf("Expected the resolved directory kept, got %s", DataDir())
+	}
+	if entries, _ := os.ReadDir(first); len(entries) != 0 {
+		t.Errorf("Expected no probe files left, got %v", entries)
+	}
+	Reset()
+	if DataDir() != second {
+		t.Errorf("Expected the directories probed again after Reset, got %s", DataDir())
+	}
+}
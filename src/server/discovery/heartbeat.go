@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server"
+	"jaspermate-utils/src/server/config"
+)
+
+// heartbeatMinBackoff is the first retry delay after a failed heartbeat; it doubles up to the interval
+const heartbeatMinBackoff = 5 * time.Second
+
+// CardSummary is the short description of an IO card included in a heartbeat
+type CardSummary struct {
+	ID           string `json:"id"`
+	Module       string `json:"module"`
+	PortPath     string `json:"portPath"`
+	SlaveID      byte   `json:"slaveId"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+	Online       bool   `json:"online"`
+}
+
+// Heartbeat is the registration message posted to the management endpoint
+type Heartbeat struct {
+	DeviceID    string        `json:"deviceId"`
+	Type        string        `json:"type"`
+	Version     string        `json:"version"`
+	Time        time.Time     `json:"time"`
+	IPAddresses []string      `json:"ipAddresses"`
+	Cards       []CardSummary `json:"cards"`
+}
+
+// HeartbeatStatus reports the last heartbeat attempts
+type HeartbeatStatus struct {
+	URL         string    `json:"url"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	Failures    int       `json:"failures"`
+}
+
+// HeartbeatAgent periodically registers the device with a central management endpoint for fleet inventory.
+// Failed heartbeats are retried with exponential backoff, capped at the interval.
+type HeartbeatAgent struct {
+	url      string
+	interval time.Duration
+	version  string
+	cards    func() []CardSummary
+	client   *http.Client
+
+	mu     sync.Mutex
+	status HeartbeatStatus
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewHeartbeatAgent creates an agent posting to url every interval. cards returns the current card summary.
+func NewHeartbeatAgent(url string, interval time.Duration, version string, cards func() []CardSummary) *HeartbeatAgent {
+	return &HeartbeatAgent{
+		url:      url,
+		interval: interval,
+		version:  version,
+		cards:    cards,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		status:   HeartbeatStatus{URL: url},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start sends the first heartbeat immediately and keeps sending them until Stop is called
+func (a *HeartbeatAgent) Start() {
+	go a.run()
+}
+
+// Stop ends the heartbeat loop
+func (a *HeartbeatAgent) Stop() {
+	a.once.Do(func() { close(a.stop) })
+}
+
+// Status returns the result of the last heartbeats
+func (a *HeartbeatAgent) Status() HeartbeatStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.status
+}
+
+func (a *HeartbeatAgent) run() {
+	backoff := heartbeatMinBackoff
+	for {
+		wait := a.interval
+		if err := a.send(); err != nil {
+			log.Printf("heartbeat: %v (retrying in %s)", err, backoff)
+			wait = backoff
+			if backoff *= 2; backoff > a.interval {
+				backoff = a.interval
+			}
+		} else {
+			backoff = heartbeatMinBackoff
+		}
+
+		select {
+		case <-a.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send posts one heartbeat and records the result
+func (a *HeartbeatAgent) send() error {
+	hb := Heartbeat{
+		DeviceID:    config.GetDeviceID(),
+		Type:        GetDeviceType(),
+		Version:     a.version,
+		Time:        time.Now(),
+		IPAddresses: server.GetIPAddresses(),
+		Cards:       a.cards(),
+	}
+	err := a.post(hb)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.LastAttempt = hb.Time
+	if err != nil {
+		a.status.LastError = err.Error()
+		a.status.Failures++
+		return err
+	}
+	a.status.LastSuccess = hb.Time
+	a.status.LastError = ""
+	a.status.Failures = 0
+	return nil
+}
+
+func (a *HeartbeatAgent) post(hb Heartbeat) error {
+	body, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("management endpoint returned %s", resp.Status)
+	}
+	return nil
+}
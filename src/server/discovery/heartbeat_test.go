@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatAgent_Send(t *testing.T) {
+	received := make(chan Heartbeat, 1)
+	var fail atomic.Bool
+	fail.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var hb Heartbeat
+		if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+			t.Errorf("Failed to decode heartbeat: %v", err)
+		}
+		received <- hb
+	}))
+	defer srv.Close()
+
+	cards := func() []CardSummary {
+		return []CardSummary{{ID: "1", Module: "IO4040", PortPath: "/dev/ttyS7", SlaveID: 1, Online: true}}
+	}
+	a := NewHeartbeatAgent(srv.URL, time.Minute, "1.2.3", cards)
+
+	if err := a.send(); err == nil {
+		t.Fatal("Expected an error for a 503 response")
+	}
+	if st := a.Status(); st.Failures != 1 || st.LastError == "" {
+		t.Errorf("Expected the failure to be recorded, got %+v", st)
+	}
+
+	fail.Store(false)
+	if err := a.send(); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	hb := <-received
+	if hb.Version != "1.2.3" || len(hb.Cards) != 1 || hb.Cards[0].Module != "IO4040" || hb.Type == "" {
+		t.Errorf("Unexpected heartbeat %+v", hb)
+	}
+	if st := a.Status(); st.Failures != 0 || st.LastError != "" || st.LastSuccess.IsZero() {
+		t.Errorf("Expected the success to reset the status, got %+v", st)
+	}
+}
@@ -0,0 +1,11 @@
+package discovery
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestMain(m *testing.M) {
+	configtest.Main(m)
+}
@@ -0,0 +1,918 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.28.3
+// source: io.proto
+
+// IO control API of JasperMate Utils. Regenerate io.pb.go and io_grpc.pb.go after changes:
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative io.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetCardsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCardsRequest) Reset() {
+	*x = GetCardsRequest{}
+	mi := &file_io_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCardsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCardsRequest) ProtoMessage() {}
+
+func (x *GetCardsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCardsRequest.ProtoReflect.Descriptor instead.
+func (*GetCardsRequest) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{0}
+}
+
+type GetCardsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cards         []*Card                `protobuf:"bytes,1,rep,name=cards,proto3" json:"cards,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCardsResponse) Reset() {
+	*x = GetCardsResponse{}
+	mi := &file_io_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCardsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCardsResponse) ProtoMessage() {}
+
+func (x *GetCardsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCardsResponse.ProtoReflect.Descriptor instead.
+func (*GetCardsResponse) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetCardsResponse) GetCards() []*Card {
+	if x != nil {
+		return x.Cards
+	}
+	return nil
+}
+
+type StreamCardsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Interval between two updates in milliseconds (0 = 500, at least 50)
+	IntervalMs    uint32 `protobuf:"varint,1,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamCardsRequest) Reset() {
+	*x = StreamCardsRequest{}
+	mi := &file_io_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamCardsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamCardsRequest) ProtoMessage() {}
+
+func (x *StreamCardsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamCardsRequest.ProtoReflect.Descriptor instead.
+func (*StreamCardsRequest) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StreamCardsRequest) GetIntervalMs() uint32 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+type CardUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Increases by one with every update of the stream, starting at 1
+	Seq           uint64  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Cards         []*Card `protobuf:"bytes,2,rep,name=cards,proto3" json:"cards,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CardUpdate) Reset() {
+	*x = CardUpdate{}
+	mi := &file_io_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CardUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CardUpdate) ProtoMessage() {}
+
+func (x *CardUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CardUpdate.ProtoReflect.Descriptor instead.
+func (*CardUpdate) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CardUpdate) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *CardUpdate) GetCards() []*Card {
+	if x != nil {
+		return x.Cards
+	}
+	return nil
+}
+
+type Card struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	PortPath string                 `protobuf:"bytes,2,opt,name=port_path,json=portPath,proto3" json:"port_path,omitempty"`
+	SlaveId  uint32                 `protobuf:"varint,3,opt,name=slave_id,json=slaveId,proto3" json:"slave_id,omitempty"`
+	Module   string                 `protobuf:"bytes,4,opt,name=module,proto3" json:"module,omitempty"`
+	// Name of the driver polling the card
+	Driver string     `protobuf:"bytes,5,opt,name=driver,proto3" json:"driver,omitempty"`
+	Last   *CardState `protobuf:"bytes,6,opt,name=last,proto3" json:"last,omitempty"`
+	// Set while more than one physical card answers on the slave ID; writes are rejected
+	Conflict      string `protobuf:"bytes,7,opt,name=conflict,proto3" json:"conflict,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Card) Reset() {
+	*x = Card{}
+	mi := &file_io_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Card) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Card) ProtoMessage() {}
+
+func (x *Card) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Card.ProtoReflect.Descriptor instead.
+func (*Card) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Card) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Card) GetPortPath() string {
+	if x != nil {
+		return x.PortPath
+	}
+	return ""
+}
+
+func (x *Card) GetSlaveId() uint32 {
+	if x != nil {
+		return x.SlaveId
+	}
+	return 0
+}
+
+func (x *Card) GetModule() string {
+	if x != nil {
+		return x.Module
+	}
+	return ""
+}
+
+func (x *Card) GetDriver() string {
+	if x != nil {
+		return x.Driver
+	}
+	return ""
+}
+
+func (x *Card) GetLast() *CardState {
+	if x != nil {
+		return x.Last
+	}
+	return nil
+}
+
+func (x *Card) GetConflict() string {
+	if x != nil {
+		return x.Conflict
+	}
+	return ""
+}
+
+type CardState struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Di        []bool                 `protobuf:"varint,2,rep,packed,name=di,proto3" json:"di,omitempty"`
+	Do        []bool                 `protobuf:"varint,3,rep,packed,name=do,proto3" json:"do,omitempty"`
+	Ai        []float32              `protobuf:"fixed32,4,rep,packed,name=ai,proto3" json:"ai,omitempty"`
+	Ao        []float32              `protobuf:"fixed32,5,rep,packed,name=ao,proto3" json:"ao,omitempty"`
+	// AO output types, "0-10V" or "4-20mA"
+	AoType       []string `protobuf:"bytes,6,rep,name=ao_type,json=aoType,proto3" json:"ao_type,omitempty"`
+	SerialNumber string   `protobuf:"bytes,7,opt,name=serial_number,json=serialNumber,proto3" json:"serial_number,omitempty"`
+	BaudRate     uint32   `protobuf:"varint,8,opt,name=baud_rate,json=baudRate,proto3" json:"baud_rate,omitempty"`
+	// Error of the last read ("" = success)
+	Error   string          `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	Quality *ChannelQuality `protobuf:"bytes,10,opt,name=quality,proto3" json:"quality,omitempty"`
+	// Time of the last successful read
+	LastGood      *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=last_good,json=lastGood,proto3" json:"last_good,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CardState) Reset() {
+	*x = CardState{}
+	mi := &file_io_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CardState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CardState) ProtoMessage() {}
+
+func (x *CardState) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CardState.ProtoReflect.Descriptor instead.
+func (*CardState) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CardState) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CardState) GetDi() []bool {
+	if x != nil {
+		return x.Di
+	}
+	return nil
+}
+
+func (x *CardState) GetDo() []bool {
+	if x != nil {
+		return x.Do
+	}
+	return nil
+}
+
+func (x *CardState) GetAi() []float32 {
+	if x != nil {
+		return x.Ai
+	}
+	return nil
+}
+
+func (x *CardState) GetAo() []float32 {
+	if x != nil {
+		return x.Ao
+	}
+	return nil
+}
+
+func (x *CardState) GetAoType() []string {
+	if x != nil {
+		return x.AoType
+	}
+	return nil
+}
+
+func (x *CardState) GetSerialNumber() string {
+	if x != nil {
+		return x.SerialNumber
+	}
+	return ""
+}
+
+func (x *CardState) GetBaudRate() uint32 {
+	if x != nil {
+		return x.BaudRate
+	}
+	return 0
+}
+
+func (x *CardState) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CardState) GetQuality() *ChannelQuality {
+	if x != nil {
+		return x.Quality
+	}
+	return nil
+}
+
+func (x *CardState) GetLastGood() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastGood
+	}
+	return nil
+}
+
+// Quality of each channel's value: "good", "stale", "error", "forced", "simulated" or "disabled"
+type ChannelQuality struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Di            []string               `protobuf:"bytes,1,rep,name=di,proto3" json:"di,omitempty"`
+	Do            []string               `protobuf:"bytes,2,rep,name=do,proto3" json:"do,omitempty"`
+	Ai            []string               `protobuf:"bytes,3,rep,name=ai,proto3" json:"ai,omitempty"`
+	Ao            []string               `protobuf:"bytes,4,rep,name=ao,proto3" json:"ao,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChannelQuality) Reset() {
+	*x = ChannelQuality{}
+	mi := &file_io_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChannelQuality) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChannelQuality) ProtoMessage() {}
+
+func (x *ChannelQuality) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChannelQuality.ProtoReflect.Descriptor instead.
+func (*ChannelQuality) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ChannelQuality) GetDi() []string {
+	if x != nil {
+		return x.Di
+	}
+	return nil
+}
+
+func (x *ChannelQuality) GetDo() []string {
+	if x != nil {
+		return x.Do
+	}
+	return nil
+}
+
+func (x *ChannelQuality) GetAi() []string {
+	if x != nil {
+		return x.Ai
+	}
+	return nil
+}
+
+func (x *ChannelQuality) GetAo() []string {
+	if x != nil {
+		return x.Ao
+	}
+	return nil
+}
+
+type WriteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Commands      []*WriteCommand        `protobuf:"bytes,1,rep,name=commands,proto3" json:"commands,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRequest) Reset() {
+	*x = WriteRequest{}
+	mi := &file_io_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRequest) ProtoMessage() {}
+
+func (x *WriteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRequest.ProtoReflect.Descriptor instead.
+func (*WriteRequest) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WriteRequest) GetCommands() []*WriteCommand {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+type WriteCommand struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	CardId string                 `protobuf:"bytes,1,opt,name=card_id,json=cardId,proto3" json:"card_id,omitempty"`
+	Index  uint32                 `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	// Types that are valid to be assigned to Value:
+	//
+	//	*WriteCommand_DoState
+	//	*WriteCommand_AoValue
+	//	*WriteCommand_AoType
+	Value         isWriteCommand_Value `protobuf_oneof:"value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteCommand) Reset() {
+	*x = WriteCommand{}
+	mi := &file_io_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteCommand) ProtoMessage() {}
+
+func (x *WriteCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteCommand.ProtoReflect.Descriptor instead.
+func (*WriteCommand) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WriteCommand) GetCardId() string {
+	if x != nil {
+		return x.CardId
+	}
+	return ""
+}
+
+func (x *WriteCommand) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *WriteCommand) GetValue() isWriteCommand_Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *WriteCommand) GetDoState() bool {
+	if x != nil {
+		if x, ok := x.Value.(*WriteCommand_DoState); ok {
+			return x.DoState
+		}
+	}
+	return false
+}
+
+func (x *WriteCommand) GetAoValue() float32 {
+	if x != nil {
+		if x, ok := x.Value.(*WriteCommand_AoValue); ok {
+			return x.AoValue
+		}
+	}
+	return 0
+}
+
+func (x *WriteCommand) GetAoType() string {
+	if x != nil {
+		if x, ok := x.Value.(*WriteCommand_AoType); ok {
+			return x.AoType
+		}
+	}
+	return ""
+}
+
+type isWriteCommand_Value interface {
+	isWriteCommand_Value()
+}
+
+type WriteCommand_DoState struct {
+	// DO state
+	DoState bool `protobuf:"varint,3,opt,name=do_state,json=doState,proto3,oneof"`
+}
+
+type WriteCommand_AoValue struct {
+	// AO value in V or mA
+	AoValue float32 `protobuf:"fixed32,4,opt,name=ao_value,json=aoValue,proto3,oneof"`
+}
+
+type WriteCommand_AoType struct {
+	// AO output type, "0-10V" or "4-20mA"
+	AoType string `protobuf:"bytes,5,opt,name=ao_type,json=aoType,proto3,oneof"`
+}
+
+func (*WriteCommand_DoState) isWriteCommand_Value() {}
+
+func (*WriteCommand_AoValue) isWriteCommand_Value() {}
+
+func (*WriteCommand_AoType) isWriteCommand_Value() {}
+
+type WriteResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// True if every command succeeded
+	Ok            bool             `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`
+	Results       []*CommandResult `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteResponse) Reset() {
+	*x = WriteResponse{}
+	mi := &file_io_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteResponse) ProtoMessage() {}
+
+func (x *WriteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteResponse.ProtoReflect.Descriptor instead.
+func (*WriteResponse) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *WriteResponse) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *WriteResponse) GetResults() []*CommandResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type CommandResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Index uint32                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Ok    bool                   `protobuf:"varint,2,opt,name=ok,proto3" json:"ok,omitempty"`
+	// Error code of a failed command, as in the HTTP and TCP APIs (e.g. CARD_NOT_FOUND)
+	Code          string `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandResult) Reset() {
+	*x = CommandResult{}
+	mi := &file_io_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandResult) ProtoMessage() {}
+
+func (x *CommandResult) ProtoReflect() protoreflect.Message {
+	mi := &file_io_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandResult.ProtoReflect.Descriptor instead.
+func (*CommandResult) Descriptor() ([]byte, []int) {
+	return file_io_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CommandResult) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *CommandResult) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *CommandResult) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *CommandResult) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_io_proto protoreflect.FileDescriptor
+
+const file_io_proto_rawDesc = "" +
+	"\n" +
+	"\bio.proto\x12\x10jaspermate.io.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x11\n" +
+	"\x0fGetCardsRequest\"@\n" +
+	"\x10GetCardsResponse\x12,\n" +
+	"\x05cards\x18\x01 \x03(\v2\x16.jaspermate.io.v1.CardR\x05cards\"5\n" +
+	"\x12StreamCardsRequest\x12\x1f\n" +
+	"\vinterval_ms\x18\x01 \x01(\rR\n" +
+	"intervalMs\"L\n" +
+	"\n" +
+	"CardUpdate\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12,\n" +
+	"\x05cards\x18\x02 \x03(\v2\x16.jaspermate.io.v1.CardR\x05cards\"\xcb\x01\n" +
+	"\x04Card\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tport_path\x18\x02 \x01(\tR\bportPath\x12\x19\n" +
+	"\bslave_id\x18\x03 \x01(\rR\aslaveId\x12\x16\n" +
+	"\x06module\x18\x04 \x01(\tR\x06module\x12\x16\n" +
+	"\x06driver\x18\x05 \x01(\tR\x06driver\x12/\n" +
+	"\x04last\x18\x06 \x01(\v2\x1b.jaspermate.io.v1.CardStateR\x04last\x12\x1a\n" +
+	"\bconflict\x18\a \x01(\tR\bconflict\"\xeb\x02\n" +
+	"\tCardState\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x0e\n" +
+	"\x02di\x18\x02 \x03(\bR\x02di\x12\x0e\n" +
+	"\x02do\x18\x03 \x03(\bR\x02do\x12\x0e\n" +
+	"\x02ai\x18\x04 \x03(\x02R\x02ai\x12\x0e\n" +
+	"\x02ao\x18\x05 \x03(\x02R\x02ao\x12\x17\n" +
+	"\aao_type\x18\x06 \x03(\tR\x06aoType\x12#\n" +
+	"\rserial_number\x18\a \x01(\tR\fserialNumber\x12\x1b\n" +
+	"\tbaud_rate\x18\b \x01(\rR\bbaudRate\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\x12:\n" +
+	"\aquality\x18\n" +
+	" \x01(\v2 .jaspermate.io.v1.ChannelQualityR\aquality\x127\n" +
+	"\tlast_good\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\blastGood\"P\n" +
+	"\x0eChannelQuality\x12\x0e\n" +
+	"\x02di\x18\x01 \x03(\tR\x02di\x12\x0e\n" +
+	"\x02do\x18\x02 \x03(\tR\x02do\x12\x0e\n" +
+	"\x02ai\x18\x03 \x03(\tR\x02ai\x12\x0e\n" +
+	"\x02ao\x18\x04 \x03(\tR\x02ao\"J\n" +
+	"\fWriteRequest\x12:\n" +
+	"\bcommands\x18\x01 \x03(\v2\x1e.jaspermate.io.v1.WriteCommandR\bcommands\"\x9b\x01\n" +
+	"\fWriteCommand\x12\x17\n" +
+	"\acard_id\x18\x01 \x01(\tR\x06cardId\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\rR\x05index\x12\x1b\n" +
+	"\bdo_state\x18\x03 \x01(\bH\x00R\adoState\x12\x1b\n" +
+	"\bao_value\x18\x04 \x01(\x02H\x00R\aaoValue\x12\x19\n" +
+	"\aao_type\x18\x05 \x01(\tH\x00R\x06aoTypeB\a\n" +
+	"\x05value\"Z\n" +
+	"\rWriteResponse\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x129\n" +
+	"\aresults\x18\x02 \x03(\v2\x1f.jaspermate.io.v1.CommandResultR\aresults\"c\n" +
+	"\rCommandResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x12\x0e\n" +
+	"\x02ok\x18\x02 \x01(\bR\x02ok\x12\x12\n" +
+	"\x04code\x18\x03 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage2\xfd\x01\n" +
+	"\tIOService\x12Q\n" +
+	"\bGetCards\x12!.jaspermate.io.v1.GetCardsRequest\x1a\".jaspermate.io.v1.GetCardsResponse\x12S\n" +
+	"\vStreamCards\x12$.jaspermate.io.v1.StreamCardsRequest\x1a\x1c.jaspermate.io.v1.CardUpdate0\x01\x12H\n" +
+	"\x05Write\x12\x1e.jaspermate.io.v1.WriteRequest\x1a\x1f.jaspermate.io.v1.WriteResponseB%Z#jaspermate-utils/src/server/grpcapib\x06proto3"
+
+var (
+	file_io_proto_rawDescOnce sync.Once
+	file_io_proto_rawDescData []byte
+)
+
+func file_io_proto_rawDescGZIP() []byte {
+	file_io_proto_rawDescOnce.Do(func() {
+		file_io_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_io_proto_rawDesc), len(file_io_proto_rawDesc)))
+	})
+	return file_io_proto_rawDescData
+}
+
+var file_io_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_io_proto_goTypes = []any{
+	(*GetCardsRequest)(nil),       // 0: jaspermate.io.v1.GetCardsRequest
+	(*GetCardsResponse)(nil),      // 1: jaspermate.io.v1.GetCardsResponse
+	(*StreamCardsRequest)(nil),    // 2: jaspermate.io.v1.StreamCardsRequest
+	(*CardUpdate)(nil),            // 3: jaspermate.io.v1.CardUpdate
+	(*Card)(nil),                  // 4: jaspermate.io.v1.Card
+	(*CardState)(nil),             // 5: jaspermate.io.v1.CardState
+	(*ChannelQuality)(nil),        // 6: jaspermate.io.v1.ChannelQuality
+	(*WriteRequest)(nil),          // 7: jaspermate.io.v1.WriteRequest
+	(*WriteCommand)(nil),          // 8: jaspermate.io.v1.WriteCommand
+	(*WriteResponse)(nil),         // 9: jaspermate.io.v1.WriteResponse
+	(*CommandResult)(nil),         // 10: jaspermate.io.v1.CommandResult
+	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
+}
+var file_io_proto_depIdxs = []int32{
+	4,  // 0: jaspermate.io.v1.GetCardsResponse.cards:type_name -> jaspermate.io.v1.Card
+	4,  // 1: jaspermate.io.v1.CardUpdate.cards:type_name -> jaspermate.io.v1.Card
+	5,  // 2: jaspermate.io.v1.Card.last:type_name -> jaspermate.io.v1.CardState
+	11, // 3: jaspermate.io.v1.CardState.timestamp:type_name -> google.protobuf.Timestamp
+	6,  // 4: jaspermate.io.v1.CardState.quality:type_name -> jaspermate.io.v1.ChannelQuality
+	11, // 5: jaspermate.io.v1.CardState.last_good:type_name -> google.protobuf.Timestamp
+	8,  // 6: jaspermate.io.v1.WriteRequest.commands:type_name -> jaspermate.io.v1.WriteCommand
+	10, // 7: jaspermate.io.v1.WriteResponse.results:type_name -> jaspermate.io.v1.CommandResult
+	0,  // 8: jaspermate.io.v1.IOService.GetCards:input_type -> jaspermate.io.v1.GetCardsRequest
+	2,  // 9: jaspermate.io.v1.IOService.StreamCards:input_type -> jaspermate.io.v1.StreamCardsRequest
+	7,  // 10: jaspermate.io.v1.IOService.Write:input_type -> jaspermate.io.v1.WriteRequest
+	1,  // 11: jaspermate.io.v1.IOService.GetCards:output_type -> jaspermate.io.v1.GetCardsResponse
+	3,  // 12: jaspermate.io.v1.IOService.StreamCards:output_type -> jaspermate.io.v1.CardUpdate
+	9,  // 13: jaspermate.io.v1.IOService.Write:output_type -> jaspermate.io.v1.WriteResponse
+	11, // [11:14] is the sub-list for method output_type
+	8,  // [8:11] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_io_proto_init() }
+func file_io_proto_init() {
+	if File_io_proto != nil {
+		return
+	}
+	file_io_proto_msgTypes[8].OneofWrappers = []any{
+		(*WriteCommand_DoState)(nil),
+		(*WriteCommand_AoValue)(nil),
+		(*WriteCommand_AoType)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_io_proto_rawDesc), len(file_io_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_io_proto_goTypes,
+		DependencyIndexes: file_io_proto_depIdxs,
+		MessageInfos:      file_io_proto_msgTypes,
+	}.Build()
+	File_io_proto = out.File
+	file_io_proto_goTypes = nil
+	file_io_proto_depIdxs = nil
+}
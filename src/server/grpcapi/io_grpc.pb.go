@@ -0,0 +1,214 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.28.3
+// source: io.proto
+
+// IO control API of JasperMate Utils. Regenerate io.pb.go and io_grpc.pb.go after changes:
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative io.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IOService_GetCards_FullMethodName    = "/jaspermate.io.v1.IOService/GetCards"
+	IOService_StreamCards_FullMethodName = "/jaspermate.io.v1.IOService/StreamCards"
+	IOService_Write_FullMethodName       = "/jaspermate.io.v1.IOService/Write"
+)
+
+// IOServiceClient is the client API for IOService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IOService reads and writes the IO cards on the bus
+type IOServiceClient interface {
+	// GetCards returns the current state of all cards
+	GetCards(ctx context.Context, in *GetCardsRequest, opts ...grpc.CallOption) (*GetCardsResponse, error)
+	// StreamCards sends the state of all cards right away and then every interval until the call ends
+	StreamCards(ctx context.Context, in *StreamCardsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CardUpdate], error)
+	// Write executes a batch of output writes; the results are in command order
+	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+}
+
+type iOServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIOServiceClient(cc grpc.ClientConnInterface) IOServiceClient {
+	return &iOServiceClient{cc}
+}
+
+func (c *iOServiceClient) GetCards(ctx context.Context, in *GetCardsRequest, opts ...grpc.CallOption) (*GetCardsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetCardsResponse)
+	err := c.cc.Invoke(ctx, IOService_GetCards_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iOServiceClient) StreamCards(ctx context.Context, in *StreamCardsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CardUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IOService_ServiceDesc.Streams[0], IOService_StreamCards_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamCardsRequest, CardUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IOService_StreamCardsClient = grpc.ServerStreamingClient[CardUpdate]
+
+func (c *iOServiceClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteResponse)
+	err := c.cc.Invoke(ctx, IOService_Write_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IOServiceServer is the server API for IOService service.
+// All implementations must embed UnimplementedIOServiceServer
+// for forward compatibility.
+//
+// IOService reads and writes the IO cards on the bus
+type IOServiceServer interface {
+	// GetCards returns the current state of all cards
+	GetCards(context.Context, *GetCardsRequest) (*GetCardsResponse, error)
+	// StreamCards sends the state of all cards right away and then every interval until the call ends
+	StreamCards(*StreamCardsRequest, grpc.ServerStreamingServer[CardUpdate]) error
+	// Write executes a batch of output writes; the results are in command order
+	Write(context.Context, *WriteRequest) (*WriteResponse, error)
+	mustEmbedUnimplementedIOServiceServer()
+}
+
+// UnimplementedIOServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIOServiceServer struct{}
+
+func (UnimplementedIOServiceServer) GetCards(context.Context, *GetCardsRequest) (*GetCardsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetCards not implemented")
+}
+func (UnimplementedIOServiceServer) StreamCards(*StreamCardsRequest, grpc.ServerStreamingServer[CardUpdate]) error {
+	return status.Error(codes.Unimplemented, "method StreamCards not implemented")
+}
+func (UnimplementedIOServiceServer) Write(context.Context, *WriteRequest) (*WriteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedIOServiceServer) mustEmbedUnimplementedIOServiceServer() {}
+func (UnimplementedIOServiceServer) testEmbeddedByValue()                   {}
+
+// UnsafeIOServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IOServiceServer will
+// result in compilation errors.
+type UnsafeIOServiceServer interface {
+	mustEmbedUnimplementedIOServiceServer()
+}
+
+func RegisterIOServiceServer(s grpc.ServiceRegistrar, srv IOServiceServer) {
+	// If the following call panics, it indicates UnimplementedIOServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IOService_ServiceDesc, srv)
+}
+
+func _IOService_GetCards_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCardsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IOServiceServer).GetCards(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IOService_GetCards_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IOServiceServer).GetCards(ctx, req.(*GetCardsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IOService_StreamCards_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamCardsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IOServiceServer).StreamCards(m, &grpc.GenericServerStream[StreamCardsRequest, CardUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IOService_StreamCardsServer = grpc.ServerStreamingServer[CardUpdate]
+
+func _IOService_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IOServiceServer).Write(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IOService_Write_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IOServiceServer).Write(ctx, req.(*WriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// IOService_ServiceDesc is the grpc.ServiceDesc for IOService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IOService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "jaspermate.io.v1.IOService",
+	HandlerType: (*IOServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCards",
+			Handler:    _IOService_GetCards_Handler,
+		},
+		{
+			MethodName: "Write",
+			Handler:    _IOService_Write_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamCards",
+			Handler:       _IOService_StreamCards_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "io.proto",
+}
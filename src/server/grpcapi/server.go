@@ -0,0 +1,273 @@
+// Package grpcapi serves the IO control API over gRPC (see io.proto) for internal services that want
+// typed card state streams and batched writes with deadlines and authentication.
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/tcp"
+	"jaspermate-utils/src/server/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DefaultStreamInterval is the interval of StreamCards updates when the request sets none
+	DefaultStreamInterval = 500 * time.Millisecond
+	// MinStreamInterval is the shortest interval of StreamCards updates
+	MinStreamInterval = 50 * time.Millisecond
+)
+
+// Server implements IOService over the localio manager
+type Server struct {
+	UnimplementedIOServiceServer
+	localioMgr *localio.Manager
+	token      string // Bearer token required in the "authorization" metadata ("" = all calls are refused)
+	port       string
+	localOnly  bool
+	grpcServer *grpc.Server
+	listener   net.Listener
+}
+
+// NewServer creates a gRPC server on port. Calls must carry "authorization: Bearer <token>"; without a
+// token every call is refused. Unless serveExternally is set it only listens on localhost.
+func NewServer(port string, localioMgr *localio.Manager, token string, serveExternally bool) *Server {
+	s := &Server{
+		localioMgr: localioMgr,
+		token:      token,
+		port:       port,
+		localOnly:  !serveExternally,
+	}
+	s.grpcServer = grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	)
+	RegisterIOServiceServer(s.grpcServer, s)
+	return s
+}
+
+// Start listens on the port and serves calls in the background
+func (s *Server) Start() error {
+	addr := "0.0.0.0:" + s.port
+	if s.localOnly {
+		addr = "127.0.0.1:" + s.port
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start gRPC server on %s: %v", addr, err)
+	}
+	s.listener = listener
+	log.Printf("gRPC server listening on %s", addr)
+	go s.Serve(listener)
+	return nil
+}
+
+// Serve serves calls on listener until Stop is called
+func (s *Server) Serve(listener net.Listener) error {
+	if err := s.grpcServer.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+		log.Printf("gRPC server stopped: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Stop ends all calls and closes the listener
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// authorize checks the bearer token in the call metadata
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return status.Error(codes.PermissionDenied, "grpc_token is not configured")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		given, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token")
+}
+
+// GetCards returns the current state of all cards
+func (s *Server) GetCards(ctx context.Context, _ *GetCardsRequest) (*GetCardsResponse, error) {
+	return &GetCardsResponse{Cards: s.cards()}, nil
+}
+
+// StreamCards sends the state of all cards right away and then every interval until the call ends
+func (s *Server) StreamCards(req *StreamCardsRequest, stream grpc.ServerStreamingServer[CardUpdate]) error {
+	interval := time.Duration(req.GetIntervalMs()) * time.Millisecond
+	if interval == 0 {
+		interval = DefaultStreamInterval
+	}
+	if interval < MinStreamInterval {
+		return status.Errorf(codes.InvalidArgument, "interval_ms must be at least %d", MinStreamInterval.Milliseconds())
+	}
+
+	// A stream is a consumer of the card states, like a TCP client
+	detach := s.localioMgr.AttachConsumer("grpc")
+	defer detach()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var seq uint64
+	for {
+		seq++
+		if err := stream.Send(&CardUpdate{Seq: seq, Cards: s.cards()}); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write executes a batch of output writes as the calling peer
+func (s *Server) Write(ctx context.Context, req *WriteRequest) (*WriteResponse, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "grpc.write",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.Int("commands", len(req.GetCommands()))))
+	defer span.End()
+
+	ops, err := writeOperations(req.GetCommands())
+	if err != nil {
+		return nil, err
+	}
+	// Don't start writes the caller no longer waits for
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	results := s.localioMgr.ProcessBatchWriteContext(localio.WithSource(ctx, source(ctx)), ops)
+	resp := &WriteResponse{Ok: true, Results: make([]*CommandResult, len(results))}
+	for i, r := range results {
+		resp.Results[i] = &CommandResult{
+			Index:   uint32(i),
+			Ok:      r.Status == "ok",
+			Code:    string(r.Code),
+			Message: r.Message,
+		}
+		resp.Ok = resp.Ok && r.Status == "ok"
+	}
+	return resp, nil
+}
+
+// writeOperations validates the commands of a write batch and converts them to write operations
+func writeOperations(commands []*WriteCommand) ([]localio.WriteOperation, error) {
+	if len(commands) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no commands in batch")
+	}
+	if len(commands) > tcp.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "batch too large: %d commands (max %d)", len(commands), tcp.MaxBatchSize)
+	}
+	ops := make([]localio.WriteOperation, len(commands))
+	for i, cmd := range commands {
+		if cmd.GetCardId() == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "commands[%d]: card_id is required", i)
+		}
+		op := localio.WriteOperation{CardID: cmd.GetCardId(), Index: int(cmd.GetIndex())}
+		switch v := cmd.GetValue().(type) {
+		case *WriteCommand_DoState:
+			op.Type = localio.WriteOpDO
+			if v.DoState {
+				op.Value = 1.0
+			}
+		case *WriteCommand_AoValue:
+			op.Type = localio.WriteOpAO
+			op.Value = v.AoValue
+		case *WriteCommand_AoType:
+			op.Type = localio.WriteOpAOType
+			op.Mode = v.AoType
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "commands[%d]: one of do_state, ao_value or ao_type is required", i)
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
+
+// source returns the write source of a call: the address of the calling peer
+func source(ctx context.Context) localio.WriteSource {
+	src := localio.WriteSource{Kind: localio.SourceGRPC}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		src.ID = p.Addr.String()
+	}
+	return src
+}
+
+func (s *Server) cards() []*Card {
+	cards := s.localioMgr.GetAllCards()
+	out := make([]*Card, len(cards))
+	for i, c := range cards {
+		out[i] = cardToProto(c)
+	}
+	return out
+}
+
+func cardToProto(c *localio.Card) *Card {
+	last := c.Last
+	state := &CardState{
+		Timestamp:    timestamp(last.Timestamp),
+		Di:           last.DI,
+		Do:           last.DO,
+		Ai:           last.AI,
+		Ao:           last.AO,
+		AoType:       last.AOType,
+		SerialNumber: last.SerialNumber,
+		BaudRate:     uint32(last.BaudRate),
+		Error:        last.Error,
+		LastGood:     timestamp(last.LastGood),
+	}
+	if q := last.Quality; q != nil {
+		state.Quality = &ChannelQuality{Di: q.DI, Do: q.DO, Ai: q.AI, Ao: q.AO}
+	}
+	return &Card{
+		Id:       c.ID,
+		PortPath: c.PortPath,
+		SlaveId:  uint32(c.SlaveID),
+		Module:   c.Module,
+		Driver:   c.Driver,
+		Last:     state,
+		Conflict: c.Conflict,
+	}
+}
+
+// timestamp converts a time, leaving zero times unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
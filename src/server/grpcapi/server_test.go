@@ -0,0 +1,150 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves s on an in-memory listener and returns a client connected to it
+func dial(t *testing.T, s *Server) IOServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewIOServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestAuth(t *testing.T) {
+	client := dial(t, NewServer("0", localio.NewManager(), "secret", false))
+
+	if _, err := client.GetCards(context.Background(), &GetCardsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a token, got %v", err)
+	}
+	if _, err := client.GetCards(withToken("wrong"), &GetCardsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for a wrong token, got %v", err)
+	}
+	if _, err := client.GetCards(withToken("secret"), &GetCardsRequest{}); err != nil {
+		t.Errorf("Expected the call with the token to succeed, got %v", err)
+	}
+	stream, err := client.StreamCards(context.Background(), &StreamCardsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for a stream without a token, got %v", err)
+	}
+
+	client = dial(t, NewServer("0", localio.NewManager(), "", false))
+	if _, err := client.GetCards(withToken(""), &GetCardsRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied without a configured token, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	client := dial(t, NewServer("0", localio.NewManager(), "secret", false))
+	ctx := withToken("secret")
+
+	resp, err := client.Write(ctx, &WriteRequest{Commands: []*WriteCommand{
+		{CardId: "9", Index: 0, Value: &WriteCommand_DoState{DoState: true}},
+	}})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if resp.Ok || len(resp.Results) != 1 || resp.Results[0].Code != string(localio.CodeCardNotFound) {
+		t.Errorf("Expected the command to fail with CARD_NOT_FOUND, got %+v", resp)
+	}
+
+	for name, req := range map[string]*WriteRequest{
+		"empty batch":     {},
+		"missing card ID": {Commands: []*WriteCommand{{Value: &WriteCommand_AoValue{AoValue: 5}}}},
+		"missing value":   {Commands: []*WriteCommand{{CardId: "1"}}},
+	} {
+		if _, err := client.Write(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", name, err)
+		}
+	}
+
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := client.Write(expired, &WriteRequest{Commands: []*WriteCommand{
+		{CardId: "1", Value: &WriteCommand_DoState{DoState: true}},
+	}}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded for an expired call, got %v", err)
+	}
+}
+
+func TestStreamCards(t *testing.T) {
+	client := dial(t, NewServer("0", localio.NewManager(), "secret", false))
+	ctx, cancel := context.WithTimeout(withToken("secret"), 2*time.Second)
+	defer cancel()
+
+	if stream, err := client.StreamCards(ctx, &StreamCardsRequest{IntervalMs: 10}); err == nil {
+		if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for a too short interval, got %v", err)
+		}
+	}
+
+	stream, err := client.StreamCards(ctx, &StreamCardsRequest{IntervalMs: 50})
+	if err != nil {
+		t.Fatalf("StreamCards failed: %v", err)
+	}
+	for want := uint64(1); want <= 3; want++ {
+		update, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if update.Seq != want {
+			t.Errorf("Expected update %d, got %d", want, update.Seq)
+		}
+	}
+}
+
+func TestCardToProto(t *testing.T) {
+	now := time.Now()
+	card := cardToProto(&localio.Card{
+		ID:      "1",
+		SlaveID: 3,
+		Module:  "IO4040",
+		Last: localio.CardState{
+			Timestamp: now,
+			DO:        []bool{true, false},
+			AI:        []float32{4.5},
+			Quality:   &localio.ChannelQuality{DO: []string{"good", "stale"}},
+		},
+	})
+	if card.Id != "1" || card.SlaveId != 3 || card.Module != "IO4040" {
+		t.Errorf("Unexpected card fields: %+v", card)
+	}
+	last := card.Last
+	if !last.Timestamp.AsTime().Equal(now) || last.LastGood != nil {
+		t.Errorf("Expected the read time and no last good time, got %v and %v", last.Timestamp, last.LastGood)
+	}
+	if len(last.Do) != 2 || !last.Do[0] || last.Ai[0] != 4.5 || last.Quality.Do[1] != "stale" {
+		t.Errorf("Unexpected card state: %+v", last)
+	}
+}
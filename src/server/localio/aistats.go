@@ -0,0 +1,126 @@
+package localio
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AIStatsPeriod are the statistics of the values read from an AI channel (raw units) between two daily
+// resets
+type AIStatsPeriod struct {
+	Since time.Time `json:"since"`
+	// Until is set once the period ended
+	Until   time.Time `json:"until,omitempty"`
+	Min     float32   `json:"min"`
+	Max     float32   `json:"max"`
+	Avg     float64   `json:"avg"`
+	Samples uint64    `json:"samples"`
+	sum     float64
+}
+
+// AIStats are the statistics of an AI channel for the current day and the day before
+type AIStats struct {
+	CardID   string         `json:"cardId"`
+	Channel  string         `json:"channel"`
+	Current  AIStatsPeriod  `json:"current"`
+	Previous *AIStatsPeriod `json:"previous,omitempty"`
+}
+
+// aiChannelStats are the periods of one AI channel; guarded by m.mu
+type aiChannelStats struct {
+	current  AIStatsPeriod
+	previous *AIStatsPeriod
+}
+
+// add records a value read in the current period
+func (s *aiChannelStats) add(v float32) {
+	p := &s.current
+	if p.Samples == 0 || v < p.Min {
+		p.Min = v
+	}
+	if p.Samples == 0 || v > p.Max {
+		p.Max = v
+	}
+	p.Samples++
+	p.sum += float64(v)
+	p.Avg = p.sum / float64(p.Samples)
+}
+
+// roll starts a new period at start if the current one began before it. The current period becomes the
+// previous one if it is the day before start; otherwise there were no reads the day before.
+func (s *aiChannelStats) roll(start time.Time) {
+	if !s.current.Since.Before(start) {
+		return
+	}
+	s.previous = nil
+	if s.current.Samples > 0 && !s.current.Since.Before(start.AddDate(0, 0, -1)) {
+		prev := s.current
+		prev.Until = start
+		s.previous = &prev
+	}
+	s.current = AIStatsPeriod{Since: start}
+}
+
+// aiStatsPeriodStart returns the start of the statistics period containing now: the last daily reset at
+// reset after midnight
+func aiStatsPeriodStart(now time.Time, reset time.Duration) time.Time {
+	y, m, d := now.Date()
+	start := time.Date(y, m, d, int(reset.Hours()), int(reset.Minutes())%60, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// recordAIStats adds the AI values of a card's read to the statistics of its enabled channels
+func (m *Manager) recordAIStats(c *Card, spec ModelSpec, state CardState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start := aiStatsPeriodStart(state.Timestamp, m.aiStatsReset)
+	stats := m.aiStats[c.ID]
+	for len(stats) < len(state.AI) {
+		stats = append(stats, &aiChannelStats{current: AIStatsPeriod{Since: start}})
+	}
+	m.aiStats[c.ID] = stats
+	for i, v := range state.AI {
+		if !spec.Enabled("ai", i) {
+			continue
+		}
+		stats[i].roll(start)
+		stats[i].add(v)
+	}
+}
+
+// GetAIStats returns the statistics of every AI channel of every card since the last daily reset
+// (ai_stats_reset_time) and for the day before
+func (m *Manager) GetAIStats() []AIStats {
+	cards := m.GetAllCards()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start := aiStatsPeriodStart(time.Now(), m.aiStatsReset)
+	out := []AIStats{}
+	for _, c := range cards {
+		stats := m.aiStats[c.ID]
+		for i := 0; i < cardSpec(c).AI; i++ {
+			st := AIStats{CardID: c.ID, Channel: "ai" + strconv.Itoa(i), Current: AIStatsPeriod{Since: start}}
+			if i < len(stats) {
+				stats[i].roll(start)
+				st.Current = stats[i].current
+				if p := stats[i].previous; p != nil {
+					prev := *p
+					st.Previous = &prev
+				}
+			}
+			out = append(out, st)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		idi, _ := strconv.Atoi(out[i].CardID)
+		idj, _ := strconv.Atoi(out[j].CardID)
+		return idi < idj
+	})
+	return out
+}
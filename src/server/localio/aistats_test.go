@@ -0,0 +1,69 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestAIStats(t *testing.T) {
+	configtest.Isolate(t)
+
+	client := &MockClient{
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) { return make([]byte, 2*quantity), nil },
+		ReadInputRegistersFunc:   func(address, quantity uint16) ([]byte, error) { return make([]byte, 2*quantity), nil },
+	}
+	mgr := newMockManager(client)
+	mgr.aiStatsReset = 6 * time.Hour
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	spec := cardSpec(card)
+	spec.Disabled = map[string]bool{"ai3": true}
+
+	// Values of the previous period, then of the current one
+	now := time.Now()
+	start := aiStatsPeriodStart(now, mgr.aiStatsReset)
+	for _, r := range []struct {
+		at time.Time
+		ai []float32
+	}{
+		{start.Add(-2 * time.Hour), []float32{100, 5, 0, 9}},
+		{start.Add(-time.Hour), []float32{300, 5, 0, 9}},
+		{start, []float32{4000, 10, 0, 9}},
+		{start.Add(time.Second), []float32{2000, 20, 0, 9}},
+		{start.Add(2 * time.Second), []float32{3000, 30, 0, 9}},
+	} {
+		mgr.recordAIStats(card, spec, CardState{Timestamp: r.at, AI: r.ai})
+	}
+
+	stats := mgr.GetAIStats()
+	if len(stats) != 4 {
+		t.Fatalf("Expected 4 AI channels, got %+v", stats)
+	}
+	cur := stats[0].Current
+	if cur.Samples != 3 || cur.Min != 2000 || cur.Max != 4000 || cur.Avg != 3000 || !cur.Since.Equal(start) {
+		t.Errorf("Unexpected current period %+v", cur)
+	}
+	prev := stats[0].Previous
+	if prev == nil || prev.Samples != 2 || prev.Min != 100 || prev.Max != 300 || prev.Avg != 200 || !prev.Until.Equal(start) {
+		t.Errorf("Unexpected previous period %+v", prev)
+	}
+	if stats[3].Current.Samples != 0 {
+		t.Errorf("Expected no statistics of the disabled channel, got %+v", stats[3])
+	}
+
+	// A period without reads leaves no previous day
+	s := &aiChannelStats{current: AIStatsPeriod{Since: start.AddDate(0, 0, -2), Samples: 1}}
+	s.roll(start)
+	if s.previous != nil {
+		t.Errorf("Expected no previous period after a day without reads, got %+v", s.previous)
+	}
+
+	if problems := mgr.ValidateConfig(config.Config{Settings: config.Settings{AIStatsResetTime: "6am"}}); len(problems) == 0 {
+		t.Error("Expected an invalid ai_stats_reset_time to be rejected")
+	}
+}
@@ -0,0 +1,414 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// maxShelveDuration is the longest time an alarm can be shelved; shelving always expires
+const maxShelveDuration = 24 * time.Hour
+
+// Alarm actions reported in alarm events
+const (
+	AlarmRaised    = "raised"
+	AlarmCleared   = "cleared"
+	AlarmAcked     = "acked"
+	AlarmShelved   = "shelved"
+	AlarmUnshelved = "unshelved"
+)
+
+// Alarm is the state of an alarm rule. An alarm stays in the alarm list until it is cleared and
+// acknowledged; a shelved alarm is still evaluated but raises no events until it is unshelved.
+type Alarm struct {
+	Name     string `json:"name"`
+	CardID   string `json:"cardId"`
+	Channel  string `json:"channel,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Severity string `json:"severity"`
+	Active   bool   `json:"active"`
+	// Acked is set once the current or last activation was acknowledged (true while the alarm is normal)
+	Acked      bool      `json:"acked"`
+	RaisedAt   time.Time `json:"raisedAt,omitempty"`
+	ClearedAt  time.Time `json:"clearedAt,omitempty"`
+	AckedBy    string    `json:"ackedBy,omitempty"`
+	AckedAt    time.Time `json:"ackedAt,omitempty"`
+	AckComment string    `json:"ackComment,omitempty"`
+	Shelved    bool      `json:"shelved"`
+	ShelvedBy  string    `json:"shelvedBy,omitempty"`
+	// ShelvedUntil is when the shelving expires
+	ShelvedUntil time.Time `json:"shelvedUntil,omitempty"`
+	ShelveReason string    `json:"shelveReason,omitempty"`
+}
+
+// SafeStateAlarm is the critical alarm raised while outputs couldn't be driven to their safe state
+const SafeStateAlarm = "safe-state-failed"
+
+// alarmState is an alarm rule and the state of its alarm; guarded by m.mu
+type alarmState struct {
+	rule      config.AlarmRule
+	alarm     Alarm
+	escalated int  // Escalation steps notified since the alarm was raised
+	system    bool // Raised and cleared by the service (e.g. SafeStateAlarm) rather than by a rule
+}
+
+// alarmEvent is a pending alarm event, emitted after m.mu is released
+type alarmEvent struct {
+	action string
+	alarm  Alarm
+	user   string
+}
+
+// ValidateAlarmRules checks alarm rules for missing names and cards, unknown channels, and limits that
+// don't match the channel
+func ValidateAlarmRules(rules []config.AlarmRule) error {
+	var p configProblems
+	validateAlarmRules(rules, &p)
+	return p.err()
+}
+
+func validateAlarmRules(rules []config.AlarmRule, p *configProblems) {
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		path := fmt.Sprintf("alarms[%d]", i)
+		if rule.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if strings.Contains(rule.Name, "/") {
+			p.add(path+".name", "name must not contain '/'")
+		} else if rule.Name == SafeStateAlarm {
+			p.add(path+".name", "name %q is reserved", rule.Name)
+		} else if names[rule.Name] {
+			p.add(path+".name", "duplicate name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if rule.Severity != "" && !ValidSeverity(rule.Severity) {
+			p.add(path+".severity", "unknown severity %q (use info, warning or critical)", rule.Severity)
+		}
+
+		switch {
+		case rule.Channel == "":
+			if rule.High != nil || rule.Low != nil {
+				p.add(path, "high/low limits need an AI channel")
+			}
+		case !inputChannelPattern.MatchString(rule.Channel):
+			p.add(path+".channel", "invalid channel %q (use di<n> or ai<n>, or leave empty for communication alarms)", rule.Channel)
+		case strings.HasPrefix(rule.Channel, "di"):
+			if rule.High != nil || rule.Low != nil {
+				p.add(path, "high/low limits need an AI channel")
+			}
+		default:
+			if rule.High == nil && rule.Low == nil {
+				p.add(path, "AI alarm needs a high or low limit")
+			}
+			if rule.High != nil && rule.Low != nil && *rule.Low >= *rule.High {
+				p.add(path+".low", "must be below high")
+			}
+		}
+	}
+}
+
+// GetAlarmRules returns the configured alarm rules
+func (m *Manager) GetAlarmRules() []config.AlarmRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]config.AlarmRule, 0, len(m.alarms))
+	for _, a := range m.alarms {
+		if a.system {
+			continue
+		}
+		rules = append(rules, a.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// SetAlarmRules validates, activates, and persists a new set of alarm rules. Alarms of rules with an
+// unchanged name keep their state, acknowledgment and shelving.
+func (m *Manager) SetAlarmRules(rules []config.AlarmRule) error {
+	return m.SetAlarmRulesContext(context.Background(), rules)
+}
+
+// SetAlarmRulesContext is SetAlarmRules with the change attributed in the config history to the change of
+// ctx (see config.WithChange)
+func (m *Manager) SetAlarmRulesContext(ctx context.Context, rules []config.AlarmRule) error {
+	if err := ValidateAlarmRules(rules); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.loadAlarmsLocked(rules)
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Alarms = rules
+	})
+}
+
+// loadAlarmsLocked replaces the alarm rules; the caller must hold m.mu
+func (m *Manager) loadAlarmsLocked(rules []config.AlarmRule) {
+	alarms := make(map[string]*alarmState, len(rules))
+	for _, rule := range rules {
+		a, ok := m.alarms[rule.Name]
+		if !ok {
+			a = &alarmState{alarm: Alarm{Name: rule.Name, Acked: true}}
+		}
+		a.rule = rule
+		a.alarm.CardID = rule.Card
+		a.alarm.Channel = rule.Channel
+		a.alarm.Message = rule.Message
+		a.alarm.Severity = alarmSeverity(rule)
+		alarms[rule.Name] = a
+	}
+	for name, a := range m.alarms {
+		if a.system {
+			alarms[name] = a
+		}
+	}
+	m.alarms = alarms
+}
+
+// GetAlarms returns the alarms sorted by name: all of them, or with listOnly the alarm list (active or
+// not yet acknowledged)
+func (m *Manager) GetAlarms(listOnly bool) []Alarm {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Alarm, 0, len(m.alarms))
+	for _, a := range m.alarms {
+		if listOnly && !a.alarm.Active && a.alarm.Acked {
+			continue
+		}
+		out = append(out, a.alarm)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// AcknowledgeAlarm acknowledges the current or last activation of an alarm
+func (m *Manager) AcknowledgeAlarm(name, user, comment string) error {
+	if user == "" {
+		return errorf(CodeInvalidRequest, "user is required")
+	}
+	m.mu.Lock()
+	a, ok := m.alarms[name]
+	if !ok {
+		m.mu.Unlock()
+		return errorf(CodeNotFound, "alarm %q not found", name)
+	}
+	if a.alarm.Acked {
+		m.mu.Unlock()
+		return errorf(CodeConflict, "alarm %q is not waiting for acknowledgment", name)
+	}
+	a.alarm.Acked = true
+	a.alarm.AckedBy = user
+	a.alarm.AckedAt = time.Now()
+	a.alarm.AckComment = comment
+	ev := alarmEvent{action: AlarmAcked, alarm: a.alarm, user: user}
+	m.mu.Unlock()
+
+	m.emitAlarmEvents([]alarmEvent{ev})
+	return nil
+}
+
+// ShelveAlarm suppresses the events of an alarm for a duration of up to 24 hours
+func (m *Manager) ShelveAlarm(name, user, reason string, d time.Duration) error {
+	if user == "" {
+		return errorf(CodeInvalidRequest, "user is required")
+	}
+	if d <= 0 || d > maxShelveDuration {
+		return errorf(CodeInvalidRequest, "shelve duration must be between 1s and %s", maxShelveDuration)
+	}
+	m.mu.Lock()
+	a, ok := m.alarms[name]
+	if !ok {
+		m.mu.Unlock()
+		return errorf(CodeNotFound, "alarm %q not found", name)
+	}
+	a.alarm.Shelved = true
+	a.alarm.ShelvedBy = user
+	a.alarm.ShelvedUntil = time.Now().Add(d)
+	a.alarm.ShelveReason = reason
+	ev := alarmEvent{action: AlarmShelved, alarm: a.alarm, user: user}
+	m.mu.Unlock()
+
+	m.emitAlarmEvents([]alarmEvent{ev})
+	return nil
+}
+
+// UnshelveAlarm ends the shelving of an alarm before it expires
+func (m *Manager) UnshelveAlarm(name, user string) error {
+	if user == "" {
+		return errorf(CodeInvalidRequest, "user is required")
+	}
+	m.mu.Lock()
+	a, ok := m.alarms[name]
+	if !ok {
+		m.mu.Unlock()
+		return errorf(CodeNotFound, "alarm %q not found", name)
+	}
+	if !a.alarm.Shelved {
+		m.mu.Unlock()
+		return errorf(CodeConflict, "alarm %q is not shelved", name)
+	}
+	evs := a.unshelveLocked(user)
+	m.mu.Unlock()
+
+	m.emitAlarmEvents(evs)
+	return nil
+}
+
+// unshelveLocked ends the shelving of an alarm; an active alarm not yet acknowledged is raised again
+func (a *alarmState) unshelveLocked(user string) []alarmEvent {
+	a.alarm.Shelved = false
+	a.alarm.ShelvedBy = ""
+	a.alarm.ShelvedUntil = time.Time{}
+	a.alarm.ShelveReason = ""
+	evs := []alarmEvent{{action: AlarmUnshelved, alarm: a.alarm, user: user}}
+	if a.alarm.Active && !a.alarm.Acked {
+		evs = append(evs, alarmEvent{action: AlarmRaised, alarm: a.alarm})
+	}
+	return evs
+}
+
+// conditionLocked evaluates an alarm rule; ok is false while the monitored input is unknown (card
+// missing or not read), in which case the alarm keeps its state. The caller must hold m.mu.
+func (m *Manager) conditionLocked(rule config.AlarmRule) (active, ok bool) {
+	c, found := m.cards[rule.Card]
+	if rule.Channel == "" {
+		return !found || c.Last.Error != "", true
+	}
+	if !found || c.Last.Error != "" {
+		return false, false
+	}
+	index, _ := strconv.Atoi(rule.Channel[2:])
+	if strings.HasPrefix(rule.Channel, "di") {
+		if index >= len(c.Last.DI) {
+			return false, false
+		}
+		return c.Last.DI[index] == rule.State, true
+	}
+	if index >= len(c.Last.AI) {
+		return false, false
+	}
+	v := c.Last.AI[index]
+	return (rule.High != nil && v > *rule.High) || (rule.Low != nil && v < *rule.Low), true
+}
+
+// evaluateAlarms raises and clears alarms from the latest card states and ends expired shelving
+func (m *Manager) evaluateAlarms() {
+	m.mu.Lock()
+	if len(m.alarms) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	var evs []alarmEvent
+	for _, a := range m.alarms {
+		if a.alarm.Shelved && !now.Before(a.alarm.ShelvedUntil) {
+			evs = append(evs, a.unshelveLocked("")...)
+		}
+		if a.system {
+			continue
+		}
+		if active, ok := m.conditionLocked(a.rule); ok {
+			evs = append(evs, a.setActiveLocked(active, now)...)
+		}
+	}
+	var due []pendingNotification
+	if m.openWindow.name == "" {
+		due = m.escalationsDueLocked(now)
+	} else {
+		// During maintenance alarms change state but raise no events and aren't escalated
+		evs = slices.DeleteFunc(evs, func(ev alarmEvent) bool {
+			return ev.action == AlarmRaised || ev.action == AlarmCleared
+		})
+	}
+	m.mu.Unlock()
+
+	sort.SliceStable(evs, func(i, j int) bool { return evs[i].alarm.Name < evs[j].alarm.Name })
+	m.emitAlarmEvents(evs)
+	m.deliverNotifications(due)
+}
+
+// setActiveLocked raises or clears an alarm and returns its event, if any; the caller must hold m.mu
+func (a *alarmState) setActiveLocked(active bool, now time.Time) []alarmEvent {
+	if active == a.alarm.Active {
+		return nil
+	}
+	a.alarm.Active = active
+	action := AlarmCleared
+	if active {
+		action = AlarmRaised
+		a.alarm.Acked = false
+		a.alarm.RaisedAt = now
+		a.escalated = 0
+		a.alarm.AckedBy = ""
+		a.alarm.AckedAt = time.Time{}
+		a.alarm.AckComment = ""
+	} else {
+		a.alarm.ClearedAt = now
+	}
+	if a.alarm.Shelved {
+		return nil
+	}
+	return []alarmEvent{{action: action, alarm: a.alarm}}
+}
+
+// setSystemAlarm raises or clears a critical alarm of the service itself. message updates the alarm's
+// message while it is raised.
+func (m *Manager) setSystemAlarm(name, message string, active bool) {
+	m.mu.Lock()
+	a, ok := m.alarms[name]
+	if !ok {
+		if !active {
+			m.mu.Unlock()
+			return
+		}
+		a = &alarmState{alarm: Alarm{Name: name, Severity: SeverityCritical, Acked: true}, system: true}
+		m.alarms[name] = a
+	}
+	if active {
+		a.alarm.Message = message
+	}
+	evs := a.setActiveLocked(active, time.Now())
+	m.mu.Unlock()
+
+	m.emitAlarmEvents(evs)
+}
+
+// emitAlarmEvents emits alarm events; must be called without m.mu held
+func (m *Manager) emitAlarmEvents(evs []alarmEvent) {
+	for _, ev := range evs {
+		data := map[string]interface{}{
+			"alarm":    ev.alarm.Name,
+			"action":   ev.action,
+			"severity": ev.alarm.Severity,
+			"active":   ev.alarm.Active,
+			"acked":    ev.alarm.Acked,
+		}
+		if ev.alarm.Channel != "" {
+			data["channel"] = ev.alarm.Channel
+		}
+		if ev.alarm.Message != "" {
+			data["message"] = ev.alarm.Message
+		}
+		if ev.user != "" {
+			data["user"] = ev.user
+		}
+		switch ev.action {
+		case AlarmAcked:
+			data["comment"] = ev.alarm.AckComment
+		case AlarmShelved:
+			data["reason"] = ev.alarm.ShelveReason
+			data["until"] = ev.alarm.ShelvedUntil
+		}
+		m.emitEvent(EventAlarm, ev.alarm.CardID, data)
+	}
+}
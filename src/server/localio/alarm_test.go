@@ -0,0 +1,107 @@
+package localio
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestAlarmAcknowledgeAndShelve(t *testing.T) {
+	configtest.Isolate(t)
+
+	di := byte(0x00)
+	var readErr error
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			return []byte{di}, readErr
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.readRetryMax = 0
+	var events []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventAlarm {
+			events = append(events, ev)
+		}
+	})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	high := float32(100)
+	if err := mgr.SetAlarmRules([]config.AlarmRule{{Name: "x", Card: card.ID, Channel: "di0", High: &high}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a limit on a DI, got %v", err)
+	}
+	rules := []config.AlarmRule{
+		{Name: "door", Card: card.ID, Channel: "di1", State: true, Message: "Door open"},
+		{Name: "comms", Card: card.ID},
+	}
+	if err := mgr.SetAlarmRules(rules); err != nil {
+		t.Fatalf("SetAlarmRules failed: %v", err)
+	}
+
+	// A raised alarm stays in the list after clearing until it is acknowledged
+	mgr.ReadAllAndProcessWrites()
+	if len(mgr.GetAlarms(true)) != 0 {
+		t.Fatalf("Expected no alarms, got %+v", mgr.GetAlarms(true))
+	}
+	di = 0x02
+	mgr.ReadAllAndProcessWrites()
+	di = 0x00
+	mgr.ReadAllAndProcessWrites()
+	if len(events) != 2 || events[0].Data["action"] != AlarmRaised || events[1].Data["action"] != AlarmCleared {
+		t.Fatalf("Expected raised and cleared events, got %+v", events)
+	}
+	if list := mgr.GetAlarms(true); len(list) != 1 || list[0].Name != "door" || list[0].Active || list[0].Acked {
+		t.Fatalf("Expected the cleared door alarm waiting for acknowledgment, got %+v", list)
+	}
+	if err := mgr.AcknowledgeAlarm("door", "", ""); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST without a user, got %v", err)
+	}
+	if err := mgr.AcknowledgeAlarm("door", "alice", "checked"); err != nil {
+		t.Fatalf("AcknowledgeAlarm failed: %v", err)
+	}
+	if err := mgr.AcknowledgeAlarm("door", "alice", ""); ErrorCodeOf(err) != CodeConflict {
+		t.Errorf("Expected CONFLICT for an acknowledged alarm, got %v", err)
+	}
+	if len(mgr.GetAlarms(true)) != 0 {
+		t.Errorf("Expected an empty alarm list after acknowledgment, got %+v", mgr.GetAlarms(true))
+	}
+	if a := mgr.GetAlarms(false)[1]; a.AckedBy != "alice" || a.AckComment != "checked" {
+		t.Errorf("Expected the acknowledgment recorded, got %+v", a)
+	}
+
+	// A shelved alarm raises no events; unshelving raises it again while it is unacknowledged
+	if err := mgr.ShelveAlarm("door", "bob", "sensor fault", 25*time.Hour); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for shelving over 24 hours, got %v", err)
+	}
+	if err := mgr.ShelveAlarm("door", "bob", "sensor fault", time.Hour); err != nil {
+		t.Fatalf("ShelveAlarm failed: %v", err)
+	}
+	events = nil
+	di = 0x02
+	mgr.ReadAllAndProcessWrites()
+	if len(events) != 0 {
+		t.Errorf("Expected no events from a shelved alarm, got %+v", events)
+	}
+	if err := mgr.UnshelveAlarm("door", "bob"); err != nil {
+		t.Fatalf("UnshelveAlarm failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Data["action"] != AlarmUnshelved || events[1].Data["action"] != AlarmRaised {
+		t.Errorf("Expected unshelved and raised events, got %+v", events)
+	}
+
+	// Communication alarms follow the card's read errors
+	readErr = errors.New("timeout")
+	mgr.ReadAllAndProcessWrites()
+	if a := mgr.GetAlarms(false)[0]; a.Name != "comms" || !a.Active {
+		t.Errorf("Expected an active communication alarm, got %+v", a)
+	}
+	if err := mgr.ShelveAlarm("missing", "bob", "", time.Hour); ErrorCodeOf(err) != CodeNotFound {
+		t.Errorf("Expected NOT_FOUND for an unknown alarm, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package localio
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Channel roles listed in the as-built description
+const (
+	RoleDisabled    = "disabled"     // disabled_channels
+	RolePriority    = "priority"     // priority_channels
+	RolePulse       = "pulse"        // pulse_channels
+	RoleCurrentLoop = "current-loop" // current_loop_inputs
+)
+
+// AsBuiltChannel is one channel of a card as installed: its point and its role in the configuration
+type AsBuiltChannel struct {
+	Channel string `json:"channel"`
+	Name    string `json:"name,omitempty"`
+	Unit    string `json:"unit,omitempty"`
+	Label   string `json:"label,omitempty"`
+	// Scaling is the point's scaling as in the point CSV (4..20=0..10)
+	Scaling   string   `json:"scaling,omitempty"`
+	SafeState string   `json:"safeState,omitempty"`
+	AOType    string   `json:"aoType,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// Commissioning is the channel's commissioning state (pending, verified, failed)
+	Commissioning string `json:"commissioning"`
+}
+
+// AsBuiltCard is a card as installed
+type AsBuiltCard struct {
+	CardID       string           `json:"cardId"`
+	Module       string           `json:"module"`
+	Driver       string           `json:"driver"`
+	PortPath     string           `json:"portPath"`
+	SlaveID      byte             `json:"slaveId"`
+	BaudRate     int              `json:"baudRate,omitempty"`
+	SerialNumber string           `json:"serialNumber,omitempty"`
+	Firmware     string           `json:"firmware,omitempty"`
+	Channels     []AsBuiltChannel `json:"channels"`
+}
+
+// AsBuilt describes the panel as installed, from the live card data and the configuration, to hand over
+// to the site maintenance team
+type AsBuilt struct {
+	DeviceID    string        `json:"deviceId"`
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Cards       []AsBuiltCard `json:"cards"`
+}
+
+// GetAsBuilt returns the as-built description of every card and channel
+func (m *Manager) GetAsBuilt() AsBuilt {
+	cards := m.GetAllCards()
+	doc := AsBuilt{DeviceID: config.GetDeviceID(), GeneratedAt: time.Now(), Cards: []AsBuiltCard{}}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	roles := make(map[config.InputChannel][]string)
+	for _, list := range []struct {
+		role     string
+		channels []config.InputChannel
+	}{{RoleDisabled, m.disabled}, {RolePriority, m.priority}, {RolePulse, m.pulse}, {RoleCurrentLoop, m.currentLoop}} {
+		for _, ch := range list.channels {
+			roles[ch] = append(roles[ch], list.role)
+		}
+	}
+
+	for _, c := range cards {
+		card := AsBuiltCard{
+			CardID:       c.ID,
+			Module:       c.Module,
+			Driver:       cardDriver(c).Name(),
+			PortPath:     c.PortPath,
+			SlaveID:      c.SlaveID,
+			BaudRate:     c.Last.BaudRate,
+			SerialNumber: c.Last.SerialNumber,
+			Firmware:     c.Last.Firmware,
+			Channels:     []AsBuiltChannel{},
+		}
+		points := make(map[string]config.Point)
+		if c.Last.SerialNumber != "" {
+			for _, pt := range m.points {
+				if pt.Serial == c.Last.SerialNumber {
+					points[pt.Channel] = pt
+				}
+			}
+		}
+		checks := m.commissioning[relayKey(c)]
+		spec := cardSpec(c)
+		for _, kind := range []string{"di", "do", "ai", "ao"} {
+			for i := 0; i < channelCount(spec, kind); i++ {
+				name := kind + strconv.Itoa(i)
+				ch := AsBuiltChannel{Channel: name, Roles: roles[config.InputChannel{Card: c.ID, Channel: name}], Commissioning: CommissioningPending}
+				if pt, ok := points[name]; ok {
+					ch.Name, ch.Unit, ch.Label, ch.SafeState = pt.Name, pt.Unit, pt.Label, pt.SafeState
+					if pt.RawMax != pt.RawMin {
+						ch.Scaling = fmt.Sprintf("%g..%g=%g..%g", pt.RawMin, pt.RawMax, pt.EngMin, pt.EngMax)
+					}
+				}
+				if kind == "ao" && i < len(c.Last.AOType) {
+					ch.AOType = c.Last.AOType[i]
+				}
+				if check, ok := checks[name]; ok {
+					ch.Commissioning = check.Status
+				}
+				card.Channels = append(card.Channels, ch)
+			}
+		}
+		doc.Cards = append(doc.Cards, card)
+	}
+	return doc
+}
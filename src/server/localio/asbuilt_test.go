@@ -0,0 +1,43 @@
+package localio
+
+import (
+	"slices"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestAsBuilt(t *testing.T) {
+	configtest.Isolate(t)
+
+	serials := []string{"SN-A"}
+	mgr := newMockManager(serialClient(&serials))
+	card, err := mgr.AddCard("/dev/ttyUSB0", 3, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.mu.Lock()
+	mgr.points = []config.Point{{Serial: "SN-A", Channel: "do1", Name: "Pump", Label: "X1:4 / W-12", SafeState: "off"}}
+	mgr.priority = []config.InputChannel{{Card: card.ID, Channel: "di0"}}
+	mgr.pulse = []config.InputChannel{{Card: card.ID, Channel: "di0"}}
+	mgr.mu.Unlock()
+	if _, err := mgr.MarkChannel(card.ID, "do1", CommissioningVerified, "J. Smith", ""); err != nil {
+		t.Fatalf("MarkChannel failed: %v", err)
+	}
+
+	doc := mgr.GetAsBuilt()
+	if len(doc.Cards) != 1 {
+		t.Fatalf("Expected one card, got %+v", doc.Cards)
+	}
+	c := doc.Cards[0]
+	if c.SlaveID != 3 || c.SerialNumber != "SN-A" || c.Driver == "" || len(c.Channels) != 8 {
+		t.Fatalf("Unexpected card %+v", c)
+	}
+	if di0 := c.Channels[0]; !slices.Equal(di0.Roles, []string{RolePriority, RolePulse}) || di0.Commissioning != CommissioningPending {
+		t.Errorf("Unexpected di0 %+v", di0)
+	}
+	if do1 := c.Channels[5]; do1.Channel != "do1" || do1.Name != "Pump" || do1.Label != "X1:4 / W-12" || do1.Commissioning != CommissioningVerified {
+		t.Errorf("Unexpected do1 %+v", do1)
+	}
+}
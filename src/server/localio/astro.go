@@ -0,0 +1,64 @@
+package localio
+
+import (
+	"math"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// j2000 is the epoch of the sunrise equation, 2000-01-01 12:00 UTC (Julian day 2451545)
+var j2000 = time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// SunTimes are the sunrise and sunset of a date at the configured location. They are zero when the sun
+// doesn't rise or set that day (polar day or night).
+type SunTimes struct {
+	Date    string    `json:"date"`
+	Sunrise time.Time `json:"sunrise,omitempty"`
+	Sunset  time.Time `json:"sunset,omitempty"`
+}
+
+// sunTimes computes the sunrise and sunset of the local date of t with the sunrise equation (accurate to
+// about a minute outside the polar regions). ok is false if the sun doesn't rise or set that day.
+func sunTimes(t time.Time, loc config.Location) (rise, set time.Time, ok bool) {
+	const rad = math.Pi / 180
+	y, m, d := t.Date()
+	n := math.Round(time.Date(y, m, d, 12, 0, 0, 0, time.UTC).Sub(j2000).Hours() / 24)
+
+	// Mean solar noon, solar mean anomaly, equation of the center and ecliptic longitude
+	jStar := n - loc.Longitude/360
+	mean := math.Mod(357.5291+0.98560028*jStar, 360)
+	center := 1.9148*math.Sin(mean*rad) + 0.02*math.Sin(2*mean*rad) + 0.0003*math.Sin(3*mean*rad)
+	lambda := math.Mod(mean+center+180+102.9372, 360)
+	transit := jStar + 0.0053*math.Sin(mean*rad) - 0.0069*math.Sin(2*lambda*rad)
+
+	// Declination of the sun and hour angle at -0.833° (refraction and the sun's radius)
+	sinDecl := math.Sin(lambda*rad) * math.Sin(23.4397*rad)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	cosOmega := (math.Sin(-0.833*rad) - math.Sin(loc.Latitude*rad)*sinDecl) / (math.Cos(loc.Latitude*rad) * cosDecl)
+	if cosOmega < -1 || cosOmega > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	omega := math.Acos(cosOmega) / rad
+
+	at := func(days float64) time.Time {
+		return j2000.Add(time.Duration(days * 24 * float64(time.Hour))).In(t.Location()).Truncate(time.Second)
+	}
+	return at(transit - omega/360), at(transit + omega/360), true
+}
+
+// GetSunTimes returns today's sunrise and sunset at the configured location (nil without a location)
+func (m *Manager) GetSunTimes() *SunTimes {
+	m.mu.Lock()
+	loc := m.location
+	m.mu.Unlock()
+	if loc == nil {
+		return nil
+	}
+	now := time.Now()
+	st := &SunTimes{Date: now.Format(time.DateOnly)}
+	if rise, set, ok := sunTimes(now, *loc); ok {
+		st.Sunrise, st.Sunset = rise, set
+	}
+	return st
+}
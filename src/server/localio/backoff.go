@@ -0,0 +1,37 @@
+package localio
+
+import (
+	"errors"
+	"time"
+)
+
+// readRetryBase is the retry delay of a card after its second consecutive failed read. It doubles with
+// every further failure up to failed_card_retry_max_ms; a single failed read is retried on the next cycle.
+const readRetryBase = 250 * time.Millisecond
+
+// scheduleRetry sets when a card is read again after a failed read. Failing cards are retried at a
+// decreasing rate so the timeouts of a missing card don't delay the reads of the healthy cards on the bus.
+func (m *Manager) scheduleRetry(c *Card, readErr error, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if readErr == nil || m.readRetryMax <= 0 || c.readFailures < 2 {
+		c.RetryAt = time.Time{}
+		return
+	}
+	delay := min(readRetryBase<<min(c.readFailures-2, 16), m.readRetryMax)
+	c.RetryAt = now.Add(delay)
+}
+
+// readDeferred reports whether the read of a failing card is skipped in this cycle
+func (m *Manager) readDeferred(c *Card, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !c.RetryAt.IsZero() && now.Before(c.RetryAt)
+}
+
+// deferRead keeps the state of a card whose read is skipped: its channels age to stale and error quality
+// as if the read had failed again
+func (m *Manager) deferRead(c *Card, spec ModelSpec, now time.Time) {
+	m.applyQuality(c, spec, errors.New(c.Last.Error), now)
+}
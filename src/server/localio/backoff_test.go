@@ -0,0 +1,68 @@
+package localio
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestReadBackoff(t *testing.T) {
+	configtest.Isolate(t)
+
+	handler := &MockClientHandler{}
+	failing := false
+	reads := make(map[byte]int)
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			reads[handler.SlaveID]++
+			if handler.SlaveID == 1 && failing {
+				return nil, errors.New("timeout")
+			}
+			return []byte{0}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) { return handler, nil }
+	mgr.readRetryMax = time.Second
+	bad, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 2, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	clear(reads)
+	failing = true
+
+	// A single failure is retried on the next cycle, the second one backs off
+	mgr.ReadAllAndProcessWrites()
+	mgr.ReadAllAndProcessWrites()
+	if c, _ := mgr.GetCard(bad.ID); c.RetryAt.IsZero() {
+		t.Fatal("Expected a retry time after two failed reads")
+	}
+	mgr.ReadAllAndProcessWrites()
+	mgr.ReadAllAndProcessWrites()
+	if reads[1] != 2 || reads[2] != 4 {
+		t.Errorf("Expected the failing card read twice and the healthy card every cycle, got %v", reads)
+	}
+	if c, _ := mgr.GetCard(bad.ID); c.Last.Quality == nil || c.Last.Quality.DI[0] != QualityStale {
+		t.Errorf("Expected stale quality while the read is skipped, got %+v", c.Last.Quality)
+	}
+
+	// The retry after the delay reads the card again; the first success ends the backoff
+	time.Sleep(260 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if reads[1] != 3 {
+		t.Errorf("Expected the failing card retried after the delay, got %v", reads)
+	}
+	failing = false
+	time.Sleep(510 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	mgr.ReadAllAndProcessWrites()
+	if c, _ := mgr.GetCard(bad.ID); reads[1] != 5 || !c.RetryAt.IsZero() || c.Last.Error != "" {
+		t.Errorf("Expected the card back on cadence, got %d reads, retry at %v, error %q", reads[1], c.RetryAt, c.Last.Error)
+	}
+}
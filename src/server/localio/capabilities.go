@@ -0,0 +1,80 @@
+package localio
+
+// CardCapabilities describes what a card supports, so generic clients can adapt to a card without knowing
+// its model
+type CardCapabilities struct {
+	// Channel counts of the model
+	DI int `json:"di"`
+	DO int `json:"do"`
+	AI int `json:"ai"`
+	AO int `json:"ao"`
+	// AOModes are the modes the AO channels can be switched to with write-aotype
+	AOModes []string `json:"aoModes,omitempty"`
+	Reboot  bool     `json:"reboot"`
+	// SerialNumber is set if the card reports a serial number (duplicate slave ID detection, replacement)
+	SerialNumber bool `json:"serialNumber"`
+	// BaudChange is set if the RS485 baud rate of the card can be changed over the bus
+	BaudChange bool `json:"baudChange"`
+	// Counters is how the pulses of the DI channels are captured for pulse_channels: "latch" in hardware
+	// or "sub-poll" ("" without DI channels)
+	Counters string `json:"counters,omitempty"`
+	// Registers are the Modbus registers of the card that can be written
+	Registers []WritableRegister `json:"registers"`
+}
+
+// WritableRegister is a range of Modbus registers of a card that can be written
+type WritableRegister struct {
+	Table       string `json:"table"` // "coil" or "holding"
+	Address     int    `json:"address"`
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+}
+
+// CapabilityDescriber is implemented by drivers that describe what their devices support beyond the
+// channel layout and the optional driver interfaces: AO modes, baud rate changes and writable registers
+type CapabilityDescriber interface {
+	Capabilities(spec ModelSpec) CardCapabilities
+}
+
+// cardCapabilities returns the capabilities of a card of a driver and model
+func cardCapabilities(d CardDriver, spec ModelSpec) *CardCapabilities {
+	var caps CardCapabilities
+	if cd, ok := d.(CapabilityDescriber); ok {
+		caps = cd.Capabilities(spec)
+	}
+	caps.DI, caps.DO, caps.AI, caps.AO = spec.DI, spec.DO, spec.AI, spec.AO
+	_, caps.Reboot = d.(CardRebooter)
+	_, caps.SerialNumber = d.(SerialNumberReader)
+	caps.Counters = ""
+	if spec.DI > 0 {
+		caps.Counters = PulseCaptureSubPoll
+		if _, ok := d.(DILatchReader); ok {
+			caps.Counters = PulseCaptureLatch
+		}
+	}
+	if caps.Registers == nil {
+		caps.Registers = []WritableRegister{}
+	}
+	return &caps
+}
+
+// Capabilities describes the AO modes, baud rate register and writable registers of a JasperMate IO card
+func (ioCardDriver) Capabilities(spec ModelSpec) CardCapabilities {
+	caps := CardCapabilities{
+		BaudChange: true,
+		Registers: []WritableRegister{
+			{Table: "holding", Address: 0x0010, Count: 1, Description: "Reboot (write 0xFF00)"},
+			{Table: "holding", Address: baudRateRegAddr, Count: baudRateRegCount, Description: "RS485 baud rate (uint32, applied after a reboot)"},
+		},
+	}
+	if spec.DO > 0 {
+		caps.Registers = append(caps.Registers, WritableRegister{Table: "coil", Address: 0, Count: spec.DO, Description: "DO states"})
+	}
+	if spec.AO > 0 {
+		caps.AOModes = []string{"0-10V", "4-20mA"}
+		caps.Registers = append(caps.Registers,
+			WritableRegister{Table: "holding", Address: 0, Count: spec.AO * 2, Description: "AO values (float32, 2 registers per channel)"},
+			WritableRegister{Table: "holding", Address: aoTypeRegAddr, Count: spec.AO, Description: "AO types (1 = 0-10V, 4 = 4-20mA)"})
+	}
+	return caps
+}
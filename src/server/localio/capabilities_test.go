@@ -0,0 +1,34 @@
+package localio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCardCapabilities(t *testing.T) {
+	caps := cardCapabilities(ioCardDriver{}, ModelTable["IO0404"])
+	if caps.AI != 4 || caps.AO != 4 || caps.DI != 0 || !caps.Reboot || !caps.SerialNumber || !caps.BaudChange {
+		t.Errorf("Unexpected IO0404 capabilities %+v", caps)
+	}
+	if !reflect.DeepEqual(caps.AOModes, []string{"0-10V", "4-20mA"}) || caps.Counters != "" {
+		t.Errorf("Expected the AO modes and no counters, got %+v", caps)
+	}
+	var tables []string
+	for _, r := range caps.Registers {
+		tables = append(tables, r.Table)
+	}
+	if !reflect.DeepEqual(tables, []string{"holding", "holding", "holding", "holding"}) {
+		t.Errorf("Expected reboot, baud rate, AO value and AO type registers, got %+v", caps.Registers)
+	}
+
+	caps = cardCapabilities(ioCardDriver{}, ModelTable["IO4040"])
+	if caps.Counters != PulseCaptureSubPoll || caps.AOModes != nil || len(caps.Registers) != 3 {
+		t.Errorf("Unexpected IO4040 capabilities %+v", caps)
+	}
+
+	// A driver without a description only reports what its interfaces tell
+	caps = cardCapabilities(testMeter, testMeter.Models()[0])
+	if caps.DO != 1 || caps.AI != 2 || caps.Reboot || caps.SerialNumber || caps.BaudChange || caps.Registers == nil || len(caps.Registers) != 0 {
+		t.Errorf("Unexpected meter capabilities %+v", caps)
+	}
+}
@@ -0,0 +1,221 @@
+package localio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// commissioningFile is the file in the data directory the commissioning progress is persisted to
+const commissioningFile = "commissioning.json"
+
+// Commissioning states of a channel
+const (
+	CommissioningPending  = "pending"
+	CommissioningVerified = "verified" // The field device reacted as expected
+	CommissioningFailed   = "failed"   // The field device didn't react; Note says why
+)
+
+var commissioningChannelPattern = regexp.MustCompile(`^(di|do|ai|ao)([0-9]+)$`)
+
+// ChannelCheck is the commissioning state of one channel
+type ChannelCheck struct {
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	// Value is the channel's value when it was marked, e.g. the DO state the operator switched to
+	Value interface{} `json:"value,omitempty"`
+	By    string      `json:"by,omitempty"` // Operator name as given, or the API client
+	Note  string      `json:"note,omitempty"`
+	Time  time.Time   `json:"time,omitempty"`
+}
+
+// CardCommissioning is the commissioning state of the channels of a card
+type CardCommissioning struct {
+	CardID       string         `json:"cardId"`
+	Module       string         `json:"module"`
+	SerialNumber string         `json:"serialNumber,omitempty"`
+	PortPath     string         `json:"portPath"`
+	SlaveID      byte           `json:"slaveId"`
+	Channels     []ChannelCheck `json:"channels"`
+}
+
+// CommissioningSummary counts the channels by state
+type CommissioningSummary struct {
+	Total    int `json:"total"`
+	Verified int `json:"verified"`
+	Failed   int `json:"failed"`
+	Pending  int `json:"pending"`
+}
+
+// CommissioningReport is the commissioning checklist of the device, structured for printing
+type CommissioningReport struct {
+	DeviceID    string    `json:"deviceId"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Complete is set once every channel is verified
+	Complete bool                 `json:"complete"`
+	Summary  CommissioningSummary `json:"summary"`
+	Cards    []CardCommissioning  `json:"cards"`
+}
+
+func commissioningPath() string {
+	return filepath.Join(config.DataDir(), commissioningFile)
+}
+
+// loadCommissioning reads the persisted commissioning progress, by card key (see relayKey) and channel
+func loadCommissioning() map[string]map[string]ChannelCheck {
+	checks := make(map[string]map[string]ChannelCheck)
+	data, err := os.ReadFile(commissioningPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("commissioning progress not loaded: %v", err)
+		}
+		return checks
+	}
+	if err := json.Unmarshal(data, &checks); err != nil {
+		log.Printf("commissioning progress not loaded: %v", err)
+		return make(map[string]map[string]ChannelCheck)
+	}
+	return checks
+}
+
+// saveCommissioningLocked persists the commissioning progress; the caller must hold m.mu
+func (m *Manager) saveCommissioningLocked() error {
+	data, err := json.MarshalIndent(m.commissioning, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := commissioningPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// MarkChannel records the commissioning state of a channel (di<n>, do<n>, ai<n> or ao<n>) of a card, with
+// its current value. Progress is kept per physical card, so it survives rediscovery.
+func (m *Manager) MarkChannel(cardID, channel, status, by, note string) (ChannelCheck, error) {
+	switch status {
+	case CommissioningPending, CommissioningVerified, CommissioningFailed:
+	default:
+		return ChannelCheck{}, errorf(CodeInvalidRequest, "invalid status %q (use verified, failed or pending)", status)
+	}
+	c, ok := m.GetCard(cardID)
+	if !ok {
+		return ChannelCheck{}, errorf(CodeCardNotFound, "card %s not found", cardID).with("cardId", cardID)
+	}
+	match := commissioningChannelPattern.FindStringSubmatch(channel)
+	if match == nil {
+		return ChannelCheck{}, errorf(CodeInvalidRequest, "invalid channel %q (use di<n>, do<n>, ai<n> or ao<n>, e.g. do0)", channel)
+	}
+	index, _ := strconv.Atoi(match[2])
+	if index >= channelCount(cardSpec(c), match[1]) {
+		return ChannelCheck{}, errorf(CodeIndexOutOfRange, "%s index %d out of range", match[1], index).with("channel", channel)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	check := ChannelCheck{Channel: channel, Status: status, Value: channelValue(c.Last, match[1], index), By: by, Note: note, Time: time.Now()}
+	key := relayKey(c)
+	if m.commissioning[key] == nil {
+		m.commissioning[key] = make(map[string]ChannelCheck)
+	}
+	if status == CommissioningPending {
+		delete(m.commissioning[key], channel)
+	} else {
+		m.commissioning[key][channel] = check
+	}
+	if err := m.saveCommissioningLocked(); err != nil {
+		return ChannelCheck{}, fmt.Errorf("save commissioning progress: %w", err)
+	}
+	return check, nil
+}
+
+// ResetCommissioning clears the commissioning progress of every card
+func (m *Manager) ResetCommissioning() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commissioning = make(map[string]map[string]ChannelCheck)
+	return m.saveCommissioningLocked()
+}
+
+// GetCommissioningReport returns the commissioning state of every channel of every card
+func (m *Manager) GetCommissioningReport() CommissioningReport {
+	cards := m.GetAllCards()
+	report := CommissioningReport{DeviceID: config.GetDeviceID(), GeneratedAt: time.Now(), Cards: []CardCommissioning{}}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range cards {
+		card := CardCommissioning{CardID: c.ID, Module: c.Module, SerialNumber: c.Last.SerialNumber, PortPath: c.PortPath, SlaveID: c.SlaveID, Channels: []ChannelCheck{}}
+		checks := m.commissioning[relayKey(c)]
+		spec := cardSpec(c)
+		for _, kind := range []string{"di", "do", "ai", "ao"} {
+			for i := 0; i < channelCount(spec, kind); i++ {
+				name := kind + strconv.Itoa(i)
+				check, ok := checks[name]
+				if !ok {
+					check = ChannelCheck{Channel: name, Status: CommissioningPending}
+				}
+				card.Channels = append(card.Channels, check)
+				report.Summary.Total++
+				switch check.Status {
+				case CommissioningVerified:
+					report.Summary.Verified++
+				case CommissioningFailed:
+					report.Summary.Failed++
+				default:
+					report.Summary.Pending++
+				}
+			}
+		}
+		report.Cards = append(report.Cards, card)
+	}
+	report.Complete = report.Summary.Total > 0 && report.Summary.Verified == report.Summary.Total
+	return report
+}
+
+// channelCount returns the number of channels of a kind (di, do, ai, ao) of a model
+func channelCount(spec ModelSpec, kind string) int {
+	switch kind {
+	case "di":
+		return spec.DI
+	case "do":
+		return spec.DO
+	case "ai":
+		return spec.AI
+	case "ao":
+		return spec.AO
+	}
+	return 0
+}
+
+// channelValue returns the value of a channel in a card state (nil if it wasn't read)
+func channelValue(s CardState, kind string, index int) interface{} {
+	switch kind {
+	case "di":
+		if index < len(s.DI) {
+			return s.DI[index]
+		}
+	case "do":
+		if index < len(s.DO) {
+			return s.DO[index]
+		}
+	case "ai":
+		if index < len(s.AI) {
+			return s.AI[index]
+		}
+	case "ao":
+		if index < len(s.AO) {
+			return s.AO[index]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestCommissioning(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	report := mgr.GetCommissioningReport()
+	if len(report.Cards) != 1 || report.Summary.Total != 8 || report.Summary.Pending != 8 || report.Complete {
+		t.Fatalf("Expected 8 pending channels, got %+v", report.Summary)
+	}
+
+	check, err := mgr.MarkChannel("1", "do2", CommissioningVerified, "jane", "pump starts")
+	if err != nil {
+		t.Fatalf("MarkChannel failed: %v", err)
+	}
+	if check.Value != false || check.By != "jane" || check.Time.IsZero() {
+		t.Errorf("Expected the DO value and operator recorded, got %+v", check)
+	}
+	if _, err := mgr.MarkChannel("1", "di1", CommissioningFailed, "jane", "no signal"); err != nil {
+		t.Fatalf("MarkChannel failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		card, channel, status string
+		code                  ErrorCode
+	}{
+		{"9", "do0", CommissioningVerified, CodeCardNotFound},
+		{"1", "do9", CommissioningVerified, CodeIndexOutOfRange},
+		{"1", "x0", CommissioningVerified, CodeInvalidRequest},
+		{"1", "do0", "done", CodeInvalidRequest},
+	} {
+		if _, err := mgr.MarkChannel(tt.card, tt.channel, tt.status, "", ""); ErrorCodeOf(err) != tt.code {
+			t.Errorf("MarkChannel(%s, %s, %s): expected %s, got %v", tt.card, tt.channel, tt.status, tt.code, err)
+		}
+	}
+
+	// Progress is persisted and kept for the physical card
+	restarted := newMockManager(&MockClient{})
+	restarted.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	report = restarted.GetCommissioningReport()
+	if report.Summary.Verified != 1 || report.Summary.Failed != 1 || report.Summary.Pending != 6 {
+		t.Errorf("Expected the progress to be restored, got %+v", report.Summary)
+	}
+	if ch := report.Cards[0].Channels[6]; ch.Channel != "do2" || ch.Status != CommissioningVerified || ch.Note != "pump starts" {
+		t.Errorf("Expected do2 verified, got %+v", ch)
+	}
+
+	restarted.MarkChannel("1", "di1", CommissioningPending, "", "")
+	if report = restarted.GetCommissioningReport(); report.Summary.Pending != 7 {
+		t.Errorf("Expected di1 pending again, got %+v", report.Summary)
+	}
+	if err := restarted.ResetCommissioning(); err != nil {
+		t.Fatalf("ResetCommissioning failed: %v", err)
+	}
+	if report = restarted.GetCommissioningReport(); report.Summary.Pending != 8 {
+		t.Errorf("Expected all channels pending after a reset, got %+v", report.Summary)
+	}
+}
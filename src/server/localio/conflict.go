@@ -0,0 +1,137 @@
+package localio
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Duplicate slave ID detection
+const (
+	// serialCheckInterval is how often the serial number of a healthy card is re-read
+	serialCheckInterval = 30 * time.Second
+	// serialConfirmReads is the number of consecutive identical serial numbers needed to accept a
+	// replaced card or to clear a conflict
+	serialConfirmReads = 10
+	// discoverySerialReads is the number of extra serial number reads when a card is added
+	discoverySerialReads = 2
+)
+
+// checkSerialNumber re-reads the serial number of a card to detect two physical cards answering on the
+// same slave ID. Their responses interleave, so the serial number alternates between reads.
+// A serial number that changes once and then stays stable is a replaced card, not a conflict.
+func (m *Manager) checkSerialNumber(c *Card, pc *portClient, now time.Time) {
+	sr, ok := cardDriver(c).(SerialNumberReader)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	due := c.Conflict != "" || c.pendingSerial != "" || c.Replacing != nil || now.Sub(c.lastSerialCheck) >= serialCheckInterval
+	m.mu.Unlock()
+	if !due {
+		return
+	}
+
+	sn := pc.readSlaveSerialNumber(sr, c.SlaveID)
+
+	m.mu.Lock()
+	c.lastSerialCheck = now
+	if sn == "" {
+		m.mu.Unlock()
+		return
+	}
+	known := c.Last.SerialNumber
+	var conflict, cleared bool
+	var replaced *CardReplacement
+	switch {
+	case c.Replacing != nil:
+		if r := c.Replacing; sn != r.OldSerial && (r.ExpectedSerial == "" || sn == r.ExpectedSerial) {
+			replaced = c.Replacing
+			replaced.NewSerial = sn
+			replaced.Completed = now
+			c.Replacing = nil
+			c.Last.SerialNumber = sn
+			c.Conflict = ""
+		}
+	case known == "":
+		c.Last.SerialNumber = sn
+	case c.Conflict != "":
+		if sn != known {
+			c.serialMatches = 0
+		} else if c.serialMatches++; c.serialMatches >= serialConfirmReads {
+			c.Conflict = ""
+			c.serialMatches = 0
+			cleared = true
+		}
+	case sn == known:
+		if c.pendingSerial != "" {
+			// Back to the old serial number after seeing another one: two cards are answering
+			conflict = true
+			c.Conflict = fmt.Sprintf("slave ID %d answered with serial numbers %s and %s", c.SlaveID, known, c.pendingSerial)
+		}
+	case c.pendingSerial == "" || c.pendingSerial == sn:
+		c.pendingSerial = sn
+		if c.serialMatches++; c.serialMatches >= serialConfirmReads {
+			log.Printf("card %s: serial number changed from %s to %s (card replaced)", c.ID, known, sn)
+			c.Last.SerialNumber = sn
+			c.pendingSerial = ""
+			c.serialMatches = 0
+		}
+	default:
+		// A third serial number
+		conflict = true
+		c.Conflict = fmt.Sprintf("slave ID %d answered with serial numbers %s, %s and %s", c.SlaveID, known, c.pendingSerial, sn)
+	}
+	if conflict {
+		c.pendingSerial = ""
+		c.serialMatches = 0
+	}
+	message := c.Conflict
+	m.mu.Unlock()
+
+	if conflict {
+		m.raiseSlaveConflict(c, message)
+	}
+	if replaced != nil {
+		m.completeReplacement(c, *replaced)
+	}
+	if cleared {
+		log.Printf("card %s: slave ID conflict cleared", c.ID)
+	}
+}
+
+// checkSerialAtDiscovery re-reads the serial number of a newly added card a few times and flags a
+// conflict if the answers differ
+func (m *Manager) checkSerialAtDiscovery(c *Card, pc *portClient, first string) {
+	sr, ok := cardDriver(c).(SerialNumberReader)
+	if first == "" || !ok {
+		return
+	}
+	for i := 0; i < discoverySerialReads; i++ {
+		sn := pc.readSlaveSerialNumber(sr, c.SlaveID)
+		if sn == "" || sn == first {
+			continue
+		}
+		message := fmt.Sprintf("slave ID %d answered with serial numbers %s and %s", c.SlaveID, first, sn)
+		m.mu.Lock()
+		c.Conflict = message
+		m.mu.Unlock()
+		m.raiseSlaveConflict(c, message)
+		return
+	}
+}
+
+// cardConflict returns the conflict message of a card ("" if none)
+func (m *Manager) cardConflict(c *Card) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return c.Conflict
+}
+
+func (m *Manager) raiseSlaveConflict(c *Card, message string) {
+	m.emitEvent(EventSlaveConflict, c.ID, map[string]interface{}{
+		"slaveId":  c.SlaveID,
+		"portPath": c.PortPath,
+		"message":  message,
+	})
+}
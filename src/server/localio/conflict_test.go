@@ -0,0 +1,90 @@
+package localio
+
+import (
+	"testing"
+	"time"
+)
+
+// serialClient returns a mock client whose serial number register answers with the next entry of serials
+func serialClient(serials *[]string) *MockClient {
+	return &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			raw := make([]byte, quantity*2)
+			if address == 0x0070 && len(*serials) > 0 {
+				copy(raw, (*serials)[0])
+				if len(*serials) > 1 {
+					*serials = (*serials)[1:]
+				}
+			}
+			return raw, nil
+		},
+	}
+}
+
+func TestSlaveConflict_Discovery(t *testing.T) {
+	serials := []string{"SN-A", "SN-B"}
+	mgr := newMockManager(serialClient(&serials))
+	var events []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventSlaveConflict {
+			events = append(events, ev)
+		}
+	})
+
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if card.Conflict == "" {
+		t.Fatal("Expected conflict after discovery")
+	}
+	if len(events) != 1 || events[0].Type != EventSlaveConflict {
+		t.Errorf("Expected slave-conflict event, got %+v", events)
+	}
+
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	if results[0].Code != CodeSlaveConflict {
+		t.Errorf("Expected write rejected with %s, got %+v", CodeSlaveConflict, results[0])
+	}
+}
+
+func TestSlaveConflict_Operation(t *testing.T) {
+	serials := []string{"SN-A"}
+	mgr := newMockManager(serialClient(&serials))
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if card.Conflict != "" {
+		t.Fatalf("Unexpected conflict: %s", card.Conflict)
+	}
+	pc, _ := mgr.ensurePort(card.PortPath)
+	now := time.Now().Add(time.Hour)
+
+	// Alternating serial numbers: conflict
+	serials = []string{"SN-B", "SN-A", "SN-A"}
+	mgr.checkSerialNumber(card, pc, now)
+	mgr.checkSerialNumber(card, pc, now)
+	if card.Conflict == "" {
+		t.Fatal("Expected conflict after alternating serial numbers")
+	}
+
+	// Stable again: the conflict clears
+	for i := 0; i < serialConfirmReads; i++ {
+		mgr.checkSerialNumber(card, pc, now)
+	}
+	if card.Conflict != "" {
+		t.Errorf("Expected conflict to clear, got %s", card.Conflict)
+	}
+
+	// A replaced card: the new serial number is accepted without a conflict
+	serials = []string{"SN-C"}
+	for i := 1; i <= serialConfirmReads; i++ {
+		mgr.checkSerialNumber(card, pc, now.Add(time.Duration(i)*serialCheckInterval))
+	}
+	if card.Conflict != "" || card.Last.SerialNumber != "SN-C" {
+		t.Errorf("Expected replaced card SN-C without conflict, got serial %s conflict %q", card.Last.SerialNumber, card.Conflict)
+	}
+}
@@ -0,0 +1,107 @@
+package localio
+
+import "time"
+
+// consumerIdleAfter is how long a polling consumer (an HTTP client reading card states) counts as
+// active after its last read
+const consumerIdleAfter = 30 * time.Second
+
+// AttachConsumer registers a consumer of card states, e.g. the TCP client, until the returned function
+// is called. The cycle runs at cycle_delay_ms while a consumer is active and slows down to
+// idle_cycle_delay_ms otherwise; attaching wakes an idle cycle right away.
+func (m *Manager) AttachConsumer(name string) (detach func()) {
+	m.mu.Lock()
+	m.consumers[name]++
+	m.mu.Unlock()
+	m.wakeCycle()
+
+	detached := false
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if detached {
+			return
+		}
+		detached = true
+		if m.consumers[name]--; m.consumers[name] <= 0 {
+			delete(m.consumers, name)
+		}
+	}
+}
+
+// TouchConsumer marks a polling consumer as active for consumerIdleAfter, waking an idle cycle
+func (m *Manager) TouchConsumer(name string) {
+	now := time.Now()
+	m.mu.Lock()
+	wasActive := m.consumersActiveLocked(now)
+	m.polled[name] = now
+	m.mu.Unlock()
+	if !wasActive {
+		m.wakeCycle()
+	}
+}
+
+// consumersActiveLocked reports whether the cycle has to run at full rate: a consumer is attached or
+// polled recently, PID loops or scripts run on the cycle, AO ramps are in progress, a heartbeat output
+// is toggled, or the service itself acts on the inputs: priority or pulse channels, alarm rules,
+// interlocks on an input, schedules, or a running sequence waiting for a DI
+func (m *Manager) consumersActiveLocked(now time.Time) bool {
+	if len(m.consumers) > 0 || len(m.pidLoops) > 0 || len(m.scripts) > 0 || len(m.ramps) > 0 || m.heartbeat.Card != "" {
+		return true
+	}
+	if len(m.priority) > 0 || len(m.pulse) > 0 || len(m.schedules) > 0 {
+		return true
+	}
+	for _, rule := range m.interlocks {
+		if rule.Input.Card != "" {
+			return true
+		}
+	}
+	for _, a := range m.alarms {
+		if !a.system {
+			return true
+		}
+	}
+	for _, run := range m.sequenceRuns {
+		if run.status == SequenceRunning && run.waitsDI {
+			return true
+		}
+	}
+	for _, t := range m.polled {
+		if now.Sub(t) < consumerIdleAfter {
+			return true
+		}
+	}
+	return false
+}
+
+// cycleWait returns the pause after a read-write cycle
+func (m *Manager) cycleWait() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.idleCycleDelay <= m.cycleDelay || m.consumersActiveLocked(time.Now()) {
+		return m.cycleDelay
+	}
+	return m.idleCycleDelay
+}
+
+// wakeCycle ends the pause of an idle cycle
+func (m *Manager) wakeCycle() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pauseCycle waits the pause after a cycle; it returns false when the cycle is stopped
+func (m *Manager) pauseCycle() bool {
+	timer := time.NewTimer(m.cycleWait())
+	defer timer.Stop()
+	select {
+	case <-m.stopChan:
+		return false
+	case <-m.wake:
+	case <-timer.C:
+	}
+	return true
+}
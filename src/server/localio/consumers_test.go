@@ -0,0 +1,95 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestConsumers_AdaptiveCycle(t *testing.T) {
+	configtest.Isolate(t)
+	mgr := newMockManager(&MockClient{})
+	mgr.cycleDelay = 10 * time.Millisecond
+	mgr.idleCycleDelay = time.Hour
+
+	if d := mgr.cycleWait(); d != time.Hour {
+		t.Errorf("Expected the idle delay without consumers, got %v", d)
+	}
+
+	detach := mgr.AttachConsumer("tcp")
+	if d := mgr.cycleWait(); d != 10*time.Millisecond {
+		t.Errorf("Expected the full rate with a TCP client, got %v", d)
+	}
+	detach()
+	detach()
+	if d := mgr.cycleWait(); d != time.Hour {
+		t.Errorf("Expected the idle delay after detaching, got %v", d)
+	}
+
+	mgr.TouchConsumer("http:10.0.0.9")
+	if d := mgr.cycleWait(); d != 10*time.Millisecond {
+		t.Errorf("Expected the full rate after an HTTP read, got %v", d)
+	}
+	mgr.polled["http:10.0.0.9"] = time.Now().Add(-consumerIdleAfter)
+	if d := mgr.cycleWait(); d != time.Hour {
+		t.Errorf("Expected the idle delay once the HTTP client stopped polling, got %v", d)
+	}
+
+	// An attaching consumer ends the idle pause right away
+	done := make(chan bool)
+	go func() { done <- mgr.pauseCycle() }()
+	time.Sleep(10 * time.Millisecond)
+	defer mgr.AttachConsumer("tcp")()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("Expected the pause to end without stopping the cycle")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the idle pause to end when a consumer attaches")
+	}
+}
+
+func TestConsumers_FullRateFeatures(t *testing.T) {
+	configtest.Isolate(t)
+	mgr := newMockManager(&MockClient{})
+	mgr.cycleDelay = 10 * time.Millisecond
+	mgr.idleCycleDelay = time.Hour
+
+	features := map[string]func(){
+		"priority channels": func() { mgr.priority = []config.InputChannel{{Card: "1", Channel: "di0"}} },
+		"pulse channels":    func() { mgr.pulse = []config.InputChannel{{Card: "1", Channel: "di0"}} },
+		"schedules":         func() { mgr.schedules = []config.Schedule{{Name: "lights", Card: "1"}} },
+		"interlock input": func() {
+			mgr.interlocks = []config.InterlockRule{{Name: "door", Type: "requires", Input: config.ChannelRef{Card: "1"}}}
+		},
+		"alarm rule": func() { mgr.alarms["high"] = &alarmState{rule: config.AlarmRule{Name: "high", Card: "1"}} },
+		"wait-di sequence": func() {
+			mgr.sequenceRuns["start"] = &sequenceRun{status: SequenceRunning, waitsDI: true}
+		},
+	}
+	for name, enable := range features {
+		mgr.mu.Lock()
+		mgr.priority, mgr.pulse, mgr.schedules, mgr.interlocks = nil, nil, nil, nil
+		mgr.alarms = make(map[string]*alarmState)
+		mgr.sequenceRuns = make(map[string]*sequenceRun)
+		enable()
+		mgr.mu.Unlock()
+		if d := mgr.cycleWait(); d != 10*time.Millisecond {
+			t.Errorf("Expected the full rate with %s, got %v", name, d)
+		}
+	}
+
+	// Exclusive interlocks, system alarms and sequences without wait-di steps don't read inputs
+	mgr.mu.Lock()
+	mgr.priority, mgr.pulse, mgr.schedules = nil, nil, nil
+	mgr.interlocks = []config.InterlockRule{{Name: "pumps", Type: "exclusive"}}
+	mgr.alarms = map[string]*alarmState{SafeStateAlarm: {system: true}}
+	mgr.sequenceRuns = map[string]*sequenceRun{"fill": {status: SequenceRunning}}
+	mgr.mu.Unlock()
+	if d := mgr.cycleWait(); d != time.Hour {
+		t.Errorf("Expected the idle delay, got %v", d)
+	}
+}
@@ -0,0 +1,142 @@
+package localio
+
+import (
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// deliveryHistorySize is the number of notification deliveries kept
+const deliveryHistorySize = 100
+
+// EventNotificationTest is the type of the synthetic event sent by TestNotifications
+const EventNotificationTest = "notification-test"
+
+// Notification delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Notification delivery kinds
+const (
+	DeliveryAlarm = "alarm" // Escalation of an unacknowledged alarm
+	DeliveryEvent = "event" // Event forwarded to a channel subscribed to its severity
+	DeliveryTest  = "test"  // Synthetic event sent by TestNotifications
+)
+
+// notifyRetryDelays are the waits before the retries of a failed alarm or event delivery
+var notifyRetryDelays = []time.Duration{10 * time.Second, time.Minute}
+
+// NotificationDelivery is a message sent to a notification channel and its attempts
+type NotificationDelivery struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"` // When the delivery started
+	Channel string    `json:"channel"`
+	Type    string    `json:"type"` // Channel type: webhook, slack or email
+	Kind    string    `json:"kind"` // alarm, event or test
+	Subject string    `json:"subject"`
+	Status  string    `json:"status"` // pending, retrying, delivered or failed
+	// Retries is the number of attempts after the first; Error is the error of the last failed attempt
+	Retries     int       `json:"retries"`
+	Error       string    `json:"error,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+}
+
+// GetNotificationDeliveries returns the recent notification deliveries, newest first
+func (m *Manager) GetNotificationDeliveries() []NotificationDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]NotificationDelivery, 0, len(m.deliveries))
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		out = append(out, *m.deliveries[i])
+	}
+	return out
+}
+
+// TestNotifications sends a synthetic notification-test event to every notification channel, or to the
+// named one, whatever events the channels subscribe to. The channels are tried once, without retries, and
+// the deliveries are returned once all of them completed.
+func (m *Manager) TestNotifications(channel string) ([]NotificationDelivery, error) {
+	m.mu.Lock()
+	var channels []config.NotificationChannel
+	for _, ch := range m.notifications.Channels {
+		if channel == "" || ch.Name == channel {
+			channels = append(channels, ch)
+		}
+	}
+	m.mu.Unlock()
+	if channel != "" && len(channels) == 0 {
+		return nil, errorf(CodeNotFound, "notification channel %q not found", channel).with("channel", channel)
+	}
+
+	msg := eventMessage(Event{
+		Type:     EventNotificationTest,
+		Severity: SeverityInfo,
+		Time:     time.Now(),
+		Data: map[string]interface{}{
+			"deviceId": config.GetDeviceID(),
+			"message":  "Test notification from JasperMate Utils",
+		},
+	})
+	out := make([]NotificationDelivery, len(channels))
+	var wg sync.WaitGroup
+	for i, ch := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = m.deliver(ch, msg, DeliveryTest, nil)
+		}()
+	}
+	wg.Wait()
+	return out, nil
+}
+
+// deliver sends a message to a channel, retrying a failed attempt after each of the retry delays, and
+// records the delivery. It returns once the message was delivered or the retries are exhausted.
+func (m *Manager) deliver(ch config.NotificationChannel, msg message, kind string, retries []time.Duration) NotificationDelivery {
+	m.mu.Lock()
+	send := m.notify
+	server := m.notifications.SMTP
+	m.deliverySeq++
+	d := &NotificationDelivery{
+		ID:      m.deliverySeq,
+		Time:    time.Now(),
+		Channel: ch.Name,
+		Type:    ch.Type,
+		Kind:    kind,
+		Subject: msg.subject,
+		Status:  DeliveryPending,
+	}
+	m.deliveries = append(m.deliveries, d)
+	if len(m.deliveries) > deliveryHistorySize {
+		m.deliveries = m.deliveries[len(m.deliveries)-deliveryHistorySize:]
+	}
+	m.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		err := send(ch, server, msg)
+
+		m.mu.Lock()
+		d.Retries = attempt
+		d.LastAttempt = time.Now()
+		switch {
+		case err == nil:
+			d.Status, d.Error = DeliveryDelivered, ""
+		case attempt < len(retries):
+			d.Status, d.Error = DeliveryRetrying, err.Error()
+		default:
+			d.Status, d.Error = DeliveryFailed, err.Error()
+		}
+		result := *d
+		m.mu.Unlock()
+
+		if result.Status != DeliveryRetrying {
+			return result
+		}
+		time.Sleep(retries[attempt])
+	}
+}
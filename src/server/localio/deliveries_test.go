@@ -0,0 +1,74 @@
+package localio
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestNotificationDeliveries(t *testing.T) {
+	configtest.Isolate(t)
+	defer func(delays []time.Duration) { notifyRetryDelays = delays }(notifyRetryDelays)
+	notifyRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+
+	mgr := newMockManager(&MockClient{})
+	calls := make(map[string]int)
+	var subjects []string
+	mgr.notify = func(ch config.NotificationChannel, server config.SMTPServer, msg message) error {
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		calls[ch.Name]++
+		subjects = append(subjects, msg.subject)
+		if ch.Name == "broken" {
+			return errors.New("endpoint returned 500 Internal Server Error")
+		}
+		return nil
+	}
+	err := mgr.SetNotifications(config.Notifications{Channels: []config.NotificationChannel{
+		{Name: "hook", Type: NotifyWebhook, URL: "http://example.com/hook"},
+		{Name: "broken", Type: NotifyWebhook, URL: "http://example.com/broken", Events: SeverityCritical},
+	}})
+	if err != nil {
+		t.Fatalf("SetNotifications failed: %v", err)
+	}
+
+	// The test reaches every channel, once, whatever events it subscribes to
+	deliveries, err := mgr.TestNotifications("")
+	if err != nil {
+		t.Fatalf("TestNotifications failed: %v", err)
+	}
+	if len(deliveries) != 2 || deliveries[0].Status != DeliveryDelivered || deliveries[1].Status != DeliveryFailed ||
+		deliveries[1].Retries != 0 || deliveries[1].Error == "" || deliveries[0].Kind != DeliveryTest {
+		t.Errorf("Unexpected test deliveries: %+v", deliveries)
+	}
+	if subjects[0] != "[INFO] notification-test" {
+		t.Errorf("Expected the synthetic event, got %q", subjects[0])
+	}
+	if _, err := mgr.TestNotifications("missing"); ErrorCodeOf(err) != CodeNotFound {
+		t.Errorf("Expected NOT_FOUND for an unknown channel, got %v", err)
+	}
+
+	// Forwarded events are retried
+	mgr.forwardEvent(Event{Type: EventCardOffline, Severity: SeverityCritical, CardID: "1", Time: time.Now()})
+	deadline := time.Now().Add(2 * time.Second)
+	var last NotificationDelivery
+	for time.Now().Before(deadline) {
+		// The delivery is recorded by the sender goroutine, after the failed test delivery
+		last = mgr.GetNotificationDeliveries()[0]
+		if last.Kind == DeliveryEvent && last.Status == DeliveryFailed {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if last.Kind != DeliveryEvent || last.Status != DeliveryFailed || last.Retries != 2 || last.Channel != "broken" {
+		t.Errorf("Expected the event delivery failed after 2 retries, got %+v", last)
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if calls["broken"] != 4 {
+		t.Errorf("Expected 1 test and 3 event attempts, got %d", calls["broken"])
+	}
+}
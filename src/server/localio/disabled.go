@@ -0,0 +1,78 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// inputChannelPattern matches the input channel names of disabled_channels
+var inputChannelPattern = regexp.MustCompile(`^(di|ai)[0-9]+$`)
+
+// ValidateDisabledChannels checks disabled channel entries for missing cards and invalid channel names
+func ValidateDisabledChannels(channels []config.InputChannel) error {
+	var p configProblems
+	validateDisabledChannels(channels, &p)
+	return p.err()
+}
+
+func validateDisabledChannels(channels []config.InputChannel, p *configProblems) {
+	for i, ch := range channels {
+		path := fmt.Sprintf("disabled_channels[%d]", i)
+		if ch.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if !inputChannelPattern.MatchString(ch.Channel) {
+			p.add(path+".channel", "invalid channel %q (use di<n> or ai<n>, e.g. ai3)", ch.Channel)
+		}
+	}
+}
+
+// GetDisabledChannels returns the input channels excluded from polling
+func (m *Manager) GetDisabledChannels() []config.InputChannel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channels := make([]config.InputChannel, len(m.disabled))
+	copy(channels, m.disabled)
+	return channels
+}
+
+// SetDisabledChannels validates, activates, and persists the input channels excluded from polling.
+// The change applies from the next poll cycle.
+func (m *Manager) SetDisabledChannels(channels []config.InputChannel) error {
+	return m.SetDisabledChannelsContext(context.Background(), channels)
+}
+
+// SetDisabledChannelsContext is SetDisabledChannels with the change attributed in the config history to the
+// change of ctx (see config.WithChange)
+func (m *Manager) SetDisabledChannelsContext(ctx context.Context, channels []config.InputChannel) error {
+	if err := ValidateDisabledChannels(channels); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.disabled = channels
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.DisabledChannels = channels
+	})
+}
+
+// pollSpec returns the channel layout of a card with its disabled channels set
+func (m *Manager) pollSpec(c *Card) ModelSpec {
+	spec := cardSpec(c)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.disabled {
+		if ch.Card != c.ID {
+			continue
+		}
+		if spec.Disabled == nil {
+			spec.Disabled = make(map[string]bool)
+		}
+		spec.Disabled[ch.Channel] = true
+	}
+	return spec
+}
@@ -0,0 +1,71 @@
+package localio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestDisabledChannels(t *testing.T) {
+	configtest.Isolate(t)
+
+	var address, quantity uint16
+	client := &MockClient{
+		ReadInputRegistersFunc: func(addr, qty uint16) ([]byte, error) {
+			address, quantity = addr, qty
+			raw := make([]byte, qty*2)
+			for i := 0; i < int(qty)/2; i++ {
+				channel := int(addr)/2 + i
+				binary.BigEndian.PutUint32(raw[i*4:], math.Float32bits(float32(channel+1)))
+			}
+			return raw, nil
+		},
+		ReadHoldingRegistersFunc: func(addr, qty uint16) ([]byte, error) {
+			return make([]byte, qty*2), nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.SetDisabledChannels([]config.InputChannel{{Card: card.ID, Channel: "ao1"}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for an output channel, got %v", err)
+	}
+
+	// Only AI1 and AI2 are wired: the span AI1..AI2 is read
+	disabled := []config.InputChannel{{Card: card.ID, Channel: "ai0"}, {Card: card.ID, Channel: "ai3"}}
+	if err := mgr.SetDisabledChannels(disabled); err != nil {
+		t.Fatalf("SetDisabledChannels failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if address != 2 || quantity != 4 {
+		t.Errorf("Expected AI registers 2..5 read, got address %d quantity %d", address, quantity)
+	}
+	if ai := card.Last.AI; len(ai) != 4 || ai[0] != 0 || ai[1] != 2 || ai[2] != 3 || ai[3] != 0 {
+		t.Errorf("Expected AI [0 2 3 0], got %v", ai)
+	}
+	if q := card.Last.Quality.AI; q[0] != QualityDisabled || q[1] != QualityGood || q[3] != QualityDisabled {
+		t.Errorf("Expected AI0 and AI3 disabled, got %v", q)
+	}
+	if got := config.GetConfig().DisabledChannels; len(got) != 2 {
+		t.Errorf("Expected the disabled channels persisted, got %+v", got)
+	}
+
+	// With every AI disabled the AI read is skipped
+	address, quantity = 0, 0
+	for _, ch := range []string{"ai1", "ai2"} {
+		disabled = append(disabled, config.InputChannel{Card: card.ID, Channel: ch})
+	}
+	if err := mgr.SetDisabledChannels(disabled); err != nil {
+		t.Fatalf("SetDisabledChannels failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if quantity != 0 || len(card.Last.AI) != 4 {
+		t.Errorf("Expected no AI read and zero values, got quantity %d AI %v", quantity, card.Last.AI)
+	}
+}
@@ -0,0 +1,221 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// doSwitch is the state of a DO channel after its last switch and when it switched
+type doSwitch struct {
+	on bool
+	at time.Time
+}
+
+// shortCycle is a DO write within the minimum on/off time of its channel
+type shortCycle struct {
+	until   time.Time // When the write is allowed
+	delay   bool      // Hold the write back instead of rejecting it
+	message string
+	params  map[string]interface{} // Parameters of the message
+}
+
+// err is the SHORT_CYCLE error of a rejected write
+func (sc shortCycle) err() *Error {
+	return &Error{Code: CodeShortCycle, Message: sc.message, Params: sc.params}
+}
+
+// ValidateDOTimings checks minimum on/off time rules for missing channels, negative times, and unknown modes
+func ValidateDOTimings(rules []config.DOTiming) error {
+	var p configProblems
+	validateDOTimings(rules, &p)
+	return p.err()
+}
+
+func validateDOTimings(rules []config.DOTiming, p *configProblems) {
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		path := fmt.Sprintf("do_timings[%d]", i)
+		if rule.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if rule.Index < 0 {
+			p.add(path+".index", "must not be negative")
+		}
+		key := fmt.Sprintf("%s/%d", rule.Card, rule.Index)
+		if seen[key] {
+			p.add(path, "duplicate rule for card %s DO%d", rule.Card, rule.Index)
+		}
+		seen[key] = true
+		if rule.MinOnMs < 0 {
+			p.add(path+".min_on_ms", "must not be negative")
+		}
+		if rule.MinOffMs < 0 {
+			p.add(path+".min_off_ms", "must not be negative")
+		}
+		switch rule.Mode {
+		case "", config.DOTimingReject, config.DOTimingDelay:
+		default:
+			p.add(path+".mode", "unknown mode %q (use reject or delay)", rule.Mode)
+		}
+	}
+}
+
+// GetDOTimings returns the active minimum on/off time rules
+func (m *Manager) GetDOTimings() []config.DOTiming {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]config.DOTiming, len(m.doTimings))
+	copy(rules, m.doTimings)
+	return rules
+}
+
+// SetDOTimings validates, activates, and persists a new set of minimum on/off time rules
+func (m *Manager) SetDOTimings(rules []config.DOTiming) error {
+	return m.SetDOTimingsContext(context.Background(), rules)
+}
+
+// SetDOTimingsContext is SetDOTimings with the change attributed in the config history to the change of ctx
+// (see config.WithChange)
+func (m *Manager) SetDOTimingsContext(ctx context.Context, rules []config.DOTiming) error {
+	if err := ValidateDOTimings(rules); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.doTimings = rules
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.DOTimings = rules
+	})
+}
+
+// shortCycleLocked checks a DO write against the minimum on/off time of its channel; ok is false if the
+// write is allowed now. The caller must hold m.mu.
+func (m *Manager) shortCycleLocked(op writeOperation, now time.Time) (sc shortCycle, ok bool) {
+	if op.Type != writeOpDO || op.source.Kind == SourceSafeState {
+		return sc, false
+	}
+	var rule *config.DOTiming
+	for i := range m.doTimings {
+		if m.doTimings[i].Card == op.CardID && m.doTimings[i].Index == op.Index {
+			rule = &m.doTimings[i]
+			break
+		}
+	}
+	last, switched := m.doSwitches[op.CardID][op.Index]
+	on := op.Value != 0
+	if rule == nil || !switched || last.on == on {
+		return sc, false
+	}
+
+	minimum, name := time.Duration(rule.MinOffMs)*time.Millisecond, "min_off_ms"
+	if last.on {
+		minimum, name = time.Duration(rule.MinOnMs)*time.Millisecond, "min_on_ms"
+	}
+	elapsed := now.Sub(last.at)
+	if elapsed >= minimum {
+		return sc, false
+	}
+	sc.until = last.at.Add(minimum)
+	sc.delay = rule.Mode == config.DOTimingDelay
+	state := "off"
+	if last.on {
+		state = "on"
+	}
+	sc.message = fmt.Sprintf("DO%d switched %s %d ms ago, %s is %d", op.Index, state, elapsed.Milliseconds(), name, minimum.Milliseconds())
+	sc.params = map[string]interface{}{
+		"channel":   ChannelKey(writeOpDO, op.Index),
+		"state":     state,
+		"elapsedMs": elapsed.Milliseconds(),
+		"minimumMs": minimum.Milliseconds(),
+	}
+	if sc.delay {
+		sc.message = fmt.Sprintf("delayed until %s: %s", sc.until.Format(time.RFC3339Nano), sc.message)
+	}
+	return sc, true
+}
+
+// checkShortCycles evaluates the minimum on/off times of a batch of writes. Held back writes of the
+// channels written by the batch are dropped, except on a dry run: the batch supersedes them.
+func (m *Manager) checkShortCycles(ops []writeOperation, dry bool) map[int]shortCycle {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var out map[int]shortCycle
+	for i, op := range ops {
+		if op.Type != writeOpDO {
+			continue
+		}
+		if !dry {
+			m.dropHeldLocked(op.CardID, op.Index)
+		}
+		if sc, ok := m.shortCycleLocked(op, now); ok {
+			if out == nil {
+				out = make(map[int]shortCycle)
+			}
+			out[i] = sc
+		}
+	}
+	return out
+}
+
+// holdWrite queues a write held back by the minimum on/off time of its channel until it is allowed
+func (m *Manager) holdWrite(ctx context.Context, op writeOperation, until time.Time) *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op.notBefore = until
+	return m.enqueueLocked(ctx, op)
+}
+
+// dropHeldLocked removes the held back writes of a DO channel; the caller must hold m.mu
+func (m *Manager) dropHeldLocked(cardID string, index int) {
+	queue := m.writeQueue[:0]
+	for _, op := range m.writeQueue {
+		if !op.notBefore.IsZero() && op.Type == writeOpDO && op.CardID == cardID && op.Index == index {
+			m.dropOptimisticLocked(op)
+			continue
+		}
+		queue = append(queue, op)
+	}
+	m.writeQueue = queue
+}
+
+// recordSwitchLocked stores the time a DO channel switched; the caller must hold m.mu
+func (m *Manager) recordSwitchLocked(cardID string, index int, on bool, now time.Time) {
+	if last, ok := m.doSwitches[cardID][index]; ok && last.on == on {
+		return
+	}
+	if m.doSwitches[cardID] == nil {
+		m.doSwitches[cardID] = make(map[int]doSwitch)
+	}
+	m.doSwitches[cardID][index] = doSwitch{on: on, at: now}
+}
+
+// recordSwitches stores the switching time of the successful DO writes of a batch
+func (m *Manager) recordSwitches(ops []writeOperation, results []CommandResult, held map[int]shortCycle) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i, op := range ops {
+		if _, ok := held[i]; ok || op.Type != writeOpDO || i >= len(results) || results[i].Status != "ok" {
+			continue
+		}
+		m.recordSwitchLocked(op.CardID, op.Index, op.Value != 0, now)
+	}
+}
+
+// safeStateSwitched records the switch of the DOs of a card to safe state and drops their held back
+// writes, which must not re-energize outputs after safe state is applied
+func (m *Manager) safeStateSwitched(cardID string, states []bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i, on := range states {
+		m.recordSwitchLocked(cardID, i, on, now)
+		m.dropHeldLocked(cardID, i)
+	}
+}
@@ -0,0 +1,87 @@
+package localio
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestDOTimings(t *testing.T) {
+	configtest.Isolate(t)
+
+	coils := byte(0x00)
+	client := &MockClient{
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) {
+			return []byte{coils}, nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			mask := byte(1<<quantity-1) << address
+			coils = coils&^mask | value[0]<<address&mask
+			return nil, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.SetDOTimings([]config.DOTiming{{Card: card.ID, Index: 0, Mode: "later"}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for an unknown mode, got %v", err)
+	}
+	err = mgr.SetDOTimings([]config.DOTiming{
+		{Card: card.ID, Index: 0, MinOnMs: 3600000},
+		{Card: card.ID, Index: 1, MinOnMs: 50, Mode: config.DOTimingDelay},
+	})
+	if err != nil {
+		t.Fatalf("SetDOTimings failed: %v", err)
+	}
+
+	// DO0 is rejected while within its minimum on time; other channels are not limited
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	if results[0].Status != "ok" {
+		t.Fatalf("Expected the first switch to be accepted, got %+v", results[0])
+	}
+	results = mgr.ProcessBatchWrite([]WriteOperation{
+		{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 0},
+		{CardID: card.ID, Type: WriteOpDO, Index: 2, Value: 1},
+	})
+	if results[0].Code != CodeShortCycle || results[1].Status != "ok" {
+		t.Errorf("Expected DO0 SHORT_CYCLE and DO2 ok, got %+v", results)
+	}
+	if err := mgr.QueueWriteDO(card.ID, 0, false); ErrorCodeOf(err) != CodeShortCycle {
+		t.Errorf("Expected SHORT_CYCLE queueing DO0 off, got %v", err)
+	}
+
+	// DO1 switching off too early is held back until its minimum on time has passed
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1}})
+	results = mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 0}})
+	if results[0].Status != "ok" || !strings.HasPrefix(results[0].Message, "delayed") {
+		t.Errorf("Expected the write to be delayed, got %+v", results[0])
+	}
+	mgr.ReadAllAndProcessWrites()
+	pending := mgr.GetPendingWrites()
+	if len(pending) != 1 || pending[0].HeldUntil.IsZero() || coils&0x02 == 0 {
+		t.Fatalf("Expected DO1 on and the off write held, got coils %08b pending %+v", coils, pending)
+	}
+	time.Sleep(60 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if len(mgr.GetPendingWrites()) != 0 || coils&0x02 != 0 {
+		t.Errorf("Expected DO1 switched off after its minimum on time, got coils %08b", coils)
+	}
+
+	// Safe state is never held back and drops held writes
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1}})
+	time.Sleep(60 * time.Millisecond)
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 0}})
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1}})
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	if coils != 0 || len(mgr.GetPendingWrites()) != 0 {
+		t.Errorf("Expected all DOs off and no held writes after safe state, got coils %08b pending %+v", coils, mgr.GetPendingWrites())
+	}
+}
@@ -0,0 +1,194 @@
+package localio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// CardDriver reads and writes one family of Modbus devices. The manager polls every card through the
+// driver that detected it, so devices other than JasperMate IO cards (VFDs, meters, third-party relay
+// boards) can be added by compiling in a driver that calls RegisterDriver from an init function.
+//
+// Drivers expose their channels as DI/DO/AI/AO so cards of any driver work with the HTTP API, the TCP
+// protocol, PID loops, interlocks and sequences.
+type CardDriver interface {
+	// Name identifies the driver (e.g. "jaspermate-io")
+	Name() string
+	// Models lists the models of the driver. Model names must be unique across all drivers.
+	Models() []ModelSpec
+	// Probe detects the layout of the device on the bus. Name is one of the driver's models if the
+	// device is recognized; the channel counts are reported even if it is not.
+	Probe(bus *Bus) ModelSpec
+	// Read reads the channels of a card. full also reads the slow-changing data (AO types, serial
+	// number, baud rate), which is done when a card is added and after a reboot.
+	Read(bus *Bus, spec ModelSpec, full bool) (CardState, error)
+	// Write writes consecutive output channels. Unsupported writes return an INVALID_REQUEST error.
+	Write(bus *Bus, w OutputWrite) error
+}
+
+// CardRebooter is implemented by drivers whose devices can be restarted remotely
+type CardRebooter interface {
+	Reboot(bus *Bus) error
+}
+
+// SerialNumberReader is implemented by drivers whose devices report a serial number. It enables the
+// duplicate slave ID detection of the manager.
+type SerialNumberReader interface {
+	ReadSerialNumber(bus *Bus) string
+}
+
+// OutputWrite writes consecutive output channels starting at Start. The values slice matching Type
+// (DO, AO or AOType) is set.
+type OutputWrite struct {
+	Type   WriteOpType
+	Start  int
+	DO     []bool
+	AO     []float32
+	AOType []string
+}
+
+// Bus is a Modbus client addressed to one slave. Drivers get a Bus while the port is locked, so their
+// requests are never interleaved with other traffic on the port.
+type Bus struct {
+	modbus.Client
+	Slave          byte
+	operationDelay time.Duration
+}
+
+// Pause waits the delay required between two Modbus operations on RS485
+func (b *Bus) Pause() {
+	time.Sleep(b.operationDelay)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   []CardDriver
+)
+
+func init() {
+	RegisterDriver(ioCardDriver{})
+}
+
+// RegisterDriver adds a driver. Discovery tries drivers in registration order, starting with the
+// built-in JasperMate IO driver. It panics if the driver name or one of its models is already registered.
+func RegisterDriver(d CardDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	for _, existing := range drivers {
+		if existing.Name() == d.Name() {
+			panic(fmt.Sprintf("localio: driver %s registered twice", d.Name()))
+		}
+		for _, a := range existing.Models() {
+			for _, b := range d.Models() {
+				if a.Name == b.Name {
+					panic(fmt.Sprintf("localio: model %s of driver %s is already provided by %s", b.Name, d.Name(), existing.Name()))
+				}
+			}
+		}
+	}
+	drivers = append(drivers, d)
+}
+
+// Drivers returns the registered drivers in registration order
+func Drivers() []CardDriver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	return append([]CardDriver(nil), drivers...)
+}
+
+// lookupModel returns the driver providing a model and the model's spec
+func lookupModel(model string) (CardDriver, ModelSpec, bool) {
+	for _, d := range Drivers() {
+		for _, spec := range d.Models() {
+			if spec.Name == model {
+				return d, spec, true
+			}
+		}
+	}
+	return nil, ModelSpec{}, false
+}
+
+// cardDriver returns the driver of a card. Cards restored from a recording have no driver and use the
+// driver of their model.
+func cardDriver(c *Card) CardDriver {
+	if c.driver != nil {
+		return c.driver
+	}
+	if d, _, ok := lookupModel(c.Module); ok {
+		return d
+	}
+	return ioCardDriver{}
+}
+
+// Spec returns the channel layout of the card (zero if the model is unknown)
+func (c *Card) Spec() ModelSpec {
+	return cardSpec(c)
+}
+
+// cardSpec returns the channel layout of a card (zero if the model is unknown)
+func cardSpec(c *Card) ModelSpec {
+	_, spec, _ := lookupModel(c.Module)
+	return spec
+}
+
+// do selects a slave and runs fn with the port locked
+func (pc *portClient) do(slave byte, fn func(bus *Bus) error) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	setSlaveID(pc.handler, slave)
+	return fn(&Bus{Client: pc.client, Slave: slave, operationDelay: pc.operationDelay})
+}
+
+// read reads a card through its driver
+func (pc *portClient) read(d CardDriver, slave byte, spec ModelSpec, full bool) (CardState, error) {
+	var state CardState
+	err := pc.do(slave, func(bus *Bus) error {
+		var err error
+		state, err = d.Read(bus, spec, full)
+		return err
+	})
+	return state, err
+}
+
+// write writes output channels through a driver
+func (pc *portClient) write(d CardDriver, slave byte, w OutputWrite) error {
+	return pc.do(slave, func(bus *Bus) error {
+		return d.Write(bus, w)
+	})
+}
+
+// probe detects the device on a slave ID with a driver
+func (pc *portClient) probe(d CardDriver, slave byte) ModelSpec {
+	var spec ModelSpec
+	pc.do(slave, func(bus *Bus) error {
+		spec = d.Probe(bus)
+		return nil
+	})
+	return spec
+}
+
+// identify returns the driver and spec of a card: those of module if set, else of the first driver
+// that recognizes the device
+func (pc *portClient) identify(slave byte, module string) (CardDriver, ModelSpec, error) {
+	if module != "" {
+		d, spec, ok := lookupModel(module)
+		if !ok {
+			return nil, ModelSpec{}, fmt.Errorf("unknown module %s", module)
+		}
+		return d, spec, nil
+	}
+	for _, d := range Drivers() {
+		detected := pc.probe(d, slave)
+		for _, spec := range d.Models() {
+			if spec.Name == detected.Name {
+				return d, spec, nil
+			}
+		}
+	}
+	return nil, ModelSpec{}, fmt.Errorf("unable to detect module; specify module explicitly")
+}
@@ -0,0 +1,113 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+// meterDriver is a test driver for a power meter with two AI channels and one relay output
+type meterDriver struct {
+	writes []OutputWrite
+}
+
+func (d *meterDriver) Name() string { return "test-meter" }
+
+func (d *meterDriver) Models() []ModelSpec {
+	return []ModelSpec{{Name: "METER-1", DO: 1, AI: 2}}
+}
+
+func (d *meterDriver) Probe(bus *Bus) ModelSpec {
+	raw, err := bus.ReadInputRegisters(0x1000, 1)
+	if err != nil || len(raw) < 2 || raw[1] != 1 {
+		return ModelSpec{}
+	}
+	return d.Models()[0]
+}
+
+func (d *meterDriver) Read(bus *Bus, spec ModelSpec, full bool) (CardState, error) {
+	return CardState{Timestamp: time.Now(), DO: []bool{false}, AI: []float32{230, 1.5}}, nil
+}
+
+func (d *meterDriver) Write(bus *Bus, w OutputWrite) error {
+	if w.Type != WriteOpDO {
+		return errorf(CodeInvalidRequest, "meter only has digital outputs")
+	}
+	d.writes = append(d.writes, w)
+	return nil
+}
+
+var testMeter = &meterDriver{}
+
+func init() {
+	RegisterDriver(testMeter)
+}
+
+func TestDriver_DiscoveryAndWrites(t *testing.T) {
+	configtest.Isolate(t)
+
+	// Only the meter's identification register answers, so the built-in probe finds nothing
+	client := &MockClient{
+		ReadInputRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			if address == 0x1000 {
+				return []byte{0, 1}, nil
+			}
+			return nil, errorf(CodeBusTimeout, "timeout")
+		},
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			return nil, errorf(CodeBusTimeout, "timeout")
+		},
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) {
+			return nil, errorf(CodeBusTimeout, "timeout")
+		},
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return nil, errorf(CodeBusTimeout, "timeout")
+		},
+	}
+	mgr := newMockManager(client)
+
+	card, err := mgr.AddCard("/dev/ttyUSB0", 3, "")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if card.Driver != "test-meter" || card.Module != "METER-1" {
+		t.Fatalf("Expected METER-1 from test-meter, got %s from %s", card.Module, card.Driver)
+	}
+	if len(card.Last.AI) != 2 || card.Last.AI[0] != 230 {
+		t.Errorf("Expected the driver's AI values, got %v", card.Last.AI)
+	}
+
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	if results[0].Status != "ok" {
+		t.Fatalf("Expected DO write ok, got %+v", results[0])
+	}
+	if len(testMeter.writes) != 1 || len(testMeter.writes[0].DO) != 1 || !testMeter.writes[0].DO[0] {
+		t.Errorf("Expected the write to reach the driver, got %+v", testMeter.writes)
+	}
+
+	// The layout comes from the driver: the meter has no analog outputs
+	results = mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpAO, Index: 0, Value: 1}})
+	if results[0].Code != CodeIndexOutOfRange {
+		t.Errorf("Expected INDEX_OUT_OF_RANGE for AO write, got %+v", results[0])
+	}
+
+	if err := mgr.RebootCard(card.ID); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST rebooting a driver without reboot support, got %v", err)
+	}
+}
+
+func TestRegisterDriver_DuplicateModel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic registering a model twice")
+		}
+	}()
+	RegisterDriver(&duplicateDriver{})
+}
+
+// duplicateDriver claims a built-in model
+type duplicateDriver struct{ meterDriver }
+
+func (d *duplicateDriver) Name() string        { return "duplicate" }
+func (d *duplicateDriver) Models() []ModelSpec { return []ModelSpec{ModelTable["IO4040"]} }
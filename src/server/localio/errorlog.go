@@ -0,0 +1,63 @@
+package localio
+
+import (
+	"time"
+)
+
+// errorHistorySize is the number of errors kept per card
+const errorHistorySize = 50
+
+// CardError is one entry of a card's error history
+type CardError struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"` // "read", "write-do", "write-ao", "write-aotype", "reboot", "restore"
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	// Exception is the Modbus exception code if the card answered with an exception
+	Exception byte `json:"exception,omitempty"`
+}
+
+// GetCardErrors returns the recent errors of a card, oldest first
+func (m *Manager) GetCardErrors(cardID string) ([]CardError, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cards[cardID]; !ok {
+		return nil, errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
+	}
+	history := make([]CardError, len(m.errorHistory[cardID]))
+	copy(history, m.errorHistory[cardID])
+	return history, nil
+}
+
+// logCardError appends an error to a card's history, dropping the oldest entry when full
+func (m *Manager) logCardError(cardID, operation string, err error) {
+	entry := CardError{
+		Time:      time.Now(),
+		Operation: operation,
+		Code:      busErrorCode(err),
+		Message:   err.Error(),
+		Exception: exceptionOf(err),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := append(m.errorHistory[cardID], entry)
+	if len(history) > errorHistorySize {
+		history = history[len(history)-errorHistorySize:]
+	}
+	m.errorHistory[cardID] = history
+}
+
+// writeOpName returns the command name of a write operation type
+func writeOpName(t writeOpType) string {
+	switch t {
+	case writeOpDO:
+		return "write-do"
+	case writeOpAO:
+		return "write-ao"
+	case writeOpAOType:
+		return "write-aotype"
+	}
+	return "write"
+}
@@ -0,0 +1,69 @@
+package localio
+
+import (
+	"testing"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+func TestCardErrorHistory(t *testing.T) {
+	failRead := false
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			if failRead {
+				return nil, serial.ErrTimeout
+			}
+			return []byte{0x00}, nil
+		},
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			return nil, &modbus.ModbusError{FunctionCode: 0x0F, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	// Validation errors are not card faults
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 99, Value: 1}})
+	if errs, _ := mgr.GetCardErrors(card.ID); len(errs) != 0 {
+		t.Fatalf("Expected empty history, got %+v", errs)
+	}
+
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	failRead = true
+	mgr.ReadAllAndProcessWrites()
+
+	errs, err := mgr.GetCardErrors(card.ID)
+	if err != nil {
+		t.Fatalf("GetCardErrors failed: %v", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %+v", errs)
+	}
+	if errs[0].Operation != "write-do" || errs[0].Code != CodeIllegalAddress || errs[0].Exception != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("Unexpected write error entry: %+v", errs[0])
+	}
+	if errs[1].Operation != "read" || errs[1].Code != CodeBusTimeout {
+		t.Errorf("Unexpected read error entry: %+v", errs[1])
+	}
+
+	// History is bounded; failing reads are retried every cycle to fill it
+	mgr.readRetryMax = 0
+	for i := 0; i < errorHistorySize+10; i++ {
+		mgr.ReadAllAndProcessWrites()
+	}
+	if errs, _ := mgr.GetCardErrors(card.ID); len(errs) != errorHistorySize {
+		t.Errorf("Expected %d errors, got %d", errorHistorySize, len(errs))
+	}
+
+	if _, err := mgr.GetCardErrors("missing"); ErrorCodeOf(err) != CodeCardNotFound {
+		t.Errorf("Expected %s, got %v", CodeCardNotFound, err)
+	}
+}
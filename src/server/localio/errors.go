@@ -0,0 +1,141 @@
+package localio
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// ErrorCode is a machine-readable error code returned to HTTP and TCP clients
+type ErrorCode string
+
+// Error codes
+const (
+	CodeInvalidRequest     ErrorCode = "INVALID_REQUEST"      // Malformed request or invalid parameter
+	CodeCardNotFound       ErrorCode = "CARD_NOT_FOUND"       // No card with the given ID
+	CodeNotFound           ErrorCode = "NOT_FOUND"            // Named resource (PID loop, sequence, ...) not found
+	CodeIndexOutOfRange    ErrorCode = "INDEX_OUT_OF_RANGE"   // Channel index outside the card's range
+	CodeConflict           ErrorCode = "CONFLICT"             // Operation not allowed in the current state
+	CodeFeatureDisabled    ErrorCode = "FEATURE_DISABLED"     // Feature is disabled in the configuration
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"         // Missing or invalid credentials
+	CodeInterlockViolation ErrorCode = "INTERLOCK_VIOLATION"  // Write rejected by an output interlock
+	CodeSlaveConflict      ErrorCode = "SLAVE_ID_CONFLICT"    // More than one card answers on the card's slave ID
+	CodeShortCycle         ErrorCode = "SHORT_CYCLE"          // DO write within the channel's minimum on/off time
+	CodeControlLocked      ErrorCode = "CONTROL_LOCKED"       // Writes are disabled (e.g. a TCP client has control)
+	CodeWriteForbidden     ErrorCode = "WRITE_FORBIDDEN"      // The source may not write the channel (write_permissions)
+	CodeQueueFull          ErrorCode = "QUEUE_FULL"           // Write queue can't accept more operations
+	CodePortUnavailable    ErrorCode = "PORT_UNAVAILABLE"     // Serial port can't be opened
+	CodeBusTimeout         ErrorCode = "BUS_TIMEOUT"          // No response from the card
+	CodeIllegalFunction    ErrorCode = "ILLEGAL_FUNCTION"     // Card doesn't support the request (exception 1)
+	CodeIllegalAddress     ErrorCode = "ILLEGAL_DATA_ADDRESS" // Register or coil doesn't exist on the card (exception 2)
+	CodeIllegalValue       ErrorCode = "ILLEGAL_DATA_VALUE"   // Card rejected the written value (exception 3)
+	CodeDeviceBusy         ErrorCode = "DEVICE_BUSY"          // Card is busy, retry later (exception 6)
+	CodeModbusException    ErrorCode = "MODBUS_EXCEPTION"     // Card answered with another Modbus exception
+	CodeBusError           ErrorCode = "BUS_ERROR"            // Other communication error
+	CodeInternal           ErrorCode = "INTERNAL"             // Unclassified error
+)
+
+// Error is an error with a machine-readable code. Params holds the values of the message (card, channel,
+// limits) so user interfaces can render a localized message from the code; Message is the English detail
+// for developers and logs.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Params  map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// with sets a parameter of the error's message
+func (e *Error) with(key string, value interface{}) *Error {
+	if e.Params == nil {
+		e.Params = make(map[string]interface{})
+	}
+	e.Params[key] = value
+	return e
+}
+
+// ErrorParamsOf returns the message parameters of the *Error in err's chain (nil if there is none)
+func ErrorParamsOf(err error) map[string]interface{} {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Params
+	}
+	return nil
+}
+
+// ErrorCodeOf returns the code of err: the code of an *Error in its chain,
+// the classification of a Modbus/serial error, or CodeInternal
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	var mbErr *modbus.ModbusError
+	switch {
+	case errors.As(err, &e):
+		return e.Code
+	case errors.As(err, &mbErr):
+		return exceptionErrorCode(mbErr.ExceptionCode)
+	case errors.Is(err, serial.ErrTimeout):
+		return CodeBusTimeout
+	}
+	return CodeInternal
+}
+
+// exceptionErrorCode returns the error code of a Modbus exception code
+func exceptionErrorCode(exception byte) ErrorCode {
+	switch exception {
+	case modbus.ExceptionCodeIllegalFunction:
+		return CodeIllegalFunction
+	case modbus.ExceptionCodeIllegalDataAddress:
+		return CodeIllegalAddress
+	case modbus.ExceptionCodeIllegalDataValue:
+		return CodeIllegalValue
+	case modbus.ExceptionCodeServerDeviceBusy:
+		return CodeDeviceBusy
+	}
+	return CodeModbusException
+}
+
+// exceptionOf returns the Modbus exception code in err's chain, or 0 if the card didn't answer with an
+// exception
+func exceptionOf(err error) byte {
+	var mbErr *modbus.ModbusError
+	if errors.As(err, &mbErr) {
+		return mbErr.ExceptionCode
+	}
+	return 0
+}
+
+// busErrorCode classifies an error returned by a Modbus request
+func busErrorCode(err error) ErrorCode {
+	if code := ErrorCodeOf(err); code != CodeInternal {
+		return code
+	}
+	return CodeBusError
+}
+
+// errorResult builds a failed CommandResult
+func errorResult(index int, code ErrorCode, message string) CommandResult {
+	return CommandResult{Index: index, Status: "error", Code: code, Message: message}
+}
+
+// errorResultOf builds a failed CommandResult from an *Error
+func errorResultOf(index int, err *Error) CommandResult {
+	r := errorResult(index, err.Code, err.Message)
+	r.Params = err.Params
+	return r
+}
+
+// busErrorResult builds a failed CommandResult from a Modbus request error
+func busErrorResult(index int, err error) CommandResult {
+	r := errorResult(index, busErrorCode(err), err.Error())
+	r.Exception = exceptionOf(err)
+	return r
+}
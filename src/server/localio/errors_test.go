@@ -0,0 +1,92 @@
+package localio
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{errorf(CodeCardNotFound, "card not found"), CodeCardNotFound},
+		{fmt.Errorf("wrapped: %w", errorf(CodeConflict, "busy")), CodeConflict},
+		{&modbus.ModbusError{FunctionCode: 0x0F, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}, CodeIllegalAddress},
+		{&modbus.ModbusError{FunctionCode: 0x10, ExceptionCode: modbus.ExceptionCodeIllegalDataValue}, CodeIllegalValue},
+		{fmt.Errorf("write: %w", &modbus.ModbusError{FunctionCode: 0x10, ExceptionCode: modbus.ExceptionCodeServerDeviceBusy}), CodeDeviceBusy},
+		{&modbus.ModbusError{FunctionCode: 0x10, ExceptionCode: modbus.ExceptionCodeServerDeviceFailure}, CodeModbusException},
+		{serial.ErrTimeout, CodeBusTimeout},
+		{errors.New("something else"), CodeInternal},
+	}
+	for _, tt := range tests {
+		if got := ErrorCodeOf(tt.err); got != tt.want {
+			t.Errorf("ErrorCodeOf(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestProcessBatchWrite_ErrorCodes(t *testing.T) {
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			return nil, serial.ErrTimeout
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	results := mgr.ProcessBatchWrite([]WriteOperation{
+		{CardID: "missing", Type: WriteOpDO, Index: 0, Value: 1},
+		{CardID: card.ID, Type: WriteOpDO, Index: 99, Value: 1},
+		{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1},
+	})
+	want := []ErrorCode{CodeCardNotFound, CodeIndexOutOfRange, CodeBusTimeout}
+	for i, code := range want {
+		if results[i].Status != "error" || results[i].Code != code {
+			t.Errorf("Result %d: expected %s, got %+v", i, code, results[i])
+		}
+	}
+	// The parameters of the messages, for localized clients
+	if results[0].Params["cardId"] != "missing" || results[1].Params["channel"] != "do99" {
+		t.Errorf("Expected the card and channel parameters, got %v and %v", results[0].Params, results[1].Params)
+	}
+
+	if err := mgr.QueueWriteDO("missing", 0, true); ErrorCodeOf(err) != CodeCardNotFound || ErrorParamsOf(err)["cardId"] != "missing" {
+		t.Errorf("Expected %s from QueueWriteDO, got %v", CodeCardNotFound, err)
+	}
+}
+
+func TestProcessBatchWrite_Exception(t *testing.T) {
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			return nil, &modbus.ModbusError{FunctionCode: modbus.FuncCodeWriteMultipleCoils, ExceptionCode: modbus.ExceptionCodeServerDeviceBusy}
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	if results[0].Code != CodeDeviceBusy || results[0].Exception != modbus.ExceptionCodeServerDeviceBusy {
+		t.Errorf("Expected DEVICE_BUSY with exception 6, got %+v", results[0])
+	}
+}
@@ -0,0 +1,170 @@
+package localio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	EventModelMismatch   = "model-mismatch"
+	EventSlaveConflict   = "slave-conflict"
+	EventRebootProgress  = "reboot-progress"
+	EventWriteExecuted   = "write-executed"
+	EventRelayWear       = "relay-wear"
+	EventDIPulse         = "di-pulse"
+	EventCycleOverBudget = "cycle-over-budget"
+	EventAlarm           = "alarm"
+	EventSafeState       = "safe-state"
+	EventSafeStateCheck  = "safe-state-verified"
+	EventCardOffline     = "card-offline"
+	EventCardOnline      = "card-online"
+	EventCardReboot      = "card-reboot"
+	EventCardAdded       = "card-added"
+	EventCardRemoved     = "card-removed"
+	EventMaintenance     = "maintenance"
+	EventSensorFault     = "sensor-fault"
+	EventCardReplaced    = "card-replaced"
+)
+
+// Event severities, from least to most severe
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severityRanks = map[string]int{SeverityInfo: 1, SeverityWarning: 2, SeverityCritical: 3}
+
+// eventSeverities are the severities of the event types. Failed reboots and writes are raised to warning,
+// failed safe state read-backs to critical; alarm events carry the severity of their alarm (see
+// eventSeverity).
+var eventSeverities = map[string]string{
+	EventModelMismatch:   SeverityWarning,
+	EventSlaveConflict:   SeverityCritical,
+	EventRebootProgress:  SeverityInfo,
+	EventWriteExecuted:   SeverityInfo,
+	EventRelayWear:       SeverityWarning,
+	EventDIPulse:         SeverityInfo,
+	EventCycleOverBudget: SeverityWarning,
+	EventSafeState:       SeverityWarning,
+	EventSafeStateCheck:  SeverityInfo,
+	EventCardOffline:     SeverityCritical,
+	EventCardOnline:      SeverityInfo,
+	EventCardReboot:      SeverityInfo,
+	EventCardAdded:       SeverityInfo,
+	EventCardRemoved:     SeverityInfo,
+	EventMaintenance:     SeverityInfo,
+	EventSensorFault:     SeverityWarning,
+	EventCardReplaced:    SeverityInfo,
+	EventAlarm:           SeverityInfo,
+}
+
+// EventTypes returns the types of the events emitted by the manager, sorted
+func EventTypes() []string {
+	types := make([]string, 0, len(eventSeverities))
+	for t := range eventSeverities {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidSeverity reports whether s is one of info, warning and critical
+func ValidSeverity(s string) bool {
+	return severityRanks[s] > 0
+}
+
+// SeverityAtLeast reports whether severity s is min or more severe; an empty min matches every severity
+func SeverityAtLeast(s, min string) bool {
+	return severityRanks[s] >= severityRanks[min]
+}
+
+// eventSeverity classifies an event
+func eventSeverity(eventType string, data map[string]interface{}) string {
+	switch eventType {
+	case EventAlarm:
+		if data["action"] == AlarmRaised {
+			if s, ok := data["severity"].(string); ok {
+				return s
+			}
+		}
+		return SeverityInfo
+	case EventSafeState:
+		if data["status"] == "error" {
+			return SeverityCritical
+		}
+	case EventSafeStateCheck:
+		if data["status"] != SafeStateVerified {
+			return SeverityCritical
+		}
+	case EventSensorFault:
+		if data["status"] == SensorOK {
+			return SeverityInfo
+		}
+	case EventCardReboot, EventRebootProgress, EventWriteExecuted:
+		if data["status"] == "error" {
+			return SeverityWarning
+		}
+	}
+	if s, ok := eventSeverities[eventType]; ok {
+		return s
+	}
+	return SeverityInfo
+}
+
+// Event is a notable occurrence on the bus, delivered to event listeners
+type Event struct {
+	Type     string                 `json:"type"`
+	Severity string                 `json:"severity"` // "info", "warning" or "critical"
+	CardID   string                 `json:"cardId,omitempty"`
+	Time     time.Time              `json:"time"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventListener is called for every event emitted by the manager.
+// Listeners are called synchronously from the emitting goroutine and must not block.
+type EventListener func(Event)
+
+// AddEventListener registers a listener for manager events
+func (m *Manager) AddEventListener(listener EventListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventListeners = append(m.eventListeners, listener)
+}
+
+// logEvent writes an event to the service log, prefixed with its severity
+func logEvent(ev Event) {
+	line := fmt.Sprintf("[%s] %s", strings.ToUpper(ev.Severity), ev.Type)
+	if ev.CardID != "" {
+		line += " card " + ev.CardID
+	}
+	if len(ev.Data) > 0 {
+		data, _ := json.Marshal(ev.Data)
+		line += " " + string(data)
+	}
+	log.Print(line)
+}
+
+// emitEvent delivers an event to all listeners; must be called without m.mu held
+func (m *Manager) emitEvent(eventType, cardID string, data map[string]interface{}) {
+	ev := Event{Type: eventType, Severity: eventSeverity(eventType, data), CardID: cardID, Time: time.Now(), Data: data}
+
+	m.mu.Lock()
+	listeners := make([]EventListener, len(m.eventListeners))
+	copy(listeners, m.eventListeners)
+	logSeverity := m.eventLogSeverity
+	m.mu.Unlock()
+
+	if SeverityAtLeast(ev.Severity, logSeverity) {
+		logEvent(ev)
+	}
+
+	for _, listener := range listeners {
+		listener(ev)
+	}
+}
@@ -0,0 +1,115 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestEventSeverity(t *testing.T) {
+	tests := []struct {
+		eventType string
+		data      map[string]interface{}
+		want      string
+	}{
+		{EventCardOffline, nil, SeverityCritical},
+		{EventCardOnline, nil, SeverityInfo},
+		{EventSafeState, map[string]interface{}{"status": "ok"}, SeverityWarning},
+		{EventSafeState, map[string]interface{}{"status": "error"}, SeverityCritical},
+		{EventCardReboot, map[string]interface{}{"status": "error"}, SeverityWarning},
+		{EventAlarm, map[string]interface{}{"action": AlarmRaised, "severity": SeverityCritical}, SeverityCritical},
+		{EventAlarm, map[string]interface{}{"action": AlarmAcked, "severity": SeverityCritical}, SeverityInfo},
+		{"unknown", nil, SeverityInfo},
+	}
+	for _, tt := range tests {
+		if got := eventSeverity(tt.eventType, tt.data); got != tt.want {
+			t.Errorf("eventSeverity(%s, %v) = %s, want %s", tt.eventType, tt.data, got, tt.want)
+		}
+	}
+	if !SeverityAtLeast(SeverityCritical, SeverityWarning) || SeverityAtLeast(SeverityInfo, SeverityWarning) || !SeverityAtLeast(SeverityInfo, "") {
+		t.Error("Unexpected severity order")
+	}
+}
+
+func TestEventForwardingBySeverity(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	sent := make(chan Event, 10)
+	mgr.notify = func(ch config.NotificationChannel, server config.SMTPServer, msg message) error {
+		sent <- msg.payload.(Event)
+		return nil
+	}
+	err := mgr.SetNotifications(config.Notifications{Channels: []config.NotificationChannel{
+		{Name: "ops", Type: NotifyWebhook, URL: "http://example.com/events", Events: SeverityWarning},
+		{Name: "quiet", Type: NotifyWebhook, URL: "http://example.com/alarms"},
+	}})
+	if err != nil {
+		t.Fatalf("SetNotifications failed: %v", err)
+	}
+
+	mgr.emitEvent(EventCardOnline, "1", nil)
+	mgr.emitEvent(EventCardOffline, "1", map[string]interface{}{"error": "timeout"})
+	select {
+	case ev := <-sent:
+		if ev.Type != EventCardOffline || ev.Severity != SeverityCritical {
+			t.Errorf("Expected the critical card-offline event, got %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the card-offline event to be forwarded")
+	}
+	select {
+	case ev := <-sent:
+		t.Errorf("Expected a single forwarded event, also got %+v", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The journal filters by minimum severity as well
+	page, err := mgr.QueryJournal(JournalQuery{Severity: SeverityWarning})
+	if err != nil {
+		t.Fatalf("QueryJournal failed: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Type != EventCardOffline {
+		t.Errorf("Expected only the card-offline entry, got %+v", page.Entries)
+	}
+	if _, err := mgr.QueryJournal(JournalQuery{Severity: "fatal"}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for an unknown severity, got %v", err)
+	}
+}
+
+func TestCardLifecycleEvents(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+	events := make(chan Event, 10)
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventCardAdded || ev.Type == EventCardRemoved {
+			events <- ev
+		}
+	})
+
+	c, err := mgr.AddCard("/dev/ttyUSB0", 3, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	ev := <-events
+	if ev.Type != EventCardAdded || ev.CardID != c.ID || ev.Data["module"] != "IO4040" || ev.Data["slaveId"] != byte(3) {
+		t.Errorf("Unexpected card-added event: %+v", ev)
+	}
+
+	if !mgr.RemoveCard(c.ID) {
+		t.Fatal("RemoveCard failed")
+	}
+	ev = <-events
+	if ev.Type != EventCardRemoved || ev.CardID != c.ID || ev.Data["portPath"] != "/dev/ttyUSB0" {
+		t.Errorf("Unexpected card-removed event: %+v", ev)
+	}
+	if mgr.RemoveCard(c.ID) {
+		t.Error("Expected removing an unknown card to fail")
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("Expected no event for an unknown card, got %+v", ev)
+	default:
+	}
+}
@@ -0,0 +1,141 @@
+package localio
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// defaultHeartbeatInterval is the time between two toggles of the heartbeat output if none is configured
+const defaultHeartbeatInterval = 500 * time.Millisecond
+
+// HeartbeatOutputStatus is the configuration and state of the heartbeat output
+type HeartbeatOutputStatus struct {
+	config.HeartbeatOutput
+	State     bool      `json:"state"`
+	ToggledAt time.Time `json:"toggledAt,omitempty"`
+	// Fault is why the output stopped toggling (empty while healthy)
+	Fault string `json:"fault,omitempty"`
+}
+
+// heartbeatState is the state of the heartbeat output kept by the cycle
+type heartbeatState struct {
+	on        bool
+	toggledAt time.Time
+	fault     string
+}
+
+func heartbeatInterval(hb config.HeartbeatOutput) time.Duration {
+	if hb.IntervalMs <= 0 {
+		return defaultHeartbeatInterval
+	}
+	return time.Duration(hb.IntervalMs) * time.Millisecond
+}
+
+// ValidateHeartbeatOutput checks the heartbeat output for a negative index or interval
+func ValidateHeartbeatOutput(hb config.HeartbeatOutput) error {
+	var p configProblems
+	validateHeartbeatOutput(hb, &p)
+	return p.err()
+}
+
+func validateHeartbeatOutput(hb config.HeartbeatOutput, p *configProblems) {
+	if hb.Index < 0 {
+		p.add("heartbeat_output.index", "must not be negative")
+	}
+	if hb.IntervalMs < 0 {
+		p.add("heartbeat_output.interval_ms", "must not be negative")
+	}
+}
+
+// GetHeartbeatOutput returns the heartbeat output and its state
+func (m *Manager) GetHeartbeatOutput() HeartbeatOutputStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return HeartbeatOutputStatus{
+		HeartbeatOutput: m.heartbeat,
+		State:           m.hb.on,
+		ToggledAt:       m.hb.toggledAt,
+		Fault:           m.hb.fault,
+	}
+}
+
+// SetHeartbeatOutput validates, activates, and persists the heartbeat output. An empty card disables it.
+func (m *Manager) SetHeartbeatOutput(hb config.HeartbeatOutput) error {
+	return m.SetHeartbeatOutputContext(context.Background(), hb)
+}
+
+// SetHeartbeatOutputContext is SetHeartbeatOutput with the change attributed in the config history to the
+// change of ctx (see config.WithChange)
+func (m *Manager) SetHeartbeatOutputContext(ctx context.Context, hb config.HeartbeatOutput) error {
+	if err := ValidateHeartbeatOutput(hb); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.heartbeat = hb
+	m.hb = heartbeatState{}
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.HeartbeatOutput = hb
+	})
+}
+
+// isHeartbeatLocked reports whether a channel is the heartbeat output; the caller must hold m.mu
+func (m *Manager) isHeartbeatLocked(cardID string, t writeOpType, index int) bool {
+	return t == writeOpDO && m.heartbeat.Card != "" && m.heartbeat.Card == cardID && m.heartbeat.Index == index
+}
+
+// runHeartbeat toggles the heartbeat output once its interval has passed. fault is the first failure of
+// the cycle (empty if every card was read); the output stops toggling while there is one, so a hardwired
+// safety relay watching it drops out.
+func (m *Manager) runHeartbeat(fault string) {
+	m.mu.Lock()
+	hb := m.heartbeat
+	if hb.Card == "" {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	prevFault := m.hb.fault
+	m.hb.fault = fault
+	due := fault == "" && now.Sub(m.hb.toggledAt) >= heartbeatInterval(hb)
+	on := !m.hb.on
+	m.mu.Unlock()
+
+	if fault != "" && prevFault == "" {
+		log.Printf("heartbeat output card %s DO%d stopped: %s", hb.Card, hb.Index, fault)
+	}
+	if !due {
+		return
+	}
+
+	value := float32(0)
+	if on {
+		value = 1
+	}
+	results := m.ProcessBatchWrite([]writeOperation{{
+		CardID: hb.Card,
+		Type:   writeOpDO,
+		Index:  hb.Index,
+		Value:  value,
+		source: WriteSource{Kind: SourceHeartbeat},
+	}})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if results[0].Status != "ok" {
+		if m.hb.fault == "" {
+			log.Printf("heartbeat output card %s DO%d stopped: %s", hb.Card, hb.Index, results[0].Message)
+		}
+		m.hb.fault = results[0].Message
+		return
+	}
+	if prevFault != "" {
+		log.Printf("heartbeat output card %s DO%d resumed", hb.Card, hb.Index)
+	}
+	m.hb.on = on
+	m.hb.toggledAt = now
+}
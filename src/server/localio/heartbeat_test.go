@@ -0,0 +1,73 @@
+package localio
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestHeartbeatOutput(t *testing.T) {
+	configtest.Isolate(t)
+
+	coils := byte(0x00)
+	var readErr error
+	client := &MockClient{
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) {
+			return []byte{coils}, readErr
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			mask := byte(1<<quantity-1) << address
+			coils = coils&^mask | value[0]<<address&mask
+			return nil, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.SetHeartbeatOutput(config.HeartbeatOutput{Card: card.ID, Index: 3, IntervalMs: -1}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a negative interval, got %v", err)
+	}
+	if err := mgr.SetHeartbeatOutput(config.HeartbeatOutput{Card: card.ID, Index: 3, IntervalMs: 20}); err != nil {
+		t.Fatalf("SetHeartbeatOutput failed: %v", err)
+	}
+
+	// The output toggles once per interval while the cycle is healthy
+	mgr.ReadAllAndProcessWrites()
+	if coils&0x08 == 0 || !mgr.GetHeartbeatOutput().State {
+		t.Fatalf("Expected DO3 switched on by the first cycle, got coils %08b", coils)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if coils&0x08 == 0 {
+		t.Errorf("Expected DO3 unchanged within the interval, got coils %08b", coils)
+	}
+	time.Sleep(25 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if coils&0x08 != 0 {
+		t.Errorf("Expected DO3 toggled off after the interval, got coils %08b", coils)
+	}
+
+	// Other sources can't write the heartbeat output
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 3, Value: 1}})
+	if results[0].Code != CodeControlLocked {
+		t.Errorf("Expected CONTROL_LOCKED writing the heartbeat output, got %+v", results[0])
+	}
+
+	// A failing read stops the toggling until the bus recovers
+	readErr = errors.New("timeout")
+	time.Sleep(25 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if hb := mgr.GetHeartbeatOutput(); coils&0x08 != 0 || hb.Fault == "" {
+		t.Errorf("Expected DO3 held off with a fault, got coils %08b status %+v", coils, hb)
+	}
+	readErr = nil
+	mgr.ReadAllAndProcessWrites()
+	if hb := mgr.GetHeartbeatOutput(); coils&0x08 == 0 || hb.Fault != "" {
+		t.Errorf("Expected DO3 toggled after recovery, got coils %08b status %+v", coils, hb)
+	}
+}
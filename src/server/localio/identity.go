@@ -0,0 +1,48 @@
+package localio
+
+import "time"
+
+// defaultIdentityRefreshInterval is how often the identity fields of a card (AO types, serial number,
+// baud rate) are re-read, so changes made out-of-band (e.g. by another Modbus master) show up
+const defaultIdentityRefreshInterval = 5 * time.Minute
+
+// fullReadDue reports whether the next read of a card must include the identity fields: after a
+// reboot or RefreshIdentity, until a full read succeeded once, and periodically. The pending flag is
+// cleared.
+func (m *Manager) fullReadDue(c *Card, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c.needsFullRead {
+		c.needsFullRead = false
+		return true
+	}
+	if c.Last.IdentityReadAt.IsZero() {
+		return true
+	}
+	if m.identityRefreshInterval <= 0 {
+		return false
+	}
+	return now.Sub(c.Last.IdentityReadAt) >= m.identityRefreshInterval
+}
+
+// keepIdentity copies the identity fields of the last full read into a state read without them
+func keepIdentity(state *CardState, prev CardState) {
+	state.AOType = prev.AOType
+	state.SerialNumber = prev.SerialNumber
+	state.BaudRate = prev.BaudRate
+	state.Firmware = prev.Firmware
+	state.IdentityReadAt = prev.IdentityReadAt
+}
+
+// RefreshIdentity schedules a full read of a card, refreshing its identity fields on the next cycle
+func (m *Manager) RefreshIdentity(cardID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.cards[cardID]
+	if !ok {
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
+	}
+	c.needsFullRead = true
+	return nil
+}
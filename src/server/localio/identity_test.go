@@ -0,0 +1,67 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestIdentityRefresh(t *testing.T) {
+	configtest.Isolate(t)
+
+	aoType := uint16(0x0001)
+	client := &MockClient{
+		ReadInputRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			raw := make([]byte, quantity*2)
+			switch address {
+			case aoTypeRegAddr:
+				for i := 0; i < int(quantity); i++ {
+					raw[i*2+1] = byte(aoType)
+				}
+			case baudRateRegAddr:
+				raw[1], raw[2], raw[3] = 0x01, 0xC2, 0x00 // 115200
+			}
+			return raw, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if card.Last.AOType[0] != "0-10V" || card.Last.BaudRate != 115200 || card.Last.IdentityReadAt.IsZero() {
+		t.Fatalf("Expected identity fields from the initial read, got %+v", card.Last)
+	}
+
+	// Someone switches the AO mode out-of-band; normal reads keep the identity fields
+	aoType = 0x0004
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.AOType[0] != "0-10V" || card.Last.BaudRate != 115200 {
+		t.Errorf("Expected identity fields kept on a normal read, got %+v", card.Last)
+	}
+
+	// On request
+	if err := mgr.RefreshIdentity(card.ID); err != nil {
+		t.Fatalf("RefreshIdentity failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.AOType[0] != "4-20mA" {
+		t.Errorf("Expected the refreshed AO type, got %v", card.Last.AOType)
+	}
+
+	// Periodically
+	aoType = 0x0001
+	card.Last.IdentityReadAt = time.Now().Add(-mgr.identityRefreshInterval)
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.AOType[0] != "0-10V" {
+		t.Errorf("Expected the AO type refreshed periodically, got %v", card.Last.AOType)
+	}
+
+	if err := mgr.RefreshIdentity("99"); ErrorCodeOf(err) != CodeCardNotFound {
+		t.Errorf("Expected CARD_NOT_FOUND, got %v", err)
+	}
+}
@@ -1,29 +1,129 @@
 package localio
 
-import "log"
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// DiscoveryOptions controls the startup scan for cards
+type DiscoveryOptions struct {
+	Ports      []string
+	MinSlaveID int
+	MaxSlaveID int
+	// ProbeTimeout is the Modbus timeout used while probing (0 = the manager's timeout)
+	ProbeTimeout time.Duration
+	// StartWithoutCards starts the read-write cycle even if no card was found
+	StartWithoutCards bool
+}
+
+// DiscoveryOptionsFromSettings returns the discovery options configured in the settings
+func DiscoveryOptionsFromSettings(s config.Settings) DiscoveryOptions {
+	ports := s.DiscoveryPorts
+	if len(ports) == 0 {
+		ports = []string{s.SerialPort}
+	}
+	return DiscoveryOptions{
+		Ports:             ports,
+		MinSlaveID:        s.MinSlaveID,
+		MaxSlaveID:        s.MaxSlaveID,
+		ProbeTimeout:      s.ProbeTimeout(),
+		StartWithoutCards: s.StartCycleWithoutCards,
+	}
+}
 
 // InitializeManager creates a new manager, performs auto-discovery, and starts the read-write cycle
 func InitializeManager() *Manager {
 	mgr := NewManager()
+	LogConfigProblems(mgr.ValidateConfig(config.GetConfig()))
 
-	// Auto-discover slaves at startup
-	portPath := "/dev/ttyS7"
-	maxSlave := 5
-	discovered := 0
-	for sid := 1; sid <= maxSlave; sid++ {
-		if card, err := mgr.AddCard(portPath, byte(sid), ""); err == nil {
-			log.Printf("discovered slave %d on %s module=%s, baudrate=%d", sid, portPath, card.Module, card.Last.BaudRate)
-			discovered++
-		}
-	}
+	settings := config.GetSettings()
+	opts := DiscoveryOptionsFromSettings(settings)
+	discovered := mgr.Discover(opts)
+	mgr.applyStartupPolicy(settings.StartupOutputPolicy)
 
-	// Only start continuous read-write cycle if at least one card was discovered
-	if discovered > 0 {
+	// Only start continuous read-write cycle if at least one card was discovered (unless configured otherwise)
+	if discovered > 0 || opts.StartWithoutCards {
 		mgr.StartCycle()
 		log.Printf("started JasperMate IO read-write cycle (%d card(s) discovered)", discovered)
 	} else {
-		log.Printf("no JasperMate IO cards discovered on %s; skipping read-write cycle", portPath)
+		log.Printf("no JasperMate IO cards discovered on %s; skipping read-write cycle", strings.Join(opts.Ports, ", "))
 	}
 
 	return mgr
 }
+
+// Rediscover removes all cards and scans the configured ports again, keeping the manager and its listeners.
+// Removed and found cards are announced with card-removed and card-added events; card IDs start at 1 again.
+// The read-write cycle is started if it isn't running and cards were found. Returns the number of cards found.
+func (m *Manager) Rediscover() int {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.cards))
+	for id := range m.cards {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	sort.Slice(ids, func(i, j int) bool {
+		idi, _ := strconv.Atoi(ids[i])
+		idj, _ := strconv.Atoi(ids[j])
+		return idi < idj
+	})
+	for _, id := range ids {
+		m.RemoveCard(id)
+	}
+
+	m.mu.Lock()
+	m.nextID = 1
+	running := m.cycleRunning
+	m.mu.Unlock()
+
+	opts := DiscoveryOptionsFromSettings(config.GetSettings())
+	discovered := m.Discover(opts)
+	if !running && (discovered > 0 || opts.StartWithoutCards) {
+		m.StartCycle()
+		log.Printf("started JasperMate IO read-write cycle (%d card(s) discovered)", discovered)
+	}
+	return discovered
+}
+
+// CheckPort opens a serial port for the cycle unless it is open already, and returns why it can't be opened
+func (m *Manager) CheckPort(path string) error {
+	_, err := m.ensurePort(path)
+	return err
+}
+
+// Discover probes slave IDs MinSlaveID..MaxSlaveID on every port, adds the cards found, and returns how many
+// were added. Ports that can't be opened are logged and skipped.
+func (m *Manager) Discover(opts DiscoveryOptions) int {
+	minSlave, maxSlave := opts.MinSlaveID, opts.MaxSlaveID
+	if minSlave < 1 {
+		minSlave = 1
+	}
+	if maxSlave > 247 {
+		maxSlave = 247
+	}
+
+	discovered := 0
+	for _, portPath := range opts.Ports {
+		pc, err := m.ensurePort(portPath)
+		if err != nil {
+			log.Printf("discovery: failed to open %s: %v", portPath, err)
+			continue
+		}
+		if opts.ProbeTimeout > 0 {
+			pc.setTimeout(opts.ProbeTimeout)
+		}
+		for sid := minSlave; sid <= maxSlave; sid++ {
+			if card, err := m.AddCard(portPath, byte(sid), ""); err == nil {
+				log.Printf("discovered slave %d on %s module=%s, baudrate=%d", sid, portPath, card.Module, card.Last.BaudRate)
+				discovered++
+			}
+		}
+		pc.setTimeout(m.timeout)
+	}
+	return discovered
+}
@@ -0,0 +1,162 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// ValidateInterlocks checks interlock rules for structural problems (unknown type, missing channels)
+func ValidateInterlocks(rules []config.InterlockRule) error {
+	var p configProblems
+	validateInterlocks(rules, &p)
+	return p.err()
+}
+
+func validateInterlocks(rules []config.InterlockRule, p *configProblems) {
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		path := fmt.Sprintf("interlocks[%d]", i)
+		if rule.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if names[rule.Name] {
+			p.add(path+".name", "duplicate name %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Type {
+		case config.InterlockExclusive:
+			if len(rule.Outputs) < 2 {
+				p.add(path+".outputs", "exclusive rule needs at least 2 outputs")
+			}
+		case config.InterlockRequires:
+			if rule.Output.Card == "" {
+				p.add(path+".output.card", "requires rule needs an output")
+			}
+			if rule.Input.Card == "" {
+				p.add(path+".input.card", "requires rule needs an input")
+			}
+		default:
+			p.add(path+".type", "unknown type %q", rule.Type)
+		}
+	}
+}
+
+// GetInterlocks returns the active interlock rules
+func (m *Manager) GetInterlocks() []config.InterlockRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]config.InterlockRule, len(m.interlocks))
+	copy(rules, m.interlocks)
+	return rules
+}
+
+// SetInterlocks validates, activates, and persists a new set of interlock rules
+func (m *Manager) SetInterlocks(rules []config.InterlockRule) error {
+	return m.SetInterlocksContext(context.Background(), rules)
+}
+
+// SetInterlocksContext is SetInterlocks with the change attributed in the config history to the change of
+// ctx (see config.WithChange)
+func (m *Manager) SetInterlocksContext(ctx context.Context, rules []config.InterlockRule) error {
+	if err := ValidateInterlocks(rules); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.interlocks = rules
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Interlocks = rules
+	})
+}
+
+// checkInterlocks evaluates the interlock rules against a batch of writes.
+// The DO state is projected from the cached state with every DO write of the batch applied,
+// so "turn DO2 off, DO3 on" in one batch passes an exclusive rule on DO2/DO3.
+// Returns the violation per rejected operation index.
+func (m *Manager) checkInterlocks(ops []writeOperation) map[int]*Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.interlocks) == 0 {
+		return nil
+	}
+
+	projected := make(map[config.ChannelRef]bool)
+	doState := func(ref config.ChannelRef) bool {
+		if v, ok := projected[ref]; ok {
+			return v
+		}
+		if c, ok := m.cards[ref.Card]; ok && ref.Index >= 0 && ref.Index < len(c.Last.DO) {
+			return c.Last.DO[ref.Index]
+		}
+		return false
+	}
+	for _, op := range ops {
+		if op.Type == writeOpDO {
+			projected[config.ChannelRef{Card: op.CardID, Index: op.Index}] = op.Value != 0
+		}
+	}
+
+	violations := make(map[int]*Error)
+	for i, op := range ops {
+		if op.Type != writeOpDO || op.Value == 0 {
+			continue
+		}
+		ref := config.ChannelRef{Card: op.CardID, Index: op.Index}
+
+		for _, rule := range m.interlocks {
+			if msg := m.violates(rule, ref, doState); msg != "" {
+				violations[i] = errorf(CodeInterlockViolation, "interlock %s: %s", rule.Name, msg).
+					with("interlock", rule.Name).with("channel", ChannelKey(writeOpDO, op.Index))
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// violates checks whether switching ref on breaks rule; must be called with m.mu held
+func (m *Manager) violates(rule config.InterlockRule, ref config.ChannelRef, doState func(config.ChannelRef) bool) string {
+	switch rule.Type {
+	case config.InterlockExclusive:
+		member := false
+		for _, out := range rule.Outputs {
+			if out == ref {
+				member = true
+				break
+			}
+		}
+		if !member {
+			return ""
+		}
+		for _, out := range rule.Outputs {
+			if out != ref && doState(out) {
+				return fmt.Sprintf("card %s DO%d is on", out.Card, out.Index)
+			}
+		}
+
+	case config.InterlockRequires:
+		if rule.Output != ref {
+			return ""
+		}
+		want := true
+		if rule.InputState != nil {
+			want = *rule.InputState
+		}
+		c, ok := m.cards[rule.Input.Card]
+		if !ok || c.Last.Error != "" || rule.Input.Index < 0 || rule.Input.Index >= len(c.Last.DI) {
+			return fmt.Sprintf("card %s DI%d unavailable", rule.Input.Card, rule.Input.Index)
+		}
+		if c.Last.DI[rule.Input.Index] != want {
+			level := "high"
+			if !want {
+				level = "low"
+			}
+			return fmt.Sprintf("requires card %s DI%d %s", rule.Input.Card, rule.Input.Index, level)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package localio
+
+import (
+	"strings"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+)
+
+func TestInterlocks(t *testing.T) {
+	var coilWrites int
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x04}, nil }, // DO2 on
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			coilWrites++
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	mgr.interlocks = []config.InterlockRule{
+		{Name: "direction", Type: config.InterlockExclusive, Outputs: []config.ChannelRef{{Card: card.ID, Index: 2}, {Card: card.ID, Index: 3}}},
+		{Name: "permissive", Type: config.InterlockRequires, Output: config.ChannelRef{Card: card.ID, Index: 0}, Input: config.ChannelRef{Card: card.ID, Index: 1}},
+	}
+
+	// DO3 on while DO2 is on
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 3, Value: 1}})
+	if results[0].Status != "error" || !strings.Contains(results[0].Message, "interlock direction") {
+		t.Errorf("Expected exclusive interlock rejection, got %+v", results[0])
+	}
+	if err := mgr.QueueWriteDO(card.ID, 3, true); err == nil {
+		t.Error("Expected QueueWriteDO to reject interlocked write")
+	}
+
+	// Switching DO2 off in the same batch makes DO3 allowed
+	results = mgr.ProcessBatchWrite([]WriteOperation{
+		{CardID: card.ID, Type: WriteOpDO, Index: 2, Value: 0},
+		{CardID: card.ID, Type: WriteOpDO, Index: 3, Value: 1},
+	})
+	for i, result := range results {
+		if result.Status != "ok" {
+			t.Errorf("Result %d: expected ok, got %+v", i, result)
+		}
+	}
+
+	// DO0 requires DI1 high (it is low)
+	results = mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	if results[0].Status != "error" || !strings.Contains(results[0].Message, "interlock permissive") {
+		t.Errorf("Expected requires interlock rejection, got %+v", results[0])
+	}
+
+	// Switching off is always allowed
+	if err := mgr.QueueWriteDO(card.ID, 0, false); err != nil {
+		t.Errorf("Expected switching off to be allowed, got %v", err)
+	}
+
+	if coilWrites != 1 {
+		t.Errorf("Expected exactly 1 coil write, got %d", coilWrites)
+	}
+}
+
+func TestValidateInterlocks(t *testing.T) {
+	bad := [][]config.InterlockRule{
+		{{Name: "", Type: config.InterlockExclusive}},
+		{{Name: "a", Type: "bogus"}},
+		{{Name: "a", Type: config.InterlockExclusive, Outputs: []config.ChannelRef{{Card: "1"}}}},
+		{{Name: "a", Type: config.InterlockRequires, Output: config.ChannelRef{Card: "1"}}},
+	}
+	for i, rules := range bad {
+		if err := ValidateInterlocks(rules); err == nil {
+			t.Errorf("Case %d: expected validation error", i)
+		}
+	}
+}
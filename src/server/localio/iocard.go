@@ -0,0 +1,242 @@
+package localio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ioCardDriver is the built-in driver for JasperMate IO cards
+type ioCardDriver struct{}
+
+func (ioCardDriver) Name() string {
+	return "jaspermate-io"
+}
+
+func (ioCardDriver) Models() []ModelSpec {
+	models := make([]ModelSpec, 0, len(ModelTable))
+	for _, spec := range ModelTable {
+		models = append(models, spec)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models
+}
+
+// Probe detects DI/DO/AI/AO counts similar to read_di.go; Name is the matching model or "Unknown"
+func (ioCardDriver) Probe(bus *Bus) ModelSpec {
+	di := probeDI(bus)
+	doCount := probeDO(bus)
+	ai := probeAI(bus)
+	ao := probeAO(bus)
+	return ModelSpec{Name: guessModel(di, doCount, ai, ao), DI: di, DO: doCount, AI: ai, AO: ao}
+}
+
+func probeDI(bus *Bus) int {
+	if _, err := bus.ReadDiscreteInputs(0x0000, 8); err == nil {
+		return 8
+	}
+	if _, err := bus.ReadDiscreteInputs(0x0000, 4); err == nil {
+		return 4
+	}
+	return 0
+}
+
+func probeDO(bus *Bus) int {
+	if _, err := bus.ReadCoils(0x0000, 8); err == nil {
+		return 8
+	}
+	if _, err := bus.ReadCoils(0x0000, 4); err == nil {
+		return 4
+	}
+	return 0
+}
+
+func probeAI(bus *Bus) int {
+	// Known modules have up to 4 AI; read 4 channels (8 registers)
+	if _, err := bus.ReadInputRegisters(0x0000, 8); err == nil {
+		return 4
+	}
+	return 0
+}
+
+func probeAO(bus *Bus) int {
+	if _, err := bus.ReadHoldingRegisters(aoTypeRegAddr, 4); err == nil {
+		return 4
+	}
+	return 0
+}
+
+func (d ioCardDriver) Read(bus *Bus, spec ModelSpec, readAll bool) (CardState, error) {
+	state := CardState{Timestamp: time.Now()}
+
+	// Inputs are read from the first to the last enabled channel; disabled channels outside it read as zero
+	if first, last, ok := spec.enabledSpan("di", spec.DI); ok {
+		raw, err := bus.ReadDiscreteInputs(uint16(first), uint16(last-first+1))
+		if err != nil {
+			state.Error = fmt.Sprintf("DI read error: %v", err)
+			return state, err
+		}
+		state.DI = make([]bool, spec.DI)
+		copy(state.DI[first:], unpackBits(raw, last-first+1))
+		bus.Pause() // RS485 delay
+	} else if spec.DI > 0 {
+		state.DI = make([]bool, spec.DI)
+	}
+
+	if spec.DO > 0 {
+		raw, err := bus.ReadCoils(0x0000, uint16(spec.DO))
+		if err != nil {
+			state.Error = fmt.Sprintf("DO read error: %v", err)
+			return state, err
+		}
+		state.DO = unpackBits(raw, spec.DO)
+		bus.Pause() // RS485 delay
+	}
+
+	if first, last, ok := spec.enabledSpan("ai", spec.AI); ok {
+		quantity := uint16((last - first + 1) * 2)
+		raw, err := bus.ReadInputRegisters(uint16(first*2), quantity)
+		if err != nil {
+			state.Error = fmt.Sprintf("AI read error: %v", err)
+			return state, err
+		}
+		state.AI = make([]float32, spec.AI)
+		for i := first; i <= last; i++ {
+			if !spec.Enabled("ai", i) {
+				continue
+			}
+			off := (i - first) * 4
+			bits := binary.BigEndian.Uint32(raw[off : off+4])
+			state.AI[i] = math.Float32frombits(bits)
+		}
+		bus.Pause() // RS485 delay
+	} else if spec.AI > 0 {
+		state.AI = make([]float32, spec.AI)
+	}
+
+	if spec.AO > 0 {
+		quantity := uint16(spec.AO * 2)
+		raw, err := bus.ReadHoldingRegisters(0x0000, quantity)
+		if err != nil {
+			state.Error = fmt.Sprintf("AO read error: %v", err)
+			return state, err
+		}
+		state.AO = make([]float32, spec.AO)
+		for i := 0; i < spec.AO; i++ {
+			bits := binary.BigEndian.Uint32(raw[i*4 : i*4+4])
+			state.AO[i] = math.Float32frombits(bits)
+		}
+		bus.Pause() // RS485 delay
+
+		if readAll {
+			typeRaw, err := bus.ReadHoldingRegisters(aoTypeRegAddr, uint16(spec.AO))
+			if err == nil {
+				state.AOType = make([]string, spec.AO)
+				for i := 0; i < spec.AO; i++ {
+					val := binary.BigEndian.Uint16(typeRaw[i*2 : i*2+2])
+					if val == 0x0001 {
+						state.AOType[i] = "0-10V"
+					} else if val == 0x0004 {
+						state.AOType[i] = "4-20mA"
+					} else {
+						state.AOType[i] = fmt.Sprintf("0x%04X", val)
+					}
+				}
+			}
+			bus.Pause() // RS485 delay
+		}
+	}
+
+	if readAll {
+		state.SerialNumber = d.ReadSerialNumber(bus)
+		bus.Pause() // RS485 delay
+
+		state.BaudRate = readBaudRate(bus)
+		bus.Pause() // RS485 delay
+	}
+
+	return state, nil
+}
+
+// ReadDI reads count discrete inputs starting at first
+func (ioCardDriver) ReadDI(bus *Bus, first, count int) ([]bool, error) {
+	raw, err := bus.ReadDiscreteInputs(uint16(first), uint16(count))
+	if err != nil {
+		return nil, err
+	}
+	return unpackBits(raw, count), nil
+}
+
+// ReadSerialNumber reads the serial number from Modbus registers 0x0070-0x0079
+// Returns empty string if read fails or no serial number is found
+func (ioCardDriver) ReadSerialNumber(bus *Bus) string {
+	// Read Serial Number (10 words = 20 bytes = 20 characters)
+	// Register address 0x0070-0x0079 (112-121 decimal)
+	snRaw, err := bus.ReadHoldingRegisters(serialNumberRegAddr, serialNumberRegCount)
+	if err != nil || len(snRaw) < 20 {
+		return ""
+	}
+
+	// ReadHoldingRegisters returns bytes, each register is 2 bytes
+	// Convert to string, removing null terminators
+	snBytes := make([]byte, 20)
+	copy(snBytes, snRaw[:20])
+
+	// Find null terminator or end of string
+	nullIdx := 0
+	for nullIdx < len(snBytes) && snBytes[nullIdx] != 0 {
+		nullIdx++
+	}
+
+	return string(snBytes[:nullIdx])
+}
+
+// readBaudRate reads the RS485 baud rate from the device (holding registers 0x0020-0x0021).
+// Returns 0 if read fails.
+func readBaudRate(bus *Bus) int {
+	raw, err := bus.ReadHoldingRegisters(baudRateRegAddr, baudRateRegCount)
+	if err != nil || len(raw) < 4 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(raw[:4]))
+}
+
+func (ioCardDriver) Write(bus *Bus, w OutputWrite) error {
+	var err error
+	switch w.Type {
+	case writeOpDO:
+		// Write all coils at once
+		_, err = bus.WriteMultipleCoils(uint16(w.Start), uint16(len(w.DO)), packBits(w.DO))
+	case writeOpAO:
+		// Each AO value is 2 registers (4 bytes)
+		buf := make([]byte, len(w.AO)*4)
+		for i, val := range w.AO {
+			binary.BigEndian.PutUint32(buf[i*4:(i+1)*4], math.Float32bits(val))
+		}
+		_, err = bus.WriteMultipleRegisters(uint16(w.Start*2), uint16(len(w.AO)*2), buf)
+	case writeOpAOType:
+		// AO type registers are consecutive, one register per channel
+		buf := make([]byte, len(w.AOType)*2)
+		for i, mode := range w.AOType {
+			binary.BigEndian.PutUint16(buf[i*2:(i+1)*2], aoTypeValue(mode))
+		}
+		_, err = bus.WriteMultipleRegisters(uint16(aoTypeRegAddr+w.Start), uint16(len(w.AOType)), buf)
+	default:
+		return errorf(CodeInvalidRequest, "unsupported write %s", writeOpName(w.Type))
+	}
+	if err == nil {
+		bus.Pause() // RS485 delay
+	}
+	return err
+}
+
+func (ioCardDriver) Reboot(bus *Bus) error {
+	// Register address 0x0010 (16 decimal), value 0xFF00
+	_, err := bus.WriteSingleRegister(0x0010, 0xFF00)
+	if err == nil {
+		bus.Pause() // RS485 delay
+	}
+	return err
+}
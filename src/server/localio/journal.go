@@ -0,0 +1,267 @@
+package localio
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalFile is the name of the event journal in the data directory; rotated files get a .1, .2, ... suffix
+const journalFile = "journal.jsonl"
+
+// Journal query page sizes
+const (
+	defaultJournalLimit = 100
+	maxJournalLimit     = 1000
+)
+
+// journalTypes are the event types written to the journal. Frequent events (executed writes, DI pulses)
+// are left out so the journal covers a long period.
+var journalTypes = map[string]bool{
+	EventAlarm:           true,
+	EventSafeState:       true,
+	EventSafeStateCheck:  true,
+	EventCardOffline:     true,
+	EventCardOnline:      true,
+	EventCardReboot:      true,
+	EventModelMismatch:   true,
+	EventSlaveConflict:   true,
+	EventRelayWear:       true,
+	EventCycleOverBudget: true,
+	EventMaintenance:     true,
+	EventSensorFault:     true,
+	EventCardReplaced:    true,
+}
+
+// JournalEntry is a journaled event. Seq increases with every entry and survives restarts.
+type JournalEntry struct {
+	Seq uint64 `json:"seq"`
+	Event
+}
+
+// JournalQuery selects journal entries; zero fields don't filter
+type JournalQuery struct {
+	Type     string
+	Severity string // Minimum severity
+	CardID   string
+	Since    time.Time
+	Until    time.Time
+	// Before only returns entries with a lower sequence number: the Next value of the previous page
+	Before uint64
+	Limit  int // Page size (0 = 100)
+}
+
+// JournalPage is a page of journal entries, newest first
+type JournalPage struct {
+	Entries []JournalEntry `json:"entries"`
+	// Next is the Before value of the next page (0 = no older entries)
+	Next uint64 `json:"next,omitempty"`
+}
+
+// journal appends events to a JSON Lines file, rotating it when it exceeds maxBytes and keeping at most
+// files files
+type journal struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	files    int
+	f        *os.File // Current file (nil until the first entry)
+	size     int64
+	seq      uint64
+}
+
+// openJournal loads the journal at path and continues its sequence numbers. The file is opened for
+// appending by the first entry.
+func openJournal(path string, maxBytes int64, files int) (*journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	j := &journal{path: path, maxBytes: maxBytes, files: max(files, 1)}
+	for i := 0; i < j.files && j.seq == 0; i++ {
+		entries, err := readJournalFile(j.file(i))
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			j.seq = entries[len(entries)-1].Seq
+		}
+	}
+	return j, nil
+}
+
+// file returns the path of the i-th newest journal file (0 = current)
+func (j *journal) file(i int) string {
+	return rotatedFile(j.path, i)
+}
+
+// rotatedFile returns the path of the i-th newest file of a log rotated at path (0 = current)
+func rotatedFile(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// shiftFiles shifts the files of a log rotated at path by one, dropping the oldest of files files, so
+// the current file can be started over
+func shiftFiles(path string, files int) error {
+	for i := files - 1; i > 0; i-- {
+		if err := os.Rename(rotatedFile(path, i-1), rotatedFile(path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if files == 1 {
+		os.Remove(path)
+	}
+	return nil
+}
+
+func (j *journal) open() error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.f, j.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts the journal files by one, dropping the oldest, and starts a new current file
+func (j *journal) rotate() error {
+	j.f.Close()
+	j.f = nil
+	if err := shiftFiles(j.path, j.files); err != nil {
+		return err
+	}
+	return j.open()
+}
+
+// append writes an event to the journal
+func (j *journal) append(ev Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	line, err := json.Marshal(JournalEntry{Seq: j.seq + 1, Event: ev})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if j.f == nil {
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+	if j.size > 0 && j.size+int64(len(line)) > j.maxBytes {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.f.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		return err
+	}
+	j.seq++
+	return nil
+}
+
+// query returns the entries matching q, newest first
+func (j *journal) query(q JournalQuery) (JournalPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultJournalLimit
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	page := JournalPage{Entries: make([]JournalEntry, 0)}
+	for i := 0; i < j.files; i++ {
+		entries, err := readJournalFile(j.file(i))
+		if err != nil {
+			return JournalPage{}, err
+		}
+		for k := len(entries) - 1; k >= 0; k-- {
+			e := entries[k]
+			if !q.match(e) {
+				continue
+			}
+			if len(page.Entries) == limit {
+				page.Next = page.Entries[limit-1].Seq
+				return page, nil
+			}
+			page.Entries = append(page.Entries, e)
+		}
+	}
+	return page, nil
+}
+
+func (q JournalQuery) match(e JournalEntry) bool {
+	return (q.Type == "" || e.Type == q.Type) &&
+		SeverityAtLeast(e.Severity, q.Severity) &&
+		(q.CardID == "" || e.CardID == q.CardID) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until)) &&
+		(q.Before == 0 || e.Seq < q.Before)
+}
+
+// readJournalFile parses a journal file, oldest entry first; a missing file has no entries and a
+// truncated last line (power loss during a write) is skipped
+func readJournalFile(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e JournalEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// journalEvent is the event listener writing notable events to the journal
+func (m *Manager) journalEvent(ev Event) {
+	if !journalTypes[ev.Type] {
+		return
+	}
+	if err := m.journal.append(ev); err != nil {
+		log.Printf("event journal: %v", err)
+	}
+}
+
+// QueryJournal returns journaled events, newest first. The journal keeps alarms, safe state activations,
+// cards going offline and online, reboots, and other notable events across restarts.
+func (m *Manager) QueryJournal(q JournalQuery) (JournalPage, error) {
+	if m.journal == nil {
+		return JournalPage{}, errorf(CodeFeatureDisabled, "event journal is not available")
+	}
+	if q.Severity != "" && !ValidSeverity(q.Severity) {
+		return JournalPage{}, errorf(CodeInvalidRequest, "unknown severity %q (use info, warning or critical)", q.Severity)
+	}
+	if q.Limit < 0 || q.Limit > maxJournalLimit {
+		return JournalPage{}, errorf(CodeInvalidRequest, "limit must be between 1 and %d", maxJournalLimit)
+	}
+	page, err := m.journal.query(q)
+	if err != nil {
+		return JournalPage{}, errorf(CodeInternal, "failed to read the event journal: %v", err)
+	}
+	return page, nil
+}
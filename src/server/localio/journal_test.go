@@ -0,0 +1,115 @@
+package localio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestJournalRotationAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFile)
+	j, err := openJournal(path, 400, 3)
+	if err != nil {
+		t.Fatalf("openJournal failed: %v", err)
+	}
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		cardID := "1"
+		if i%2 == 1 {
+			cardID = "2"
+		}
+		if err := j.append(Event{Type: EventCardOffline, CardID: cardID, Time: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected at most 3 journal files, stat of a 4th: %v", err)
+	}
+
+	// Entries survive a restart and the sequence continues; the oldest were rotated out
+	j, err = openJournal(path, 400, 3)
+	if err != nil {
+		t.Fatalf("openJournal failed: %v", err)
+	}
+	if j.seq != 20 {
+		t.Errorf("Expected sequence 20 after reopening, got %d", j.seq)
+	}
+	all, err := j.query(JournalQuery{Limit: maxJournalLimit})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if n := len(all.Entries); n == 0 || n == 20 || all.Entries[0].Seq != 20 || all.Entries[n-1].Seq != uint64(21-n) {
+		t.Fatalf("Expected the newest entries down to the rotation, got %d entries: %+v", n, all.Entries)
+	}
+
+	// Filters and paging newest first
+	page, err := j.query(JournalQuery{CardID: "2", Limit: 2})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].Seq != 20 || page.Entries[1].Seq != 18 || page.Next != 18 {
+		t.Fatalf("Unexpected first page: %+v", page)
+	}
+	page, _ = j.query(JournalQuery{CardID: "2", Limit: 2, Before: page.Next})
+	if len(page.Entries) != 2 || page.Entries[0].Seq != 16 {
+		t.Errorf("Unexpected second page: %+v", page)
+	}
+	page, _ = j.query(JournalQuery{Since: start.Add(18 * time.Second)})
+	if len(page.Entries) != 2 || page.Next != 0 {
+		t.Errorf("Expected the entries since the given time, got %+v", page)
+	}
+}
+
+func TestJournalManagerEvents(t *testing.T) {
+	configtest.Isolate(t)
+
+	var readErr error
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			return []byte{0}, readErr
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.readRetryMax = 0
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	// A card is offline after consecutive failed reads and online with the next answer
+	mgr.ReadAllAndProcessWrites()
+	readErr = errors.New("timeout")
+	for i := 0; i < offlineThreshold+1; i++ {
+		mgr.ReadAllAndProcessWrites()
+	}
+	readErr = nil
+	mgr.ReadAllAndProcessWrites()
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	mgr.emitEvent(EventWriteExecuted, card.ID, nil)
+
+	page, err := mgr.QueryJournal(JournalQuery{})
+	if err != nil {
+		t.Fatalf("QueryJournal failed: %v", err)
+	}
+	var types []string
+	for _, e := range page.Entries {
+		types = append(types, e.Type)
+	}
+	if len(types) != 4 || types[0] != EventSafeState || types[1] != EventSafeStateCheck || types[2] != EventCardOnline || types[3] != EventCardOffline {
+		t.Errorf("Expected safe-state, safe-state-verified, card-online, card-offline, got %v", types)
+	}
+	if _, err := mgr.QueryJournal(JournalQuery{Limit: maxJournalLimit + 1}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a too large page, got %v", err)
+	}
+
+	// A new manager reads the journal of the previous run
+	if page, _ := newMockManager(client).QueryJournal(JournalQuery{Type: EventCardOffline}); len(page.Entries) != 1 || page.Entries[0].CardID != card.ID {
+		t.Errorf("Expected the card-offline entry after a restart, got %+v", page.Entries)
+	}
+}
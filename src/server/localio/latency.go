@@ -0,0 +1,155 @@
+package localio
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CycleStats reports the time spent by the read-write cycle: the cycle itself, each card's read, and
+// the wait of queued writes before their execution. Maximums are kept since the start of the service.
+type CycleStats struct {
+	Cycles      uint64  `json:"cycles"`
+	LastCycleMs float64 `json:"lastCycleMs"`
+	MaxCycleMs  float64 `json:"maxCycleMs"`
+	// BudgetMs is the cycle_budget_ms setting (0 = no budget)
+	BudgetMs int `json:"budgetMs"`
+	// OverBudget counts the cycles that took longer than BudgetMs
+	OverBudget  uint64        `json:"overBudget"`
+	Cards       []CardLatency `json:"cards"`
+	WriteWaits  uint64        `json:"writeWaits"` // Executed queued writes
+	LastWaitMs  float64       `json:"lastWaitMs"`
+	MaxWaitMs   float64       `json:"maxWaitMs"`
+	TotalWaitMs float64       `json:"totalWaitMs"`
+}
+
+// CardLatency is the duration of a card's reads
+type CardLatency struct {
+	CardID     string  `json:"cardId"`
+	LastReadMs float64 `json:"lastReadMs"`
+	MaxReadMs  float64 `json:"maxReadMs"`
+}
+
+// latencyStats accumulates the cycle statistics; guarded by m.mu
+type latencyStats struct {
+	budget     time.Duration
+	cycles     uint64
+	last, max  time.Duration
+	overBudget uint64
+	over       bool // The last cycle was over budget
+	reads      map[string]*cardReads
+	waits      uint64
+	lastWait   time.Duration
+	maxWait    time.Duration
+	totalWait  time.Duration
+}
+
+type cardReads struct {
+	last, max time.Duration
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// recordRead stores the duration of a card's read
+func (m *Manager) recordRead(cardID string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.latency.reads[cardID]
+	if !ok {
+		r = &cardReads{}
+		m.latency.reads[cardID] = r
+	}
+	r.last = d
+	r.max = max(r.max, d)
+}
+
+// recordWriteWaits stores how long executed queued writes waited. Writes held back by the minimum on/off
+// time of their channel wait from the end of the hold.
+func (m *Manager) recordWriteWaits(ops []writeOperation, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range ops {
+		if op.queuedAt.IsZero() {
+			continue
+		}
+		from := op.queuedAt
+		if op.notBefore.After(from) {
+			from = op.notBefore
+		}
+		wait := max(now.Sub(from), 0)
+		m.latency.waits++
+		m.latency.lastWait = wait
+		m.latency.maxWait = max(m.latency.maxWait, wait)
+		m.latency.totalWait += wait
+	}
+}
+
+// finishCycle stores the duration of a cycle and emits a cycle-over-budget event when a cycle exceeds
+// cycle_budget_ms after one within it
+func (m *Manager) finishCycle(started time.Time) {
+	d := time.Since(started)
+
+	m.mu.Lock()
+	l := &m.latency
+	l.cycles++
+	l.last = d
+	l.max = max(l.max, d)
+	over := l.budget > 0 && d > l.budget
+	warn := over && !l.over
+	l.over = over
+	if over {
+		l.overBudget++
+	}
+	var slowest string
+	var slowestRead time.Duration
+	for id, r := range l.reads {
+		if r.last > slowestRead || (r.last == slowestRead && id < slowest) {
+			slowest, slowestRead = id, r.last
+		}
+	}
+	budget := l.budget
+	m.mu.Unlock()
+
+	if !warn {
+		return
+	}
+	m.emitEvent(EventCycleOverBudget, "", map[string]interface{}{
+		"cycleMs":       ms(d),
+		"budgetMs":      budget.Milliseconds(),
+		"slowestCardId": slowest,
+		"slowestReadMs": ms(slowestRead),
+	})
+}
+
+// GetCycleStats returns the cycle, read and write wait durations
+func (m *Manager) GetCycleStats() CycleStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := &m.latency
+	st := CycleStats{
+		Cycles:      l.cycles,
+		LastCycleMs: ms(l.last),
+		MaxCycleMs:  ms(l.max),
+		BudgetMs:    int(l.budget.Milliseconds()),
+		OverBudget:  l.overBudget,
+		Cards:       make([]CardLatency, 0, len(l.reads)),
+		WriteWaits:  l.waits,
+		LastWaitMs:  ms(l.lastWait),
+		MaxWaitMs:   ms(l.maxWait),
+		TotalWaitMs: ms(l.totalWait),
+	}
+	for id, r := range l.reads {
+		if _, ok := m.cards[id]; !ok {
+			continue // Removed card
+		}
+		st.Cards = append(st.Cards, CardLatency{CardID: id, LastReadMs: ms(r.last), MaxReadMs: ms(r.max)})
+	}
+	sort.Slice(st.Cards, func(i, j int) bool {
+		idi, _ := strconv.Atoi(st.Cards[i].CardID)
+		idj, _ := strconv.Atoi(st.Cards[j].CardID)
+		return idi < idj
+	})
+	return st
+}
@@ -0,0 +1,58 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestCycleStats(t *testing.T) {
+	configtest.Isolate(t)
+
+	delay := 30 * time.Millisecond
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			time.Sleep(delay)
+			return []byte{0}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.latency.budget = 20 * time.Millisecond
+	var events []Event
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.AddEventListener(func(ev Event) { events = append(events, ev) })
+
+	// Slow cycles warn once until a cycle is within the budget again
+	mgr.ReadAllAndProcessWrites()
+	mgr.ReadAllAndProcessWrites()
+	delay = 0
+	mgr.ReadAllAndProcessWrites()
+	delay = 30 * time.Millisecond
+	mgr.ReadAllAndProcessWrites()
+	if len(events) != 2 || events[0].Type != EventCycleOverBudget || events[0].Data["slowestCardId"] != card.ID {
+		t.Errorf("Expected two cycle-over-budget events naming card %s, got %+v", card.ID, events)
+	}
+
+	st := mgr.GetCycleStats()
+	if st.Cycles != 4 || st.OverBudget != 3 || st.BudgetMs != 20 || st.MaxCycleMs < 30 {
+		t.Errorf("Unexpected cycle stats: %+v", st)
+	}
+	if len(st.Cards) != 1 || st.Cards[0].LastReadMs < 30 || st.Cards[0].MaxReadMs < st.Cards[0].LastReadMs {
+		t.Errorf("Unexpected card read durations: %+v", st.Cards)
+	}
+
+	// Queued writes wait until the cycle executes them
+	delay = 0
+	if err := mgr.QueueWriteDO(card.ID, 0, true); err != nil {
+		t.Fatalf("QueueWriteDO failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if st := mgr.GetCycleStats(); st.WriteWaits != 1 || st.LastWaitMs < 10 || st.MaxWaitMs < st.LastWaitMs {
+		t.Errorf("Unexpected write waits: %+v", st)
+	}
+}
@@ -0,0 +1,203 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// maxMaintenanceMinutes is the longest maintenance window, a week
+const maxMaintenanceMinutes = 7 * 24 * 60
+
+// weekdays maps the day names of maintenance windows to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// MaintenanceStatus is the configured maintenance windows and the open one
+type MaintenanceStatus struct {
+	Windows []config.MaintenanceWindow `json:"windows"`
+	// Active is the name of the open window ("" = none)
+	Active string `json:"active,omitempty"`
+	// Since and Until are when the open window opened and closes
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+}
+
+// openWindow is the maintenance window currently open; guarded by m.mu
+type openWindow struct {
+	name         string
+	since, until time.Time
+}
+
+// ValidateMaintenanceWindows checks maintenance windows for missing or duplicate names, invalid times and
+// recurrences
+func ValidateMaintenanceWindows(windows []config.MaintenanceWindow) error {
+	var p configProblems
+	validateMaintenanceWindows(windows, &p)
+	return p.err()
+}
+
+func validateMaintenanceWindows(windows []config.MaintenanceWindow, p *configProblems) {
+	names := make(map[string]bool)
+	for i, w := range windows {
+		path := fmt.Sprintf("maintenance_windows[%d]", i)
+		if w.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if names[w.Name] {
+			p.add(path+".name", "duplicate name %q", w.Name)
+		}
+		names[w.Name] = true
+		if _, err := time.Parse("15:04", w.Start); err != nil {
+			p.add(path+".start", "invalid time %q (use HH:MM)", w.Start)
+		}
+		if w.DurationMin <= 0 || w.DurationMin > maxMaintenanceMinutes {
+			p.add(path+".duration_min", "must be between 1 and %d", maxMaintenanceMinutes)
+		}
+		for j, d := range w.Days {
+			if _, ok := weekdays[strings.ToLower(d)]; !ok {
+				p.add(fmt.Sprintf("%s.days[%d]", path, j), "unknown day %q (use mon, tue, wed, thu, fri, sat or sun)", d)
+			}
+		}
+		for j, d := range w.MonthDays {
+			if d < 1 || d > 31 {
+				p.add(fmt.Sprintf("%s.month_days[%d]", path, j), "day %d out of range (1-31)", d)
+			}
+		}
+		for j, d := range w.Dates {
+			if _, err := time.Parse(time.DateOnly, d); err != nil {
+				p.add(fmt.Sprintf("%s.dates[%d]", path, j), "invalid date %q (use YYYY-MM-DD)", d)
+			}
+		}
+	}
+}
+
+// windowStartsOn reports whether a maintenance window recurs on the date of t
+func windowStartsOn(w config.MaintenanceWindow, t time.Time) bool {
+	if len(w.Days) > 0 && !slices.ContainsFunc(w.Days, func(d string) bool {
+		wd, ok := weekdays[strings.ToLower(d)]
+		return ok && wd == t.Weekday()
+	}) {
+		return false
+	}
+	if len(w.MonthDays) > 0 && !slices.Contains(w.MonthDays, t.Day()) {
+		return false
+	}
+	if len(w.Dates) > 0 && !slices.Contains(w.Dates, t.Format(time.DateOnly)) {
+		return false
+	}
+	return true
+}
+
+// windowOpenAt returns when a maintenance window that is open at now opened and closes. Windows that
+// started on one of the previous days and last past midnight are open too.
+func windowOpenAt(w config.MaintenanceWindow, now time.Time) (since, until time.Time, open bool) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil || w.DurationMin <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	d := time.Duration(w.DurationMin) * time.Minute
+	y, mo, day := now.Date()
+	for back := 0; back <= w.DurationMin/(24*60)+1; back++ {
+		since = time.Date(y, mo, day-back, start.Hour(), start.Minute(), 0, 0, now.Location())
+		if windowStartsOn(w, since) && !now.Before(since) && now.Before(since.Add(d)) {
+			return since, since.Add(d), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// GetMaintenance returns the maintenance windows and the open one
+func (m *Manager) GetMaintenance() MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MaintenanceStatus{
+		Windows: append([]config.MaintenanceWindow{}, m.maintenance...),
+		Active:  m.openWindow.name,
+		Since:   m.openWindow.since,
+		Until:   m.openWindow.until,
+	}
+}
+
+// SetMaintenanceWindows validates, activates, and persists a new set of maintenance windows
+func (m *Manager) SetMaintenanceWindows(windows []config.MaintenanceWindow) error {
+	return m.SetMaintenanceWindowsContext(context.Background(), windows)
+}
+
+// SetMaintenanceWindowsContext is SetMaintenanceWindows with the change attributed in the config history to
+// the change of ctx (see config.WithChange)
+func (m *Manager) SetMaintenanceWindowsContext(ctx context.Context, windows []config.MaintenanceWindow) error {
+	if err := ValidateMaintenanceWindows(windows); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.maintenance = windows
+	m.mu.Unlock()
+
+	if err := config.UpdateContext(ctx, func(c *config.Config) {
+		c.MaintenanceWindows = windows
+	}); err != nil {
+		return err
+	}
+	m.checkMaintenance(time.Now())
+	return nil
+}
+
+// inMaintenance reports whether a maintenance window is open
+func (m *Manager) inMaintenance() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.openWindow.name != ""
+}
+
+// checkMaintenance opens and closes the maintenance windows, emitting a maintenance event for each change.
+// Opening a window with safe_state drives the outputs to safe state; closing one raises the alarms that
+// were raised while it was open and are still active.
+func (m *Manager) checkMaintenance(now time.Time) {
+	m.mu.Lock()
+	var next openWindow
+	var safeState bool
+	for _, w := range m.maintenance {
+		if since, until, ok := windowOpenAt(w, now); ok {
+			next = openWindow{name: w.Name, since: since, until: until}
+			safeState = w.SafeState
+			break
+		}
+	}
+	prev := m.openWindow
+	m.openWindow = next
+	if next.name == prev.name {
+		m.mu.Unlock()
+		return
+	}
+	var evs []alarmEvent
+	if next.name == "" {
+		for _, a := range m.alarms {
+			if a.alarm.Active && !a.alarm.Acked && !a.alarm.Shelved && !a.system && !a.alarm.RaisedAt.Before(prev.since) {
+				evs = append(evs, alarmEvent{action: AlarmRaised, alarm: a.alarm})
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if prev.name != "" {
+		log.Printf("maintenance window %s closed", prev.name)
+		m.emitEvent(EventMaintenance, "", map[string]interface{}{"window": prev.name, "action": "closed"})
+	}
+	if next.name != "" {
+		log.Printf("maintenance window %s open until %s", next.name, next.until.Format(time.DateTime))
+		m.emitEvent(EventMaintenance, "", map[string]interface{}{"window": next.name, "action": "opened", "until": next.until})
+		if safeState {
+			if err := m.WriteAllOutputsToSafeState(); err != nil {
+				log.Printf("maintenance window %s: %v", next.name, err)
+			}
+		}
+	}
+	m.emitAlarmEvents(evs)
+}
@@ -0,0 +1,94 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestWindowOpenAt(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation(time.DateTime, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		window config.MaintenanceWindow
+		now    string
+		open   bool
+	}{
+		{config.MaintenanceWindow{Start: "02:00", DurationMin: 60}, "2026-10-14 02:30:00", true},
+		{config.MaintenanceWindow{Start: "02:00", DurationMin: 60}, "2026-10-14 03:00:00", false},
+		// Overnight windows are open after midnight
+		{config.MaintenanceWindow{Start: "22:00", DurationMin: 240, Days: []string{"tue"}}, "2026-10-14 01:00:00", true},
+		{config.MaintenanceWindow{Start: "22:00", DurationMin: 240, Days: []string{"wed"}}, "2026-10-14 01:00:00", false},
+		{config.MaintenanceWindow{Start: "08:00", DurationMin: 60, MonthDays: []int{1, 15}}, "2026-10-15 08:10:00", true},
+		{config.MaintenanceWindow{Start: "08:00", DurationMin: 60, Dates: []string{"2026-12-24"}}, "2026-10-15 08:10:00", false},
+	}
+	for _, tt := range tests {
+		if _, _, open := windowOpenAt(tt.window, at(tt.now)); open != tt.open {
+			t.Errorf("%+v at %s: expected open %v", tt.window, tt.now, tt.open)
+		}
+	}
+
+	err := ValidateMaintenanceWindows([]config.MaintenanceWindow{{Name: "w", Start: "25:00", DurationMin: 0, Days: []string{"monday"}}})
+	if ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST, got %v", err)
+	}
+}
+
+func TestMaintenanceSuppressesAlarms(t *testing.T) {
+	configtest.Isolate(t)
+
+	di := byte(0x00)
+	safeWrites := 0
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{di}, nil },
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			safeWrites++
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	var events []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventAlarm || ev.Type == EventMaintenance {
+			events = append(events, ev)
+		}
+	})
+	if err := mgr.SetAlarmRules([]config.AlarmRule{{Name: "door", Card: card.ID, Channel: "di0", State: true}}); err != nil {
+		t.Fatalf("SetAlarmRules failed: %v", err)
+	}
+
+	window := config.MaintenanceWindow{Name: "service", Start: time.Now().Add(-time.Minute).Format("15:04"), DurationMin: 10, SafeState: true}
+	if err := mgr.SetMaintenanceWindows([]config.MaintenanceWindow{window}); err != nil {
+		t.Fatalf("SetMaintenanceWindows failed: %v", err)
+	}
+	if st := mgr.GetMaintenance(); st.Active != "service" || safeWrites != 1 {
+		t.Fatalf("Expected the window open and the outputs in safe state, got %+v and %d writes", st, safeWrites)
+	}
+
+	// The alarm is raised silently during maintenance and announced when the window closes
+	di = 0x01
+	mgr.ReadAllAndProcessWrites()
+	if alarms := mgr.GetAlarms(true); len(alarms) != 1 || !alarms[0].Active {
+		t.Fatalf("Expected the alarm active, got %+v", alarms)
+	}
+	if len(events) != 1 || events[0].Type != EventMaintenance || events[0].Data["action"] != "opened" {
+		t.Fatalf("Expected only the maintenance event, got %+v", events)
+	}
+	if err := mgr.SetMaintenanceWindows(nil); err != nil {
+		t.Fatalf("SetMaintenanceWindows failed: %v", err)
+	}
+	if len(events) != 3 || events[1].Data["action"] != "closed" || events[2].Type != EventAlarm || events[2].Data["action"] != AlarmRaised {
+		t.Errorf("Expected the window closed and the alarm raised, got %+v", events)
+	}
+}
@@ -1,11 +1,15 @@
 package localio
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"jaspermate-utils/src/server/config"
@@ -13,23 +17,69 @@ import (
 	"github.com/goburrow/modbus"
 )
 
-// ModbusHandler interface extends modbus.ClientHandler with Connect method and SetSlave
+// ModbusHandler interface extends modbus.ClientHandler with Connect, the slave ID, and the response
+// timeout, so every handler implementation (RTU, TCP, simulator) honors the same settings
 type ModbusHandler interface {
 	modbus.ClientHandler
 	Connect() error
+	Close() error
 	SetSlave(slave byte)
+	// Timeout returns the response timeout
+	Timeout() time.Duration
+	// SetTimeout changes the response timeout; handlers that apply it when connecting reconnect on the next request
+	SetTimeout(d time.Duration)
 }
 
-// rtuWrapper wraps modbus.RTUClientHandler to satisfy ModbusHandler interface
+// rtuWrapper wraps modbus.RTUClientHandler to satisfy ModbusHandler interface. Requests with a write
+// function code wait writeTimeout for their response, the others readTimeout.
 type rtuWrapper struct {
 	*modbus.RTUClientHandler
+	readTimeout  time.Duration
+	writeTimeout time.Duration
 }
 
 func (r *rtuWrapper) SetSlave(slave byte) {
 	r.SlaveId = slave
 }
 
+// Timeout returns the response timeout of reads
+func (r *rtuWrapper) Timeout() time.Duration {
+	return r.readTimeout
+}
+
+// SetTimeout changes the response timeout of reads
+func (r *rtuWrapper) SetTimeout(d time.Duration) {
+	r.readTimeout = d
+}
+
+// Send applies the timeout of the request's function code before sending it. Changing the timeout closes
+// the port, since the serial read timeout is applied when the port is opened; with equal read and write
+// timeouts the port stays open.
+func (r *rtuWrapper) Send(aduRequest []byte) ([]byte, error) {
+	d := r.readTimeout
+	if len(aduRequest) > 1 && isWriteFunction(aduRequest[1]) && r.writeTimeout > 0 {
+		d = r.writeTimeout
+	}
+	if r.RTUClientHandler.Timeout != d {
+		r.RTUClientHandler.Timeout = d
+		r.RTUClientHandler.Close()
+	}
+	return r.RTUClientHandler.Send(aduRequest)
+}
+
+// isWriteFunction reports whether a Modbus function code writes to the slave
+func isWriteFunction(code byte) bool {
+	switch code {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeWriteMultipleCoils,
+		modbus.FuncCodeWriteMultipleRegisters, modbus.FuncCodeMaskWriteRegister, modbus.FuncCodeReadWriteMultipleRegisters:
+		return true
+	}
+	return false
+}
+
 type ClientFactory func(handler modbus.ClientHandler) modbus.Client
+
+// HandlerFactory creates the Modbus handler of a port with the given serial settings and timeout
 type HandlerFactory func(path string, cfg serialCfg) (ModbusHandler, error)
 
 // StateChangeCallback is called when card state changes (DI or AI values)
@@ -60,7 +110,13 @@ func DefaultSafeStateConfig() SafeStateConfig {
 }
 
 type CardState struct {
-	Timestamp    time.Time `json:"timestamp"`
+	Timestamp time.Time `json:"timestamp"`
+	// Seq increases with every new state of any card of the service, so consumers can order and
+	// de-duplicate states; it restarts with the boot ID (Manager.BootID)
+	Seq uint64 `json:"seq"`
+	// MonotonicMs is the time of the state in ms since the service started, on the monotonic clock that,
+	// unlike Timestamp, NTP corrections don't move
+	MonotonicMs  int64     `json:"monotonicMs"`
 	DI           []bool    `json:"di,omitempty"`
 	DO           []bool    `json:"do,omitempty"`
 	AI           []float32 `json:"ai,omitempty"`
@@ -68,16 +124,50 @@ type CardState struct {
 	AOType       []string  `json:"aoType,omitempty"`
 	SerialNumber string    `json:"serialNumber,omitempty"`
 	BaudRate     int       `json:"baudRate,omitempty"`
-	Error        string    `json:"error,omitempty"`
+	// Firmware is the firmware version, for drivers whose devices report it in full reads
+	Firmware string `json:"firmware,omitempty"`
+	// IdentityReadAt is when AOType, SerialNumber, BaudRate and Firmware were last read from the card
+	IdentityReadAt time.Time `json:"identityReadAt,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	// ErrorCode and ErrorParams describe Error for clients rendering a localized message
+	ErrorCode   ErrorCode              `json:"errorCode,omitempty"`
+	ErrorParams map[string]interface{} `json:"errorParams,omitempty"`
+	// Simulated lists input channels whose values are injected via the simulation API
+	Simulated *SimulatedChannels `json:"simulated,omitempty"`
+	// Pending lists output channels showing a queued value not yet confirmed by a read (optimistic_writes)
+	Pending *PendingChannels `json:"pending,omitempty"`
+	// Quality is the quality of each channel's value; LastGood is the time of the last successful read
+	Quality  *ChannelQuality `json:"quality,omitempty"`
+	LastGood time.Time       `json:"lastGood,omitempty"`
 }
 
 type Card struct {
-	ID            string    `json:"id"`
-	PortPath      string    `json:"portPath"`
-	SlaveID       byte      `json:"slaveId"`
-	Module        string    `json:"module"`
-	Last          CardState `json:"last"`
-	needsFullRead bool      // Flag to force full read (AO types, serial number) on next read cycle
+	ID       string    `json:"id"`
+	PortPath string    `json:"portPath"`
+	SlaveID  byte      `json:"slaveId"`
+	Module   string    `json:"module"`
+	Driver   string    `json:"driver"` // Name of the CardDriver polling the card
+	Last     CardState `json:"last"`
+	// RetryAt is when the cycle reads the card again after consecutive failed reads (zero while healthy)
+	RetryAt time.Time `json:"retryAt,omitempty"`
+	// DetectedModel is set when re-probing found a different IO layout than Module
+	DetectedModel string `json:"detectedModel,omitempty"`
+	// Conflict is set while more than one physical card answers on the slave ID; writes are rejected
+	Conflict string `json:"conflict,omitempty"`
+	// Replacing is set while the card is being swapped for a new one (see BeginReplace)
+	Replacing *CardReplacement `json:"replacing,omitempty"`
+	// Capabilities describes what the card supports, from its driver and model
+	Capabilities    *CardCapabilities           `json:"capabilities,omitempty"`
+	needsFullRead   bool                        // Flag to force full read (AO types, serial number) on next read cycle
+	readFailures    int                         // Consecutive failed reads
+	lastModelCheck  time.Time                   // Last model re-verification
+	lastSerialCheck time.Time                   // Last serial number re-read
+	pendingSerial   string                      // Different serial number seen since the last confirmed one
+	serialMatches   int                         // Consecutive reads confirming pendingSerial, or the known serial while in conflict
+	optimistic      map[string]*optimisticValue // Queued output values shown before they are confirmed, by channel
+	lastGood        time.Time                   // Last successful read
+	offline         bool                        // Reported offline after consecutive failed reads
+	driver          CardDriver
 }
 
 type writeOpType int
@@ -104,26 +194,108 @@ type writeOperation struct {
 	Index  int     // For DO: uint16 cast, For AO/AOType: int
 	Value  float32 // For DO: bool cast (0=false, 1=true), For AO: float32, For AOType: unused
 	Mode   string  // For AOType only
+
+	ctx      context.Context // Trace context of the request that queued the operation (nil = none)
+	queuedAt time.Time       // When the operation was queued (zero = not queued)
+	source   WriteSource     // Origin of the write (zero = the source of the batch context)
+	queueID  uint64          // ID in the write queue (0 = not queued)
+	// notBefore holds a queued DO write back until its channel's minimum on/off time has passed
+	notBefore time.Time
+	ramp      *aoRamp // AO ramp the write is a step of, exempt from the slew rate (nil = none)
+	// safeStateGen binds the write to a safe state generation: it is rejected once safe state was applied
+	// after the generation was read (0 = not bound)
+	safeStateGen uint64
 }
 
 // WriteOperation is the exported version of writeOperation for use by TCP server
 type WriteOperation = writeOperation
 
 type Manager struct {
-	ports               map[string]*portClient
-	cards               map[string]*Card
-	mu                  sync.Mutex
-	nextID              int
-	serial              serialCfg
-	timeout             time.Duration
-	cycleDelay          time.Duration       // Delay after write cycle before next loop
-	operationDelay      time.Duration       // Delay between each Modbus operation (RS485)
-	writeQueue          []writeOperation    // Queue of pending write operations
-	stopChan            chan struct{}       // Channel to stop background goroutine
-	clientFactory       ClientFactory       // Factory for creating modbus clients
-	handlerFactory      HandlerFactory      // Factory for creating modbus handlers
-	stateChangeCallback StateChangeCallback // Callback for state changes (DI/AI)
-	safeStateConfig     SafeStateConfig     // Safe state configuration for outputs
+	ports                   map[string]*portClient
+	cards                   map[string]*Card
+	mu                      sync.Mutex
+	nextID                  int
+	serial                  serialCfg
+	timeout                 time.Duration                       // Response timeout of reads
+	writeTimeout            time.Duration                       // Response timeout of writes
+	cycleDelay              time.Duration                       // Delay after write cycle before next loop
+	idleCycleDelay          time.Duration                       // Delay between cycles while no consumer is active
+	consumers               map[string]int                      // Attached consumers of card states by name
+	polled                  map[string]time.Time                // Last read of each polling consumer
+	wake                    chan struct{}                       // Ends an idle pause early
+	operationDelay          time.Duration                       // Delay between each Modbus operation (RS485)
+	writeQueue              []writeOperation                    // Queue of pending write operations
+	nextQueueID             uint64                              // ID of the next queued operation
+	optimisticWrites        bool                                // Show queued DO/AO values before they are confirmed
+	stopChan                chan struct{}                       // Channel to stop background goroutine
+	cycleRunning            bool                                // StartCycle was called
+	clientFactory           ClientFactory                       // Factory for creating modbus clients
+	handlerFactory          HandlerFactory                      // Factory for creating modbus handlers
+	stateChangeCallback     StateChangeCallback                 // Callback for state changes (DI/AI)
+	safeStateConfig         SafeStateConfig                     // Safe state configuration for outputs
+	pidLoops                map[string]*pidLoop                 // Embedded PID loops executed on the poll cycle
+	interlocks              []config.InterlockRule              // Output interlocks enforced on DO writes
+	writePermissions        []config.WritePermission            // Allowed writers of restricted output channels
+	points                  []config.Point                      // Names, units, scaling and safe states of channels
+	clock                   stateClock                          // Sequence numbers of the card states
+	cycle                   uint64                              // Number of the current poll cycle
+	readCycles              map[string]uint64                   // Last cycle that read each card by card ID
+	snapshot                *cycleSnapshot                      // Card states at the end of the last cycle
+	alarms                  map[string]*alarmState              // Alarm rules and their state by name
+	doTimings               []config.DOTiming                   // Minimum on/off times of DO channels
+	doSwitches              map[string]map[int]doSwitch         // Last switch of each written DO channel by card ID
+	slewRates               []config.AOSlewRate                 // Maximum rates of change of AO channels
+	heartbeat               config.HeartbeatOutput              // Watchdog output toggled while healthy
+	hb                      heartbeatState                      // State of the heartbeat output
+	ramps                   map[string]*aoRamp                  // AO ramps in progress by card ID and channel
+	disabled                []config.InputChannel               // Input channels excluded from polling
+	priority                []config.InputChannel               // DI channels sub-polled between card reads
+	pulse                   []config.InputChannel               // DI channels whose short pulses are captured
+	currentLoop             []config.InputChannel               // AI channels checked for sensor faults
+	sensorFaults            map[string]map[int]string           // Fault state of faulted current loop AIs by card ID and index
+	pendingPulses           map[string][]int                    // Latched pulses to report on the next read by card ID
+	sequences               []config.Sequence                   // Named step sequences
+	sequenceRuns            map[string]*sequenceRun             // Last run of each sequence by name
+	simulated               map[string]*simulatedInputs         // Simulated inputs by card ID
+	rec                     *recorder                           // Active bus activity recording (nil if off)
+	replay                  *replayer                           // Active replay (nil if off); suspends bus reads
+	errorHistory            map[string][]CardError              // Recent bus errors by card ID
+	eventListeners          []EventListener                     // Listeners for manager events
+	modelCheckInterval      time.Duration                       // Interval of model re-verification (<= 0 = off)
+	identityRefreshInterval time.Duration                       // Interval of the full reads refreshing AO types, serial number, baud rate (<= 0 = off)
+	readdress               *readdressSession                   // Current or last re-addressing workflow
+	readdressPoll           time.Duration                       // Poll interval of the re-addressing workflow
+	scripts                 []*script                           // Loaded edge logic scripts
+	owners                  map[string]map[string]*ChannelOwner // Source of each output value by card ID and channel
+	relays                  relayCounter                        // DO transition counts
+	relayWearLimit          uint64                              // Transitions after which a relay is reported worn (0 = off)
+	runtime                 runtimeCounter                      // Running time of the outputs
+	aoRuntimeThreshold      float32                             // Raw AO value above the range's bottom counted as running
+	aiStats                 map[string][]*aiChannelStats        // Daily AI statistics by card ID and channel
+	aiStatsReset            time.Duration                       // Time after midnight the AI statistics start over
+	commissioning           map[string]map[string]ChannelCheck  // Commissioning state by card key and channel
+	readRetryMax            time.Duration                       // Maximum retry delay of a failing card (0 = retry every cycle)
+	latency                 latencyStats                        // Cycle, read and write wait durations
+	journal                 *journal                            // Persistent event journal (nil if it couldn't be opened)
+	notifications           config.Notifications                // Notification channels and escalation policies
+	notify                  notificationSender                  // Delivers escalation notifications and forwarded events
+	deliveries              []*NotificationDelivery             // Recent notification deliveries, oldest first
+	deliverySeq             uint64                              // ID of the last notification delivery
+	eventLogSeverity        string                              // Minimum severity of the events written to the log
+	safeStateRetry          context.CancelFunc                  // Stops the retry of failed safe state writes (nil if none)
+	safeStateChecks         map[string]SafeStateCheck           // Last safe state read-back by card ID
+	safeStateMu             sync.RWMutex                        // Held (read) by output writes, (write) to advance safeStateGen
+	safeStateGen            atomic.Uint64                       // Incremented each time safe state is applied
+	outputs                 outputStore                         // Persisted output values for the restore startup policy
+	outputsSaveMu           sync.Mutex                          // Serializes the saves of outputs
+	replacements            []CardReplacement                   // Completed card replacements
+	maintenance             []config.MaintenanceWindow          // Maintenance windows suppressing alarms
+	openWindow              openWindow                          // Maintenance window currently open
+	schedules               []config.Schedule                   // Output schedules
+	calendar                []config.CalendarException          // Dates on which schedules are skipped or follow another day
+	scheduleRuns            map[string]scheduleRun              // Last write by schedule name
+	scheduleChecked         time.Time                           // End of the period whose schedule entries were written
+	location                *config.Location                    // Site position for sunrise/sunset schedule entries
 }
 
 func defaultHandlerFactory(path string, cfg serialCfg) (ModbusHandler, error) {
@@ -132,28 +304,112 @@ func defaultHandlerFactory(path string, cfg serialCfg) (ModbusHandler, error) {
 	h.DataBits = cfg.Data
 	h.Parity = cfg.Par
 	h.StopBits = cfg.Stop
-	return &rtuWrapper{h}, nil
+	h.Timeout = cfg.Timeout
+	return &rtuWrapper{RTUClientHandler: h, readTimeout: cfg.Timeout, writeTimeout: cfg.WriteTimeout}, nil
 }
 
 func NewManager() *Manager {
-	baud := config.GetConfig().SerialBaud
+	cfg := config.GetConfig()
+	baud := cfg.SerialBaud
 	if baud <= 0 {
 		baud = 115200
 	}
-	return &Manager{
-		ports:           make(map[string]*portClient),
-		cards:           make(map[string]*Card),
-		nextID:          1,
-		serial:          serialCfg{Baud: baud, Par: "N", Stop: 1, Data: 8},
-		timeout:         200 * time.Millisecond,
-		cycleDelay:      10 * time.Millisecond,
-		operationDelay:  2 * time.Millisecond,
-		writeQueue:      make([]writeOperation, 0),
-		stopChan:        make(chan struct{}),
-		clientFactory:   modbus.NewClient,
-		handlerFactory:  defaultHandlerFactory,
-		safeStateConfig: DefaultSafeStateConfig(),
+	modelCheckInterval := defaultModelCheckInterval
+	if cfg.ModelCheckIntervalSec != 0 {
+		modelCheckInterval = time.Duration(cfg.ModelCheckIntervalSec) * time.Second
+	}
+	identityRefreshInterval := defaultIdentityRefreshInterval
+	if cfg.IdentityRefreshIntervalSec != 0 {
+		identityRefreshInterval = time.Duration(cfg.IdentityRefreshIntervalSec) * time.Second
+	}
+	settings := config.GetSettings()
+	m := &Manager{
+		ports:                   make(map[string]*portClient),
+		cards:                   make(map[string]*Card),
+		nextID:                  1,
+		serial:                  serialCfg{Baud: baud, Par: "N", Stop: 1, Data: 8},
+		timeout:                 settings.ModbusTimeout(),
+		writeTimeout:            settings.ModbusWriteTimeout(),
+		cycleDelay:              settings.CycleDelay(),
+		idleCycleDelay:          settings.IdleCycleDelay(),
+		consumers:               make(map[string]int),
+		polled:                  make(map[string]time.Time),
+		wake:                    make(chan struct{}, 1),
+		operationDelay:          settings.OperationDelay(),
+		writeQueue:              make([]writeOperation, 0),
+		stopChan:                make(chan struct{}),
+		clientFactory:           modbus.NewClient,
+		handlerFactory:          defaultHandlerFactory,
+		safeStateConfig:         DefaultSafeStateConfig(),
+		pidLoops:                newPIDLoops(cfg.PIDLoops),
+		interlocks:              cfg.Interlocks,
+		writePermissions:        cfg.WritePermissions,
+		points:                  cfg.Points,
+		clock:                   newStateClock(),
+		readCycles:              make(map[string]uint64),
+		doTimings:               cfg.DOTimings,
+		doSwitches:              make(map[string]map[int]doSwitch),
+		slewRates:               cfg.AOSlewRates,
+		heartbeat:               cfg.HeartbeatOutput,
+		ramps:                   make(map[string]*aoRamp),
+		disabled:                cfg.DisabledChannels,
+		priority:                cfg.PriorityChannels,
+		pulse:                   cfg.PulseChannels,
+		currentLoop:             cfg.CurrentLoopInputs,
+		sensorFaults:            make(map[string]map[int]string),
+		pendingPulses:           make(map[string][]int),
+		notifications:           cfg.Notifications,
+		maintenance:             cfg.MaintenanceWindows,
+		notify:                  sendNotification,
+		eventLogSeverity:        settings.EventLogSeverity,
+		sequences:               cfg.Sequences,
+		sequenceRuns:            make(map[string]*sequenceRun),
+		schedules:               cfg.Schedules,
+		calendar:                cfg.Calendar,
+		location:                cfg.Location,
+		scheduleRuns:            make(map[string]scheduleRun),
+		errorHistory:            make(map[string][]CardError),
+		safeStateChecks:         make(map[string]SafeStateCheck),
+		modelCheckInterval:      modelCheckInterval,
+		identityRefreshInterval: identityRefreshInterval,
+		readdressPoll:           settings.ReaddressPoll(),
+		optimisticWrites:        settings.OptimisticWrites,
+		simulated:               make(map[string]*simulatedInputs),
+		owners:                  make(map[string]map[string]*ChannelOwner),
+		relays:                  loadRelayCycles(),
+		runtime:                 loadRuntime(),
+		aoRuntimeThreshold:      float32(max(settings.AORuntimeThreshold, 0)),
+		aiStats:                 make(map[string][]*aiChannelStats),
+		aiStatsReset:            settings.AIStatsReset(),
+		outputs:                 loadOutputs(settings.StartupOutputPolicy == config.StartupOutputsRestore),
+		commissioning:           loadCommissioning(),
+		replacements:            loadReplacements(),
+		relayWearLimit:          uint64(max(settings.RelayWearLimit, 0)),
+		readRetryMax:            settings.FailedCardRetryMax(),
+		latency:                 latencyStats{budget: settings.CycleBudget(), reads: make(map[string]*cardReads)},
+	}
+	m.safeStateGen.Store(1) // 0 marks the writes that are not bound to a generation
+	m.loadAlarmsLocked(cfg.Alarms)
+	m.eventListeners = append(m.eventListeners, m.forwardEvent)
+	if j, err := openJournal(filepath.Join(config.DataDir(), journalFile), settings.JournalMaxBytes(), settings.JournalFiles); err != nil {
+		log.Printf("event journal disabled: %v", err)
+	} else {
+		m.journal = j
+		m.eventListeners = append(m.eventListeners, m.journalEvent)
 	}
+	if settings.ModbusTrafficLog != "" {
+		if f, err := openTrafficLog(settings.ModbusTrafficLog, settings.ModbusTrafficLogMaxBytes(), settings.ModbusTrafficLogFiles); err != nil {
+			log.Printf("modbus traffic log disabled: %v", err)
+		} else {
+			m.handlerFactory = RecordingHandlerFactory(m.handlerFactory, f)
+		}
+	}
+	if scripts, err := m.loadScripts(cfg.Scripts); err != nil {
+		log.Printf("scripts not started: %v", err)
+	} else {
+		m.replaceScripts(scripts)
+	}
+	return m
 }
 
 func (m *Manager) ensurePort(path string) (*portClient, error) {
@@ -164,18 +420,14 @@ func (m *Manager) ensurePort(path string) (*portClient, error) {
 		return p, nil
 	}
 
-	h, err := m.handlerFactory(path, m.serial)
+	cfg := m.serial
+	cfg.Timeout = m.timeout
+	cfg.WriteTimeout = m.writeTimeout
+	h, err := m.handlerFactory(path, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// We need to set timeout on the handler if possible, but ClientHandler interface doesn't have Timeout.
-	// However, RTUClientHandler has it.
-	// For testing, we might ignore it or assert type.
-	if rtu, ok := h.(*rtuWrapper); ok {
-		rtu.RTUClientHandler.Timeout = m.timeout
-	}
-
 	if err := h.Connect(); err != nil {
 		return nil, err
 	}
@@ -196,16 +448,9 @@ func (m *Manager) AddCard(portPath string, slave byte, module string) (*Card, er
 		return nil, err
 	}
 
-	if module == "" {
-		module = detectModel(pc, slave)
-		if module == "" {
-			return nil, fmt.Errorf("unable to detect module; specify module explicitly")
-		}
-	}
-
-	spec, ok := ModelTable[module]
-	if !ok {
-		return nil, fmt.Errorf("unknown module %s", module)
+	drv, spec, err := pc.identify(slave, module)
+	if err != nil {
+		return nil, err
 	}
 
 	m.mu.Lock()
@@ -216,15 +461,28 @@ func (m *Manager) AddCard(portPath string, slave byte, module string) (*Card, er
 		PortPath: portPath,
 		SlaveID:  slave,
 		Module:   spec.Name,
+		Driver:   drv.Name(),
+		driver:   drv,
+
+		Capabilities: cardCapabilities(drv, spec),
 	}
 	m.cards[c.ID] = c
 	m.mu.Unlock()
 
-	state, err := pc.readCard(slave, spec, true)
+	state, err := pc.read(drv, slave, spec, true)
 	if err == nil {
+		state.IdentityReadAt = state.Timestamp
 		c.Last = state
+		m.checkSerialAtDiscovery(c, pc, state.SerialNumber)
 	}
+	m.applyQuality(c, spec, err, time.Now())
+	m.checkSensorFaults(c, err)
 
+	data := map[string]interface{}{"module": c.Module, "portPath": portPath, "slaveId": slave}
+	if c.Last.SerialNumber != "" {
+		data["serialNumber"] = c.Last.SerialNumber
+	}
+	m.emitEvent(EventCardAdded, c.ID, data)
 	return c, nil
 }
 
@@ -237,11 +495,21 @@ func (m *Manager) GetCard(id string) (*Card, bool) {
 
 func (m *Manager) RemoveCard(id string) bool {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if _, ok := m.cards[id]; !ok {
+	c, ok := m.cards[id]
+	if !ok {
+		m.mu.Unlock()
 		return false
 	}
 	delete(m.cards, id)
+	delete(m.errorHistory, id)
+	delete(m.safeStateChecks, id)
+	delete(m.runtime.lastRead, id)
+	delete(m.aiStats, id)
+	delete(m.sensorFaults, id)
+	delete(m.owners, id)
+	m.mu.Unlock()
+
+	m.emitEvent(EventCardRemoved, id, map[string]interface{}{"module": c.Module, "portPath": c.PortPath, "slaveId": c.SlaveID})
 	return true
 }
 
@@ -261,7 +529,7 @@ func (m *Manager) RefreshAll() []*Card {
 	})
 
 	for _, c := range cards {
-		spec := ModelTable[c.Module]
+		spec := m.pollSpec(c)
 
 		// Get port directly - ports are created when cards are added via AddCard()
 		m.mu.Lock()
@@ -270,33 +538,40 @@ func (m *Manager) RefreshAll() []*Card {
 
 		if !ok {
 			// Port should exist, but handle edge case defensively
-			c.Last.Error = fmt.Sprintf("port %s not found", c.PortPath)
+			m.setReadError(c, errorf(CodePortUnavailable, "port %s not found", c.PortPath).with("port", c.PortPath))
 			continue
 		}
 
-		// Check if we need a full read (e.g., after reboot)
-		m.mu.Lock()
-		readAll := c.needsFullRead
-		if readAll {
-			// Clear the flag after we've read it
-			c.needsFullRead = false
-		}
-		m.mu.Unlock()
+		// Check if we need a full read (e.g., after reboot, or the identity fields are due for a refresh)
+		readAll := m.fullReadDue(c, time.Now())
 
-		state, err := pc.readCard(c.SlaveID, spec, readAll)
+		state, err := pc.read(cardDriver(c), c.SlaveID, spec, readAll)
 		if err != nil {
-			c.Last.Error = err.Error()
+			m.setReadError(c, err)
+			if readAll {
+				// Retry the full read once the card answers again (e.g. after a reboot)
+				m.mu.Lock()
+				c.needsFullRead = true
+				m.mu.Unlock()
+			}
 		} else {
 			if readAll {
 				// Full read includes AO types and serial number, use them directly
-				c.Last = state
+				state.IdentityReadAt = state.Timestamp
 			} else {
-				// Preserve SN and AOType from previous state (read only during AddCard)
-				state.SerialNumber = c.Last.SerialNumber
-				state.AOType = c.Last.AOType
-				c.Last = state
+				// Preserve the identity fields from the last full read
+				keepIdentity(&state, c.Last)
 			}
+			c.Last = state
+			m.countRelayCycles(c, state.DO)
+			m.countRuntime(c, state)
+			m.recordAIStats(c, spec, state)
+			m.recordOutputs(c, state)
 		}
+		m.applySimulation(c.ID, spec, &c.Last)
+		m.applyOptimistic(c)
+		m.applyQuality(c, spec, err, time.Now())
+		m.checkSensorFaults(c, err)
 	}
 	return cards
 }
@@ -321,9 +596,24 @@ func (m *Manager) GetAllCards() []*Card {
 	return cards
 }
 
+// setReadError shows a failed read in the card state and logs it
+func (m *Manager) setReadError(c *Card, err error) {
+	c.Last.Error = err.Error()
+	c.Last.ErrorCode = busErrorCode(err)
+	c.Last.ErrorParams = ErrorParamsOf(err)
+	m.logCardError(c.ID, "read", err)
+}
+
 // ReadAllAndProcessWrites reads all cards and processes pending writes after each card read
 // This minimizes write latency by processing writes immediately as they're queued
 func (m *Manager) ReadAllAndProcessWrites() []*Card {
+	// Card states come from the recording while a replay is active
+	if m.isReplaying() {
+		return m.GetAllCards()
+	}
+	started := time.Now()
+	cycle := m.beginCycle()
+
 	m.mu.Lock()
 	cards := make([]*Card, 0, len(m.cards))
 	for _, c := range m.cards {
@@ -338,9 +628,10 @@ func (m *Manager) ReadAllAndProcessWrites() []*Card {
 		return idi < idj
 	})
 
-	hasStateChange := false
+	var changed []string // Cards whose DI or AI values changed
+	var fault string     // First failure of the cycle, stops the heartbeat output
 	for _, c := range cards {
-		spec := ModelTable[c.Module]
+		spec := m.pollSpec(c)
 
 		// Get port directly - ports are created when cards are added via AddCard()
 		m.mu.Lock()
@@ -349,48 +640,102 @@ func (m *Manager) ReadAllAndProcessWrites() []*Card {
 
 		if !ok {
 			// Port should exist, but handle edge case defensively
-			c.Last.Error = fmt.Sprintf("port %s not found", c.PortPath)
+			m.setReadError(c, errorf(CodePortUnavailable, "port %s not found", c.PortPath).with("port", c.PortPath))
+			if fault == "" {
+				fault = fmt.Sprintf("card %s: %s", c.ID, c.Last.Error)
+			}
+			continue
+		}
+
+		// Failing cards are retried at a lower rate (see scheduleRetry)
+		if m.readDeferred(c, time.Now()) {
+			m.deferRead(c, spec, time.Now())
+			if fault == "" {
+				fault = fmt.Sprintf("card %s: %s", c.ID, c.Last.Error)
+			}
 			continue
 		}
 
 		// Store previous state for change detection
 		prevState := c.Last
 
-		// Check if we need a full read (e.g., after reboot)
-		m.mu.Lock()
-		readAll := c.needsFullRead
-		if readAll {
-			// Clear the flag after we've read it
-			c.needsFullRead = false
-		}
-		m.mu.Unlock()
+		// Check if we need a full read (e.g., after reboot, or the identity fields are due for a refresh)
+		readAll := m.fullReadDue(c, time.Now())
 
-		state, err := pc.readCard(c.SlaveID, spec, readAll)
+		readStart := time.Now()
+		state, err := pc.read(cardDriver(c), c.SlaveID, spec, readAll)
+		m.recordRead(c.ID, time.Since(readStart))
+		if m.modelCheckDue(c, err, time.Now()) {
+			m.verifyModel(c, pc)
+		}
+		m.scheduleRetry(c, err, time.Now())
+		m.trackOnline(c, err)
 		if err != nil {
-			c.Last.Error = err.Error()
+			m.setReadError(c, err)
+			if fault == "" {
+				fault = fmt.Sprintf("card %s: %v", c.ID, err)
+			}
+			if readAll {
+				// Retry the full read once the card answers again (e.g. after a reboot)
+				m.mu.Lock()
+				c.needsFullRead = true
+				m.mu.Unlock()
+			}
 		} else {
 			if readAll {
 				// Full read includes AO types and serial number, use them directly
-				c.Last = state
+				state.IdentityReadAt = state.Timestamp
 			} else {
-				// Preserve SN and AOType from previous state (read only during AddCard)
-				state.SerialNumber = c.Last.SerialNumber
-				state.AOType = c.Last.AOType
-				c.Last = state
+				// Preserve the identity fields from the last full read
+				keepIdentity(&state, c.Last)
 			}
+			c.Last = state
+			m.markRead(c.ID, cycle)
+		}
+		if err == nil {
+			m.checkSerialNumber(c, pc, time.Now())
+			m.countRelayCycles(c, state.DO)
+			m.countRuntime(c, state)
+			m.recordAIStats(c, spec, state)
+			m.recordOutputs(c, state)
+			m.capturePulses(c, pc, prevState.DI)
 		}
+		m.applySimulation(c.ID, spec, &c.Last)
+		m.applyOptimistic(c)
+		m.applyQuality(c, spec, err, time.Now())
+		m.checkSensorFaults(c, err)
 
 		// Check if DI or AI changed
-		if !hasStateChange {
-			hasStateChange = m.detectStateChange(&prevState, &c.Last)
+		if m.detectStateChange(&prevState, &c.Last) && !slices.Contains(changed, c.ID) {
+			changed = append(changed, c.ID)
 		}
 
 		// Process any pending writes after each card read to minimize latency
 		m.ProcessWriteQueue()
+
+		// Re-read the priority inputs of the other cards between card reads
+		for _, id := range m.pollPriority(c.ID) {
+			if !slices.Contains(changed, id) {
+				changed = append(changed, id)
+			}
+		}
 	}
 
+	// Run scripts, PID loops and schedules on the fresh inputs and write their outputs
+	m.runScripts(changed)
+	m.runPIDLoops()
+	m.runSchedules(time.Now())
+	m.ProcessWriteQueue()
+	m.advanceRamps()
+	m.runHeartbeat(fault)
+	m.checkMaintenance(time.Now())
+	m.evaluateAlarms()
+
+	m.recordStates(cards)
+	m.takeSnapshot(cycle, cards)
+
 	// Call state change callback if DI or AI changed
-	if hasStateChange {
+	if len(changed) > 0 {
 		m.mu.Lock()
 		callback := m.stateChangeCallback
 		m.mu.Unlock()
@@ -401,6 +746,7 @@ func (m *Manager) ReadAllAndProcessWrites() []*Card {
 		}
 	}
 
+	m.finishCycle(started)
 	return cards
 }
 
@@ -432,6 +778,9 @@ func (m *Manager) detectStateChange(oldState, newState *CardState) bool {
 // StartCycle starts the continuous read-write cycle: interleaves reads and writes
 // This prevents writes from being delayed when there are many cards to read
 func (m *Manager) StartCycle() {
+	m.mu.Lock()
+	m.cycleRunning = true
+	m.mu.Unlock()
 	go func() {
 		for {
 			select {
@@ -440,7 +789,9 @@ func (m *Manager) StartCycle() {
 			default:
 				// Read all cards and process writes after each card read
 				m.ReadAllAndProcessWrites()
-				time.Sleep(m.cycleDelay)
+				if !m.pauseCycle() {
+					return
+				}
 			}
 		}
 	}()
@@ -449,83 +800,145 @@ func (m *Manager) StartCycle() {
 // StopCycle stops the background cycle goroutine
 func (m *Manager) StopCycle() {
 	close(m.stopChan)
+	m.saveRelayCycles()
+	m.saveRuntime()
+	m.saveOutputs()
 }
 
 // QueueWriteDO queues a DO write operation
 func (m *Manager) QueueWriteDO(cardID string, index int, state bool) error {
+	return m.QueueWriteDOContext(context.Background(), cardID, index, state)
+}
+
+// QueueWriteDOContext queues a DO write operation; the span in ctx is continued when the write executes
+func (m *Manager) QueueWriteDOContext(ctx context.Context, cardID string, index int, state bool) error {
 	c, ok := m.GetCard(cardID)
 	if !ok {
-		return fmt.Errorf("card not found")
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
 	}
 
-	spec := ModelTable[c.Module]
+	spec := cardSpec(c)
 	if index < 0 || index >= spec.DO {
-		return fmt.Errorf("index out of range")
+		return errorf(CodeIndexOutOfRange, "index out of range").with("channel", ChannelKey(writeOpDO, index))
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	var value float32
 	if state {
 		value = 1.0
 	}
-	m.writeQueue = append(m.writeQueue, writeOperation{
+	op := writeOperation{
 		CardID: cardID,
 		Type:   writeOpDO,
 		Index:  index,
 		Value:  value,
-	})
+	}
+	if err := m.checkWritePermission(cardID, writeOpDO, index, sourceFrom(ctx)); err != nil {
+		return err
+	}
+	if violations := m.checkInterlocks([]writeOperation{op}); len(violations) > 0 {
+		return violations[0]
+	}
+	if err := m.checkControl(cardID, writeOpDO, index, sourceFrom(ctx)); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.replayConflictLocked(); err != nil {
+		return err
+	}
+
+	// Writes within the minimum on/off time are rejected here or held back by ProcessWriteQueue
+	op.source = sourceFrom(ctx)
+	if sc, ok := m.shortCycleLocked(op, time.Now()); ok && !sc.delay {
+		return sc.err()
+	}
+	m.dropHeldLocked(cardID, index)
+	if err := m.enqueueLocked(ctx, op); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 // QueueWriteAO queues an AO write operation
 func (m *Manager) QueueWriteAO(cardID string, index int, value float32) error {
+	return m.QueueWriteAOContext(context.Background(), cardID, index, value)
+}
+
+// QueueWriteAOContext queues an AO write operation; the span in ctx is continued when the write executes
+func (m *Manager) QueueWriteAOContext(ctx context.Context, cardID string, index int, value float32) error {
 	c, ok := m.GetCard(cardID)
 	if !ok {
-		return fmt.Errorf("card not found")
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
 	}
 
-	spec := ModelTable[c.Module]
+	spec := cardSpec(c)
 	if index < 0 || index >= spec.AO {
-		return fmt.Errorf("index out of range")
+		return errorf(CodeIndexOutOfRange, "index out of range").with("channel", ChannelKey(writeOpAO, index))
+	}
+	if err := m.checkWritePermission(cardID, writeOpAO, index, sourceFrom(ctx)); err != nil {
+		return err
+	}
+	if err := m.checkControl(cardID, writeOpAO, index, sourceFrom(ctx)); err != nil {
+		return err
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if err := m.replayConflictLocked(); err != nil {
+		return err
+	}
 
-	m.writeQueue = append(m.writeQueue, writeOperation{
+	if err := m.enqueueLocked(ctx, writeOperation{
 		CardID: cardID,
 		Type:   writeOpAO,
 		Index:  index,
 		Value:  value,
-	})
+	}); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 // QueueWriteAOType queues an AO type write operation
 func (m *Manager) QueueWriteAOType(cardID string, index int, mode string) error {
+	return m.QueueWriteAOTypeContext(context.Background(), cardID, index, mode)
+}
+
+// QueueWriteAOTypeContext queues an AO type write operation; the span in ctx is continued when the write executes
+func (m *Manager) QueueWriteAOTypeContext(ctx context.Context, cardID string, index int, mode string) error {
 	c, ok := m.GetCard(cardID)
 	if !ok {
-		return fmt.Errorf("card not found")
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
 	}
 
-	spec := ModelTable[c.Module]
+	spec := cardSpec(c)
 	if index < 0 || index >= spec.AO {
-		return fmt.Errorf("index out of range")
+		return errorf(CodeIndexOutOfRange, "index out of range").with("channel", ChannelKey(writeOpAOType, index))
+	}
+	if err := m.checkWritePermission(cardID, writeOpAOType, index, sourceFrom(ctx)); err != nil {
+		return err
+	}
+	if err := m.checkControl(cardID, writeOpAOType, index, sourceFrom(ctx)); err != nil {
+		return err
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if err := m.replayConflictLocked(); err != nil {
+		return err
+	}
 
-	m.writeQueue = append(m.writeQueue, writeOperation{
+	if err := m.enqueueLocked(ctx, writeOperation{
 		CardID: cardID,
 		Type:   writeOpAOType,
 		Index:  index,
 		Mode:   mode,
-	})
+	}); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -533,9 +946,18 @@ func (m *Manager) QueueWriteAOType(cardID string, index int, mode string) error
 // ProcessWriteQueue processes all queued write operations using batch optimization
 func (m *Manager) ProcessWriteQueue() {
 	m.mu.Lock()
-	queue := make([]writeOperation, len(m.writeQueue))
-	copy(queue, m.writeQueue)
-	m.writeQueue = m.writeQueue[:0] // Clear the queue
+	now := time.Now()
+	queue := make([]writeOperation, 0, len(m.writeQueue))
+	held := m.writeQueue[:0] // DO writes held back by their minimum on/off time stay queued
+	for _, op := range m.writeQueue {
+		if sc, ok := m.shortCycleLocked(op, now); ok && sc.delay {
+			op.notBefore = sc.until
+			held = append(held, op)
+			continue
+		}
+		queue = append(queue, op)
+	}
+	m.writeQueue = held
 	m.mu.Unlock()
 
 	if len(queue) == 0 {
@@ -544,6 +966,9 @@ func (m *Manager) ProcessWriteQueue() {
 
 	// Use batch processing for better performance
 	results := m.ProcessBatchWrite(queue)
+	m.recordWriteWaits(queue, now)
+	m.confirmOptimistic(queue)
+	m.emitWriteExecuted(queue, results)
 
 	// Log any errors from batch processing
 	for i, result := range results {
@@ -553,13 +978,27 @@ func (m *Manager) ProcessWriteQueue() {
 	}
 }
 
-// RebootCard sends a reboot command to the specified card
+// RebootCard sends a reboot command to the specified card and emits a card-reboot event
 func (m *Manager) RebootCard(cardID string) error {
+	err := m.rebootCard(cardID)
+	if ErrorCodeOf(err) == CodeCardNotFound {
+		return err
+	}
+	data := map[string]interface{}{"status": "ok"}
+	if err != nil {
+		data["status"] = "error"
+		data["message"] = err.Error()
+	}
+	m.emitEvent(EventCardReboot, cardID, data)
+	return err
+}
+
+func (m *Manager) rebootCard(cardID string) error {
 	m.mu.Lock()
 	c, ok := m.cards[cardID]
 	if !ok {
 		m.mu.Unlock()
-		return fmt.Errorf("card not found")
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
 	}
 
 	// Set flag to read all info (AO types) on next read cycle after reboot
@@ -568,10 +1007,20 @@ func (m *Manager) RebootCard(cardID string) error {
 
 	pc, err := m.ensurePort(c.PortPath)
 	if err != nil {
+		err = errorf(CodePortUnavailable, "failed to get port: %v", err).with("port", c.PortPath)
+		m.logCardError(cardID, "reboot", err)
 		return err
 	}
 
-	return pc.reboot(c.SlaveID)
+	rebooter, ok := cardDriver(c).(CardRebooter)
+	if !ok {
+		return errorf(CodeInvalidRequest, "%s cards can't be rebooted", cardDriver(c).Name())
+	}
+	if err := pc.do(c.SlaveID, rebooter.Reboot); err != nil {
+		m.logCardError(cardID, "reboot", err)
+		return errorf(busErrorCode(err), "%v", err)
+	}
+	return nil
 }
 
 // SetStateChangeCallback sets a callback that will be called when card state changes (DI or AI)
@@ -583,9 +1032,14 @@ func (m *Manager) SetStateChangeCallback(callback StateChangeCallback) {
 
 // CommandResult represents the result of a single command in a batch
 type CommandResult struct {
-	Index   int    `json:"index"`             // Index in the original commands array
-	Status  string `json:"status"`            // "ok" or "error"
-	Message string `json:"message,omitempty"` // Optional error message
+	Index  int       `json:"index"`          // Index in the original commands array
+	Status string    `json:"status"`         // "ok" or "error"
+	Code   ErrorCode `json:"code,omitempty"` // Error code if Status is "error"
+	// Params are the parameters of the error message, for clients rendering a localized message
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Message string                 `json:"message,omitempty"` // Optional error message
+	// Exception is the Modbus exception code if the card answered with an exception
+	Exception byte `json:"exception,omitempty"`
 }
 
 // WriteGroup represents a group of write operations that can be combined
@@ -624,6 +1078,10 @@ func (m *Manager) GroupWriteOperations(ops []writeOperation) []WriteGroup {
 
 // shouldWrite checks if a write operation is needed (value changed)
 func (m *Manager) shouldWrite(op writeOperation, card *Card) bool {
+	// The cached value of a channel with an optimistic value wasn't read from the card
+	if m.hasOptimistic(card, op) {
+		return true
+	}
 	switch op.Type {
 	case writeOpDO:
 		if op.Index >= 0 && op.Index < len(card.Last.DO) {
@@ -647,48 +1105,51 @@ func (m *Manager) shouldWrite(op writeOperation, card *Card) bool {
 
 // ProcessBatchWrite processes a batch of write operations with optimization
 func (m *Manager) ProcessBatchWrite(ops []writeOperation) []CommandResult {
-	results := make([]CommandResult, len(ops))
+	return m.ProcessBatchWriteContext(context.Background(), ops)
+}
 
-	// Validate all operations first
-	for i, op := range ops {
-		card, ok := m.GetCard(op.CardID)
-		if !ok {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: "card not found",
-			}
-			continue
-		}
+// ProcessBatchWriteContext is ProcessBatchWrite with a trace context for the batch span
+func (m *Manager) ProcessBatchWriteContext(ctx context.Context, ops []writeOperation) []CommandResult {
+	ctx, span := startBatchSpan(ctx, ops)
+	defer span.End()
 
-		// Validate index ranges
-		spec := ModelTable[card.Module]
-		var maxIndex int
-		switch op.Type {
-		case writeOpDO:
-			maxIndex = spec.DO
-		case writeOpAO, writeOpAOType:
-			maxIndex = spec.AO
+	// Queued operations carry their own source, the others write as the source of ctx
+	ops = append([]writeOperation(nil), ops...)
+	for i := range ops {
+		if ops[i].source.Kind == "" {
+			ops[i].source = sourceFrom(ctx)
 		}
+	}
 
-		if op.Index < 0 || op.Index >= maxIndex {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: "index out of range",
-			}
-			continue
+	results := make([]CommandResult, len(ops))
+	if err := m.replayConflict(); err != nil {
+		for i := range ops {
+			results[i] = errorResultOf(i, err)
 		}
-
-		// Check if value actually changed (skip if unchanged)
-		if !m.shouldWrite(op, card) {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "ok",
-				Message: "value unchanged, skipped",
-			}
+		return results
+	}
+	defer func() { m.recordWrites(ops, results) }()
+	defer func() { m.recordOwners(ops, results) }()
+	violations := m.checkInterlocks(ops)
+	shortCycles := m.checkShortCycles(ops, false)
+	defer func() { m.recordSwitches(ops, results, shortCycles) }()
+	m.checkWrites(ctx, ops, results, violations, shortCycles, false)
+
+	// Writes bound to a safe state generation are rejected if safe state was applied since, and ramp steps
+	// if their ramp was stopped; holding the read lock until the writes are done keeps safe state from
+	// being applied in between
+	m.safeStateMu.RLock()
+	defer m.safeStateMu.RUnlock()
+	gen := m.safeStateGen.Load()
+	for i, op := range ops {
+		if results[i].Status != "" {
 			continue
 		}
+		if op.safeStateGen != 0 && op.safeStateGen != gen {
+			results[i] = errorResult(i, CodeConflict, "safe state was applied")
+		} else if op.ramp != nil && !m.rampActive(op.ramp) {
+			results[i] = errorResult(i, CodeConflict, "ramp was stopped")
+		}
 	}
 
 	// Filter out operations that failed validation or were skipped
@@ -711,7 +1172,7 @@ func (m *Manager) ProcessBatchWrite(ops []writeOperation) []CommandResult {
 
 	// Process each group
 	for _, group := range groups {
-		groupResults := m.processWriteGroup(group)
+		groupResults := m.processWriteGroup(ctx, group)
 
 		// Map group results back to original indices
 		// Find which validOps indices correspond to this group
@@ -741,37 +1202,119 @@ func (m *Manager) ProcessBatchWrite(ops []writeOperation) []CommandResult {
 	return results
 }
 
+// checkWrites validates a batch of write operations and sets the results of the operations that are
+// rejected, held back, ramped or skipped as unchanged; the results of the operations to write stay empty.
+// A dry run (see SimulateBatchWrite) neither holds back nor ramps anything.
+func (m *Manager) checkWrites(ctx context.Context, ops []writeOperation, results []CommandResult, violations map[int]*Error, shortCycles map[int]shortCycle, dry bool) {
+	// Validate all operations first
+	for i, op := range ops {
+		card, ok := m.GetCard(op.CardID)
+		if !ok {
+			results[i] = errorResultOf(i, errorf(CodeCardNotFound, "card not found").with("cardId", op.CardID))
+			continue
+		}
+
+		// Validate index ranges
+		spec := cardSpec(card)
+		var maxIndex int
+		switch op.Type {
+		case writeOpDO:
+			maxIndex = spec.DO
+		case writeOpAO, writeOpAOType:
+			maxIndex = spec.AO
+		}
+
+		if op.Index < 0 || op.Index >= maxIndex {
+			results[i] = errorResultOf(i, errorf(CodeIndexOutOfRange, "index out of range").with("channel", ChannelKey(op.Type, op.Index)))
+			continue
+		}
+
+		// Writes to a duplicated slave ID would reach more than one card
+		if conflict := m.cardConflict(card); conflict != "" {
+			results[i] = errorResultOf(i, errorf(CodeSlaveConflict, "%s", conflict).with("cardId", op.CardID).with("slaveId", card.SlaveID))
+			continue
+		}
+
+		// Reject writes by sources not allowed to write the channel
+		if err := m.checkWritePermission(op.CardID, op.Type, op.Index, op.source); err != nil {
+			results[i] = errorResultOf(i, err)
+			continue
+		}
+
+		// Reject writes that would break an interlock
+		if err, ok := violations[i]; ok {
+			results[i] = errorResultOf(i, err)
+			continue
+		}
+
+		// Reject writes to channels held by a source of higher priority
+		if err := m.checkControl(op.CardID, op.Type, op.Index, op.source); err != nil {
+			results[i] = errorResultOf(i, err)
+			continue
+		}
+
+		// Reject or hold back DO switches within the minimum on/off time of the channel
+		if sc, ok := shortCycles[i]; ok {
+			if !sc.delay {
+				results[i] = errorResultOf(i, sc.err())
+				continue
+			}
+			if !dry {
+				if err := m.holdWrite(ctx, op, sc.until); err != nil {
+					results[i] = errorResultOf(i, err)
+					continue
+				}
+			}
+			results[i] = CommandResult{Index: i, Status: "ok", Message: sc.message}
+			continue
+		}
+
+		// Ramp AO changes on channels with a slew rate
+		if msg, ok := m.startRamp(op, card, dry); ok {
+			results[i] = CommandResult{Index: i, Status: "ok", Message: msg}
+			continue
+		}
+
+		// Check if value actually changed (skip if unchanged)
+		if !m.shouldWrite(op, card) {
+			results[i] = CommandResult{
+				Index:   i,
+				Status:  "ok",
+				Message: "value unchanged, skipped",
+			}
+			continue
+		}
+	}
+}
+
 // processWriteGroup processes a group of write operations for the same card and register type
-func (m *Manager) processWriteGroup(group WriteGroup) []CommandResult {
+func (m *Manager) processWriteGroup(ctx context.Context, group WriteGroup) []CommandResult {
 	card, ok := m.GetCard(group.CardID)
 	if !ok {
 		// All operations in group fail
 		results := make([]CommandResult, len(group.Operations))
 		for i := range results {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: "card not found",
-			}
+			results[i] = errorResult(i, CodeCardNotFound, "card not found")
 		}
 		return results
 	}
 
 	pc, err := m.ensurePort(card.PortPath)
 	if err != nil {
+		m.logCardError(card.ID, writeOpName(group.RegisterType), errorf(CodePortUnavailable, "failed to get port: %v", err))
 		results := make([]CommandResult, len(group.Operations))
 		for i := range results {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: fmt.Sprintf("failed to get port: %v", err),
-			}
+			results[i] = errorResult(i, CodePortUnavailable, fmt.Sprintf("failed to get port: %v", err))
 		}
 		return results
 	}
 
 	results := make([]CommandResult, len(group.Operations))
 
+	// The span covers waiting for the port and the bus transaction itself
+	_, span := startBusSpan(ctx, "modbus."+writeOpName(group.RegisterType), card, len(group.Operations))
+	defer span.End()
+
 	switch group.RegisterType {
 	case writeOpDO:
 		m.processBatchDO(pc, card, group.Operations, results)
@@ -780,6 +1323,7 @@ func (m *Manager) processWriteGroup(group WriteGroup) []CommandResult {
 	case writeOpAOType:
 		m.processBatchAOType(pc, card, group.Operations, results)
 	}
+	endBusSpan(span, results)
 
 	return results
 }
@@ -790,47 +1334,16 @@ func (m *Manager) processBatchDO(pc *portClient, card *Card, ops []writeOperatio
 		return
 	}
 
-	// Find min and max indices
-	minIdx := ops[0].Index
-	maxIdx := ops[0].Index
-	for _, op := range ops {
-		if op.Index < minIdx {
-			minIdx = op.Index
-		}
-		if op.Index > maxIdx {
-			maxIdx = op.Index
-		}
-	}
-
-	// Create array covering all indices from min to max
-	count := maxIdx - minIdx + 1
-	values := make([]bool, count)
-
-	// Initialize with cached values
-	for i := 0; i < count; i++ {
-		idx := minIdx + i
-		if idx < len(card.Last.DO) {
-			values[i] = card.Last.DO[idx]
-		}
-	}
-
-	// Override with new values from operations
-	for _, op := range ops {
-		idx := op.Index - minIdx
-		values[idx] = op.Value != 0
-	}
-
 	// Write all coils at once
-	err := pc.writeMultipleDO(card.SlaveID, uint16(minIdx), values)
+	err := pc.write(cardDriver(card), card.SlaveID, doWrite(card, ops))
+	if err != nil {
+		m.logCardError(card.ID, "write-do", err)
+	}
 
 	// Set results
 	for i := range ops {
 		if err != nil {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: err.Error(),
-			}
+			results[i] = busErrorResult(i, err)
 		} else {
 			results[i] = CommandResult{
 				Index:  i,
@@ -846,47 +1359,16 @@ func (m *Manager) processBatchAO(pc *portClient, card *Card, ops []writeOperatio
 		return
 	}
 
-	// Find min and max indices
-	minIdx := ops[0].Index
-	maxIdx := ops[0].Index
-	for _, op := range ops {
-		if op.Index < minIdx {
-			minIdx = op.Index
-		}
-		if op.Index > maxIdx {
-			maxIdx = op.Index
-		}
-	}
-
-	// Create array covering all indices from min to max
-	count := maxIdx - minIdx + 1
-	values := make([]float32, count)
-
-	// Initialize with cached values
-	for i := 0; i < count; i++ {
-		idx := minIdx + i
-		if idx < len(card.Last.AO) {
-			values[i] = card.Last.AO[idx]
-		}
-	}
-
-	// Override with new values from operations
-	for _, op := range ops {
-		idx := op.Index - minIdx
-		values[idx] = op.Value
-	}
-
 	// Write all AO values at once
-	err := pc.writeMultipleAO(card.SlaveID, minIdx, values)
+	err := pc.write(cardDriver(card), card.SlaveID, aoWrite(card, ops))
+	if err != nil {
+		m.logCardError(card.ID, "write-ao", err)
+	}
 
 	// Set results
 	for i := range ops {
 		if err != nil {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: err.Error(),
-			}
+			results[i] = busErrorResult(i, err)
 		} else {
 			results[i] = CommandResult{
 				Index:  i,
@@ -897,111 +1379,297 @@ func (m *Manager) processBatchAO(pc *portClient, card *Card, ops []writeOperatio
 }
 
 // processBatchAOType processes multiple AOType write operations
+// AOType registers are consecutive (0x0190 + index), so runs of contiguous channels
+// are combined into a single WriteMultipleRegisters request
 func (m *Manager) processBatchAOType(pc *portClient, card *Card, ops []writeOperation, results []CommandResult) {
-	// AOType writes are to different register addresses (0x0190 + index)
-	// They cannot be combined into a single WriteMultipleRegisters if addresses are non-contiguous
-	// For now, process individually but could be optimized if addresses are contiguous
+	if len(ops) == 0 {
+		return
+	}
 
-	for i, op := range ops {
-		err := pc.writeAOType(card.SlaveID, op.Index, op.Mode)
+	// Write each contiguous run and remember the outcome per channel
+	errs := make(map[int]error)
+	for _, w := range aoTypeWrites(ops) {
+		err := pc.write(cardDriver(card), card.SlaveID, w)
 		if err != nil {
-			results[i] = CommandResult{
-				Index:   i,
-				Status:  "error",
-				Message: err.Error(),
-			}
+			m.logCardError(card.ID, "write-aotype", err)
+		}
+		for k := range w.AOType {
+			errs[w.Start+k] = err
+		}
+	}
+
+	// Set results
+	for i, op := range ops {
+		if err := errs[op.Index]; err != nil {
+			results[i] = busErrorResult(i, err)
 		} else {
 			results[i] = CommandResult{
 				Index:  i,
 				Status: "ok",
 			}
 		}
+	}
+}
 
-		// Add delay between writes if there are more
-		if i < len(ops)-1 {
-			time.Sleep(pc.operationDelay)
+// indexRange returns the lowest and highest channel index of a batch of write operations
+func indexRange(ops []writeOperation) (minIdx, maxIdx int) {
+	minIdx, maxIdx = ops[0].Index, ops[0].Index
+	for _, op := range ops {
+		minIdx = min(minIdx, op.Index)
+		maxIdx = max(maxIdx, op.Index)
+	}
+	return minIdx, maxIdx
+}
+
+// doWrite builds the coil write of DO operations on a card: one request covering all their channels,
+// the channels in between keeping their cached state
+func doWrite(card *Card, ops []writeOperation) OutputWrite {
+	minIdx, maxIdx := indexRange(ops)
+	values := make([]bool, maxIdx-minIdx+1)
+	for i := range values {
+		if idx := minIdx + i; idx < len(card.Last.DO) {
+			values[i] = card.Last.DO[idx]
 		}
 	}
+	for _, op := range ops {
+		values[op.Index-minIdx] = op.Value != 0
+	}
+	return OutputWrite{Type: writeOpDO, Start: minIdx, DO: values}
+}
+
+// aoWrite builds the register write of AO operations on a card: one request covering all their channels,
+// the channels in between keeping their cached value
+func aoWrite(card *Card, ops []writeOperation) OutputWrite {
+	minIdx, maxIdx := indexRange(ops)
+	values := make([]float32, maxIdx-minIdx+1)
+	for i := range values {
+		if idx := minIdx + i; idx < len(card.Last.AO) {
+			values[i] = card.Last.AO[idx]
+		}
+	}
+	for _, op := range ops {
+		values[op.Index-minIdx] = op.Value
+	}
+	return OutputWrite{Type: writeOpAO, Start: minIdx, AO: values}
+}
+
+// aoTypeWrites builds the register writes of AOType operations on a card, one per run of contiguous
+// channels; later operations on a channel override earlier ones
+func aoTypeWrites(ops []writeOperation) []OutputWrite {
+	modes := make(map[int]string)
+	for _, op := range ops {
+		modes[op.Index] = op.Mode
+	}
+	indices := make([]int, 0, len(modes))
+	for idx := range modes {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+
+	var writes []OutputWrite
+	for start := 0; start < len(indices); {
+		end := start + 1
+		for end < len(indices) && indices[end] == indices[end-1]+1 {
+			end++
+		}
+		run := make([]string, 0, end-start)
+		for _, idx := range indices[start:end] {
+			run = append(run, modes[idx])
+		}
+		writes = append(writes, OutputWrite{Type: writeOpAOType, Start: indices[start], AOType: run})
+		start = end
+	}
+	return writes
+}
+
+// WriteAOTypeAll sets the AO type of every channel of a card in one batch.
+// modes must contain either a single mode (applied to all channels) or one mode per channel.
+// The card is flagged for a full read so the new AO types show up in the cached state.
+func (m *Manager) WriteAOTypeAll(cardID string, modes []string) ([]CommandResult, error) {
+	return m.WriteAOTypeAllContext(context.Background(), cardID, modes)
+}
+
+// WriteAOTypeAllContext is WriteAOTypeAll with the trace context and write source in ctx
+func (m *Manager) WriteAOTypeAllContext(ctx context.Context, cardID string, modes []string) ([]CommandResult, error) {
+	c, ok := m.GetCard(cardID)
+	if !ok {
+		return nil, errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
+	}
+
+	spec := cardSpec(c)
+	if spec.AO == 0 {
+		return nil, errorf(CodeInvalidRequest, "card has no analog outputs")
+	}
+	if len(modes) != 1 && len(modes) != spec.AO {
+		return nil, errorf(CodeInvalidRequest, "expected 1 or %d modes, got %d", spec.AO, len(modes))
+	}
+	for _, mode := range modes {
+		if mode != "0-10V" && mode != "4-20mA" {
+			return nil, errorf(CodeInvalidRequest, "invalid mode %q", mode)
+		}
+	}
+
+	ops := make([]writeOperation, spec.AO)
+	for i := range ops {
+		mode := modes[0]
+		if len(modes) > 1 {
+			mode = modes[i]
+		}
+		ops[i] = writeOperation{
+			CardID: cardID,
+			Type:   writeOpAOType,
+			Index:  i,
+			Mode:   mode,
+		}
+	}
+
+	results := m.ProcessBatchWriteContext(ctx, ops)
+
+	m.mu.Lock()
+	c.needsFullRead = true
+	m.mu.Unlock()
+
+	return results, nil
 }
 
 // WriteAllOutputsToSafeState writes all DO and AO outputs to their safe state values
-// This is called when JN (TCP client) disconnects to ensure all outputs are in a safe state
+// This is called when JN (TCP client) disconnects to ensure all outputs are in a safe state.
+// Cards whose outputs couldn't be written are retried in the background (see retrySafeState).
 func (m *Manager) WriteAllOutputsToSafeState() error {
+	// Waits for the writes in progress, then rejects the writes bound to the previous generation
+	m.safeStateMu.Lock()
+	m.safeStateGen.Add(1)
+	m.safeStateMu.Unlock()
+	// Running sequences must not re-energize outputs after safe state is applied
+	m.abortAllSequences()
+	// A new activation retries the cards that fail now; the alarm stays raised while any still fail
+	m.stopSafeStateRetry()
+
 	m.mu.Lock()
 	cards := make([]*Card, 0, len(m.cards))
 	for _, c := range m.cards {
 		cards = append(cards, c)
 	}
-	safeConfig := m.safeStateConfig
 	m.mu.Unlock()
 
 	var firstErr error
+	var failed []string
 	for _, card := range cards {
-		spec := ModelTable[card.Module]
-
-		// Get port for this card
-		pc, err := m.ensurePort(card.PortPath)
-		if err != nil {
+		if err := m.writeCardSafeState(context.Background(), card); err != nil {
 			if firstErr == nil {
-				firstErr = fmt.Errorf("card %s: failed to get port: %v", card.ID, err)
+				firstErr = err
 			}
-			log.Printf("WriteAllOutputsToSafeState: card %s port error: %v", card.ID, err)
-			continue
+			failed = append(failed, card.ID)
 		}
+	}
 
-		// Write all DO outputs to safe state (false = open/off)
-		if spec.DO > 0 {
-			doValues := make([]bool, spec.DO)
-			for i := range doValues {
-				doValues[i] = safeConfig.DOState
-			}
-			err := pc.writeMultipleDO(card.SlaveID, 0, doValues)
-			if err != nil {
-				if firstErr == nil {
-					firstErr = fmt.Errorf("card %s: failed to write DO to safe state: %v", card.ID, err)
-				}
-				log.Printf("WriteAllOutputsToSafeState: card %s DO write error: %v", card.ID, err)
-			} else {
-				log.Printf("WriteAllOutputsToSafeState: card %s - set all %d DO outputs to safe state (%v)", card.ID, spec.DO, safeConfig.DOState)
+	if firstErr != nil {
+		m.emitEvent(EventSafeState, "", map[string]interface{}{"status": "error", "message": firstErr.Error()})
+		m.startSafeStateRetry(failed)
+		return fmt.Errorf("WriteAllOutputsToSafeState completed with errors: %v", firstErr)
+	}
+
+	log.Printf("WriteAllOutputsToSafeState: all outputs set to safe state successfully")
+	m.setSystemAlarm(SafeStateAlarm, "", false)
+	m.emitEvent(EventSafeState, "", map[string]interface{}{"status": "ok"})
+	return nil
+}
+
+// writeCardSafeState writes the DO and AO outputs of one card to their safe state values and returns the
+// first failure. The outputs are written under safeStateMu, between output writes: nothing is written once
+// ctx is done, so a retry stopped by stopSafeStateRetry can't overwrite the outputs of the client taking over.
+func (m *Manager) writeCardSafeState(ctx context.Context, card *Card) error {
+	m.safeStateMu.Lock()
+	if err := ctx.Err(); err != nil {
+		m.safeStateMu.Unlock()
+		return err
+	}
+	pc, doValues, aoValues, err := m.writeCardSafeStateLocked(card)
+	m.safeStateMu.Unlock()
+
+	if err == nil {
+		m.verifySafeState(card, pc, doValues, aoValues)
+	}
+	return err
+}
+
+// writeCardSafeStateLocked writes the outputs of writeCardSafeState and returns the values written. The
+// caller must hold safeStateMu.
+func (m *Manager) writeCardSafeStateLocked(card *Card) (*portClient, []bool, []float32, error) {
+	spec := cardSpec(card)
+
+	// Stop the AO ramps of the card first: a ramp step being written completes before, the steps checked
+	// after are dropped
+	m.cancelRamps(card.ID)
+
+	// Get port for this card
+	pc, err := m.ensurePort(card.PortPath)
+	if err != nil {
+		log.Printf("WriteAllOutputsToSafeState: card %s port error: %v", card.ID, err)
+		return nil, nil, nil, fmt.Errorf("card %s: failed to get port: %v", card.ID, err)
+	}
+
+	m.mu.Lock()
+	safeConfig := m.safeStateConfig
+	doSafe, aoSafe := m.pointSafeStatesLocked(card)
+	m.mu.Unlock()
+
+	var firstErr error
+	var doValues []bool
+	var aoValues []float32
+	// Write all DO outputs to safe state (false = open/off), or the safe state of their point
+	if spec.DO > 0 {
+		doValues = make([]bool, spec.DO)
+		for i := range doValues {
+			doValues[i] = safeConfig.DOState
+			if v, ok := doSafe[i]; ok {
+				doValues[i] = v
 			}
 		}
+		err := pc.write(cardDriver(card), card.SlaveID, OutputWrite{Type: writeOpDO, DO: doValues})
+		if err != nil {
+			firstErr = fmt.Errorf("card %s: failed to write DO to safe state: %v", card.ID, err)
+			log.Printf("WriteAllOutputsToSafeState: card %s DO write error: %v", card.ID, err)
+		} else {
+			log.Printf("WriteAllOutputsToSafeState: card %s - set all %d DO outputs to safe state (%v)", card.ID, spec.DO, doValues)
+			m.setSafeStateOwner(card.ID, writeOpDO, spec.DO)
+			m.safeStateSwitched(card.ID, doValues)
+		}
+	}
 
-		// Write all AO outputs to safe state based on their type
-		if spec.AO > 0 {
-			// Read current AO types if not already cached
-			m.mu.Lock()
-			cardState := card.Last
-			m.mu.Unlock()
-
-			aoValues := make([]float32, spec.AO)
-			for i := 0; i < spec.AO; i++ {
-				// Determine safe value based on AO type
-				if i < len(cardState.AOType) && cardState.AOType[i] == "4-20mA" {
-					// Safe config is in mA; module expects raw value = mA * 1000
-					aoValues[i] = safeConfig.AOCurrentValue * 1000
-				} else {
-					// Default to voltage value (0-10V or unknown type)
-					// Safe config is in V; module expects raw value = V * 1000
-					aoValues[i] = safeConfig.AOVoltageValue * 1000
-				}
-			}
+	// Write all AO outputs to safe state based on their type
+	if spec.AO > 0 {
+		// Read current AO types if not already cached
+		m.mu.Lock()
+		cardState := card.Last
+		m.mu.Unlock()
 
-			err := pc.writeMultipleAO(card.SlaveID, 0, aoValues)
-			if err != nil {
-				if firstErr == nil {
-					firstErr = fmt.Errorf("card %s: failed to write AO to safe state: %v", card.ID, err)
-				}
-				log.Printf("WriteAllOutputsToSafeState: card %s AO write error: %v", card.ID, err)
+		aoValues = make([]float32, spec.AO)
+		for i := 0; i < spec.AO; i++ {
+			// Determine safe value based on AO type
+			if i < len(cardState.AOType) && cardState.AOType[i] == "4-20mA" {
+				// Safe config is in mA; module expects raw value = mA * 1000
+				aoValues[i] = safeConfig.AOCurrentValue * 1000
 			} else {
-				log.Printf("WriteAllOutputsToSafeState: card %s - set all %d AO outputs to safe state", card.ID, spec.AO)
+				// Default to voltage value (0-10V or unknown type)
+				// Safe config is in V; module expects raw value = V * 1000
+				aoValues[i] = safeConfig.AOVoltageValue * 1000
+			}
+			if v, ok := aoSafe[i]; ok {
+				aoValues[i] = v * 1000
 			}
 		}
-	}
 
-	if firstErr != nil {
-		return fmt.Errorf("WriteAllOutputsToSafeState completed with errors: %v", firstErr)
+		err := pc.write(cardDriver(card), card.SlaveID, OutputWrite{Type: writeOpAO, AO: aoValues})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("card %s: failed to write AO to safe state: %v", card.ID, err)
+			}
+			log.Printf("WriteAllOutputsToSafeState: card %s AO write error: %v", card.ID, err)
+		} else {
+			log.Printf("WriteAllOutputsToSafeState: card %s - set all %d AO outputs to safe state", card.ID, spec.AO)
+			m.setSafeStateOwner(card.ID, writeOpAO, spec.AO)
+		}
 	}
-
-	log.Printf("WriteAllOutputsToSafeState: all outputs set to safe state successfully")
-	return nil
+	return pc, doValues, aoValues, firstErr
 }
@@ -3,8 +3,11 @@ package localio
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/goburrow/modbus"
+
+	"jaspermate-utils/src/server/config/configtest"
 )
 
 // MockClient implements modbus.Client
@@ -252,3 +255,181 @@ func TestManager_AutoDiscover(t *testing.T) {
 		t.Errorf("Expected detected module IO4040, got %s", card.Module)
 	}
 }
+
+// newIO0404Client returns a mock client that answers the reads of an IO0404 card
+func newIO0404Client() *MockClient {
+	return &MockClient{
+		ReadInputRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+	}
+}
+
+func TestManager_WriteAOTypeAll(t *testing.T) {
+	mgr := NewManager()
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) {
+		return &MockClientHandler{}, nil
+	}
+
+	type regWrite struct {
+		address, quantity uint16
+		value             []byte
+	}
+	var writes []regWrite
+	client := newIO0404Client()
+	client.WriteMultipleRegistersFunc = func(address, quantity uint16, value []byte) ([]byte, error) {
+		writes = append(writes, regWrite{address, quantity, value})
+		return []byte{}, nil
+	}
+	client.WriteSingleRegisterFunc = func(address, value uint16) ([]byte, error) {
+		t.Errorf("unexpected single register write at 0x%04X", address)
+		return []byte{}, nil
+	}
+	mgr.clientFactory = func(h modbus.ClientHandler) modbus.Client { return client }
+
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	results, err := mgr.WriteAOTypeAll(card.ID, []string{"4-20mA"})
+	if err != nil {
+		t.Fatalf("WriteAOTypeAll failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Status != "ok" || result.Index != i {
+			t.Errorf("Unexpected result %d: %+v", i, result)
+		}
+	}
+
+	if len(writes) != 1 {
+		t.Fatalf("Expected a single contiguous write, got %d", len(writes))
+	}
+	if writes[0].address != 0x0190 || writes[0].quantity != 4 {
+		t.Errorf("Expected write at 0x0190 qty 4, got 0x%04X qty %d", writes[0].address, writes[0].quantity)
+	}
+	want := []byte{0, 4, 0, 4, 0, 4, 0, 4}
+	if string(writes[0].value) != string(want) {
+		t.Errorf("Expected register values %v, got %v", want, writes[0].value)
+	}
+
+	if _, err := mgr.WriteAOTypeAll(card.ID, []string{"bogus"}); err == nil {
+		t.Error("Expected error for invalid mode")
+	}
+	if _, err := mgr.WriteAOTypeAll(card.ID, []string{"0-10V", "4-20mA"}); err == nil {
+		t.Error("Expected error for wrong number of modes")
+	}
+}
+
+func TestManager_ProcessBatchAOType_NonContiguous(t *testing.T) {
+	mgr := NewManager()
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) {
+		return &MockClientHandler{}, nil
+	}
+
+	var addresses []uint16
+	client := newIO0404Client()
+	client.WriteMultipleRegistersFunc = func(address, quantity uint16, value []byte) ([]byte, error) {
+		addresses = append(addresses, address)
+		return []byte{}, nil
+	}
+	mgr.clientFactory = func(h modbus.ClientHandler) modbus.Client { return client }
+
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	results := mgr.ProcessBatchWrite([]WriteOperation{
+		{CardID: card.ID, Type: WriteOpAOType, Index: 3, Mode: "0-10V"},
+		{CardID: card.ID, Type: WriteOpAOType, Index: 0, Mode: "0-10V"},
+		{CardID: card.ID, Type: WriteOpAOType, Index: 1, Mode: "0-10V"},
+	})
+	for i, result := range results {
+		if result.Status != "ok" {
+			t.Errorf("Result %d: expected ok, got %+v", i, result)
+		}
+	}
+
+	// Channels 0-1 form one run, channel 3 another
+	if len(addresses) != 2 || addresses[0] != 0x0190 || addresses[1] != 0x0193 {
+		t.Errorf("Expected writes at 0x0190 and 0x0193, got %v", addresses)
+	}
+}
+
+func TestManager_DiscoverSlaveRange(t *testing.T) {
+	dev := &addressableDevice{handler: &MockClientHandler{}, addr: 15}
+	mgr := newMockManager(dev.client())
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) { return dev.handler, nil }
+
+	if n := mgr.Discover(DiscoveryOptions{Ports: []string{"/dev/ttyUSB0"}, MinSlaveID: 1, MaxSlaveID: 5}); n != 0 {
+		t.Errorf("Expected no card in 1-5, got %d", n)
+	}
+	if n := mgr.Discover(DiscoveryOptions{Ports: []string{"/dev/ttyUSB0"}, MinSlaveID: 10, MaxSlaveID: 20}); n != 1 {
+		t.Fatalf("Expected 1 card in 10-20, got %d", n)
+	}
+	cards := mgr.GetAllCards()
+	if len(cards) != 1 || cards[0].SlaveID != 15 || cards[0].Module != "IO4040" {
+		t.Errorf("Unexpected cards: %+v", cards)
+	}
+}
+
+func TestManager_DiscoverProbeTimeout(t *testing.T) {
+	configtest.Isolate(t)
+
+	handler := &MockClientHandler{}
+	var probeTimeout time.Duration
+	mgr := newMockManager(&MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			probeTimeout = handler.Timeout()
+			return []byte{0x00}, nil
+		},
+	})
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) {
+		handler.SetTimeout(cfg.Timeout)
+		return handler, nil
+	}
+
+	mgr.Discover(DiscoveryOptions{Ports: []string{"/dev/ttyUSB0"}, MinSlaveID: 1, MaxSlaveID: 1, ProbeTimeout: 20 * time.Millisecond})
+	if probeTimeout != 20*time.Millisecond {
+		t.Errorf("Expected the probe timeout while probing, got %v", probeTimeout)
+	}
+	if handler.Timeout() != mgr.timeout {
+		t.Errorf("Expected the Modbus timeout %v restored after discovery, got %v", mgr.timeout, handler.Timeout())
+	}
+}
+
+func TestManager_WriteTimeout(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+	mgr.timeout = 200 * time.Millisecond
+	mgr.writeTimeout = time.Second
+	var got serialCfg
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) {
+		got = cfg
+		return &MockClientHandler{}, nil
+	}
+
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if got.Timeout != 200*time.Millisecond || got.WriteTimeout != time.Second {
+		t.Errorf("Expected read and write timeouts passed to the handler factory, got %v and %v", got.Timeout, got.WriteTimeout)
+	}
+
+	for _, code := range []byte{modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters} {
+		if !isWriteFunction(code) {
+			t.Errorf("Expected function code %d to be a write", code)
+		}
+	}
+	for _, code := range []byte{modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs, modbus.FuncCodeReadHoldingRegisters} {
+		if isWriteFunction(code) {
+			t.Errorf("Expected function code %d to be a read", code)
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package localio
 
 import (
+	"time"
+
 	"github.com/goburrow/modbus"
 )
 
 // MockClientHandler implements ModbusHandler (modbus.ClientHandler + Connect)
 type MockClientHandler struct {
 	SlaveID byte
+	timeout time.Duration
 }
 
 func (m *MockClientHandler) Connect() error {
@@ -30,3 +33,19 @@ func (m *MockClientHandler) Encode(pdu *modbus.ProtocolDataUnit) (adu []byte, er
 func (m *MockClientHandler) SetSlave(slave byte) {
 	m.SlaveID = slave
 }
+func (m *MockClientHandler) Timeout() time.Duration {
+	return m.timeout
+}
+func (m *MockClientHandler) SetTimeout(d time.Duration) {
+	m.timeout = d
+}
+
+// newMockManager returns a manager whose ports are backed by the given mock client
+func newMockManager(client *MockClient) *Manager {
+	mgr := NewManager()
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) {
+		return &MockClientHandler{timeout: cfg.Timeout}, nil
+	}
+	mgr.clientFactory = func(h modbus.ClientHandler) modbus.Client { return client }
+	return mgr
+}
@@ -1,11 +1,57 @@
 package localio
 
+import "strconv"
+
 type ModelSpec struct {
 	Name string `json:"name"`
 	DI   int    `json:"di"`
 	DO   int    `json:"do"`
 	AI   int    `json:"ai"`
 	AO   int    `json:"ao"`
+	// Disabled are the input channels the poll cycle skips, by channel name ("di0", "ai3"). It is set
+	// per card from the disabled_channels config; drivers may ignore it and read every channel.
+	Disabled map[string]bool `json:"-"`
+}
+
+// Enabled reports whether an input channel is read, e.g. spec.Enabled("ai", 2)
+func (s ModelSpec) Enabled(kind string, index int) bool {
+	return !s.Disabled[kind+strconv.Itoa(index)]
+}
+
+// enabledSpan returns the first and last enabled channel of n input channels (ok = false if none is enabled)
+func (s ModelSpec) enabledSpan(kind string, n int) (first, last int, ok bool) {
+	first, last = -1, -1
+	for i := 0; i < n; i++ {
+		if s.Enabled(kind, i) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	return first, last, first >= 0
+}
+
+// StatusRegister is a documented identity, config or status register range of a card model
+type StatusRegister struct {
+	Name        string `json:"name"`
+	Table       string `json:"table"` // "holding" or "input"
+	Address     int    `json:"address"`
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+}
+
+// StatusRegisters returns the documented identity, config and status registers of the model, for tools
+// that dump a card for diagnostics. The IO registers follow from the channel counts.
+func (s ModelSpec) StatusRegisters() []StatusRegister {
+	regs := []StatusRegister{
+		{Name: "serialNumber", Table: "holding", Address: serialNumberRegAddr, Count: serialNumberRegCount, Description: "Serial number (20 ASCII characters)"},
+		{Name: "baudRate", Table: "holding", Address: baudRateRegAddr, Count: baudRateRegCount, Description: "RS485 baud rate (uint32)"},
+	}
+	if s.AO > 0 {
+		regs = append(regs, StatusRegister{Name: "aoType", Table: "holding", Address: aoTypeRegAddr, Count: s.AO, Description: "AO types (1 = 0-10V, 4 = 4-20mA)"})
+	}
+	return regs
 }
 
 var ModelTable = map[string]ModelSpec{
@@ -16,6 +62,12 @@ var ModelTable = map[string]ModelSpec{
 	"IO0080": {Name: "IO0080", DI: 0, DO: 8, AI: 0, AO: 0},
 }
 
+// ModelForChannels returns the spec of the model with the given channel counts (ok = false if none matches)
+func ModelForChannels(di, doCount, ai, ao int) (ModelSpec, bool) {
+	spec, ok := ModelTable[guessModel(di, doCount, ai, ao)]
+	return spec, ok
+}
+
 // guessModel mirrors read_di.go mapping
 func guessModel(di, doCount, ai, ao int) string {
 	switch {
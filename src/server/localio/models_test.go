@@ -24,3 +24,21 @@ func TestGuessModel(t *testing.T) {
 		}
 	}
 }
+
+func TestModelSpec_StatusRegisters(t *testing.T) {
+	regs := ModelTable["IO0404"].StatusRegisters()
+	if len(regs) != 3 || regs[2].Name != "aoType" || regs[2].Address != aoTypeRegAddr || regs[2].Count != 4 {
+		t.Fatalf("IO0404 status registers = %+v; want serial number, baud rate and 4 AO types", regs)
+	}
+	for _, r := range ModelTable["IO4040"].StatusRegisters() {
+		if r.Name == "aoType" {
+			t.Fatalf("IO4040 has no AO channels but lists %+v", r)
+		}
+	}
+	if spec, ok := ModelForChannels(0, 4, 4, 0); !ok || spec.Name != "IO0440" {
+		t.Fatalf("ModelForChannels(0, 4, 4, 0) = %+v, %v; want IO0440", spec, ok)
+	}
+	if _, ok := ModelForChannels(1, 1, 1, 1); ok {
+		t.Fatal("ModelForChannels(1, 1, 1, 1) matched a model")
+	}
+}
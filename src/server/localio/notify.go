@@ -0,0 +1,349 @@
+package localio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Notification channel types
+const (
+	NotifyWebhook = "webhook"
+	NotifySlack   = "slack"
+	NotifyEmail   = "email"
+)
+
+// defaultSMTPPort is the submission port used when the SMTP server has no port
+const defaultSMTPPort = 587
+
+// notifyClient posts webhook and Slack notifications
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notification is sent to the channels of an escalation step while an alarm waits for acknowledgment
+type Notification struct {
+	DeviceID string    `json:"deviceId"`
+	Alarm    string    `json:"alarm"`
+	Severity string    `json:"severity"`
+	CardID   string    `json:"cardId"`
+	Channel  string    `json:"channel,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Active   bool      `json:"active"`
+	RaisedAt time.Time `json:"raisedAt"`
+	// Step is the escalation step (1 = first); UnackedSec is how long the alarm has waited for acknowledgment
+	Step       int `json:"step"`
+	UnackedSec int `json:"unackedSec"`
+}
+
+// message is a notification or forwarded event as delivered to a channel: payload is posted to webhooks,
+// subject and text are used by Slack and email
+type message struct {
+	subject string
+	text    string
+	payload interface{}
+}
+
+func (n Notification) message() message {
+	return message{subject: fmt.Sprintf("[%s] Alarm %s", strings.ToUpper(n.Severity), n.Alarm), text: n.text(), payload: n}
+}
+
+// eventMessage is the message of an event forwarded to a channel
+func eventMessage(ev Event) message {
+	text := fmt.Sprintf("[%s] %s", strings.ToUpper(ev.Severity), ev.Type)
+	if ev.CardID != "" {
+		text += " on card " + ev.CardID
+	}
+	if len(ev.Data) > 0 {
+		data, _ := json.Marshal(ev.Data)
+		text += ": " + string(data)
+	}
+	return message{subject: fmt.Sprintf("[%s] %s", strings.ToUpper(ev.Severity), ev.Type), text: text, payload: ev}
+}
+
+// text is the human-readable form of a notification (Slack, email)
+func (n Notification) text() string {
+	what := n.Message
+	if what == "" {
+		what = "alarm raised"
+	}
+	where := "card " + n.CardID
+	if n.Channel != "" {
+		where += " " + n.Channel
+	}
+	state := "active"
+	if !n.Active {
+		state = "cleared"
+	}
+	return fmt.Sprintf("[%s] %s: %s (%s, %s), unacknowledged for %s on device %s",
+		strings.ToUpper(n.Severity), n.Alarm, what, where, state, time.Duration(n.UnackedSec)*time.Second, n.DeviceID)
+}
+
+// notificationSender delivers a message to a channel
+type notificationSender func(ch config.NotificationChannel, server config.SMTPServer, msg message) error
+
+// pendingNotification is a notification to deliver to a channel, sent after m.mu is released
+type pendingNotification struct {
+	channel      config.NotificationChannel
+	notification Notification
+}
+
+// sendNotification delivers a message by webhook (the payload as JSON), Slack incoming webhook or email
+func sendNotification(ch config.NotificationChannel, server config.SMTPServer, msg message) error {
+	switch ch.Type {
+	case NotifyWebhook:
+		return postNotification(ch.URL, msg.payload)
+	case NotifySlack:
+		return postNotification(ch.URL, map[string]string{"text": msg.text})
+	case NotifyEmail:
+		return mailNotification(server, ch.To, msg)
+	}
+	return fmt.Errorf("unknown channel type %q", ch.Type)
+}
+
+func postNotification(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func mailNotification(server config.SMTPServer, to []string, msg message) error {
+	port := server.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if server.Username != "" {
+		auth = smtp.PlainAuth("", server.Username, server.Password, server.Host)
+	}
+	mail := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		server.From, strings.Join(to, ", "), msg.subject, msg.text)
+	return smtp.SendMail(server.Host+":"+strconv.Itoa(port), auth, server.From, to, []byte(mail))
+}
+
+// alarmSeverity returns the severity of an alarm rule
+func alarmSeverity(rule config.AlarmRule) string {
+	if rule.Severity == "" {
+		return SeverityWarning
+	}
+	return rule.Severity
+}
+
+// ValidateNotifications checks notification channels and escalation policies
+func ValidateNotifications(n config.Notifications) error {
+	var p configProblems
+	validateNotifications(n, &p)
+	return p.err()
+}
+
+func validateNotifications(n config.Notifications, p *configProblems) {
+	channels := make(map[string]bool)
+	email := false
+	for i, ch := range n.Channels {
+		path := fmt.Sprintf("notifications.channels[%d]", i)
+		if ch.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if channels[ch.Name] {
+			p.add(path+".name", "duplicate name %q", ch.Name)
+		}
+		channels[ch.Name] = true
+		switch ch.Type {
+		case NotifyWebhook, NotifySlack:
+			if !strings.HasPrefix(ch.URL, "http://") && !strings.HasPrefix(ch.URL, "https://") {
+				p.add(path+".url", "an http(s) URL is required")
+			}
+		case NotifyEmail:
+			email = true
+			if len(ch.To) == 0 {
+				p.add(path+".to", "at least one recipient is required")
+			}
+		default:
+			p.add(path+".type", "unknown type %q (use webhook, slack or email)", ch.Type)
+		}
+		if ch.Events != "" && !ValidSeverity(ch.Events) {
+			p.add(path+".events", "unknown severity %q (use info, warning or critical)", ch.Events)
+		}
+	}
+	if email && (n.SMTP.Host == "" || n.SMTP.From == "") {
+		p.add("notifications.smtp", "host and from are required for email channels")
+	}
+
+	severities := make(map[string]bool)
+	for i, policy := range n.Escalations {
+		path := fmt.Sprintf("notifications.escalations[%d]", i)
+		if !ValidSeverity(policy.Severity) {
+			p.add(path+".severity", "unknown severity %q (use info, warning or critical)", policy.Severity)
+		} else if severities[policy.Severity] {
+			p.add(path+".severity", "duplicate policy for %s", policy.Severity)
+		}
+		severities[policy.Severity] = true
+		for k, step := range policy.Steps {
+			stepPath := fmt.Sprintf("%s.steps[%d]", path, k)
+			if step.AfterSec < 0 {
+				p.add(stepPath+".after_sec", "must not be negative")
+			} else if k > 0 && step.AfterSec <= policy.Steps[k-1].AfterSec {
+				p.add(stepPath+".after_sec", "must be after the previous step")
+			}
+			if len(step.Channels) == 0 {
+				p.add(stepPath+".channels", "at least one channel is required")
+			}
+			for _, name := range step.Channels {
+				if !channels[name] {
+					p.add(stepPath+".channels", "unknown channel %q", name)
+				}
+			}
+		}
+	}
+}
+
+// GetNotifications returns the notification channels and escalation policies. The channel URLs are left
+// out: webhook and Slack URLs carry the token of their endpoint.
+func (m *Manager) GetNotifications() config.Notifications {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.notifications
+	n.Channels = slices.Clone(n.Channels)
+	for i := range n.Channels {
+		n.Channels[i].URL = ""
+	}
+	return n
+}
+
+// SetNotifications validates, activates, and persists notification channels and escalation policies.
+// The SMTP password is not part of the API: it is kept as long as the SMTP host and username are, and
+// dropped when either changes, so the stored password can't be sent to another server. Likewise a channel
+// without URL keeps the URL of the channel of the same name and type.
+func (m *Manager) SetNotifications(n config.Notifications) error {
+	return m.SetNotificationsContext(context.Background(), n)
+}
+
+// SetNotificationsContext is SetNotifications with the change attributed in the config history to the
+// change of ctx (see config.WithChange)
+func (m *Manager) SetNotificationsContext(ctx context.Context, n config.Notifications) error {
+	m.mu.Lock()
+	prev := m.notifications
+	if n.SMTP.Password == "" && n.SMTP.Host == prev.SMTP.Host && n.SMTP.Username == prev.SMTP.Username {
+		n.SMTP.Password = prev.SMTP.Password
+	}
+	n.Channels = slices.Clone(n.Channels)
+	for i, ch := range n.Channels {
+		if ch.URL != "" {
+			continue
+		}
+		for _, old := range prev.Channels {
+			if old.Name == ch.Name && old.Type == ch.Type {
+				n.Channels[i].URL = old.URL
+			}
+		}
+	}
+	if err := ValidateNotifications(n); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.notifications = n
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Notifications = n
+	})
+}
+
+// escalationsDueLocked advances the escalation of alarms waiting for acknowledgment and returns the
+// notifications of the steps that became due. Shelved alarms are not escalated. The caller must hold m.mu.
+func (m *Manager) escalationsDueLocked(now time.Time) []pendingNotification {
+	var due []pendingNotification
+	for _, a := range m.alarms {
+		if a.alarm.Acked || a.alarm.Shelved {
+			continue
+		}
+		policy, ok := m.escalationPolicyLocked(a.alarm.Severity)
+		if !ok {
+			continue
+		}
+		unacked := now.Sub(a.alarm.RaisedAt)
+		for a.escalated < len(policy.Steps) && unacked >= time.Duration(policy.Steps[a.escalated].AfterSec)*time.Second {
+			step := policy.Steps[a.escalated]
+			a.escalated++
+			n := Notification{
+				DeviceID:   config.GetDeviceID(),
+				Alarm:      a.alarm.Name,
+				Severity:   a.alarm.Severity,
+				CardID:     a.alarm.CardID,
+				Channel:    a.alarm.Channel,
+				Message:    a.alarm.Message,
+				Active:     a.alarm.Active,
+				RaisedAt:   a.alarm.RaisedAt,
+				Step:       a.escalated,
+				UnackedSec: int(unacked / time.Second),
+			}
+			for _, name := range step.Channels {
+				for _, ch := range m.notifications.Channels {
+					if ch.Name == name {
+						due = append(due, pendingNotification{channel: ch, notification: n})
+					}
+				}
+			}
+		}
+	}
+	return due
+}
+
+func (m *Manager) escalationPolicyLocked(severity string) (config.EscalationPolicy, bool) {
+	for _, policy := range m.notifications.Escalations {
+		if policy.Severity == severity {
+			return policy, true
+		}
+	}
+	return config.EscalationPolicy{}, false
+}
+
+// deliverNotifications sends notifications in the background so slow endpoints and retries don't hold up
+// the cycle
+func (m *Manager) deliverNotifications(due []pendingNotification) {
+	for _, pn := range due {
+		go func(pn pendingNotification) {
+			log.Printf("alarm %s: escalation step %d, notifying %s", pn.notification.Alarm, pn.notification.Step, pn.channel.Name)
+			if d := m.deliver(pn.channel, pn.notification.message(), DeliveryAlarm, notifyRetryDelays); d.Status == DeliveryFailed {
+				log.Printf("alarm %s: notification to %s failed after %d retries: %s", pn.notification.Alarm, pn.channel.Name, d.Retries, d.Error)
+			}
+		}(pn)
+	}
+}
+
+// forwardEvent is the event listener sending events to the channels subscribed to their severity
+func (m *Manager) forwardEvent(ev Event) {
+	m.mu.Lock()
+	var channels []config.NotificationChannel
+	for _, ch := range m.notifications.Channels {
+		if ch.Events != "" && SeverityAtLeast(ev.Severity, ch.Events) {
+			channels = append(channels, ch)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ch := range channels {
+		go func(ch config.NotificationChannel) {
+			if d := m.deliver(ch, eventMessage(ev), DeliveryEvent, notifyRetryDelays); d.Status == DeliveryFailed {
+				log.Printf("%s event: notification to %s failed after %d retries: %s", ev.Type, ch.Name, d.Retries, d.Error)
+			}
+		}(ch)
+	}
+}
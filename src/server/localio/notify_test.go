@@ -0,0 +1,189 @@
+package localio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestAlarmEscalation(t *testing.T) {
+	configtest.Isolate(t)
+
+	di := byte(0x00)
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			return []byte{di}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	sent := make(chan string, 10)
+	mgr.notify = func(ch config.NotificationChannel, server config.SMTPServer, msg message) error {
+		if _, ok := msg.payload.(Notification); ok {
+			sent <- ch.Name
+		}
+		return nil
+	}
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	n := config.Notifications{
+		Channels: []config.NotificationChannel{
+			{Name: "ops-mail", Type: NotifyEmail, To: []string{"ops@example.com"}},
+			{Name: "hook", Type: NotifyWebhook, URL: "http://example.com/hook"},
+			{Name: "chat", Type: NotifySlack, URL: "https://hooks.example.com/T000"},
+		},
+		SMTP: config.SMTPServer{Host: "mail.example.com", From: "device@example.com"},
+		Escalations: []config.EscalationPolicy{{Severity: SeverityCritical, Steps: []config.EscalationStep{
+			{AfterSec: 60, Channels: []string{"ops-mail"}},
+			{AfterSec: 300, Channels: []string{"hook", "chat"}},
+		}}},
+	}
+	n.Escalations[0].Steps[1].AfterSec = 30
+	if err := mgr.SetNotifications(n); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for steps out of order, got %v", err)
+	}
+	n.Escalations[0].Steps[1].AfterSec = 300
+	if err := mgr.SetNotifications(n); err != nil {
+		t.Fatalf("SetNotifications failed: %v", err)
+	}
+	rule := config.AlarmRule{Name: "door", Card: card.ID, Channel: "di0", State: true, Severity: SeverityCritical}
+	if err := mgr.SetAlarmRules([]config.AlarmRule{rule}); err != nil {
+		t.Fatalf("SetAlarmRules failed: %v", err)
+	}
+
+	// raisedAgo moves the raise time of the alarm back to simulate the time waiting for acknowledgment
+	raisedAgo := func(d time.Duration) {
+		mgr.mu.Lock()
+		mgr.alarms["door"].alarm.RaisedAt = time.Now().Add(-d)
+		mgr.mu.Unlock()
+	}
+	expectSent := func(want ...string) {
+		t.Helper()
+		var got []string
+		for range want {
+			select {
+			case name := <-sent:
+				got = append(got, name)
+			case <-time.After(time.Second):
+			}
+		}
+		select {
+		case name := <-sent:
+			got = append(got, name)
+		case <-time.After(20 * time.Millisecond):
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected notifications to %v, got %v", want, got)
+		}
+	}
+
+	di = 0x01
+	mgr.ReadAllAndProcessWrites()
+	expectSent()
+	raisedAgo(61 * time.Second)
+	mgr.ReadAllAndProcessWrites()
+	expectSent("ops-mail")
+	mgr.ReadAllAndProcessWrites()
+	expectSent()
+	raisedAgo(301 * time.Second)
+	mgr.ReadAllAndProcessWrites()
+	expectSent("hook", "chat")
+
+	// Acknowledged alarms are not escalated further; a new activation starts over
+	if err := mgr.AcknowledgeAlarm("door", "alice", ""); err != nil {
+		t.Fatalf("AcknowledgeAlarm failed: %v", err)
+	}
+	di = 0x00
+	mgr.ReadAllAndProcessWrites()
+	di = 0x01
+	mgr.ReadAllAndProcessWrites()
+	raisedAgo(61 * time.Second)
+	mgr.ReadAllAndProcessWrites()
+	expectSent("ops-mail")
+
+	// The SMTP password is not part of the API and is kept when the notifications are replaced
+	mgr.mu.Lock()
+	mgr.notifications.SMTP.Password = "secret"
+	mgr.mu.Unlock()
+	if err := mgr.SetNotifications(n); err != nil {
+		t.Fatalf("SetNotifications failed: %v", err)
+	}
+	if got := mgr.GetNotifications(); got.SMTP.Password != "secret" {
+		t.Error("Expected the SMTP password to be kept")
+	}
+
+	// It is dropped when the host or username changes, so it can't be sent to another server
+	for _, change := range []func(*config.Notifications){
+		func(n *config.Notifications) { n.SMTP.Host = "smtp.attacker.example" },
+		func(n *config.Notifications) { n.SMTP.Username = "someone-else" },
+	} {
+		mgr.mu.Lock()
+		mgr.notifications.SMTP.Password = "secret"
+		changed := mgr.notifications
+		mgr.mu.Unlock()
+		changed.SMTP.Password = ""
+		change(&changed)
+		if err := mgr.SetNotifications(changed); err != nil {
+			t.Fatalf("SetNotifications failed: %v", err)
+		}
+		if got := mgr.GetNotifications(); got.SMTP.Password != "" {
+			t.Errorf("Expected the SMTP password dropped for %+v", got.SMTP)
+		}
+	}
+
+	// Channel URLs carry the webhook tokens: they are not returned, and kept when replaced without one
+	got := mgr.GetNotifications()
+	for _, ch := range got.Channels {
+		if ch.URL != "" {
+			t.Errorf("Expected the URL of %s hidden, got %q", ch.Name, ch.URL)
+		}
+	}
+	got.Channels[2].Type = NotifyWebhook
+	if err := mgr.SetNotifications(got); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a channel changing type without URL, got %v", err)
+	}
+	got.Channels[2].Type = NotifySlack
+	if err := mgr.SetNotifications(got); err != nil {
+		t.Fatalf("SetNotifications failed: %v", err)
+	}
+	mgr.mu.Lock()
+	hook, chat := mgr.notifications.Channels[1].URL, mgr.notifications.Channels[2].URL
+	mgr.mu.Unlock()
+	if hook != "http://example.com/hook" || chat != "https://hooks.example.com/T000" {
+		t.Errorf("Expected the channel URLs kept, got %q %q", hook, chat)
+	}
+}
+
+func TestSendNotification(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	n := Notification{Alarm: "tank-high", Severity: SeverityCritical, CardID: "2", Channel: "ai0", Message: "Tank level high", Active: true, Step: 1, UnackedSec: 60}
+	if err := sendNotification(config.NotificationChannel{Type: NotifyWebhook, URL: srv.URL}, config.SMTPServer{}, n.message()); err != nil {
+		t.Fatalf("webhook failed: %v", err)
+	}
+	if body["alarm"] != "tank-high" || body["severity"] != SeverityCritical || body["step"] != 1.0 {
+		t.Errorf("Unexpected webhook body %v", body)
+	}
+	if err := sendNotification(config.NotificationChannel{Type: NotifySlack, URL: srv.URL}, config.SMTPServer{}, n.message()); err != nil {
+		t.Fatalf("slack failed: %v", err)
+	}
+	if text, _ := body["text"].(string); !strings.HasPrefix(text, "[CRITICAL] tank-high: Tank level high (card 2 ai0, active)") {
+		t.Errorf("Unexpected Slack text %q", text)
+	}
+}
@@ -0,0 +1,36 @@
+package localio
+
+// offlineThreshold is the number of consecutive failed reads after which a card is reported offline, so
+// a single lost response doesn't count as an outage
+const offlineThreshold = 3
+
+// trackOnline emits a card-offline event when a card's reads keep failing and a card-online event when it
+// answers again. Cards being replaced aren't reported offline.
+func (m *Manager) trackOnline(c *Card, readErr error) {
+	m.mu.Lock()
+	var event string
+	switch {
+	case readErr != nil && !c.offline && c.readFailures >= offlineThreshold && c.Replacing == nil:
+		c.offline = true
+		event = EventCardOffline
+	case readErr == nil && c.offline:
+		c.offline = false
+		event = EventCardOnline
+	}
+	m.mu.Unlock()
+
+	switch event {
+	case EventCardOffline:
+		m.emitEvent(EventCardOffline, c.ID, map[string]interface{}{"error": readErr.Error()})
+	case EventCardOnline:
+		m.emitEvent(EventCardOnline, c.ID, nil)
+	}
+}
+
+// Offline reports whether a card is offline: its last offlineThreshold reads failed
+func (m *Manager) Offline(cardID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.cards[cardID]
+	return ok && c.offline
+}
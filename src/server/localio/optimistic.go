@@ -0,0 +1,110 @@
+package localio
+
+import "sort"
+
+// PendingChannels lists the output channels of a card state showing a queued value
+type PendingChannels struct {
+	DO []int `json:"do,omitempty"`
+	AO []int `json:"ao,omitempty"`
+}
+
+// optimisticValue is a queued output value shown in the card state until a read after the write
+type optimisticValue struct {
+	op       writeOperation
+	executed bool // The write was performed; the next read shows the real value
+}
+
+// setOptimisticLocked shows the value of a queued DO/AO write in the card state if optimistic writes are
+// enabled; the caller must hold m.mu
+func (m *Manager) setOptimisticLocked(op writeOperation) {
+	if !m.optimisticWrites || (op.Type != writeOpDO && op.Type != writeOpAO) {
+		return
+	}
+	c, ok := m.cards[op.CardID]
+	if !ok {
+		return
+	}
+	if c.optimistic == nil {
+		c.optimistic = make(map[string]*optimisticValue)
+	}
+	c.optimistic[ChannelKey(op.Type, op.Index)] = &optimisticValue{op: op}
+	applyOptimisticLocked(c)
+}
+
+// dropOptimisticLocked stops showing the value of a cancelled write; the caller must hold m.mu
+func (m *Manager) dropOptimisticLocked(op writeOperation) {
+	c, ok := m.cards[op.CardID]
+	if !ok {
+		return
+	}
+	key := ChannelKey(op.Type, op.Index)
+	if v, ok := c.optimistic[key]; ok && v.op.queueID == op.queueID {
+		delete(c.optimistic, key)
+	}
+}
+
+// hasOptimistic reports whether the channel written by op shows an unconfirmed value
+func (m *Manager) hasOptimistic(c *Card, op writeOperation) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := c.optimistic[ChannelKey(op.Type, op.Index)]
+	return ok
+}
+
+// confirmOptimistic marks the shown values of executed writes, so the next read replaces them
+func (m *Manager) confirmOptimistic(ops []writeOperation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range ops {
+		c, ok := m.cards[op.CardID]
+		if !ok {
+			continue
+		}
+		if v, ok := c.optimistic[ChannelKey(op.Type, op.Index)]; ok && v.op.queueID == op.queueID {
+			v.executed = true
+		}
+	}
+}
+
+// applyOptimistic is called after each read of a card: values of writes performed before the read are
+// dropped (the read shows the real value), the others are shown again
+func (m *Manager) applyOptimistic(c *Card) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, v := range c.optimistic {
+		if v.executed {
+			delete(c.optimistic, key)
+		}
+	}
+	applyOptimisticLocked(c)
+}
+
+func applyOptimisticLocked(c *Card) {
+	if len(c.optimistic) == 0 {
+		c.Last.Pending = nil
+		return
+	}
+
+	// Copy before overwriting: the slices may be shared with previously published states
+	state := &c.Last
+	state.DO = append([]bool(nil), state.DO...)
+	state.AO = append([]float32(nil), state.AO...)
+	pending := &PendingChannels{}
+	for _, v := range c.optimistic {
+		switch v.op.Type {
+		case writeOpDO:
+			if v.op.Index < len(state.DO) {
+				state.DO[v.op.Index] = v.op.Value != 0
+				pending.DO = append(pending.DO, v.op.Index)
+			}
+		case writeOpAO:
+			if v.op.Index < len(state.AO) {
+				state.AO[v.op.Index] = v.op.Value
+				pending.AO = append(pending.AO, v.op.Index)
+			}
+		}
+	}
+	sort.Ints(pending.DO)
+	sort.Ints(pending.AO)
+	state.Pending = pending
+}
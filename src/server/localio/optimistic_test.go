@@ -0,0 +1,58 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestOptimisticWrites(t *testing.T) {
+	configtest.Isolate(t)
+
+	coils := byte(0x00)
+	client := &MockClient{
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{coils}, nil },
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			coils |= value[0] << address
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.optimisticWrites = true
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	// The queued value shows immediately, marked pending
+	if err := mgr.QueueWriteDO(card.ID, 1, true); err != nil {
+		t.Fatalf("QueueWriteDO failed: %v", err)
+	}
+	if !card.Last.DO[1] || card.Last.Pending == nil || len(card.Last.Pending.DO) != 1 || card.Last.Pending.DO[0] != 1 {
+		t.Fatalf("Expected DO1 on and pending, got %v %+v", card.Last.DO, card.Last.Pending)
+	}
+
+	// The cycle reads the card before writing: the value is still shown
+	mgr.ReadAllAndProcessWrites()
+	if !card.Last.DO[1] || card.Last.Pending == nil {
+		t.Errorf("Expected DO1 still pending after the write, got %v %+v", card.Last.DO, card.Last.Pending)
+	}
+
+	// The next read confirms it
+	mgr.ReadAllAndProcessWrites()
+	if !card.Last.DO[1] || card.Last.Pending != nil {
+		t.Errorf("Expected DO1 confirmed by the read, got %v %+v", card.Last.DO, card.Last.Pending)
+	}
+
+	// A cancelled write is no longer shown after the next read
+	if err := mgr.QueueWriteDO(card.ID, 2, true); err != nil {
+		t.Fatalf("QueueWriteDO failed: %v", err)
+	}
+	if err := mgr.CancelPendingWrite(mgr.GetPendingWrites()[0].ID); err != nil {
+		t.Fatalf("CancelPendingWrite failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.DO[2] || card.Last.Pending != nil {
+		t.Errorf("Expected DO2 off after cancelling, got %v %+v", card.Last.DO, card.Last.Pending)
+	}
+}
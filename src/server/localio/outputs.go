@@ -0,0 +1,188 @@
+package localio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// outputsFile is the file in the data directory the output values are persisted to for the restore
+// startup policy
+const outputsFile = "outputs.json"
+
+// persistedOutputs are the output values of a card as last read by the cycle
+type persistedOutputs struct {
+	DO []bool    `json:"do,omitempty"`
+	AO []float32 `json:"ao,omitempty"`
+}
+
+// outputStore keeps the output values of each card while the restore startup policy is configured
+type outputStore struct {
+	enabled bool
+	values  map[string]persistedOutputs // Output values by card key (see relayKey)
+	dirty   bool                        // values changed since the last save
+}
+
+func outputsPath() string {
+	return filepath.Join(config.DataDir(), outputsFile)
+}
+
+// loadOutputs reads the persisted output values if enabled (empty if there are none)
+func loadOutputs(enabled bool) outputStore {
+	o := outputStore{enabled: enabled, values: make(map[string]persistedOutputs)}
+	if !enabled {
+		return o
+	}
+	data, err := os.ReadFile(outputsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("output values not loaded: %v", err)
+		}
+		return o
+	}
+	if err := json.Unmarshal(data, &o.values); err != nil {
+		log.Printf("output values not loaded: %v", err)
+		o.values = make(map[string]persistedOutputs)
+	}
+	return o
+}
+
+// recordOutputs keeps the output values of a card's read; changed values are saved right away, as a
+// restore from older values could energize an output that was switched off since
+func (m *Manager) recordOutputs(c *Card, state CardState) {
+	m.mu.Lock()
+	if !m.outputs.enabled {
+		m.mu.Unlock()
+		return
+	}
+	key := relayKey(c)
+	prev := m.outputs.values[key]
+	if !slices.Equal(prev.DO, state.DO) || !slices.Equal(prev.AO, state.AO) {
+		m.outputs.values[key] = persistedOutputs{DO: slices.Clone(state.DO), AO: slices.Clone(state.AO)}
+		m.outputs.dirty = true
+	}
+	save := m.outputs.dirty
+	m.mu.Unlock()
+
+	if save {
+		m.saveOutputs()
+	}
+}
+
+// saveOutputs persists the output values if they changed. Saves are serialized, so an older snapshot
+// never replaces a newer one, and synced to disk before the rename, so a power loss leaves either file.
+func (m *Manager) saveOutputs() {
+	m.outputsSaveMu.Lock()
+	defer m.outputsSaveMu.Unlock()
+	m.mu.Lock()
+	if !m.outputs.dirty {
+		m.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(m.outputs.values)
+	m.outputs.dirty = false
+	m.mu.Unlock()
+
+	if err == nil {
+		err = writeFileSynced(outputsPath(), data)
+	}
+	if err != nil {
+		log.Printf("output values not saved: %v", err)
+	}
+}
+
+// writeFileSynced replaces path by data through a synced temporary file and syncs the directory of the
+// rename
+func writeFileSynced(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// applyStartupPolicy applies the startup output policy to the discovered cards before the cycle starts
+func (m *Manager) applyStartupPolicy(policy string) {
+	switch policy {
+	case config.StartupOutputsSafeState:
+		log.Printf("startup output policy: writing all outputs to safe state")
+		if err := m.WriteAllOutputsToSafeState(); err != nil {
+			log.Printf("startup output policy: %v", err)
+		}
+	case config.StartupOutputsRestore:
+		m.restoreOutputs()
+	}
+}
+
+// restoreOutputs writes the persisted output values to the cards. Cards without persisted values, e.g.
+// new cards, are left untouched.
+func (m *Manager) restoreOutputs() {
+	cards := m.GetAllCards()
+	sort.Slice(cards, func(i, j int) bool {
+		idi, _ := strconv.Atoi(cards[i].ID)
+		idj, _ := strconv.Atoi(cards[j].ID)
+		return idi < idj
+	})
+	for _, c := range cards {
+		m.mu.Lock()
+		saved, ok := m.outputs.values[relayKey(c)]
+		m.mu.Unlock()
+		if !ok {
+			log.Printf("startup output policy: card %s has no persisted outputs, left untouched", c.ID)
+			continue
+		}
+		if err := m.restoreCardOutputs(c, saved); err != nil {
+			log.Printf("startup output policy: card %s: %v", c.ID, err)
+			m.logCardError(c.ID, "restore", err)
+			continue
+		}
+		log.Printf("startup output policy: card %s - restored DO %v, AO %v", c.ID, saved.DO, saved.AO)
+	}
+}
+
+// restoreCardOutputs writes the persisted outputs of a card that match its layout
+func (m *Manager) restoreCardOutputs(c *Card, saved persistedOutputs) error {
+	pc, err := m.ensurePort(c.PortPath)
+	if err != nil {
+		return errorf(CodePortUnavailable, "failed to get port: %v", err).with("port", c.PortPath)
+	}
+	spec := cardSpec(c)
+	if spec.DO > 0 && len(saved.DO) == spec.DO {
+		if err := pc.write(cardDriver(c), c.SlaveID, OutputWrite{Type: writeOpDO, DO: saved.DO}); err != nil {
+			return fmt.Errorf("DO write failed: %w", err)
+		}
+	}
+	if spec.AO > 0 && len(saved.AO) == spec.AO {
+		if err := pc.write(cardDriver(c), c.SlaveID, OutputWrite{Type: writeOpAO, AO: saved.AO}); err != nil {
+			return fmt.Errorf("AO write failed: %w", err)
+		}
+	}
+	return nil
+}
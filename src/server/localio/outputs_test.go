@@ -0,0 +1,96 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestStartupPolicy_Restore(t *testing.T) {
+	configtest.Isolate(t)
+	t.Setenv("CM_UTILS_STARTUP_OUTPUT_POLICY", config.StartupOutputsRestore)
+
+	coils := byte(0x05)
+	var written [][]byte
+	client := &MockClient{
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{coils}, nil },
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			written = append(written, value)
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	mgr.StopCycle()
+
+	// Changes are saved right away, so a restart without a clean stop doesn't restore older values
+	coils = 0x04
+	mgr = newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	coils = 0x00
+	crashed := newMockManager(client)
+	if _, err := crashed.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	crashed.applyStartupPolicy(config.StartupOutputsRestore)
+	if len(written) != 1 || written[0][0] != 0x04 {
+		t.Errorf("Expected the last values restored, got writes %v", written)
+	}
+	coils = 0x05
+	written = nil
+	mgr.ReadAllAndProcessWrites()
+	mgr.StopCycle()
+
+	// After a restart the card comes up with its outputs off; the persisted values are written back
+	coils = 0x00
+	restarted := newMockManager(client)
+	if _, err := restarted.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	restarted.applyStartupPolicy(config.StartupOutputsRestore)
+	if len(written) != 1 || written[0][0] != 0x05 {
+		t.Errorf("Expected DO0 and DO2 restored, got writes %v", written)
+	}
+
+	// Cards without persisted outputs are left untouched
+	written = nil
+	if _, err := restarted.AddCard("/dev/ttyUSB0", 2, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	restarted.RemoveCard("1")
+	restarted.applyStartupPolicy(config.StartupOutputsRestore)
+	if len(written) != 0 {
+		t.Errorf("Expected no writes for a card without persisted outputs, got %v", written)
+	}
+}
+
+func TestStartupPolicy_SafeState(t *testing.T) {
+	configtest.Isolate(t)
+
+	writes := 0
+	client := &MockClient{
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			writes++
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.applyStartupPolicy(config.StartupOutputsUntouched)
+	if writes != 0 {
+		t.Fatalf("Expected no writes with the untouched policy, got %d", writes)
+	}
+	mgr.applyStartupPolicy(config.StartupOutputsSafeState)
+	if writes != 1 {
+		t.Errorf("Expected the DOs written to safe state, got %d writes", writes)
+	}
+}
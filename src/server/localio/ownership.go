@@ -0,0 +1,195 @@
+package localio
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Write source kinds
+const (
+	SourceLocal     = "local" // Internal writes without a source
+	SourceHTTP      = "http"
+	SourceScript    = "script"
+	SourceSequence  = "sequence"
+	SourcePID       = "pid"
+	SourceSchedule  = "schedule"
+	SourceTCP       = "tcp"
+	SourceGRPC      = "grpc"
+	SourceMQTT      = "mqtt"
+	SourceNATS      = "nats"
+	SourceCloud     = "cloud"
+	SourceSafeState = "safe-state"
+	SourceHeartbeat = "heartbeat"
+)
+
+// sourcePriority arbitrates control of an output channel: a source can't write a channel last written by
+// a source of higher priority until that source releases it (e.g. the TCP client disconnects, a
+// sequence ends). Sources of equal priority take over from each other. Safe state always writes and
+// doesn't hold the channel afterwards.
+var sourcePriority = map[string]int{
+	SourceLocal:     0,
+	SourceSafeState: 0,
+	SourceHeartbeat: 0,
+	SourceHTTP:      1,
+	SourceGRPC:      1,
+	SourceMQTT:      1,
+	SourceNATS:      1,
+	SourceCloud:     1,
+	SourceScript:    2,
+	SourceSequence:  2,
+	SourcePID:       2,
+	SourceSchedule:  2,
+	SourceTCP:       3,
+}
+
+// WriteSource identifies the origin of an output value
+type WriteSource struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id,omitempty"` // Client address, script/sequence/loop name
+	// Override takes control of a channel regardless of the priority of its owner (manual overrides)
+	Override bool `json:"override,omitempty"`
+}
+
+func (s WriteSource) String() string {
+	if s.ID == "" {
+		return s.Kind
+	}
+	return s.Kind + ":" + s.ID
+}
+
+// ChannelOwner is the source of the current value of an output channel
+type ChannelOwner struct {
+	CardID  string      `json:"cardId"`
+	Channel string      `json:"channel"` // "do0", "ao1", ...
+	Source  WriteSource `json:"source"`
+	Since   time.Time   `json:"since"`
+	// Released is set once the source gave up control; any source can then write the channel
+	Released bool `json:"released,omitempty"`
+}
+
+type sourceKey struct{}
+
+// WithSource returns a context carrying the source of the writes made with it
+func WithSource(ctx context.Context, src WriteSource) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// sourceFrom returns the write source of ctx (SourceLocal if none)
+func sourceFrom(ctx context.Context) WriteSource {
+	if ctx != nil {
+		if src, ok := ctx.Value(sourceKey{}).(WriteSource); ok {
+			return src
+		}
+	}
+	return WriteSource{Kind: SourceLocal}
+}
+
+// ChannelKey is the name of an output channel, e.g. "ao1"; AO types belong to the AO channel
+func ChannelKey(t writeOpType, index int) string {
+	if t == writeOpDO {
+		return "do" + strconv.Itoa(index)
+	}
+	return "ao" + strconv.Itoa(index)
+}
+
+// controlConflictLocked returns the owner preventing src from writing a channel; the caller must hold m.mu.
+// The heartbeat output is only written by the heartbeat and safe state.
+func (m *Manager) controlConflictLocked(cardID string, t writeOpType, index int, src WriteSource) (WriteSource, bool) {
+	if m.isHeartbeatLocked(cardID, t, index) && src.Kind != SourceHeartbeat && src.Kind != SourceSafeState {
+		return WriteSource{Kind: SourceHeartbeat}, true
+	}
+	owner, ok := m.owners[cardID][ChannelKey(t, index)]
+	if !ok || owner.Released || src.Override || owner.Source == src || sourcePriority[src.Kind] >= sourcePriority[owner.Source.Kind] {
+		return WriteSource{}, false
+	}
+	return owner.Source, true
+}
+
+// checkControl returns a CONTROL_LOCKED error if a channel is held by a source of higher priority than src
+func (m *Manager) checkControl(cardID string, t writeOpType, index int, src WriteSource) *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if owner, locked := m.controlConflictLocked(cardID, t, index, src); locked {
+		return errorf(CodeControlLocked, "%s is controlled by %s", ChannelKey(t, index), owner).
+			with("channel", ChannelKey(t, index)).with("owner", owner.String())
+	}
+	return nil
+}
+
+// setOwnerLocked records src as the owner of a channel; the caller must hold m.mu
+func (m *Manager) setOwnerLocked(cardID string, t writeOpType, index int, src WriteSource) {
+	key := ChannelKey(t, index)
+	owners, ok := m.owners[cardID]
+	if !ok {
+		owners = make(map[string]*ChannelOwner)
+		m.owners[cardID] = owners
+	}
+	if owner, ok := owners[key]; ok && owner.Source == src && !owner.Released {
+		return
+	}
+	owners[key] = &ChannelOwner{CardID: cardID, Channel: key, Source: src, Since: time.Now()}
+}
+
+// ReleaseSource gives up the channels held by a source, e.g. when a TCP client disconnects.
+// The channels keep their owner for display but can be written by any source. The AO ramps started by
+// the source stop where they are.
+func (m *Manager) ReleaseSource(src WriteSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, r := range m.ramps {
+		if r.Source == src {
+			delete(m.ramps, key)
+		}
+	}
+	for _, owners := range m.owners {
+		for _, owner := range owners {
+			if owner.Source == src {
+				owner.Released = true
+			}
+		}
+	}
+}
+
+// setSafeStateOwner records safe state as the owner of the first count channels of a type
+func (m *Manager) setSafeStateOwner(cardID string, t writeOpType, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < count; i++ {
+		m.setOwnerLocked(cardID, t, i, WriteSource{Kind: SourceSafeState})
+	}
+}
+
+// recordOwners records the source of every successful write of a batch
+func (m *Manager) recordOwners(ops []writeOperation, results []CommandResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, op := range ops {
+		if i < len(results) && results[i].Status == "ok" {
+			m.setOwnerLocked(op.CardID, op.Type, op.Index, op.source)
+		}
+	}
+}
+
+// GetOwners returns the owner of every written output channel, sorted by card and channel
+func (m *Manager) GetOwners() []ChannelOwner {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]ChannelOwner, 0)
+	for _, owners := range m.owners {
+		for _, owner := range owners {
+			out = append(out, *owner)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CardID != out[j].CardID {
+			idi, _ := strconv.Atoi(out[i].CardID)
+			idj, _ := strconv.Atoi(out[j].CardID)
+			return idi < idj
+		}
+		return out[i].Channel < out[j].Channel
+	})
+	return out
+}
@@ -0,0 +1,60 @@
+package localio
+
+import (
+	"context"
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestOwnership_Arbitration(t *testing.T) {
+	configtest.Isolate(t)
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	tcp := WithSource(context.Background(), WriteSource{Kind: SourceTCP, ID: "10.0.0.5:40000"})
+	http := WithSource(context.Background(), WriteSource{Kind: SourceHTTP, ID: "10.0.0.9"})
+
+	results := mgr.ProcessBatchWriteContext(tcp, []WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	if results[0].Status != "ok" {
+		t.Fatalf("Expected TCP write ok, got %+v", results[0])
+	}
+
+	// The TCP client holds DO0 against the HTTP API, other channels stay writable
+	if err := mgr.QueueWriteDOContext(http, card.ID, 0, false); ErrorCodeOf(err) != CodeControlLocked {
+		t.Errorf("Expected CONTROL_LOCKED writing DO0 over HTTP, got %v", err)
+	}
+	results = mgr.ProcessBatchWriteContext(http, []WriteOperation{
+		{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 0},
+		{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1},
+	})
+	if results[0].Code != CodeControlLocked || results[1].Status != "ok" {
+		t.Errorf("Expected DO0 locked and DO1 ok, got %+v", results)
+	}
+
+	owners := mgr.GetOwners()
+	if len(owners) != 2 || owners[0].Channel != "do0" || owners[0].Source.Kind != SourceTCP || owners[1].Source.Kind != SourceHTTP {
+		t.Errorf("Expected do0 owned by tcp and do1 by http, got %+v", owners)
+	}
+
+	// After the TCP client disconnects, the HTTP API takes over
+	mgr.ReleaseSource(WriteSource{Kind: SourceTCP, ID: "10.0.0.5:40000"})
+	if err := mgr.QueueWriteDOContext(http, card.ID, 0, false); err != nil {
+		t.Errorf("Expected HTTP write after release to succeed, got %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if owners := mgr.GetOwners(); owners[0].Source.Kind != SourceHTTP || owners[0].Released {
+		t.Errorf("Expected do0 owned by http, got %+v", owners[0])
+	}
+
+	// A manual override takes control regardless of the owner
+	mgr.ProcessBatchWriteContext(tcp, []WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}})
+	override := WithSource(context.Background(), WriteSource{Kind: SourceHTTP, ID: "10.0.0.9", Override: true})
+	results = mgr.ProcessBatchWriteContext(override, []WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 0}})
+	if results[0].Status != "ok" {
+		t.Errorf("Expected the override to be accepted, got %+v", results[0])
+	}
+}
@@ -0,0 +1,115 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// ValidateWritePermissions checks write permission entries for missing cards, non-output channels and
+// duplicates
+func ValidateWritePermissions(perms []config.WritePermission) error {
+	var p configProblems
+	validateWritePermissions(perms, &p)
+	return p.err()
+}
+
+func validateWritePermissions(perms []config.WritePermission, p *configProblems) {
+	seen := make(map[config.ControlChannel]bool)
+	for i, perm := range perms {
+		path := fmt.Sprintf("write_permissions[%d]", i)
+		if perm.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if !controlChannelPattern.MatchString(perm.Channel) {
+			p.add(path+".channel", "invalid channel %q (use do<n> or ao<n>, e.g. do0)", perm.Channel)
+		}
+		key := config.ControlChannel{Card: perm.Card, Channel: perm.Channel}
+		if seen[key] {
+			p.add(path, "duplicate entry for card %s %s", perm.Card, perm.Channel)
+		}
+		seen[key] = true
+		for j, writer := range perm.Writers {
+			kind, _, _ := strings.Cut(writer, ":")
+			if _, ok := sourcePriority[kind]; !ok || kind == SourceLocal || kind == SourceSafeState || kind == SourceHeartbeat {
+				p.add(fmt.Sprintf("%s.writers[%d]", path, j), "unknown source %q (e.g. tcp, http:192.168.1.*, script:boiler)", writer)
+			}
+		}
+	}
+}
+
+// GetWritePermissions returns the active write permissions
+func (m *Manager) GetWritePermissions() []config.WritePermission {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	perms := make([]config.WritePermission, len(m.writePermissions))
+	copy(perms, m.writePermissions)
+	return perms
+}
+
+// SetWritePermissions validates, activates, and persists the write permissions
+func (m *Manager) SetWritePermissions(perms []config.WritePermission) error {
+	return m.SetWritePermissionsContext(context.Background(), perms)
+}
+
+// SetWritePermissionsContext is SetWritePermissions with the change attributed in the config history to the
+// change of ctx (see config.WithChange)
+func (m *Manager) SetWritePermissionsContext(ctx context.Context, perms []config.WritePermission) error {
+	if err := ValidateWritePermissions(perms); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.writePermissions = perms
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.WritePermissions = perms
+	})
+}
+
+// checkWritePermission returns a WRITE_FORBIDDEN error if src may not write a channel
+func (m *Manager) checkWritePermission(cardID string, t writeOpType, index int, src WriteSource) *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.writeForbiddenLocked(cardID, t, index, src) {
+		return errorf(CodeWriteForbidden, "%s may not be written by %s", ChannelKey(t, index), src).
+			with("channel", ChannelKey(t, index)).with("source", src.String())
+	}
+	return nil
+}
+
+// writeForbiddenLocked reports whether the write permissions exclude src from writing a channel; the
+// caller must hold m.mu. Internal writes, safe state and the heartbeat are never restricted.
+func (m *Manager) writeForbiddenLocked(cardID string, t writeOpType, index int, src WriteSource) bool {
+	switch src.Kind {
+	case SourceLocal, SourceSafeState, SourceHeartbeat:
+		return false
+	}
+	key := ChannelKey(t, index)
+	for _, perm := range m.writePermissions {
+		if perm.Card != cardID || perm.Channel != key {
+			continue
+		}
+		for _, writer := range perm.Writers {
+			if writerMatches(writer, src) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writerMatches reports whether a writer entry matches a source: a bare kind matches every source of the
+// kind, "kind:id" matches the source's ID with * matching any characters
+func writerMatches(writer string, src WriteSource) bool {
+	if !strings.Contains(writer, ":") {
+		return writer == src.Kind
+	}
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(writer), `\*`, ".*") + "$"
+	ok, _ := regexp.MatchString(pattern, src.Kind+":"+src.ID)
+	return ok
+}
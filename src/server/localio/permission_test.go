@@ -0,0 +1,51 @@
+package localio
+
+import (
+	"context"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestWritePermissions(t *testing.T) {
+	configtest.Isolate(t)
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if err := mgr.SetWritePermissions([]config.WritePermission{
+		{Card: card.ID, Channel: "do0", Writers: []string{"tcp", "http:10.0.0.*"}},
+		{Card: card.ID, Channel: "do1"},
+	}); err != nil {
+		t.Fatalf("SetWritePermissions failed: %v", err)
+	}
+
+	monitor := WithSource(context.Background(), WriteSource{Kind: SourceHTTP, ID: "192.168.1.20", Override: true})
+	operator := WithSource(context.Background(), WriteSource{Kind: SourceHTTP, ID: "10.0.0.9"})
+
+	if err := mgr.QueueWriteDOContext(monitor, card.ID, 0, true); ErrorCodeOf(err) != CodeWriteForbidden {
+		t.Errorf("Expected WRITE_FORBIDDEN for a writer not listed, even with an override, got %v", err)
+	}
+	if err := mgr.QueueWriteDOContext(operator, card.ID, 0, true); err != nil {
+		t.Errorf("Expected the write of a matching writer to be queued, got %v", err)
+	}
+	results := mgr.ProcessBatchWriteContext(operator, []WriteOperation{
+		{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1},
+		{CardID: card.ID, Type: WriteOpDO, Index: 2, Value: 1},
+	})
+	if results[0].Code != CodeWriteForbidden || results[1].Status != "ok" {
+		t.Errorf("Expected the read-only DO1 rejected and DO2 written, got %+v", results)
+	}
+
+	// Safe state is never restricted
+	safe := WithSource(context.Background(), WriteSource{Kind: SourceSafeState})
+	if results := mgr.ProcessBatchWriteContext(safe, []WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 0}}); results[0].Status != "ok" {
+		t.Errorf("Expected the safe state write to be accepted, got %+v", results[0])
+	}
+
+	if err := mgr.SetWritePermissions([]config.WritePermission{{Card: card.ID, Channel: "di0", Writers: []string{"safe-state"}}}); err == nil {
+		t.Error("Expected an error for an input channel and a reserved writer")
+	}
+}
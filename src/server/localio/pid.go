@@ -0,0 +1,276 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// PID loop modes
+const (
+	PIDModeAuto   = "auto"
+	PIDModeManual = "manual"
+)
+
+// PIDLoopStatus is the runtime view of a PID loop returned by the API
+type PIDLoopStatus struct {
+	Name         string    `json:"name"`
+	PVCard       string    `json:"pvCard"`
+	PVIndex      int       `json:"pvIndex"`
+	CVCard       string    `json:"cvCard"`
+	CVIndex      int       `json:"cvIndex"`
+	Kp           float64   `json:"kp"`
+	Ki           float64   `json:"ki"`
+	Kd           float64   `json:"kd"`
+	Setpoint     float64   `json:"setpoint"`
+	OutMin       float64   `json:"outMin"`
+	OutMax       float64   `json:"outMax"`
+	Mode         string    `json:"mode"`
+	ManualOutput float64   `json:"manualOutput"`
+	PV           float64   `json:"pv"`
+	Output       float64   `json:"output"`
+	LastRun      time.Time `json:"lastRun,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// pidLoop holds the configuration and controller state of a single loop
+type pidLoop struct {
+	cfg      config.PIDLoopConfig
+	integral float64
+	lastPV   float64
+	output   float64
+	lastRun  time.Time
+	err      string
+}
+
+// newPIDLoops builds the runtime loops from config, keyed by name
+func newPIDLoops(cfgs []config.PIDLoopConfig) map[string]*pidLoop {
+	loops := make(map[string]*pidLoop, len(cfgs))
+	for _, c := range cfgs {
+		if c.Mode == "" {
+			c.Mode = PIDModeAuto
+		}
+		loops[c.Name] = &pidLoop{cfg: c, output: c.ManualOutput, integral: c.ManualOutput}
+	}
+	return loops
+}
+
+// clamp limits v to [min, max]
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// step runs one controller iteration and returns the new output.
+// Anti-windup: the integral term is frozen while the output is saturated in the direction of the error.
+// The derivative acts on the measurement to avoid a kick on setpoint changes.
+func (l *pidLoop) step(pv float64, now time.Time) float64 {
+	c := l.cfg
+	if c.Mode == PIDModeManual {
+		// Track the manual output so switching back to auto is bumpless
+		l.output = clamp(c.ManualOutput, c.OutMin, c.OutMax)
+		l.integral = l.output
+		l.lastPV = pv
+		l.lastRun = now
+		return l.output
+	}
+
+	dt := 0.0
+	if !l.lastRun.IsZero() {
+		dt = now.Sub(l.lastRun).Seconds()
+	}
+
+	e := c.Setpoint - pv
+	p := c.Kp * e
+	d := 0.0
+	if dt > 0 {
+		d = -c.Kd * (pv - l.lastPV) / dt
+	}
+
+	integral := l.integral + c.Ki*e*dt
+	out := p + integral + d
+	switch {
+	case out > c.OutMax:
+		out = c.OutMax
+		if e < 0 {
+			l.integral = integral
+		}
+	case out < c.OutMin:
+		out = c.OutMin
+		if e > 0 {
+			l.integral = integral
+		}
+	default:
+		l.integral = integral
+	}
+
+	l.output = out
+	l.lastPV = pv
+	l.lastRun = now
+	return out
+}
+
+func (l *pidLoop) status() PIDLoopStatus {
+	c := l.cfg
+	return PIDLoopStatus{
+		Name:         c.Name,
+		PVCard:       c.PVCard,
+		PVIndex:      c.PVIndex,
+		CVCard:       c.CVCard,
+		CVIndex:      c.CVIndex,
+		Kp:           c.Kp,
+		Ki:           c.Ki,
+		Kd:           c.Kd,
+		Setpoint:     c.Setpoint,
+		OutMin:       c.OutMin,
+		OutMax:       c.OutMax,
+		Mode:         c.Mode,
+		ManualOutput: c.ManualOutput,
+		PV:           l.lastPV,
+		Output:       l.output,
+		LastRun:      l.lastRun,
+		Error:        l.err,
+	}
+}
+
+// runPIDLoops executes every loop once using the latest card state and queues the CV writes.
+// Loops whose PV card is in error hold their last output.
+func (m *Manager) runPIDLoops() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.pidLoops) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, l := range m.pidLoops {
+		pvCard, ok := m.cards[l.cfg.PVCard]
+		if !ok {
+			l.err = "pv card not found"
+			continue
+		}
+		cvCard, ok := m.cards[l.cfg.CVCard]
+		if !ok {
+			l.err = "cv card not found"
+			continue
+		}
+		if l.cfg.CVIndex < 0 || l.cfg.CVIndex >= cardSpec(cvCard).AO {
+			l.err = "cv index out of range"
+			continue
+		}
+		if pvCard.Last.Error != "" || l.cfg.PVIndex < 0 || l.cfg.PVIndex >= len(pvCard.Last.AI) {
+			l.err = "pv unavailable"
+			continue
+		}
+		if m.sensorFaultLocked(pvCard.ID, l.cfg.PVIndex) {
+			l.err = "pv sensor fault"
+			continue
+		}
+		src := WriteSource{Kind: SourcePID, ID: l.cfg.Name}
+		if m.writeForbiddenLocked(l.cfg.CVCard, writeOpAO, l.cfg.CVIndex, src) {
+			l.err = "cv not writable (write_permissions)"
+			continue
+		}
+		if owner, locked := m.controlConflictLocked(l.cfg.CVCard, writeOpAO, l.cfg.CVIndex, src); locked {
+			l.err = fmt.Sprintf("cv controlled by %s", owner)
+			continue
+		}
+		l.err = ""
+
+		out := l.step(float64(pvCard.Last.AI[l.cfg.PVIndex]), now)
+		if err := m.enqueueLocked(nil, writeOperation{
+			CardID: l.cfg.CVCard,
+			Type:   writeOpAO,
+			Index:  l.cfg.CVIndex,
+			Value:  float32(out),
+			source: src,
+		}); err != nil {
+			l.err = err.Message
+		}
+	}
+}
+
+// GetPIDLoops returns the status of all PID loops sorted by name
+func (m *Manager) GetPIDLoops() []PIDLoopStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]PIDLoopStatus, 0, len(m.pidLoops))
+	for _, l := range m.pidLoops {
+		out = append(out, l.status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetPIDSetpoint changes the setpoint of a loop and persists it
+func (m *Manager) SetPIDSetpoint(name string, setpoint float64) error {
+	return m.SetPIDSetpointContext(context.Background(), name, setpoint)
+}
+
+// SetPIDSetpointContext is SetPIDSetpoint with the change attributed in the config history to the change of
+// ctx (see config.WithChange)
+func (m *Manager) SetPIDSetpointContext(ctx context.Context, name string, setpoint float64) error {
+	return m.updatePIDLoop(ctx, name, func(c *config.PIDLoopConfig) error {
+		c.Setpoint = setpoint
+		return nil
+	})
+}
+
+// SetPIDMode switches a loop between auto and manual; output is the manual output (ignored in auto)
+func (m *Manager) SetPIDMode(name string, mode string, output float64) error {
+	return m.SetPIDModeContext(context.Background(), name, mode, output)
+}
+
+// SetPIDModeContext is SetPIDMode with the change attributed in the config history to the change of ctx
+// (see config.WithChange)
+func (m *Manager) SetPIDModeContext(ctx context.Context, name string, mode string, output float64) error {
+	return m.updatePIDLoop(ctx, name, func(c *config.PIDLoopConfig) error {
+		switch mode {
+		case PIDModeAuto:
+		case PIDModeManual:
+			c.ManualOutput = output
+		default:
+			return errorf(CodeInvalidRequest, "invalid mode %q", mode)
+		}
+		c.Mode = mode
+		return nil
+	})
+}
+
+// updatePIDLoop applies fn to a loop's configuration and persists the change
+func (m *Manager) updatePIDLoop(ctx context.Context, name string, fn func(c *config.PIDLoopConfig) error) error {
+	m.mu.Lock()
+	l, ok := m.pidLoops[name]
+	if !ok {
+		m.mu.Unlock()
+		return errorf(CodeNotFound, "pid loop not found")
+	}
+	updated := l.cfg
+	if err := fn(&updated); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	l.cfg = updated
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		loops := make([]config.PIDLoopConfig, len(c.PIDLoops))
+		copy(loops, c.PIDLoops)
+		for i := range loops {
+			if loops[i].Name == name {
+				loops[i] = updated
+			}
+		}
+		c.PIDLoops = loops
+	})
+}
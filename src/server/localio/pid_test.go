@@ -0,0 +1,61 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+func TestPIDLoop_Step(t *testing.T) {
+	l := newPIDLoops([]config.PIDLoopConfig{{
+		Name: "loop", Kp: 1, Ki: 1, Setpoint: 10, OutMin: 0, OutMax: 100,
+	}})["loop"]
+
+	start := time.Now()
+	if out := l.step(0, start); out != 10 {
+		t.Errorf("First step: expected proportional output 10, got %v", out)
+	}
+	if out := l.step(0, start.Add(time.Second)); out != 20 {
+		t.Errorf("Second step: expected 20 (P=10 + I=10), got %v", out)
+	}
+}
+
+func TestPIDLoop_AntiWindup(t *testing.T) {
+	l := newPIDLoops([]config.PIDLoopConfig{{
+		Name: "loop", Kp: 1, Ki: 10, Setpoint: 100, OutMin: 0, OutMax: 50,
+	}})["loop"]
+
+	now := time.Now()
+	l.step(0, now)
+	for i := 1; i <= 10; i++ {
+		if out := l.step(0, now.Add(time.Duration(i)*time.Second)); out != 50 {
+			t.Fatalf("Expected saturated output 50, got %v", out)
+		}
+	}
+	if l.integral != 0 {
+		t.Errorf("Expected integral to stay frozen while saturated, got %v", l.integral)
+	}
+
+	// Once PV passes the setpoint the output must leave saturation immediately
+	if out := l.step(120, now.Add(11*time.Second)); out != 0 {
+		t.Errorf("Expected output to drop to 0 after overshoot, got %v", out)
+	}
+}
+
+func TestPIDLoop_ManualBumpless(t *testing.T) {
+	l := newPIDLoops([]config.PIDLoopConfig{{
+		Name: "loop", Kp: 0, Ki: 1, Setpoint: 10, OutMin: 0, OutMax: 100,
+		Mode: PIDModeManual, ManualOutput: 42,
+	}})["loop"]
+
+	now := time.Now()
+	if out := l.step(10, now); out != 42 {
+		t.Errorf("Expected manual output 42, got %v", out)
+	}
+
+	l.cfg.Mode = PIDModeAuto
+	if out := l.step(10, now.Add(time.Second)); out != 42 {
+		t.Errorf("Expected bumpless transfer to hold 42, got %v", out)
+	}
+}
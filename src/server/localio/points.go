@@ -0,0 +1,292 @@
+package localio
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// pointColumns are the columns of a point schedule CSV; serial, channel and name are required
+var pointColumns = []string{"serial", "channel", "name", "unit", "scaling", "safe_state", "label"}
+
+// PointValue is a point with the card it is on and the current value of its channel
+type PointValue struct {
+	config.Point
+	// CardID is the card with the point's serial number ("" = no such card found)
+	CardID string      `json:"cardId"`
+	Value  interface{} `json:"value"`
+	// Scaled is the value scaled to engineering units, for analog points with scaling
+	Scaled *float64 `json:"scaled,omitempty"`
+	// Fault is the sensor fault of a current loop input (under-range or over-range); Scaled is omitted
+	Fault string `json:"fault,omitempty"`
+}
+
+// ValidatePoints checks points for missing fields, invalid channels, scaling and safe states, and duplicates
+func ValidatePoints(points []config.Point) error {
+	var p configProblems
+	validatePoints(points, &p)
+	return p.err()
+}
+
+func validatePoints(points []config.Point, p *configProblems) {
+	validatePointList(points, func(i int) string { return fmt.Sprintf("points[%d]", i) }, p)
+}
+
+// validatePointList checks points with the problems reported at path(i), e.g. the CSV line of an import
+func validatePointList(points []config.Point, path func(i int) string, p *configProblems) {
+	seen := make(map[[2]string]bool)
+	names := make(map[string]bool)
+	for i, pt := range points {
+		if pt.Serial == "" {
+			p.add(path(i)+".serial", "card serial number is required")
+		}
+		match := commissioningChannelPattern.FindStringSubmatch(pt.Channel)
+		if match == nil {
+			p.add(path(i)+".channel", "invalid channel %q (use di<n>, do<n>, ai<n> or ao<n>, e.g. ai0)", pt.Channel)
+		}
+		if pt.Name == "" {
+			p.add(path(i)+".name", "name is required")
+		} else if names[pt.Name] {
+			p.add(path(i)+".name", "duplicate name %q", pt.Name)
+		}
+		names[pt.Name] = true
+		key := [2]string{pt.Serial, pt.Channel}
+		if seen[key] {
+			p.add(path(i), "duplicate entry for card %s %s", pt.Serial, pt.Channel)
+		}
+		seen[key] = true
+		if match == nil {
+			continue
+		}
+
+		kind := match[1]
+		if pt.RawMin != 0 || pt.RawMax != 0 || pt.EngMin != 0 || pt.EngMax != 0 {
+			if kind != "ai" && kind != "ao" {
+				p.add(path(i)+".scaling", "only analog channels can be scaled")
+			} else if pt.RawMin == pt.RawMax {
+				p.add(path(i)+".scaling", "raw range must not be empty")
+			}
+		}
+		if pt.SafeState == "" {
+			continue
+		}
+		switch kind {
+		case "do":
+			if pt.SafeState != "on" && pt.SafeState != "off" {
+				p.add(path(i)+".safe_state", "must be on or off")
+			}
+		case "ao":
+			if v, err := strconv.ParseFloat(pt.SafeState, 32); err != nil || v < 0 || v > 20 {
+				p.add(path(i)+".safe_state", "must be a value in V (0-10) or mA (4-20)")
+			}
+		default:
+			p.add(path(i)+".safe_state", "only outputs have a safe state")
+		}
+	}
+}
+
+// GetPoints returns the points with their cards and current values
+func (m *Manager) GetPoints() []PointValue {
+	cards := m.GetAllCards()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]PointValue, 0, len(m.points))
+	for _, pt := range m.points {
+		pv := PointValue{Point: pt}
+		for _, c := range cards {
+			if c.Last.SerialNumber != pt.Serial {
+				continue
+			}
+			pv.CardID = c.ID
+			if match := commissioningChannelPattern.FindStringSubmatch(pt.Channel); match != nil {
+				index, _ := strconv.Atoi(match[2])
+				pv.Value = channelValue(c.Last, match[1], index)
+				if match[1] == "ai" {
+					pv.Fault = m.sensorFaults[c.ID][index]
+				}
+				if v, ok := pv.Value.(float32); ok && pt.RawMax != pt.RawMin && pv.Fault == "" {
+					scaled := pt.EngMin + (float64(v)-pt.RawMin)*(pt.EngMax-pt.EngMin)/(pt.RawMax-pt.RawMin)
+					pv.Scaled = &scaled
+				}
+			}
+			break
+		}
+		out = append(out, pv)
+	}
+	return out
+}
+
+// SetPoints validates, activates, and persists the points
+func (m *Manager) SetPoints(points []config.Point) error {
+	return m.SetPointsContext(context.Background(), points)
+}
+
+// SetPointsContext is SetPoints with the change attributed in the config history to the change of ctx (see
+// config.WithChange)
+func (m *Manager) SetPointsContext(ctx context.Context, points []config.Point) error {
+	if err := ValidatePoints(points); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.points = points
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Points = points
+	})
+}
+
+// ImportPointsCSV loads a point schedule from CSV with a header row naming the columns (serial, channel,
+// name, unit, scaling, safe_state; any order, unit and the last two optional). Scaling is written
+// "4..20=0..10" (raw range = engineering range). The schedule replaces all points, or with merge only the
+// points of the same card and channel. Nothing is imported if any row is invalid. Returns the rows imported.
+func (m *Manager) ImportPointsCSV(r io.Reader, merge bool) (int, error) {
+	return m.ImportPointsCSVContext(context.Background(), r, merge)
+}
+
+// ImportPointsCSVContext is ImportPointsCSV with the change attributed in the config history to the change
+// of ctx (see config.WithChange)
+func (m *Manager) ImportPointsCSVContext(ctx context.Context, r io.Reader, merge bool) (int, error) {
+	imported, err := parsePointsCSV(r)
+	if err != nil {
+		return 0, err
+	}
+	points := imported
+	if merge {
+		replaced := make(map[[2]string]bool, len(imported))
+		for _, pt := range imported {
+			replaced[[2]string{pt.Serial, pt.Channel}] = true
+		}
+		points = nil
+		for _, pt := range m.getPointsConfig() {
+			if !replaced[[2]string{pt.Serial, pt.Channel}] {
+				points = append(points, pt)
+			}
+		}
+		points = append(points, imported...)
+	}
+	if err := m.SetPointsContext(ctx, points); err != nil {
+		return 0, err
+	}
+	return len(imported), nil
+}
+
+func (m *Manager) getPointsConfig() []config.Point {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]config.Point(nil), m.points...)
+}
+
+// parsePointsCSV reads a point schedule, reporting problems by CSV line
+func parsePointsCSV(r io.Reader) ([]config.Point, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errorf(CodeInvalidRequest, "invalid CSV: %v", err)
+	}
+	if len(rows) < 2 {
+		return nil, errorf(CodeInvalidRequest, "CSV needs a header row and at least one point")
+	}
+
+	column := make(map[string]int)
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, c := range pointColumns {
+			found = found || c == name
+		}
+		if !found {
+			return nil, errorf(CodeInvalidRequest, "line 1: unknown column %q (use %s)", name, strings.Join(pointColumns, ", "))
+		}
+		column[name] = i
+	}
+	for _, required := range pointColumns[:3] {
+		if _, ok := column[required]; !ok {
+			return nil, errorf(CodeInvalidRequest, "line 1: column %s is required", required)
+		}
+	}
+
+	var p configProblems
+	line := func(i int) string { return "line " + strconv.Itoa(i+2) }
+	points := make([]config.Point, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		field := func(name string) string {
+			if c, ok := column[name]; ok {
+				return strings.TrimSpace(row[c])
+			}
+			return ""
+		}
+		pt := config.Point{
+			Serial:    field("serial"),
+			Channel:   strings.ToLower(field("channel")),
+			Name:      field("name"),
+			Unit:      field("unit"),
+			SafeState: strings.ToLower(field("safe_state")),
+			Label:     field("label"),
+		}
+		if s := field("scaling"); s != "" {
+			var ok bool
+			if pt.RawMin, pt.RawMax, pt.EngMin, pt.EngMax, ok = parseScaling(s); !ok {
+				p.add(line(i)+".scaling", "invalid scaling %q (use raw..raw=eng..eng, e.g. 4..20=0..10)", s)
+			}
+		}
+		points = append(points, pt)
+	}
+	validatePointList(points, line, &p)
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// parseScaling parses "rawMin..rawMax=engMin..engMax"
+func parseScaling(s string) (rawMin, rawMax, engMin, engMax float64, ok bool) {
+	raw, eng, found := strings.Cut(s, "=")
+	if !found {
+		return 0, 0, 0, 0, false
+	}
+	parseRange := func(r string) (float64, float64, bool) {
+		lo, hi, found := strings.Cut(strings.TrimSpace(r), "..")
+		a, errA := strconv.ParseFloat(strings.TrimSpace(lo), 64)
+		b, errB := strconv.ParseFloat(strings.TrimSpace(hi), 64)
+		return a, b, found && errA == nil && errB == nil
+	}
+	rawMin, rawMax, okRaw := parseRange(raw)
+	engMin, engMax, okEng := parseRange(eng)
+	return rawMin, rawMax, engMin, engMax, okRaw && okEng
+}
+
+// pointSafeStatesLocked returns the safe state overrides of a card's outputs by channel index; the caller
+// must hold m.mu
+func (m *Manager) pointSafeStatesLocked(c *Card) (do map[int]bool, ao map[int]float32) {
+	do, ao = make(map[int]bool), make(map[int]float32)
+	if c.Last.SerialNumber == "" {
+		return do, ao
+	}
+	for _, pt := range m.points {
+		if pt.Serial != c.Last.SerialNumber || pt.SafeState == "" {
+			continue
+		}
+		match := commissioningChannelPattern.FindStringSubmatch(pt.Channel)
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[2])
+		switch match[1] {
+		case "do":
+			do[index] = pt.SafeState == "on"
+		case "ao":
+			if v, err := strconv.ParseFloat(pt.SafeState, 32); err == nil {
+				ao[index] = float32(v)
+			}
+		}
+	}
+	return do, ao
+}
@@ -0,0 +1,89 @@
+package localio
+
+import (
+	"strings"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestImportPointsCSV(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(newIO0404Client())
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	card.Last.SerialNumber = "SN1"
+	card.Last.AI = []float32{12, 0, 0, 0}
+
+	schedule := "Serial,Channel,Name,Unit,Scaling,Safe_State\n" +
+		"SN1,AI0,Supply pressure,bar,4..20=0..10,\n" +
+		"SN1,ao1,Valve,%,,2.5\n" +
+		"SN2,do0,Pump,,,on\n"
+	n, err := mgr.ImportPointsCSV(strings.NewReader(schedule), false)
+	if err != nil || n != 3 {
+		t.Fatalf("ImportPointsCSV failed: %d %v", n, err)
+	}
+	points := mgr.GetPoints()
+	if len(points) != 3 || points[0].Name != "Supply pressure" || points[0].CardID != "1" || points[0].Scaled == nil || *points[0].Scaled != 5 {
+		t.Fatalf("Expected the supply pressure scaled to 5 bar, got %+v", points[0])
+	}
+	if points[2].CardID != "" || points[2].Value != nil {
+		t.Errorf("Expected no card for SN2, got %+v", points[2])
+	}
+
+	// Merging replaces the points of the same channels and keeps the others
+	if _, err := mgr.ImportPointsCSV(strings.NewReader("serial,channel,name\nSN1,ao1,Damper\n"), true); err != nil {
+		t.Fatalf("ImportPointsCSV failed: %v", err)
+	}
+	points = mgr.GetPoints()
+	if len(points) != 3 || points[2].Name != "Damper" || points[2].SafeState != "" || config.GetConfig().Points[2].Name != "Damper" {
+		t.Errorf("Expected ao1 renamed and persisted, got %+v", points)
+	}
+
+	for _, tt := range []struct{ csv, want string }{
+		{"serial,channel\nSN1,ai0\n", "column name is required"},
+		{"serial,channel,name,color\nSN1,ai0,x,red\n", `unknown column "color"`},
+		{"serial,channel,name\nSN1,ai0,x\nSN1,ai9x,y\n", "line 3.channel"},
+		{"serial,channel,name,scaling\nSN1,ai0,x,4-20\n", "line 2.scaling"},
+		{"serial,channel,name,safe_state\nSN1,di0,x,on\n", "only outputs have a safe state"},
+		{"serial,channel,name\nSN1,ai0,x\nSN1,ai0,y\n", "duplicate entry"},
+	} {
+		if _, err := mgr.ImportPointsCSV(strings.NewReader(tt.csv), false); ErrorCodeOf(err) != CodeInvalidRequest || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expected %q importing %q, got %v", tt.want, tt.csv, err)
+		}
+	}
+	if len(mgr.GetPoints()) != 3 {
+		t.Errorf("Expected a failed import to keep the points")
+	}
+}
+
+func TestPointSafeState(t *testing.T) {
+	configtest.Isolate(t)
+
+	var coils byte
+	client := &MockClient{
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			coils = value[0]
+			return nil, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	card.Last.SerialNumber = "SN1"
+	if err := mgr.SetPoints([]config.Point{{Serial: "SN1", Channel: "do2", Name: "Fan", SafeState: "on"}}); err != nil {
+		t.Fatalf("SetPoints failed: %v", err)
+	}
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	if coils != 0x04 {
+		t.Errorf("Expected only DO2 on in safe state, got %08b", coils)
+	}
+}
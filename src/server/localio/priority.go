@@ -0,0 +1,179 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// DIReader is implemented by drivers that can read a span of discrete inputs on their own. It enables
+// the sub-polling of priority_channels.
+type DIReader interface {
+	ReadDI(bus *Bus, first, count int) ([]bool, error)
+}
+
+// priorityChannelPattern matches the channel names of priority_channels
+var priorityChannelPattern = regexp.MustCompile(`^di[0-9]+$`)
+
+// ValidatePriorityChannels checks priority channel entries for missing cards and non-DI channels
+func ValidatePriorityChannels(channels []config.InputChannel) error {
+	var p configProblems
+	validatePriorityChannels(channels, &p)
+	return p.err()
+}
+
+func validatePriorityChannels(channels []config.InputChannel, p *configProblems) {
+	for i, ch := range channels {
+		path := fmt.Sprintf("priority_channels[%d]", i)
+		if ch.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if !priorityChannelPattern.MatchString(ch.Channel) {
+			p.add(path+".channel", "invalid channel %q (use di<n>, e.g. di0)", ch.Channel)
+		}
+	}
+}
+
+// GetPriorityChannels returns the DI channels sub-polled between card reads
+func (m *Manager) GetPriorityChannels() []config.InputChannel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channels := make([]config.InputChannel, len(m.priority))
+	copy(channels, m.priority)
+	return channels
+}
+
+// SetPriorityChannels validates, activates, and persists the DI channels sub-polled between card reads
+func (m *Manager) SetPriorityChannels(channels []config.InputChannel) error {
+	return m.SetPriorityChannelsContext(context.Background(), channels)
+}
+
+// SetPriorityChannelsContext is SetPriorityChannels with the change attributed in the config history to the
+// change of ctx (see config.WithChange)
+func (m *Manager) SetPriorityChannelsContext(ctx context.Context, channels []config.InputChannel) error {
+	if err := ValidatePriorityChannels(channels); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.priority = channels
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.PriorityChannels = channels
+	})
+}
+
+// priorityTarget is a card with priority channels and the port it is read on
+type priorityTarget struct {
+	card     *Card
+	pc       *portClient
+	channels []int
+}
+
+// pollPriority re-reads the priority DI channels (and the pulse channels of cards without latches) of
+// every card except skip (the card that was just
+// read in full). Cards whose last read failed are left to the full read so a missing card doesn't
+// add a timeout between every card read. A state change is reported to the state change callback
+// right away; the IDs of the changed cards are returned.
+func (m *Manager) pollPriority(skip string) []string {
+	m.mu.Lock()
+	channels := m.subPolledLocked()
+	if len(channels) == 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	byCard := make(map[string]*priorityTarget)
+	for _, ch := range channels {
+		c, ok := m.cards[ch.Card]
+		if !ok || c.ID == skip || c.Last.Error != "" {
+			continue
+		}
+		pc, ok := m.ports[c.PortPath]
+		if !ok {
+			continue
+		}
+		index, _ := strconv.Atoi(ch.Channel[2:])
+		t, ok := byCard[c.ID]
+		if !ok {
+			t = &priorityTarget{card: c, pc: pc}
+			byCard[c.ID] = t
+		}
+		t.channels = append(t.channels, index)
+	}
+	callback := m.stateChangeCallback
+	m.mu.Unlock()
+
+	targets := make([]*priorityTarget, 0, len(byCard))
+	for _, t := range byCard {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		idi, _ := strconv.Atoi(targets[i].card.ID)
+		idj, _ := strconv.Atoi(targets[j].card.ID)
+		return idi < idj
+	})
+
+	var changed []string
+	for _, t := range targets {
+		if m.readPriority(t) {
+			changed = append(changed, t.card.ID)
+		}
+	}
+	if len(changed) > 0 && callback != nil {
+		callback(m.GetAllCards())
+	}
+	return changed
+}
+
+// readPriority reads the span of a card's priority channels and reports whether one of them changed
+func (m *Manager) readPriority(t *priorityTarget) bool {
+	c := t.card
+	drv, ok := cardDriver(c).(DIReader)
+	if !ok {
+		return false
+	}
+	n := len(c.Last.DI)
+	channels := slices.DeleteFunc(t.channels, func(i int) bool { return i < 0 || i >= n })
+	if len(channels) == 0 {
+		return false
+	}
+	first, last := slices.Min(channels), slices.Max(channels)
+
+	var values []bool
+	err := t.pc.do(c.SlaveID, func(bus *Bus) error {
+		var err error
+		values, err = drv.ReadDI(bus, first, last-first+1)
+		bus.Pause() // RS485 delay
+		return err
+	})
+	if err != nil {
+		// The next full read of the card reports the error
+		return false
+	}
+
+	var simulated []int
+	if c.Last.Simulated != nil {
+		simulated = c.Last.Simulated.DI
+	}
+	di := slices.Clone(c.Last.DI)
+	changed := false
+	for _, i := range channels {
+		if slices.Contains(simulated, i) || di[i] == values[i-first] {
+			continue
+		}
+		di[i] = values[i-first]
+		changed = true
+	}
+	if changed {
+		m.mu.Lock()
+		c.Last.DI = di
+		m.stampLocked(&c.Last)
+		m.mu.Unlock()
+	}
+	return changed
+}
@@ -0,0 +1,61 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestPriorityChannels(t *testing.T) {
+	configtest.Isolate(t)
+
+	var priorityReads int
+	di2 := false
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			if address == 2 && quantity == 1 {
+				priorityReads++
+				if di2 {
+					return []byte{0x01}, nil
+				}
+				return []byte{0x00}, nil
+			}
+			if di2 {
+				return []byte{0x04}, nil
+			}
+			return []byte{0x00}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	second, err := mgr.AddCard("/dev/ttyUSB0", 2, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.SetPriorityChannels([]config.InputChannel{{Card: second.ID, Channel: "ai0"}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for an AI channel, got %v", err)
+	}
+	if err := mgr.SetPriorityChannels([]config.InputChannel{{Card: second.ID, Channel: "di2"}}); err != nil {
+		t.Fatalf("SetPriorityChannels failed: %v", err)
+	}
+
+	var callbacks int
+	mgr.SetStateChangeCallback(func(cards []*Card) { callbacks++ })
+
+	// DI2 of the second card is re-read after the first card; after its own full read it is not
+	di2 = true
+	mgr.ReadAllAndProcessWrites()
+	if priorityReads != 1 {
+		t.Errorf("Expected 1 priority read per cycle, got %d", priorityReads)
+	}
+	if callbacks != 2 {
+		t.Errorf("Expected the change reported by the priority read and at the end of the cycle, got %d callbacks", callbacks)
+	}
+	if !second.Last.DI[2] {
+		t.Errorf("Expected DI2 of the second card on, got %v", second.Last.DI)
+	}
+}
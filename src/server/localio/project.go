@@ -0,0 +1,169 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Project document format; ProjectVersion increases with incompatible changes of the document
+const (
+	ProjectFormat  = "jaspermate-project"
+	ProjectVersion = 1
+)
+
+// ProjectCard is a card of the exported unit
+type ProjectCard struct {
+	ID           string `json:"id"`
+	Module       string `json:"module"`
+	PortPath     string `json:"portPath"`
+	SlaveID      byte   `json:"slaveId"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// Project is the point database of a unit: its cards and the configuration bound to their channels. It is
+// exported from one unit and imported on another, e.g. a replacement panel or the units of a rollout.
+type Project struct {
+	Format     string        `json:"format"`
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exportedAt"`
+	DeviceID   string        `json:"deviceId"` // Unit the project was exported from
+	Cards      []ProjectCard `json:"cards"`
+
+	Points            []config.Point           `json:"points"`
+	Alarms            []config.AlarmRule       `json:"alarms"`
+	PIDLoops          []config.PIDLoopConfig   `json:"pidLoops"`
+	Interlocks        []config.InterlockRule   `json:"interlocks"`
+	WritePermissions  []config.WritePermission `json:"writePermissions"`
+	DOTimings         []config.DOTiming        `json:"doTimings"`
+	AOSlewRates       []config.AOSlewRate      `json:"aoSlewRates"`
+	HeartbeatOutput   config.HeartbeatOutput   `json:"heartbeatOutput"`
+	DisabledChannels  []config.InputChannel    `json:"disabledChannels"`
+	PriorityChannels  []config.InputChannel    `json:"priorityChannels"`
+	PulseChannels     []config.InputChannel    `json:"pulseChannels"`
+	CurrentLoopInputs []config.InputChannel    `json:"currentLoopInputs"`
+	Sequences         []config.Sequence        `json:"sequences"`
+	Scripts           []config.Script          `json:"scripts"`
+}
+
+// ExportProject returns the point database of the unit
+func (m *Manager) ExportProject() Project {
+	cfg := config.GetConfig()
+	p := Project{
+		Format:            ProjectFormat,
+		Version:           ProjectVersion,
+		ExportedAt:        time.Now().UTC(),
+		DeviceID:          cfg.DeviceID,
+		Cards:             []ProjectCard{},
+		Points:            cfg.Points,
+		Alarms:            cfg.Alarms,
+		PIDLoops:          cfg.PIDLoops,
+		Interlocks:        cfg.Interlocks,
+		WritePermissions:  cfg.WritePermissions,
+		DOTimings:         cfg.DOTimings,
+		AOSlewRates:       cfg.AOSlewRates,
+		HeartbeatOutput:   cfg.HeartbeatOutput,
+		DisabledChannels:  cfg.DisabledChannels,
+		PriorityChannels:  cfg.PriorityChannels,
+		PulseChannels:     cfg.PulseChannels,
+		CurrentLoopInputs: cfg.CurrentLoopInputs,
+		Sequences:         cfg.Sequences,
+		Scripts:           cfg.Scripts,
+	}
+	for _, c := range m.GetAllCards() {
+		p.Cards = append(p.Cards, ProjectCard{ID: c.ID, Module: c.Module, PortPath: c.PortPath, SlaveID: c.SlaveID, SerialNumber: c.Last.SerialNumber})
+	}
+	return p
+}
+
+// ImportProject replaces the point database of the unit by p, validated as a whole, and activates it.
+// Points of exported cards whose serial number isn't on this unit move to the card at the same port and
+// slave ID, so a replacement panel takes over the points of the one it replaces. Returns warnings about
+// exported cards missing here or with a different module.
+func (m *Manager) ImportProject(p Project) ([]string, error) {
+	return m.ImportProjectContext(context.Background(), p)
+}
+
+// ImportProjectContext is ImportProject with the change attributed in the config history to the change of
+// ctx (see config.WithChange)
+func (m *Manager) ImportProjectContext(ctx context.Context, p Project) ([]string, error) {
+	if p.Format != ProjectFormat {
+		return nil, errorf(CodeInvalidRequest, "not a project document (format %q, want %q)", p.Format, ProjectFormat)
+	}
+	if p.Version < 1 || p.Version > ProjectVersion {
+		return nil, errorf(CodeInvalidRequest, "unsupported project version %d (this unit reads up to %d)", p.Version, ProjectVersion)
+	}
+
+	var warnings []string
+	cards := m.GetAllCards()
+	serials := make(map[string]string) // Exported serial number -> serial number of the card here
+	for _, pc := range p.Cards {
+		var here *Card
+		for _, c := range cards {
+			if c.PortPath == pc.PortPath && c.SlaveID == pc.SlaveID {
+				here = c
+				break
+			}
+		}
+		switch {
+		case here == nil:
+			warnings = append(warnings, fmt.Sprintf("card %s (%s slave %d) not found", pc.ID, pc.PortPath, pc.SlaveID))
+			continue
+		case here.Module != pc.Module:
+			warnings = append(warnings, fmt.Sprintf("card %s is %s here, %s in the project", here.ID, here.Module, pc.Module))
+		}
+		if pc.SerialNumber != "" && here.Last.SerialNumber != "" {
+			serials[pc.SerialNumber] = here.Last.SerialNumber
+		}
+	}
+	points := make([]config.Point, len(p.Points))
+	for i, pt := range p.Points {
+		if serial, ok := serials[pt.Serial]; ok {
+			pt.Serial = serial
+		}
+		points[i] = pt
+	}
+
+	apply := func(c *config.Config) {
+		c.Points = points
+		c.Alarms = p.Alarms
+		c.PIDLoops = p.PIDLoops
+		c.Interlocks = p.Interlocks
+		c.WritePermissions = p.WritePermissions
+		c.DOTimings = p.DOTimings
+		c.AOSlewRates = p.AOSlewRates
+		c.HeartbeatOutput = p.HeartbeatOutput
+		c.DisabledChannels = p.DisabledChannels
+		c.PriorityChannels = p.PriorityChannels
+		c.PulseChannels = p.PulseChannels
+		c.CurrentLoopInputs = p.CurrentLoopInputs
+		c.Sequences = p.Sequences
+		c.Scripts = p.Scripts
+	}
+	// Problems the config has already (e.g. in its settings) don't block the import
+	current := config.GetConfig()
+	known := make(map[ConfigProblem]bool)
+	for _, problem := range m.ValidateConfig(current) {
+		known[problem] = true
+	}
+	candidate := current
+	apply(&candidate)
+	var problems configProblems
+	for _, problem := range m.ValidateConfig(candidate) {
+		if !known[problem] {
+			problems = append(problems, problem)
+		}
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	if err := config.UpdateContext(ctx, apply); err != nil {
+		return nil, err
+	}
+	m.activateConfig(config.GetConfig())
+	log.Printf("project of device %s imported (%d points)", p.DeviceID, len(points))
+	return warnings, nil
+}
@@ -0,0 +1,80 @@
+package localio
+
+import (
+	"encoding/json"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestProjectExportImport(t *testing.T) {
+	configtest.Isolate(t)
+
+	old := newMockManager(&MockClient{})
+	card, err := old.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	card.Last.SerialNumber = "SN-OLD"
+	if err := old.SetPoints([]config.Point{{Serial: "SN-OLD", Channel: "do0", Name: "Pump"}}); err != nil {
+		t.Fatalf("SetPoints failed: %v", err)
+	}
+	interlocks := []config.InterlockRule{{Name: "fwd-rev", Type: config.InterlockExclusive, Outputs: []config.ChannelRef{{Card: "1", Index: 0}, {Card: "1", Index: 1}}}}
+	if err := old.SetInterlocks(interlocks); err != nil {
+		t.Fatalf("SetInterlocks failed: %v", err)
+	}
+	data, err := json.Marshal(old.ExportProject())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	config.Update(func(c *config.Config) {
+		c.Points = nil
+		c.Interlocks = nil
+	})
+
+	// The replacement panel has a new card at the same address
+	replacement := newMockManager(&MockClient{})
+	card, _ = replacement.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	card.Last.SerialNumber = "SN-NEW"
+	var project Project
+	if err := json.Unmarshal(data, &project); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	project.Cards = append(project.Cards, ProjectCard{ID: "2", Module: "IO0404", PortPath: "/dev/ttyUSB0", SlaveID: 2})
+	warnings, err := replacement.ImportProject(project)
+	if err != nil {
+		t.Fatalf("ImportProject failed: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected a warning about the missing card 2, got %v", warnings)
+	}
+	points := replacement.GetPoints()
+	if len(points) != 1 || points[0].Serial != "SN-NEW" || points[0].CardID != "1" {
+		t.Errorf("Expected the point moved to the new card, got %+v", points)
+	}
+	if got := replacement.GetInterlocks(); len(got) != 1 || got[0].Name != "fwd-rev" {
+		t.Errorf("Expected the interlock activated, got %+v", got)
+	}
+	if cfg := config.GetConfig(); len(cfg.Interlocks) != 1 || cfg.Points[0].Serial != "SN-NEW" {
+		t.Errorf("Expected the project persisted, got %+v %+v", cfg.Interlocks, cfg.Points)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(p *Project)
+	}{
+		{"format", func(p *Project) { p.Format = "other" }},
+		{"version", func(p *Project) { p.Version = ProjectVersion + 1 }},
+		{"invalid point", func(p *Project) { p.Points = []config.Point{{Serial: "SN-NEW", Channel: "do0"}} }},
+	} {
+		p := project
+		tt.modify(&p)
+		if _, err := replacement.ImportProject(p); ErrorCodeOf(err) != CodeInvalidRequest {
+			t.Errorf("%s: expected INVALID_REQUEST, got %v", tt.name, err)
+		}
+	}
+	if len(replacement.GetPoints()) != 1 || replacement.GetPoints()[0].Name != "Pump" {
+		t.Errorf("Expected a rejected import to keep the points")
+	}
+}
@@ -0,0 +1,180 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// DILatchReader is implemented by drivers whose devices latch discrete inputs in hardware. It enables
+// the latch capture of pulse_channels; pulse channels of other cards are sub-polled instead.
+type DILatchReader interface {
+	// ReadDILatches returns the inputs of the card that became active since the previous call. Reading
+	// clears the latches.
+	ReadDILatches(bus *Bus, spec ModelSpec) ([]bool, error)
+}
+
+// Pulse capture modes
+const (
+	PulseCaptureLatch   = "latch"
+	PulseCaptureSubPoll = "sub-poll"
+)
+
+// PulseChannel is a DI channel whose short pulses are captured and how they are captured
+type PulseChannel struct {
+	config.InputChannel
+	Capture string `json:"capture,omitempty"` // latch or sub-poll; empty if the card is unknown
+}
+
+// ValidatePulseChannels checks pulse channel entries for missing cards and non-DI channels
+func ValidatePulseChannels(channels []config.InputChannel) error {
+	var p configProblems
+	validatePulseChannels(channels, &p)
+	return p.err()
+}
+
+func validatePulseChannels(channels []config.InputChannel, p *configProblems) {
+	for i, ch := range channels {
+		path := fmt.Sprintf("pulse_channels[%d]", i)
+		if ch.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if !priorityChannelPattern.MatchString(ch.Channel) {
+			p.add(path+".channel", "invalid channel %q (use di<n>, e.g. di0)", ch.Channel)
+		}
+	}
+}
+
+// GetPulseChannels returns the DI channels whose short pulses are captured
+func (m *Manager) GetPulseChannels() []PulseChannel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]PulseChannel, 0, len(m.pulse))
+	for _, ch := range m.pulse {
+		pc := PulseChannel{InputChannel: ch}
+		if c, ok := m.cards[ch.Card]; ok {
+			pc.Capture = PulseCaptureSubPoll
+			if _, ok := cardDriver(c).(DILatchReader); ok {
+				pc.Capture = PulseCaptureLatch
+			}
+		}
+		out = append(out, pc)
+	}
+	return out
+}
+
+// SetPulseChannels validates, activates, and persists the DI channels whose short pulses are captured
+func (m *Manager) SetPulseChannels(channels []config.InputChannel) error {
+	return m.SetPulseChannelsContext(context.Background(), channels)
+}
+
+// SetPulseChannelsContext is SetPulseChannels with the change attributed in the config history to the
+// change of ctx (see config.WithChange)
+func (m *Manager) SetPulseChannelsContext(ctx context.Context, channels []config.InputChannel) error {
+	if err := ValidatePulseChannels(channels); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.pulse = channels
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.PulseChannels = channels
+	})
+}
+
+// subPolledLocked returns the DI channels re-read between card reads: the priority channels and the
+// pulse channels of cards that don't latch their inputs. The caller must hold m.mu.
+func (m *Manager) subPolledLocked() []config.InputChannel {
+	channels := m.priority
+	for _, ch := range m.pulse {
+		c, ok := m.cards[ch.Card]
+		if !ok {
+			continue
+		}
+		if _, ok := cardDriver(c).(DILatchReader); ok || slices.Contains(channels, ch) {
+			continue
+		}
+		channels = append(slices.Clip(channels), ch)
+	}
+	return channels
+}
+
+// latchedPulseChannelsLocked returns the pulse channel indexes of a card read through its latches; the
+// caller must hold m.mu
+func (m *Manager) latchedPulseChannelsLocked(cardID string) []int {
+	var out []int
+	for _, ch := range m.pulse {
+		if ch.Card == cardID {
+			index, _ := strconv.Atoi(ch.Channel[2:])
+			out = append(out, index)
+		}
+	}
+	return out
+}
+
+// capturePulses reads the DI latches of a card after a successful read and reports pulse channels that
+// were active between two reads but are inactive in both as active for this read, so the next read
+// reports a momentary transition. Pulses that can't be reported yet because the channel is still shown
+// active from the previous pulse are kept for the next read.
+func (m *Manager) capturePulses(c *Card, pc *portClient, prevDI []bool) {
+	drv, ok := cardDriver(c).(DILatchReader)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	channels := m.latchedPulseChannelsLocked(c.ID)
+	pending := m.pendingPulses[c.ID]
+	m.mu.Unlock()
+	if len(channels) == 0 {
+		return
+	}
+
+	var latched []bool
+	spec := cardSpec(c)
+	err := pc.do(c.SlaveID, func(bus *Bus) error {
+		var err error
+		latched, err = drv.ReadDILatches(bus, spec)
+		bus.Pause() // RS485 delay
+		return err
+	})
+	if err != nil {
+		log.Printf("card %s: DI latch read failed: %v", c.ID, err)
+		return
+	}
+
+	var captured []int
+	var keep []int
+	di := c.Last.DI
+	for _, i := range channels {
+		if i < 0 || i >= len(di) {
+			continue
+		}
+		pulse := slices.Contains(pending, i) || (i < len(latched) && latched[i])
+		if !pulse || di[i] {
+			continue // No pulse, or the read shows the input active
+		}
+		if i < len(prevDI) && prevDI[i] {
+			keep = append(keep, i) // Still reported active: report the pulse on the next read
+			continue
+		}
+		di[i] = true
+		captured = append(captured, i)
+	}
+
+	m.mu.Lock()
+	if len(keep) > 0 {
+		m.pendingPulses[c.ID] = keep
+	} else {
+		delete(m.pendingPulses, c.ID)
+	}
+	m.mu.Unlock()
+
+	for _, i := range captured {
+		m.emitEvent(EventDIPulse, c.ID, map[string]interface{}{"channel": "di" + strconv.Itoa(i)})
+	}
+}
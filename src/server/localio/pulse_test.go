@@ -0,0 +1,117 @@
+package localio
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+// latchDriver is a test driver for a DI card that latches its inputs in hardware
+type latchDriver struct {
+	di      []bool
+	latched []bool
+}
+
+func (d *latchDriver) Name() string { return "test-latch" }
+
+func (d *latchDriver) Models() []ModelSpec {
+	return []ModelSpec{{Name: "LATCH-4", DI: 4}}
+}
+
+func (d *latchDriver) Probe(bus *Bus) ModelSpec { return ModelSpec{} }
+
+func (d *latchDriver) Read(bus *Bus, spec ModelSpec, full bool) (CardState, error) {
+	return CardState{Timestamp: time.Now(), DI: slices.Clone(d.di)}, nil
+}
+
+func (d *latchDriver) Write(bus *Bus, w OutputWrite) error {
+	return errorf(CodeInvalidRequest, "no outputs")
+}
+
+func (d *latchDriver) ReadDILatches(bus *Bus, spec ModelSpec) ([]bool, error) {
+	latched := d.latched
+	d.latched = make([]bool, spec.DI)
+	return latched, nil
+}
+
+var testLatch = &latchDriver{di: make([]bool, 4), latched: make([]bool, 4)}
+
+func init() {
+	RegisterDriver(testLatch)
+}
+
+func TestPulseChannels_Latch(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	var events []Event
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "LATCH-4")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.AddEventListener(func(ev Event) { events = append(events, ev) })
+	if err := mgr.SetPulseChannels([]config.InputChannel{{Card: card.ID, Channel: "do0"}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a DO channel, got %v", err)
+	}
+	if err := mgr.SetPulseChannels([]config.InputChannel{{Card: card.ID, Channel: "di1"}}); err != nil {
+		t.Fatalf("SetPulseChannels failed: %v", err)
+	}
+	if channels := mgr.GetPulseChannels(); len(channels) != 1 || channels[0].Capture != PulseCaptureLatch {
+		t.Fatalf("Expected di1 captured by latch, got %+v", channels)
+	}
+	mgr.ReadAllAndProcessWrites()
+
+	// A pulse on DI1 between two reads is reported for one read; DI2 is not a pulse channel
+	testLatch.latched = []bool{false, true, true, false}
+	mgr.ReadAllAndProcessWrites()
+	c, _ := mgr.GetCard(card.ID)
+	if !c.Last.DI[1] || c.Last.DI[2] {
+		t.Errorf("Expected the DI1 pulse reported and DI2 not, got %v", c.Last.DI)
+	}
+	if len(events) != 1 || events[0].Type != EventDIPulse || events[0].Data["channel"] != "di1" {
+		t.Errorf("Expected one di-pulse event for di1, got %+v", events)
+	}
+
+	// A second pulse while the first is still reported is reported after the input went off
+	testLatch.latched = []bool{false, true, false, false}
+	mgr.ReadAllAndProcessWrites()
+	c, _ = mgr.GetCard(card.ID)
+	if c.Last.DI[1] {
+		t.Errorf("Expected DI1 off after the pulse, got %v", c.Last.DI)
+	}
+	mgr.ReadAllAndProcessWrites()
+	c, _ = mgr.GetCard(card.ID)
+	if !c.Last.DI[1] {
+		t.Errorf("Expected the second DI1 pulse reported, got %v", c.Last.DI)
+	}
+	mgr.ReadAllAndProcessWrites()
+	c, _ = mgr.GetCard(card.ID)
+	if c.Last.DI[1] {
+		t.Errorf("Expected DI1 off after the second pulse, got %v", c.Last.DI)
+	}
+}
+
+func TestPulseChannels_SubPoll(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if err := mgr.SetPulseChannels([]config.InputChannel{{Card: card.ID, Channel: "di2"}}); err != nil {
+		t.Fatalf("SetPulseChannels failed: %v", err)
+	}
+	if channels := mgr.GetPulseChannels(); len(channels) != 1 || channels[0].Capture != PulseCaptureSubPoll {
+		t.Fatalf("Expected di2 sub-polled, got %+v", channels)
+	}
+	mgr.mu.Lock()
+	polled := mgr.subPolledLocked()
+	mgr.mu.Unlock()
+	if len(polled) != 1 || polled[0].Channel != "di2" {
+		t.Errorf("Expected di2 sub-polled between card reads, got %+v", polled)
+	}
+}
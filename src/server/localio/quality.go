@@ -0,0 +1,97 @@
+package localio
+
+import (
+	"strconv"
+	"time"
+)
+
+// Channel qualities
+const (
+	QualityGood        = "good"         // Read in the last cycle
+	QualityStale       = "stale"        // The last read failed; the value is from the last good read
+	QualityError       = "error"        // Never read, or reads have failed for longer than qualityErrorAfter
+	QualityForced      = "forced"       // Output held by a manual override (control_lock warn/channels)
+	QualitySimulated   = "simulated"    // Input injected via the simulation API
+	QualityDisabled    = "disabled"     // Input not polled (disabled_channels); the value is always zero
+	QualitySensorFault = "sensor-fault" // Current loop input out of range (current_loop_inputs)
+)
+
+// qualityErrorAfter is how long reads of a card can fail before its values are reported as error instead
+// of stale
+const qualityErrorAfter = 30 * time.Second
+
+// ChannelQuality is the quality of each channel of a card state, in channel order
+type ChannelQuality struct {
+	DI []string `json:"di,omitempty"`
+	DO []string `json:"do,omitempty"`
+	AI []string `json:"ai,omitempty"`
+	AO []string `json:"ao,omitempty"`
+}
+
+// applyQuality sets the channel qualities and last good read time of a card after a read, and numbers
+// the new state
+func (m *Manager) applyQuality(c *Card, spec ModelSpec, readErr error, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if readErr == nil {
+		c.lastGood = now
+	}
+	base := QualityGood
+	switch {
+	case readErr == nil:
+	case c.lastGood.IsZero() || now.Sub(c.lastGood) >= qualityErrorAfter:
+		base = QualityError
+	default:
+		base = QualityStale
+	}
+
+	fill := func(n int) []string {
+		q := make([]string, n)
+		for i := range q {
+			q[i] = base
+		}
+		return q
+	}
+	q := &ChannelQuality{DI: fill(spec.DI), DO: fill(spec.DO), AI: fill(spec.AI), AO: fill(spec.AO)}
+	for i := range q.DI {
+		if !spec.Enabled("di", i) {
+			q.DI[i] = QualityDisabled
+		}
+	}
+	for i := range q.AI {
+		if !spec.Enabled("ai", i) {
+			q.AI[i] = QualityDisabled
+		}
+	}
+	if sim := c.Last.Simulated; sim != nil {
+		setQuality(q.DI, sim.DI, QualitySimulated)
+		setQuality(q.AI, sim.AI, QualitySimulated)
+	}
+	for key, owner := range m.owners[c.ID] {
+		if !owner.Source.Override || owner.Released {
+			continue
+		}
+		index, err := strconv.Atoi(key[2:])
+		if err != nil {
+			continue
+		}
+		if key[:2] == "do" {
+			setQuality(q.DO, []int{index}, QualityForced)
+		} else {
+			setQuality(q.AO, []int{index}, QualityForced)
+		}
+	}
+
+	c.Last.Quality = q
+	c.Last.LastGood = c.lastGood
+	m.stampLocked(&c.Last)
+}
+
+func setQuality(q []string, indexes []int, quality string) {
+	for _, i := range indexes {
+		if i >= 0 && i < len(q) {
+			q[i] = quality
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package localio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestChannelQuality(t *testing.T) {
+	configtest.Isolate(t)
+
+	offline := false
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			if offline {
+				return nil, errorf(CodeBusTimeout, "timeout")
+			}
+			return []byte{0x00}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if q := card.Last.Quality; q == nil || len(q.DI) != 4 || q.DI[0] != QualityGood || q.DO[3] != QualityGood || card.Last.LastGood.IsZero() {
+		t.Fatalf("Expected good channels after the initial read, got %+v", card.Last)
+	}
+
+	// Simulated inputs and overridden outputs are flagged
+	if err := mgr.SimulateInputs(card.ID, map[int]bool{2: true}, nil); err != nil {
+		t.Fatalf("SimulateInputs failed: %v", err)
+	}
+	override := WithSource(context.Background(), WriteSource{Kind: SourceHTTP, ID: "10.0.0.9", Override: true})
+	mgr.ProcessBatchWriteContext(override, []WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1}})
+	mgr.ReadAllAndProcessWrites()
+	if q := card.Last.Quality; q.DI[2] != QualitySimulated || q.DI[0] != QualityGood || q.DO[1] != QualityForced {
+		t.Errorf("Expected DI2 simulated and DO1 forced, got %+v", q)
+	}
+	if err := mgr.ClearSimulation(card.ID); err != nil {
+		t.Fatalf("ClearSimulation failed: %v", err)
+	}
+
+	// Failed reads make the values stale, then errors
+	offline = true
+	lastGood := card.Last.LastGood
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.Quality.DI[0] != QualityStale || !card.Last.LastGood.Equal(lastGood) {
+		t.Errorf("Expected stale values from %v, got %+v at %v", lastGood, card.Last.Quality, card.Last.LastGood)
+	}
+	card.lastGood = time.Now().Add(-qualityErrorAfter)
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.Quality.DI[0] != QualityError || len(card.Last.Quality.AI) != 0 {
+		t.Errorf("Expected error quality, got %+v", card.Last.Quality)
+	}
+}
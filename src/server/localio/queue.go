@@ -0,0 +1,109 @@
+package localio
+
+import (
+	"context"
+	"time"
+)
+
+// PendingWrite is a queued write operation that hasn't been executed yet
+type PendingWrite struct {
+	ID       uint64      `json:"id"`
+	CardID   string      `json:"cardId"`
+	Type     string      `json:"type"`    // "write-do", "write-ao", "write-aotype"
+	Channel  string      `json:"channel"` // "do0", "ao1", ...
+	Value    float32     `json:"value"`
+	Mode     string      `json:"mode,omitempty"` // write-aotype
+	QueuedAt time.Time   `json:"queuedAt"`
+	AgeMs    int64       `json:"ageMs"`
+	Source   WriteSource `json:"source"`
+	// HeldUntil is set while a DO write is held back by the minimum on/off time of its channel
+	HeldUntil time.Time `json:"heldUntil,omitempty"`
+}
+
+// maxQueuedWrites is the number of pending writes above which new writes are rejected with QUEUE_FULL,
+// so a producer outrunning a stalled bus can't grow the queue without bound
+const maxQueuedWrites = 1000
+
+// enqueueLocked appends an operation to the write queue, or returns QUEUE_FULL if the queue holds
+// maxQueuedWrites operations; the caller must hold m.mu
+func (m *Manager) enqueueLocked(ctx context.Context, op writeOperation) *Error {
+	if len(m.writeQueue) >= maxQueuedWrites {
+		return errorf(CodeQueueFull, "write queue full (%d pending writes)", len(m.writeQueue)).with("limit", maxQueuedWrites)
+	}
+	m.nextQueueID++
+	op = queuedOperation(ctx, op)
+	op.queueID = m.nextQueueID
+	m.writeQueue = append(m.writeQueue, op)
+	m.setOptimisticLocked(op)
+	// Don't leave the write waiting for an idle pause
+	m.wakeCycle()
+	return nil
+}
+
+// GetPendingWrites returns the queued write operations in execution order
+func (m *Manager) GetPendingWrites() []PendingWrite {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	out := make([]PendingWrite, 0, len(m.writeQueue))
+	for _, op := range m.writeQueue {
+		out = append(out, PendingWrite{
+			ID:        op.queueID,
+			CardID:    op.CardID,
+			Type:      writeOpName(op.Type),
+			Channel:   ChannelKey(op.Type, op.Index),
+			Value:     op.Value,
+			Mode:      op.Mode,
+			QueuedAt:  op.queuedAt,
+			AgeMs:     now.Sub(op.queuedAt).Milliseconds(),
+			Source:    op.source,
+			HeldUntil: op.notBefore,
+		})
+	}
+	return out
+}
+
+// CancelPendingWrite removes a queued write operation before it is executed
+func (m *Manager) CancelPendingWrite(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, op := range m.writeQueue {
+		if op.queueID == id {
+			m.writeQueue = append(m.writeQueue[:i], m.writeQueue[i+1:]...)
+			m.dropOptimisticLocked(op)
+			return nil
+		}
+	}
+	return errorf(CodeNotFound, "write %d is not pending (already executed or cancelled)", id)
+}
+
+// emitWriteExecuted emits a write-executed event with the result of every executed queued operation.
+// PID loop outputs are left out: they are written every cycle and reported by GetPIDLoops.
+func (m *Manager) emitWriteExecuted(ops []writeOperation, results []CommandResult) {
+	for i, op := range ops {
+		if i >= len(results) {
+			break
+		}
+		if op.source.Kind == SourcePID {
+			continue
+		}
+		data := map[string]interface{}{
+			"id":      op.queueID,
+			"type":    writeOpName(op.Type),
+			"channel": ChannelKey(op.Type, op.Index),
+			"value":   op.Value,
+			"source":  op.source,
+			"status":  results[i].Status,
+		}
+		if op.Type == writeOpAOType {
+			data["mode"] = op.Mode
+		}
+		if results[i].Status == "error" {
+			data["code"] = results[i].Code
+			data["message"] = results[i].Message
+		}
+		m.emitEvent(EventWriteExecuted, op.CardID, data)
+	}
+}
@@ -0,0 +1,92 @@
+package localio
+
+import (
+	"context"
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestPendingWrites(t *testing.T) {
+	configtest.Isolate(t)
+
+	var writes int
+	client := &MockClient{
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			writes++
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	ctx := WithSource(context.Background(), WriteSource{Kind: SourceHTTP, ID: "10.0.0.9"})
+	if err := mgr.QueueWriteDOContext(ctx, card.ID, 2, true); err != nil {
+		t.Fatalf("QueueWriteDOContext failed: %v", err)
+	}
+	if err := mgr.QueueWriteDOContext(ctx, card.ID, 3, true); err != nil {
+		t.Fatalf("QueueWriteDOContext failed: %v", err)
+	}
+
+	pending := mgr.GetPendingWrites()
+	if len(pending) != 2 || pending[0].Channel != "do2" || pending[0].Type != "write-do" || pending[0].Value != 1 ||
+		pending[0].Source.Kind != SourceHTTP || pending[0].QueuedAt.IsZero() {
+		t.Fatalf("Expected two pending DO writes from http, got %+v", pending)
+	}
+
+	if err := mgr.CancelPendingWrite(pending[0].ID); err != nil {
+		t.Fatalf("CancelPendingWrite failed: %v", err)
+	}
+	if err := mgr.CancelPendingWrite(pending[0].ID); ErrorCodeOf(err) != CodeNotFound {
+		t.Errorf("Expected NOT_FOUND cancelling twice, got %v", err)
+	}
+
+	var executed []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventWriteExecuted {
+			executed = append(executed, ev)
+		}
+	})
+	mgr.ProcessWriteQueue()
+	if writes != 1 {
+		t.Errorf("Expected only the remaining write to execute, got %d writes", writes)
+	}
+	if len(executed) != 1 || executed[0].CardID != card.ID || executed[0].Data["channel"] != "do3" ||
+		executed[0].Data["status"] != "ok" || executed[0].Data["id"] != pending[1].ID {
+		t.Errorf("Expected a write-executed event for do3, got %+v", executed)
+	}
+	if pending := mgr.GetPendingWrites(); len(pending) != 0 {
+		t.Errorf("Expected an empty queue, got %+v", pending)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	for i := 0; i < maxQueuedWrites; i++ {
+		if err := mgr.QueueWriteDO(card.ID, i%4, i%2 == 0); err != nil {
+			t.Fatalf("QueueWriteDO %d failed: %v", i, err)
+		}
+	}
+	err = mgr.QueueWriteDO(card.ID, 0, true)
+	if ErrorCodeOf(err) != CodeQueueFull {
+		t.Fatalf("Expected QUEUE_FULL, got %v", err)
+	}
+	if params := ErrorParamsOf(err); params["limit"] != maxQueuedWrites {
+		t.Errorf("Expected the limit in the params, got %v", params)
+	}
+
+	mgr.ProcessWriteQueue()
+	if err := mgr.QueueWriteDO(card.ID, 0, true); err != nil {
+		t.Errorf("Expected writes accepted once the queue drained, got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package localio
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Re-addressing workflow steps
+const (
+	ReaddressWaitingForCard    = "waiting-for-card"
+	ReaddressWaitingForConfirm = "waiting-for-confirm"
+	ReaddressStopped           = "stopped"
+)
+
+const (
+	// factoryDefaultSlaveID is the slave address of cards as shipped
+	factoryDefaultSlaveID = 1
+	// readdressVerifyAttempts is how many polls to wait for a card to answer on its new address
+	readdressVerifyAttempts = 20
+)
+
+// ReaddressCandidate is the factory-default card currently waiting for confirmation
+type ReaddressCandidate struct {
+	Module       string `json:"module"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// ReaddressStatus reports the progress of the re-addressing workflow
+type ReaddressStatus struct {
+	Active      bool                     `json:"active"`
+	Port        string                   `json:"port,omitempty"`
+	Step        string                   `json:"step"`
+	NextAddress int                      `json:"nextAddress,omitempty"`
+	Candidate   *ReaddressCandidate      `json:"candidate,omitempty"`
+	Assigned    []config.SlaveAssignment `json:"assigned"`
+	Error       string                   `json:"error,omitempty"`
+}
+
+// readdressSession is a running re-addressing workflow on one port
+type readdressSession struct {
+	port      string
+	register  uint16
+	nextAddr  int
+	step      string
+	candidate *ReaddressCandidate
+	spec      ModelSpec
+	initialDI []bool
+	assigned  []config.SlaveAssignment
+	lastError string
+	confirm   chan struct{}
+	stop      chan struct{}
+}
+
+// StartReaddressing starts the guided re-addressing workflow for a bus of factory-default cards.
+// The operator connects one card at a time; the card is detected on slave ID 1, confirmed by
+// toggling any of its inputs (or via ConfirmReaddress), and given the next free address starting
+// at startAddress. Each assignment is added as a card and persisted in the config.
+func (m *Manager) StartReaddressing(port string, startAddress int) error {
+	register := config.GetConfig().SlaveIDRegister
+	if register <= 0 {
+		return errorf(CodeFeatureDisabled, "slave_id_register is not configured")
+	}
+	if port == "" {
+		return errorf(CodeInvalidRequest, "port is required")
+	}
+	if startAddress <= factoryDefaultSlaveID || startAddress > 247 {
+		return errorf(CodeInvalidRequest, "start address must be between %d and 247", factoryDefaultSlaveID+1)
+	}
+
+	m.mu.Lock()
+	if m.readdress != nil && m.readdress.step != ReaddressStopped {
+		m.mu.Unlock()
+		return errorf(CodeConflict, "re-addressing already running on %s", m.readdress.port)
+	}
+	for _, c := range m.cards {
+		if c.PortPath == port && c.SlaveID == factoryDefaultSlaveID {
+			m.mu.Unlock()
+			return errorf(CodeConflict, "card %s already uses slave ID %d on %s", c.ID, factoryDefaultSlaveID, port)
+		}
+	}
+	m.mu.Unlock()
+
+	pc, err := m.ensurePort(port)
+	if err != nil {
+		return errorf(CodePortUnavailable, "failed to get port: %v", err).with("port", port)
+	}
+
+	s := &readdressSession{
+		port:     port,
+		register: uint16(register),
+		step:     ReaddressWaitingForCard,
+		assigned: []config.SlaveAssignment{},
+		confirm:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	m.mu.Lock()
+	s.nextAddr = m.nextFreeSlaveIDLocked(port, startAddress)
+	m.readdress = s
+	m.mu.Unlock()
+
+	log.Printf("re-addressing started on %s, next address %d", port, s.nextAddr)
+	go m.runReaddressing(s, pc)
+	return nil
+}
+
+// ConfirmReaddress confirms the detected candidate card (for cards without inputs to toggle)
+func (m *Manager) ConfirmReaddress() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.readdress == nil || m.readdress.step != ReaddressWaitingForConfirm {
+		return errorf(CodeConflict, "no card waiting for confirmation")
+	}
+	select {
+	case m.readdress.confirm <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// StopReaddressing ends the re-addressing workflow
+func (m *Manager) StopReaddressing() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.readdress == nil || m.readdress.step == ReaddressStopped {
+		return errorf(CodeConflict, "re-addressing not running")
+	}
+	close(m.readdress.stop)
+	m.readdress.step = ReaddressStopped
+	m.readdress.candidate = nil
+	return nil
+}
+
+// ReaddressStatus returns the state of the current (or last) re-addressing workflow
+func (m *Manager) ReaddressStatus() ReaddressStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.readdress
+	if s == nil {
+		return ReaddressStatus{Step: ReaddressStopped, Assigned: []config.SlaveAssignment{}}
+	}
+	st := ReaddressStatus{
+		Active:      s.step != ReaddressStopped,
+		Port:        s.port,
+		Step:        s.step,
+		NextAddress: s.nextAddr,
+		Assigned:    append([]config.SlaveAssignment{}, s.assigned...),
+		Error:       s.lastError,
+	}
+	if s.candidate != nil {
+		candidate := *s.candidate
+		st.Candidate = &candidate
+	}
+	return st
+}
+
+// nextFreeSlaveIDLocked returns the first slave ID >= from not used by a known card on the port
+func (m *Manager) nextFreeSlaveIDLocked(port string, from int) int {
+	used := make(map[int]bool)
+	for _, c := range m.cards {
+		if c.PortPath == port {
+			used[int(c.SlaveID)] = true
+		}
+	}
+	for used[from] {
+		from++
+	}
+	return from
+}
+
+func (m *Manager) runReaddressing(s *readdressSession, pc *portClient) {
+	for {
+		select {
+		case <-s.stop:
+			log.Printf("re-addressing on %s stopped", s.port)
+			return
+		case <-time.After(m.readdressPoll):
+		}
+
+		m.mu.Lock()
+		step := s.step
+		m.mu.Unlock()
+
+		switch step {
+		case ReaddressWaitingForCard:
+			m.readdressDetect(s, pc)
+		case ReaddressWaitingForConfirm:
+			if m.readdressConfirmed(s, pc) {
+				m.readdressAssign(s, pc)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readdressDetect looks for a card on the factory-default address
+func (m *Manager) readdressDetect(s *readdressSession, pc *portClient) {
+	spec := probeLayout(pc, factoryDefaultSlaveID)
+	if spec.DI == 0 && spec.DO == 0 && spec.AI == 0 && spec.AO == 0 {
+		return
+	}
+	spec, ok := ModelTable[spec.Name]
+	if !ok {
+		m.setReaddressError(s, fmt.Sprintf("card on slave ID %d has an unknown IO layout", factoryDefaultSlaveID))
+		return
+	}
+
+	var initialDI []bool
+	if spec.DI > 0 {
+		state, err := pc.readCard(factoryDefaultSlaveID, ModelSpec{DI: spec.DI}, false)
+		if err != nil {
+			return
+		}
+		initialDI = state.DI
+	}
+	sn := pc.readSlaveSerialNumber(ioCardDriver{}, factoryDefaultSlaveID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.step != ReaddressWaitingForCard {
+		return
+	}
+	s.spec = spec
+	s.initialDI = initialDI
+	s.candidate = &ReaddressCandidate{Module: spec.Name, SerialNumber: sn}
+	s.step = ReaddressWaitingForConfirm
+	s.lastError = ""
+	// Drop a confirmation left over from a previous candidate
+	select {
+	case <-s.confirm:
+	default:
+	}
+	log.Printf("re-addressing: found %s (SN %s) on slave ID %d, waiting for confirmation", spec.Name, sn, factoryDefaultSlaveID)
+}
+
+// readdressConfirmed reports whether the operator confirmed the candidate by API or by toggling an input.
+// If the candidate stops answering, the workflow goes back to waiting for a card.
+func (m *Manager) readdressConfirmed(s *readdressSession, pc *portClient) bool {
+	select {
+	case <-s.confirm:
+		return true
+	default:
+	}
+	if s.spec.DI == 0 {
+		return false
+	}
+
+	state, err := pc.readCard(factoryDefaultSlaveID, ModelSpec{DI: s.spec.DI}, false)
+	if err != nil {
+		m.mu.Lock()
+		if s.step == ReaddressWaitingForConfirm {
+			s.step = ReaddressWaitingForCard
+			s.candidate = nil
+		}
+		m.mu.Unlock()
+		return false
+	}
+	return !reflect.DeepEqual(state.DI, s.initialDI)
+}
+
+// readdressAssign writes the next address to the candidate, restarts it, and adds it as a card
+func (m *Manager) readdressAssign(s *readdressSession, pc *portClient) {
+	m.mu.Lock()
+	if s.step != ReaddressWaitingForConfirm {
+		m.mu.Unlock()
+		return
+	}
+	addr := s.nextAddr
+	candidate := *s.candidate
+	m.mu.Unlock()
+
+	if addr > 247 {
+		m.setReaddressError(s, "no free slave ID left")
+		return
+	}
+
+	if err := pc.writeSlaveID(factoryDefaultSlaveID, s.register, byte(addr)); err != nil {
+		m.setReaddressError(s, fmt.Sprintf("failed to write slave ID %d: %v", addr, err))
+		return
+	}
+	// The new address takes effect after a restart; the reboot itself may not be acknowledged
+	_ = pc.reboot(factoryDefaultSlaveID)
+
+	answered := false
+	for i := 0; i < readdressVerifyAttempts && !answered; i++ {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(m.readdressPoll):
+		}
+		spec := probeLayout(pc, byte(addr))
+		answered = spec.Name == candidate.Module
+	}
+	if !answered {
+		m.setReaddressError(s, fmt.Sprintf("card did not answer on slave ID %d after re-addressing", addr))
+		return
+	}
+
+	card, err := m.AddCard(s.port, byte(addr), candidate.Module)
+	if err != nil {
+		m.setReaddressError(s, fmt.Sprintf("failed to add card on slave ID %d: %v", addr, err))
+		return
+	}
+	assignment := config.SlaveAssignment{
+		Port:         s.port,
+		SlaveID:      addr,
+		Module:       candidate.Module,
+		SerialNumber: candidate.SerialNumber,
+		AssignedAt:   time.Now(),
+	}
+	if err := persistSlaveAssignment(assignment); err != nil {
+		log.Printf("re-addressing: failed to save assignment: %v", err)
+	}
+	log.Printf("re-addressing: %s (SN %s) is now slave ID %d (card %s)", candidate.Module, candidate.SerialNumber, addr, card.ID)
+
+	m.mu.Lock()
+	s.assigned = append(s.assigned, assignment)
+	s.nextAddr = m.nextFreeSlaveIDLocked(s.port, addr+1)
+	s.candidate = nil
+	s.lastError = ""
+	if s.step == ReaddressWaitingForConfirm {
+		s.step = ReaddressWaitingForCard
+	}
+	m.mu.Unlock()
+}
+
+// setReaddressError records a workflow error and goes back to waiting for a card
+func (m *Manager) setReaddressError(s *readdressSession, msg string) {
+	log.Printf("re-addressing: %s", msg)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.lastError = msg
+	if s.step != ReaddressStopped {
+		s.step = ReaddressWaitingForCard
+		s.candidate = nil
+	}
+}
+
+// persistSlaveAssignment saves an assignment, replacing an earlier one for the same port and address
+func persistSlaveAssignment(a config.SlaveAssignment) error {
+	return config.Update(func(c *config.Config) {
+		kept := make([]config.SlaveAssignment, 0, len(c.SlaveAssignments)+1)
+		for _, existing := range c.SlaveAssignments {
+			if existing.Port != a.Port || existing.SlaveID != a.SlaveID {
+				kept = append(kept, existing)
+			}
+		}
+		c.SlaveAssignments = append(kept, a)
+	})
+}
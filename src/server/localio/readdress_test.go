@@ -0,0 +1,124 @@
+package localio
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+
+	"github.com/goburrow/modbus"
+)
+
+const testSlaveIDRegister = 0x0030
+
+// addressableDevice simulates a single IO4040 that can be re-addressed via testSlaveIDRegister
+type addressableDevice struct {
+	handler *MockClientHandler
+	addr    byte
+	pending byte
+	di      atomic.Uint32 // Read by the readdressing goroutine
+}
+
+func (d *addressableDevice) client() *MockClient {
+	answer := func(quantity uint16) ([]byte, error) {
+		if d.handler.SlaveID != d.addr {
+			return nil, fmt.Errorf("timeout")
+		}
+		if quantity > 4 {
+			return nil, fmt.Errorf("illegal data address")
+		}
+		return []byte{byte(d.di.Load())}, nil
+	}
+	return &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return answer(quantity) },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return answer(quantity) },
+		ReadInputRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return nil, fmt.Errorf("illegal function")
+		},
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			if d.handler.SlaveID != d.addr || address == aoTypeRegAddr {
+				return nil, fmt.Errorf("illegal data address")
+			}
+			raw := make([]byte, quantity*2)
+			if address == 0x0070 {
+				copy(raw, "SN-42")
+			}
+			return raw, nil
+		},
+		WriteSingleRegisterFunc: func(address, value uint16) ([]byte, error) {
+			if d.handler.SlaveID != d.addr {
+				return nil, fmt.Errorf("timeout")
+			}
+			switch address {
+			case testSlaveIDRegister:
+				d.pending = byte(value)
+			case 0x0010:
+				d.addr = d.pending
+			}
+			return []byte{}, nil
+		},
+	}
+}
+
+func TestReaddressing(t *testing.T) {
+	configtest.Isolate(t)
+	config.Update(func(c *config.Config) { c.SlaveIDRegister = testSlaveIDRegister })
+
+	dev := &addressableDevice{handler: &MockClientHandler{}, addr: 1, pending: 1}
+	mgr := newMockManager(dev.client())
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) { return dev.handler, nil }
+	mgr.clientFactory = func(h modbus.ClientHandler) modbus.Client { return dev.client() }
+	mgr.readdressPoll = time.Millisecond
+
+	if err := mgr.StartReaddressing("/dev/ttyUSB0", 1); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected start address 1 to be rejected, got %v", err)
+	}
+	if err := mgr.StartReaddressing("/dev/ttyUSB0", 5); err != nil {
+		t.Fatalf("StartReaddressing failed: %v", err)
+	}
+	defer mgr.StopReaddressing()
+
+	waitForStep(t, mgr, ReaddressWaitingForConfirm)
+	st := mgr.ReaddressStatus()
+	if st.Candidate == nil || st.Candidate.Module != "IO4040" || st.Candidate.SerialNumber != "SN-42" {
+		t.Fatalf("Unexpected candidate: %+v", st.Candidate)
+	}
+
+	// The operator toggles DI0 to confirm
+	dev.di.Store(0x01)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mgr.ReaddressStatus().Assigned) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Card was not re-addressed: %+v", mgr.ReaddressStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st = mgr.ReaddressStatus()
+	if st.Assigned[0].SlaveID != 5 || st.NextAddress != 6 {
+		t.Errorf("Expected slave ID 5 assigned and next address 6, got %+v", st)
+	}
+	cards := mgr.GetAllCards()
+	if len(cards) != 1 || cards[0].SlaveID != 5 || cards[0].Module != "IO4040" {
+		t.Errorf("Expected IO4040 card on slave ID 5, got %+v", cards)
+	}
+	saved := config.GetConfig().SlaveAssignments
+	if len(saved) == 0 || saved[len(saved)-1].SerialNumber != "SN-42" {
+		t.Errorf("Expected assignment to be persisted, got %+v", saved)
+	}
+}
+
+func waitForStep(t *testing.T, mgr *Manager, step string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.ReaddressStatus().Step != step {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for step %s, status %+v", step, mgr.ReaddressStatus())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
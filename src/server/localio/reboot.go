@@ -0,0 +1,50 @@
+package localio
+
+import (
+	"log"
+	"time"
+)
+
+// rebootStagger is the pause between two card reboots of RebootAll, so the cards don't all draw their
+// inrush current and come back on the bus at the same time
+var rebootStagger = 500 * time.Millisecond
+
+// RebootResult is the outcome of rebooting one card
+type RebootResult struct {
+	CardID  string    `json:"cardId"`
+	Status  string    `json:"status"` // "ok" or "error"
+	Code    ErrorCode `json:"code,omitempty"`
+	Message string    `json:"message,omitempty"`
+	// Params are the parameters of the error message, for clients rendering a localized message
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// RebootAll reboots every managed card one after another, e.g. to apply a bus-wide baud rate change.
+// A reboot-progress event is emitted after each card; every card is fully read again once it answers.
+func (m *Manager) RebootAll() []RebootResult {
+	cards := m.GetAllCards()
+	results := make([]RebootResult, 0, len(cards))
+	for i, c := range cards {
+		if i > 0 {
+			time.Sleep(rebootStagger)
+		}
+
+		result := RebootResult{CardID: c.ID, Status: "ok"}
+		if err := m.RebootCard(c.ID); err != nil {
+			result.Status = "error"
+			result.Code = ErrorCodeOf(err)
+			result.Message = err.Error()
+			result.Params = ErrorParamsOf(err)
+			log.Printf("RebootAll: card %s: %v", c.ID, err)
+		}
+		results = append(results, result)
+
+		m.emitEvent(EventRebootProgress, c.ID, map[string]interface{}{
+			"done":    i + 1,
+			"total":   len(cards),
+			"status":  result.Status,
+			"message": result.Message,
+		})
+	}
+	return results
+}
@@ -0,0 +1,65 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestRebootAll(t *testing.T) {
+	configtest.Isolate(t)
+	defer func(d time.Duration) { rebootStagger = d }(rebootStagger)
+	rebootStagger = 0
+
+	reboots := 0
+	offline := false
+	client := &MockClient{
+		WriteSingleRegisterFunc: func(address, value uint16) ([]byte, error) {
+			reboots++
+			if reboots == 2 {
+				return nil, errorf(CodeBusTimeout, "timeout")
+			}
+			return []byte{}, nil
+		},
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			if offline {
+				return nil, errorf(CodeBusTimeout, "timeout")
+			}
+			return []byte{0x00}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	for slave := byte(1); slave <= 2; slave++ {
+		if _, err := mgr.AddCard("/dev/ttyUSB0", slave, "IO4040"); err != nil {
+			t.Fatalf("AddCard failed: %v", err)
+		}
+	}
+	var progress []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventRebootProgress {
+			progress = append(progress, ev)
+		}
+	})
+
+	results := mgr.RebootAll()
+	if len(results) != 2 || results[0].Status != "ok" || results[1].Code != CodeBusTimeout {
+		t.Fatalf("Expected card 1 ok and card 2 BUS_TIMEOUT, got %+v", results)
+	}
+	if len(progress) != 2 || progress[1].Data["done"] != 2 || progress[1].Data["total"] != 2 {
+		t.Errorf("Expected two progress events, got %+v", progress)
+	}
+
+	// The full read is kept until the rebooting card answers again
+	offline = true
+	mgr.ReadAllAndProcessWrites()
+	card, _ := mgr.GetCard(results[0].CardID)
+	if !card.needsFullRead {
+		t.Error("Expected the full read to be retried after a failed read")
+	}
+	offline = false
+	mgr.ReadAllAndProcessWrites()
+	if card.needsFullRead {
+		t.Error("Expected the full read to be done once the card answers")
+	}
+}
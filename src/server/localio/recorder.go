@@ -0,0 +1,368 @@
+package localio
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Recording entry kinds
+const (
+	recordKindState = "state"
+	recordKindWrite = "write"
+)
+
+// RecordEntry is one line of a recording file (JSON Lines)
+type RecordEntry struct {
+	Time   time.Time      `json:"time"`
+	Kind   string         `json:"kind"` // "state" or "write"
+	Cards  []*Card        `json:"cards,omitempty"`
+	Write  *RecordedWrite `json:"write,omitempty"`
+	Result *CommandResult `json:"result,omitempty"`
+}
+
+// RecordedWrite is a write operation as stored in a recording
+type RecordedWrite struct {
+	CardID string  `json:"cardId"`
+	Type   string  `json:"type"` // "write-do", "write-ao", "write-aotype"
+	Index  int     `json:"index"`
+	Value  float32 `json:"value,omitempty"`
+	Mode   string  `json:"mode,omitempty"`
+}
+
+// RecorderStatus reports the capture/replay state
+type RecorderStatus struct {
+	Recording      bool     `json:"recording"`
+	RecordFile     string   `json:"recordFile,omitempty"`
+	Replaying      bool     `json:"replaying"`
+	ReplayFile     string   `json:"replayFile,omitempty"`
+	ReplayFinished bool     `json:"replayFinished,omitempty"`
+	Files          []string `json:"files"`
+}
+
+// recorder writes card states and write commands to a recording file
+type recorder struct {
+	name      string
+	file      *os.File
+	w         *bufio.Writer
+	enc       *json.Encoder
+	lastCards map[string]CardState
+}
+
+// replayer feeds a recording back into the manager's card states
+type replayer struct {
+	name     string
+	stop     chan struct{}
+	added    []string // IDs of cards created for the replay
+	finished bool     // All entries replayed; the last state is held until StopReplay
+}
+
+// recordingsDir is where recordings are stored (next to config.yaml)
+func recordingsDir() string {
+	return filepath.Join(config.DataDir(), "recordings")
+}
+
+// recordingPath maps a recording name to its file, rejecting path components
+func recordingPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", errorf(CodeInvalidRequest, "invalid recording name %q", name)
+	}
+	return filepath.Join(recordingsDir(), name+".jsonl"), nil
+}
+
+// RecorderStatus returns the capture/replay state and the available recordings
+func (m *Manager) RecorderStatus() RecorderStatus {
+	m.mu.Lock()
+	st := RecorderStatus{Recording: m.rec != nil, Replaying: m.replay != nil}
+	if m.rec != nil {
+		st.RecordFile = m.rec.name
+	}
+	if m.replay != nil {
+		st.ReplayFile = m.replay.name
+		st.ReplayFinished = m.replay.finished
+	}
+	m.mu.Unlock()
+
+	st.Files = []string{}
+	entries, _ := os.ReadDir(recordingsDir())
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".jsonl") {
+			st.Files = append(st.Files, strings.TrimSuffix(e.Name(), ".jsonl"))
+		}
+	}
+	return st
+}
+
+// StartRecording starts capturing card states and write commands to the named recording
+func (m *Manager) StartRecording(name string) error {
+	path, err := recordingPath(name)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rec != nil {
+		return errorf(CodeConflict, "already recording to %s", m.rec.name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	m.rec = &recorder{
+		name:      name,
+		file:      f,
+		w:         w,
+		enc:       json.NewEncoder(w),
+		lastCards: make(map[string]CardState),
+	}
+	log.Printf("recording bus activity to %s", path)
+	return nil
+}
+
+// StopRecording stops the current capture and flushes the file
+func (m *Manager) StopRecording() error {
+	m.mu.Lock()
+	rec := m.rec
+	m.rec = nil
+	m.mu.Unlock()
+
+	if rec == nil {
+		return errorf(CodeConflict, "not recording")
+	}
+	if err := rec.w.Flush(); err != nil {
+		rec.file.Close()
+		return err
+	}
+	return rec.file.Close()
+}
+
+// recordStates appends a state entry if any card's state changed since the last recorded entry
+func (m *Manager) recordStates(cards []*Card) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rec == nil {
+		return
+	}
+
+	changed := false
+	for _, c := range cards {
+		prev, ok := m.rec.lastCards[c.ID]
+		cur := c.Last
+		// Timestamps and sequence numbers change every read; compare the values only
+		prev.Timestamp, cur.Timestamp = time.Time{}, time.Time{}
+		prev.LastGood, cur.LastGood = time.Time{}, time.Time{}
+		prev.Seq, cur.Seq = 0, 0
+		prev.MonotonicMs, cur.MonotonicMs = 0, 0
+		if !ok || !reflect.DeepEqual(prev, cur) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	snapshot := make([]*Card, len(cards))
+	for i, c := range cards {
+		copied := *c
+		snapshot[i] = &copied
+		m.rec.lastCards[c.ID] = c.Last
+	}
+	if err := m.rec.enc.Encode(RecordEntry{Time: time.Now(), Kind: recordKindState, Cards: snapshot}); err != nil {
+		log.Printf("recorder: write error: %v", err)
+	}
+}
+
+// recordWrites appends the executed write operations with their results
+func (m *Manager) recordWrites(ops []writeOperation, results []CommandResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rec == nil {
+		return
+	}
+
+	now := time.Now()
+	for i, op := range ops {
+		w := &RecordedWrite{CardID: op.CardID, Type: writeOpName(op.Type), Index: op.Index}
+		if op.Type == writeOpAOType {
+			w.Mode = op.Mode
+		} else {
+			w.Value = op.Value
+		}
+		result := results[i]
+		if err := m.rec.enc.Encode(RecordEntry{Time: now, Kind: recordKindWrite, Write: w, Result: &result}); err != nil {
+			log.Printf("recorder: write error: %v", err)
+		}
+	}
+}
+
+// StartReplay feeds a recording back as the live card state. While replaying, bus reads are
+// suspended and the recorded states are published to HTTP and TCP clients with their original
+// timing (scaled by speed; 0 or 1 = real time). Recorded writes are not re-executed, and output
+// writes are rejected with CONFLICT until StopReplay: the writes still queued are dropped.
+// The last recorded state is held after the replay ends until StopReplay is called.
+func (m *Manager) StartReplay(name string, speed float64) error {
+	path, err := recordingPath(name)
+	if err != nil {
+		return err
+	}
+	entries, err := loadRecording(path)
+	if err != nil {
+		return err
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+
+	m.mu.Lock()
+	if m.replay != nil {
+		m.mu.Unlock()
+		return errorf(CodeConflict, "already replaying %s", m.replay.name)
+	}
+	rp := &replayer{name: name, stop: make(chan struct{})}
+	m.replay = rp
+	dropped := m.writeQueue
+	m.writeQueue = nil
+	for _, op := range dropped {
+		m.dropOptimisticLocked(op)
+	}
+	conflict := m.replayConflictLocked()
+	m.mu.Unlock()
+
+	results := make([]CommandResult, len(dropped))
+	for i := range dropped {
+		results[i] = errorResultOf(i, conflict)
+	}
+	m.emitWriteExecuted(dropped, results)
+
+	log.Printf("replaying recording %s (%d entries, speed %.1fx)", name, len(entries), speed)
+	go m.runReplay(rp, entries, speed)
+	return nil
+}
+
+// StopReplay stops a running replay and resumes bus reads
+func (m *Manager) StopReplay() error {
+	m.mu.Lock()
+	rp := m.replay
+	if rp == nil {
+		m.mu.Unlock()
+		return errorf(CodeConflict, "not replaying")
+	}
+	close(rp.stop)
+	m.replay = nil
+	for _, id := range rp.added {
+		delete(m.cards, id)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// isReplaying reports whether live card state currently comes from a recording
+func (m *Manager) isReplaying() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.replay != nil
+}
+
+// replayConflict returns the error of an output write while a replay is active (nil if none)
+func (m *Manager) replayConflict() *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.replayConflictLocked()
+}
+
+// replayConflictLocked is replayConflict for a caller holding m.mu
+func (m *Manager) replayConflictLocked() *Error {
+	if m.replay == nil {
+		return nil
+	}
+	return errorf(CodeConflict, "replaying %s: output writes are suspended", m.replay.name)
+}
+
+func loadRecording(path string) ([]RecordEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, errorf(CodeNotFound, "recording %s not found", strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []RecordEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e RecordEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, errorf(CodeInvalidRequest, "invalid recording entry: %v", err)
+		}
+		if e.Kind == recordKindState {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errorf(CodeInvalidRequest, "recording has no card states")
+	}
+	return entries, nil
+}
+
+func (m *Manager) runReplay(rp *replayer, entries []RecordEntry, speed float64) {
+	start := entries[0].Time
+	began := time.Now()
+
+	for _, e := range entries {
+		due := began.Add(time.Duration(float64(e.Time.Sub(start)) / speed))
+		select {
+		case <-rp.stop:
+			return
+		case <-time.After(time.Until(due)):
+		}
+
+		m.mu.Lock()
+		if m.replay != rp {
+			m.mu.Unlock()
+			return
+		}
+		for _, rc := range e.Cards {
+			c, ok := m.cards[rc.ID]
+			if !ok {
+				c = &Card{ID: rc.ID, PortPath: rc.PortPath, SlaveID: rc.SlaveID, Module: rc.Module}
+				c.Capabilities = cardCapabilities(cardDriver(c), cardSpec(c))
+				m.cards[rc.ID] = c
+				rp.added = append(rp.added, rc.ID)
+			}
+			c.Last = rc.Last
+			m.stampLocked(&c.Last)
+		}
+		callback := m.stateChangeCallback
+		m.mu.Unlock()
+
+		if callback != nil {
+			callback(m.GetAllCards())
+		}
+	}
+
+	log.Printf("replay of %s finished", rp.name)
+	m.mu.Lock()
+	rp.finished = true
+	m.mu.Unlock()
+}
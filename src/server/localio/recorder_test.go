@@ -0,0 +1,116 @@
+package localio
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	configtest.Isolate(t)
+
+	var coilWrites atomic.Int32
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x05}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			coilWrites.Add(1)
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.StartRecording("../escape"); err == nil {
+		t.Error("Expected invalid recording name to be rejected")
+	}
+	if err := mgr.StartRecording("session"); err != nil {
+		t.Fatalf("StartRecording failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	mgr.ReadAllAndProcessWrites() // unchanged state is not recorded again
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 1}})
+	if err := mgr.StopRecording(); err != nil {
+		t.Fatalf("StopRecording failed: %v", err)
+	}
+
+	path, _ := recordingPath("session")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Recording file missing: %v", err)
+	}
+	defer f.Close()
+	var kinds []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e RecordEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid entry: %v", err)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	if len(kinds) != 2 || kinds[0] != recordKindState || kinds[1] != recordKindWrite {
+		t.Fatalf("Expected [state write] entries, got %v", kinds)
+	}
+
+	// Replay into a manager without any cards
+	replayMgr := newMockManager(client)
+	if err := replayMgr.StartReplay("session", 100); err != nil {
+		t.Fatalf("StartReplay failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !replayMgr.RecorderStatus().ReplayFinished && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cards := replayMgr.ReadAllAndProcessWrites()
+	if len(cards) != 1 || cards[0].Module != "IO4040" || !cards[0].Last.DI[0] || !cards[0].Last.DI[2] {
+		t.Fatalf("Expected replayed IO4040 card with DI0/DI2 high, got %+v", cards)
+	}
+
+	if err := replayMgr.StopReplay(); err != nil {
+		t.Fatalf("StopReplay failed: %v", err)
+	}
+	if len(replayMgr.GetAllCards()) != 0 {
+		t.Error("Expected replayed cards to be removed after StopReplay")
+	}
+
+	// Output writes are rejected while replaying; the writes still queued are dropped
+	if err := mgr.QueueWriteDO(card.ID, 2, true); err != nil {
+		t.Fatalf("QueueWriteDO failed: %v", err)
+	}
+	if err := mgr.StartReplay("session", 100); err != nil {
+		t.Fatalf("StartReplay failed: %v", err)
+	}
+	if pending := mgr.GetPendingWrites(); len(pending) != 0 {
+		t.Errorf("Expected the queued write dropped, got %+v", pending)
+	}
+	if err := mgr.QueueWriteDO(card.ID, 2, true); ErrorCodeOf(err) != CodeConflict {
+		t.Errorf("Expected CONFLICT queueing a write while replaying, got %v", err)
+	}
+	writes := coilWrites.Load()
+	results := mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpDO, Index: 2, Value: 1}})
+	if results[0].Code != CodeConflict || coilWrites.Load() != writes {
+		t.Errorf("Expected the write rejected while replaying, got %+v", results[0])
+	}
+	if err := mgr.StopReplay(); err != nil {
+		t.Fatalf("StopReplay failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if coilWrites.Load() != writes {
+		t.Error("Expected no write on the bus after StopReplay")
+	}
+	if err := mgr.QueueWriteDO(card.ID, 2, true); err != nil {
+		t.Errorf("Expected writes accepted after StopReplay, got %v", err)
+	}
+}
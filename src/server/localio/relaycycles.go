@@ -0,0 +1,195 @@
+package localio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// relayCyclesFile is the file in the data directory the DO transition counts are persisted to
+const relayCyclesFile = "relay-cycles.json"
+
+// relayCyclesSaveInterval is the minimum time between two saves of changed counts
+const relayCyclesSaveInterval = time.Minute
+
+// RelayCycles is the number of switching operations of a DO channel
+type RelayCycles struct {
+	CardID      string `json:"cardId"`
+	Channel     string `json:"channel"`
+	Transitions uint64 `json:"transitions"`
+	Limit       uint64 `json:"limit,omitempty"`
+	// Worn is set once Transitions reached Limit
+	Worn bool `json:"worn,omitempty"`
+}
+
+// relayCounter counts the DO transitions seen by the reads of each card
+type relayCounter struct {
+	counts  map[string][]uint64 // Transitions per DO channel by card key (see relayKey)
+	lastDO  map[string][]bool   // DO state of the last read by card ID
+	dirty   bool                // counts changed since the last save
+	savedAt time.Time
+}
+
+func relayCyclesPath() string {
+	return filepath.Join(config.DataDir(), relayCyclesFile)
+}
+
+// loadRelayCycles reads the persisted transition counts (empty if there are none)
+func loadRelayCycles() relayCounter {
+	r := relayCounter{counts: make(map[string][]uint64), lastDO: make(map[string][]bool), savedAt: time.Now()}
+	data, err := os.ReadFile(relayCyclesPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("relay cycles not loaded: %v", err)
+		}
+		return r
+	}
+	if err := json.Unmarshal(data, &r.counts); err != nil {
+		log.Printf("relay cycles not loaded: %v", err)
+		r.counts = make(map[string][]uint64)
+	}
+	return r
+}
+
+// relayKey identifies the physical card the counts belong to: its serial number, or port and slave ID
+// for cards without one. Card IDs are not stable across rediscovery.
+func relayKey(c *Card) string {
+	if c.Last.SerialNumber != "" {
+		return "sn:" + c.Last.SerialNumber
+	}
+	return fmt.Sprintf("%s#%d", c.PortPath, c.SlaveID)
+}
+
+// countRelayCycles counts the DO transitions between the last and the current read of a card. Counts
+// reaching the relay_wear_limit emit a relay-wear event; changed counts are saved at most once per
+// relayCyclesSaveInterval.
+func (m *Manager) countRelayCycles(c *Card, do []bool) {
+	now := time.Now()
+	var worn []int
+
+	m.mu.Lock()
+	prev := m.relays.lastDO[c.ID]
+	m.relays.lastDO[c.ID] = do
+	if len(prev) == len(do) {
+		key := relayKey(c)
+		counts := m.relays.counts[key]
+		for len(counts) < len(do) {
+			counts = append(counts, 0)
+		}
+		for i := range do {
+			if do[i] == prev[i] {
+				continue
+			}
+			counts[i]++
+			m.relays.dirty = true
+			if m.relayWearLimit > 0 && counts[i] == m.relayWearLimit {
+				worn = append(worn, i)
+			}
+		}
+		m.relays.counts[key] = counts
+	}
+	save := m.relays.dirty && now.Sub(m.relays.savedAt) >= relayCyclesSaveInterval
+	limit := m.relayWearLimit
+	m.mu.Unlock()
+
+	for _, i := range worn {
+		m.emitEvent(EventRelayWear, c.ID, map[string]interface{}{
+			"channel":     "do" + strconv.Itoa(i),
+			"transitions": limit,
+			"limit":       limit,
+		})
+	}
+	if save {
+		m.saveRelayCycles()
+	}
+}
+
+// saveRelayCycles persists the transition counts if they changed
+func (m *Manager) saveRelayCycles() {
+	m.mu.Lock()
+	if !m.relays.dirty {
+		m.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(m.relays.counts)
+	m.relays.dirty = false
+	m.relays.savedAt = time.Now()
+	m.mu.Unlock()
+
+	if err == nil {
+		path := relayCyclesPath()
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("relay cycles not saved: %v", err)
+	}
+}
+
+// GetRelayCycles returns the transition counts of every DO channel of every card
+func (m *Manager) GetRelayCycles() []RelayCycles {
+	cards := m.GetAllCards()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []RelayCycles{}
+	for _, c := range cards {
+		counts := m.relays.counts[relayKey(c)]
+		for i := 0; i < cardSpec(c).DO; i++ {
+			rc := RelayCycles{CardID: c.ID, Channel: "do" + strconv.Itoa(i), Limit: m.relayWearLimit}
+			if i < len(counts) {
+				rc.Transitions = counts[i]
+			}
+			rc.Worn = rc.Limit > 0 && rc.Transitions >= rc.Limit
+			out = append(out, rc)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		idi, _ := strconv.Atoi(out[i].CardID)
+		idj, _ := strconv.Atoi(out[j].CardID)
+		return idi < idj
+	})
+	return out
+}
+
+// ResetRelayCycles clears the transition count of a DO channel of a card after its relay was replaced.
+// An empty channel resets all channels of the card.
+func (m *Manager) ResetRelayCycles(cardID, channel string) error {
+	c, ok := m.GetCard(cardID)
+	if !ok {
+		return errorf(CodeCardNotFound, "card %s not found", cardID).with("cardId", cardID)
+	}
+	index := -1
+	if channel != "" {
+		n, err := strconv.Atoi(channel[min(2, len(channel)):])
+		if len(channel) < 3 || channel[:2] != "do" || err != nil {
+			return errorf(CodeInvalidRequest, "invalid channel %q (use do<n>, e.g. do0)", channel)
+		}
+		if n < 0 || n >= cardSpec(c).DO {
+			return errorf(CodeIndexOutOfRange, "DO index %d out of range", n).with("channel", channel)
+		}
+		index = n
+	}
+
+	m.mu.Lock()
+	key := relayKey(c)
+	if index < 0 {
+		delete(m.relays.counts, key)
+	} else if index < len(m.relays.counts[key]) {
+		m.relays.counts[key][index] = 0
+	}
+	m.relays.dirty = true
+	m.mu.Unlock()
+
+	m.saveRelayCycles()
+	return nil
+}
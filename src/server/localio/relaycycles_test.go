@@ -0,0 +1,62 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestRelayCycles(t *testing.T) {
+	configtest.Isolate(t)
+
+	coils := byte(0x00)
+	client := &MockClient{
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) {
+			return []byte{coils}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.relayWearLimit = 3
+	var events []Event
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.AddEventListener(func(ev Event) { events = append(events, ev) })
+
+	// DO0 switches on, off, on; DO1 switches on once
+	for _, c := range []byte{0x00, 0x01, 0x00, 0x03} {
+		coils = c
+		mgr.ReadAllAndProcessWrites()
+	}
+	relays := mgr.GetRelayCycles()
+	if len(relays) != 4 || relays[0].Transitions != 3 || !relays[0].Worn || relays[1].Transitions != 1 || relays[1].Worn {
+		t.Fatalf("Expected DO0 worn after 3 transitions and DO1 at 1, got %+v", relays)
+	}
+	if len(events) != 1 || events[0].Type != EventRelayWear || events[0].Data["channel"] != "do0" {
+		t.Errorf("Expected one relay-wear event for do0, got %+v", events)
+	}
+
+	// Counts survive a restart
+	mgr.StopCycle()
+	restarted := newMockManager(client)
+	if _, err := restarted.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if relays := restarted.GetRelayCycles(); relays[0].Transitions != 3 || relays[1].Transitions != 1 {
+		t.Errorf("Expected the persisted counts, got %+v", relays)
+	}
+
+	if err := restarted.ResetRelayCycles(card.ID, "di0"); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a DI channel, got %v", err)
+	}
+	if err := restarted.ResetRelayCycles(card.ID, "do9"); ErrorCodeOf(err) != CodeIndexOutOfRange {
+		t.Errorf("Expected INDEX_OUT_OF_RANGE, got %v", err)
+	}
+	if err := restarted.ResetRelayCycles(card.ID, "do0"); err != nil {
+		t.Fatalf("ResetRelayCycles failed: %v", err)
+	}
+	if relays := restarted.GetRelayCycles(); relays[0].Transitions != 0 || relays[1].Transitions != 1 {
+		t.Errorf("Expected only DO0 reset, got %+v", relays)
+	}
+}
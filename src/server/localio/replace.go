@@ -0,0 +1,189 @@
+package localio
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// replacementsFile is the file in the data directory the completed card replacements are persisted to
+const replacementsFile = "replacements.json"
+
+// CardReplacement is the swap of a card for a new one at the same port and slave ID. It links the serial
+// numbers, so the history recorded under the old serial number can be followed to the new card.
+type CardReplacement struct {
+	CardID    string `json:"cardId"`
+	PortPath  string `json:"portPath"`
+	SlaveID   byte   `json:"slaveId"`
+	OldSerial string `json:"oldSerial"`
+	// ExpectedSerial restricts the new card to this serial number ("" = any other than OldSerial)
+	ExpectedSerial string    `json:"expectedSerial,omitempty"`
+	NewSerial      string    `json:"newSerial,omitempty"`
+	Since          time.Time `json:"since"`
+	// Completed is set once the new card answered
+	Completed time.Time `json:"completed,omitempty"`
+}
+
+func replacementsPath() string {
+	return filepath.Join(config.DataDir(), replacementsFile)
+}
+
+// loadReplacements reads the persisted replacements (empty if there are none)
+func loadReplacements() []CardReplacement {
+	var r []CardReplacement
+	data, err := os.ReadFile(replacementsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("card replacements not loaded: %v", err)
+		}
+		return r
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		log.Printf("card replacements not loaded: %v", err)
+		return nil
+	}
+	return r
+}
+
+// saveReplacements persists the completed replacements
+func (m *Manager) saveReplacements() {
+	m.mu.Lock()
+	data, err := json.Marshal(m.replacements)
+	m.mu.Unlock()
+
+	if err == nil {
+		path := replacementsPath()
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("card replacements not saved: %v", err)
+	}
+}
+
+// BeginReplace marks a card as being replaced. While it is, the card isn't reported offline and the first
+// other serial number read at its port and slave ID is accepted as the new card (instead of being checked
+// for a slave ID conflict). The new card takes over the points, output runtimes and persisted output values
+// of the old one. If expected is given, only a card with that serial number is accepted.
+func (m *Manager) BeginReplace(cardID, expected string) (*CardReplacement, error) {
+	c, ok := m.GetCard(cardID)
+	if !ok {
+		return nil, errorf(CodeCardNotFound, "card %s not found", cardID).with("cardId", cardID)
+	}
+	if _, ok := cardDriver(c).(SerialNumberReader); !ok {
+		return nil, errorf(CodeInvalidRequest, "card %s doesn't report a serial number", cardID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case c.Replacing != nil:
+		return nil, errorf(CodeConflict, "card %s is already being replaced", cardID)
+	case c.Last.SerialNumber == "":
+		return nil, errorf(CodeConflict, "card %s has no known serial number yet", cardID)
+	case expected == c.Last.SerialNumber:
+		return nil, errorf(CodeInvalidRequest, "serial number %s is the card being replaced", expected)
+	}
+	c.Replacing = &CardReplacement{
+		CardID:         c.ID,
+		PortPath:       c.PortPath,
+		SlaveID:        c.SlaveID,
+		OldSerial:      c.Last.SerialNumber,
+		ExpectedSerial: expected,
+		Since:          time.Now(),
+	}
+	// The old card's outage is expected now; the new card gets a full read (AO types, serial number)
+	c.offline = false
+	c.pendingSerial = ""
+	c.serialMatches = 0
+	c.needsFullRead = true
+	r := *c.Replacing
+	log.Printf("card %s: being replaced (SN %s)", c.ID, r.OldSerial)
+	return &r, nil
+}
+
+// CancelReplace ends the replacement of a card before a new card answered
+func (m *Manager) CancelReplace(cardID string) error {
+	c, ok := m.GetCard(cardID)
+	if !ok {
+		return errorf(CodeCardNotFound, "card %s not found", cardID).with("cardId", cardID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c.Replacing == nil {
+		return errorf(CodeConflict, "card %s is not being replaced", cardID)
+	}
+	c.Replacing = nil
+	log.Printf("card %s: replacement cancelled", c.ID)
+	return nil
+}
+
+// GetReplacements returns the completed card replacements, oldest first, followed by the pending ones
+func (m *Manager) GetReplacements() []CardReplacement {
+	cards := m.GetAllCards()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := append([]CardReplacement{}, m.replacements...)
+	for _, c := range cards {
+		if c.Replacing != nil {
+			out = append(out, *c.Replacing)
+		}
+	}
+	return out
+}
+
+// completeReplacement hands the data kept under the old serial number of a replaced card over to the new
+// one. Relay cycle counts and commissioning checks stay with the old card: they describe its hardware.
+func (m *Manager) completeReplacement(c *Card, r CardReplacement) {
+	oldKey, newKey := "sn:"+r.OldSerial, "sn:"+r.NewSerial
+
+	m.mu.Lock()
+	if seconds, ok := m.runtime.seconds[oldKey]; ok {
+		m.runtime.seconds[newKey] = seconds
+		delete(m.runtime.seconds, oldKey)
+		m.runtime.dirty = true
+	}
+	if values, ok := m.outputs.values[oldKey]; ok {
+		m.outputs.values[newKey] = values
+		delete(m.outputs.values, oldKey)
+		m.outputs.dirty = true
+	}
+	m.replacements = append(m.replacements, r)
+	m.mu.Unlock()
+
+	m.saveRuntime()
+	m.saveOutputs()
+	m.saveReplacements()
+
+	moved := 0
+	err := config.Update(func(cfg *config.Config) {
+		for i := range cfg.Points {
+			if cfg.Points[i].Serial == r.OldSerial {
+				cfg.Points[i].Serial = r.NewSerial
+				moved++
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("card %s: points not moved to the new card: %v", c.ID, err)
+	} else {
+		m.mu.Lock()
+		m.points = config.GetConfig().Points
+		m.mu.Unlock()
+	}
+
+	log.Printf("card %s: replaced, serial number %s -> %s (%d points moved)", c.ID, r.OldSerial, r.NewSerial, moved)
+	m.emitEvent(EventCardReplaced, c.ID, map[string]interface{}{
+		"portPath":  r.PortPath,
+		"slaveId":   r.SlaveID,
+		"oldSerial": r.OldSerial,
+		"newSerial": r.NewSerial,
+	})
+}
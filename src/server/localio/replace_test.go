@@ -0,0 +1,81 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestReplaceCard(t *testing.T) {
+	configtest.Isolate(t)
+
+	serials := []string{"SN-A"}
+	mgr := newMockManager(serialClient(&serials))
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	pc, _ := mgr.ensurePort(card.PortPath)
+	var events []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventCardReplaced {
+			events = append(events, ev)
+		}
+	})
+	if err := mgr.SetPoints([]config.Point{{Serial: "SN-A", Channel: "do0", Name: "pump", SafeState: "off"}}); err != nil {
+		t.Fatalf("SetPoints failed: %v", err)
+	}
+	mgr.mu.Lock()
+	mgr.runtime.seconds["sn:SN-A"] = map[string]float64{"do0": 3600}
+	card.offline = true
+	mgr.mu.Unlock()
+
+	if _, err := mgr.BeginReplace(card.ID, "SN-A"); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Fatalf("Expected INVALID_REQUEST for the old serial number, got %v", err)
+	}
+	if _, err := mgr.BeginReplace(card.ID, "SN-C"); err != nil {
+		t.Fatalf("BeginReplace failed: %v", err)
+	}
+	if _, err := mgr.BeginReplace(card.ID, ""); ErrorCodeOf(err) != CodeConflict {
+		t.Errorf("Expected CONFLICT while being replaced, got %v", err)
+	}
+	if mgr.Offline(card.ID) {
+		t.Error("Expected the offline state cleared")
+	}
+
+	// Another card than the expected one is not accepted, the expected one at once
+	now := time.Now()
+	serials = []string{"SN-B"}
+	mgr.checkSerialNumber(card, pc, now)
+	if card.Replacing == nil || card.Last.SerialNumber != "SN-A" {
+		t.Fatalf("Expected SN-B ignored, got %+v", card.Replacing)
+	}
+	serials = []string{"SN-C"}
+	mgr.checkSerialNumber(card, pc, now)
+	if card.Replacing != nil || card.Last.SerialNumber != "SN-C" || card.Conflict != "" {
+		t.Fatalf("Expected SN-C accepted, got serial %s, replacing %+v, conflict %q", card.Last.SerialNumber, card.Replacing, card.Conflict)
+	}
+	if len(events) != 1 || events[0].Data["oldSerial"] != "SN-A" || events[0].Data["newSerial"] != "SN-C" {
+		t.Errorf("Expected a card-replaced event, got %+v", events)
+	}
+
+	// The new card has the old one's points and runtimes
+	if pts := mgr.GetPoints(); len(pts) != 1 || pts[0].Serial != "SN-C" || pts[0].CardID != card.ID || pts[0].SafeState != "off" {
+		t.Errorf("Expected the point moved to SN-C, got %+v", pts)
+	}
+	if rt := mgr.GetRuntimes(); rt[0].Hours != 1 {
+		t.Errorf("Expected the runtime carried over, got %+v", rt[0])
+	}
+	if r := mgr.GetReplacements(); len(r) != 1 || r[0].NewSerial != "SN-C" || r[0].Completed.IsZero() {
+		t.Errorf("Expected the completed replacement, got %+v", r)
+	}
+	if r := loadReplacements(); len(r) != 1 {
+		t.Errorf("Expected the replacement persisted, got %+v", r)
+	}
+
+	if err := mgr.CancelReplace(card.ID); ErrorCodeOf(err) != CodeConflict {
+		t.Errorf("Expected CONFLICT without a replacement, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package localio
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// RollbackConfig restores a configuration version (see config.Rollback) and activates its PID loops, alarm
+// rules, notifications, interlocks, write permissions, points, DO timings, AO slew rates, heartbeat output,
+// channel lists, sequences, schedules, calendar, location and scripts. Settings and the other values read at
+// startup take effect after a restart.
+func (m *Manager) RollbackConfig(version int) error {
+	return m.RollbackConfigContext(context.Background(), version)
+}
+
+// RollbackConfigContext is RollbackConfig with the change attributed in the config history to the change of
+// ctx (see config.WithChange)
+func (m *Manager) RollbackConfigContext(ctx context.Context, version int) error {
+	if err := config.RollbackContext(ctx, version); errors.Is(err, config.ErrVersionNotFound) {
+		return errorf(CodeNotFound, "config version %d not found", version)
+	} else if err != nil {
+		return errorf(CodeInternal, "rollback failed: %v", err)
+	}
+	cfg := config.GetConfig()
+	LogConfigProblems(m.ValidateConfig(cfg))
+	m.activateConfig(cfg)
+	log.Printf("config rolled back to version %d", version)
+	return nil
+}
+
+// activateConfig replaces the rules and channel lists in effect by those of cfg
+func (m *Manager) activateConfig(cfg config.Config) {
+	m.mu.Lock()
+	m.pidLoops = newPIDLoops(cfg.PIDLoops)
+	m.loadAlarmsLocked(cfg.Alarms)
+	m.notifications = cfg.Notifications
+	m.maintenance = cfg.MaintenanceWindows
+	m.interlocks = cfg.Interlocks
+	m.writePermissions = cfg.WritePermissions
+	m.points = cfg.Points
+	m.doTimings = cfg.DOTimings
+	m.slewRates = cfg.AOSlewRates
+	if m.heartbeat != cfg.HeartbeatOutput {
+		m.heartbeat = cfg.HeartbeatOutput
+		m.hb = heartbeatState{}
+	}
+	m.disabled = cfg.DisabledChannels
+	m.priority = cfg.PriorityChannels
+	m.pulse = cfg.PulseChannels
+	m.currentLoop = cfg.CurrentLoopInputs
+	m.sequences = cfg.Sequences
+	m.schedules = cfg.Schedules
+	m.calendar = cfg.Calendar
+	m.location = cfg.Location
+	m.mu.Unlock()
+
+	if scripts, err := m.loadScripts(cfg.Scripts); err != nil {
+		log.Printf("scripts not restarted: %v", err)
+	} else {
+		m.replaceScripts(scripts)
+	}
+}
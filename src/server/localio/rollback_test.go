@@ -0,0 +1,49 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestRollbackConfig(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if err := mgr.SetDOTimings([]config.DOTiming{{Card: card.ID, Index: 0, MinOnMs: 1000}}); err != nil {
+		t.Fatalf("SetDOTimings failed: %v", err)
+	}
+	versions, err := config.History()
+	if err != nil || len(versions) == 0 {
+		t.Fatalf("Expected the change in the config history, got %+v, %v", versions, err)
+	}
+	good := versions[0].Version
+
+	// A bad change is undone, and the restored rules are active right away
+	if err := mgr.SetDOTimings([]config.DOTiming{{Card: card.ID, Index: 0, MinOnMs: 60000}}); err != nil {
+		t.Fatalf("SetDOTimings failed: %v", err)
+	}
+	if err := mgr.SetAlarmRules([]config.AlarmRule{{Name: "comms", Card: card.ID}}); err != nil {
+		t.Fatalf("SetAlarmRules failed: %v", err)
+	}
+	if err := mgr.RollbackConfig(good); err != nil {
+		t.Fatalf("RollbackConfig failed: %v", err)
+	}
+	if rules := mgr.GetDOTimings(); len(rules) != 1 || rules[0].MinOnMs != 1000 {
+		t.Errorf("Expected the restored DO timing, got %+v", rules)
+	}
+	if rules := mgr.GetAlarmRules(); len(rules) != 0 {
+		t.Errorf("Expected no alarm rules after the rollback, got %+v", rules)
+	}
+	if c := config.GetConfig(); len(c.DOTimings) != 1 || c.DOTimings[0].MinOnMs != 1000 || len(c.Alarms) != 0 {
+		t.Errorf("Expected the restored config persisted, got %+v", c)
+	}
+	if err := mgr.RollbackConfig(9999); ErrorCodeOf(err) != CodeNotFound {
+		t.Errorf("Expected NOT_FOUND for an unknown version, got %v", err)
+	}
+}
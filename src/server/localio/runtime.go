@@ -0,0 +1,211 @@
+package localio
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// runtimeFile is the file in the data directory the output runtimes are persisted to
+const runtimeFile = "runtime.json"
+
+// runtimeSaveInterval is the minimum time between two saves of changed runtimes
+const runtimeSaveInterval = time.Minute
+
+// runtimeMaxGap is the longest time between two reads of a card that is counted. The outputs of a card
+// that wasn't read for longer (read errors, stopped cycle) may have changed unseen.
+const runtimeMaxGap = 30 * time.Second
+
+// OutputRuntime is the accumulated running time of an output channel: on-time of a DO, time above the
+// ao_runtime_threshold of an AO
+type OutputRuntime struct {
+	CardID  string  `json:"cardId"`
+	Channel string  `json:"channel"`
+	Hours   float64 `json:"hours"`
+	Running bool    `json:"running"`
+}
+
+// runtimeSample is the running outputs of a card's last read
+type runtimeSample struct {
+	at      time.Time
+	running []string // Channel keys
+}
+
+// runtimeCounter accumulates the running time of the outputs seen by the reads of each card
+type runtimeCounter struct {
+	seconds  map[string]map[string]float64 // Running seconds by card key (see relayKey) and channel key
+	lastRead map[string]runtimeSample      // Last read by card ID
+	dirty    bool                          // seconds changed since the last save
+	savedAt  time.Time
+}
+
+func runtimePath() string {
+	return filepath.Join(config.DataDir(), runtimeFile)
+}
+
+// loadRuntime reads the persisted runtimes (empty if there are none)
+func loadRuntime() runtimeCounter {
+	r := runtimeCounter{seconds: make(map[string]map[string]float64), lastRead: make(map[string]runtimeSample), savedAt: time.Now()}
+	data, err := os.ReadFile(runtimePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("output runtimes not loaded: %v", err)
+		}
+		return r
+	}
+	if err := json.Unmarshal(data, &r.seconds); err != nil {
+		log.Printf("output runtimes not loaded: %v", err)
+		r.seconds = make(map[string]map[string]float64)
+	}
+	return r
+}
+
+// runningOutputs returns the channel keys of the DOs that are on and the AOs above threshold (raw units)
+// over the bottom of their range, 0 V or 4 mA
+func runningOutputs(state CardState, threshold float32) []string {
+	var running []string
+	for i, on := range state.DO {
+		if on {
+			running = append(running, ChannelKey(writeOpDO, i))
+		}
+	}
+	for i, v := range state.AO {
+		zero := float32(0)
+		if i < len(state.AOType) && state.AOType[i] == "4-20mA" {
+			zero = 4000
+		}
+		if v > zero+threshold {
+			running = append(running, ChannelKey(writeOpAO, i))
+		}
+	}
+	return running
+}
+
+// countRuntime adds the time since the last read of a card to the outputs that were running then. Changed
+// runtimes are saved at most once per runtimeSaveInterval.
+func (m *Manager) countRuntime(c *Card, state CardState) {
+	now := time.Now()
+
+	m.mu.Lock()
+	prev, ok := m.runtime.lastRead[c.ID]
+	m.runtime.lastRead[c.ID] = runtimeSample{at: now, running: runningOutputs(state, m.aoRuntimeThreshold)}
+	if dt := now.Sub(prev.at); ok && dt <= runtimeMaxGap && len(prev.running) > 0 {
+		key := relayKey(c)
+		seconds := m.runtime.seconds[key]
+		if seconds == nil {
+			seconds = make(map[string]float64)
+			m.runtime.seconds[key] = seconds
+		}
+		for _, ch := range prev.running {
+			seconds[ch] += dt.Seconds()
+		}
+		m.runtime.dirty = true
+	}
+	save := m.runtime.dirty && now.Sub(m.runtime.savedAt) >= runtimeSaveInterval
+	m.mu.Unlock()
+
+	if save {
+		m.saveRuntime()
+	}
+}
+
+// saveRuntime persists the runtimes if they changed
+func (m *Manager) saveRuntime() {
+	m.mu.Lock()
+	if !m.runtime.dirty {
+		m.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(m.runtime.seconds)
+	m.runtime.dirty = false
+	m.runtime.savedAt = time.Now()
+	m.mu.Unlock()
+
+	if err == nil {
+		path := runtimePath()
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("output runtimes not saved: %v", err)
+	}
+}
+
+// GetRuntimes returns the running time of every DO and AO channel of every card
+func (m *Manager) GetRuntimes() []OutputRuntime {
+	cards := m.GetAllCards()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []OutputRuntime{}
+	for _, c := range cards {
+		seconds := m.runtime.seconds[relayKey(c)]
+		running := m.runtime.lastRead[c.ID].running
+		spec := cardSpec(c)
+		for _, ch := range []struct {
+			t writeOpType
+			n int
+		}{{writeOpDO, spec.DO}, {writeOpAO, spec.AO}} {
+			for i := 0; i < ch.n; i++ {
+				key := ChannelKey(ch.t, i)
+				out = append(out, OutputRuntime{
+					CardID:  c.ID,
+					Channel: key,
+					Hours:   seconds[key] / 3600,
+					Running: slices.Contains(running, key),
+				})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		idi, _ := strconv.Atoi(out[i].CardID)
+		idj, _ := strconv.Atoi(out[j].CardID)
+		return idi < idj
+	})
+	return out
+}
+
+// ResetRuntime clears the running time of an output channel of a card, e.g. after servicing the pump it
+// drives. An empty channel resets all outputs of the card.
+func (m *Manager) ResetRuntime(cardID, channel string) error {
+	c, ok := m.GetCard(cardID)
+	if !ok {
+		return errorf(CodeCardNotFound, "card %s not found", cardID).with("cardId", cardID)
+	}
+	if channel != "" {
+		if !controlChannelPattern.MatchString(channel) {
+			return errorf(CodeInvalidRequest, "invalid channel %q (use do<n> or ao<n>, e.g. do0)", channel)
+		}
+		n, _ := strconv.Atoi(channel[2:])
+		count := cardSpec(c).DO
+		if channel[:2] == "ao" {
+			count = cardSpec(c).AO
+		}
+		if n >= count {
+			return errorf(CodeIndexOutOfRange, "%s index %d out of range", strings.ToUpper(channel[:2]), n).with("channel", channel)
+		}
+	}
+
+	m.mu.Lock()
+	key := relayKey(c)
+	if channel == "" {
+		delete(m.runtime.seconds, key)
+	} else {
+		delete(m.runtime.seconds[key], channel)
+	}
+	m.runtime.dirty = true
+	m.mu.Unlock()
+
+	m.saveRuntime()
+	return nil
+}
@@ -0,0 +1,84 @@
+package localio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestOutputRuntime(t *testing.T) {
+	configtest.Isolate(t)
+
+	client := &MockClient{
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) { return make([]byte, 2*quantity), nil },
+		ReadInputRegistersFunc:   func(address, quantity uint16) ([]byte, error) { return make([]byte, 2*quantity), nil },
+	}
+	mgr := newMockManager(client)
+	mgr.aoRuntimeThreshold = 100
+	relays, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	analog, err := mgr.AddCard("/dev/ttyUSB0", 2, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	// count reads a card's outputs as if its previous read was ago
+	count := func(c *Card, ago time.Duration, state CardState) {
+		mgr.mu.Lock()
+		if prev, ok := mgr.runtime.lastRead[c.ID]; ok {
+			prev.at = time.Now().Add(-ago)
+			mgr.runtime.lastRead[c.ID] = prev
+		}
+		mgr.mu.Unlock()
+		mgr.countRuntime(c, state)
+	}
+	do := CardState{DO: []bool{true, false, false, false}}
+	ao := CardState{AO: []float32{5000, 50, 4050, 4500}, AOType: []string{"0-10V", "0-10V", "4-20mA", "4-20mA"}}
+	count(relays, 0, do)
+	count(analog, 0, ao)
+	count(relays, 10*time.Second, do)
+	count(analog, 10*time.Second, ao)
+	// Gaps without reads are not counted
+	count(relays, time.Minute, do)
+
+	hours := make(map[string]float64)
+	for _, rt := range mgr.GetRuntimes() {
+		hours[rt.CardID+"/"+rt.Channel] = rt.Hours
+	}
+	want := map[string]float64{
+		relays.ID + "/do0": 10, relays.ID + "/do1": 0,
+		analog.ID + "/ao0": 10, analog.ID + "/ao1": 0, analog.ID + "/ao2": 0, analog.ID + "/ao3": 10,
+	}
+	for ch, sec := range want {
+		if math.Abs(hours[ch]*3600-sec) > 0.5 {
+			t.Errorf("%s: expected %.0f s, got %.1f s", ch, sec, hours[ch]*3600)
+		}
+	}
+
+	// Runtimes survive a restart
+	mgr.StopCycle()
+	restarted := newMockManager(client)
+	if _, err := restarted.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if rt := restarted.GetRuntimes(); len(rt) != 4 || math.Abs(rt[0].Hours*3600-10) > 0.5 {
+		t.Fatalf("Expected the persisted runtimes, got %+v", rt)
+	}
+
+	if err := restarted.ResetRuntime(relays.ID, "di0"); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a DI channel, got %v", err)
+	}
+	if err := restarted.ResetRuntime(relays.ID, "ao0"); ErrorCodeOf(err) != CodeIndexOutOfRange {
+		t.Errorf("Expected INDEX_OUT_OF_RANGE, got %v", err)
+	}
+	if err := restarted.ResetRuntime(relays.ID, "do0"); err != nil {
+		t.Fatalf("ResetRuntime failed: %v", err)
+	}
+	if rt := restarted.GetRuntimes(); rt[0].Hours != 0 {
+		t.Errorf("Expected DO0 reset, got %+v", rt)
+	}
+}
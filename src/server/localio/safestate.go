@@ -0,0 +1,199 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retry delays of failed safe state writes: the first retry follows after safeStateRetryBase, and the
+// delay doubles with every further failure up to safeStateRetryMax
+var (
+	safeStateRetryBase = time.Second
+	safeStateRetryMax  = 30 * time.Second
+)
+
+// startSafeStateRetry raises SafeStateAlarm and keeps retrying the safe state of the given cards in the
+// background until all of them succeed or CancelSafeStateRetry is called. A retry still running is
+// stopped: it must not clear the alarm or the retry of the cards failing now.
+func (m *Manager) startSafeStateRetry(cardIDs []string) {
+	sort.Strings(cardIDs)
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	prev := m.safeStateRetry
+	m.safeStateRetry = cancel
+	m.mu.Unlock()
+	if prev != nil {
+		prev()
+	}
+
+	m.setSystemAlarm(SafeStateAlarm, unsafedMessage(cardIDs), true)
+	go m.retrySafeState(ctx, cardIDs)
+}
+
+// CancelSafeStateRetry stops retrying failed safe state writes and clears SafeStateAlarm. It is called
+// when a TCP client connects and takes over the outputs again.
+func (m *Manager) CancelSafeStateRetry() {
+	if m.stopSafeStateRetry() {
+		m.setSystemAlarm(SafeStateAlarm, "", false)
+	}
+}
+
+// stopSafeStateRetry stops retrying failed safe state writes and reports whether a retry was running. It
+// cancels under safeStateMu: a retry write in progress completes first, and none follows.
+func (m *Manager) stopSafeStateRetry() bool {
+	m.safeStateMu.Lock()
+	defer m.safeStateMu.Unlock()
+	m.mu.Lock()
+	cancel := m.safeStateRetry
+	m.safeStateRetry = nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// retrySafeState retries the safe state of the cards that failed it, with backoff
+func (m *Manager) retrySafeState(ctx context.Context, cardIDs []string) {
+	delay := safeStateRetryBase
+	for len(cardIDs) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, safeStateRetryMax)
+
+		var failed []string
+		for _, id := range cardIDs {
+			m.mu.Lock()
+			card, ok := m.cards[id]
+			m.mu.Unlock()
+			if !ok {
+				continue // Removed cards have no outputs left to safe
+			}
+			if err := m.writeCardSafeState(ctx, card); ctx.Err() != nil {
+				return
+			} else if err != nil {
+				failed = append(failed, id)
+			}
+		}
+		if len(failed) > 0 && len(failed) < len(cardIDs) {
+			m.setSystemAlarm(SafeStateAlarm, unsafedMessage(failed), true)
+		}
+		cardIDs = failed
+	}
+
+	m.mu.Lock()
+	if ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.safeStateRetry()
+	m.safeStateRetry = nil
+	m.mu.Unlock()
+
+	log.Printf("WriteAllOutputsToSafeState: all outputs set to safe state after retrying")
+	m.setSystemAlarm(SafeStateAlarm, "", false)
+	m.emitEvent(EventSafeState, "", map[string]interface{}{"status": "ok", "retried": true})
+}
+
+// unsafedMessage is the alarm message naming the cards whose outputs aren't in safe state
+func unsafedMessage(cardIDs []string) string {
+	return fmt.Sprintf("outputs of card %s are not in safe state", strings.Join(cardIDs, ", "))
+}
+
+// safeStateAOTolerance is the largest difference between a read back AO value and its safe state, in raw
+// units (mV or µA), that still counts as reached
+const safeStateAOTolerance = 50
+
+// Statuses of a safe state read-back
+const (
+	SafeStateVerified  = "verified" // All outputs read back at their safe state
+	SafeStateMismatch  = "mismatch" // Some outputs read back at another value
+	SafeStateReadError = "error"    // The outputs couldn't be read back
+)
+
+// SafeStateCheck is the read-back of a card's outputs after they were written to safe state, kept as
+// evidence that the outputs reached the commanded state
+type SafeStateCheck struct {
+	CardID     string           `json:"cardId"`
+	Time       time.Time        `json:"time"`
+	Status     string           `json:"status"`
+	Mismatches []OutputMismatch `json:"mismatches,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// OutputMismatch is an output that read back at another value than its safe state
+type OutputMismatch struct {
+	Channel  string      `json:"channel"` // "do<n>" or "ao<n>"
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+}
+
+// GetSafeStateChecks returns the last safe state read-back of each card, sorted by card ID
+func (m *Manager) GetSafeStateChecks() []SafeStateCheck {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]SafeStateCheck, 0, len(m.safeStateChecks))
+	for _, c := range m.safeStateChecks {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CardID < out[j].CardID })
+	return out
+}
+
+// verifySafeState reads back the outputs of a card written to safe state, records the result and emits
+// a safe-state-verified event
+func (m *Manager) verifySafeState(card *Card, pc *portClient, do []bool, ao []float32) {
+	check := SafeStateCheck{CardID: card.ID, Time: time.Now(), Status: SafeStateVerified}
+	state, err := pc.read(cardDriver(card), card.SlaveID, cardSpec(card), false)
+	if err != nil {
+		check.Status = SafeStateReadError
+		check.Error = err.Error()
+	} else {
+		for i, want := range do {
+			if i >= len(state.DO) || state.DO[i] != want {
+				check.Mismatches = append(check.Mismatches, OutputMismatch{Channel: fmt.Sprintf("do%d", i), Expected: want, Actual: valueAt(state.DO, i)})
+			}
+		}
+		for i, want := range ao {
+			if i >= len(state.AO) || math.Abs(float64(state.AO[i]-want)) > safeStateAOTolerance {
+				check.Mismatches = append(check.Mismatches, OutputMismatch{Channel: fmt.Sprintf("ao%d", i), Expected: want, Actual: valueAt(state.AO, i)})
+			}
+		}
+		if len(check.Mismatches) > 0 {
+			check.Status = SafeStateMismatch
+		}
+	}
+	if check.Status != SafeStateVerified {
+		log.Printf("WriteAllOutputsToSafeState: card %s - safe state not verified: %s %v %s", card.ID, check.Status, check.Mismatches, check.Error)
+	}
+
+	m.mu.Lock()
+	m.safeStateChecks[card.ID] = check
+	m.mu.Unlock()
+
+	data := map[string]interface{}{"status": check.Status}
+	if len(check.Mismatches) > 0 {
+		data["mismatches"] = check.Mismatches
+	}
+	if check.Error != "" {
+		data["error"] = check.Error
+	}
+	m.emitEvent(EventSafeStateCheck, card.ID, data)
+}
+
+// valueAt returns the value of a read back channel, or nil if the card didn't report it
+func valueAt[T any](values []T, i int) interface{} {
+	if i >= len(values) {
+		return nil
+	}
+	return values[i]
+}
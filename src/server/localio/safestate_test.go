@@ -0,0 +1,160 @@
+package localio
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestSafeStateRetry(t *testing.T) {
+	configtest.Isolate(t)
+	defer func(d time.Duration) { safeStateRetryBase = d }(safeStateRetryBase)
+	safeStateRetryBase = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	failures := 2
+	client := &MockClient{
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failures > 0 {
+				failures--
+				return nil, errors.New("timeout")
+			}
+			return []byte{}, nil
+		},
+		WriteMultipleRegistersFunc: func(address, quantity uint16, value []byte) ([]byte, error) { return []byte{}, nil },
+	}
+	mgr := newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	var evMu sync.Mutex
+	var actions []string
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventAlarm {
+			evMu.Lock()
+			actions = append(actions, ev.Data["action"].(string))
+			evMu.Unlock()
+		}
+	})
+
+	if err := mgr.WriteAllOutputsToSafeState(); err == nil {
+		t.Fatal("Expected the first safe state write to fail")
+	}
+	if alarms := mgr.GetAlarms(true); len(alarms) != 1 || alarms[0].Name != SafeStateAlarm || !alarms[0].Active || alarms[0].Severity != SeverityCritical {
+		t.Fatalf("Expected the critical safe state alarm raised, got %+v", alarms)
+	}
+
+	// The card is retried in the background until its outputs are safe, which clears the alarm
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.GetAlarms(false)[0].Active {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the safe state retry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	if failures != 0 {
+		t.Errorf("Expected both failures retried, %d left", failures)
+	}
+	mu.Unlock()
+	evMu.Lock()
+	if len(actions) != 2 || actions[0] != AlarmRaised || actions[1] != AlarmCleared {
+		t.Errorf("Expected the alarm raised and cleared, got %v", actions)
+	}
+	evMu.Unlock()
+	if len(mgr.GetAlarmRules()) != 0 {
+		t.Errorf("Expected the safe state alarm not listed as a rule, got %+v", mgr.GetAlarmRules())
+	}
+}
+
+func TestCancelSafeStateRetry(t *testing.T) {
+	configtest.Isolate(t)
+	defer func(d time.Duration) { safeStateRetryBase = d }(safeStateRetryBase)
+	safeStateRetryBase = time.Millisecond
+
+	var writes atomic.Int32
+	started := make(chan struct{}, 10)
+	client := &MockClient{
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			started <- struct{}{}
+			time.Sleep(10 * time.Millisecond)
+			writes.Add(1)
+			return nil, errors.New("timeout")
+		},
+	}
+	mgr := newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if err := mgr.WriteAllOutputsToSafeState(); err == nil {
+		t.Fatal("Expected the safe state write to fail")
+	}
+
+	<-started
+	<-started // The first retry is writing
+
+	// A reconnecting client stops the retry and clears the alarm; a retry write in progress completes
+	// before, and none follows that could overwrite the outputs of the client
+	mgr.CancelSafeStateRetry()
+	after := writes.Load()
+	time.Sleep(20 * time.Millisecond)
+	if writes.Load() != after {
+		t.Errorf("Expected no safe state write after the retry was cancelled, got %d more", writes.Load()-after)
+	}
+	if alarms := mgr.GetAlarms(false); len(alarms) != 1 || alarms[0].Active {
+		t.Errorf("Expected the safe state alarm cleared, got %+v", alarms)
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if mgr.safeStateRetry != nil {
+		t.Error("Expected no safe state retry running")
+	}
+}
+
+func TestSafeStateVerification(t *testing.T) {
+	configtest.Isolate(t)
+
+	coils := byte(0x00)
+	client := &MockClient{
+		ReadDiscreteInputsFunc:   func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:            func(address, quantity uint16) ([]byte, error) { return []byte{coils}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) { return make([]byte, quantity*2), nil },
+		WriteMultipleCoilsFunc:   func(address, quantity uint16, value []byte) ([]byte, error) { return []byte{}, nil },
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	var events []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventSafeStateCheck {
+			events = append(events, ev)
+		}
+	})
+
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	checks := mgr.GetSafeStateChecks()
+	if len(checks) != 1 || checks[0].CardID != card.ID || checks[0].Status != SafeStateVerified {
+		t.Fatalf("Expected the card verified, got %+v", checks)
+	}
+
+	// A relay that stays energized is reported with its channel
+	coils = 0x04
+	mgr.WriteAllOutputsToSafeState()
+	checks = mgr.GetSafeStateChecks()
+	if checks[0].Status != SafeStateMismatch || len(checks[0].Mismatches) != 1 || checks[0].Mismatches[0].Channel != "do2" {
+		t.Errorf("Expected a mismatch on do2, got %+v", checks[0])
+	}
+	if len(events) != 2 || events[0].Severity != SeverityInfo || events[1].Severity != SeverityCritical {
+		t.Errorf("Expected an info and a critical safe-state-verified event, got %+v", events)
+	}
+}
@@ -0,0 +1,348 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// maxScheduleOffsetMinutes is the largest offset of a schedule entry, half a day
+const maxScheduleOffsetMinutes = 12 * 60
+
+// maxScheduleCatchUp limits the entries written after the cycle stalled or the clock jumped forward
+const maxScheduleCatchUp = 24 * time.Hour
+
+// ScheduleStatus is a schedule with the day it follows today and its last write
+type ScheduleStatus struct {
+	config.Schedule
+	// Today is the day type the schedule follows today: a weekday, "holiday", or "" if it's skipped
+	Today string `json:"today"`
+	// Exception is the name (or date) of the calendar exception in effect today
+	Exception string    `json:"exception,omitempty"`
+	LastRun   time.Time `json:"lastRun,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// scheduleRun is the last write of a schedule; guarded by m.mu
+type scheduleRun struct {
+	lastRun time.Time
+	err     string
+}
+
+// dueEntry is a schedule entry due in the current cycle
+type dueEntry struct {
+	at    time.Time
+	sched config.Schedule
+	entry config.ScheduleEntry
+}
+
+// ValidateSchedules checks schedules for missing or duplicate names, missing outputs, invalid times and days.
+// Sunrise and sunset entries require a location.
+func ValidateSchedules(schedules []config.Schedule, loc *config.Location) error {
+	var p configProblems
+	validateSchedules(schedules, loc, &p)
+	return p.err()
+}
+
+func validateSchedules(schedules []config.Schedule, loc *config.Location, p *configProblems) {
+	names := make(map[string]bool)
+	for i, s := range schedules {
+		path := fmt.Sprintf("schedules[%d]", i)
+		if s.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if names[s.Name] {
+			p.add(path+".name", "duplicate name %q", s.Name)
+		}
+		names[s.Name] = true
+		if s.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if s.Type != "" && s.Type != config.ScheduleDO && s.Type != config.ScheduleAO {
+			p.add(path+".type", "unknown type %q (use do or ao)", s.Type)
+		}
+		if s.Index < 0 {
+			p.add(path+".index", "index must not be negative")
+		}
+		for j, e := range s.Entries {
+			entryPath := fmt.Sprintf("%s.entries[%d]", path, j)
+			if isSunEvent(e.At) {
+				if loc == nil {
+					p.add(entryPath+".at", "%s requires a location", e.At)
+				}
+			} else if _, err := time.Parse("15:04", e.At); err != nil {
+				p.add(entryPath+".at", "invalid time %q (use HH:MM, sunrise or sunset)", e.At)
+			}
+			if e.OffsetMin < -maxScheduleOffsetMinutes || e.OffsetMin > maxScheduleOffsetMinutes {
+				p.add(entryPath+".offset_min", "must be between %d and %d", -maxScheduleOffsetMinutes, maxScheduleOffsetMinutes)
+			}
+			for k, d := range e.Days {
+				if !validDayType(d) {
+					p.add(fmt.Sprintf("%s.days[%d]", entryPath, k), "unknown day %q (use mon .. sun or holiday)", d)
+				}
+			}
+		}
+	}
+}
+
+// validateLocation checks the latitude and longitude of the site
+func validateLocation(loc *config.Location, p *configProblems) {
+	if loc == nil {
+		return
+	}
+	if loc.Latitude < -90 || loc.Latitude > 90 {
+		p.add("location.latitude", "must be between -90 and 90")
+	}
+	if loc.Longitude < -180 || loc.Longitude > 180 {
+		p.add("location.longitude", "must be between -180 and 180")
+	}
+}
+
+// ValidateCalendar checks calendar exceptions for invalid or duplicate dates and unknown alternates
+func ValidateCalendar(calendar []config.CalendarException) error {
+	var p configProblems
+	validateCalendar(calendar, &p)
+	return p.err()
+}
+
+func validateCalendar(calendar []config.CalendarException, p *configProblems) {
+	for i, c := range calendar {
+		path := fmt.Sprintf("calendar[%d]", i)
+		if _, err := time.Parse(time.DateOnly, c.Date); err != nil {
+			p.add(path+".date", "invalid date %q (use YYYY-MM-DD)", c.Date)
+		}
+		if c.Alternate != "" && !validDayType(c.Alternate) {
+			p.add(path+".alternate", "unknown day %q (use mon .. sun, holiday, or leave empty to skip)", c.Alternate)
+		}
+		// Two exceptions of a date may only apply to different schedules
+		for j := range i {
+			other := calendar[j]
+			if other.Date == c.Date && (len(other.Schedules) == 0 || len(c.Schedules) == 0 ||
+				slices.ContainsFunc(c.Schedules, func(s string) bool { return slices.Contains(other.Schedules, s) })) {
+				p.add(path+".date", "date %s overlaps calendar[%d]", c.Date, j)
+				break
+			}
+		}
+	}
+}
+
+// validDayType reports whether d is a weekday name or "holiday"
+func validDayType(d string) bool {
+	_, ok := weekdays[strings.ToLower(d)]
+	return ok || strings.EqualFold(d, config.Holiday)
+}
+
+// weekdayName returns the day type of a date without exception, e.g. "mon"
+func weekdayName(t time.Time) string {
+	return strings.ToLower(t.Weekday().String()[:3])
+}
+
+// dayTypeLocked returns the day type a schedule follows on the date of t and the name of the calendar
+// exception that selected it. An empty day type means the schedule is skipped. The caller must hold m.mu.
+func (m *Manager) dayTypeLocked(schedule string, t time.Time) (day, exception string) {
+	date := t.Format(time.DateOnly)
+	for _, c := range m.calendar {
+		if c.Date != date || (len(c.Schedules) > 0 && !slices.Contains(c.Schedules, schedule)) {
+			continue
+		}
+		exception = c.Name
+		if exception == "" {
+			exception = c.Date
+		}
+		return strings.ToLower(c.Alternate), exception
+	}
+	return weekdayName(t), ""
+}
+
+// isSunEvent reports whether the time of a schedule entry is sunrise or sunset
+func isSunEvent(at string) bool {
+	return at == config.Sunrise || at == config.Sunset
+}
+
+// entryTimeLocked returns when a schedule entry falls due on the date of day, or false if it doesn't (no
+// sunrise or sunset that day). The caller must hold m.mu.
+func (m *Manager) entryTimeLocked(e config.ScheduleEntry, day time.Time) (time.Time, bool) {
+	offset := time.Duration(e.OffsetMin) * time.Minute
+	if isSunEvent(e.At) {
+		if m.location == nil {
+			return time.Time{}, false
+		}
+		rise, set, ok := sunTimes(day, *m.location)
+		if !ok {
+			return time.Time{}, false
+		}
+		if e.At == config.Sunrise {
+			return rise.Add(offset), true
+		}
+		return set.Add(offset), true
+	}
+	t, err := time.Parse("15:04", e.At)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()).Add(offset), true
+}
+
+// entryApplies reports whether a schedule entry applies to a day type
+func entryApplies(e config.ScheduleEntry, day string) bool {
+	return len(e.Days) == 0 || slices.ContainsFunc(e.Days, func(d string) bool { return strings.EqualFold(d, day) })
+}
+
+// GetSchedules returns the schedules with the day they follow today and their last write
+func (m *Manager) GetSchedules() []ScheduleStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	out := make([]ScheduleStatus, 0, len(m.schedules))
+	for _, s := range m.schedules {
+		st := ScheduleStatus{Schedule: s}
+		st.Today, st.Exception = m.dayTypeLocked(s.Name, now)
+		if run, ok := m.scheduleRuns[s.Name]; ok {
+			st.LastRun = run.lastRun
+			st.Error = run.err
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// SetSchedules validates, activates, and persists a new set of schedules
+func (m *Manager) SetSchedules(schedules []config.Schedule) error {
+	return m.SetSchedulesContext(context.Background(), schedules)
+}
+
+// SetSchedulesContext is SetSchedules with the change attributed in the config history to the change of ctx
+// (see config.WithChange)
+func (m *Manager) SetSchedulesContext(ctx context.Context, schedules []config.Schedule) error {
+	m.mu.Lock()
+	loc := m.location
+	m.mu.Unlock()
+	if err := ValidateSchedules(schedules, loc); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.schedules = schedules
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Schedules = schedules
+	})
+}
+
+// GetCalendar returns the calendar exceptions
+func (m *Manager) GetCalendar() []config.CalendarException {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]config.CalendarException{}, m.calendar...)
+}
+
+// SetCalendar validates, activates, and persists a new set of calendar exceptions
+func (m *Manager) SetCalendar(calendar []config.CalendarException) error {
+	return m.SetCalendarContext(context.Background(), calendar)
+}
+
+// SetCalendarContext is SetCalendar with the change attributed in the config history to the change of ctx
+// (see config.WithChange)
+func (m *Manager) SetCalendarContext(ctx context.Context, calendar []config.CalendarException) error {
+	if err := ValidateCalendar(calendar); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.calendar = calendar
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Calendar = calendar
+	})
+}
+
+// runSchedules queues the writes of the schedule entries that fell due since the last cycle, in time order.
+// The first call only starts the clock; entries falling due while a maintenance window is open are
+// skipped.
+func (m *Manager) runSchedules(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from := m.scheduleChecked
+	m.scheduleChecked = now
+	if from.IsZero() || !now.After(from) || len(m.schedules) == 0 || m.openWindow.name != "" {
+		return
+	}
+	if now.Sub(from) > maxScheduleCatchUp {
+		from = now.Add(-maxScheduleCatchUp)
+	}
+
+	// Offsets can move entries of the previous and the next day into the period
+	var due []dueEntry
+	y, mo, d := from.Date()
+	for day := time.Date(y, mo, d-1, 0, 0, 0, 0, now.Location()); !day.After(now.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		for _, s := range m.schedules {
+			dayType, _ := m.dayTypeLocked(s.Name, day)
+			if dayType == "" {
+				continue
+			}
+			for _, e := range s.Entries {
+				if !entryApplies(e, dayType) {
+					continue
+				}
+				if at, ok := m.entryTimeLocked(e, day); ok && at.After(from) && !at.After(now) {
+					due = append(due, dueEntry{at: at, sched: s, entry: e})
+				}
+			}
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, d := range due {
+		m.writeScheduleLocked(d.sched, d.entry, now)
+	}
+}
+
+// writeScheduleLocked queues the write of a schedule entry and records the result. The caller must hold m.mu.
+func (m *Manager) writeScheduleLocked(s config.Schedule, e config.ScheduleEntry, now time.Time) {
+	run := scheduleRun{lastRun: now}
+	defer func() { m.scheduleRuns[s.Name] = run }()
+
+	op := writeOperation{CardID: s.Card, Index: s.Index, source: WriteSource{Kind: SourceSchedule, ID: s.Name}}
+	if s.Type == config.ScheduleAO {
+		op.Type = writeOpAO
+		op.Value = e.Value
+	} else {
+		op.Type = writeOpDO
+		if e.State {
+			op.Value = 1.0
+		}
+	}
+	card, ok := m.cards[s.Card]
+	if !ok {
+		run.err = "card not found"
+		return
+	}
+	spec := cardSpec(card)
+	limit := spec.DO
+	if op.Type == writeOpAO {
+		limit = spec.AO
+	}
+	if s.Index >= limit {
+		run.err = "index out of range"
+		return
+	}
+	if m.writeForbiddenLocked(s.Card, op.Type, s.Index, op.source) {
+		run.err = "output not writable (write_permissions)"
+		return
+	}
+	if owner, locked := m.controlConflictLocked(s.Card, op.Type, s.Index, op.source); locked {
+		run.err = fmt.Sprintf("output controlled by %s", owner)
+		return
+	}
+	if err := m.enqueueLocked(nil, op); err != nil {
+		run.err = err.Message
+		return
+	}
+	log.Printf("schedule %s: %s (%s)", s.Name, ChannelKey(op.Type, s.Index), e.At)
+}
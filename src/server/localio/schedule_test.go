@@ -0,0 +1,177 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestSchedulesWithCalendar(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation(time.DateTime, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	err = mgr.SetSchedules([]config.Schedule{{
+		Name: "lights", Card: card.ID, Index: 0,
+		Entries: []config.ScheduleEntry{
+			{At: "07:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}, State: true},
+			{At: "09:00", Days: []string{"holiday"}, State: true},
+			{At: "19:00", State: false},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("SetSchedules failed: %v", err)
+	}
+	err = mgr.SetCalendar([]config.CalendarException{
+		{Date: "2026-10-15", Name: "closed"},
+		{Date: "2026-10-16", Name: "open day", Alternate: "holiday"},
+	})
+	if err != nil {
+		t.Fatalf("SetCalendar failed: %v", err)
+	}
+
+	// run returns the values queued between from and to
+	run := func(from, to string) []float32 {
+		mgr.mu.Lock()
+		mgr.writeQueue = nil
+		mgr.scheduleChecked = at(from)
+		mgr.mu.Unlock()
+		mgr.runSchedules(at(to))
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		var values []float32
+		for _, op := range mgr.writeQueue {
+			if op.source.Kind != SourceSchedule || op.CardID != card.ID || op.Type != writeOpDO || op.Index != 0 {
+				t.Fatalf("Unexpected write %+v", op)
+			}
+			values = append(values, op.Value)
+		}
+		return values
+	}
+
+	// Wednesday: the weekday entries
+	if v := run("2026-10-14 06:59:00", "2026-10-14 07:01:00"); len(v) != 1 || v[0] != 1 {
+		t.Errorf("Expected the 07:00 entry on Wednesday, got %v", v)
+	}
+	// Thursday is skipped
+	if v := run("2026-10-15 06:00:00", "2026-10-15 20:00:00"); len(v) != 0 {
+		t.Errorf("Expected no writes on a skipped date, got %v", v)
+	}
+	// Friday follows the holiday entries, in time order
+	if v := run("2026-10-16 06:00:00", "2026-10-16 20:00:00"); len(v) != 2 || v[0] != 1 || v[1] != 0 {
+		t.Errorf("Expected the 09:00 and 19:00 entries on the holiday, got %v", v)
+	}
+	// Entries across midnight
+	if v := run("2026-10-13 18:00:00", "2026-10-14 08:00:00"); len(v) != 2 || v[0] != 0 || v[1] != 1 {
+		t.Errorf("Expected the 19:00 and 07:00 entries, got %v", v)
+	}
+
+	st := mgr.GetSchedules()
+	if len(st) != 1 || st[0].LastRun.IsZero() || st[0].Error != "" {
+		t.Errorf("Unexpected status %+v", st)
+	}
+
+	// Schedules and calendar are persisted
+	cfg := config.GetConfig()
+	if len(cfg.Schedules) != 1 || len(cfg.Calendar) != 2 {
+		t.Errorf("Expected the schedules and calendar persisted, got %+v / %+v", cfg.Schedules, cfg.Calendar)
+	}
+}
+
+func TestValidateCalendar(t *testing.T) {
+	tests := []struct {
+		calendar []config.CalendarException
+		valid    bool
+	}{
+		{[]config.CalendarException{{Date: "2026-12-25"}, {Date: "2026-12-26", Alternate: "sun"}}, true},
+		{[]config.CalendarException{{Date: "2026-12-25", Schedules: []string{"a"}}, {Date: "2026-12-25", Schedules: []string{"b"}}}, true},
+		{[]config.CalendarException{{Date: "2026-12-25"}, {Date: "2026-12-25", Schedules: []string{"b"}}}, false},
+		{[]config.CalendarException{{Date: "25.12.2026"}}, false},
+		{[]config.CalendarException{{Date: "2026-12-25", Alternate: "weekend"}}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateCalendar(tt.calendar); (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid %v, got %v", tt.calendar, tt.valid, err)
+		}
+	}
+
+	err := ValidateSchedules([]config.Schedule{{Name: "s", Card: "1", Type: "di", Entries: []config.ScheduleEntry{{At: "7am", Days: []string{"xmas"}}}}}, nil)
+	if ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST, got %v", err)
+	}
+}
+
+func TestSunTimes(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*60*60)
+	berlin := config.Location{Latitude: 52.52, Longitude: 13.405}
+	rise, set, ok := sunTimes(time.Date(2026, 6, 21, 12, 0, 0, 0, cest), berlin)
+	if !ok {
+		t.Fatal("Expected a sunrise and sunset in Berlin")
+	}
+	near := func(got time.Time, want string) bool {
+		w, _ := time.ParseInLocation(time.DateTime, want, cest)
+		return got.Sub(w).Abs() <= 3*time.Minute
+	}
+	if !near(rise, "2026-06-21 04:43:00") || !near(set, "2026-06-21 21:33:00") {
+		t.Errorf("Expected sunrise 04:43 and sunset 21:33, got %s and %s", rise, set)
+	}
+
+	// Polar day
+	if _, _, ok := sunTimes(time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), config.Location{Latitude: 69.65, Longitude: 18.96}); ok {
+		t.Error("Expected no sunset in Tromsø at midsummer")
+	}
+}
+
+func TestSunsetSchedule(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	sched := config.Schedule{Name: "exterior", Card: card.ID, Entries: []config.ScheduleEntry{{At: config.Sunset, OffsetMin: -15, State: true}}}
+	if err := mgr.SetSchedules([]config.Schedule{sched}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Fatalf("Expected INVALID_REQUEST without a location, got %v", err)
+	}
+	mgr.location = &config.Location{Latitude: 52.52, Longitude: 13.405}
+	if err := mgr.SetSchedules([]config.Schedule{sched}); err != nil {
+		t.Fatalf("SetSchedules failed: %v", err)
+	}
+
+	day := time.Date(2026, 6, 21, 0, 0, 0, 0, time.Local)
+	_, set, _ := sunTimes(day, *mgr.location)
+	due := set.Add(-15 * time.Minute)
+	for _, tt := range []struct {
+		from, to time.Time
+		writes   int
+	}{
+		{due.Add(-time.Minute), due.Add(-time.Second), 0},
+		{due.Add(-time.Second), due.Add(time.Second), 1},
+	} {
+		mgr.mu.Lock()
+		mgr.writeQueue = nil
+		mgr.scheduleChecked = tt.from
+		mgr.mu.Unlock()
+		mgr.runSchedules(tt.to)
+		if n := len(mgr.GetPendingWrites()); n != tt.writes {
+			t.Errorf("%s - %s: expected %d writes, got %d", tt.from, tt.to, tt.writes, n)
+		}
+	}
+	if sun := mgr.GetSunTimes(); sun == nil || sun.Sunrise.IsZero() {
+		t.Errorf("Expected today's sun times, got %+v", sun)
+	}
+}
@@ -0,0 +1,315 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// scriptMaxSteps bounds the Starlark execution steps of one hook call, so a runaway loop can't stall
+// the poll cycle
+const scriptMaxSteps = 1000000
+
+// scriptBuiltinNames are the names predeclared for scripts
+var scriptBuiltinNames = []string{"read_di", "read_do", "read_ai", "read_ao", "write_do", "write_ao", "now", "state"}
+
+// ScriptStatus reports the definition and execution state of a script
+type ScriptStatus struct {
+	config.Script
+	Runs      int       `json:"runs"`
+	LastRun   time.Time `json:"lastRun,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// script is a loaded script. Hook calls are serialized by mu; the status fields are guarded by the
+// manager's mutex.
+type script struct {
+	cfg     config.Script
+	globals starlark.StringDict
+	state   *starlark.Dict // Values kept between hook calls
+	mu      sync.Mutex
+	stop    chan struct{}
+
+	runs    int
+	lastRun time.Time
+	lastErr string
+}
+
+// ValidateScripts checks script definitions for missing names and syntax errors
+func ValidateScripts(scripts []config.Script) error {
+	var p configProblems
+	validateScripts(scripts, &p)
+	return p.err()
+}
+
+func validateScripts(scripts []config.Script, p *configProblems) {
+	isPredeclared := func(name string) bool {
+		for _, n := range scriptBuiltinNames {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	names := make(map[string]bool)
+	for i, s := range scripts {
+		path := fmt.Sprintf("scripts[%d]", i)
+		if s.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if names[s.Name] {
+			p.add(path+".name", "duplicate name %q", s.Name)
+		}
+		names[s.Name] = true
+
+		if s.IntervalMs < 0 {
+			p.add(path+".interval_ms", "interval_ms must not be negative")
+		}
+		if _, _, err := starlark.SourceProgramOptions(&syntax.FileOptions{}, s.Name+".star", s.Source, isPredeclared); err != nil {
+			p.add(path+".source", "%v", err)
+		}
+	}
+}
+
+// GetScripts returns all scripts with their execution state
+func (m *Manager) GetScripts() []ScriptStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]ScriptStatus, 0, len(m.scripts))
+	for _, s := range m.scripts {
+		out = append(out, ScriptStatus{Script: s.cfg, Runs: s.runs, LastRun: s.lastRun, LastError: s.lastErr})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetScripts validates, loads, and persists scripts, replacing the running ones
+func (m *Manager) SetScripts(scripts []config.Script) error {
+	return m.SetScriptsContext(context.Background(), scripts)
+}
+
+// SetScriptsContext is SetScripts with the change attributed in the config history to the change of ctx
+// (see config.WithChange)
+func (m *Manager) SetScriptsContext(ctx context.Context, scripts []config.Script) error {
+	if err := ValidateScripts(scripts); err != nil {
+		return err
+	}
+	loaded, err := m.loadScripts(scripts)
+	if err != nil {
+		return err
+	}
+	m.replaceScripts(loaded)
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Scripts = scripts
+	})
+}
+
+// loadScripts executes the top level of each script (function definitions, initial state)
+func (m *Manager) loadScripts(scripts []config.Script) ([]*script, error) {
+	loaded := make([]*script, 0, len(scripts))
+	for _, cfg := range scripts {
+		s := &script{cfg: cfg, state: new(starlark.Dict), stop: make(chan struct{})}
+		globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, s.thread(), cfg.Name+".star", cfg.Source, m.scriptBuiltins(s))
+		if err != nil {
+			return nil, errorf(CodeInvalidRequest, "script %s: %v", cfg.Name, err)
+		}
+		s.globals = globals
+		loaded = append(loaded, s)
+	}
+	return loaded, nil
+}
+
+// replaceScripts stops the timers of the running scripts and starts the given ones
+func (m *Manager) replaceScripts(scripts []*script) {
+	m.mu.Lock()
+	old := m.scripts
+	m.scripts = scripts
+	m.mu.Unlock()
+
+	for _, s := range old {
+		close(s.stop)
+		m.ReleaseSource(WriteSource{Kind: SourceScript, ID: s.cfg.Name})
+	}
+	for _, s := range scripts {
+		if s.cfg.IntervalMs > 0 {
+			go m.runScriptTimer(s)
+		}
+	}
+}
+
+// runScriptTimer calls the on_timer hook of a script every IntervalMs until the script is replaced
+func (m *Manager) runScriptTimer(s *script) {
+	ticker := time.NewTicker(time.Duration(s.cfg.IntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// Timers are paused during maintenance
+			if !m.inMaintenance() {
+				m.callScript(s, "on_timer", nil)
+			}
+		}
+	}
+}
+
+// runScripts calls the on_change hook of every script with the IDs of the cards whose inputs changed
+func (m *Manager) runScripts(changed []string) {
+	if len(changed) == 0 {
+		return
+	}
+	m.mu.Lock()
+	scripts := m.scripts
+	m.mu.Unlock()
+
+	for _, s := range scripts {
+		ids := make([]starlark.Value, len(changed))
+		for i, id := range changed {
+			ids[i] = starlark.String(id)
+		}
+		m.callScript(s, "on_change", starlark.Tuple{starlark.NewList(ids)})
+	}
+}
+
+// callScript calls a hook of a script if the script defines it and records the outcome
+func (m *Manager) callScript(s *script, hook string, args starlark.Tuple) {
+	fn, ok := s.globals[hook].(starlark.Callable)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	_, err := starlark.Call(s.thread(), fn, args, nil)
+	s.mu.Unlock()
+
+	m.mu.Lock()
+	s.runs++
+	s.lastRun = time.Now()
+	s.lastErr = ""
+	if err != nil {
+		s.lastErr = err.Error()
+	}
+	m.mu.Unlock()
+	if err != nil {
+		log.Printf("script %s: %s failed: %v", s.cfg.Name, hook, err)
+	}
+}
+
+// thread returns a Starlark thread for one call. load() is not available and print() goes to the log.
+func (s *script) thread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.cfg.Name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("script %s: %s", s.cfg.Name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+	return thread
+}
+
+// scriptBuiltins returns the API available to a script:
+//
+//	read_di(card, index) / read_do(card, index) -> bool
+//	read_ai(card, index) / read_ao(card, index) -> float
+//	write_do(card, index, state), write_ao(card, index, value)  (queued like API writes)
+//	now() -> Unix time in seconds
+//	state: dict kept between hook calls
+func (m *Manager) scriptBuiltins(s *script) starlark.StringDict {
+	return starlark.StringDict{
+		"read_di":  starlark.NewBuiltin("read_di", m.scriptRead("DI")),
+		"read_do":  starlark.NewBuiltin("read_do", m.scriptRead("DO")),
+		"read_ai":  starlark.NewBuiltin("read_ai", m.scriptRead("AI")),
+		"read_ao":  starlark.NewBuiltin("read_ao", m.scriptRead("AO")),
+		"write_do": starlark.NewBuiltin("write_do", m.scriptWriteDO),
+		"write_ao": starlark.NewBuiltin("write_ao", m.scriptWriteAO),
+		"now": starlark.NewBuiltin("now", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			return starlark.Float(float64(time.Now().UnixNano()) / 1e9), nil
+		}),
+		"state": s.state,
+	}
+}
+
+// scriptRead returns the builtin reading a cached channel value of the given kind
+func (m *Manager) scriptRead(kind string) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var cardID string
+		var index int
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &cardID, &index); err != nil {
+			return nil, err
+		}
+		c, ok := m.GetCard(cardID)
+		if !ok {
+			return nil, fmt.Errorf("%s: card %s not found", b.Name(), cardID)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		var value starlark.Value
+		switch kind {
+		case "DI":
+			if index >= 0 && index < len(c.Last.DI) {
+				value = starlark.Bool(c.Last.DI[index])
+			}
+		case "DO":
+			if index >= 0 && index < len(c.Last.DO) {
+				value = starlark.Bool(c.Last.DO[index])
+			}
+		case "AI":
+			if index >= 0 && index < len(c.Last.AI) {
+				value = starlark.Float(c.Last.AI[index])
+			}
+		case "AO":
+			if index >= 0 && index < len(c.Last.AO) {
+				value = starlark.Float(c.Last.AO[index])
+			}
+		}
+		if value == nil {
+			return nil, fmt.Errorf("%s: card %s has no %s%d", b.Name(), cardID, kind, index)
+		}
+		return value, nil
+	}
+}
+
+// scriptContext returns the context of the writes of the script running on thread
+func scriptContext(thread *starlark.Thread) context.Context {
+	return WithSource(context.Background(), WriteSource{Kind: SourceScript, ID: thread.Name})
+}
+
+func (m *Manager) scriptWriteDO(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var cardID string
+	var index int
+	var state bool
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 3, &cardID, &index, &state); err != nil {
+		return nil, err
+	}
+	if err := m.QueueWriteDOContext(scriptContext(thread), cardID, index, state); err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+func (m *Manager) scriptWriteAO(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var cardID string
+	var index int
+	var value float64
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 3, &cardID, &index, &value); err != nil {
+		return nil, err
+	}
+	if err := m.QueueWriteAOContext(scriptContext(thread), cardID, index, float32(value)); err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	return starlark.None, nil
+}
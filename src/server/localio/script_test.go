@@ -0,0 +1,89 @@
+package localio
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestScripts_OnChange(t *testing.T) {
+	configtest.Isolate(t)
+
+	di := byte(0x00)
+	var written []byte
+	var writtenAt uint16
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{di}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			written, writtenAt = append([]byte(nil), value...), address
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	// Mirror DI0 to DO1 and count the calls in the script state
+	source := `
+def on_change(cards):
+    state["calls"] = state.get("calls", 0) + 1
+    if "1" in cards:
+        write_do("1", 1, read_di("1", 0))
+`
+	if err := mgr.SetScripts([]config.Script{{Name: "mirror", Source: source}}); err != nil {
+		t.Fatalf("SetScripts failed: %v", err)
+	}
+
+	di = 0x01
+	mgr.ReadAllAndProcessWrites()
+	if writtenAt != 1 || len(written) != 1 || written[0]&0x01 == 0 {
+		t.Errorf("Expected DO1 switched on by the script, got %v", written)
+	}
+
+	// No input change, no call
+	mgr.ReadAllAndProcessWrites()
+	st := mgr.GetScripts()
+	if len(st) != 1 || st[0].Runs != 1 || st[0].LastError != "" {
+		t.Errorf("Expected one successful run, got %+v", st)
+	}
+	if calls, _, _ := mgr.scripts[0].state.Get(starlark.String("calls")); calls == nil || calls.String() != "1" {
+		t.Errorf("Expected state[\"calls\"] == 1, got %v", calls)
+	}
+	if persisted := config.GetConfig().Scripts; len(persisted) != 1 || persisted[0].Name != "mirror" {
+		t.Errorf("Expected the script to be persisted, got %+v", persisted)
+	}
+}
+
+func TestScripts_Sandbox(t *testing.T) {
+	configtest.Isolate(t)
+	mgr := newMockManager(&MockClient{})
+
+	// Runaway loops are stopped by the step limit
+	if err := mgr.SetScripts([]config.Script{{Name: "busy", Source: "def on_change(cards):\n    for i in range(100000000):\n        pass\n"}}); err != nil {
+		t.Fatalf("SetScripts failed: %v", err)
+	}
+	mgr.runScripts([]string{"1"})
+	if st := mgr.GetScripts(); !strings.Contains(st[0].LastError, "too many steps") {
+		t.Errorf("Expected the step limit to stop the script, got %q", st[0].LastError)
+	}
+
+	// Modules can't be loaded, and invalid scripts are rejected before replacing the running ones
+	if err := mgr.SetScripts([]config.Script{{Name: "io", Source: `load("os.star", "system")`}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for load(), got %v", err)
+	}
+	if err := mgr.SetScripts([]config.Script{{Name: "broken", Source: "def on_change(:"}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a syntax error, got %v", err)
+	}
+	if st := mgr.GetScripts(); len(st) != 1 || st[0].Name != "busy" {
+		t.Errorf("Expected the running script to be kept, got %+v", st)
+	}
+}
@@ -0,0 +1,148 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// NAMUR NE 43 limits of 4-20mA inputs in raw units (µA): values outside indicate a broken wire, a shorted
+// loop or a failed transmitter
+const (
+	sensorUnderRange = 3600
+	sensorOverRange  = 20500
+)
+
+// Sensor fault states of current loop inputs
+const (
+	SensorUnderRange = "under-range"
+	SensorOverRange  = "over-range"
+	SensorOK         = "ok"
+)
+
+// currentLoopPattern matches the channel names of current_loop_inputs
+var currentLoopPattern = regexp.MustCompile(`^ai[0-9]+$`)
+
+// ValidateCurrentLoopInputs checks current loop entries for missing cards and non-AI channels
+func ValidateCurrentLoopInputs(channels []config.InputChannel) error {
+	var p configProblems
+	validateCurrentLoopInputs(channels, &p)
+	return p.err()
+}
+
+func validateCurrentLoopInputs(channels []config.InputChannel, p *configProblems) {
+	for i, ch := range channels {
+		path := fmt.Sprintf("current_loop_inputs[%d]", i)
+		if ch.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if !currentLoopPattern.MatchString(ch.Channel) {
+			p.add(path+".channel", "invalid channel %q (use ai<n>, e.g. ai0)", ch.Channel)
+		}
+	}
+}
+
+// GetCurrentLoopInputs returns the AI channels wired to 4-20mA transmitters
+func (m *Manager) GetCurrentLoopInputs() []config.InputChannel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channels := make([]config.InputChannel, len(m.currentLoop))
+	copy(channels, m.currentLoop)
+	return channels
+}
+
+// SetCurrentLoopInputs validates, activates, and persists the AI channels wired to 4-20mA transmitters.
+// The change applies from the next read.
+func (m *Manager) SetCurrentLoopInputs(channels []config.InputChannel) error {
+	return m.SetCurrentLoopInputsContext(context.Background(), channels)
+}
+
+// SetCurrentLoopInputsContext is SetCurrentLoopInputs with the change attributed in the config history to
+// the change of ctx (see config.WithChange)
+func (m *Manager) SetCurrentLoopInputsContext(ctx context.Context, channels []config.InputChannel) error {
+	if err := ValidateCurrentLoopInputs(channels); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.currentLoop = channels
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.CurrentLoopInputs = channels
+	})
+}
+
+// sensorFault returns the fault state of a current loop value in raw units
+func sensorFault(v float32) string {
+	switch {
+	case v < sensorUnderRange:
+		return SensorUnderRange
+	case v > sensorOverRange:
+		return SensorOverRange
+	}
+	return SensorOK
+}
+
+// sensorFaultLocked reports whether an AI channel of a card has a sensor fault. The caller must hold m.mu.
+func (m *Manager) sensorFaultLocked(cardID string, index int) bool {
+	_, faulted := m.sensorFaults[cardID][index]
+	return faulted
+}
+
+// checkSensorFaults checks the current loop inputs of a card after a successful read: out of range values
+// get the sensor-fault quality, and every change of a channel's fault state emits a sensor-fault event
+func (m *Manager) checkSensorFaults(c *Card, readErr error) {
+	if readErr != nil {
+		return
+	}
+	type change struct {
+		channel, status string
+		value           float32
+	}
+	var changes []change
+
+	m.mu.Lock()
+	faults := m.sensorFaults[c.ID]
+	for _, ch := range m.currentLoop {
+		if ch.Card != c.ID {
+			continue
+		}
+		index, err := strconv.Atoi(ch.Channel[2:])
+		if err != nil || index >= len(c.Last.AI) {
+			continue
+		}
+		// Disabled and simulated inputs are not measurements
+		q := c.Last.Quality
+		if q == nil || index >= len(q.AI) || q.AI[index] != QualityGood {
+			continue
+		}
+		v := c.Last.AI[index]
+		status := sensorFault(v)
+		prev, faulted := faults[index]
+		if status != SensorOK {
+			q.AI[index] = QualitySensorFault
+			if faults == nil {
+				faults = make(map[int]string)
+				m.sensorFaults[c.ID] = faults
+			}
+			faults[index] = status
+		} else {
+			delete(faults, index)
+		}
+		if (faulted && prev != status) || (!faulted && status != SensorOK) {
+			changes = append(changes, change{ch.Channel, status, v})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ch := range changes {
+		m.emitEvent(EventSensorFault, c.ID, map[string]interface{}{
+			"channel": ch.channel,
+			"status":  ch.status,
+			"value":   ch.value,
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package localio
+
+import (
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestSensorFaults(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := newMockManager(&MockClient{
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) { return make([]byte, 2*quantity), nil },
+		ReadInputRegistersFunc:   func(address, quantity uint16) ([]byte, error) { return make([]byte, 2*quantity), nil },
+	})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	var events []Event
+	mgr.AddEventListener(func(ev Event) {
+		if ev.Type == EventSensorFault {
+			events = append(events, ev)
+		}
+	})
+
+	if err := mgr.SetCurrentLoopInputs([]config.InputChannel{{Card: card.ID, Channel: "ao0"}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Fatalf("Expected INVALID_REQUEST for an AO channel, got %v", err)
+	}
+	err = mgr.SetCurrentLoopInputs([]config.InputChannel{{Card: card.ID, Channel: "ai0"}, {Card: card.ID, Channel: "ai1"}})
+	if err != nil {
+		t.Fatalf("SetCurrentLoopInputs failed: %v", err)
+	}
+	if len(config.GetConfig().CurrentLoopInputs) != 2 {
+		t.Error("Expected the current loop inputs persisted")
+	}
+
+	// read sets the AI values of the card as if they had been read
+	read := func(ai ...float32) *ChannelQuality {
+		mgr.mu.Lock()
+		card.Last.AI = ai
+		mgr.mu.Unlock()
+		mgr.applyQuality(card, cardSpec(card), nil, time.Now())
+		mgr.checkSensorFaults(card, nil)
+		return card.Last.Quality
+	}
+
+	q := read(2000, 21000, 0, 12000)
+	if q.AI[0] != QualitySensorFault || q.AI[1] != QualitySensorFault || q.AI[2] != QualityGood {
+		t.Errorf("Expected ai0 and ai1 faulted, got %v", q.AI)
+	}
+	if len(events) != 2 || events[0].Data["status"] != SensorUnderRange || events[1].Data["status"] != SensorOverRange ||
+		events[0].Severity != SeverityWarning {
+		t.Fatalf("Expected under-range and over-range events, got %+v", events)
+	}
+
+	// A persisting fault is reported once
+	read(2000, 21000, 0, 12000)
+	if len(events) != 2 {
+		t.Errorf("Expected no events for persisting faults, got %+v", events[2:])
+	}
+
+	q = read(12000, 21000, 0, 12000)
+	if q.AI[0] != QualityGood || q.AI[1] != QualitySensorFault {
+		t.Errorf("Expected ai0 recovered, got %v", q.AI)
+	}
+	if len(events) != 3 || events[2].Data["channel"] != "ai0" || events[2].Data["status"] != SensorOK || events[2].Severity != SeverityInfo {
+		t.Errorf("Expected an ok event for ai0, got %+v", events)
+	}
+
+	// Points on a faulted channel are not scaled
+	mgr.mu.Lock()
+	card.Last.SerialNumber = "SN1"
+	mgr.points = []config.Point{
+		{Serial: "SN1", Channel: "ai0", RawMin: 4000, RawMax: 20000, EngMin: 0, EngMax: 10},
+		{Serial: "SN1", Channel: "ai1", RawMin: 4000, RawMax: 20000, EngMin: 0, EngMax: 10},
+	}
+	mgr.mu.Unlock()
+	points := mgr.GetPoints()
+	if points[0].Scaled == nil || points[0].Fault != "" {
+		t.Errorf("Expected ai0 scaled, got %+v", points[0])
+	}
+	if points[1].Scaled != nil || points[1].Fault != SensorOverRange {
+		t.Errorf("Expected ai1 with its fault and unscaled, got %+v", points[1])
+	}
+}
@@ -0,0 +1,291 @@
+package localio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// Sequence run states
+const (
+	SequenceRunning   = "running"
+	SequenceCompleted = "completed"
+	SequenceAborted   = "aborted"
+	SequenceFailed    = "failed"
+)
+
+// seqPollInterval is how often a wait-di step checks the cached DI state
+const seqPollInterval = 20 * time.Millisecond
+
+// SequenceStatus reports the definition and last run of a sequence
+type SequenceStatus struct {
+	config.Sequence
+	Status      string    `json:"status,omitempty"` // empty if never started
+	CurrentStep int       `json:"currentStep"`      // index of the step being executed
+	TotalSteps  int       `json:"totalSteps"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"startedAt,omitempty"`
+	FinishedAt  time.Time `json:"finishedAt,omitempty"`
+}
+
+// sequenceRun tracks one execution of a sequence
+type sequenceRun struct {
+	status     string
+	step       int
+	err        string
+	startedAt  time.Time
+	finishedAt time.Time
+	abort      chan struct{}
+	// safeStateGen is the safe state generation at start: the writes of the run are rejected once safe
+	// state was applied, even if it happened between the abort check and the write
+	safeStateGen uint64
+	waitsDI      bool // The sequence has wait-di steps, which need the DIs read at full rate
+}
+
+// ValidateSequences checks sequence definitions for unknown step types and missing fields
+func ValidateSequences(seqs []config.Sequence) error {
+	var p configProblems
+	validateSequences(seqs, &p)
+	return p.err()
+}
+
+func validateSequences(seqs []config.Sequence, p *configProblems) {
+	names := make(map[string]bool)
+	for i, seq := range seqs {
+		path := fmt.Sprintf("sequences[%d]", i)
+		if seq.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if names[seq.Name] {
+			p.add(path+".name", "duplicate name %q", seq.Name)
+		}
+		names[seq.Name] = true
+
+		for j, step := range seq.Steps {
+			stepPath := fmt.Sprintf("%s.steps[%d]", path, j)
+			switch step.Type {
+			case config.StepWriteDO, config.StepWriteAO, config.StepWaitDI:
+				if step.Card == "" {
+					p.add(stepPath+".card", "card is required")
+				}
+			case config.StepDelay:
+				if step.DelayMs <= 0 {
+					p.add(stepPath+".delay_ms", "delay_ms must be positive")
+				}
+			default:
+				p.add(stepPath+".type", "unknown type %q", step.Type)
+			}
+		}
+	}
+}
+
+// GetSequences returns all sequence definitions with their last run status
+func (m *Manager) GetSequences() []SequenceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]SequenceStatus, 0, len(m.sequences))
+	for _, seq := range m.sequences {
+		st := SequenceStatus{Sequence: seq, TotalSteps: len(seq.Steps)}
+		if run, ok := m.sequenceRuns[seq.Name]; ok {
+			st.Status = run.status
+			st.CurrentStep = run.step
+			st.Error = run.err
+			st.StartedAt = run.startedAt
+			st.FinishedAt = run.finishedAt
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetSequences validates, activates, and persists sequence definitions
+func (m *Manager) SetSequences(seqs []config.Sequence) error {
+	return m.SetSequencesContext(context.Background(), seqs)
+}
+
+// SetSequencesContext is SetSequences with the change attributed in the config history to the change of ctx
+// (see config.WithChange)
+func (m *Manager) SetSequencesContext(ctx context.Context, seqs []config.Sequence) error {
+	if err := ValidateSequences(seqs); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.sequences = seqs
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.Sequences = seqs
+	})
+}
+
+// StartSequence starts a sequence in the background; a sequence can only run once at a time
+func (m *Manager) StartSequence(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var seq *config.Sequence
+	for i := range m.sequences {
+		if m.sequences[i].Name == name {
+			seq = &m.sequences[i]
+			break
+		}
+	}
+	if seq == nil {
+		return errorf(CodeNotFound, "sequence not found")
+	}
+	if run, ok := m.sequenceRuns[name]; ok && run.status == SequenceRunning {
+		return errorf(CodeConflict, "sequence already running")
+	}
+
+	run := &sequenceRun{
+		status:       SequenceRunning,
+		startedAt:    time.Now(),
+		abort:        make(chan struct{}),
+		safeStateGen: m.safeStateGen.Load(),
+	}
+	for _, step := range seq.Steps {
+		if step.Type == config.StepWaitDI {
+			run.waitsDI = true
+		}
+	}
+	m.sequenceRuns[name] = run
+	go m.runSequence(*seq, run)
+	// A wait-di step must not wait for an idle pause to see its input
+	if run.waitsDI {
+		m.wakeCycle()
+	}
+	return nil
+}
+
+// AbortSequence stops a running sequence before its next step
+func (m *Manager) AbortSequence(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.sequenceRuns[name]
+	if !ok || run.status != SequenceRunning {
+		return errorf(CodeConflict, "sequence not running")
+	}
+	close(run.abort)
+	run.status = SequenceAborted
+	run.finishedAt = time.Now()
+	return nil
+}
+
+// abortAllSequences stops every running sequence (used before driving outputs to safe state)
+func (m *Manager) abortAllSequences() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, run := range m.sequenceRuns {
+		if run.status == SequenceRunning {
+			close(run.abort)
+			run.status = SequenceAborted
+			run.finishedAt = time.Now()
+			log.Printf("sequence %s aborted", name)
+		}
+	}
+}
+
+// runSequence executes the steps of seq in order until done, aborted, or a step fails
+// The channels written by the sequence are released when it ends.
+func (m *Manager) runSequence(seq config.Sequence, run *sequenceRun) {
+	src := WriteSource{Kind: SourceSequence, ID: seq.Name}
+	defer m.ReleaseSource(src)
+
+	for i, step := range seq.Steps {
+		m.mu.Lock()
+		if run.status != SequenceRunning {
+			m.mu.Unlock()
+			return
+		}
+		run.step = i
+		m.mu.Unlock()
+
+		if err := m.runSequenceStep(step, src, run); err != nil {
+			m.mu.Lock()
+			if run.status == SequenceRunning {
+				run.status = SequenceFailed
+				run.err = fmt.Sprintf("step %d: %v", i, err)
+				run.finishedAt = time.Now()
+			}
+			m.mu.Unlock()
+			return
+		}
+	}
+
+	m.mu.Lock()
+	if run.status == SequenceRunning {
+		run.status = SequenceCompleted
+		run.step = len(seq.Steps)
+		run.finishedAt = time.Now()
+	}
+	m.mu.Unlock()
+}
+
+// errSequenceAborted is returned by a step interrupted by AbortSequence
+var errSequenceAborted = errors.New("aborted")
+
+func (m *Manager) runSequenceStep(step config.SequenceStep, src WriteSource, run *sequenceRun) error {
+	switch step.Type {
+	case config.StepWriteDO, config.StepWriteAO:
+		op := writeOperation{CardID: step.Card, Index: step.Index, source: src, safeStateGen: run.safeStateGen}
+		if step.Type == config.StepWriteDO {
+			op.Type = writeOpDO
+			if step.State {
+				op.Value = 1.0
+			}
+		} else {
+			op.Type = writeOpAO
+			op.Value = step.Value
+		}
+		result := m.ProcessBatchWrite([]writeOperation{op})[0]
+		if result.Status == "error" {
+			return fmt.Errorf("%s", result.Message)
+		}
+		return nil
+
+	case config.StepDelay:
+		select {
+		case <-run.abort:
+			return errSequenceAborted
+		case <-time.After(time.Duration(step.DelayMs) * time.Millisecond):
+			return nil
+		}
+
+	case config.StepWaitDI:
+		var timeout <-chan time.Time
+		if step.TimeoutMs > 0 {
+			timeout = time.After(time.Duration(step.TimeoutMs) * time.Millisecond)
+		}
+		ticker := time.NewTicker(seqPollInterval)
+		defer ticker.Stop()
+		for {
+			c, ok := m.GetCard(step.Card)
+			if !ok {
+				return fmt.Errorf("card not found")
+			}
+			m.mu.Lock()
+			reached := step.Index >= 0 && step.Index < len(c.Last.DI) && c.Last.DI[step.Index] == step.State
+			m.mu.Unlock()
+			if reached {
+				return nil
+			}
+
+			select {
+			case <-run.abort:
+				return errSequenceAborted
+			case <-timeout:
+				return fmt.Errorf("timeout waiting for card %s DI%d", step.Card, step.Index)
+			case <-ticker.C:
+			}
+		}
+	}
+	return fmt.Errorf("unknown step type %q", step.Type)
+}
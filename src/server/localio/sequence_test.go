@@ -0,0 +1,148 @@
+package localio
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// waitSequence polls until the sequence leaves the running state
+func waitSequence(t *testing.T, mgr *Manager, name string) SequenceStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, st := range mgr.GetSequences() {
+			if st.Name == name && st.Status != SequenceRunning {
+				return st
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("sequence %s did not finish", name)
+	return SequenceStatus{}
+}
+
+func TestSequence_Run(t *testing.T) {
+	var mu sync.Mutex
+	var coils [][]byte
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x01}, nil }, // DI0 high
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			mu.Lock()
+			coils = append(coils, []byte{byte(address), value[0]})
+			mu.Unlock()
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	mgr.sequences = []config.Sequence{
+		{Name: "start", Steps: []config.SequenceStep{
+			{Type: config.StepWriteDO, Card: card.ID, Index: 1, State: true},
+			{Type: config.StepDelay, DelayMs: 10},
+			{Type: config.StepWaitDI, Card: card.ID, Index: 0, State: true, TimeoutMs: 100},
+		}},
+		{Name: "stuck", Steps: []config.SequenceStep{
+			{Type: config.StepWaitDI, Card: card.ID, Index: 1, State: true, TimeoutMs: 20},
+		}},
+		{Name: "long", Steps: []config.SequenceStep{
+			{Type: config.StepDelay, DelayMs: 10000},
+			{Type: config.StepWriteDO, Card: card.ID, Index: 2, State: true},
+		}},
+	}
+
+	if err := mgr.StartSequence("start"); err != nil {
+		t.Fatalf("StartSequence failed: %v", err)
+	}
+	if st := waitSequence(t, mgr, "start"); st.Status != SequenceCompleted || st.CurrentStep != 3 {
+		t.Errorf("Expected completed at step 3, got %+v", st)
+	}
+	mu.Lock()
+	if len(coils) != 1 || coils[0][0] != 1 || coils[0][1] != 0x01 {
+		t.Errorf("Expected a single write of DO1 on, got %v", coils)
+	}
+	mu.Unlock()
+
+	if err := mgr.StartSequence("stuck"); err != nil {
+		t.Fatalf("StartSequence failed: %v", err)
+	}
+	if st := waitSequence(t, mgr, "stuck"); st.Status != SequenceFailed || !strings.Contains(st.Error, "timeout") {
+		t.Errorf("Expected timeout failure, got %+v", st)
+	}
+
+	if err := mgr.StartSequence("long"); err != nil {
+		t.Fatalf("StartSequence failed: %v", err)
+	}
+	if err := mgr.StartSequence("long"); err == nil {
+		t.Error("Expected error starting an already running sequence")
+	}
+	if err := mgr.AbortSequence("long"); err != nil {
+		t.Fatalf("AbortSequence failed: %v", err)
+	}
+	if st := waitSequence(t, mgr, "long"); st.Status != SequenceAborted {
+		t.Errorf("Expected aborted, got %+v", st)
+	}
+
+	if err := mgr.StartSequence("missing"); err == nil {
+		t.Error("Expected error for unknown sequence")
+	}
+}
+
+func TestSequence_SafeStateBeforeWrite(t *testing.T) {
+	var mu sync.Mutex
+	var coils [][]byte
+	client := &MockClient{
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			mu.Lock()
+			coils = append(coils, []byte{byte(address), value[0]})
+			mu.Unlock()
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	// The run passed its abort check for the step, then safe state is applied before the step writes
+	run := &sequenceRun{status: SequenceRunning, abort: make(chan struct{}), safeStateGen: mgr.safeStateGen.Load()}
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	mu.Lock()
+	written := len(coils)
+	mu.Unlock()
+
+	step := config.SequenceStep{Type: config.StepWriteDO, Card: card.ID, Index: 1, State: true}
+	err = mgr.runSequenceStep(step, WriteSource{Kind: SourceSequence, ID: "start"}, run)
+	if err == nil || !strings.Contains(err.Error(), "safe state") {
+		t.Errorf("Expected the step rejected after safe state, got %v", err)
+	}
+	mu.Lock()
+	if len(coils) != written {
+		t.Errorf("Expected no write after safe state, got %v", coils[written:])
+	}
+	mu.Unlock()
+
+	// A run started after safe state writes normally
+	run.safeStateGen = mgr.safeStateGen.Load()
+	if err := mgr.runSequenceStep(step, WriteSource{Kind: SourceSequence, ID: "start"}, run); err != nil {
+		t.Errorf("Expected the step written, got %v", err)
+	}
+}
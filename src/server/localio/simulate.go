@@ -0,0 +1,111 @@
+package localio
+
+import (
+	"sort"
+	"strconv"
+)
+
+// SimulatedChannels lists the input channels of a card whose values are simulated
+type SimulatedChannels struct {
+	DI []int `json:"di,omitempty"`
+	AI []int `json:"ai,omitempty"`
+}
+
+// simulatedInputs holds injected input values for a card, keyed by channel index
+type simulatedInputs struct {
+	di map[int]bool
+	ai map[int]float32
+}
+
+// SimulateInputs injects simulated DI/AI values for a card. Simulated channels keep their
+// injected value instead of the value read from the bus until ClearSimulation is called.
+func (m *Manager) SimulateInputs(cardID string, di map[int]bool, ai map[int]float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.cards[cardID]
+	if !ok {
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
+	}
+	spec := cardSpec(c)
+	for idx := range di {
+		if idx < 0 || idx >= spec.DI {
+			return errorf(CodeIndexOutOfRange, "DI index %d out of range", idx).with("channel", "di"+strconv.Itoa(idx))
+		}
+	}
+	for idx := range ai {
+		if idx < 0 || idx >= spec.AI {
+			return errorf(CodeIndexOutOfRange, "AI index %d out of range", idx).with("channel", "ai"+strconv.Itoa(idx))
+		}
+	}
+
+	sim, ok := m.simulated[cardID]
+	if !ok {
+		sim = &simulatedInputs{di: make(map[int]bool), ai: make(map[int]float32)}
+		m.simulated[cardID] = sim
+	}
+	for idx, v := range di {
+		sim.di[idx] = v
+	}
+	for idx, v := range ai {
+		sim.ai[idx] = v
+	}
+
+	// Show the simulated values right away instead of after the next read
+	m.applySimulationLocked(c.ID, spec, &c.Last)
+	m.stampLocked(&c.Last)
+	return nil
+}
+
+// ClearSimulation removes all simulated inputs of a card; real values return on the next read
+func (m *Manager) ClearSimulation(cardID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.cards[cardID]
+	if !ok {
+		return errorf(CodeCardNotFound, "card not found").with("cardId", cardID)
+	}
+	delete(m.simulated, cardID)
+	c.Last.Simulated = nil
+	return nil
+}
+
+// applySimulation overlays simulated inputs onto a freshly read state
+func (m *Manager) applySimulation(cardID string, spec ModelSpec, state *CardState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applySimulationLocked(cardID, spec, state)
+}
+
+func (m *Manager) applySimulationLocked(cardID string, spec ModelSpec, state *CardState) {
+	sim, ok := m.simulated[cardID]
+	if !ok {
+		state.Simulated = nil
+		return
+	}
+
+	// Copy before overwriting: the slices may be shared with previously published states
+	marked := &SimulatedChannels{}
+	if len(sim.di) > 0 {
+		di := make([]bool, spec.DI)
+		copy(di, state.DI)
+		state.DI = di
+		for idx, v := range sim.di {
+			state.DI[idx] = v
+			marked.DI = append(marked.DI, idx)
+		}
+		sort.Ints(marked.DI)
+	}
+	if len(sim.ai) > 0 {
+		ai := make([]float32, spec.AI)
+		copy(ai, state.AI)
+		state.AI = ai
+		for idx, v := range sim.ai {
+			state.AI[idx] = v
+			marked.AI = append(marked.AI, idx)
+		}
+		sort.Ints(marked.AI)
+	}
+	state.Simulated = marked
+}
@@ -0,0 +1,48 @@
+package localio
+
+import "testing"
+
+func TestSimulateInputs(t *testing.T) {
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.SimulateInputs(card.ID, map[int]bool{2: true}, nil); err != nil {
+		t.Fatalf("SimulateInputs failed: %v", err)
+	}
+	if err := mgr.SimulateInputs(card.ID, map[int]bool{4: true}, nil); err == nil {
+		t.Error("Expected error for out of range DI")
+	}
+	if err := mgr.SimulateInputs(card.ID, nil, map[int]float32{0: 1}); err == nil {
+		t.Error("Expected error for AI on a card without AI")
+	}
+
+	// The simulated value must survive a real read that reports the input low
+	mgr.ReadAllAndProcessWrites()
+	if !card.Last.DI[2] {
+		t.Error("Expected simulated DI2 to stay high after a read")
+	}
+	if card.Last.DI[0] {
+		t.Error("Expected real DI0 to be low")
+	}
+	if card.Last.Simulated == nil || len(card.Last.Simulated.DI) != 1 || card.Last.Simulated.DI[0] != 2 {
+		t.Errorf("Expected DI2 marked as simulated, got %+v", card.Last.Simulated)
+	}
+
+	if err := mgr.ClearSimulation(card.ID); err != nil {
+		t.Fatalf("ClearSimulation failed: %v", err)
+	}
+	mgr.ReadAllAndProcessWrites()
+	if card.Last.DI[2] || card.Last.Simulated != nil {
+		t.Errorf("Expected real values after clearing simulation, got %+v", card.Last)
+	}
+}
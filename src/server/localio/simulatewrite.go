@@ -0,0 +1,91 @@
+package localio
+
+import (
+	"context"
+	"sort"
+	"strconv"
+)
+
+// PlannedWrite is a bus request a batch of writes would make
+type PlannedWrite struct {
+	CardID  string `json:"cardId"`
+	SlaveID byte   `json:"slaveId"`
+	Type    string `json:"type"` // "write-do", "write-ao" or "write-aotype"
+	// Start is the first channel written; channels between the written ones keep their cached value
+	Start  int       `json:"start"`
+	DO     []bool    `json:"do,omitempty"`
+	AO     []float32 `json:"ao,omitempty"`
+	AOType []string  `json:"aoType,omitempty"`
+}
+
+// WriteSimulation is the predicted outcome of a batch of writes
+type WriteSimulation struct {
+	// Results are the results the batch would return, with an empty message for the operations written
+	Results []CommandResult `json:"results"`
+	Writes  []PlannedWrite  `json:"writes"` // Bus requests of the operations written
+}
+
+// SimulateBatchWrite runs a batch of writes through the checks of ProcessBatchWriteContext (index range,
+// slave conflicts, write permissions, interlocks, control, minimum on/off times, slew rates, unchanged
+// values) and returns the results and bus requests the batch would make, without writing or holding
+// anything. Bus errors can't be predicted.
+func (m *Manager) SimulateBatchWrite(ctx context.Context, ops []writeOperation) WriteSimulation {
+	ops = append([]writeOperation(nil), ops...)
+	for i := range ops {
+		if ops[i].source.Kind == "" {
+			ops[i].source = sourceFrom(ctx)
+		}
+	}
+
+	results := make([]CommandResult, len(ops))
+	m.checkWrites(ctx, ops, results, m.checkInterlocks(ops), m.checkShortCycles(ops, true), true)
+
+	var written []writeOperation
+	for i, op := range ops {
+		if results[i].Status == "" {
+			results[i] = CommandResult{Index: i, Status: "ok"}
+			written = append(written, op)
+		}
+	}
+
+	sim := WriteSimulation{Results: results, Writes: []PlannedWrite{}}
+	for _, group := range m.GroupWriteOperations(written) {
+		card, ok := m.GetCard(group.CardID)
+		if !ok {
+			continue
+		}
+		var writes []OutputWrite
+		switch group.RegisterType {
+		case writeOpDO:
+			writes = []OutputWrite{doWrite(card, group.Operations)}
+		case writeOpAO:
+			writes = []OutputWrite{aoWrite(card, group.Operations)}
+		case writeOpAOType:
+			writes = aoTypeWrites(group.Operations)
+		}
+		for _, w := range writes {
+			sim.Writes = append(sim.Writes, PlannedWrite{
+				CardID:  card.ID,
+				SlaveID: card.SlaveID,
+				Type:    writeOpName(w.Type),
+				Start:   w.Start,
+				DO:      w.DO,
+				AO:      w.AO,
+				AOType:  w.AOType,
+			})
+		}
+	}
+	sort.Slice(sim.Writes, func(i, j int) bool {
+		a, b := sim.Writes[i], sim.Writes[j]
+		if a.CardID != b.CardID {
+			ida, _ := strconv.Atoi(a.CardID)
+			idb, _ := strconv.Atoi(b.CardID)
+			return ida < idb
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Start < b.Start
+	})
+	return sim
+}
@@ -0,0 +1,68 @@
+package localio
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+)
+
+func TestSimulateBatchWrite(t *testing.T) {
+	var coilWrites int
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) { return []byte{0x00}, nil },
+		ReadCoilsFunc:          func(address, quantity uint16) ([]byte, error) { return []byte{0x04}, nil }, // DO2 on
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return make([]byte, quantity*2), nil
+		},
+		WriteMultipleCoilsFunc: func(address, quantity uint16, value []byte) ([]byte, error) {
+			coilWrites++
+			return []byte{}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	mgr.interlocks = []config.InterlockRule{
+		{Name: "direction", Type: config.InterlockExclusive, Outputs: []config.ChannelRef{{Card: card.ID, Index: 2}, {Card: card.ID, Index: 3}}},
+		{Name: "permissive", Type: config.InterlockRequires, Output: config.ChannelRef{Card: card.ID, Index: 0}, Input: config.ChannelRef{Card: card.ID, Index: 1}},
+	}
+
+	sim := mgr.SimulateBatchWrite(context.Background(), []WriteOperation{
+		{CardID: card.ID, Type: WriteOpDO, Index: 0, Value: 1}, // DI1 is low
+		{CardID: card.ID, Type: WriteOpDO, Index: 1, Value: 0}, // Already off
+		{CardID: card.ID, Type: WriteOpDO, Index: 2, Value: 0},
+		{CardID: card.ID, Type: WriteOpDO, Index: 3, Value: 1},
+		{CardID: "99", Type: WriteOpDO, Index: 0, Value: 1},
+	})
+
+	if r := sim.Results[0]; r.Status != "error" || !strings.Contains(r.Message, "interlock permissive") {
+		t.Errorf("Expected the interlock rejection, got %+v", r)
+	}
+	if r := sim.Results[1]; r.Status != "ok" || r.Message != "value unchanged, skipped" {
+		t.Errorf("Expected the unchanged value skipped, got %+v", r)
+	}
+	for _, i := range []int{2, 3} {
+		if r := sim.Results[i]; r.Status != "ok" || r.Message != "" || r.Index != i {
+			t.Errorf("Result %d: expected ok, got %+v", i, r)
+		}
+	}
+	if r := sim.Results[4]; r.Code != CodeCardNotFound {
+		t.Errorf("Expected card not found, got %+v", r)
+	}
+
+	want := []PlannedWrite{{CardID: card.ID, SlaveID: 1, Type: "write-do", Start: 2, DO: []bool{false, true}}}
+	if !reflect.DeepEqual(sim.Writes, want) {
+		t.Errorf("Expected writes %+v, got %+v", want, sim.Writes)
+	}
+	if coilWrites != 0 {
+		t.Errorf("Expected no bus writes, got %d", coilWrites)
+	}
+	if c, _ := mgr.GetCard(card.ID); !c.Last.DO[2] || c.Last.DO[3] {
+		t.Errorf("Expected the cached outputs unchanged, got %v", c.Last.DO)
+	}
+}
@@ -0,0 +1,231 @@
+package localio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// AORamp is an AO change in progress, limited by the slew rate of the channel
+type AORamp struct {
+	CardID    string      `json:"cardId"`
+	Channel   string      `json:"channel"`
+	From      float32     `json:"from"`
+	Target    float32     `json:"target"`
+	Value     float32     `json:"value"` // Last value written
+	MaxPerSec float64     `json:"maxPerSec"`
+	Started   time.Time   `json:"started"`
+	Source    WriteSource `json:"source"`
+}
+
+// aoRamp moves an AO channel from a value to a target at a limited rate
+type aoRamp struct {
+	AORamp
+	index int
+}
+
+// at returns the ramp value at the given time
+func (r *aoRamp) at(now time.Time) float32 {
+	step := r.MaxPerSec * now.Sub(r.Started).Seconds()
+	diff := float64(r.Target - r.From)
+	if math.Abs(diff) <= step {
+		return r.Target
+	}
+	return r.From + float32(math.Copysign(step, diff))
+}
+
+// ValidateAOSlewRates checks slew rate rules for missing channels and non-positive rates
+func ValidateAOSlewRates(rules []config.AOSlewRate) error {
+	var p configProblems
+	validateAOSlewRates(rules, &p)
+	return p.err()
+}
+
+func validateAOSlewRates(rules []config.AOSlewRate, p *configProblems) {
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		path := fmt.Sprintf("ao_slew_rates[%d]", i)
+		if rule.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if rule.Index < 0 {
+			p.add(path+".index", "must not be negative")
+		}
+		key := fmt.Sprintf("%s/%d", rule.Card, rule.Index)
+		if seen[key] {
+			p.add(path, "duplicate rule for card %s AO%d", rule.Card, rule.Index)
+		}
+		seen[key] = true
+		if rule.MaxPerSec <= 0 {
+			p.add(path+".max_per_sec", "must be positive")
+		}
+	}
+}
+
+// GetAOSlewRates returns the active slew rate rules
+func (m *Manager) GetAOSlewRates() []config.AOSlewRate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]config.AOSlewRate, len(m.slewRates))
+	copy(rules, m.slewRates)
+	return rules
+}
+
+// SetAOSlewRates validates, activates, and persists a new set of slew rate rules. Running ramps keep
+// their rate.
+func (m *Manager) SetAOSlewRates(rules []config.AOSlewRate) error {
+	return m.SetAOSlewRatesContext(context.Background(), rules)
+}
+
+// SetAOSlewRatesContext is SetAOSlewRates with the change attributed in the config history to the change of
+// ctx (see config.WithChange)
+func (m *Manager) SetAOSlewRatesContext(ctx context.Context, rules []config.AOSlewRate) error {
+	if err := ValidateAOSlewRates(rules); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.slewRates = rules
+	m.mu.Unlock()
+
+	return config.UpdateContext(ctx, func(c *config.Config) {
+		c.AOSlewRates = rules
+	})
+}
+
+// GetAORamps returns the AO ramps in progress
+func (m *Manager) GetAORamps() []AORamp {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]AORamp, 0, len(m.ramps))
+	for _, r := range m.ramps {
+		out = append(out, r.AORamp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CardID != out[j].CardID {
+			idi, _ := strconv.Atoi(out[i].CardID)
+			idj, _ := strconv.Atoi(out[j].CardID)
+			return idi < idj
+		}
+		return out[i].Channel < out[j].Channel
+	})
+	return out
+}
+
+// startRamp turns an AO write on a channel with a slew rate into a ramp from the current value. It
+// returns false if the write is performed as is: another type, a ramp step, no rule, or no change. A dry
+// run only returns the message.
+func (m *Manager) startRamp(op writeOperation, card *Card, dry bool) (string, bool) {
+	if op.Type != writeOpAO || op.ramp != nil {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rule *config.AOSlewRate
+	for i := range m.slewRates {
+		if m.slewRates[i].Card == op.CardID && m.slewRates[i].Index == op.Index {
+			rule = &m.slewRates[i]
+			break
+		}
+	}
+	if rule == nil {
+		return "", false
+	}
+	now := time.Now()
+	key := op.CardID + "/" + ChannelKey(op.Type, op.Index)
+	var current float32
+	if r, ok := m.ramps[key]; ok {
+		current = r.at(now)
+	} else if op.Index < len(card.Last.AO) {
+		current = card.Last.AO[op.Index]
+	} else {
+		return "", false
+	}
+	if !dry {
+		delete(m.ramps, key)
+	}
+	if current == op.Value {
+		return "", false
+	}
+	msg := fmt.Sprintf("ramping from %g to %g at %g/s", current, op.Value, rule.MaxPerSec)
+	if dry {
+		return msg, true
+	}
+
+	m.ramps[key] = &aoRamp{
+		AORamp: AORamp{
+			CardID:    op.CardID,
+			Channel:   ChannelKey(op.Type, op.Index),
+			From:      current,
+			Target:    op.Value,
+			Value:     current,
+			MaxPerSec: rule.MaxPerSec,
+			Started:   now,
+			Source:    op.source,
+		},
+		index: op.Index,
+	}
+	return msg, true
+}
+
+// advanceRamps writes the next value of every AO ramp; ramps end at their target or when a step fails
+func (m *Manager) advanceRamps() {
+	m.mu.Lock()
+	if len(m.ramps) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	keys := make([]string, 0, len(m.ramps))
+	ops := make([]writeOperation, 0, len(m.ramps))
+	for key, r := range m.ramps {
+		keys = append(keys, key)
+		ops = append(ops, writeOperation{
+			CardID: r.CardID,
+			Type:   writeOpAO,
+			Index:  r.index,
+			Value:  r.at(now),
+			source: r.Source,
+			ramp:   r,
+		})
+	}
+	m.mu.Unlock()
+
+	results := m.ProcessBatchWrite(ops)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, key := range keys {
+		r, ok := m.ramps[key]
+		if !ok || r.Started.After(now) {
+			continue // Replaced by a newer write meanwhile
+		}
+		r.Value = ops[i].Value
+		if results[i].Status != "ok" || r.Value == r.Target {
+			delete(m.ramps, key)
+		}
+	}
+}
+
+// rampActive reports whether r is still the ramp of its channel, i.e. it wasn't replaced or stopped
+func (m *Manager) rampActive(r *aoRamp) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ramps[r.CardID+"/"+r.Channel] == r
+}
+
+// cancelRamps stops the AO ramps of a card, e.g. when it is put into safe state
+func (m *Manager) cancelRamps(cardID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, r := range m.ramps {
+		if r.CardID == cardID {
+			delete(m.ramps, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package localio
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestAOSlewRates(t *testing.T) {
+	configtest.Isolate(t)
+
+	regs := make([]byte, 16)
+	client := newIO0404Client()
+	client.ReadHoldingRegistersFunc = func(address, quantity uint16) ([]byte, error) {
+		if address == 0 {
+			return append([]byte(nil), regs[:quantity*2]...), nil
+		}
+		return make([]byte, quantity*2), nil
+	}
+	client.WriteMultipleRegistersFunc = func(address, quantity uint16, value []byte) ([]byte, error) {
+		if int(address+quantity)*2 <= len(regs) {
+			copy(regs[address*2:], value)
+		}
+		return nil, nil
+	}
+	ao := func(i int) float32 { return math.Float32frombits(binary.BigEndian.Uint32(regs[i*4:])) }
+
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO0404")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	if err := mgr.SetAOSlewRates([]config.AOSlewRate{{Card: card.ID, Index: 0}}); ErrorCodeOf(err) != CodeInvalidRequest {
+		t.Errorf("Expected INVALID_REQUEST for a zero rate, got %v", err)
+	}
+	if err := mgr.SetAOSlewRates([]config.AOSlewRate{{Card: card.ID, Index: 0, MaxPerSec: 10000}}); err != nil {
+		t.Fatalf("SetAOSlewRates failed: %v", err)
+	}
+
+	// A step on AO0 becomes a ramp; AO1 has no limit and is written at once
+	results := mgr.ProcessBatchWrite([]WriteOperation{
+		{CardID: card.ID, Type: WriteOpAO, Index: 0, Value: 1000},
+		{CardID: card.ID, Type: WriteOpAO, Index: 1, Value: 1000},
+	})
+	if results[0].Status != "ok" || !strings.HasPrefix(results[0].Message, "ramping") {
+		t.Errorf("Expected AO0 to ramp, got %+v", results[0])
+	}
+	if ao(0) != 0 || ao(1) != 1000 {
+		t.Errorf("Expected AO0 0 and AO1 1000, got %g and %g", ao(0), ao(1))
+	}
+	if ramps := mgr.GetAORamps(); len(ramps) != 1 || ramps[0].Channel != "ao0" || ramps[0].Target != 1000 {
+		t.Fatalf("Expected a ramp of ao0 to 1000, got %+v", ramps)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if v := ao(0); v <= 0 || v >= 1000 {
+		t.Errorf("Expected AO0 between 0 and 1000 during the ramp, got %g", v)
+	}
+	time.Sleep(100 * time.Millisecond)
+	mgr.ReadAllAndProcessWrites()
+	if ao(0) != 1000 || len(mgr.GetAORamps()) != 0 {
+		t.Errorf("Expected AO0 at 1000 and the ramp done, got %g and %+v", ao(0), mgr.GetAORamps())
+	}
+
+	// Safe state is applied at once and stops the ramp
+	mgr.ProcessBatchWrite([]WriteOperation{{CardID: card.ID, Type: WriteOpAO, Index: 0, Value: 0}})
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	if len(mgr.GetAORamps()) != 0 {
+		t.Errorf("Expected no ramps after safe state, got %+v", mgr.GetAORamps())
+	}
+
+	// A ramp step taken before safe state is dropped instead of written after it
+	src := WriteSource{Kind: SourceTCP, ID: "10.0.0.9"}
+	mgr.ProcessBatchWriteContext(WithSource(context.Background(), src), []WriteOperation{{CardID: card.ID, Type: WriteOpAO, Index: 0, Value: 1000}})
+	mgr.mu.Lock()
+	r := mgr.ramps[card.ID+"/ao0"]
+	mgr.mu.Unlock()
+	if r == nil {
+		t.Fatal("Expected a ramp of ao0")
+	}
+	step := writeOperation{CardID: card.ID, Type: writeOpAO, Index: 0, Value: 500, source: src, ramp: r}
+	if err := mgr.WriteAllOutputsToSafeState(); err != nil {
+		t.Fatalf("WriteAllOutputsToSafeState failed: %v", err)
+	}
+	if results := mgr.ProcessBatchWrite([]writeOperation{step}); results[0].Code != CodeConflict || ao(0) != 0 {
+		t.Errorf("Expected the stale ramp step dropped, got %+v and AO0 %g", results[0], ao(0))
+	}
+
+	// Releasing the source of a ramp stops it
+	mgr.ProcessBatchWriteContext(WithSource(context.Background(), src), []WriteOperation{{CardID: card.ID, Type: WriteOpAO, Index: 0, Value: 1000}})
+	if len(mgr.GetAORamps()) != 1 {
+		t.Fatalf("Expected a ramp, got %+v", mgr.GetAORamps())
+	}
+	mgr.ReleaseSource(src)
+	if len(mgr.GetAORamps()) != 0 {
+		t.Errorf("Expected the ramp stopped with its source released, got %+v", mgr.GetAORamps())
+	}
+}
@@ -0,0 +1,97 @@
+package localio
+
+import "time"
+
+// Snapshot is the state of a set of cards at the end of one poll cycle. Reading several cards from
+// GET /api/jaspermate-io can mix states of different cycles; a snapshot doesn't.
+type Snapshot struct {
+	BootID string `json:"bootId"`
+	// Cycle is the number of the poll cycle, counted from the service start
+	Cycle   uint64    `json:"cycle"`
+	TakenAt time.Time `json:"takenAt"`
+	Cards   []*Card   `json:"cards"`
+	// Stale lists the cards whose state is from an older cycle, since their read in this cycle failed or
+	// was skipped
+	Stale []StaleCard `json:"stale"`
+}
+
+// StaleCard is a card of a snapshot whose state wasn't read in the snapshot's cycle
+type StaleCard struct {
+	CardID string `json:"cardId"`
+	// Cycle is the last cycle that read the card (0 = none since discovery)
+	Cycle uint64 `json:"cycle"`
+}
+
+// cycleSnapshot is the state of every card at the end of the last completed cycle
+type cycleSnapshot struct {
+	cycle   uint64
+	takenAt time.Time
+	cards   []Card            // Copies; their state slices are never modified in place
+	read    map[string]uint64 // Last cycle that read each card
+}
+
+// beginCycle numbers a new poll cycle
+func (m *Manager) beginCycle() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cycle++
+	return m.cycle
+}
+
+// markRead records that a card was read in a cycle
+func (m *Manager) markRead(cardID string, cycle uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readCycles[cardID] = cycle
+}
+
+// takeSnapshot keeps the state of every card at the end of a cycle
+func (m *Manager) takeSnapshot(cycle uint64, cards []*Card) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := &cycleSnapshot{cycle: cycle, takenAt: time.Now(), cards: make([]Card, len(cards)), read: make(map[string]uint64, len(cards))}
+	for i, c := range cards {
+		snap.cards[i] = *c
+		snap.read[c.ID] = m.readCycles[c.ID]
+	}
+	m.snapshot = snap
+}
+
+// GetSnapshot returns the state of the cards with the given IDs (all cards if none are given) at the end
+// of the last completed poll cycle
+func (m *Manager) GetSnapshot(cardIDs []string) (Snapshot, error) {
+	m.mu.Lock()
+	snap := m.snapshot
+	m.mu.Unlock()
+	if snap == nil {
+		return Snapshot{}, errorf(CodeConflict, "no poll cycle has completed yet")
+	}
+
+	out := Snapshot{BootID: m.BootID(), Cycle: snap.cycle, TakenAt: snap.takenAt, Cards: []*Card{}, Stale: []StaleCard{}}
+	include := func(c *Card) {
+		out.Cards = append(out.Cards, c)
+		if read := snap.read[c.ID]; read != snap.cycle {
+			out.Stale = append(out.Stale, StaleCard{CardID: c.ID, Cycle: read})
+		}
+	}
+	if len(cardIDs) == 0 {
+		for i := range snap.cards {
+			include(&snap.cards[i])
+		}
+		return out, nil
+	}
+	for _, id := range cardIDs {
+		found := false
+		for i := range snap.cards {
+			if snap.cards[i].ID == id {
+				include(&snap.cards[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return Snapshot{}, errorf(CodeCardNotFound, "card %s not found in cycle %d", id, snap.cycle).with("cardId", id)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,65 @@
+package localio
+
+import (
+	"errors"
+	"testing"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestSnapshot(t *testing.T) {
+	configtest.Isolate(t)
+
+	handler := &MockClientHandler{}
+	failing := false
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			if handler.SlaveID == 2 && failing {
+				return nil, errors.New("timeout")
+			}
+			return []byte{0}, nil
+		},
+	}
+	mgr := newMockManager(client)
+	mgr.handlerFactory = func(path string, cfg serialCfg) (ModbusHandler, error) { return handler, nil }
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if _, err := mgr.AddCard("/dev/ttyUSB0", 2, "IO4040"); err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if _, err := mgr.GetSnapshot(nil); ErrorCodeOf(err) != CodeConflict {
+		t.Fatalf("Expected CONFLICT before the first cycle, got %v", err)
+	}
+
+	mgr.ReadAllAndProcessWrites()
+	snap, err := mgr.GetSnapshot([]string{"2", "1"})
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	if snap.Cycle != 1 || len(snap.Cards) != 2 || snap.Cards[0].ID != "2" || len(snap.Stale) != 0 {
+		t.Fatalf("Expected both cards fresh in cycle 1, got %+v", snap)
+	}
+	seq := snap.Cards[1].Last.Seq
+
+	// A failed read leaves the card's state from the earlier cycle
+	failing = true
+	mgr.ReadAllAndProcessWrites()
+	if seq != snap.Cards[1].Last.Seq {
+		t.Errorf("Expected the earlier snapshot to stay unchanged")
+	}
+	snap, err = mgr.GetSnapshot(nil)
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	if snap.Cycle != 2 || len(snap.Cards) != 2 {
+		t.Fatalf("Expected both cards in cycle 2, got %+v", snap)
+	}
+	if len(snap.Stale) != 1 || snap.Stale[0] != (StaleCard{CardID: "2", Cycle: 1}) {
+		t.Errorf("Expected card 2 stale since cycle 1, got %+v", snap.Stale)
+	}
+
+	if _, err := mgr.GetSnapshot([]string{"1", "9"}); ErrorCodeOf(err) != CodeCardNotFound {
+		t.Errorf("Expected CARD_NOT_FOUND for an unknown card, got %v", err)
+	}
+}
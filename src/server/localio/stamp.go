@@ -0,0 +1,34 @@
+package localio
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// stateClock numbers the card states of a service run. Wall clock timestamps can jump with NTP
+// corrections; the sequence and the monotonic time can't, and the boot ID tells runs apart.
+type stateClock struct {
+	bootID  string
+	started time.Time // Carries the monotonic clock reading
+	seq     uint64
+}
+
+func newStateClock() stateClock {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return stateClock{bootID: hex.EncodeToString(b), started: time.Now()}
+}
+
+// BootID identifies this run of the service; the state sequence numbers restart with a new boot ID
+func (m *Manager) BootID() string {
+	return m.clock.bootID
+}
+
+// stampLocked gives a new card state the next sequence number and its monotonic time; the caller must
+// hold m.mu
+func (m *Manager) stampLocked(state *CardState) {
+	m.clock.seq++
+	state.Seq = m.clock.seq
+	state.MonotonicMs = time.Since(m.clock.started).Milliseconds()
+}
@@ -0,0 +1,27 @@
+package localio
+
+import "testing"
+
+func TestStateSequence(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+	card1, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	card2, _ := mgr.AddCard("/dev/ttyUSB0", 2, "IO4040")
+	if card1.Last.Seq == 0 || card2.Last.Seq <= card1.Last.Seq {
+		t.Fatalf("Expected increasing sequence numbers across cards, got %d and %d", card1.Last.Seq, card2.Last.Seq)
+	}
+
+	before := card2.Last
+	mgr.ReadAllAndProcessWrites()
+	if card1.Last.Seq <= before.Seq || card2.Last.Seq <= card1.Last.Seq {
+		t.Errorf("Expected the new states to continue the sequence after %d, got %d and %d", before.Seq, card1.Last.Seq, card2.Last.Seq)
+	}
+	if card2.Last.MonotonicMs < before.MonotonicMs {
+		t.Errorf("Expected the monotonic time not to go back, got %d after %d", card2.Last.MonotonicMs, before.MonotonicMs)
+	}
+	if len(mgr.BootID()) != 16 || NewManager().BootID() == mgr.BootID() {
+		t.Errorf("Expected a random boot ID per manager, got %q", mgr.BootID())
+	}
+}
@@ -0,0 +1,66 @@
+package localio
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"jaspermate-utils/src/server/telemetry"
+)
+
+// queuedOperation stamps an operation with the trace context and time it was queued
+func queuedOperation(ctx context.Context, op writeOperation) writeOperation {
+	if ctx != nil && trace.SpanContextFromContext(ctx).IsValid() {
+		op.ctx = telemetry.Detach(ctx)
+	}
+	op.queuedAt = time.Now()
+	if op.source.Kind == "" {
+		op.source = sourceFrom(ctx)
+	}
+	return op
+}
+
+// startBatchSpan starts the span of a batch write. Queued operations get a "localio.queue-wait" span in
+// the trace of the request that queued them, and the batch span links to those requests.
+func startBatchSpan(ctx context.Context, ops []writeOperation) (context.Context, trace.Span) {
+	now := time.Now()
+	var links []trace.Link
+	for _, op := range ops {
+		if op.ctx == nil {
+			continue
+		}
+		_, wait := telemetry.Tracer().Start(op.ctx, "localio.queue-wait",
+			trace.WithTimestamp(op.queuedAt),
+			trace.WithAttributes(attribute.String("card.id", op.CardID), attribute.Int("channel.index", op.Index)))
+		wait.End(trace.WithTimestamp(now))
+		links = append(links, trace.Link{SpanContext: trace.SpanContextFromContext(op.ctx)})
+	}
+	return telemetry.Tracer().Start(ctx, "localio.batch-write",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("operations", len(ops))))
+}
+
+// startBusSpan starts the span of a Modbus write transaction
+func startBusSpan(ctx context.Context, name string, card *Card, ops int) (context.Context, trace.Span) {
+	return telemetry.Tracer().Start(ctx, name, trace.WithAttributes(
+		attribute.String("card.id", card.ID),
+		attribute.String("card.module", card.Module),
+		attribute.String("modbus.port", card.PortPath),
+		attribute.Int("modbus.slave_id", int(card.SlaveID)),
+		attribute.Int("operations", ops),
+	))
+}
+
+// endBusSpan marks the bus span as failed if any operation failed
+func endBusSpan(span trace.Span, results []CommandResult) {
+	for _, r := range results {
+		if r.Status == "error" {
+			span.SetAttributes(attribute.String("error.code", string(r.Code)))
+			span.SetStatus(codes.Error, r.Message)
+			return
+		}
+	}
+}
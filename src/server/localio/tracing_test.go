@@ -0,0 +1,55 @@
+package localio
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing_QueuedWrite(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	mgr := newMockManager(&MockClient{
+		ReadDiscreteInputsFunc:   func(address, quantity uint16) ([]byte, error) { return []byte{0}, nil },
+		ReadCoilsFunc:            func(address, quantity uint16) ([]byte, error) { return []byte{0}, nil },
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) { return make([]byte, 20), nil },
+	})
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "IO4040")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+
+	ctx, request := tp.Tracer("test").Start(context.Background(), "request")
+	if err := mgr.QueueWriteDOContext(ctx, card.ID, 1, true); err != nil {
+		t.Fatalf("QueueWriteDOContext failed: %v", err)
+	}
+	request.End()
+	mgr.ProcessWriteQueue()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	wait, ok := spans["localio.queue-wait"]
+	if !ok {
+		t.Fatalf("Expected a queue-wait span, got %v", spans)
+	}
+	if wait.SpanContext().TraceID() != request.SpanContext().TraceID() {
+		t.Error("Expected the queue-wait span in the request's trace")
+	}
+	batch, ok := spans["localio.batch-write"]
+	if !ok || len(batch.Links()) != 1 {
+		t.Fatalf("Expected a batch-write span linked to the request, got %v", spans)
+	}
+	bus, ok := spans["modbus.write-do"]
+	if !ok || bus.Parent().SpanID() != batch.SpanContext().SpanID() {
+		t.Errorf("Expected a modbus.write-do span under the batch span, got %v", spans)
+	}
+}
@@ -0,0 +1,229 @@
+package localio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// TrafficEntry is one request/response pair of a Modbus traffic log (JSON Lines).
+// Request and Response are the hex encoded RTU frames including slave ID and CRC.
+type TrafficEntry struct {
+	Time     time.Time `json:"time"`
+	Port     string    `json:"port"`
+	Request  string    `json:"request"`
+	Response string    `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// recordingHandler logs every request/response pair of the wrapped handler
+type recordingHandler struct {
+	ModbusHandler
+	port string
+	mu   *sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewRecordingHandler wraps h so that every request/response pair on the given port is written to w
+func NewRecordingHandler(h ModbusHandler, port string, w io.Writer) ModbusHandler {
+	return &recordingHandler{ModbusHandler: h, port: port, mu: &sync.Mutex{}, enc: json.NewEncoder(w)}
+}
+
+func (r *recordingHandler) Send(aduRequest []byte) ([]byte, error) {
+	aduResponse, err := r.ModbusHandler.Send(aduRequest)
+	entry := TrafficEntry{
+		Time:     time.Now(),
+		Port:     r.port,
+		Request:  hex.EncodeToString(aduRequest),
+		Response: hex.EncodeToString(aduResponse),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.mu.Lock()
+	if encErr := r.enc.Encode(entry); encErr != nil {
+		log.Printf("modbus traffic log: %v", encErr)
+	}
+	r.mu.Unlock()
+	return aduResponse, err
+}
+
+// RecordingHandlerFactory wraps factory so that the traffic of all ports is appended to w
+func RecordingHandlerFactory(factory HandlerFactory, w io.Writer) HandlerFactory {
+	mu := &sync.Mutex{}
+	enc := json.NewEncoder(w)
+	return func(path string, cfg serialCfg) (ModbusHandler, error) {
+		h, err := factory(path, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingHandler{ModbusHandler: h, port: path, mu: mu, enc: enc}, nil
+	}
+}
+
+// ReadTraffic parses a Modbus traffic log
+func ReadTraffic(r io.Reader) ([]TrafficEntry, error) {
+	var entries []TrafficEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e TrafficEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// replayHandler serves recorded responses instead of talking to a serial port
+type replayHandler struct {
+	*modbus.RTUClientHandler
+	mu      sync.Mutex
+	entries []TrafficEntry
+	used    []bool
+	timeout time.Duration
+}
+
+// NewReplayHandler returns a handler answering each request with the first unused recorded
+// response to the same request frame. Requests that were not recorded fail.
+func NewReplayHandler(entries []TrafficEntry) ModbusHandler {
+	return &replayHandler{
+		RTUClientHandler: modbus.NewRTUClientHandler(""),
+		entries:          entries,
+		used:             make([]bool, len(entries)),
+	}
+}
+
+// ReplayHandlerFactory creates replay handlers serving the entries recorded on each port
+func ReplayHandlerFactory(entries []TrafficEntry) HandlerFactory {
+	return func(path string, cfg serialCfg) (ModbusHandler, error) {
+		var own []TrafficEntry
+		for _, e := range entries {
+			if e.Port == path {
+				own = append(own, e)
+			}
+		}
+		h := NewReplayHandler(own)
+		h.SetTimeout(cfg.Timeout)
+		return h, nil
+	}
+}
+
+func (r *replayHandler) Connect() error { return nil }
+
+func (r *replayHandler) Close() error { return nil }
+
+func (r *replayHandler) SetSlave(slave byte) {
+	r.SlaveId = slave
+}
+
+func (r *replayHandler) Timeout() time.Duration {
+	return r.timeout
+}
+
+func (r *replayHandler) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+func (r *replayHandler) Send(aduRequest []byte) ([]byte, error) {
+	request := hex.EncodeToString(aduRequest)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.entries {
+		if r.used[i] || e.Request != request {
+			continue
+		}
+		r.used[i] = true
+		if e.Error != "" {
+			// Keep timeouts recognisable so errors classify as on the real bus
+			if e.Error == serial.ErrTimeout.Error() {
+				return nil, serial.ErrTimeout
+			}
+			return nil, fmt.Errorf("%s", e.Error)
+		}
+		return hex.DecodeString(e.Response)
+	}
+	return nil, fmt.Errorf("replay: no recorded response for %s", request)
+}
+
+// trafficLog is the Modbus traffic log file, rotated when it exceeds maxBytes into .1, .2, ... and keeping
+// at most files files, so a log left enabled doesn't fill the data partition
+type trafficLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	files    int
+	f        *os.File
+	size     int64
+}
+
+// openTrafficLog opens the Modbus traffic log for appending; relative paths are in the data directory
+func openTrafficLog(path string, maxBytes int64, files int) (*trafficLog, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.DataDir(), path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	t := &trafficLog{path: path, maxBytes: maxBytes, files: max(files, 1)}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *trafficLog) open() error {
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.f, t.size = f, info.Size()
+	return nil
+}
+
+// Write appends an entry, rotating the log first if the entry would take it past maxBytes. Each entry is
+// written in one call, so files are rotated between entries.
+func (t *trafficLog) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		if err := t.open(); err != nil {
+			return 0, err
+		}
+	}
+	if t.size > 0 && t.size+int64(len(p)) > t.maxBytes {
+		t.f.Close()
+		t.f = nil
+		if err := shiftFiles(t.path, t.files); err != nil {
+			return 0, err
+		}
+		if err := t.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := t.f.Write(p)
+	t.size += int64(n)
+	return n, err
+}
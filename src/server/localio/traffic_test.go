@@ -0,0 +1,110 @@
+package localio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// coilCard answers every request with four coils where DO0 and DO2 are on
+type coilCard struct {
+	*modbus.RTUClientHandler
+	fail bool
+}
+
+func (c *coilCard) Connect() error             { return nil }
+func (c *coilCard) Close() error               { return nil }
+func (c *coilCard) SetSlave(slave byte)        { c.SlaveId = slave }
+func (c *coilCard) Timeout() time.Duration     { return 0 }
+func (c *coilCard) SetTimeout(d time.Duration) {}
+
+func (c *coilCard) Send(aduRequest []byte) ([]byte, error) {
+	if c.fail {
+		return nil, serial.ErrTimeout
+	}
+	req, err := c.Decode(aduRequest)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encode(&modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: []byte{1, 0x05}})
+}
+
+func TestTraffic_RecordAndReplay(t *testing.T) {
+	card := &coilCard{RTUClientHandler: modbus.NewRTUClientHandler("")}
+	card.SlaveId = 1
+	var log bytes.Buffer
+	recording := NewRecordingHandler(card, "/dev/ttyUSB0", &log)
+
+	if _, err := modbus.NewClient(recording).ReadCoils(0, 4); err != nil {
+		t.Fatalf("ReadCoils failed: %v", err)
+	}
+	card.fail = true
+	if _, err := modbus.NewClient(recording).ReadCoils(4, 4); err == nil {
+		t.Fatal("Expected the failing read to return an error")
+	}
+
+	entries, err := ReadTraffic(&log)
+	if err != nil {
+		t.Fatalf("ReadTraffic failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Port != "/dev/ttyUSB0" || entries[0].Response == "" || entries[1].Error == "" {
+		t.Fatalf("Expected a response and an error entry, got %+v", entries)
+	}
+
+	replay, err := ReplayHandlerFactory(entries)("/dev/ttyUSB0", serialCfg{})
+	if err != nil {
+		t.Fatalf("ReplayHandlerFactory failed: %v", err)
+	}
+	replay.SetSlave(1)
+	client := modbus.NewClient(replay)
+	results, err := client.ReadCoils(0, 4)
+	if err != nil || len(results) != 1 || results[0] != 0x05 {
+		t.Errorf("Expected the recorded coils 0x05, got %v (%v)", results, err)
+	}
+	if _, err := client.ReadCoils(4, 4); ErrorCodeOf(err) != CodeBusTimeout {
+		t.Errorf("Expected the recorded timeout, got %v", err)
+	}
+
+	// Each recorded response is served once
+	if _, err := client.ReadCoils(0, 4); err == nil {
+		t.Error("Expected an error replaying a request more often than recorded")
+	}
+
+	// Other ports have no recorded traffic
+	other, _ := ReplayHandlerFactory(entries)("/dev/ttyUSB1", serialCfg{})
+	other.SetSlave(1)
+	if _, err := modbus.NewClient(other).ReadCoils(0, 4); err == nil {
+		t.Error("Expected an error replaying a port without traffic")
+	}
+}
+
+func TestTraffic_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	tl, err := openTrafficLog(path, 100, 2)
+	if err != nil {
+		t.Fatalf("openTrafficLog failed: %v", err)
+	}
+	defer tl.f.Close()
+
+	// Entries are never split; the log is rotated before the one that doesn't fit, the oldest file dropped
+	entry := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 5; i++ {
+		if _, err := tl.Write(entry); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	for i, want := range []int64{60, 60} {
+		if info, err := os.Stat(rotatedFile(path, i)); err != nil || info.Size() != want {
+			t.Errorf("Expected file %d of %d bytes, got %v %v", i, want, info, err)
+		}
+	}
+	if _, err := os.Stat(rotatedFile(path, 2)); !os.IsNotExist(err) {
+		t.Errorf("Expected at most 2 files, got %v", err)
+	}
+}
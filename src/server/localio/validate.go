@@ -0,0 +1,399 @@
+package localio
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// aoRawMax is the largest raw AO value (20 mA * 1000)
+const aoRawMax = 20000
+
+// standardBaudRates are the serial baud rates supported by the cards
+var standardBaudRates = map[int]bool{
+	1200: true, 2400: true, 4800: true, 9600: true, 19200: true, 38400: true, 57600: true, 115200: true,
+}
+
+// ConfigProblem is a single configuration error. Path is the YAML field path (e.g. "pid_loops[0].out_max").
+type ConfigProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p ConfigProblem) Error() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// configProblems collects every problem found instead of stopping at the first one
+type configProblems []ConfigProblem
+
+func (p *configProblems) add(path, format string, args ...interface{}) {
+	*p = append(*p, ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the first problem as an INVALID_REQUEST error, or nil
+func (p configProblems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return errorf(CodeInvalidRequest, "%s", p[0].Error())
+}
+
+// ValidateConfig checks the whole configuration and returns every problem found (empty if valid).
+// The manager's safe-state values are checked as well.
+func (m *Manager) ValidateConfig(cfg config.Config) []ConfigProblem {
+	m.mu.Lock()
+	safe := m.safeStateConfig
+	m.mu.Unlock()
+
+	p := configProblems{}
+	validateSettings(cfg, &p)
+	validateSlaveAssignments(cfg.SlaveAssignments, &p)
+	validateControlLock(cfg.ControlLock, &p)
+	validatePIDLoops(cfg.PIDLoops, &p)
+	validateInterlocks(cfg.Interlocks, &p)
+	validateWritePermissions(cfg.WritePermissions, &p)
+	validatePoints(cfg.Points, &p)
+	validateDOTimings(cfg.DOTimings, &p)
+	validateAOSlewRates(cfg.AOSlewRates, &p)
+	validateHeartbeatOutput(cfg.HeartbeatOutput, &p)
+	validatePulseChannels(cfg.PulseChannels, &p)
+	validateAlarmRules(cfg.Alarms, &p)
+	validateNotifications(cfg.Notifications, &p)
+	validateMaintenanceWindows(cfg.MaintenanceWindows, &p)
+	validateMQTT(cfg.MQTT, &p)
+	validateNATS(cfg.NATS, &p)
+	validateRedis(cfg.Redis, &p)
+	validateCloudTwin(cfg.CloudTwin, &p)
+	validateDisabledChannels(cfg.DisabledChannels, &p)
+	validatePriorityChannels(cfg.PriorityChannels, &p)
+	validateCurrentLoopInputs(cfg.CurrentLoopInputs, &p)
+	validateSequences(cfg.Sequences, &p)
+	validateLocation(cfg.Location, &p)
+	validateSchedules(cfg.Schedules, cfg.Location, &p)
+	validateCalendar(cfg.Calendar, &p)
+	validateScripts(cfg.Scripts, &p)
+	validateSafeState(safe, &p)
+	return p
+}
+
+func validateMQTT(m config.MQTTConfig, p *configProblems) {
+	if m.Broker == "" {
+		return
+	}
+	u, err := url.Parse(m.Broker)
+	if err != nil || u.Host == "" || !slices.Contains([]string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}, u.Scheme) {
+		p.add("mqtt.broker", "must be a broker URL, e.g. tcp://broker:1883 or ssl://broker:8883")
+	}
+	if strings.ContainsAny(m.TopicPrefix, "+#") {
+		p.add("mqtt.topic_prefix", "must not contain wildcards")
+	}
+	if m.PublishIntervalMs < 0 {
+		p.add("mqtt.publish_interval_ms", "must not be negative")
+	}
+}
+
+func validateNATS(n config.NATSConfig, p *configProblems) {
+	if n.URL == "" {
+		return
+	}
+	for _, server := range strings.Split(n.URL, ",") {
+		u, err := url.Parse(strings.TrimSpace(server))
+		if err != nil || u.Host == "" || !slices.Contains([]string{"nats", "tls", "ws", "wss"}, u.Scheme) {
+			p.add("nats.url", "%q is not a server URL, e.g. nats://nats:4222", server)
+		}
+	}
+	if strings.ContainsAny(n.SubjectPrefix, "*> \t") {
+		p.add("nats.subject_prefix", "must not contain wildcards or whitespace")
+	}
+	if n.PublishIntervalMs < 0 {
+		p.add("nats.publish_interval_ms", "must not be negative")
+	}
+}
+
+func validateRedis(r config.RedisConfig, p *configProblems) {
+	if r.Addr == "" {
+		return
+	}
+	if _, port, err := net.SplitHostPort(r.Addr); err != nil || port == "" {
+		p.add("redis.addr", "%q is not a host:port address, e.g. localhost:6379", r.Addr)
+	}
+	if r.DB < 0 {
+		p.add("redis.db", "must not be negative")
+	}
+	if strings.ContainsAny(r.KeyPrefix, "*?[ \t") {
+		p.add("redis.key_prefix", "must not contain glob patterns or whitespace")
+	}
+	if r.IntervalMs < 0 {
+		p.add("redis.interval_ms", "must not be negative")
+	}
+}
+
+func validateCloudTwin(t config.CloudTwinConfig, p *configProblems) {
+	switch t.Provider {
+	case "":
+		return
+	case "azure":
+		if t.DeviceKey == "" && t.CertFile == "" {
+			p.add("cloud_twin.device_key", "a device key or certificate (cert_file and key_file) is required")
+		}
+	case "aws":
+		if t.CertFile == "" {
+			p.add("cloud_twin.cert_file", "a device certificate (cert_file and key_file) is required")
+		}
+	default:
+		p.add("cloud_twin.provider", "unknown provider %q (use azure or aws)", t.Provider)
+	}
+	if t.Host == "" {
+		p.add("cloud_twin.host", "host is required")
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		p.add("cloud_twin.key_file", "cert_file and key_file must be set together")
+	}
+	if t.ReportIntervalMs < 0 {
+		p.add("cloud_twin.report_interval_ms", "must not be negative")
+	}
+}
+
+func validateSettings(cfg config.Config, p *configProblems) {
+	if cfg.SerialBaud != 0 && !standardBaudRates[cfg.SerialBaud] {
+		p.add("serial_baud", "unsupported baud rate %d (use 1200-115200, e.g. 9600 or 115200)", cfg.SerialBaud)
+	}
+	if cfg.TCPMaxMessageSize < 0 {
+		p.add("tcp_max_message_size", "must not be negative")
+	}
+	if cfg.SlaveIDRegister < 0 || cfg.SlaveIDRegister > 0xFFFF {
+		p.add("slave_id_register", "must be a register address between 0 and 65535")
+	}
+
+	validateSettingValues("settings", cfg.Settings, p)
+	if name := config.ActiveProfile(); name != "" {
+		if _, ok := cfg.Profiles[name]; !ok {
+			p.add("profiles", "active profile %q is not defined", name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		validateSettingValues("profiles."+name, cfg.Profiles[name], p)
+	}
+}
+
+// validateSettingValues checks the settings section or a profile; prefix is the YAML path of the section
+func validateSettingValues(prefix string, s config.Settings, p *configProblems) {
+	for _, port := range []struct {
+		name  string
+		value int
+	}{{"http_port", s.HTTPPort}, {"tcp_port", s.TCPPort}, {"grpc_port", s.GRPCPort}} {
+		if port.value < 0 || port.value > 0xFFFF {
+			p.add(prefix+"."+port.name, "port %d out of range (1-65535)", port.value)
+		}
+	}
+	if s.HTTPPort != 0 && s.HTTPPort == s.TCPPort {
+		p.add(prefix+".tcp_port", "tcp_port must differ from http_port")
+	}
+	if s.GRPCPort != 0 && (s.GRPCPort == s.HTTPPort || s.GRPCPort == s.TCPPort) {
+		p.add(prefix+".grpc_port", "grpc_port must differ from http_port and tcp_port")
+	}
+	if s.MinSlaveID < 0 || s.MinSlaveID > 247 {
+		p.add(prefix+".min_slave_id", "min_slave_id %d out of range (1-247)", s.MinSlaveID)
+	}
+	if s.MaxSlaveID < 0 || s.MaxSlaveID > 247 {
+		p.add(prefix+".max_slave_id", "max_slave_id %d out of range (1-247)", s.MaxSlaveID)
+	}
+	if s.MinSlaveID > 0 && s.MaxSlaveID > 0 && s.MinSlaveID > s.MaxSlaveID {
+		p.add(prefix+".max_slave_id", "max_slave_id (%d) is below min_slave_id (%d)", s.MaxSlaveID, s.MinSlaveID)
+	}
+	if s.HeartbeatURL != "" {
+		if u, err := url.Parse(s.HeartbeatURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add(prefix+".heartbeat_url", "must be an http(s) URL")
+		}
+	}
+	if s.EventLogSeverity != "" && !ValidSeverity(s.EventLogSeverity) {
+		p.add(prefix+".event_log_severity", "unknown severity %q (use info, warning or critical)", s.EventLogSeverity)
+	}
+	if s.TCPEventSeverity != "" && !ValidSeverity(s.TCPEventSeverity) {
+		p.add(prefix+".tcp_event_severity", "unknown severity %q (use info, warning or critical)", s.TCPEventSeverity)
+	}
+	switch s.TCPUpdateMode {
+	case "", config.TCPUpdatePeriodic, config.TCPUpdateChangeOnly:
+	default:
+		p.add(prefix+".tcp_update_mode", "unknown mode %q (use periodic or change-only)", s.TCPUpdateMode)
+	}
+	if s.AIStatsResetTime != "" {
+		if _, err := time.Parse("15:04", s.AIStatsResetTime); err != nil {
+			p.add(prefix+".ai_stats_reset_time", "invalid time %q (use HH:MM)", s.AIStatsResetTime)
+		}
+	}
+	switch s.StartupOutputPolicy {
+	case "", config.StartupOutputsUntouched, config.StartupOutputsSafeState, config.StartupOutputsRestore:
+	default:
+		p.add(prefix+".startup_output_policy", "unknown policy %q (use untouched, safe-state or restore)", s.StartupOutputPolicy)
+	}
+	switch s.TCPSlowClientPolicy {
+	case "", config.SlowClientDisconnect, config.SlowClientDropOldest:
+	default:
+		p.add(prefix+".tcp_slow_client_policy", "unknown policy %q (use disconnect or drop-oldest)", s.TCPSlowClientPolicy)
+	}
+	for i, port := range s.DiscoveryPorts {
+		if _, err := os.Stat(port); err != nil {
+			p.add(fmt.Sprintf("%s.discovery_ports[%d]", prefix, i), "port %s does not exist", port)
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value int
+	}{
+		{"modbus_timeout_ms", s.ModbusTimeoutMs},
+		{"modbus_write_timeout_ms", s.ModbusWriteTimeoutMs},
+		{"probe_timeout_ms", s.ProbeTimeoutMs},
+		{"cycle_delay_ms", s.CycleDelayMs},
+		{"idle_cycle_delay_ms", s.IdleCycleDelayMs},
+		{"operation_delay_ms", s.OperationDelayMs},
+		{"tcp_update_interval_ms", s.TCPUpdateIntervalMs},
+		{"tcp_send_queue_size", s.TCPSendQueueSize},
+		{"tcp_session_grace_ms", s.TCPSessionGraceMs},
+		{"readdress_poll_ms", s.ReaddressPollMs},
+		{"heartbeat_interval_sec", s.HeartbeatIntervalSec},
+		{"relay_wear_limit", s.RelayWearLimit},
+		{"ao_runtime_threshold", s.AORuntimeThreshold},
+		{"failed_card_retry_max_ms", s.FailedCardRetryMaxMs},
+		{"cycle_budget_ms", s.CycleBudgetMs},
+		{"modbus_traffic_log_max_kb", s.ModbusTrafficLogMaxKB},
+		{"modbus_traffic_log_files", s.ModbusTrafficLogFiles},
+		{"journal_max_kb", s.JournalMaxKB},
+		{"journal_files", s.JournalFiles},
+		{"config_history_versions", s.ConfigHistoryVersions},
+		{"idempotency_window_sec", s.IdempotencyWindowSec},
+	} {
+		if d.value < 0 {
+			p.add(prefix+"."+d.name, "must not be negative")
+		}
+	}
+}
+
+func validateControlLock(c config.ControlLock, p *configProblems) {
+	switch c.Policy {
+	case "", config.ControlLockOwner, config.ControlLockBlock, config.ControlLockWarn, config.ControlLockChannels:
+	default:
+		p.add("control_lock.policy", "unknown policy %q (use owner, block, warn, or channels)", c.Policy)
+	}
+	for i, ch := range c.Channels {
+		path := fmt.Sprintf("control_lock.channels[%d]", i)
+		if ch.Card == "" {
+			p.add(path+".card", "card is required")
+		}
+		if !controlChannelPattern.MatchString(ch.Channel) {
+			p.add(path+".channel", "invalid channel %q (use do<n> or ao<n>, e.g. do0)", ch.Channel)
+		}
+	}
+}
+
+// controlChannelPattern matches the output channel names of ChannelKey
+var controlChannelPattern = regexp.MustCompile(`^(do|ao)[0-9]+$`)
+
+func validateSlaveAssignments(assignments []config.SlaveAssignment, p *configProblems) {
+	seen := make(map[string]int)
+	for i, a := range assignments {
+		path := fmt.Sprintf("slave_assignments[%d]", i)
+		if a.Port == "" {
+			p.add(path+".port", "port is required")
+		} else if _, err := os.Stat(a.Port); err != nil {
+			p.add(path+".port", "port %s does not exist", a.Port)
+		}
+		if a.SlaveID < 1 || a.SlaveID > 247 {
+			p.add(path+".slave_id", "slave ID %d out of range (1-247)", a.SlaveID)
+		}
+		if _, _, ok := lookupModel(a.Module); !ok {
+			p.add(path+".module", "unknown module %q", a.Module)
+		}
+		key := fmt.Sprintf("%s/%d", a.Port, a.SlaveID)
+		if first, ok := seen[key]; ok {
+			p.add(path+".slave_id", "slave ID %d on %s is already assigned in slave_assignments[%d]", a.SlaveID, a.Port, first)
+		} else {
+			seen[key] = i
+		}
+	}
+}
+
+func validatePIDLoops(loops []config.PIDLoopConfig, p *configProblems) {
+	names := make(map[string]bool)
+	outputs := make(map[string]int)
+	for i, c := range loops {
+		path := fmt.Sprintf("pid_loops[%d]", i)
+		if c.Name == "" {
+			p.add(path+".name", "name is required")
+		} else if names[c.Name] {
+			p.add(path+".name", "duplicate name %q", c.Name)
+		}
+		names[c.Name] = true
+
+		if c.PVCard == "" {
+			p.add(path+".pv_card", "pv_card is required")
+		}
+		if c.PVIndex < 0 {
+			p.add(path+".pv_index", "must not be negative")
+		}
+		if c.CVCard == "" {
+			p.add(path+".cv_card", "cv_card is required")
+		}
+		if c.CVIndex < 0 {
+			p.add(path+".cv_index", "must not be negative")
+		}
+		if c.OutMin >= c.OutMax {
+			p.add(path+".out_max", "out_max (%g) must be greater than out_min (%g)", c.OutMax, c.OutMin)
+		}
+		if c.OutMin < 0 || c.OutMax > aoRawMax {
+			p.add(path+".out_min", "output limits must be within the AO range 0-%d", aoRawMax)
+		}
+		switch c.Mode {
+		case "", PIDModeAuto:
+		case PIDModeManual:
+			if c.ManualOutput < c.OutMin || c.ManualOutput > c.OutMax {
+				p.add(path+".manual_output", "manual_output %g is outside out_min/out_max", c.ManualOutput)
+			}
+		default:
+			p.add(path+".mode", "unknown mode %q (use %q or %q)", c.Mode, PIDModeAuto, PIDModeManual)
+		}
+
+		if c.CVCard != "" {
+			cv := fmt.Sprintf("%s/%d", c.CVCard, c.CVIndex)
+			if first, ok := outputs[cv]; ok {
+				p.add(path+".cv_index", "AO %d of card %s is already driven by pid_loops[%d]", c.CVIndex, c.CVCard, first)
+			} else {
+				outputs[cv] = i
+			}
+		}
+	}
+}
+
+func validateSafeState(s SafeStateConfig, p *configProblems) {
+	if s.AOVoltageValue < 0 || s.AOVoltageValue > 10 {
+		p.add("safe_state.ao_voltage_value", "%g V is outside the 0-10 V AO range", s.AOVoltageValue)
+	}
+	if s.AOCurrentValue < 4 || s.AOCurrentValue > 20 {
+		p.add("safe_state.ao_current_value", "%g mA is outside the 4-20 mA AO range", s.AOCurrentValue)
+	}
+}
+
+// LogConfigProblems logs every configuration problem, one per line
+func LogConfigProblems(problems []ConfigProblem) {
+	if len(problems) == 0 {
+		return
+	}
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = "  " + problem.Error()
+	}
+	log.Printf("config: %d problem(s) found:\n%s", len(problems), strings.Join(lines, "\n"))
+}
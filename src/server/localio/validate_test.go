@@ -0,0 +1,98 @@
+package localio
+
+import (
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+)
+
+func TestValidateConfig_ReportsAllProblems(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+
+	cfg := config.Config{
+		SerialBaud:        12345,
+		TCPMaxMessageSize: -1,
+		SlaveAssignments: []config.SlaveAssignment{
+			{Port: "/dev/does-not-exist", SlaveID: 2, Module: "IO4040"},
+		},
+		PIDLoops: []config.PIDLoopConfig{
+			{Name: "heat", PVCard: "1", CVCard: "2", OutMin: 0, OutMax: 10000},
+			{Name: "heat", PVCard: "1", CVCard: "2", OutMin: 5000, OutMax: 1000, Mode: "bogus"},
+		},
+		Interlocks: []config.InterlockRule{{Name: "x", Type: "bogus"}},
+		Sequences:  []config.Sequence{{Name: "s", Steps: []config.SequenceStep{{Type: config.StepDelay}}}},
+		MQTT:       config.MQTTConfig{Broker: "broker:1883", TopicPrefix: "site/#"},
+		NATS:       config.NATSConfig{URL: "nats://nats:4222,http://nats2", SubjectPrefix: "site.>"},
+		Redis:      config.RedisConfig{Addr: "localhost", KeyPrefix: "site:*"},
+		CloudTwin:  config.CloudTwinConfig{Provider: "aws", Host: "example.iot.eu-west-1.amazonaws.com"},
+		ControlLock: config.ControlLock{
+			Policy:   "bogus",
+			Channels: []config.ControlChannel{{Card: "1", Channel: "di0"}},
+		},
+	}
+
+	problems := mgr.ValidateConfig(cfg)
+	got := make(map[string]bool)
+	for _, p := range problems {
+		got[p.Path] = true
+	}
+	for _, path := range []string{
+		"serial_baud",
+		"tcp_max_message_size",
+		"slave_assignments[0].port",
+		"pid_loops[1].name",
+		"pid_loops[1].out_max",
+		"pid_loops[1].mode",
+		"pid_loops[1].cv_index",
+		"interlocks[0].type",
+		"sequences[0].steps[0].delay_ms",
+		"control_lock.policy",
+		"control_lock.channels[0].channel",
+		"mqtt.broker",
+		"mqtt.topic_prefix",
+		"nats.url",
+		"nats.subject_prefix",
+		"redis.addr",
+		"redis.key_prefix",
+		"cloud_twin.cert_file",
+	} {
+		if !got[path] {
+			t.Errorf("Expected a problem at %s, got %v", path, problems)
+		}
+	}
+	if got["pid_loops[0].out_max"] {
+		t.Errorf("Did not expect a problem for the valid loop: %v", problems)
+	}
+}
+
+func TestValidateConfig_Valid(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+	cfg := config.Config{
+		SerialBaud: 115200,
+		PIDLoops:   []config.PIDLoopConfig{{Name: "heat", PVCard: "1", CVCard: "2", OutMax: 10000}},
+	}
+	if problems := mgr.ValidateConfig(cfg); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateConfig_SafeState(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+	mgr.safeStateConfig.AOCurrentValue = 2
+	problems := mgr.ValidateConfig(config.Config{})
+	if len(problems) != 1 || problems[0].Path != "safe_state.ao_current_value" {
+		t.Errorf("Expected a safe_state.ao_current_value problem, got %v", problems)
+	}
+}
+
+func TestValidateConfig_Profiles(t *testing.T) {
+	t.Setenv("CM_UTILS_PROFILE", "staging")
+	mgr := newMockManager(&MockClient{})
+	cfg := config.Config{Profiles: map[string]config.Settings{
+		"lab": {MinSlaveID: 300},
+	}}
+	problems := mgr.ValidateConfig(cfg)
+	if len(problems) != 2 || problems[0].Path != "profiles" || problems[1].Path != "profiles.lab.min_slave_id" {
+		t.Errorf("Expected the undefined profile and the lab slave ID range, got %v", problems)
+	}
+}
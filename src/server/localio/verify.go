@@ -0,0 +1,75 @@
+package localio
+
+import (
+	"log"
+	"time"
+)
+
+// Model re-verification defaults
+const (
+	defaultModelCheckInterval = 10 * time.Minute
+	// modelCheckErrorThreshold is the number of consecutive failed reads that triggers a re-probe
+	modelCheckErrorThreshold = 5
+)
+
+// modelCheckDue reports whether the card's model should be re-probed, given the result of the last read.
+// Checks run periodically and after persistent read errors.
+func (m *Manager) modelCheckDue(c *Card, readErr error, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if readErr != nil {
+		c.readFailures++
+		if c.readFailures == modelCheckErrorThreshold {
+			return true
+		}
+	} else {
+		c.readFailures = 0
+	}
+
+	if m.modelCheckInterval <= 0 {
+		return false
+	}
+	if c.lastModelCheck.IsZero() {
+		c.lastModelCheck = now
+		return false
+	}
+	return now.Sub(c.lastModelCheck) >= m.modelCheckInterval
+}
+
+// verifyModel re-runs model probing for a card and flags it if the detected IO layout no longer
+// matches the stored model (e.g. a card was swapped for a different model on the same slave ID).
+// A model-mismatch event is emitted when a mismatch is first detected.
+func (m *Manager) verifyModel(c *Card, pc *portClient) {
+	detected := pc.probe(cardDriver(c), c.SlaveID)
+	spec := cardSpec(c)
+
+	m.mu.Lock()
+	c.lastModelCheck = time.Now()
+	if detected.DI == 0 && detected.DO == 0 && detected.AI == 0 && detected.AO == 0 {
+		// No answer at all: the card is offline, which says nothing about its model
+		m.mu.Unlock()
+		return
+	}
+	matches := detected.DI == spec.DI && detected.DO == spec.DO && detected.AI == spec.AI && detected.AO == spec.AO
+	if matches {
+		if c.DetectedModel != "" {
+			log.Printf("card %s: model %s verified again", c.ID, c.Module)
+		}
+		c.DetectedModel = ""
+		m.mu.Unlock()
+		return
+	}
+	changed := c.DetectedModel != detected.Name
+	c.DetectedModel = detected.Name
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	m.emitEvent(EventModelMismatch, c.ID, map[string]interface{}{
+		"expected": c.Module,
+		"detected": detected.Name,
+		"layout":   detected,
+	})
+}
@@ -0,0 +1,94 @@
+package localio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyModel(t *testing.T) {
+	// Starts as an IO4040 (4 DI, 4 DO); swapped for an IO8000 (8 DI, no DO) later
+	swapped := false
+	client := &MockClient{
+		ReadDiscreteInputsFunc: func(address, quantity uint16) ([]byte, error) {
+			if quantity > 4 && !swapped {
+				return nil, fmt.Errorf("illegal data address")
+			}
+			return []byte{0x00}, nil
+		},
+		ReadCoilsFunc: func(address, quantity uint16) ([]byte, error) {
+			if swapped || quantity > 4 {
+				return nil, fmt.Errorf("illegal data address")
+			}
+			return []byte{0x00}, nil
+		},
+		ReadInputRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			return nil, fmt.Errorf("illegal function")
+		},
+		ReadHoldingRegistersFunc: func(address, quantity uint16) ([]byte, error) {
+			if address == aoTypeRegAddr {
+				return nil, fmt.Errorf("illegal data address")
+			}
+			return make([]byte, quantity*2), nil
+		},
+	}
+	mgr := newMockManager(client)
+	card, err := mgr.AddCard("/dev/ttyUSB0", 1, "")
+	if err != nil {
+		t.Fatalf("AddCard failed: %v", err)
+	}
+	if card.Module != "IO4040" {
+		t.Fatalf("Expected IO4040, got %s", card.Module)
+	}
+
+	var events []Event
+	mgr.AddEventListener(func(ev Event) { events = append(events, ev) })
+
+	pc, _ := mgr.ensurePort(card.PortPath)
+	mgr.verifyModel(card, pc)
+	if card.DetectedModel != "" || len(events) != 0 {
+		t.Fatalf("Expected no mismatch, got %q and %d events", card.DetectedModel, len(events))
+	}
+
+	swapped = true
+	mgr.verifyModel(card, pc)
+	mgr.verifyModel(card, pc)
+	if card.DetectedModel != "IO8000" {
+		t.Errorf("Expected detected model IO8000, got %q", card.DetectedModel)
+	}
+	if len(events) != 1 || events[0].Type != EventModelMismatch || events[0].CardID != card.ID {
+		t.Fatalf("Expected one model-mismatch event, got %+v", events)
+	}
+	if events[0].Data["expected"] != "IO4040" || events[0].Data["detected"] != "IO8000" {
+		t.Errorf("Unexpected event data: %+v", events[0].Data)
+	}
+
+	swapped = false
+	mgr.verifyModel(card, pc)
+	if card.DetectedModel != "" {
+		t.Errorf("Expected mismatch to clear, got %q", card.DetectedModel)
+	}
+}
+
+func TestModelCheckDue(t *testing.T) {
+	mgr := newMockManager(&MockClient{})
+	mgr.modelCheckInterval = time.Minute
+	card := &Card{ID: "1"}
+	now := time.Now()
+
+	if mgr.modelCheckDue(card, nil, now) {
+		t.Error("Expected no check on first read")
+	}
+	if !mgr.modelCheckDue(card, nil, now.Add(time.Minute)) {
+		t.Error("Expected periodic check after interval")
+	}
+
+	card.lastModelCheck = now
+	readErr := fmt.Errorf("timeout")
+	for i := 1; i <= modelCheckErrorThreshold; i++ {
+		due := mgr.modelCheckDue(card, readErr, now)
+		if due != (i == modelCheckErrorThreshold) {
+			t.Errorf("Read failure %d: expected due=%v", i, i == modelCheckErrorThreshold)
+		}
+	}
+}
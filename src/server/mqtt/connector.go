@@ -0,0 +1,255 @@
+// Package mqtt connects the device to an MQTT broker: it publishes the card states and executes write
+// commands received on the device's command topics, for broker-mediated control.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/tcp"
+	"jaspermate-utils/src/server/telemetry"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultPublishInterval is the interval of card state publications when publish_interval_ms is not set
+const DefaultPublishInterval = time.Second
+
+// Topics below the topic prefix
+const (
+	// TopicStatus is "online" while connected, and "offline" (the last will) otherwise; retained
+	TopicStatus = "status"
+	// TopicCards carries the states of all cards; retained
+	TopicCards = "cards"
+	// TopicWrite accepts a batch write command in the TCP write message format
+	TopicWrite = "write"
+	// TopicResponse carries the write-response (or error) of each command received
+	TopicResponse = "write/response"
+)
+
+// Status reports the state of the broker connection
+type Status struct {
+	Broker      string    `json:"broker"`
+	TopicPrefix string    `json:"topicPrefix"`
+	Connected   bool      `json:"connected"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastPublish time.Time `json:"lastPublish,omitempty"`
+	Commands    int       `json:"commands"` // Commands received
+}
+
+// Connector publishes the card states to an MQTT broker and executes the write commands received on
+// "<prefix>/write" (batches) and "<prefix>/cards/<card>/<channel>/set" (one channel). Each command is
+// answered on "<prefix>/write/response".
+type Connector struct {
+	cfg        config.MQTTConfig
+	prefix     string
+	interval   time.Duration
+	localioMgr *localio.Manager
+	client     paho.Client
+	// publish sends a message to the broker (replaced in tests)
+	publish func(topic string, retained bool, payload []byte)
+
+	mu     sync.Mutex
+	status Status
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewConnector creates a connector for the device. The topic prefix and client ID default to names
+// derived from deviceID.
+func NewConnector(cfg config.MQTTConfig, deviceID string, localioMgr *localio.Manager) *Connector {
+	prefix := strings.TrimSuffix(cfg.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = "jaspermate/" + deviceID
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "jaspermate-" + deviceID
+	}
+	interval := time.Duration(cfg.PublishIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultPublishInterval
+	}
+	c := &Connector{
+		cfg:        cfg,
+		prefix:     prefix,
+		interval:   interval,
+		localioMgr: localioMgr,
+		status:     Status{Broker: cfg.Broker, TopicPrefix: prefix},
+		stop:       make(chan struct{}),
+	}
+	c.publish = func(topic string, retained bool, payload []byte) {
+		c.client.Publish(topic, 1, retained, payload)
+	}
+	return c
+}
+
+// Start connects to the broker in the background, reconnecting whenever the connection is lost, and
+// publishes the card states every interval until Stop is called
+func (c *Connector) Start() {
+	opts := paho.NewClientOptions().
+		AddBroker(c.cfg.Broker).
+		SetClientID(c.cfg.ClientID).
+		SetUsername(c.cfg.Username).
+		SetPassword(c.cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(c.topic(TopicStatus), "offline", 1, true).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(c.onConnectionLost)
+	c.client = paho.NewClient(opts)
+	c.client.Connect()
+	log.Printf("MQTT: connecting to %s as %s (topics %s/...)", c.cfg.Broker, c.cfg.ClientID, c.prefix)
+	go c.run()
+}
+
+// Stop publishes the offline status and disconnects
+func (c *Connector) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+		if c.client != nil && c.client.IsConnectionOpen() {
+			c.client.Publish(c.topic(TopicStatus), 1, true, "offline").WaitTimeout(time.Second)
+			c.client.Disconnect(250)
+		}
+	})
+}
+
+// Status returns the state of the broker connection
+func (c *Connector) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+func (c *Connector) topic(name string) string {
+	return c.prefix + "/" + name
+}
+
+// onConnect announces the device and subscribes to the command topics. Subscriptions are renewed on
+// every connect since the broker drops them with the session.
+func (c *Connector) onConnect(client paho.Client) {
+	c.mu.Lock()
+	c.status.Connected = true
+	c.status.LastError = ""
+	c.mu.Unlock()
+	log.Printf("MQTT: connected to %s", c.cfg.Broker)
+
+	c.publish(c.topic(TopicStatus), true, []byte("online"))
+	client.SubscribeMultiple(map[string]byte{
+		c.topic(TopicWrite):              1,
+		c.topic(TopicCards + "/+/+/set"): 1,
+	}, func(_ paho.Client, msg paho.Message) {
+		c.handleCommand(msg.Topic(), msg.Payload())
+	})
+	c.publishCards()
+}
+
+func (c *Connector) onConnectionLost(_ paho.Client, err error) {
+	c.mu.Lock()
+	c.status.Connected = false
+	c.status.LastError = err.Error()
+	c.mu.Unlock()
+	log.Printf("MQTT: connection to %s lost: %v", c.cfg.Broker, err)
+}
+
+func (c *Connector) run() {
+	// Publishing keeps the cycle at full rate, like a connected TCP client
+	detach := c.localioMgr.AttachConsumer("mqtt")
+	defer detach()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if c.client.IsConnectionOpen() {
+				c.publishCards()
+			}
+		}
+	}
+}
+
+// publishCards publishes the states of all cards as retained message
+func (c *Connector) publishCards() {
+	data, err := json.Marshal(c.localioMgr.GetAllCards())
+	if err != nil {
+		log.Printf("MQTT: failed to encode cards: %v", err)
+		return
+	}
+	c.publish(c.topic(TopicCards), true, data)
+	c.mu.Lock()
+	c.status.LastPublish = time.Now()
+	c.mu.Unlock()
+}
+
+// handleCommand executes a command received on a command topic and publishes its response
+func (c *Connector) handleCommand(topic string, payload []byte) {
+	c.mu.Lock()
+	c.status.Commands++
+	c.mu.Unlock()
+
+	var cmd *tcp.WriteCommand
+	var perr *tcp.ProtocolError
+	if topic == c.topic(TopicWrite) {
+		cmd, perr = tcp.ParseWriteCommand(payload)
+	} else {
+		cmd, perr = channelCommand(strings.TrimPrefix(topic, c.prefix+"/"), payload)
+	}
+
+	var response interface{}
+	if perr != nil {
+		log.Printf("MQTT: rejected command on %s: %v", topic, perr)
+		response = perr.ToMessage()
+	} else {
+		response = c.execute(cmd)
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("MQTT: failed to encode response: %v", err)
+		return
+	}
+	c.publish(c.topic(TopicResponse), false, data)
+}
+
+func (c *Connector) execute(cmd *tcp.WriteCommand) tcp.WriteResponse {
+	ctx, span := telemetry.Tracer().Start(context.Background(), "mqtt.write",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.Int("commands", len(cmd.Commands)),
+			attribute.String("request.id", string(cmd.ID)),
+		))
+	defer span.End()
+
+	response := tcp.ExecuteWrite(localio.WithSource(ctx, localio.WriteSource{Kind: localio.SourceMQTT}), c.localioMgr, cmd)
+	if response.Status == "error" {
+		span.SetStatus(codes.Error, response.Message)
+	}
+	return response
+}
+
+// channelCommand converts a message on a channel topic ("cards/<card>/<channel>/set") to a batch with one
+// command (see tcp.ParseChannelWrite). The response ID is the topic.
+func channelCommand(topic string, payload []byte) (*tcp.WriteCommand, *tcp.ProtocolError) {
+	id, _ := json.Marshal(topic)
+	var cmd *tcp.WriteCommand
+	perr := &tcp.ProtocolError{Code: localio.CodeInvalidRequest, Message: "unknown command topic " + topic, Index: -1}
+	if parts := strings.Split(topic, "/"); len(parts) == 4 && parts[0] == TopicCards && parts[3] == "set" {
+		cmd, perr = tcp.ParseChannelWrite(parts[1], parts[2], payload)
+	}
+	if perr != nil {
+		perr.ID = id
+		return nil, perr
+	}
+	cmd.ID = id
+	return cmd, nil
+}
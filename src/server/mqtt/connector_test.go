@@ -0,0 +1,100 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+type message struct {
+	topic    string
+	retained bool
+	payload  map[string]interface{}
+}
+
+// newTestConnector returns a connector that records its publications instead of sending them
+func newTestConnector() (*Connector, *[]message) {
+	c := NewConnector(config.MQTTConfig{Broker: "tcp://localhost:1883"}, "dev1", localio.NewManager())
+	var sent []message
+	c.publish = func(topic string, retained bool, payload []byte) {
+		msg := message{topic: topic, retained: retained}
+		json.Unmarshal(payload, &msg.payload)
+		sent = append(sent, msg)
+	}
+	return c, &sent
+}
+
+func TestHandleCommand(t *testing.T) {
+	c, sent := newTestConnector()
+	if c.prefix != "jaspermate/dev1" || c.cfg.ClientID != "jaspermate-dev1" {
+		t.Fatalf("Expected names derived from the device ID, got %s and %s", c.prefix, c.cfg.ClientID)
+	}
+
+	// A batch in the TCP write format is answered with its write-response
+	c.handleCommand("jaspermate/dev1/write", []byte(`{"type":"write","id":"b1","commands":[{"type":"write-do","cardId":"9","index":0,"state":true}]}`))
+	// A channel write is answered with the topic as ID
+	c.handleCommand("jaspermate/dev1/cards/9/ao1/set", []byte(`4.5`))
+	// Invalid commands are answered with an error
+	c.handleCommand("jaspermate/dev1/write", []byte(`{"type":"write","commands":[]}`))
+
+	if len(*sent) != 3 {
+		t.Fatalf("Expected 3 responses, got %+v", *sent)
+	}
+	for _, msg := range *sent {
+		if msg.topic != "jaspermate/dev1/write/response" || msg.retained {
+			t.Errorf("Expected a response on the response topic, got %+v", msg)
+		}
+	}
+	if resp := (*sent)[0].payload; resp["type"] != "write-response" || resp["id"] != "b1" || resp["code"] != string(localio.CodeCardNotFound) {
+		t.Errorf("Expected the batch response with CARD_NOT_FOUND, got %v", resp)
+	}
+	if resp := (*sent)[1].payload; resp["id"] != "cards/9/ao1/set" || resp["code"] != string(localio.CodeCardNotFound) {
+		t.Errorf("Expected the channel write response, got %v", resp)
+	}
+	if resp := (*sent)[2].payload; resp["type"] != "error" || resp["code"] != string(localio.CodeInvalidRequest) {
+		t.Errorf("Expected an error for the empty batch, got %v", resp)
+	}
+	if status := c.Status(); status.Commands != 3 || status.Connected {
+		t.Errorf("Expected 3 commands counted, got %+v", status)
+	}
+}
+
+func TestChannelCommand(t *testing.T) {
+	for _, tc := range []struct {
+		topic, payload string
+		want           string // Command type, "" = rejected
+	}{
+		{"cards/1/do0/set", `true`, "write-do"},
+		{"cards/1/do3/set", `0`, "write-do"},
+		{"cards/1/ao1/set", `7.25`, "write-ao"},
+		{"cards/1/ao1/set", `"4-20mA"`, "write-aotype"},
+		{"cards/1/ao1/set", `"5V"`, ""},
+		{"cards/1/do0/set", `2`, ""},
+		{"cards/1/ao0/set", `false`, ""},
+		{"cards/1/di0/set", `1`, ""},
+		{"cards/1/do/set", `true`, ""},
+		{"cards/1/do0/set", `on`, ""},
+	} {
+		cmd, perr := channelCommand(tc.topic, []byte(tc.payload))
+		if tc.want == "" {
+			if perr == nil || string(perr.ID) != `"`+tc.topic+`"` {
+				t.Errorf("%s %s: expected an error with the topic as ID, got %+v", tc.topic, tc.payload, perr)
+			}
+			continue
+		}
+		if perr != nil {
+			t.Errorf("%s %s: unexpected error %v", tc.topic, tc.payload, perr)
+			continue
+		}
+		if item := cmd.Commands[0]; item.Type != tc.want || item.CardID != "1" {
+			t.Errorf("%s %s: expected %s, got %+v", tc.topic, tc.payload, tc.want, item)
+		}
+	}
+
+	cmd, _ := channelCommand("cards/2/ao3/set", []byte(`7.25`))
+	if item := cmd.Commands[0]; item.Index != 3 || item.Value != 7.25 {
+		t.Errorf("Expected AO 3 set to 7.25, got %+v", item)
+	}
+}
@@ -0,0 +1,265 @@
+// Package nats connects the device to a NATS server: it publishes the card states and executes write
+// commands received on the device's command subjects.
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/tcp"
+	"jaspermate-utils/src/server/telemetry"
+
+	natsgo "github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultPublishInterval is the interval of card state publications when publish_interval_ms is not set
+const DefaultPublishInterval = time.Second
+
+// Subjects below the subject prefix
+const (
+	// SubjectCards is followed by the card ID and carries the state of the card
+	SubjectCards = "cards"
+	// SubjectWrite accepts a batch write command in the TCP write message format
+	SubjectWrite = "write"
+	// SubjectSet is followed by the card ID and channel and accepts the value of one output channel
+	SubjectSet = "set"
+)
+
+// Status reports the state of the server connection
+type Status struct {
+	URL           string    `json:"url"`
+	SubjectPrefix string    `json:"subjectPrefix"`
+	Connected     bool      `json:"connected"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastPublish   time.Time `json:"lastPublish,omitempty"`
+	Commands      int       `json:"commands"` // Commands received
+}
+
+// Connector publishes the state of every card on "<prefix>.cards.<card>" and executes the write commands
+// received on "<prefix>.write" (batches) and "<prefix>.set.<card>.<channel>" (one channel). Commands are
+// answered on their reply subject (request-reply).
+type Connector struct {
+	cfg        config.NATSConfig
+	prefix     string
+	name       string // Connection name shown by the server
+	interval   time.Duration
+	localioMgr *localio.Manager
+	conn       *natsgo.Conn
+	// publish sends a message to the server (replaced in tests)
+	publish func(subject string, data []byte) error
+
+	mu     sync.Mutex
+	status Status
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewConnector creates a connector for the device. The subject prefix defaults to a name derived from
+// deviceID.
+func NewConnector(cfg config.NATSConfig, deviceID string, localioMgr *localio.Manager) *Connector {
+	prefix := strings.TrimSuffix(cfg.SubjectPrefix, ".")
+	if prefix == "" {
+		prefix = "jaspermate." + deviceID
+	}
+	interval := time.Duration(cfg.PublishIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultPublishInterval
+	}
+	c := &Connector{
+		cfg:        cfg,
+		prefix:     prefix,
+		name:       "jaspermate-" + deviceID,
+		interval:   interval,
+		localioMgr: localioMgr,
+		status:     Status{URL: cfg.URL, SubjectPrefix: prefix},
+		stop:       make(chan struct{}),
+	}
+	c.publish = func(subject string, data []byte) error {
+		return c.conn.Publish(subject, data)
+	}
+	return c
+}
+
+// Start connects to the server in the background, reconnecting whenever the connection is lost, and
+// publishes the card states every interval until Stop is called
+func (c *Connector) Start() error {
+	opts := []natsgo.Option{
+		natsgo.Name(c.name),
+		natsgo.RetryOnFailedConnect(true),
+		natsgo.MaxReconnects(-1),
+		natsgo.ConnectHandler(c.onConnect),
+		natsgo.ReconnectHandler(c.onConnect),
+		natsgo.DisconnectErrHandler(c.onDisconnect),
+	}
+	if c.cfg.Username != "" {
+		opts = append(opts, natsgo.UserInfo(c.cfg.Username, c.cfg.Password))
+	}
+	if c.cfg.Token != "" {
+		opts = append(opts, natsgo.Token(c.cfg.Token))
+	}
+	conn, err := natsgo.Connect(c.cfg.URL, opts...)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	// Subscriptions are kept by the client and renewed after reconnects
+	for _, subject := range []string{c.subject(SubjectWrite), c.subject(SubjectSet + ".*.*")} {
+		if _, err := conn.Subscribe(subject, func(msg *natsgo.Msg) {
+			c.handleCommand(msg.Subject, msg.Reply, msg.Data)
+		}); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	log.Printf("NATS: connecting to %s (subjects %s.>)", c.cfg.URL, c.prefix)
+	go c.run()
+	return nil
+}
+
+// Stop flushes pending messages and closes the connection
+func (c *Connector) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+		if c.conn != nil {
+			c.conn.Drain()
+		}
+	})
+}
+
+// Status returns the state of the server connection
+func (c *Connector) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.Connected = c.conn != nil && c.conn.IsConnected()
+	return status
+}
+
+func (c *Connector) subject(name string) string {
+	return c.prefix + "." + name
+}
+
+func (c *Connector) onConnect(conn *natsgo.Conn) {
+	c.mu.Lock()
+	c.status.LastError = ""
+	c.mu.Unlock()
+	log.Printf("NATS: connected to %s", conn.ConnectedUrlRedacted())
+}
+
+func (c *Connector) onDisconnect(_ *natsgo.Conn, err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	c.status.LastError = err.Error()
+	c.mu.Unlock()
+	log.Printf("NATS: disconnected: %v", err)
+}
+
+func (c *Connector) run() {
+	// Publishing keeps the cycle at full rate, like a connected TCP client
+	detach := c.localioMgr.AttachConsumer("nats")
+	defer detach()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if c.conn.IsConnected() {
+				c.publishCards()
+			}
+		}
+	}
+}
+
+// publishCards publishes the state of every card on its subject
+func (c *Connector) publishCards() {
+	for _, card := range c.localioMgr.GetAllCards() {
+		data, err := json.Marshal(card)
+		if err != nil {
+			log.Printf("NATS: failed to encode card %s: %v", card.ID, err)
+			continue
+		}
+		if err := c.publish(c.subject(SubjectCards+"."+card.ID), data); err != nil {
+			log.Printf("NATS: failed to publish card %s: %v", card.ID, err)
+			return
+		}
+	}
+	c.mu.Lock()
+	c.status.LastPublish = time.Now()
+	c.mu.Unlock()
+}
+
+// handleCommand executes a command received on a command subject and sends its response to reply
+// (none if the command was published without a reply subject)
+func (c *Connector) handleCommand(subject, reply string, data []byte) {
+	c.mu.Lock()
+	c.status.Commands++
+	c.mu.Unlock()
+
+	var cmd *tcp.WriteCommand
+	var perr *tcp.ProtocolError
+	if subject == c.subject(SubjectWrite) {
+		cmd, perr = tcp.ParseWriteCommand(data)
+	} else {
+		cmd, perr = channelCommand(strings.TrimPrefix(subject, c.prefix+"."), data)
+	}
+
+	var response interface{}
+	if perr != nil {
+		log.Printf("NATS: rejected command on %s: %v", subject, perr)
+		response = perr.ToMessage()
+	} else {
+		response = c.execute(cmd)
+	}
+	if reply == "" {
+		return
+	}
+	out, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("NATS: failed to encode response: %v", err)
+		return
+	}
+	if err := c.publish(reply, out); err != nil {
+		log.Printf("NATS: failed to send response: %v", err)
+	}
+}
+
+func (c *Connector) execute(cmd *tcp.WriteCommand) tcp.WriteResponse {
+	ctx, span := telemetry.Tracer().Start(context.Background(), "nats.write",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.Int("commands", len(cmd.Commands)),
+			attribute.String("request.id", string(cmd.ID)),
+		))
+	defer span.End()
+
+	response := tcp.ExecuteWrite(localio.WithSource(ctx, localio.WriteSource{Kind: localio.SourceNATS}), c.localioMgr, cmd)
+	if response.Status == "error" {
+		span.SetStatus(codes.Error, response.Message)
+	}
+	return response
+}
+
+// channelCommand converts a message on a channel subject ("set.<card>.<channel>") to a batch with one
+// command (see tcp.ParseChannelWrite)
+func channelCommand(subject string, data []byte) (*tcp.WriteCommand, *tcp.ProtocolError) {
+	parts := strings.Split(subject, ".")
+	if len(parts) != 3 || parts[0] != SubjectSet {
+		return nil, &tcp.ProtocolError{Code: localio.CodeInvalidRequest, Message: "unknown command subject " + subject, Index: -1}
+	}
+	return tcp.ParseChannelWrite(parts[1], parts[2], data)
+}
@@ -0,0 +1,55 @@
+package nats
+
+import (
+	"encoding/json"
+	"testing"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestHandleCommand(t *testing.T) {
+	c := NewConnector(config.NATSConfig{URL: "nats://localhost:4222"}, "dev1", localio.NewManager())
+	if c.prefix != "jaspermate.dev1" {
+		t.Fatalf("Expected the prefix derived from the device ID, got %s", c.prefix)
+	}
+	replies := make(map[string]map[string]interface{})
+	c.publish = func(subject string, data []byte) error {
+		var msg map[string]interface{}
+		json.Unmarshal(data, &msg)
+		replies[subject] = msg
+		return nil
+	}
+
+	c.handleCommand("jaspermate.dev1.write", "_INBOX.1", []byte(`{"type":"write","id":7,"commands":[{"type":"write-do","cardId":"9","index":0,"state":true}]}`))
+	c.handleCommand("jaspermate.dev1.set.9.do0", "_INBOX.2", []byte(`true`))
+	c.handleCommand("jaspermate.dev1.set.9.di0", "_INBOX.3", []byte(`true`))
+	// Commands without a reply subject are executed without a response
+	c.handleCommand("jaspermate.dev1.set.9.do1", "", []byte(`false`))
+
+	if resp := replies["_INBOX.1"]; resp["type"] != "write-response" || resp["id"] != 7.0 || resp["code"] != string(localio.CodeCardNotFound) {
+		t.Errorf("Expected the batch response with CARD_NOT_FOUND, got %v", resp)
+	}
+	if resp := replies["_INBOX.2"]; resp["type"] != "write-response" || resp["code"] != string(localio.CodeCardNotFound) {
+		t.Errorf("Expected the channel write response, got %v", resp)
+	}
+	if resp := replies["_INBOX.3"]; resp["type"] != "error" || resp["code"] != string(localio.CodeInvalidRequest) {
+		t.Errorf("Expected an error for the input channel, got %v", resp)
+	}
+	if len(replies) != 3 || c.Status().Commands != 4 {
+		t.Errorf("Expected 3 responses to 4 commands, got %v and %+v", replies, c.Status())
+	}
+}
+
+func TestChannelCommand(t *testing.T) {
+	cmd, perr := channelCommand("set.2.ao3", []byte(`"4-20mA"`))
+	if perr != nil {
+		t.Fatalf("channelCommand failed: %v", perr)
+	}
+	if item := cmd.Commands[0]; item.Type != "write-aotype" || item.CardID != "2" || item.Index != 3 || item.Mode != "4-20mA" {
+		t.Errorf("Expected the AO type write, got %+v", item)
+	}
+	if _, perr := channelCommand("set.2", []byte(`1`)); perr == nil {
+		t.Error("Expected an error for a subject without channel")
+	}
+}
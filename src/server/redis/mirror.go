@@ -0,0 +1,193 @@
+// Package redis mirrors the card states into a Redis server, so co-located services can read them with
+// a key lookup and subscribe to their changes instead of polling the HTTP API.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// DefaultInterval is the interval of state updates when interval_ms is not set
+const DefaultInterval = 200 * time.Millisecond
+
+// keyLifetime is the expiry of the card keys in update intervals, so the keys of removed cards and of a
+// stopped service disappear instead of showing stale states
+const keyLifetime = 10
+
+// Status reports the state of the server connection
+type Status struct {
+	Addr       string    `json:"addr"`
+	KeyPrefix  string    `json:"keyPrefix"`
+	Connected  bool      `json:"connected"` // The last update succeeded
+	LastError  string    `json:"lastError,omitempty"`
+	LastUpdate time.Time `json:"lastUpdate,omitempty"`
+	Published  int       `json:"published"` // Change messages published
+}
+
+// cardUpdate is the state of one card sent in an update
+type cardUpdate struct {
+	key     string
+	data    []byte
+	changed bool // The state changed since the last update and is published
+}
+
+// Mirror keeps the state of every card in the key "<prefix>:card:<card>" and publishes it on the channel
+// of the same name whenever it changed
+type Mirror struct {
+	addr       string
+	prefix     string
+	interval   time.Duration
+	localioMgr *localio.Manager
+	client     *goredis.Client
+	// send writes the card keys and publishes the changed ones in one round trip (replaced in tests)
+	send func(ctx context.Context, updates []cardUpdate) error
+
+	mu     sync.Mutex
+	status Status
+	last   map[string]string // Published state of each card key, without read timestamps
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewMirror creates a mirror for the device. The key prefix defaults to a name derived from deviceID.
+func NewMirror(cfg config.RedisConfig, deviceID string, localioMgr *localio.Manager) *Mirror {
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = "jaspermate:" + deviceID
+	}
+	interval := time.Duration(cfg.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	m := &Mirror{
+		addr:       cfg.Addr,
+		prefix:     prefix,
+		interval:   interval,
+		localioMgr: localioMgr,
+		client: goredis.NewClient(&goredis.Options{
+			Addr:     cfg.Addr,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}),
+		status: Status{Addr: cfg.Addr, KeyPrefix: prefix},
+		last:   make(map[string]string),
+		stop:   make(chan struct{}),
+	}
+	m.send = m.pipeline
+	return m
+}
+
+// Start mirrors the card states every interval until Stop is called. The client reconnects on demand, so
+// an unreachable server only fails the updates until it is back.
+func (m *Mirror) Start() {
+	log.Printf("Redis: mirroring card states to %s (keys %s:card:*)", m.addr, m.prefix)
+	go m.run()
+}
+
+// Stop ends the updates and closes the connection
+func (m *Mirror) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+		m.client.Close()
+	})
+}
+
+// Status returns the state of the server connection
+func (m *Mirror) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+func (m *Mirror) run() {
+	// Mirroring keeps the cycle at full rate, like a connected TCP client
+	detach := m.localioMgr.AttachConsumer("redis")
+	defer detach()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.update(m.localioMgr.GetAllCards())
+		}
+	}
+}
+
+// update writes the state of every card and publishes the changed ones
+func (m *Mirror) update(cards []*localio.Card) {
+	updates := make([]cardUpdate, 0, len(cards))
+	fingerprints := make(map[string]string, len(cards))
+	m.mu.Lock()
+	for _, card := range cards {
+		data, err := json.Marshal(card)
+		if err != nil {
+			log.Printf("Redis: failed to encode card %s: %v", card.ID, err)
+			continue
+		}
+		key := m.prefix + ":card:" + card.ID
+		fingerprints[key] = fingerprint(card)
+		updates = append(updates, cardUpdate{key: key, data: data, changed: fingerprints[key] != m.last[key]})
+	}
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.interval+time.Second)
+	defer cancel()
+	err := m.send(ctx, updates)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		if m.status.LastError != err.Error() {
+			log.Printf("Redis: update failed: %v", err)
+		}
+		m.status.Connected = false
+		m.status.LastError = err.Error()
+		return
+	}
+	for _, u := range updates {
+		if u.changed {
+			m.status.Published++
+		}
+	}
+	m.last = fingerprints
+	m.status.Connected = true
+	m.status.LastError = ""
+	m.status.LastUpdate = time.Now()
+}
+
+// pipeline sends the updates to the server
+func (m *Mirror) pipeline(ctx context.Context, updates []cardUpdate) error {
+	pipe := m.client.Pipeline()
+	for _, u := range updates {
+		pipe.Set(ctx, u.key, u.data, keyLifetime*m.interval)
+		if u.changed {
+			pipe.Publish(ctx, u.key, u.data)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// fingerprint identifies the state of a card without the read timestamps and sequence numbers, which
+// change on every cycle
+func fingerprint(card *localio.Card) string {
+	c := *card
+	c.Last.Timestamp = time.Time{}
+	c.Last.LastGood = time.Time{}
+	c.Last.Seq = 0
+	c.Last.MonotonicMs = 0
+	data, _ := json.Marshal(c)
+	return string(data)
+}
@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestUpdatePublishesChanges(t *testing.T) {
+	m := NewMirror(config.RedisConfig{Addr: "localhost:6379"}, "dev1", localio.NewManager())
+	defer m.Stop()
+	var sent []cardUpdate
+	var sendErr error
+	m.send = func(_ context.Context, updates []cardUpdate) error {
+		sent = updates
+		return sendErr
+	}
+	card := &localio.Card{ID: "1", Module: "IO4040", Last: localio.CardState{Timestamp: time.Now(), DI: []bool{false, true}}}
+
+	m.update([]*localio.Card{card})
+	if len(sent) != 1 || sent[0].key != "jaspermate:dev1:card:1" || !sent[0].changed {
+		t.Fatalf("Expected the first state to be published, got %+v", sent)
+	}
+
+	// A new read of the same values only refreshes the key
+	card.Last.Timestamp = time.Now().Add(time.Second)
+	m.update([]*localio.Card{card})
+	if sent[0].changed {
+		t.Error("Expected an unchanged state not to be published")
+	}
+
+	// A failed update is published again by the next one
+	card.Last.DI = []bool{true, true}
+	sendErr = errors.New("connection refused")
+	m.update([]*localio.Card{card})
+	if status := m.Status(); status.Connected || status.LastError != "connection refused" {
+		t.Errorf("Expected the failure in the status, got %+v", status)
+	}
+	sendErr = nil
+	m.update([]*localio.Card{card})
+	if !sent[0].changed {
+		t.Error("Expected the change to be published after the failed update")
+	}
+	if status := m.Status(); !status.Connected || status.Published != 2 {
+		t.Errorf("Expected 2 published changes, got %+v", status)
+	}
+}
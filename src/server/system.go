@@ -63,6 +63,23 @@ func CheckNetworkConnectivity() bool {
 	return true
 }
 
+// GetIPAddresses returns the non-loopback IP addresses of all interfaces
+func GetIPAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP.String())
+	}
+	return ips
+}
+
 // FormatUptime formats a duration into a human-readable string
 func FormatUptime(duration time.Duration) string {
 	totalSeconds := int(duration.Seconds())
@@ -0,0 +1,43 @@
+package tcp
+
+import (
+	"encoding/json"
+	"log"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// AIStatsRequest is received from TCP clients asking for the daily AI statistics
+type AIStatsRequest struct {
+	Type string          `json:"type"`         // Always "ai-stats"
+	ID   json.RawMessage `json:"id,omitempty"` // Optional request ID echoed in the ai-stats-response
+}
+
+// AIStatsResponse is sent back to TCP clients with the min/max/avg of every AI channel
+type AIStatsResponse struct {
+	Type     string            `json:"type"` // "ai-stats-response"
+	ID       json.RawMessage   `json:"id,omitempty"`
+	Channels []localio.AIStats `json:"channels"`
+}
+
+// ParseAIStatsRequest decodes and validates an AI statistics request received from a TCP client
+func ParseAIStatsRequest(line []byte) (*AIStatsRequest, *ProtocolError) {
+	var req AIStatsRequest
+	if perr := decodeMessage(line, &req); perr != nil {
+		return nil, perr
+	}
+	if len(req.ID) > 0 && !validRequestID(req.ID) {
+		return nil, protocolErrorf(-1, "id must be a string or number")
+	}
+	return &req, nil
+}
+
+func (s *TCPServer) sendAIStats(clientConn *ClientConnection, req AIStatsRequest) {
+	resp := AIStatsResponse{Type: "ai-stats-response", ID: req.ID, Channels: s.localioMgr.GetAIStats()}
+
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+	if err := s.send(clientConn, resp); err != nil {
+		log.Printf("TCP: failed to send AI statistics: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package tcp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestAIStatsRequest(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	dec := json.NewDecoder(client)
+	var welcome WelcomeMessage
+	if err := dec.Decode(&welcome); err != nil {
+		t.Fatalf("Failed to read welcome message: %v", err)
+	}
+
+	client.Write([]byte(`{"type":"ai-stats","id":"s1"}` + "\n"))
+	for {
+		var msg map[string]interface{}
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if msg["type"] == "card-update" {
+			continue
+		}
+		if msg["type"] != "ai-stats-response" || msg["id"] != "s1" {
+			t.Fatalf("Expected the AI statistics response, got %v", msg)
+		}
+		if _, ok := msg["channels"].([]interface{}); !ok {
+			t.Errorf("Expected a channel list, got %v", msg["channels"])
+		}
+		return
+	}
+}
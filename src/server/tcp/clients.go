@@ -0,0 +1,205 @@
+package tcp
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+)
+
+// clientsFile is the file in the data directory the client registry is persisted to
+const clientsFile = "tcp-clients.json"
+
+// HelloRequest is sent by clients to identify themselves; it must be their first message after the
+// protocol selection, and at least before the first write
+type HelloRequest struct {
+	Type string          `json:"type"`         // Always "hello"
+	ID   json.RawMessage `json:"id,omitempty"` // Optional request ID echoed in the hello-response
+	// Client names the controller (e.g. "jn-main"); clients are registered by it
+	Client  string `json:"client"`
+	Version string `json:"version,omitempty"`
+}
+
+// HelloResponse is sent back to clients after their hello
+type HelloResponse struct {
+	Type   string          `json:"type"` // "hello-response"
+	ID     json.RawMessage `json:"id,omitempty"`
+	Status string          `json:"status"` // "ok"
+}
+
+// ClientRecord is a client that has connected, identified by its hello or, without one, by its IP address
+type ClientRecord struct {
+	// Client is the name from the hello handshake ("" for clients that didn't send one)
+	Client         string    `json:"client,omitempty"`
+	Version        string    `json:"version,omitempty"`
+	IP             string    `json:"ip"` // Address of the last connection
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastConnect    time.Time `json:"lastConnect"`
+	LastDisconnect time.Time `json:"lastDisconnect,omitempty"`
+	Connected      bool      `json:"connected"`
+	Connections    uint64    `json:"connections"`
+	Commands       uint64    `json:"commands"` // Write batch commands executed
+}
+
+// clientRegistry is the persisted record of the clients that have connected
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[string]*ClientRecord // By client name, or "ip:<address>" for clients without a hello
+}
+
+func clientsPath() string {
+	return filepath.Join(config.DataDir(), clientsFile)
+}
+
+// loadClientRegistry reads the persisted registry (empty if there is none). Clients recorded as connected
+// by a service that stopped without their disconnect are not connected anymore.
+func loadClientRegistry() *clientRegistry {
+	r := &clientRegistry{clients: make(map[string]*ClientRecord)}
+	data, err := os.ReadFile(clientsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("TCP client registry not loaded: %v", err)
+		}
+		return r
+	}
+	if err := json.Unmarshal(data, &r.clients); err != nil {
+		log.Printf("TCP client registry not loaded: %v", err)
+		r.clients = make(map[string]*ClientRecord)
+	}
+	for _, c := range r.clients {
+		c.Connected = false
+	}
+	return r
+}
+
+// saveLocked persists the registry. The caller must hold r.mu.
+func (r *clientRegistry) saveLocked() {
+	data, err := json.Marshal(r.clients)
+	if err == nil {
+		path := clientsPath()
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("TCP client registry not saved: %v", err)
+	}
+}
+
+// list returns the clients, most recently connected first
+func (r *clientRegistry) list() []ClientRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ClientRecord, 0, len(r.clients))
+	for _, c := range r.clients {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastConnect.After(out[j].LastConnect) })
+	return out
+}
+
+// register records a connection under the client's hello identity, or its IP address if it sent none.
+// It is done once per connection: on the hello, the first write, or the disconnect.
+func (r *clientRegistry) register(c *ClientConnection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.registryKey != "" {
+		return
+	}
+	ip := c.conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	key := "ip:" + ip
+	if c.hello != nil {
+		key = c.hello.Client
+	}
+	rec, ok := r.clients[key]
+	if !ok {
+		rec = &ClientRecord{FirstSeen: c.connectedAt}
+		r.clients[key] = rec
+	}
+	if c.hello != nil {
+		rec.Client, rec.Version = c.hello.Client, c.hello.Version
+	}
+	rec.IP = ip
+	rec.LastConnect = c.connectedAt
+	rec.Connected = true
+	rec.Connections++
+	c.registryKey = key
+	r.saveLocked()
+}
+
+// countCommands adds executed write batch commands to a connection's record
+func (r *clientRegistry) countCommands(c *ClientConnection, n int) {
+	r.register(c)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.clients[c.registryKey]; ok {
+		rec.Commands += uint64(n)
+	}
+}
+
+// disconnected records the end of a connection
+func (r *clientRegistry) disconnected(c *ClientConnection) {
+	r.register(c)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.clients[c.registryKey]; ok {
+		rec.Connected = false
+		rec.LastDisconnect = time.Now()
+	}
+	r.saveLocked()
+}
+
+// Clients returns the registry of the clients that have connected, most recently connected first
+func (s *TCPServer) Clients() []ClientRecord {
+	return s.clients.list()
+}
+
+// ParseHelloRequest decodes and validates a hello received from a TCP client
+func ParseHelloRequest(line []byte) (*HelloRequest, *ProtocolError) {
+	var req HelloRequest
+	if perr := decodeMessage(line, &req); perr != nil {
+		return nil, perr
+	}
+	if len(req.ID) > 0 && !validRequestID(req.ID) {
+		return nil, protocolErrorf(-1, "id must be a string or number")
+	}
+	if req.Client == "" {
+		return nil, protocolErrorf(-1, "client is required")
+	}
+	return &req, nil
+}
+
+// hello registers the identity of a client. It fails once the client has been registered, after a write
+// or an earlier hello.
+func (s *TCPServer) hello(clientConn *ClientConnection, req HelloRequest) *ProtocolError {
+	s.clients.mu.Lock()
+	registered := clientConn.registryKey != ""
+	if !registered {
+		clientConn.hello = &req
+	}
+	s.clients.mu.Unlock()
+	if registered {
+		return protocolErrorf(-1, "hello must be sent once, before any write")
+	}
+	s.clients.register(clientConn)
+	log.Printf("TCP client %s identified as %s %s", clientConn.conn.RemoteAddr(), req.Client, req.Version)
+	return nil
+}
+
+func (s *TCPServer) sendHello(clientConn *ClientConnection, req HelloRequest) {
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+	if err := s.send(clientConn, HelloResponse{Type: "hello-response", ID: req.ID, Status: "ok"}); err != nil {
+		log.Printf("TCP: failed to send hello response: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package tcp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestClientRegistry(t *testing.T) {
+	configtest.Isolate(t)
+
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	dec := json.NewDecoder(client)
+	var welcome WelcomeMessage
+	if err := dec.Decode(&welcome); err != nil {
+		t.Fatalf("Failed to read welcome message: %v", err)
+	}
+	// next returns the next message other than a card update
+	next := func() map[string]interface{} {
+		t.Helper()
+		for {
+			var msg map[string]interface{}
+			if err := dec.Decode(&msg); err != nil {
+				t.Fatalf("Failed to read message: %v", err)
+			}
+			if msg["type"] != "card-update" {
+				return msg
+			}
+		}
+	}
+
+	client.Write([]byte(`{"type":"hello","id":1,"client":"jn-main","version":"2.4.0"}` + "\n"))
+	if msg := next(); msg["type"] != "hello-response" || msg["status"] != "ok" || msg["id"] != 1.0 {
+		t.Fatalf("Expected the hello response, got %v", msg)
+	}
+	client.Write([]byte(`{"type":"write","commands":[{"type":"write-do","cardId":"9","index":0,"state":true},{"type":"write-do","cardId":"9","index":1}]}` + "\n"))
+	if msg := next(); msg["type"] != "write-response" {
+		t.Fatalf("Expected the write response, got %v", msg)
+	}
+	client.Write([]byte(`{"type":"hello","client":"other"}` + "\n"))
+	if msg := next(); msg["type"] != "error" {
+		t.Errorf("Expected a second hello rejected, got %v", msg)
+	}
+
+	clients := s.Clients()
+	if len(clients) != 1 || clients[0].Client != "jn-main" || clients[0].Version != "2.4.0" || !clients[0].Connected ||
+		clients[0].IP != "127.0.0.1" || clients[0].Commands != 2 {
+		t.Fatalf("Unexpected registry %+v", clients)
+	}
+
+	client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Clients()[0].Connected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The registry survives a restart
+	clients = NewTCPServer("0", localio.NewManager(), "test", false).Clients()
+	if len(clients) != 1 || clients[0].Connected || clients[0].LastDisconnect.IsZero() || clients[0].Connections != 1 {
+		t.Errorf("Expected the persisted disconnected client, got %+v", clients)
+	}
+}
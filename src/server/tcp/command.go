@@ -0,0 +1,226 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// MaxBatchSize is the maximum number of commands accepted in one write batch
+const MaxBatchSize = 256
+
+// CodeMessageTooLarge is the error code for a message over the maximum message size
+const CodeMessageTooLarge localio.ErrorCode = "MESSAGE_TOO_LARGE"
+
+// ErrorMessage is sent to TCP clients when a received line cannot be processed
+type ErrorMessage struct {
+	Type    string            `json:"type"`         // Always "error"
+	ID      json.RawMessage   `json:"id,omitempty"` // Request ID, if the message could be decoded
+	Code    localio.ErrorCode `json:"code"`
+	Message string            `json:"message"`
+	// Index is the offending command index within the batch, if the error is specific to one command
+	Index *int `json:"index,omitempty"`
+}
+
+// ProtocolError describes why a received line was rejected
+type ProtocolError struct {
+	Code    localio.ErrorCode
+	Message string
+	Index   int             // -1 if not specific to a command
+	ID      json.RawMessage // Request ID of the rejected command, if known
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Index >= 0 {
+		return fmt.Sprintf("commands[%d]: %s", e.Index, e.Message)
+	}
+	return e.Message
+}
+
+// ToMessage converts the error to the error message sent to the client
+func (e *ProtocolError) ToMessage() ErrorMessage {
+	msg := ErrorMessage{Type: "error", ID: e.ID, Code: e.Code, Message: e.Error()}
+	if e.Index >= 0 {
+		idx := e.Index
+		msg.Index = &idx
+	}
+	return msg
+}
+
+func protocolErrorf(index int, format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Code: localio.CodeInvalidRequest, Message: fmt.Sprintf(format, args...), Index: index}
+}
+
+// ParseWriteCommand decodes and validates one line received from a TCP client.
+// Unknown fields, wrong value types, unknown command types, missing required fields,
+// and batches larger than MaxBatchSize are rejected.
+func ParseWriteCommand(line []byte) (*WriteCommand, *ProtocolError) {
+	var cmd WriteCommand
+	if perr := decodeMessage(line, &cmd); perr != nil {
+		return nil, perr
+	}
+	if perr := ValidateWriteCommand(&cmd); perr != nil {
+		perr.ID = cmd.ID
+		return nil, perr
+	}
+	return &cmd, nil
+}
+
+// decodeMessage decodes one received line into v, rejecting unknown fields and wrong value types
+func decodeMessage(line []byte, v interface{}) *ProtocolError {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return protocolErrorf(-1, "invalid type for field %q: expected %s", typeErr.Field, typeErr.Type)
+		}
+		return protocolErrorf(-1, "invalid JSON: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return protocolErrorf(-1, "invalid JSON: unexpected data after message")
+	}
+	return nil
+}
+
+// messageType returns the type of a received message, or "" if it can't be decoded
+func messageType(line []byte) string {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(line, &msg)
+	return msg.Type
+}
+
+// ValidateWriteCommand checks a decoded write command, e.g. one built by another transport
+func ValidateWriteCommand(cmd *WriteCommand) *ProtocolError {
+	if cmd.Type != "write" {
+		return protocolErrorf(-1, "unknown message type %q", cmd.Type)
+	}
+	if len(cmd.ID) > 0 && !validRequestID(cmd.ID) {
+		cmd.ID = nil
+		return protocolErrorf(-1, "id must be a string or number")
+	}
+	if len(cmd.Commands) == 0 {
+		return protocolErrorf(-1, "no commands in batch")
+	}
+	if len(cmd.Commands) > MaxBatchSize {
+		return protocolErrorf(-1, "batch too large: %d commands (max %d)", len(cmd.Commands), MaxBatchSize)
+	}
+
+	for i, item := range cmd.Commands {
+		if err := validateCommandItem(item); err != "" {
+			return protocolErrorf(i, "%s", err)
+		}
+	}
+	return nil
+}
+
+// validRequestID reports whether a raw JSON request ID is a string or a number
+func validRequestID(id json.RawMessage) bool {
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case string, float64:
+		return true
+	}
+	return false
+}
+
+// validateCommandItem checks the fields required by each command type; returns "" if valid
+func validateCommandItem(item WriteCommandItem) string {
+	switch item.Type {
+	case "write-do", "write-ao", "reboot":
+	case "write-aotype":
+		if item.Mode != "0-10V" && item.Mode != "4-20mA" {
+			return fmt.Sprintf("invalid mode %q", item.Mode)
+		}
+	case "reboot-all":
+		return ""
+	case "sequence-start", "sequence-abort":
+		if item.Sequence == "" {
+			return "sequence is required"
+		}
+		return ""
+	case "alarm-ack", "alarm-shelve", "alarm-unshelve":
+		if item.Alarm == "" {
+			return "alarm is required"
+		}
+		if item.User == "" {
+			return "user is required"
+		}
+		if item.Type == "alarm-shelve" && item.DurationSec <= 0 {
+			return "durationSec must be positive"
+		}
+		return ""
+	case "":
+		return "type is required"
+	default:
+		return fmt.Sprintf("unknown command type %q", item.Type)
+	}
+
+	if item.CardID == "" {
+		return "cardId is required"
+	}
+	if item.Index < 0 {
+		return "index must not be negative"
+	}
+	return ""
+}
+
+// ParseChannelWrite converts a value written to one output channel ("do<n>" or "ao<n>") of a card to a
+// validated batch with one command, for transports addressing channels individually (e.g. MQTT topics).
+// The value is JSON: true/false (or 1/0) for a DO, a number for an AO, or the AO type ("0-10V",
+// "4-20mA") for an AO.
+func ParseChannelWrite(cardID, channel string, value []byte) (*WriteCommand, *ProtocolError) {
+	item := WriteCommandItem{CardID: cardID}
+	kind := strings.TrimRight(channel, "0123456789")
+	index, err := strconv.Atoi(channel[len(kind):])
+	if err != nil || (kind != "do" && kind != "ao") {
+		return nil, protocolErrorf(-1, "invalid channel %q (use do<n> or ao<n>)", channel)
+	}
+	item.Index = index
+
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return nil, protocolErrorf(-1, "invalid JSON value: %v", err)
+	}
+	switch v := v.(type) {
+	case bool:
+		if kind != "do" {
+			return nil, protocolErrorf(-1, "a boolean can only be written to a DO channel")
+		}
+		item.Type, item.State = "write-do", v
+	case float64:
+		if kind == "do" {
+			if v != 0 && v != 1 {
+				return nil, protocolErrorf(-1, "a DO value must be true, false, 1 or 0")
+			}
+			item.Type, item.State = "write-do", v == 1
+		} else {
+			item.Type, item.Value = "write-ao", float32(v)
+		}
+	case string:
+		if kind != "ao" {
+			return nil, protocolErrorf(-1, "an AO type can only be written to an AO channel")
+		}
+		item.Type, item.Mode = "write-aotype", v
+	default:
+		return nil, protocolErrorf(-1, "the value must be a boolean, number or string")
+	}
+
+	cmd := &WriteCommand{Type: "write", Commands: []WriteCommandItem{item}}
+	if perr := ValidateWriteCommand(cmd); perr != nil {
+		return nil, perr
+	}
+	return cmd, nil
+}
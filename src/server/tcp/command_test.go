@@ -0,0 +1,151 @@
+package tcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestParseWriteCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr string
+		index   int
+	}{
+		{"valid", `{"type":"write","commands":[{"type":"write-do","cardId":"1","index":0,"state":true}]}`, "", -1},
+		{"malformed", `{"type":"write",`, "invalid JSON", -1},
+		{"trailing data", `{"type":"write","commands":[{"type":"reboot","cardId":"1"}]} {}`, "unexpected data", -1},
+		{"wrong type", `{"type":"write","commands":[{"type":"write-do","cardId":"1","index":"0"}]}`, "invalid type for field", -1},
+		{"unknown field", `{"type":"write","commands":[],"extra":1}`, "unknown field", -1},
+		{"unknown message", `{"type":"read"}`, "unknown message type", -1},
+		{"empty batch", `{"type":"write","commands":[]}`, "no commands", -1},
+		{"unknown command", `{"type":"write","commands":[{"type":"reboot","cardId":"1"},{"type":"explode","cardId":"1"}]}`, "unknown command type", 1},
+		{"missing card", `{"type":"write","commands":[{"type":"write-ao","index":0,"value":1}]}`, "cardId is required", 0},
+		{"negative index", `{"type":"write","commands":[{"type":"write-do","cardId":"1","index":-1}]}`, "must not be negative", 0},
+		{"bad mode", `{"type":"write","commands":[{"type":"write-aotype","cardId":"1","mode":"5V"}]}`, "invalid mode", 0},
+		{"reboot all", `{"type":"write","commands":[{"type":"reboot-all"}]}`, "", -1},
+		{"missing sequence", `{"type":"write","commands":[{"type":"sequence-start"}]}`, "sequence is required", 0},
+		{"alarm ack", `{"type":"write","commands":[{"type":"alarm-ack","alarm":"pump","user":"alice"}]}`, "", -1},
+		{"alarm without user", `{"type":"write","commands":[{"type":"alarm-ack","alarm":"pump"}]}`, "user is required", 0},
+		{"shelve without duration", `{"type":"write","commands":[{"type":"alarm-shelve","alarm":"pump","user":"alice"}]}`, "durationSec must be positive", 0},
+		{"string id", `{"type":"write","id":"req-1","commands":[{"type":"reboot","cardId":"1"}]}`, "", -1},
+		{"number id", `{"type":"write","id":42,"commands":[{"type":"reboot","cardId":"1"}]}`, "", -1},
+		{"object id", `{"type":"write","id":{},"commands":[{"type":"reboot","cardId":"1"}]}`, "id must be a string or number", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, perr := ParseWriteCommand([]byte(tt.line))
+			if tt.wantErr == "" {
+				if perr != nil {
+					t.Fatalf("Unexpected error: %v", perr)
+				}
+				if cmd == nil || len(cmd.Commands) != 1 {
+					t.Fatalf("Expected 1 command, got %+v", cmd)
+				}
+				return
+			}
+			if perr == nil {
+				t.Fatalf("Expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(perr.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %q", tt.wantErr, perr.Error())
+			}
+			if perr.Index != tt.index {
+				t.Errorf("Expected index %d, got %d", tt.index, perr.Index)
+			}
+		})
+	}
+}
+
+func TestParseWriteCommand_ErrorEchoesID(t *testing.T) {
+	_, perr := ParseWriteCommand([]byte(`{"type":"write","id":"req-7","commands":[{"type":"write-do","index":0}]}`))
+	if perr == nil {
+		t.Fatal("Expected error")
+	}
+	msg, _ := json.Marshal(perr.ToMessage())
+	if !strings.Contains(string(msg), `"id":"req-7"`) {
+		t.Errorf("Expected error message to echo request id, got %s", msg)
+	}
+	if perr.Code != localio.CodeInvalidRequest {
+		t.Errorf("Expected code %s, got %s", localio.CodeInvalidRequest, perr.Code)
+	}
+}
+
+func TestParseWriteCommand_BatchLimit(t *testing.T) {
+	cmd := WriteCommand{Type: "write"}
+	for i := 0; i <= MaxBatchSize; i++ {
+		cmd.Commands = append(cmd.Commands, WriteCommandItem{Type: "reboot", CardID: "1"})
+	}
+	line, _ := json.Marshal(cmd)
+	if _, perr := ParseWriteCommand(line); perr == nil || !strings.Contains(perr.Error(), "batch too large") {
+		t.Errorf("Expected batch too large error, got %v", perr)
+	}
+
+	cmd.Commands = cmd.Commands[:MaxBatchSize]
+	line, _ = json.Marshal(cmd)
+	if _, perr := ParseWriteCommand(line); perr != nil {
+		t.Errorf("Expected batch of %d to be accepted, got %v", MaxBatchSize, perr)
+	}
+}
+
+// TestParseWriteCommand_RoundTrip checks that any valid command survives encode/parse unchanged
+func TestParseWriteCommand_RoundTrip(t *testing.T) {
+	cmd := WriteCommand{Type: "write", ID: json.RawMessage(`"abc"`), Commands: []WriteCommandItem{
+		{Type: "write-do", CardID: "1", Index: 3, State: true},
+		{Type: "write-ao", CardID: "2", Index: 1, Value: 4.5},
+		{Type: "write-aotype", CardID: "2", Index: 0, Mode: "4-20mA"},
+		{Type: "reboot", CardID: "3"},
+		{Type: "sequence-start", Sequence: "compressor-start"},
+	}}
+	line, _ := json.Marshal(cmd)
+	parsed, perr := ParseWriteCommand(line)
+	if perr != nil {
+		t.Fatalf("Unexpected error: %v", perr)
+	}
+	if !reflect.DeepEqual(*parsed, cmd) {
+		t.Errorf("Round trip mismatch:\n got %+v\nwant %+v", *parsed, cmd)
+	}
+}
+
+func FuzzParseWriteCommand(f *testing.F) {
+	f.Add([]byte(`{"type":"write","commands":[{"type":"write-do","cardId":"1","index":0,"state":true}]}`))
+	f.Add([]byte(`{"type":"write","commands":[{"type":"write-ao","cardId":"1","index":2,"value":5000}]}`))
+	f.Add([]byte(`{"type":"write","commands":[{"type":"write-aotype","cardId":"1","index":0,"mode":"0-10V"}]}`))
+	f.Add([]byte(`{"type":"write","commands":[{"type":"sequence-abort","sequence":"x"}]}`))
+	f.Add([]byte(`{"type":"write","commands":[{"type":"write-do","cardId":1}]}`))
+	f.Add([]byte(`{"type":"write","commands":null}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(``))
+
+	f.Fuzz(func(t *testing.T, line []byte) {
+		cmd, perr := ParseWriteCommand(line)
+		if perr != nil {
+			if cmd != nil {
+				t.Fatal("Expected nil command on error")
+			}
+			// Errors must always be reportable to the client
+			if _, err := json.Marshal(perr.ToMessage()); err != nil {
+				t.Fatalf("Error message not encodable: %v", err)
+			}
+			return
+		}
+
+		// Invariants of every accepted command
+		if cmd.Type != "write" {
+			t.Fatalf("Accepted message type %q", cmd.Type)
+		}
+		if len(cmd.Commands) == 0 || len(cmd.Commands) > MaxBatchSize {
+			t.Fatalf("Accepted batch of %d commands", len(cmd.Commands))
+		}
+		for i, item := range cmd.Commands {
+			if msg := validateCommandItem(item); msg != "" {
+				t.Fatalf("Accepted invalid command %d: %s", i, msg)
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultMaxMessageSize is the default maximum length of one newline-delimited message (1 MiB)
+const DefaultMaxMessageSize = 1 << 20
+
+// errMessageTooLong is returned by lineReader for a line over the size limit.
+// The oversized line is discarded, so reading can continue with the next message.
+var errMessageTooLong = errors.New("message too long")
+
+// lineReader reads newline-delimited messages with a maximum size.
+// Unlike bufio.Scanner it doesn't give up on an oversized line: it skips it and reports errMessageTooLong.
+type lineReader struct {
+	r   *bufio.Reader
+	max int
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	if max <= 0 {
+		max = DefaultMaxMessageSize
+	}
+	return &lineReader{r: bufio.NewReader(r), max: max}
+}
+
+// readLine returns the next message without its trailing \n or \r\n
+func (lr *lineReader) readLine() ([]byte, error) {
+	var line []byte
+	tooLong := false
+
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			// Allow for the line terminator when checking the limit
+			if len(bytes.TrimRight(line, "\r\n")) > lr.max {
+				tooLong = true
+				line = nil
+			}
+		}
+
+		switch err {
+		case nil:
+			if tooLong {
+				return nil, errMessageTooLong
+			}
+			return bytes.TrimRight(line, "\r\n"), nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if tooLong {
+				return nil, errMessageTooLong
+			}
+			if len(line) > 0 {
+				// Final message without a newline
+				return bytes.TrimRight(line, "\r\n"), nil
+			}
+			return nil, io.EOF
+		default:
+			return nil, err
+		}
+	}
+}
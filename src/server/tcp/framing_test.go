@@ -0,0 +1,142 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestLineReader(t *testing.T) {
+	input := "first\nsecond\r\n" + strings.Repeat("x", 40) + "\n\nlast"
+	lr := newLineReader(strings.NewReader(input), 32)
+	// Use a tiny buffer so oversized lines span several reads
+	lr.r = bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	want := []struct {
+		line string
+		err  error
+	}{
+		{"first", nil},
+		{"second", nil},
+		{"", errMessageTooLong},
+		{"", nil},
+		{"last", nil},
+		{"", io.EOF},
+	}
+	for i, w := range want {
+		line, err := lr.readLine()
+		if err != w.err || string(line) != w.line {
+			t.Errorf("Read %d: got (%q, %v), want (%q, %v)", i, line, err, w.line, w.err)
+		}
+	}
+}
+
+func TestLineReader_OversizedAtEOF(t *testing.T) {
+	lr := newLineReader(strings.NewReader(strings.Repeat("x", 100)), 10)
+	if _, err := lr.readLine(); err != errMessageTooLong {
+		t.Errorf("Expected errMessageTooLong, got %v", err)
+	}
+	if _, err := lr.readLine(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+// TestHandleClient_Framing checks an oversized message is answered with an error
+// and the connection keeps processing the following messages
+func TestHandleClient_Framing(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	s.SetMaxMessageSize(128)
+
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	s.clientConn = cc
+	go s.handleClient(cc)
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	go func() {
+		io.WriteString(client, `{"type":"write","commands":[`+strings.Repeat(" ", 200)+"]}\n")
+		io.WriteString(client, `{"type":"write","id":17,"commands":[{"type":"write-do","cardId":"9","index":0,"state":true}]}`+"\n")
+	}()
+
+	dec := json.NewDecoder(client)
+	var errMsg ErrorMessage
+	if err := dec.Decode(&errMsg); err != nil {
+		t.Fatalf("Failed to read error message: %v", err)
+	}
+	if errMsg.Type != "error" || errMsg.Code != CodeMessageTooLarge || !strings.Contains(errMsg.Message, "message too long") {
+		t.Errorf("Expected message too long error, got %+v", errMsg)
+	}
+
+	var resp WriteResponse
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Failed to read write response: %v", err)
+	}
+	if resp.Type != "write-response" || resp.Status != "error" || resp.Code != localio.CodeCardNotFound {
+		t.Errorf("Expected card not found write-response, got %+v", resp)
+	}
+	if string(resp.ID) != "17" {
+		t.Errorf("Expected request id 17 echoed, got %s", resp.ID)
+	}
+}
+
+func TestSendUpdate_Sequence(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	cc.protocol = protocolJSON
+	defer cc.close()
+	go s.writeLoop(cc)
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	go func() {
+		for i := 0; i < 3; i++ {
+			s.sendUpdate(cc, nil)
+		}
+	}()
+
+	dec := json.NewDecoder(client)
+	for want := uint64(1); want <= 3; want++ {
+		var msg CardUpdateMessage
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("Failed to read update: %v", err)
+		}
+		if msg.Seq != want {
+			t.Errorf("Expected seq %d, got %d", want, msg.Seq)
+		}
+	}
+}
+
+func TestChangedCards(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	cc.protocol = protocolJSON
+	defer cc.close()
+
+	cards := []*localio.Card{
+		{ID: "1", Last: localio.CardState{Seq: 1, DO: []bool{false, true}}},
+		{ID: "2", Last: localio.CardState{Seq: 2, AI: []float32{4.2}}},
+	}
+	if got := cc.changedCards(cards); len(got) != 2 {
+		t.Fatalf("Expected cards never sent to count as changed, got %d", len(got))
+	}
+	s.sendUpdate(cc, cards)
+
+	// A new read with the same values isn't a change
+	cards[0].Last = localio.CardState{Seq: 3, Timestamp: time.Now(), DO: []bool{false, true}}
+	cards[1].Last = localio.CardState{Seq: 4, Timestamp: time.Now(), AI: []float32{4.2}, Error: "timeout"}
+	got := cc.changedCards(cards)
+	if len(got) != 1 || got[0].ID != "2" {
+		t.Errorf("Expected only card 2 (read error) to have changed, got %v", got)
+	}
+}
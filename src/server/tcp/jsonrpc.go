@@ -0,0 +1,297 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// protocol is the message framing used on a connection
+type protocol int
+
+const (
+	// protocolJSON is the native protocol. It is the zero value, so connections set up without
+	// negotiation use it.
+	protocolJSON protocol = iota
+	// protocolPending is a new connection whose client hasn't sent its first message; card updates and
+	// events are held back until the protocol is known
+	protocolPending
+	// protocolJSONRPC is JSON-RPC 2.0, selected by a JSON-RPC request as the client's first message
+	protocolJSONRPC
+)
+
+// negotiationTimeout is how long a new connection waits for the client's first message before
+// falling back to the native protocol
+var negotiationTimeout = time.Second
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+)
+
+// JSON-RPC subscription topics
+const (
+	TopicCards  = "cards"
+	TopicEvents = "events"
+)
+
+// RPCRequest is a JSON-RPC 2.0 request received from a client; requests without an ID are notifications
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// RPCResponse is the JSON-RPC 2.0 response to a request
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is the error of a JSON-RPC response. Data holds the error code (see localio.ErrorCode) and,
+// for a rejected write batch, the index of the offending command.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// RPCNotification is a JSON-RPC 2.0 notification sent to subscribed clients ("cards" or "event")
+type RPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// RPCWriteResult is the result of the write method, as in a write-response message
+type RPCWriteResult struct {
+	Status      string                  `json:"status"`
+	Results     []localio.CommandResult `json:"results,omitempty"`
+	Code        localio.ErrorCode       `json:"code,omitempty"`
+	Message     string                  `json:"message,omitempty"`
+	FailedIndex int                     `json:"failedIndex,omitempty"`
+}
+
+// negotiate decides the protocol of the connection with the client's first message (nil = the
+// negotiation timed out) and returns it
+func (c *ClientConnection) negotiate(line []byte) protocol {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.protocol == protocolPending {
+		c.protocol = protocolJSON
+		if line != nil && isJSONRPC(line) {
+			c.protocol = protocolJSONRPC
+			c.subscribed = make(map[string]bool)
+		}
+	}
+	return c.protocol
+}
+
+// isJSONRPC reports whether a received line is a JSON-RPC request or batch
+func isJSONRPC(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	if len(line) > 0 && line[0] == '[' {
+		return true
+	}
+	var msg struct {
+		JSONRPC *string `json:"jsonrpc"`
+	}
+	return json.Unmarshal(line, &msg) == nil && msg.JSONRPC != nil
+}
+
+// handleRPC answers one received line of a JSON-RPC connection: a request or a batch of requests
+func (s *TCPServer) handleRPC(clientConn *ClientConnection, line []byte) {
+	line = bytes.TrimSpace(line)
+	var reply interface{}
+	invalid := false
+	if line[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(line, &batch); err != nil {
+			reply, invalid = rpcErrorResponse(nil, RPCParseError, "parse error: "+err.Error()), true
+		} else if len(batch) == 0 {
+			reply, invalid = rpcErrorResponse(nil, RPCInvalidRequest, "empty batch"), true
+		} else {
+			responses := make([]RPCResponse, 0, len(batch))
+			for _, raw := range batch {
+				if resp, ok := s.rpcCall(clientConn, raw); ok {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) > 0 {
+				reply = responses
+			}
+		}
+	} else {
+		resp, ok := s.rpcCall(clientConn, line)
+		invalid = resp.Error != nil && resp.Error.Code != RPCInvalidParams
+		if ok {
+			reply = resp
+		}
+	}
+	s.countReceived(clientConn, invalid)
+	if reply == nil {
+		return
+	}
+
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+	if err := s.send(clientConn, reply); err != nil {
+		log.Printf("TCP: failed to send JSON-RPC response: %v", err)
+	}
+}
+
+// rpcCall executes one JSON-RPC request and returns its response; ok is false for notifications
+func (s *TCPServer) rpcCall(clientConn *ClientConnection, raw json.RawMessage) (resp RPCResponse, ok bool) {
+	if !json.Valid(raw) {
+		return rpcErrorResponse(nil, RPCParseError, "parse error"), true
+	}
+	var req RPCRequest
+	if perr := decodeMessage(raw, &req); perr != nil {
+		return rpcErrorResponse(nil, RPCInvalidRequest, perr.Message), true
+	}
+	if len(req.ID) > 0 && string(req.ID) != "null" && !validRequestID(req.ID) {
+		return rpcErrorResponse(nil, RPCInvalidRequest, "id must be a string, number or null"), true
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcErrorResponse(req.ID, RPCInvalidRequest, `jsonrpc must be "2.0" and method is required`), true
+	}
+
+	result, rerr := s.rpcMethod(clientConn, req)
+	if len(req.ID) == 0 {
+		return RPCResponse{}, false
+	}
+	if rerr != nil {
+		return RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: rerr}, true
+	}
+	return RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}, true
+}
+
+// rpcMethod executes the method of a JSON-RPC request
+func (s *TCPServer) rpcMethod(clientConn *ClientConnection, req RPCRequest) (interface{}, *RPCError) {
+	switch req.Method {
+	case "getCards":
+		if perr := decodeParams(req.Params, &struct{}{}); perr != nil {
+			return nil, perr
+		}
+		return s.localioMgr.GetAllCards(), nil
+
+	case "hello":
+		var params struct {
+			Client  string `json:"client"`
+			Version string `json:"version"`
+		}
+		if perr := decodeParams(req.Params, &params); perr != nil {
+			return nil, perr
+		}
+		if params.Client == "" {
+			return nil, &RPCError{Code: RPCInvalidParams, Message: "client is required"}
+		}
+		if perr := s.hello(clientConn, HelloRequest{Type: "hello", Client: params.Client, Version: params.Version}); perr != nil {
+			return nil, &RPCError{Code: RPCInvalidRequest, Message: perr.Message}
+		}
+		return map[string]string{"status": "ok"}, nil
+
+	case "resume":
+		var params struct {
+			Session string `json:"session"`
+		}
+		if perr := decodeParams(req.Params, &params); perr != nil {
+			return nil, perr
+		}
+		if params.Session == "" {
+			return nil, &RPCError{Code: RPCInvalidParams, Message: "session is required"}
+		}
+		if perr := s.resumeSession(clientConn, params.Session); perr != nil {
+			return nil, &RPCError{Code: RPCInvalidRequest, Message: perr.Message}
+		}
+		return map[string]string{"status": "ok"}, nil
+
+	case "getAIStats":
+		if perr := decodeParams(req.Params, &struct{}{}); perr != nil {
+			return nil, perr
+		}
+		return s.localioMgr.GetAIStats(), nil
+
+	case "write":
+		var params struct {
+			Commands []WriteCommandItem `json:"commands"`
+		}
+		if perr := decodeParams(req.Params, &params); perr != nil {
+			return nil, perr
+		}
+		cmd := &WriteCommand{Type: "write", Commands: params.Commands}
+		if perr := ValidateWriteCommand(cmd); perr != nil {
+			data := map[string]interface{}{"code": perr.Code}
+			if perr.Index >= 0 {
+				data["index"] = perr.Index
+			}
+			return nil, &RPCError{Code: RPCInvalidParams, Message: perr.Error(), Data: data}
+		}
+		resp := s.executeWriteCommand(cmd, clientConn)
+		return RPCWriteResult{
+			Status:      resp.Status,
+			Results:     resp.Results,
+			Code:        resp.Code,
+			Message:     resp.Message,
+			FailedIndex: resp.FailedIndex,
+		}, nil
+
+	case "subscribe":
+		// The topics replace the current subscriptions; no params subscribes to everything
+		params := struct {
+			Topics []string `json:"topics"`
+		}{Topics: []string{TopicCards, TopicEvents}}
+		if perr := decodeParams(req.Params, &params); perr != nil {
+			return nil, perr
+		}
+		subscribed := make(map[string]bool)
+		for _, topic := range params.Topics {
+			if topic != TopicCards && topic != TopicEvents {
+				return nil, &RPCError{Code: RPCInvalidParams, Message: "unknown topic " + topic + " (use cards or events)"}
+			}
+			subscribed[topic] = true
+		}
+		clientConn.mu.Lock()
+		clientConn.subscribed = subscribed
+		clientConn.mu.Unlock()
+		return map[string]interface{}{"topics": params.Topics}, nil
+	}
+	return nil, &RPCError{Code: RPCMethodNotFound, Message: "unknown method " + req.Method + " (use hello, resume, getCards, getAIStats, write or subscribe)"}
+}
+
+// decodeParams decodes by-name params; absent params leave v unchanged
+func decodeParams(params json.RawMessage, v interface{}) *RPCError {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if perr := decodeMessage(params, v); perr != nil {
+		return &RPCError{Code: RPCInvalidParams, Message: "invalid params: " + perr.Message}
+	}
+	return nil
+}
+
+// rpcErrorResponse returns an error response; a request whose ID is unknown is answered with a null ID
+func rpcErrorResponse(id json.RawMessage, code int, message string) RPCResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return RPCResponse{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: message}}
+}
+
+// rpcNotification returns the message sending a card update or event to a JSON-RPC client, or nil if
+// the client isn't subscribed to it. The caller must hold clientConn.mu.
+func (c *ClientConnection) rpcNotification(topic, method string, params interface{}) interface{} {
+	if !c.subscribed[topic] {
+		return nil
+	}
+	return RPCNotification{JSONRPC: "2.0", Method: method, Params: params}
+}
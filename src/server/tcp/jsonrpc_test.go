@@ -0,0 +1,103 @@
+package tcp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestJSONRPC(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	dec := json.NewDecoder(client)
+	var welcome WelcomeMessage
+	if err := dec.Decode(&welcome); err != nil || len(welcome.Protocols) != 2 {
+		t.Fatalf("Expected the welcome message with the protocols, got %+v, %v", welcome, err)
+	}
+
+	call := func(request string) map[string]interface{} {
+		t.Helper()
+		client.Write([]byte(request + "\n"))
+		var resp map[string]interface{}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("Failed to read response to %s: %v", request, err)
+		}
+		return resp
+	}
+	errorCode := func(resp map[string]interface{}) float64 {
+		e, _ := resp["error"].(map[string]interface{})
+		code, _ := e["code"].(float64)
+		return code
+	}
+
+	// The first request selects JSON-RPC for the connection
+	resp := call(`{"jsonrpc":"2.0","id":1,"method":"getCards"}`)
+	if _, ok := resp["result"]; !ok || resp["jsonrpc"] != "2.0" || resp["id"] != 1.0 {
+		t.Fatalf("Expected the cards result, got %v", resp)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":"w1","method":"write","params":{"commands":[{"type":"write-do","cardId":"9","index":0,"state":true}]}}`)
+	if result, _ := resp["result"].(map[string]interface{}); result["status"] != "error" || result["code"] != string(localio.CodeCardNotFound) {
+		t.Errorf("Expected the write result with CARD_NOT_FOUND, got %v", resp)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":2,"method":"write","params":{"commands":[{"type":"write-do","index":0}]}}`)
+	if errorCode(resp) != RPCInvalidParams || resp["error"].(map[string]interface{})["data"].(map[string]interface{})["index"] != 0.0 {
+		t.Errorf("Expected invalid params for the command without cardId, got %v", resp)
+	}
+	if resp = call(`{"jsonrpc":"2.0","id":3,"method":"reboot"}`); errorCode(resp) != RPCMethodNotFound {
+		t.Errorf("Expected method not found, got %v", resp)
+	}
+	if resp = call(`{"jsonrpc":"2.0","id":4`); errorCode(resp) != RPCParseError || resp["id"] != nil {
+		t.Errorf("Expected a parse error with a null id, got %v", resp)
+	}
+
+	// Batches are answered with the responses of the requests that aren't notifications
+	client.Write([]byte(`[{"jsonrpc":"2.0","method":"getCards"},{"jsonrpc":"2.0","id":5,"method":"subscribe","params":{"topics":["events"]}}]` + "\n"))
+	var batch []RPCResponse
+	if err := dec.Decode(&batch); err != nil {
+		t.Fatalf("Failed to read batch response: %v", err)
+	}
+	if len(batch) != 1 || string(batch[0].ID) != "5" || batch[0].Error != nil {
+		t.Fatalf("Expected one response for the subscribe request, got %+v", batch)
+	}
+
+	// Subscribed events are sent as notifications
+	s.onEvent(localio.Event{Type: localio.EventCardOffline, Severity: localio.SeverityCritical, CardID: "1"})
+	var note RPCNotification
+	if err := dec.Decode(&note); err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	if params, _ := note.Params.(map[string]interface{}); note.Method != "event" || params["type"] != localio.EventCardOffline {
+		t.Errorf("Expected the card-offline event notification, got %+v", note)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	c := &ClientConnection{protocol: protocolPending}
+	if c.negotiate([]byte(`{"type":"write","commands":[]}`)) != protocolJSON {
+		t.Error("Expected a native message to select the native protocol")
+	}
+	if c.negotiate([]byte(`{"jsonrpc":"2.0","method":"getCards"}`)) != protocolJSON {
+		t.Error("Expected the protocol to stay fixed after the first message")
+	}
+	c = &ClientConnection{protocol: protocolPending}
+	if c.negotiate([]byte(` [{"jsonrpc":"2.0","method":"getCards"}]`)) != protocolJSONRPC {
+		t.Error("Expected a batch to select JSON-RPC")
+	}
+	c = &ClientConnection{protocol: protocolPending}
+	if c.negotiate(nil) != protocolJSON {
+		t.Error("Expected the native protocol after the negotiation timed out")
+	}
+}
@@ -0,0 +1,40 @@
+package tcp
+
+import (
+	"context"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// Executor executes the commands of write batches; *localio.Manager implements it
+type Executor interface {
+	ProcessBatchWriteContext(ctx context.Context, ops []localio.WriteOperation) []localio.CommandResult
+	RebootCard(cardID string) error
+	RebootAll() []localio.RebootResult
+	StartSequence(name string) error
+	AbortSequence(name string) error
+	AcknowledgeAlarm(name, user, comment string) error
+	ShelveAlarm(name, user, reason string, d time.Duration) error
+	UnshelveAlarm(name, user string) error
+}
+
+// Manager is the part of the localio manager the TCP server uses; *localio.Manager implements it
+type Manager interface {
+	Executor
+	GetAllCards() []*localio.Card
+	// GetAIStats returns the daily min/max/avg of every AI channel
+	GetAIStats() []localio.AIStats
+	BootID() string
+	// SetStateChangeCallback subscribes to the cards whose DI/AI values changed in a cycle
+	SetStateChangeCallback(callback localio.StateChangeCallback)
+	AddEventListener(listener localio.EventListener)
+	// AttachConsumer keeps the poll cycle at full rate until detach is called
+	AttachConsumer(name string) (detach func())
+	// ReleaseSource releases the output channels owned by a disconnected client
+	ReleaseSource(src localio.WriteSource)
+	// WriteAllOutputsToSafeState drives all outputs to their safe state
+	WriteAllOutputsToSafeState() error
+	// CancelSafeStateRetry stops retrying the safe state of cards that failed it
+	CancelSafeStateRetry()
+}
@@ -0,0 +1,185 @@
+package tcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// fakeManager records the calls of the TCP server
+type fakeManager struct {
+	mu              sync.Mutex
+	ops             []localio.WriteOperation
+	rebooted        []string
+	released        []localio.WriteSource
+	safeStates      int
+	safeStateErr    error
+	retriesCanceled int
+	detached        int
+}
+
+func (f *fakeManager) ProcessBatchWriteContext(ctx context.Context, ops []localio.WriteOperation) []localio.CommandResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ops = append(f.ops, ops...)
+	results := make([]localio.CommandResult, len(ops))
+	for i := range ops {
+		results[i] = localio.CommandResult{Index: i, Status: "ok"}
+	}
+	return results
+}
+
+func (f *fakeManager) RebootCard(cardID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rebooted = append(f.rebooted, cardID)
+	if cardID != "1" {
+		return &localio.Error{Code: localio.CodeCardNotFound, Message: "card not found"}
+	}
+	return nil
+}
+
+func (f *fakeManager) RebootAll() []localio.RebootResult                            { return nil }
+func (f *fakeManager) StartSequence(name string) error                              { return nil }
+func (f *fakeManager) AbortSequence(name string) error                              { return nil }
+func (f *fakeManager) AcknowledgeAlarm(name, user, comment string) error            { return nil }
+func (f *fakeManager) ShelveAlarm(name, user, reason string, d time.Duration) error { return nil }
+func (f *fakeManager) UnshelveAlarm(name, user string) error                        { return nil }
+func (f *fakeManager) GetAllCards() []*localio.Card                                 { return nil }
+func (f *fakeManager) GetAIStats() []localio.AIStats                                { return nil }
+func (f *fakeManager) BootID() string                                               { return "boot" }
+func (f *fakeManager) SetStateChangeCallback(callback localio.StateChangeCallback)  {}
+func (f *fakeManager) AddEventListener(listener localio.EventListener)              {}
+
+func (f *fakeManager) AttachConsumer(name string) func() {
+	return func() {
+		f.mu.Lock()
+		f.detached++
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeManager) ReleaseSource(src localio.WriteSource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, src)
+}
+
+func (f *fakeManager) CancelSafeStateRetry() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retriesCanceled++
+}
+
+func (f *fakeManager) WriteAllOutputsToSafeState() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.safeStates++
+	return f.safeStateErr
+}
+
+func TestCommandHandling(t *testing.T) {
+	mgr := &fakeManager{safeStateErr: errors.New("bus down")}
+	s := NewTCPServer("0", mgr, "test", false)
+
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	s.clientConn = cc
+	done := make(chan struct{})
+	go func() {
+		s.handleClient(cc)
+		close(done)
+	}()
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	go client.Write([]byte(`{"type":"write","id":7,"commands":[` +
+		`{"type":"write-do","cardId":"1","index":2,"state":true},` +
+		`{"type":"reboot","cardId":"9"},` +
+		`{"type":"write-ao","cardId":"1","index":0,"value":5}]}` + "\n"))
+
+	var resp WriteResponse
+	if err := json.NewDecoder(client).Decode(&resp); err != nil {
+		t.Fatalf("Failed to read the write response: %v", err)
+	}
+	if string(resp.ID) != "7" || resp.Status != "error" || resp.FailedIndex != 1 || resp.Code != localio.CodeCardNotFound {
+		t.Errorf("Expected the reboot of card 9 to fail, got %+v", resp)
+	}
+	if len(resp.Results) != 3 || resp.Results[0].Status != "ok" || resp.Results[2].Status != "ok" || resp.Results[2].Index != 2 {
+		t.Errorf("Expected both writes to succeed at their batch index, got %+v", resp.Results)
+	}
+	mgr.mu.Lock()
+	ops := mgr.ops
+	mgr.mu.Unlock()
+	if len(ops) != 2 || ops[0].Type != localio.WriteOpDO || ops[0].Index != 2 || ops[0].Value != 1 || ops[1].Type != localio.WriteOpAO || ops[1].Value != 5 {
+		t.Errorf("Unexpected write operations: %+v", ops)
+	}
+
+	// Disconnecting releases the client's channels and drives the outputs to safe state
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the disconnect")
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if mgr.safeStates != 1 || mgr.detached != 1 {
+		t.Errorf("Expected one safe state activation and the consumer detached, got %d and %d", mgr.safeStates, mgr.detached)
+	}
+	if len(mgr.released) != 1 || mgr.released[0].Kind != localio.SourceTCP {
+		t.Errorf("Expected the TCP source to be released, got %+v", mgr.released)
+	}
+	if st := s.Stats(); st.SafeStateActivations != 1 || st.SafeStateFailures != 1 {
+		t.Errorf("Expected the failed safe state activation to be counted, got %+v", st)
+	}
+}
+
+func TestSafeStateOnlyForCurrentClient(t *testing.T) {
+	mgr := &fakeManager{}
+	s := NewTCPServer("0", mgr, "test", false)
+
+	// A connection that was already replaced doesn't trigger a safe state on disconnect
+	serverConn, client := net.Pipe()
+	cc := newClientConnection(serverConn)
+	client.Close()
+	s.handleClient(cc)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if mgr.safeStates != 0 || len(mgr.released) != 1 {
+		t.Errorf("Expected no safe state and the source released, got %d safe states, %d released", mgr.safeStates, len(mgr.released))
+	}
+}
+
+func TestConnectCancelsSafeStateRetry(t *testing.T) {
+	mgr := &fakeManager{}
+	s := NewTCPServer("0", mgr, "test", false)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	var welcome WelcomeMessage
+	if err := json.NewDecoder(client).Decode(&welcome); err != nil {
+		t.Fatalf("Failed to read welcome message: %v", err)
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if mgr.retriesCanceled != 1 {
+		t.Errorf("Expected the safe state retry canceled when the client connected, got %d", mgr.retriesCanceled)
+	}
+}
@@ -0,0 +1,204 @@
+package tcp
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// SchemaRequest is received from TCP clients asking for the protocol schema
+type SchemaRequest struct {
+	Type string          `json:"type"`         // Always "schema"
+	ID   json.RawMessage `json:"id,omitempty"` // Optional request ID echoed in the schema-response
+}
+
+// SchemaResponse is sent back to TCP clients with the protocol schema (see Schema)
+type SchemaResponse struct {
+	Type   string                 `json:"type"` // "schema-response"
+	ID     json.RawMessage        `json:"id,omitempty"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// protocolMessages are the message types of the TCP protocol with the Go structs they are encoded from
+var protocolMessages = []struct {
+	Type        string
+	Value       interface{}
+	Description string
+}{
+	{"welcome", WelcomeMessage{}, "Sent by the server when a client connects"},
+	{"card-update", CardUpdateMessage{}, "Sent by the server every update interval and when inputs change"},
+	{"write", WriteCommand{}, "Sent by the client: a batch of commands"},
+	{"write-response", WriteResponse{}, "Sent by the server with the results of a write batch"},
+	{"error", ErrorMessage{}, "Sent by the server when a received message is rejected"},
+	{"event", localio.Event{}, "Sent by the server for bus events; the message type is the event type"},
+	{"schema", SchemaRequest{}, "Sent by the client to request this schema"},
+	{"schema-response", SchemaResponse{}, "Sent by the server with this schema"},
+	{"ai-stats", AIStatsRequest{}, "Sent by the client to request the daily AI statistics"},
+	{"ai-stats-response", AIStatsResponse{}, "Sent by the server with the min/max/avg of every AI channel"},
+	{"hello", HelloRequest{}, "Sent by the client to identify itself, before its first write"},
+	{"hello-response", HelloResponse{}, "Sent by the server when the client's identity is registered"},
+	{"resume", ResumeRequest{}, "Sent by a reconnecting client with the session token of its previous connection"},
+	{"resume-response", ResumeResponse{}, "Sent by the server when the client's session was resumed"},
+}
+
+var schemaOnce = sync.OnceValue(generateSchema)
+
+// Schema returns the JSON Schema (draft 2020-12) of the TCP protocol messages, generated from the Go
+// structs. Every message has a definition in $defs named after its struct, with the message type as a
+// constant (events: one of the event types), and the document validates any message. The returned map
+// is shared and must not be modified.
+func Schema() map[string]interface{} {
+	return schemaOnce()
+}
+
+func generateSchema() map[string]interface{} {
+	g := &schemaGenerator{defs: make(map[string]map[string]interface{})}
+	var oneOf []interface{}
+	for _, msg := range protocolMessages {
+		t := reflect.TypeOf(msg.Value)
+		ref := g.schemaOf(t)
+		def := g.defs[t.Name()]
+		def["description"] = msg.Description
+		props := def["properties"].(map[string]interface{})
+		if msg.Type == "event" {
+			props["type"] = map[string]interface{}{"type": "string", "enum": localio.EventTypes()}
+		} else {
+			props["type"] = map[string]interface{}{"const": msg.Type}
+		}
+		oneOf = append(oneOf, ref)
+	}
+
+	defs := make(map[string]interface{}, len(g.defs))
+	for name, def := range g.defs {
+		defs[name] = def
+	}
+	return map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "JasperMate Utils TCP protocol",
+		"$defs":   defs,
+		"oneOf":   oneOf,
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaGenerator builds JSON Schemas from Go types following the encoding/json rules. Named structs are
+// collected in defs and referenced.
+type schemaGenerator struct {
+	defs map[string]map[string]interface{}
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		// Request IDs: a string or number
+		return map[string]interface{}{"type": []string{"string", "number"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			// Register before generating the fields so recursive types end in a reference
+			g.defs[t.Name()] = map[string]interface{}{}
+			def := g.structSchema(t)
+			for k, v := range def {
+				g.defs[t.Name()][k] = v
+			}
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+	// Interfaces: any value
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	required := []string{}
+	g.addFields(t, props, &required)
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// addFields adds the JSON fields of struct t, including those of embedded structs
+func (g *schemaGenerator) addFields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(f.Type, props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// sendSchema answers a schema request
+func (s *TCPServer) sendSchema(clientConn *ClientConnection, req SchemaRequest) {
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+
+	if err := s.send(clientConn, SchemaResponse{Type: "schema-response", ID: req.ID, Schema: Schema()}); err != nil {
+		log.Printf("TCP: failed to send schema: %v", err)
+	}
+}
+
+// ParseSchemaRequest decodes and validates a schema request received from a TCP client
+func ParseSchemaRequest(line []byte) (*SchemaRequest, *ProtocolError) {
+	var req SchemaRequest
+	if perr := decodeMessage(line, &req); perr != nil {
+		return nil, perr
+	}
+	if len(req.ID) > 0 && !validRequestID(req.ID) {
+		return nil, protocolErrorf(-1, "id must be a string or number")
+	}
+	return &req, nil
+}
@@ -0,0 +1,115 @@
+package tcp
+
+import (
+	"encoding/json"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// def returns the definition of a struct in the schema
+func def(t *testing.T, schema map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	d, ok := schema["$defs"].(map[string]interface{})[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a definition of %s", name)
+	}
+	return d
+}
+
+func TestSchema(t *testing.T) {
+	// Round-trip through JSON to look at the schema as clients see it
+	data, err := json.Marshal(Schema())
+	if err != nil {
+		t.Fatalf("Failed to encode schema: %v", err)
+	}
+	var schema map[string]interface{}
+	json.Unmarshal(data, &schema)
+
+	if oneOf := schema["oneOf"].([]interface{}); len(oneOf) != len(protocolMessages) {
+		t.Errorf("Expected one reference per message type, got %v", oneOf)
+	}
+
+	write := def(t, schema, "WriteCommand")
+	props := write["properties"].(map[string]interface{})
+	if props["type"].(map[string]interface{})["const"] != "write" {
+		t.Errorf("Expected the write message type as a constant, got %v", props["type"])
+	}
+	if items := props["commands"].(map[string]interface{})["items"]; items.(map[string]interface{})["$ref"] != "#/$defs/WriteCommandItem" {
+		t.Errorf("Expected commands to reference WriteCommandItem, got %v", items)
+	}
+	item := def(t, schema, "WriteCommandItem")
+	required := item["required"].([]interface{})
+	if !slices.Contains(required, interface{}("cardId")) || slices.Contains(required, interface{}("state")) {
+		t.Errorf("Expected cardId required and state optional, got %v", required)
+	}
+
+	// Nested structs are defined once, with the encoding of special types
+	state := def(t, schema, "CardState")["properties"].(map[string]interface{})
+	if ts := state["timestamp"].(map[string]interface{}); ts["format"] != "date-time" {
+		t.Errorf("Expected a date-time timestamp, got %v", ts)
+	}
+	if ai := state["ai"].(map[string]interface{}); ai["type"] != "array" || ai["items"].(map[string]interface{})["type"] != "number" {
+		t.Errorf("Expected ai as an array of numbers, got %v", ai)
+	}
+	card := def(t, schema, "Card")["properties"].(map[string]interface{})
+	if _, ok := card["needsFullRead"]; ok || card["last"].(map[string]interface{})["$ref"] != "#/$defs/CardState" {
+		t.Errorf("Expected the exported card fields only, got %v", card)
+	}
+
+	event := def(t, schema, "Event")["properties"].(map[string]interface{})
+	if types := event["type"].(map[string]interface{})["enum"].([]interface{}); !slices.Contains(types, interface{}(localio.EventCardOffline)) {
+		t.Errorf("Expected the event types, got %v", types)
+	}
+}
+
+func TestSchemaRequest(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	dec := json.NewDecoder(client)
+	var welcome WelcomeMessage
+	if err := dec.Decode(&welcome); err != nil {
+		t.Fatalf("Failed to read welcome message: %v", err)
+	}
+
+	// nextMessage skips card updates
+	nextMessage := func() map[string]interface{} {
+		t.Helper()
+		for {
+			var msg map[string]interface{}
+			if err := dec.Decode(&msg); err != nil {
+				t.Fatalf("Failed to read message: %v", err)
+			}
+			if msg["type"] != "card-update" {
+				return msg
+			}
+		}
+	}
+
+	client.Write([]byte(`{"type":"schema","id":7}` + "\n"))
+	msg := nextMessage()
+	if msg["type"] != "schema-response" || msg["id"] != 7.0 {
+		t.Fatalf("Expected the schema response, got %v", msg["type"])
+	}
+	if schema, _ := msg["schema"].(map[string]interface{}); schema["$defs"] == nil {
+		t.Errorf("Expected the schema definitions, got %v", msg["schema"])
+	}
+
+	client.Write([]byte(`{"type":"schema","format":"yaml"}` + "\n"))
+	if msg := nextMessage(); msg["type"] != "error" || msg["code"] != string(localio.CodeInvalidRequest) {
+		t.Errorf("Expected an error for an unknown field, got %v", msg)
+	}
+}
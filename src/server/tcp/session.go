@@ -0,0 +1,162 @@
+package tcp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// ResumeRequest is sent by a reconnecting client to take over the session of its previous connection,
+// with the session token of that connection's welcome message
+type ResumeRequest struct {
+	Type    string          `json:"type"`         // Always "resume"
+	ID      json.RawMessage `json:"id,omitempty"` // Optional request ID echoed in the resume-response
+	Session string          `json:"session"`
+}
+
+// ResumeResponse is sent back to clients whose session was resumed
+type ResumeResponse struct {
+	Type   string          `json:"type"` // "resume-response"
+	ID     json.RawMessage `json:"id,omitempty"`
+	Status string          `json:"status"` // "ok"
+}
+
+// suspendedSession is the session of a disconnected client during the grace window
+type suspendedSession struct {
+	token    string
+	sourceID string // Write source ID owning the client's outputs
+	timer    *time.Timer
+}
+
+// newSessionToken returns a random session token
+func newSessionToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SetSessionGrace sets how long the session of a disconnected client can be resumed before its outputs go
+// to safe state (<= 0 = safe state right away). Must be called before Start
+func (s *TCPServer) SetSessionGrace(grace time.Duration) {
+	s.sessionGrace = max(grace, 0)
+}
+
+// suspendSession keeps the session of a disconnected client for the grace window, or ends it right away
+// without one
+func (s *TCPServer) suspendSession(clientConn *ClientConnection) {
+	stopped := false
+	select {
+	case <-s.stopChan:
+		stopped = true
+	default:
+	}
+	if stopped || s.sessionGrace <= 0 {
+		s.endSession(clientConn.sourceID)
+		return
+	}
+
+	session := &suspendedSession{token: clientConn.session, sourceID: clientConn.sourceID}
+	s.mu.Lock()
+	s.suspended = session
+	session.timer = time.AfterFunc(s.sessionGrace, func() { s.expireSession(session) })
+	s.mu.Unlock()
+	log.Printf("JN disconnected - outputs held for %v until the session is resumed", s.sessionGrace)
+}
+
+// expireSession ends a suspended session that wasn't resumed in time. A nil session ends any suspended
+// session, e.g. when a client that didn't resume it starts controlling the outputs.
+func (s *TCPServer) expireSession(session *suspendedSession) {
+	s.mu.Lock()
+	if s.suspended == nil || (session != nil && s.suspended != session) {
+		s.mu.Unlock()
+		return
+	}
+	session = s.suspended
+	s.suspended = nil
+	session.timer.Stop()
+	s.mu.Unlock()
+
+	log.Printf("TCP session not resumed")
+	s.endSession(session.sourceID)
+}
+
+// endSession releases the outputs of a client that is gone and writes all outputs to safe state
+func (s *TCPServer) endSession(sourceID string) {
+	s.localioMgr.ReleaseSource(localio.WriteSource{Kind: localio.SourceTCP, ID: sourceID})
+
+	log.Printf("JN disconnected - writing all outputs to safe state")
+	s.stats.safeStateActivations.Add(1)
+	if err := s.localioMgr.WriteAllOutputsToSafeState(); err != nil {
+		s.stats.safeStateFailures.Add(1)
+		log.Printf("Error writing outputs to safe state: %v", err)
+	}
+}
+
+// resumeSession hands the suspended session with the token over to the client: its writes continue as
+// the write source of the previous connection. A wrong token ends the suspended session.
+func (s *TCPServer) resumeSession(clientConn *ClientConnection, token string) *ProtocolError {
+	s.mu.Lock()
+	session := s.suspended
+	if session == nil {
+		s.mu.Unlock()
+		return protocolErrorf(-1, "no session to resume")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(session.token)) != 1 {
+		s.mu.Unlock()
+		s.expireSession(session)
+		return protocolErrorf(-1, "invalid session token")
+	}
+	s.suspended = nil
+	session.timer.Stop()
+	s.mu.Unlock()
+
+	clientConn.sourceID = session.sourceID
+	s.stats.sessionsResumed.Add(1)
+	log.Printf("TCP client %s resumed the session", clientConn.conn.RemoteAddr())
+	return nil
+}
+
+// claimSession is called with the first message of a connection: unless it resumes the suspended
+// session, the client is a different one and the suspended session ends before the message is processed
+func (s *TCPServer) claimSession(clientConn *ClientConnection, line []byte) {
+	if clientConn.sessionClaimed {
+		return
+	}
+	clientConn.sessionClaimed = true
+	var msg struct {
+		Type   string `json:"type"`
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(line, &msg) == nil && (msg.Type == "resume" || msg.Method == "resume") {
+		return
+	}
+	s.expireSession(nil)
+}
+
+// ParseResumeRequest decodes and validates a resume request received from a TCP client
+func ParseResumeRequest(line []byte) (*ResumeRequest, *ProtocolError) {
+	var req ResumeRequest
+	if perr := decodeMessage(line, &req); perr != nil {
+		return nil, perr
+	}
+	if len(req.ID) > 0 && !validRequestID(req.ID) {
+		return nil, protocolErrorf(-1, "id must be a string or number")
+	}
+	if req.Session == "" {
+		return nil, protocolErrorf(-1, "session is required")
+	}
+	return &req, nil
+}
+
+func (s *TCPServer) sendResume(clientConn *ClientConnection, req ResumeRequest) {
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+	if err := s.send(clientConn, ResumeResponse{Type: "resume-response", ID: req.ID, Status: "ok"}); err != nil {
+		log.Printf("TCP: failed to send resume response: %v", err)
+	}
+}
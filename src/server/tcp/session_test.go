@@ -0,0 +1,126 @@
+package tcp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config/configtest"
+)
+
+func TestSessionResume(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := &fakeManager{}
+	s := NewTCPServer("0", mgr, "test", false)
+	s.SetSessionGrace(time.Minute)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	// connect returns a client and its welcome message, once the previous client is gone
+	connect := func() (net.Conn, *json.Decoder, WelcomeMessage) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for s.IsConnected() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		client, err := net.Dial("tcp", s.listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		client.SetDeadline(time.Now().Add(2 * time.Second))
+		dec := json.NewDecoder(client)
+		var welcome WelcomeMessage
+		if err := dec.Decode(&welcome); err != nil {
+			t.Fatalf("Failed to read welcome message: %v", err)
+		}
+		if welcome.SessionToken == "" {
+			t.Fatalf("Expected a session token in the welcome message")
+		}
+		return client, dec, welcome
+	}
+	safeStates := func() int {
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		return mgr.safeStates
+	}
+
+	first, _, welcome := connect()
+	firstSource := first.LocalAddr().String()
+	first.Close()
+
+	second, dec, _ := connect()
+	if n := safeStates(); n != 0 {
+		t.Fatalf("Expected the outputs held during the grace, got %d safe state writes", n)
+	}
+	second.Write([]byte(`{"type":"resume","id":1,"session":"` + welcome.SessionToken + `"}` + "\n"))
+	var resp map[string]interface{}
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Failed to read the resume response: %v", err)
+	}
+	if resp["type"] != "resume-response" || resp["status"] != "ok" || resp["id"] != 1.0 {
+		t.Fatalf("Expected the resume response, got %v", resp)
+	}
+	if st := s.Stats(); st.SessionsResumed != 1 {
+		t.Errorf("Expected 1 resumed session, got %d", st.SessionsResumed)
+	}
+	second.Close()
+
+	// A different client ends the suspended session with its first message
+	third, dec, _ := connect()
+	defer third.Close()
+	third.Write([]byte(`{"type":"resume","session":"wrong"}` + "\n"))
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Failed to read the error: %v", err)
+	}
+	if resp["type"] != "error" {
+		t.Errorf("Expected a wrong token rejected, got %v", resp)
+	}
+	if n := safeStates(); n != 1 {
+		t.Fatalf("Expected the outputs written to safe state once, got %d", n)
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	// The resumed connection wrote as the first one: the session's source is the first client's
+	if len(mgr.released) != 1 || mgr.released[0].ID != firstSource {
+		t.Errorf("Expected the first client's source released, got %+v", mgr.released)
+	}
+}
+
+func TestSessionGraceExpires(t *testing.T) {
+	configtest.Isolate(t)
+
+	mgr := &fakeManager{}
+	s := NewTCPServer("0", mgr, "test", false)
+	s.SetSessionGrace(50 * time.Millisecond)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	var welcome WelcomeMessage
+	if err := json.NewDecoder(client).Decode(&welcome); err != nil {
+		t.Fatalf("Failed to read welcome message: %v", err)
+	}
+	client.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mgr.mu.Lock()
+		n := mgr.safeStates
+		mgr.mu.Unlock()
+		if n == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected the outputs written to safe state after the grace")
+}
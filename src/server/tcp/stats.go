@@ -0,0 +1,93 @@
+package tcp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Connection rejection reasons
+const (
+	RejectNonLocal = "non-local"
+	RejectBusy     = "busy"
+)
+
+// ClientInfo describes the connected client
+type ClientInfo struct {
+	RemoteAddr       string    `json:"remoteAddr"`
+	ConnectedAt      time.Time `json:"connectedAt"`
+	MessagesSent     uint64    `json:"messagesSent"`
+	MessagesReceived uint64    `json:"messagesReceived"`
+	// Queued is the number of messages waiting to be written to the client
+	Queued         int    `json:"queued"`
+	UpdatesDropped uint64 `json:"updatesDropped"`
+}
+
+// Stats are the TCP server counters since the service started
+type Stats struct {
+	Client               *ClientInfo       `json:"client"` // nil if no client is connected
+	ConnectionsAccepted  uint64            `json:"connectionsAccepted"`
+	ConnectionsRejected  map[string]uint64 `json:"connectionsRejected"` // by reason
+	MessagesSent         uint64            `json:"messagesSent"`
+	MessagesReceived     uint64            `json:"messagesReceived"`
+	ProtocolErrors       uint64            `json:"protocolErrors"`
+	EncodeFailures       uint64            `json:"encodeFailures"`
+	SafeStateActivations uint64            `json:"safeStateActivations"`
+	SafeStateFailures    uint64            `json:"safeStateFailures"`
+	// UpdatesDropped are the card updates dropped for slow clients by the drop-oldest policy
+	UpdatesDropped uint64 `json:"updatesDropped"`
+	// SlowClientDisconnects are the clients disconnected because their send queue was full
+	SlowClientDisconnects uint64 `json:"slowClientDisconnects"`
+	// SessionsResumed are the sessions a reconnecting client resumed within the session grace
+	SessionsResumed uint64 `json:"sessionsResumed"`
+}
+
+// serverStats holds the counters behind Stats
+type serverStats struct {
+	accepted              atomic.Uint64
+	rejectedNonLocal      atomic.Uint64
+	rejectedBusy          atomic.Uint64
+	sent                  atomic.Uint64
+	received              atomic.Uint64
+	protocolErrors        atomic.Uint64
+	encodeFailures        atomic.Uint64
+	safeStateActivations  atomic.Uint64
+	safeStateFailures     atomic.Uint64
+	updatesDropped        atomic.Uint64
+	slowClientDisconnects atomic.Uint64
+	sessionsResumed       atomic.Uint64
+}
+
+// Stats returns the connection and message counters
+func (s *TCPServer) Stats() Stats {
+	st := Stats{
+		ConnectionsAccepted: s.stats.accepted.Load(),
+		ConnectionsRejected: map[string]uint64{
+			RejectNonLocal: s.stats.rejectedNonLocal.Load(),
+			RejectBusy:     s.stats.rejectedBusy.Load(),
+		},
+		MessagesSent:          s.stats.sent.Load(),
+		MessagesReceived:      s.stats.received.Load(),
+		ProtocolErrors:        s.stats.protocolErrors.Load(),
+		EncodeFailures:        s.stats.encodeFailures.Load(),
+		SafeStateActivations:  s.stats.safeStateActivations.Load(),
+		SafeStateFailures:     s.stats.safeStateFailures.Load(),
+		UpdatesDropped:        s.stats.updatesDropped.Load(),
+		SlowClientDisconnects: s.stats.slowClientDisconnects.Load(),
+		SessionsResumed:       s.stats.sessionsResumed.Load(),
+	}
+
+	s.mu.RLock()
+	clientConn := s.clientConn
+	s.mu.RUnlock()
+	if clientConn != nil {
+		st.Client = &ClientInfo{
+			RemoteAddr:       clientConn.conn.RemoteAddr().String(),
+			ConnectedAt:      clientConn.connectedAt,
+			MessagesSent:     clientConn.sent.Load(),
+			MessagesReceived: clientConn.received.Load(),
+			Queued:           clientConn.queueLength(),
+			UpdatesDropped:   clientConn.dropped.Load(),
+		}
+	}
+	return st
+}
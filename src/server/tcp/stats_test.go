@@ -0,0 +1,102 @@
+package tcp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/localio"
+)
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStats_Connections(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+	addr := s.listener.Addr().String()
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	var welcome WelcomeMessage
+	if err := json.NewDecoder(client).Decode(&welcome); err != nil {
+		t.Fatalf("Failed to read welcome message: %v", err)
+	}
+
+	st := s.Stats()
+	if st.ConnectionsAccepted != 1 || st.Client == nil || st.Client.MessagesSent < 1 {
+		t.Fatalf("Expected one accepted client with the welcome message sent, got %+v", st)
+	}
+	if st.Client.RemoteAddr != client.LocalAddr().String() {
+		t.Errorf("Expected client address %s, got %s", client.LocalAddr(), st.Client.RemoteAddr)
+	}
+
+	// A second client is rejected while the first is connected
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer second.Close()
+	waitFor(t, "busy rejection", func() bool { return s.Stats().ConnectionsRejected[RejectBusy] == 1 })
+
+	// Disconnecting puts the outputs into safe state
+	client.Close()
+	waitFor(t, "disconnect", func() bool { return s.Stats().Client == nil })
+	// The activation is counted after the client is unregistered
+	waitFor(t, "safe state", func() bool { return s.Stats().SafeStateActivations == 1 })
+	st = s.Stats()
+	if st.MessagesSent < 1 || st.EncodeFailures != 0 {
+		t.Errorf("Expected sent messages and no encode failures, got %+v", st)
+	}
+}
+
+func TestStats_Messages(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	s.SetMaxMessageSize(128)
+
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	s.clientConn = cc
+	go s.handleClient(cc)
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	go func() {
+		client.Write([]byte("not json\n"))
+		client.Write([]byte(`{"type":"write","commands":[{"type":"write-do","cardId":"9","index":0,"state":true}]}` + "\n"))
+	}()
+
+	dec := json.NewDecoder(client)
+	for i := 0; i < 2; i++ {
+		var msg map[string]interface{}
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("Failed to read reply %d: %v", i, err)
+		}
+	}
+
+	// The sent counter is bumped once the pipe write returns
+	waitFor(t, "sent count", func() bool { return s.Stats().MessagesSent == 2 })
+	st := s.Stats()
+	if st.MessagesReceived != 2 || st.ProtocolErrors != 1 || st.MessagesSent != 2 {
+		t.Errorf("Expected 2 received, 1 protocol error, 2 sent, got %+v", st)
+	}
+	if st.Client == nil || st.Client.MessagesReceived != 2 || st.Client.MessagesSent != 2 {
+		t.Errorf("Expected per-client counts of 2, got %+v", st.Client)
+	}
+}
@@ -1,42 +1,100 @@
 package tcp
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"jaspermate-utils/src/server/config"
 	"jaspermate-utils/src/server/localio"
+	"jaspermate-utils/src/server/telemetry"
 )
 
+// DefaultUpdateInterval is the default interval of the periodic card updates
+const DefaultUpdateInterval = 500 * time.Millisecond
+
 // TCPServer manages TCP connections for JasperMate IO card automation
 type TCPServer struct {
 	listener   net.Listener
 	clientConn *ClientConnection
 	mu         sync.RWMutex
-	localioMgr *localio.Manager
+	localioMgr Manager
 	stopChan   chan struct{}
 	port       string
 	version    string
 	localOnly  bool // If true, only accept connections from localhost
+	// maxMessageSize is the maximum size of one received message; longer lines are rejected
+	maxMessageSize int
+	// updateInterval is the interval of the periodic card updates
+	updateInterval time.Duration
+	// changeOnly limits the periodic updates to the cards whose values changed since they were last sent
+	changeOnly bool
+	// eventSeverity is the minimum severity of the events forwarded to the client
+	eventSeverity string
+	// sendQueueSize and slowClientPolicy bound the messages queued for a client that doesn't keep up
+	sendQueueSize    int
+	slowClientPolicy string
+	stats            serverStats
+	// clients is the registry of the clients that have connected
+	clients *clientRegistry
+	// sessionGrace is how long a disconnected client can resume its session before safe state
+	sessionGrace time.Duration
+	suspended    *suspendedSession // Session of the last client during its grace window
 }
 
 // ClientConnection represents a connected TCP client
 type ClientConnection struct {
-	conn     net.Conn
-	writer   *bufio.Writer
-	encoder  *json.Encoder
-	lastSent map[string]*localio.CardState // Track last sent state for change detection
-	mu       sync.Mutex
+	conn net.Conn
+	// queue holds the encoded messages for writeLoop, the only writer of conn
+	queue     []queuedMessage
+	queueMu   sync.Mutex
+	queued    chan struct{} // Signals writeLoop that messages were queued
+	closed    chan struct{} // Closed with the connection
+	closeOnce sync.Once
+	dropped   atomic.Uint64                 // Card updates dropped by the drop-oldest policy
+	lastSent  map[string]*localio.CardState // Track last sent state for change detection
+	seq       uint64                        // Sequence number of the last card update sent
+	mu        sync.Mutex
+	// protocol is the framing negotiated with the client's first message
+	protocol protocol
+	// subscribed are the notification topics of a JSON-RPC client
+	subscribed map[string]bool
+	// hello is the client's identity from its hello; hello and registryKey are guarded by the registry
+	hello       *HelloRequest
+	registryKey string // Key of the client's registry record once registered
+	// session is the token a reconnecting client presents to resume this connection's session
+	session string
+	// sourceID is the ID of the client's write source, the one of the previous connection once resumed
+	sourceID string
+	// sessionClaimed is set once the first message decided on the suspended session
+	sessionClaimed bool
+
+	connectedAt time.Time
+	sent        atomic.Uint64
+	received    atomic.Uint64
 }
 
 // CardUpdateMessage is sent to TCP clients
 type CardUpdateMessage struct {
-	Type  string          `json:"type"`
-	Cards []*localio.Card `json:"cards"`
+	Type string `json:"type"`
+	// Seq increases by one with every update sent on a connection (starting at 1), so gaps reveal missed updates
+	Seq uint64 `json:"seq"`
+	// BootID identifies the service run; the seq and monotonicMs of the card states restart with it
+	BootID string          `json:"bootId"`
+	Cards  []*localio.Card `json:"cards"`
 }
 
 // WelcomeMessage is sent to clients when they connect
@@ -46,42 +104,94 @@ type WelcomeMessage struct {
 	Version     string `json:"version,omitempty"`
 	Protocol    string `json:"protocol"`
 	Description string `json:"description"`
+	// Protocols are the protocols a client can select with its first message
+	Protocols []string `json:"protocols"`
+	// SessionToken resumes the connection's session after a reconnect within the session grace
+	SessionToken string `json:"sessionToken"`
 }
 
 // WriteCommandItem represents a single command in the commands array
 type WriteCommandItem struct {
-	Type   string  `json:"type"` // "write-do", "write-ao", "write-aotype", "reboot"
-	CardID string  `json:"cardId"`
-	Index  int     `json:"index"`
-	State  bool    `json:"state,omitempty"`
-	Value  float32 `json:"value,omitempty"`
-	Mode   string  `json:"mode,omitempty"`
+	// "write-do", "write-ao", "write-aotype", "reboot", "reboot-all", "sequence-start", "sequence-abort",
+	// "alarm-ack", "alarm-shelve", "alarm-unshelve"
+	Type     string  `json:"type"`
+	CardID   string  `json:"cardId"`
+	Index    int     `json:"index"`
+	State    bool    `json:"state,omitempty"`
+	Value    float32 `json:"value,omitempty"`
+	Mode     string  `json:"mode,omitempty"`
+	Sequence string  `json:"sequence,omitempty"` // For sequence-start / sequence-abort
+	// Alarm commands: the alarm, the operator performing the action, the acknowledgment comment or
+	// shelving reason, and the shelving duration
+	Alarm       string `json:"alarm,omitempty"`
+	User        string `json:"user,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+	DurationSec int    `json:"durationSec,omitempty"`
 }
 
 // WriteCommand is received from TCP clients - always contains an array of commands
 type WriteCommand struct {
-	Type     string             `json:"type"`     // Always "write"
+	Type string `json:"type"` // Always "write"
+	// ID is an optional client-chosen request ID (string or number) echoed in the write-response
+	ID       json.RawMessage    `json:"id,omitempty"`
 	Commands []WriteCommandItem `json:"commands"` // Array of individual commands
 }
 
 // WriteResponse is sent back to TCP clients
 type WriteResponse struct {
 	Type        string                  `json:"type"`                  // "write-response"
+	ID          json.RawMessage         `json:"id,omitempty"`          // Request ID from the write command
 	Status      string                  `json:"status"`                // "ok" or "error"
 	Results     []localio.CommandResult `json:"results,omitempty"`     // Results for each command
+	Code        localio.ErrorCode       `json:"code,omitempty"`        // Error code if status is "error"
 	Message     string                  `json:"message,omitempty"`     // Error message if status is "error"
 	FailedIndex int                     `json:"failedIndex,omitempty"` // Index of failed command
 }
 
 // NewTCPServer creates a new TCP server instance
-func NewTCPServer(port string, localioMgr *localio.Manager, version string, serveExternally bool) *TCPServer {
+func NewTCPServer(port string, localioMgr Manager, version string, serveExternally bool) *TCPServer {
 	return &TCPServer{
-		localioMgr: localioMgr,
-		stopChan:   make(chan struct{}),
-		port:       port,
-		version:    version,
-		localOnly:  !serveExternally,
+		localioMgr:       localioMgr,
+		stopChan:         make(chan struct{}),
+		port:             port,
+		version:          version,
+		localOnly:        !serveExternally,
+		maxMessageSize:   DefaultMaxMessageSize,
+		updateInterval:   DefaultUpdateInterval,
+		sendQueueSize:    DefaultSendQueueSize,
+		slowClientPolicy: config.SlowClientDisconnect,
+		clients:          loadClientRegistry(),
+	}
+}
+
+// SetMaxMessageSize sets the maximum size in bytes of one received message (<= 0 = default)
+// Must be called before Start
+func (s *TCPServer) SetMaxMessageSize(size int) {
+	if size <= 0 {
+		size = DefaultMaxMessageSize
 	}
+	s.maxMessageSize = size
+}
+
+// SetUpdateInterval sets the interval of the periodic card updates (<= 0 = default)
+// Must be called before Start
+func (s *TCPServer) SetUpdateInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultUpdateInterval
+	}
+	s.updateInterval = interval
+}
+
+// SetUpdateMode sets the mode of the periodic card updates: config.TCPUpdatePeriodic ("" = default) or
+// config.TCPUpdateChangeOnly. Must be called before Start
+func (s *TCPServer) SetUpdateMode(mode string) {
+	s.changeOnly = mode == config.TCPUpdateChangeOnly
+}
+
+// SetEventSeverity sets the minimum severity of the events sent to the client ("" = all events)
+// Must be called before Start
+func (s *TCPServer) SetEventSeverity(severity string) {
+	s.eventSeverity = severity
 }
 
 // Start starts the TCP server
@@ -106,6 +216,8 @@ func (s *TCPServer) Start() error {
 
 	// Register callback for immediate updates on DI/AI changes
 	s.localioMgr.SetStateChangeCallback(s.onStateChange)
+	// Forward manager events (e.g. model-mismatch) to the client
+	s.localioMgr.AddEventListener(s.onEvent)
 
 	go s.acceptLoop()
 	go s.updateLoop()
@@ -124,6 +236,31 @@ func (s *TCPServer) onStateChange(cards []*localio.Card) {
 	}
 }
 
+// onEvent forwards a manager event to the connected client; the message type is the event type
+func (s *TCPServer) onEvent(ev localio.Event) {
+	s.mu.RLock()
+	clientConn := s.clientConn
+	s.mu.RUnlock()
+
+	if clientConn == nil || !localio.SeverityAtLeast(ev.Severity, s.eventSeverity) {
+		return
+	}
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+	var msg interface{} = ev
+	switch clientConn.protocol {
+	case protocolPending:
+		return
+	case protocolJSONRPC:
+		if msg = clientConn.rpcNotification(TopicEvents, "event", ev); msg == nil {
+			return
+		}
+	}
+	if err := s.send(clientConn, msg); err != nil {
+		log.Printf("TCP: failed to send %s event: %v", ev.Type, err)
+	}
+}
+
 // Stop stops the TCP server
 func (s *TCPServer) Stop() {
 	close(s.stopChan)
@@ -132,10 +269,11 @@ func (s *TCPServer) Stop() {
 	}
 	s.mu.Lock()
 	if s.clientConn != nil {
-		s.clientConn.conn.Close()
+		s.clientConn.close()
 		s.clientConn = nil
 	}
 	s.mu.Unlock()
+	s.expireSession(nil)
 }
 
 // IsConnected returns whether a TCP client is currently connected
@@ -168,6 +306,7 @@ func (s *TCPServer) acceptLoop() {
 			if s.localOnly {
 				if !remoteAddr.IP.IsLoopback() && remoteAddr.IP.String() != "127.0.0.1" {
 					log.Printf("TCP connection rejected: non-localhost IP %s", remoteAddr.IP.String())
+					s.stats.rejectedNonLocal.Add(1)
 					conn.Close()
 					continue
 				}
@@ -177,25 +316,25 @@ func (s *TCPServer) acceptLoop() {
 			s.mu.Lock()
 			if s.clientConn != nil {
 				log.Printf("TCP connection rejected: client already connected")
+				s.stats.rejectedBusy.Add(1)
 				conn.Close()
 				s.mu.Unlock()
 				continue
 			}
 
 			// Accept the connection
-			clientConn := &ClientConnection{
-				conn:     conn,
-				writer:   bufio.NewWriter(conn),
-				encoder:  json.NewEncoder(conn),
-				lastSent: make(map[string]*localio.CardState),
-			}
+			clientConn := newClientConnection(conn)
 			s.clientConn = clientConn
 			s.mu.Unlock()
+			s.stats.accepted.Add(1)
 
 			log.Printf("TCP client connected from %s", remoteAddr.String())
+			// The client controls the outputs again
+			s.localioMgr.CancelSafeStateRetry()
 
 			// Send welcome message to identify server
 			s.sendWelcomeMessage(clientConn)
+			time.AfterFunc(negotiationTimeout, func() { clientConn.negotiate(nil) })
 
 			// Handle client in separate goroutine
 			go s.handleClient(clientConn)
@@ -205,68 +344,183 @@ func (s *TCPServer) acceptLoop() {
 
 // handleClient handles communication with a connected client
 func (s *TCPServer) handleClient(clientConn *ClientConnection) {
+	go s.writeLoop(clientConn)
+	// The connected client keeps the poll cycle at full rate
+	detach := s.localioMgr.AttachConsumer("tcp")
 	defer func() {
+		detach()
 		s.mu.Lock()
 		wasConnected := s.clientConn == clientConn
 		if wasConnected {
 			s.clientConn = nil
 		}
 		s.mu.Unlock()
-		clientConn.conn.Close()
+		clientConn.close()
+		s.clients.disconnected(clientConn)
 		log.Printf("TCP client disconnected")
 
-		// When JN (TCP client) disconnects, write all outputs to safe state
+		// When JN (TCP client) disconnects, its outputs go to safe state unless it resumes its session
 		if wasConnected {
-			log.Printf("JN disconnected - writing all outputs to safe state")
-			if err := s.localioMgr.WriteAllOutputsToSafeState(); err != nil {
-				log.Printf("Error writing outputs to safe state: %v", err)
-			}
+			s.suspendSession(clientConn)
+		} else {
+			s.localioMgr.ReleaseSource(clientConn.source())
 		}
 	}()
 
-	scanner := bufio.NewScanner(clientConn.conn)
-	for scanner.Scan() {
-		var cmd WriteCommand
-		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
-			log.Printf("TCP: failed to parse command: %v", err)
+	reader := newLineReader(clientConn.conn, s.maxMessageSize)
+	for {
+		line, err := reader.readLine()
+		if err == errMessageTooLong {
+			perr := protocolErrorf(-1, "message too long (max %d bytes)", reader.max)
+			perr.Code = CodeMessageTooLarge
+			s.countReceived(clientConn, true)
+			log.Printf("TCP: rejected command: %v", perr)
+			s.sendError(clientConn, perr)
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("TCP: client read error: %v", err)
+			}
+			return
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		s.claimSession(clientConn, line)
+		if clientConn.negotiate(line) == protocolJSONRPC {
+			s.handleRPC(clientConn, line)
+			continue
+		}
+		if messageType(line) == "schema" {
+			req, perr := ParseSchemaRequest(line)
+			s.countReceived(clientConn, perr != nil)
+			if perr != nil {
+				log.Printf("TCP: rejected schema request: %v", perr)
+				s.sendError(clientConn, perr)
+				continue
+			}
+			s.sendSchema(clientConn, *req)
 			continue
 		}
 
-		// Process write command (always expects array of commands)
-		if cmd.Type != "write" {
-			log.Printf("TCP: unknown message type: %s", cmd.Type)
+		if messageType(line) == "hello" {
+			req, perr := ParseHelloRequest(line)
+			if perr == nil {
+				perr = s.hello(clientConn, *req)
+			}
+			s.countReceived(clientConn, perr != nil)
+			if perr != nil {
+				log.Printf("TCP: rejected hello: %v", perr)
+				s.sendError(clientConn, perr)
+				continue
+			}
+			s.sendHello(clientConn, *req)
 			continue
 		}
 
-		s.processWriteCommand(&cmd, clientConn)
-	}
+		if messageType(line) == "resume" {
+			req, perr := ParseResumeRequest(line)
+			if perr == nil {
+				perr = s.resumeSession(clientConn, req.Session)
+			}
+			s.countReceived(clientConn, perr != nil)
+			if perr != nil {
+				log.Printf("TCP: rejected resume: %v", perr)
+				s.sendError(clientConn, perr)
+				continue
+			}
+			s.sendResume(clientConn, *req)
+			continue
+		}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("TCP: client read error: %v", err)
+		if messageType(line) == "ai-stats" {
+			req, perr := ParseAIStatsRequest(line)
+			s.countReceived(clientConn, perr != nil)
+			if perr != nil {
+				log.Printf("TCP: rejected AI statistics request: %v", perr)
+				s.sendError(clientConn, perr)
+				continue
+			}
+			s.sendAIStats(clientConn, *req)
+			continue
+		}
+
+		// Parse and validate the command (a write batch)
+		cmd, perr := ParseWriteCommand(line)
+		s.countReceived(clientConn, perr != nil)
+		if perr != nil {
+			log.Printf("TCP: rejected command: %v", perr)
+			s.sendError(clientConn, perr)
+			continue
+		}
+
+		s.processWriteCommand(cmd, clientConn)
 	}
 }
 
+// source is the write source of the client's commands
+func (c *ClientConnection) source() localio.WriteSource {
+	return localio.WriteSource{Kind: localio.SourceTCP, ID: c.sourceID}
+}
+
 // processWriteCommand processes a write command from TCP client (always expects array of commands)
 func (s *TCPServer) processWriteCommand(cmd *WriteCommand, clientConn *ClientConnection) {
+	s.sendResponse(clientConn, s.executeWriteCommand(cmd, clientConn))
+}
+
+// executeWriteCommand executes the commands of a write batch and returns the response
+func (s *TCPServer) executeWriteCommand(cmd *WriteCommand, clientConn *ClientConnection) WriteResponse {
+	ctx, span := telemetry.Tracer().Start(context.Background(), "tcp.write",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("commands", len(cmd.Commands)),
+			attribute.String("request.id", string(cmd.ID)),
+		))
+	defer span.End()
+
+	s.clients.countCommands(clientConn, len(cmd.Commands))
+	response := ExecuteWrite(localio.WithSource(ctx, clientConn.source()), s.localioMgr, cmd)
+	if response.Status == "error" {
+		span.SetStatus(codes.Error, response.Message)
+	}
+	return response
+}
+
+// ExecuteWrite executes the commands of a validated write batch as the write source of ctx and returns
+// the write-response. Other transports accepting the TCP batch schema use it too.
+func ExecuteWrite(ctx context.Context, localioMgr Executor, cmd *WriteCommand) WriteResponse {
 	if len(cmd.Commands) == 0 {
 		response := WriteResponse{
 			Type:    "write-response",
+			ID:      cmd.ID,
 			Status:  "error",
+			Code:    localio.CodeInvalidRequest,
 			Message: "no commands in batch",
 		}
-		clientConn.encoder.Encode(response)
-		return
+		return response
 	}
 
 	// Separate write operations from reboot commands
 	ops := make([]localio.WriteOperation, 0, len(cmd.Commands))
-	rebootIndices := make([]int, 0) // Track indices of reboot commands
+	rebootIndices := make([]int, 0)   // Track indices of reboot commands
+	sequenceIndices := make([]int, 0) // Track indices of sequence commands
+	alarmIndices := make([]int, 0)    // Track indices of alarm commands
 
 	for i, cmdItem := range cmd.Commands {
-		if cmdItem.Type == "reboot" {
+		if cmdItem.Type == "reboot" || cmdItem.Type == "reboot-all" {
 			rebootIndices = append(rebootIndices, i)
 			continue
 		}
+		if cmdItem.Type == "sequence-start" || cmdItem.Type == "sequence-abort" {
+			sequenceIndices = append(sequenceIndices, i)
+			continue
+		}
+		if strings.HasPrefix(cmdItem.Type, "alarm-") {
+			alarmIndices = append(alarmIndices, i)
+			continue
+		}
 
 		op := localio.WriteOperation{
 			CardID: cmdItem.CardID,
@@ -299,11 +553,68 @@ func (s *TCPServer) processWriteCommand(cmd *WriteCommand, clientConn *ClientCon
 	// Process reboot commands first
 	for _, idx := range rebootIndices {
 		cmdItem := cmd.Commands[idx]
-		err := s.localioMgr.RebootCard(cmdItem.CardID)
+		var err error
+		if cmdItem.Type == "reboot-all" {
+			err = rebootAllError(localioMgr.RebootAll())
+		} else {
+			err = localioMgr.RebootCard(cmdItem.CardID)
+		}
 		if err != nil {
 			results[idx] = localio.CommandResult{
 				Index:   idx,
 				Status:  "error",
+				Code:    localio.ErrorCodeOf(err),
+				Message: err.Error(),
+			}
+		} else {
+			results[idx] = localio.CommandResult{
+				Index:  idx,
+				Status: "ok",
+			}
+		}
+	}
+
+	// Start/abort sequences (they run in the background)
+	for _, idx := range sequenceIndices {
+		cmdItem := cmd.Commands[idx]
+		var err error
+		if cmdItem.Type == "sequence-start" {
+			err = localioMgr.StartSequence(cmdItem.Sequence)
+		} else {
+			err = localioMgr.AbortSequence(cmdItem.Sequence)
+		}
+		if err != nil {
+			results[idx] = localio.CommandResult{
+				Index:   idx,
+				Status:  "error",
+				Code:    localio.ErrorCodeOf(err),
+				Message: err.Error(),
+			}
+		} else {
+			results[idx] = localio.CommandResult{
+				Index:  idx,
+				Status: "ok",
+			}
+		}
+	}
+
+	// Acknowledge and shelve alarms
+	for _, idx := range alarmIndices {
+		cmdItem := cmd.Commands[idx]
+		var err error
+		switch cmdItem.Type {
+		case "alarm-ack":
+			err = localioMgr.AcknowledgeAlarm(cmdItem.Alarm, cmdItem.User, cmdItem.Comment)
+		case "alarm-shelve":
+			err = localioMgr.ShelveAlarm(cmdItem.Alarm, cmdItem.User, cmdItem.Comment, time.Duration(cmdItem.DurationSec)*time.Second)
+		case "alarm-unshelve":
+			err = localioMgr.UnshelveAlarm(cmdItem.Alarm, cmdItem.User)
+		}
+		if err != nil {
+			results[idx] = localio.CommandResult{
+				Index:   idx,
+				Status:  "error",
+				Code:    localio.ErrorCodeOf(err),
 				Message: err.Error(),
 			}
 		} else {
@@ -316,7 +627,7 @@ func (s *TCPServer) processWriteCommand(cmd *WriteCommand, clientConn *ClientCon
 
 	// Process write operations if any
 	if len(ops) > 0 {
-		writeResults := s.localioMgr.ProcessBatchWrite(ops)
+		writeResults := localioMgr.ProcessBatchWriteContext(ctx, ops)
 
 		// Map write results back to original command indices
 		// Create a mapping: original command index -> write operation index
@@ -341,12 +652,15 @@ func (s *TCPServer) processWriteCommand(cmd *WriteCommand, clientConn *ClientCon
 		responseResults[i] = localio.CommandResult{
 			Index:   result.Index,
 			Status:  result.Status,
+			Code:    result.Code,
 			Message: result.Message,
+			Params:  result.Params,
 		}
 	}
 
 	response := WriteResponse{
 		Type:    "write-response",
+		ID:      cmd.ID,
 		Status:  "ok",
 		Results: responseResults,
 	}
@@ -356,18 +670,58 @@ func (s *TCPServer) processWriteCommand(cmd *WriteCommand, clientConn *ClientCon
 		if result.Status == "error" {
 			response.Status = "error"
 			response.FailedIndex = i
+			response.Code = result.Code
 			response.Message = result.Message
 			break
 		}
 	}
+	return response
+}
 
-	clientConn.encoder.Encode(response)
+// rebootAllError returns the first failed reboot of RebootAll as an error, with the number of failures
+func rebootAllError(results []localio.RebootResult) error {
+	failed := 0
+	var first localio.RebootResult
+	for _, result := range results {
+		if result.Status == "error" {
+			if failed == 0 {
+				first = result
+			}
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return &localio.Error{
+		Code:    first.Code,
+		Message: fmt.Sprintf("%d of %d cards failed to reboot, card %s: %s", failed, len(results), first.CardID, first.Message),
+	}
+}
+
+// sendResponse sends a write response to the TCP client
+func (s *TCPServer) sendResponse(clientConn *ClientConnection, response WriteResponse) {
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+
+	if err := s.send(clientConn, response); err != nil {
+		log.Printf("TCP: failed to send write response: %v", err)
+	}
+}
+
+// countReceived counts a received message and whether it was rejected as invalid
+func (s *TCPServer) countReceived(clientConn *ClientConnection, invalid bool) {
+	s.stats.received.Add(1)
+	clientConn.received.Add(1)
+	if invalid {
+		s.stats.protocolErrors.Add(1)
+	}
 }
 
-// updateLoop sends periodic updates (500ms) for all card data
-// Immediate updates on DI/AI changes are handled by onStateChange callback
+// updateLoop sends periodic updates (every updateInterval) for all card data, or in change-only mode for
+// the cards whose values changed. Immediate updates on DI/AI changes are handled by onStateChange callback
 func (s *TCPServer) updateLoop() {
-	ticker := time.NewTicker(500 * time.Millisecond)
+	ticker := time.NewTicker(s.updateInterval)
 	defer ticker.Stop()
 
 	for {
@@ -385,6 +739,9 @@ func (s *TCPServer) updateLoop() {
 
 			// Get current cards and send periodic update
 			cards := s.localioMgr.GetAllCards()
+			if s.changeOnly {
+				cards = clientConn.changedCards(cards)
+			}
 			if len(cards) > 0 {
 				s.sendUpdate(clientConn, cards)
 			}
@@ -403,24 +760,53 @@ func (s *TCPServer) sendWelcomeMessage(clientConn *ClientConnection) {
 		Version:     s.version,
 		Protocol:    "JSON",
 		Description: "ControlMate Extension cards TCP server - sends card state updates and accepts write commands",
+		Protocols:   []string{"json", "jsonrpc"},
+
+		SessionToken: clientConn.session,
 	}
 
-	if err := clientConn.encoder.Encode(msg); err != nil {
+	if err := s.send(clientConn, msg); err != nil {
 		log.Printf("TCP: failed to send welcome message: %v", err)
 	}
 }
 
+// sendError reports a rejected command to the TCP client
+func (s *TCPServer) sendError(clientConn *ClientConnection, perr *ProtocolError) {
+	clientConn.mu.Lock()
+	defer clientConn.mu.Unlock()
+
+	var msg interface{} = perr.ToMessage()
+	if clientConn.protocol == protocolJSONRPC {
+		msg = rpcErrorResponse(perr.ID, RPCInvalidRequest, perr.Error())
+	}
+	if err := s.send(clientConn, msg); err != nil {
+		log.Printf("TCP: failed to send error: %v", err)
+	}
+}
+
 // sendUpdate sends card update to TCP client
 func (s *TCPServer) sendUpdate(clientConn *ClientConnection, cards []*localio.Card) {
 	clientConn.mu.Lock()
 	defer clientConn.mu.Unlock()
 
-	msg := CardUpdateMessage{
-		Type:  "card-update",
-		Cards: cards,
+	if clientConn.protocol == protocolPending {
+		return
+	}
+	if clientConn.protocol == protocolJSONRPC && !clientConn.subscribed[TopicCards] {
+		return
+	}
+	clientConn.seq++
+	var msg interface{} = CardUpdateMessage{
+		Type:   "card-update",
+		Seq:    clientConn.seq,
+		BootID: s.localioMgr.BootID(),
+		Cards:  cards,
+	}
+	if clientConn.protocol == protocolJSONRPC {
+		msg = clientConn.rpcNotification(TopicCards, "cards", msg)
 	}
 
-	if err := clientConn.encoder.Encode(msg); err != nil {
+	if err := s.enqueue(clientConn, msg, true); err != nil {
 		log.Printf("TCP: failed to send update: %v", err)
 		// Connection might be broken, will be cleaned up in handleClient
 		return
@@ -432,3 +818,26 @@ func (s *TCPServer) sendUpdate(clientConn *ClientConnection, cards []*localio.Ca
 		clientConn.lastSent[card.ID] = &stateCopy
 	}
 }
+
+// changedCards returns the cards whose values differ from the state last sent to the client; a card that
+// was never sent counts as changed
+func (c *ClientConnection) changedCards(cards []*localio.Card) []*localio.Card {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var changed []*localio.Card
+	for _, card := range cards {
+		if last, ok := c.lastSent[card.ID]; !ok || valuesChanged(*last, card.Last) {
+			changed = append(changed, card)
+		}
+	}
+	return changed
+}
+
+// valuesChanged reports whether two states of a card differ in more than their timestamps and sequence
+// numbers
+func valuesChanged(a, b localio.CardState) bool {
+	for _, st := range []*localio.CardState{&a, &b} {
+		st.Timestamp, st.Seq, st.MonotonicMs, st.IdentityReadAt, st.LastGood = time.Time{}, 0, 0, time.Time{}, time.Time{}
+	}
+	return !reflect.DeepEqual(a, b)
+}
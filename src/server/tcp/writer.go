@@ -0,0 +1,159 @@
+package tcp
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+// DefaultSendQueueSize is the default number of messages queued for a client that doesn't keep up
+const DefaultSendQueueSize = 256
+
+var (
+	errConnectionClosed = errors.New("connection closed")
+	errSendQueueFull    = errors.New("send queue full")
+)
+
+// queuedMessage is an encoded message waiting for the client's writer
+type queuedMessage struct {
+	data []byte
+	// update marks card updates, which the drop-oldest policy may drop: the next update supersedes them
+	update bool
+}
+
+// newClientConnection creates the connection state of an accepted client. Its messages are written by
+// writeLoop, which handleClient starts.
+func newClientConnection(conn net.Conn) *ClientConnection {
+	return &ClientConnection{
+		conn:        conn,
+		queued:      make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+		lastSent:    make(map[string]*localio.CardState),
+		connectedAt: time.Now(),
+		protocol:    protocolPending,
+		session:     newSessionToken(),
+		sourceID:    conn.RemoteAddr().String(),
+	}
+}
+
+// close closes the connection and stops its writer; the reader in handleClient then cleans up
+func (c *ClientConnection) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// SetSendQueue sets the send queue size per client (<= 0 = default) and the policy for a client whose
+// queue is full ("" = disconnect). Must be called before Start
+func (s *TCPServer) SetSendQueue(size int, policy string) {
+	if size <= 0 {
+		size = DefaultSendQueueSize
+	}
+	if policy == "" {
+		policy = config.SlowClientDisconnect
+	}
+	s.sendQueueSize = size
+	s.slowClientPolicy = policy
+}
+
+// send encodes one message and queues it for the client's writer. The caller must hold clientConn.mu, so
+// messages are queued in the order their sequence numbers were assigned. Sending never blocks.
+func (s *TCPServer) send(clientConn *ClientConnection, msg interface{}) error {
+	return s.enqueue(clientConn, msg, false)
+}
+
+// enqueue queues a message. If the client's queue is full, the drop-oldest policy makes room by dropping
+// the oldest queued card update; otherwise, or if only responses and events are queued, the client is
+// disconnected.
+func (s *TCPServer) enqueue(clientConn *ClientConnection, msg interface{}, update bool) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.stats.encodeFailures.Add(1)
+		return err
+	}
+	data = append(data, '\n')
+
+	select {
+	case <-clientConn.closed:
+		return errConnectionClosed
+	default:
+	}
+
+	clientConn.queueMu.Lock()
+	if len(clientConn.queue) >= s.sendQueueSize && !s.dropOldestUpdate(clientConn) {
+		n := len(clientConn.queue)
+		clientConn.queueMu.Unlock()
+		log.Printf("TCP: client stopped reading (%d messages queued), disconnecting", n)
+		s.stats.slowClientDisconnects.Add(1)
+		clientConn.close()
+		return errSendQueueFull
+	}
+	clientConn.queue = append(clientConn.queue, queuedMessage{data: data, update: update})
+	clientConn.queueMu.Unlock()
+
+	select {
+	case clientConn.queued <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// dropOldestUpdate removes the oldest queued card update under the drop-oldest policy and reports whether
+// one was dropped. The caller must hold clientConn.queueMu.
+func (s *TCPServer) dropOldestUpdate(clientConn *ClientConnection) bool {
+	if s.slowClientPolicy != config.SlowClientDropOldest {
+		return false
+	}
+	for i, m := range clientConn.queue {
+		if m.update {
+			clientConn.queue = append(clientConn.queue[:i], clientConn.queue[i+1:]...)
+			s.stats.updatesDropped.Add(1)
+			clientConn.dropped.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+// queueLength returns the number of messages waiting to be written to the client
+func (c *ClientConnection) queueLength() int {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	return len(c.queue)
+}
+
+// writeLoop is the only writer of a client's socket: it writes the queued messages in order and counts
+// them until the connection is closed
+func (s *TCPServer) writeLoop(clientConn *ClientConnection) {
+	for {
+		select {
+		case <-clientConn.closed:
+			return
+		case <-clientConn.queued:
+		}
+		for {
+			clientConn.queueMu.Lock()
+			if len(clientConn.queue) == 0 {
+				clientConn.queueMu.Unlock()
+				break
+			}
+			m := clientConn.queue[0]
+			clientConn.queue = clientConn.queue[1:]
+			clientConn.queueMu.Unlock()
+
+			if _, err := clientConn.conn.Write(m.data); err != nil {
+				log.Printf("TCP: write failed: %v", err)
+				clientConn.close()
+				return
+			}
+			s.stats.sent.Add(1)
+			clientConn.sent.Add(1)
+		}
+	}
+}
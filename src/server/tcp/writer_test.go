@@ -0,0 +1,136 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"jaspermate-utils/src/server/config"
+	"jaspermate-utils/src/server/localio"
+)
+
+func TestWriteLoop_ConcurrentSends(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	cc.protocol = protocolJSON
+	defer cc.close()
+	go s.writeLoop(cc)
+
+	// Updates, events and responses are sent from different goroutines
+	const senders, messages = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				s.sendUpdate(cc, []*localio.Card{{ID: "1", Module: "IO4040"}})
+			}
+		}()
+	}
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	lines := bufio.NewScanner(client)
+	for want := uint64(1); want <= senders*messages; want++ {
+		if !lines.Scan() {
+			t.Fatalf("Failed to read message %d: %v", want, lines.Err())
+		}
+		var msg CardUpdateMessage
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil {
+			t.Fatalf("Message %d is corrupted: %v", want, err)
+		}
+		if msg.Seq != want {
+			t.Fatalf("Expected seq %d, got %d", want, msg.Seq)
+		}
+	}
+	wg.Wait()
+}
+
+func TestSend_ClientNotReading(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	go s.writeLoop(cc)
+
+	// The client never reads: sends queue up without blocking until the queue is full
+	done := make(chan error)
+	go func() {
+		var err error
+		for i := 0; i <= DefaultSendQueueSize+1 && err == nil; i++ {
+			err = s.send(cc, map[string]int{"n": i})
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != errSendQueueFull {
+			t.Errorf("Expected errSendQueueFull, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("send blocked on a client that doesn't read")
+	}
+	if err := s.send(cc, "late"); err != errConnectionClosed {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+	if st := s.Stats(); st.SlowClientDisconnects != 1 || st.UpdatesDropped != 0 {
+		t.Errorf("Expected one slow client disconnect, got %+v", st)
+	}
+}
+
+func TestSend_DropOldest(t *testing.T) {
+	s := NewTCPServer("0", localio.NewManager(), "test", false)
+	s.SetSendQueue(3, config.SlowClientDropOldest)
+	serverConn, client := net.Pipe()
+	defer client.Close()
+	cc := newClientConnection(serverConn)
+	cc.protocol = protocolJSON
+	defer cc.close()
+
+	// Without a writer nothing leaves the queue: a response and two updates fill it
+	s.sendResponse(cc, WriteResponse{Type: "write-response", Status: "ok"})
+	s.sendUpdate(cc, nil)
+	s.sendUpdate(cc, nil)
+	s.sendUpdate(cc, nil)                                                      // drops update 1
+	s.sendResponse(cc, WriteResponse{Type: "write-response", Status: "error"}) // drops update 2
+	if st := s.Stats(); st.UpdatesDropped != 2 || st.SlowClientDisconnects != 0 {
+		t.Fatalf("Expected 2 dropped updates, got %+v", st)
+	}
+
+	go s.writeLoop(cc)
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	dec := json.NewDecoder(client)
+	var got []string
+	for i := 0; i < 3; i++ {
+		var msg struct {
+			Type   string `json:"type"`
+			Seq    uint64 `json:"seq"`
+			Status string `json:"status"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("Failed to read message %d: %v", i, err)
+		}
+		got = append(got, fmt.Sprintf("%s/%d/%s", msg.Type, msg.Seq, msg.Status))
+	}
+	want := []string{"write-response/0/ok", "card-update/3/", "write-response/0/error"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// With only responses queued there's nothing to drop: the client is disconnected
+	s.SetSendQueue(1, config.SlowClientDropOldest)
+	serverConn2, client2 := net.Pipe()
+	defer client2.Close()
+	cc2 := newClientConnection(serverConn2)
+	s.send(cc2, "first")
+	if err := s.send(cc2, "second"); err != errSendQueueFull {
+		t.Errorf("Expected errSendQueueFull, got %v", err)
+	}
+}
@@ -2,33 +2,203 @@ package util
 
 import (
 	"bufio"
+	"fmt"
+	"io"
+	"log"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// LoadEnvLocal reads a value from .env.local file by key
-// Returns the value if found, empty string otherwise
-func LoadEnvLocal(key string) string {
-	file, err := os.Open(".env.local")
+// envLocalPath is the env file read by the package-level accessors
+const envLocalPath = ".env.local"
+
+// EnvFile holds the variables of a parsed env file
+type EnvFile struct {
+	values map[string]string
+}
+
+// LoadEnvFile parses an env file. Supported syntax:
+//
+//	KEY=value            # inline comment
+//	export KEY=value
+//	KEY="double quoted\nwith escapes"
+//	KEY='single quoted, taken literally'
+func LoadEnvFile(path string) (*EnvFile, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return ""
+		return nil, err
 	}
 	defer file.Close()
+	return ParseEnv(file)
+}
 
-	scanner := bufio.NewScanner(file)
+// ParseEnv parses env file content; see LoadEnvFile for the syntax. Malformed lines are logged and
+// skipped, so one bad line doesn't drop the other variables of the file.
+func ParseEnv(r io.Reader) (*EnvFile, error) {
+	env := &EnvFile{values: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
 	for scanner.Scan() {
+		lineNo++
 		line := strings.TrimSpace(scanner.Text())
-		if strings.HasPrefix(line, "#") {
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			k := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			if k == key {
-				return strings.Trim(value, "\"'")
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			log.Printf("env: ignoring line %d: expected KEY=value", lineNo)
+			continue
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			log.Printf("env: ignoring line %d (%s): %v", lineNo, key, err)
+			continue
+		}
+		env.values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// parseEnvValue unquotes a value and strips inline comments from unquoted values
+func parseEnvValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	switch v[0] {
+	case '\'':
+		end := strings.IndexByte(v[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		return v[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			c := v[i]
+			switch {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(v):
+				i++
+				switch v[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(v[i])
+				}
+			default:
+				b.WriteByte(c)
 			}
 		}
+		return "", fmt.Errorf("unterminated double quote")
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
+
+// Lookup returns the value of key in the file
+func (e *EnvFile) Lookup(key string) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	v, ok := e.values[key]
+	return v, ok
+}
+
+var (
+	envLocal     *EnvFile
+	envLocalOnce sync.Once
+)
+
+// localEnv returns the parsed .env.local file (nil if missing or unreadable); it is read once
+func localEnv() *EnvFile {
+	envLocalOnce.Do(func() {
+		env, err := LoadEnvFile(envLocalPath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("env: ignoring %s: %v", envLocalPath, err)
+			}
+			return
+		}
+		envLocal = env
+	})
+	return envLocal
+}
+
+// Lookup returns the value of an environment variable, falling back to .env.local.
+// The process environment wins so deployments can override the file.
+func Lookup(key string) (string, bool) {
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	return localEnv().Lookup(key)
+}
+
+// LoadEnvLocal reads a value from .env.local file by key
+// Returns the value if found, empty string otherwise
+func LoadEnvLocal(key string) string {
+	v, _ := localEnv().Lookup(key)
+	return v
+}
+
+// GetString returns the variable, or def if it is unset or empty
+func GetString(key, def string) string {
+	if v, ok := Lookup(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// GetInt returns the variable as an integer, or def if it is unset or invalid
+func GetInt(key string, def int) int {
+	v, ok := Lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("env: ignoring %s=%q: not an integer", key, v)
+		return def
+	}
+	return n
+}
+
+// GetBool returns the variable as a boolean (1/0, true/false, ...), or def if it is unset or invalid
+func GetBool(key string, def bool) bool {
+	v, ok := Lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("env: ignoring %s=%q: not a boolean", key, v)
+		return def
+	}
+	return b
+}
+
+// GetDuration returns the variable as a duration ("500ms", "1m30s"), or def if it is unset or invalid
+func GetDuration(key string, def time.Duration) time.Duration {
+	v, ok := Lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("env: ignoring %s=%q: not a duration", key, v)
+		return def
 	}
-	return ""
+	return d
 }
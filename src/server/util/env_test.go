@@ -0,0 +1,77 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEnv(t *testing.T) {
+	content := `# comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded  # trailing comment
+DOUBLE="a \"quoted\" # value\nnext"
+SINGLE='literal \n # kept'
+HASH=abc#def
+EMPTY=
+`
+	env, err := ParseEnv(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ParseEnv failed: %v", err)
+	}
+	want := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "yes",
+		"SPACED":   "padded",
+		"DOUBLE":   "a \"quoted\" # value\nnext",
+		"SINGLE":   `literal \n # kept`,
+		"HASH":     "abc#def",
+		"EMPTY":    "",
+	}
+	for k, v := range want {
+		if got, ok := env.Lookup(k); !ok || got != v {
+			t.Errorf("%s: got %q (found=%v), want %q", k, got, ok, v)
+		}
+	}
+
+	// Malformed lines are skipped, the other variables are kept
+	for _, bad := range []string{"NOEQUALS", `KEY="unterminated`, "BAD KEY=1"} {
+		env, err := ParseEnv(strings.NewReader("BEFORE=1\n" + bad + "\nAFTER=2\n"))
+		if err != nil {
+			t.Fatalf("ParseEnv failed: %v", err)
+		}
+		if _, ok := env.Lookup("KEY"); ok {
+			t.Errorf("Expected %q to be skipped", bad)
+		}
+		if v, _ := env.Lookup("BEFORE"); v != "1" {
+			t.Errorf("Expected BEFORE kept around %q, got %q", bad, v)
+		}
+		if v, _ := env.Lookup("AFTER"); v != "2" {
+			t.Errorf("Expected AFTER kept around %q, got %q", bad, v)
+		}
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	t.Setenv("UTIL_TEST_INT", "42")
+	t.Setenv("UTIL_TEST_BAD_INT", "x")
+	t.Setenv("UTIL_TEST_BOOL", "true")
+	t.Setenv("UTIL_TEST_DURATION", "1m30s")
+
+	if got := GetInt("UTIL_TEST_INT", 1); got != 42 {
+		t.Errorf("GetInt: got %d", got)
+	}
+	if got := GetInt("UTIL_TEST_BAD_INT", 7); got != 7 {
+		t.Errorf("GetInt with invalid value: got %d, want default", got)
+	}
+	if !GetBool("UTIL_TEST_BOOL", false) {
+		t.Error("GetBool: expected true")
+	}
+	if got := GetDuration("UTIL_TEST_DURATION", 0); got != 90*time.Second {
+		t.Errorf("GetDuration: got %s", got)
+	}
+	if got := GetString("UTIL_TEST_UNSET", "def"); got != "def" {
+		t.Errorf("GetString: got %q, want default", got)
+	}
+}